@@ -4,12 +4,16 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"github.com/square/finch"
 	"github.com/square/finch/boot"
 )
 
 func main() {
-	if err := boot.Up(boot.Env{}); err != nil {
-		log.Fatal(err)
+	err := boot.Up(boot.Env{})
+	if err != nil {
+		log.Println(err)
 	}
+	os.Exit(finch.ExitCode(err)) // see finch.EXIT_*
 }
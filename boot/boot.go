@@ -3,16 +3,30 @@
 package boot
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"time"
 
+	human "github.com/dustin/go-humanize"
+
 	"github.com/square/finch"
+	"github.com/square/finch/builtin"
 	"github.com/square/finch/compute"
 	"github.com/square/finch/config"
+	"github.com/square/finch/console"
+	"github.com/square/finch/data"
+	"github.com/square/finch/dbconn"
+	"github.com/square/finch/plot"
+	"github.com/square/finch/proto"
+	"github.com/square/finch/record"
+	"github.com/square/finch/replay"
+	"github.com/square/finch/stage"
 )
 
 func init() {
@@ -39,11 +53,42 @@ func Up(env Env) error {
 	// Parse command line
 	cmdline, err := ParseCommandLine(env.Args)
 	if err != nil {
-		return err
+		return finch.ConfigError(err)
 	}
 
-	// Set global debug var first because all code calls finch.Debug
+	// Set log output, format, and global debug var first because all code logs
+	// and calls finch.Debug
+	logMaxSize, err := human.ParseBytes(cmdline.Options.LogMaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --log-max-size %s: %s", cmdline.Options.LogMaxSize, err)
+	}
+	if cmdline.Options.LogMaxFiles < 0 {
+		return fmt.Errorf("invalid --log-max-files %d: must be >= 0", cmdline.Options.LogMaxFiles)
+	}
+	if cmdline.Options.LogFile != "" {
+		lf, err := finch.NewLogFile(cmdline.Options.LogFile, int64(logMaxSize), cmdline.Options.LogMaxFiles)
+		if err != nil {
+			return fmt.Errorf("--log-file: %s", err)
+		}
+		defer lf.Close()
+		finch.SetLogOutput(lf)
+	}
+	switch cmdline.Options.LogFormat {
+	case finch.LOG_FORMAT_TEXT, finch.LOG_FORMAT_JSON:
+		finch.SetLogFormat(cmdline.Options.LogFormat)
+	default:
+		return fmt.Errorf("invalid --log-format %s: valid formats are %s and %s", cmdline.Options.LogFormat, finch.LOG_FORMAT_TEXT, finch.LOG_FORMAT_JSON)
+	}
+	if cmdline.Options.ErrorLog != "" {
+		ef, err := finch.NewLogFile(cmdline.Options.ErrorLog, int64(logMaxSize), cmdline.Options.LogMaxFiles)
+		if err != nil {
+			return fmt.Errorf("--error-log: %s", err)
+		}
+		defer ef.Close()
+		finch.SetErrorLog(ef, cmdline.Options.LogFormat == finch.LOG_FORMAT_JSON)
+	}
 	finch.Debugging = cmdline.Options.Debug
+	finch.Verbose = cmdline.Options.Verbose
 	finch.Debug("finch %s %+v", finch.VERSION, cmdline)
 
 	// Return early (don't boot/run) --help and --verison
@@ -56,23 +101,100 @@ func Up(env Env) error {
 		return nil
 	}
 
+	// Print JSON Schema (finch schema [stage|all|plan]) before logging so the output is
+	// only the schema
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "schema" {
+		file := ""
+		if len(cmdline.Args) > 2 {
+			file = cmdline.Args[2]
+		}
+		schema, err := config.Schema(file)
+		if err != nil {
+			return err
+		}
+		bytes, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
 	log.Println(finch.SystemParams)
 
-	// Catch CTRL-C and cancel the main context, which should cause a clean shutdown
+	// --max-runtime: stop gracefully like CTRL-C after this long
+	var maxRuntime <-chan time.Time
+	if cmdline.Options.MaxRuntime != "" {
+		d, err := time.ParseDuration(cmdline.Options.MaxRuntime)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid --max-runtime %s: must be a duration greater than zero, like 2h", cmdline.Options.MaxRuntime)
+		}
+		maxRuntime = time.After(d)
+	}
+
+	// Catch CTRL-C. If stages are running, the first CTRL-C stops them gracefully:
+	// clients finish their current iteration, then stages report final stats as
+	// usual. The graceful stop is per run (see finch.WithStop), so a server
+	// keeps running the next job or scheduled run. CTRL-C while stopping, or the
+	// first if no stages are running, cancels the main context, which aborts
+	// everything but should still cause a clean shutdown.
 	ctxFinch, cancelFinch := context.WithCancel(context.Background())
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
-		<-c
-		log.Println("Caught CTRL-C")
+	SIGNAL:
+		for {
+			select {
+			case <-c:
+				log.Println("Caught CTRL-C")
+			case <-maxRuntime:
+				log.Printf("--max-runtime %s elapsed", cmdline.Options.MaxRuntime)
+			}
+			if stage.Running() == 0 {
+				break SIGNAL
+			}
+			log.Println("Stopping gracefully: clients finish current iteration (CTRL-C again to abort)")
+			finch.Stop()
+			for stage.Running() > 0 {
+				select {
+				case <-c:
+					log.Println("Caught CTRL-C again, aborting")
+					break SIGNAL
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+		}
 		cancelFinch()
 		// Fail-safe: if something doesn't respond to the ctx cancellation,
-		// this guarantees that Finch will terminate on CTRL-C after 7.5s.
-		<-time.After(7500 * time.Millisecond) // 7.5s
+		// this guarantees that Finch will terminate after 7.5s, or now on
+		// CTRL-C again. Never after a graceful stop because that doesn't
+		// cancel the main context.
+		select {
+		case <-c:
+		case <-time.After(7500 * time.Millisecond): // 7.5s
+		}
 		log.Println("Forcing exit(1) because stage did not respond to context cancellation")
 		os.Exit(1)
 	}()
 
+	// SIGUSR1 prints a snapshot of running stages without interrupting them
+	if len(snapshotSignals) > 0 {
+		go func() {
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, snapshotSignals...)
+			for range c {
+				snapshot()
+			}
+		}()
+	}
+
+	// --debug-addr: pprof and expvar for diagnosing Finch itself
+	if cmdline.Options.DebugAddr != "" {
+		if err := startDebugServer(cmdline.Options.DebugAddr); err != nil {
+			return fmt.Errorf("--debug-addr: %s", err)
+		}
+	}
+
 	// Set up --cpu-profile that's started/stopped in stage just around execution
 	if cmdline.Options.CPUProfile != "" {
 		f, err := os.Create(cmdline.Options.CPUProfile)
@@ -82,33 +204,563 @@ func Up(env Env) error {
 		finch.CPUProfile = f
 	}
 
+	// --net-latency, --net-jitter, and --net-bandwidth: shape MySQL connections
+	// on this compute instance (local or client)
+	shape, err := netShape(cmdline.Options)
+	if err != nil {
+		return err
+	}
+	dbconn.SetShape(shape)
+
 	//  If --client specified, run in client mode connected to a Finch server.
 	// In client mode, we don't need a config file because everything is fetched
 	// from the server.
 	if serverAddr := cmdline.Options.Client; serverAddr != "" {
 		clientName, _ := os.Hostname()
-		client := compute.NewClient(clientName, finch.WithPort(serverAddr, finch.DEFAULT_SERVER_PORT))
+		auth, err := computeAuth(cmdline.Options)
+		if err != nil {
+			return err
+		}
+		client, err := compute.NewClient(clientName, finch.WithPort(serverAddr, finch.DEFAULT_SERVER_PORT), auth)
+		if err != nil {
+			return err
+		}
+		client.Standing = cmdline.Options.Standing
 		return client.Run(ctxFinch)
 	}
 
+	// ----------------------------------------------------------------------
+	// Record mode: finch record
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "record" {
+		return runRecord(ctxFinch, cmdline.Options)
+	}
+
+	// ----------------------------------------------------------------------
+	// Validate mode: finch validate
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "validate" {
+		return runValidate(cmdline.Args[2:], cmdline.Options)
+	}
+
+	// ----------------------------------------------------------------------
+	// Console mode: finch console
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "console" {
+		return runConsole(ctxFinch, cmdline.Args[2:], cmdline.Options)
+	}
+
+	// ----------------------------------------------------------------------
+	// Plot mode: finch plot
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "plot" {
+		return runPlot(cmdline.Args[2:], cmdline.Options)
+	}
+
+	// ----------------------------------------------------------------------
+	// Init mode: finch init
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "init" {
+		return runInit(cmdline.Args[2:], cmdline.Options)
+	}
+
+	// ----------------------------------------------------------------------
+	// Submit mode: finch --server ADDR submit
+	if len(cmdline.Args) > 1 && cmdline.Args[1] == "submit" {
+		return runSubmit(ctxFinch, cmdline.Args[2:], cmdline.Options)
+	}
+
 	// ----------------------------------------------------------------------
 	// Server mode (default)
 
+	// --builtin: write built-in benchmark files to a temp dir and load them
+	// like stage files specified on the command line. --param overrides the
+	// params set by built-in options like --tables.
+	stageFiles := cmdline.Args[1:]
+	params := cmdline.Options.Params
+	if cmdline.Options.Builtin != "" {
+		if len(stageFiles) > 0 {
+			log.Fatal("--builtin and stage files are mutually exclusive; specify one or the other")
+		}
+		dir, err := os.MkdirTemp("", "finch-builtin-")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		opts := builtin.Options{
+			Tables:    cmdline.Options.Tables,
+			TableSize: cmdline.Options.TableSize,
+		}
+		var builtinParams []string
+		stageFiles, builtinParams, err = builtin.Load(cmdline.Options.Builtin, opts, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		params = append(builtinParams, params...)
+	}
+
+	// --replay or --replay-digests: make stage and trx files from the query
+	// log or performance_schema digests, written to a temp dir like --builtin
+	if cmdline.Options.Replay != "" || cmdline.Options.Digests != "" {
+		if len(stageFiles) > 0 || cmdline.Options.Builtin != "" || (cmdline.Options.Replay != "" && cmdline.Options.Digests != "") {
+			log.Fatal("--replay, --replay-digests, --builtin, and stage files are mutually exclusive; specify only one")
+		}
+		dir := cmdline.Options.ReplayDir // keep files to edit and rerun
+		if dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			tmpDir, err := os.MkdirTemp("", "finch-replay-")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+			dir = tmpDir
+		}
+		opts, err := replayOptions(cmdline.Options)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var replayParams []string
+		if cmdline.Options.Replay != "" {
+			stageFiles, replayParams, err = replay.Load(cmdline.Options.Replay, opts, dir)
+		} else {
+			stageFiles, replayParams, err = replay.LoadDigests(cmdline.Options.Digests, opts, dir)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		params = append(replayParams, params...)
+	}
+
+	if cmdline.Options.Checkpoint != "" && (cmdline.Options.Queue != "" || cmdline.Options.Schedule != "") {
+		log.Fatal("--checkpoint does not support --queue or --schedule")
+	}
+
+	// --queue: run jobs submitted to the server; stage files specified on the
+	// command line (if any) are the first job
+	if cmdline.Options.Queue != "" {
+		return runQueue(ctxFinch, stageFiles, params, cmdline.Options)
+	}
+
+	// --schedule: run stage files specified on the command line on a schedule
+	if cmdline.Options.Schedule != "" {
+		return runSchedule(ctxFinch, stageFiles, params, cmdline.Options)
+	}
+
 	// Load and validate all stage config files specified on the command line
-	if len(cmdline.Args) == 1 {
-		log.Fatal("No stage file specified. Run finch --help for usage. See https://square.github.io/finch/ for documentation.")
+	if len(stageFiles) == 0 {
+		return finch.ConfigError(fmt.Errorf("No stage file specified. Run finch --help for usage. See https://square.github.io/finch/ for documentation."))
 	}
 	stages, err := config.Load(
-		cmdline.Args[1:],
-		cmdline.Options.Params,
+		stageFiles,
+		params,
 		cmdline.Options.DSN,
 		cmdline.Options.Database,
 	)
 	if err != nil {
-		log.Fatal(err)
+		return finch.ConfigError(err)
+	}
+	if err := commandLineTags(stages, cmdline.Options); err != nil {
+		return finch.ConfigError(err)
+	}
+
+	// --dry-run: print the workload plan for each stage, don't run
+	if cmdline.Options.DryRun {
+		return dryRun(stages, cmdline.Options.DryRunFmt)
 	}
 
 	// Boot and run each stage specified on the command line
-	server := compute.NewServer("local", cmdline.Options.Server, cmdline.Options.Test)
+	server, err := newServer(cmdline.Options, cmdline.Options.Test)
+	if err != nil {
+		return err
+	}
+	if cmdline.Options.Checkpoint != "" && !cmdline.Options.Test {
+		// Absolute path because Server.Run changes the working dir
+		if server.Checkpoint, err = filepath.Abs(cmdline.Options.Checkpoint); err != nil {
+			return err
+		}
+	}
+
+	// Interactive: Enter prints a snapshot like SIGUSR1
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 && !cmdline.Options.Test {
+		go func() {
+			stdin := bufio.NewScanner(os.Stdin)
+			for stdin.Scan() {
+				snapshot()
+			}
+		}()
+	}
 	return server.Run(ctxFinch, stages)
 }
+
+// snapshot prints a snapshot of running stages (SIGUSR1 or Enter).
+func snapshot() {
+	if !stage.Snapshot() {
+		log.Println("Snapshot: no stage running")
+	}
+}
+
+// runQueue runs the server job queue (--queue DIR). Each job loads its stage
+// files like stage files on the command line: job params override --param.
+func runQueue(ctxFinch context.Context, stageFiles, params []string, o Options) error {
+	if o.Server == "" {
+		return fmt.Errorf("--queue requires --server")
+	}
+	if o.DryRun || o.Test {
+		return fmt.Errorf("--queue does not support --dry-run or --test")
+	}
+	server, err := newServer(o, false)
+	if err != nil {
+		return err
+	}
+	q, err := compute.NewQueue(o.Queue, func(jobFiles, jobParams []string) ([]config.Stage, error) {
+		stages, err := config.Load(jobFiles, append(append([]string{}, params...), jobParams...), o.DSN, o.Database)
+		if err != nil {
+			return nil, err
+		}
+		return stages, commandLineTags(stages, o)
+	})
+	if err != nil {
+		return err
+	}
+	if len(stageFiles) > 0 {
+		files, err := absFiles(stageFiles)
+		if err != nil {
+			return err
+		}
+		if _, err := q.Submit(proto.Job{Stages: files}); err != nil {
+			return err
+		}
+	}
+	return server.RunQueue(ctxFinch, q)
+}
+
+// runSchedule runs stage files on a schedule (--schedule CRON), appending the
+// results of each run to --history. Stage files are loaded before each run.
+func runSchedule(ctxFinch context.Context, stageFiles, params []string, o Options) error {
+	if len(stageFiles) == 0 {
+		return fmt.Errorf("--schedule requires stage files")
+	}
+	if o.Queue != "" || o.DryRun || o.Test {
+		return fmt.Errorf("--schedule does not support --queue, --dry-run, or --test")
+	}
+	sched, err := compute.ParseSchedule(o.Schedule)
+	if err != nil {
+		return err
+	}
+	history := o.History
+	if history == "" {
+		history = "finch-history.jsonl"
+	}
+	history, err = filepath.Abs(history) // Server.Run changes the working dir
+	if err != nil {
+		return err
+	}
+	files, err := absFiles(stageFiles)
+	if err != nil {
+		return err
+	}
+	server, err := newServer(o, false)
+	if err != nil {
+		return err
+	}
+	return server.RunSchedule(ctxFinch, sched, func() ([]config.Stage, error) {
+		stages, err := config.Load(files, params, o.DSN, o.Database)
+		if err != nil {
+			return nil, err
+		}
+		return stages, commandLineTags(stages, o)
+	}, history)
+}
+
+// runSubmit runs finch submit: submit stage files as a job to the server job
+// queue at --server. The stage files must exist on the server at the same
+// absolute paths (for example, a shared filesystem).
+func runSubmit(ctx context.Context, stageFiles []string, o Options) error {
+	if o.Server == "" {
+		return fmt.Errorf("finch submit requires --server ADDR")
+	}
+	if len(stageFiles) == 0 {
+		return fmt.Errorf("finch submit requires at least one stage file")
+	}
+	auth, err := computeAuth(o)
+	if err != nil {
+		return err
+	}
+	files, err := absFiles(stageFiles)
+	if err != nil {
+		return err
+	}
+	job, err := compute.Submit(ctx, finch.WithPort(o.Server, finch.DEFAULT_SERVER_PORT), auth, proto.Job{Stages: files, Params: o.Params})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Queued job %s (archive: %s)\n", job.Id, job.Dir)
+	return nil
+}
+
+func absFiles(files []string) ([]string, error) {
+	abs := make([]string, len(files))
+	for i := range files {
+		var err error
+		if abs[i], err = filepath.Abs(files[i]); err != nil {
+			return nil, err
+		}
+	}
+	return abs, nil
+}
+
+// netShape returns the network shaping from --net-latency, --net-jitter, and
+// --net-bandwidth.
+func netShape(o Options) (dbconn.Shape, error) {
+	var s dbconn.Shape
+	var err error
+	if o.NetLatency != "" {
+		if s.Latency, err = time.ParseDuration(o.NetLatency); err != nil || s.Latency < 0 {
+			return s, fmt.Errorf("invalid --net-latency %s: must be a duration like 20ms", o.NetLatency)
+		}
+	}
+	if o.NetJitter != "" {
+		if s.Jitter, err = time.ParseDuration(o.NetJitter); err != nil || s.Jitter < 0 {
+			return s, fmt.Errorf("invalid --net-jitter %s: must be a duration like 5ms", o.NetJitter)
+		}
+	}
+	if o.NetBW != "" {
+		if s.Bandwidth, err = human.ParseBytes(o.NetBW); err != nil {
+			return s, fmt.Errorf("invalid --net-bandwidth %s: %s", o.NetBW, err)
+		}
+	}
+	return s, nil
+}
+
+// newServer returns the server (local compute and --server) with --k8s-selector
+// compute pod discovery.
+func newServer(o Options, test bool) (*compute.Server, error) {
+	auth, err := computeAuth(o)
+	if err != nil {
+		return nil, err
+	}
+	if o.K8sSelector != "" && o.Server == "" {
+		return nil, fmt.Errorf("--k8s-selector requires --server")
+	}
+	server := compute.NewServer("local", o.Server, test, auth)
+	if o.K8sSelector != "" {
+		if server.K8s, err = compute.NewK8s(o.K8sSelector); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// computeAuth returns the client-server auth from --token and --tls-*.
+func computeAuth(o Options) (compute.Auth, error) {
+	auth := compute.Auth{
+		Token: o.Token,
+		TLS: config.TLS{
+			CA:   o.TLSCA,
+			Cert: o.TLSCert,
+			Key:  o.TLSKey,
+		},
+	}
+	return auth, auth.Validate()
+}
+
+func replayOptions(o Options) (replay.Options, error) {
+	opts := replay.Options{
+		Mode:  o.ReplayMode,
+		Speed: o.ReplaySpeed,
+	}
+	if o.ReplayIdle != "" {
+		d, err := time.ParseDuration(o.ReplayIdle)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --replay-max-idle %s: %s", o.ReplayIdle, err)
+		}
+		opts.MaxIdle = d
+	}
+	return opts, nil
+}
+
+// runRecord runs finch record: a MySQL proxy that records queries to record.log
+// in --replay-dir until CTRL-C, then writes replay stage and trx files for the
+// recorded queries in the same dir.
+func runRecord(ctx context.Context, o Options) error {
+	if o.ReplayDir == "" {
+		return fmt.Errorf("finch record requires --replay-dir")
+	}
+	opts, err := replayOptions(o)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(o.ReplayDir, 0755); err != nil {
+		return err
+	}
+	logFile := filepath.Join(o.ReplayDir, "record.log")
+	f, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := record.NewProxy(o.Listen, o.Upstream, f)
+	n, err := p.Run(ctx, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recorded %d queries in %s", n, logFile)
+	if n == 0 {
+		return nil
+	}
+	stageFiles, _, err := replay.Load(logFile, opts, o.ReplayDir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Replay with: finch %s", stageFiles[0])
+	return nil
+}
+
+// dryRun prints the workload plan for each stage without connecting to MySQL.
+func dryRun(stages []config.Stage, format string) error {
+	switch format {
+	case stage.DRY_RUN_TEXT, stage.DRY_RUN_JSON, stage.DRY_RUN_DOT:
+	default:
+		return finch.ConfigError(fmt.Errorf("invalid --dry-run-format %s: valid formats are %s, %s, and %s", format, stage.DRY_RUN_TEXT, stage.DRY_RUN_JSON, stage.DRY_RUN_DOT))
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(cwd)
+
+	gds := data.NewScope() // global data shared by all stages, like compute.Server
+	for _, cfg := range stages {
+		// cd dir of config file so relative file paths in config work
+		if err := os.Chdir(filepath.Dir(cfg.File)); err != nil {
+			return err
+		}
+		if err := stage.New(cfg, gds, nil).DryRun(os.Stdout, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandLineTags applies --enable-tag and --disable-tag to all stages.
+func commandLineTags(stages []config.Stage, o Options) error {
+	for i := range stages {
+		if err := stages[i].CommandLineTags(o.EnableTags, o.DisableTags); err != nil {
+			return fmt.Errorf("%s: %s", stages[i].File, err)
+		}
+	}
+	return nil
+}
+
+// runValidate runs finch validate: load and check all stage and trx files like
+// --test but without connecting to MySQL. It prints every error it finds and
+// returns an error if there are any.
+func runValidate(stageFiles []string, o Options) error {
+	if len(stageFiles) == 0 {
+		return finch.ConfigError(fmt.Errorf("finch validate requires at least one stage file"))
+	}
+	stages, err := config.Load(stageFiles, o.Params, o.DSN, o.Database)
+	if err != nil {
+		return finch.ConfigError(err)
+	}
+	if err := commandLineTags(stages, o); err != nil {
+		return finch.ConfigError(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(cwd)
+
+	gds := data.NewScope() // global data shared by all stages, like compute.Server
+	nErrors := 0
+	for _, cfg := range stages {
+		// cd dir of config file so relative file paths in config work
+		if err := os.Chdir(filepath.Dir(cfg.File)); err != nil {
+			return err
+		}
+		errs := stage.New(cfg, gds, nil).Validate()
+		for _, err := range errs {
+			fmt.Printf("%s: %s\n", cfg.File, err)
+		}
+		if len(errs) == 0 {
+			fmt.Printf("%s: OK\n", cfg.File)
+		}
+		nErrors += len(errs)
+	}
+	if nErrors > 0 {
+		return finch.ConfigError(fmt.Errorf("finch validate: %d errors", nErrors))
+	}
+	return nil
+}
+
+// runConsole runs finch console: load one stage file and execute its trx files
+// one statement at a time, reading commands from STDIN.
+func runConsole(ctx context.Context, stageFiles []string, o Options) error {
+	if len(stageFiles) != 1 {
+		return finch.ConfigError(fmt.Errorf("finch console requires one stage file"))
+	}
+	stages, err := config.Load(stageFiles, o.Params, o.DSN, o.Database)
+	if err != nil {
+		return finch.ConfigError(err)
+	}
+	// cd dir of config file so relative file paths in config work
+	if err := os.Chdir(filepath.Dir(stages[0].File)); err != nil {
+		return err
+	}
+	return console.New(stages[0], os.Stdout).Run(ctx, os.Stdin)
+}
+
+// runPlot runs finch plot: render charts (throughput, latency, and errors) from
+// each stats file written by the csv or history reporter.
+func runPlot(statsFiles []string, o Options) error {
+	if len(statsFiles) == 0 {
+		return fmt.Errorf("finch plot requires at least one stats file")
+	}
+	opts := plot.Options{
+		Dir:    o.PlotDir,
+		Format: o.PlotFormat,
+	}
+	for _, file := range statsFiles {
+		written, err := plot.Plot(file, opts)
+		if err != nil {
+			return err
+		}
+		for _, out := range written {
+			fmt.Println(out)
+		}
+	}
+	return nil
+}
+
+// runInit runs finch init: write a starter benchmark to the dir (default: current
+// dir). If STDIN is a terminal, it prompts for options not set on the command line.
+func runInit(args []string, o Options) error {
+	dir := "."
+	switch len(args) {
+	case 0:
+	case 1:
+		dir = args[0]
+	default:
+		return fmt.Errorf("finch init takes only one dir, got %d: %v", len(args), args)
+	}
+	opts := builtin.InitOptions{
+		Table:     o.InitTable,
+		Columns:   o.InitColumns,
+		TableSize: o.TableSize,
+	}
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		if err := builtin.Prompt(os.Stdin, os.Stdout, &opts); err != nil {
+			return err
+		}
+	}
+	files, err := builtin.Init(dir, opts)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Println(file)
+	}
+	fmt.Printf("Run: finch %s %s\n", filepath.Join(dir, "setup.yaml"), filepath.Join(dir, "run.yaml"))
+	return nil
+}
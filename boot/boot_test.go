@@ -124,3 +124,19 @@ func TestColumns(t *testing.T) {
 		t.Errorf("coltest1 row = '%s', expected '1,0x75'", t3)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	// finch validate doesn't connect to MySQL, so this runs in all builds
+	defer os.Chdir(cwd)
+
+	env := boot.Env{
+		Args: []string{
+			"./finch",
+			"validate",
+			"../test/run/select-1/test.yaml",
+		},
+	}
+	if err := boot.Up(env); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,24 +4,66 @@ package boot
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/alexflint/go-arg"
 
 	"github.com/square/finch"
+	"github.com/square/finch/builtin"
 )
 
 // Options represents the command line options
 type Options struct {
-	Client     string `arg:"env:FINCH_CLIENT"`
-	CPUProfile string `arg:"--cpu-profile,env:FINCH_CPU_PROFILE"`
-	Database   string `arg:"-D,--database,env:FINCH_DB"`
-	Debug      bool   `arg:"env:FINCH_DEBUG"`
-	DSN        string `arg:"env:FINCH_DSN"`
-	Help       bool
-	Params     []string `arg:"-p,--param,separate"`
-	Server     string   `arg:"env:FINCH_SERVER"`
-	Test       bool     `arg:"env:FINCH_TEST"`
-	Version    bool
+	Builtin     string   `arg:"env:FINCH_BUILTIN"`
+	Checkpoint  string   `arg:"--checkpoint,env:FINCH_CHECKPOINT"`
+	Client      string   `arg:"env:FINCH_CLIENT"`
+	CPUProfile  string   `arg:"--cpu-profile,env:FINCH_CPU_PROFILE"`
+	Database    string   `arg:"-D,--database,env:FINCH_DB"`
+	Debug       bool     `arg:"env:FINCH_DEBUG"`
+	DebugAddr   string   `arg:"--debug-addr,env:FINCH_DEBUG_ADDR"`
+	Digests     string   `arg:"--replay-digests"`
+	DisableTags []string `arg:"--disable-tag,separate"`
+	DryRun      bool     `arg:"--dry-run,env:FINCH_DRY_RUN"`
+	DryRunFmt   string   `arg:"--dry-run-format,env:FINCH_DRY_RUN_FORMAT" default:"text"`
+	DSN         string   `arg:"env:FINCH_DSN"`
+	EnableTags  []string `arg:"--enable-tag,separate"`
+	ErrorLog    string   `arg:"--error-log,env:FINCH_ERROR_LOG"`
+	Help        bool
+	History     string   `arg:"--history,env:FINCH_HISTORY"`
+	InitColumns string   `arg:"--init-columns"`
+	InitTable   string   `arg:"--init-table"`
+	K8sSelector string   `arg:"--k8s-selector,env:FINCH_K8S_SELECTOR"`
+	Listen      string   `arg:"--listen" default:"127.0.0.1:3307"`
+	LogFile     string   `arg:"--log-file,env:FINCH_LOG_FILE"`
+	LogFormat   string   `arg:"--log-format,env:FINCH_LOG_FORMAT" default:"text"`
+	LogMaxFiles int      `arg:"--log-max-files,env:FINCH_LOG_MAX_FILES" default:"5"`
+	LogMaxSize  string   `arg:"--log-max-size,env:FINCH_LOG_MAX_SIZE" default:"100MB"`
+	MaxRuntime  string   `arg:"--max-runtime,env:FINCH_MAX_RUNTIME"`
+	NetBW       string   `arg:"--net-bandwidth,env:FINCH_NET_BANDWIDTH"`
+	NetJitter   string   `arg:"--net-jitter,env:FINCH_NET_JITTER"`
+	NetLatency  string   `arg:"--net-latency,env:FINCH_NET_LATENCY"`
+	Params      []string `arg:"-p,--param,separate"`
+	PlotDir     string   `arg:"--plot-dir"`
+	PlotFormat  string   `arg:"--plot-format" default:"svg"`
+	Queue       string   `arg:"--queue,env:FINCH_QUEUE"`
+	Replay      string   `arg:"env:FINCH_REPLAY"`
+	ReplayDir   string   `arg:"--replay-dir"`
+	ReplayIdle  string   `arg:"--replay-max-idle"`
+	ReplayMode  string   `arg:"--replay-mode" default:"fingerprint"`
+	ReplaySpeed float64  `arg:"--replay-speed" default:"1"`
+	Schedule    string   `arg:"--schedule,env:FINCH_SCHEDULE"`
+	Server      string   `arg:"env:FINCH_SERVER"`
+	Standing    bool     `arg:"--standing,env:FINCH_STANDING"`
+	Tables      string   `arg:"--tables"`
+	TableSize   string   `arg:"--table-size"`
+	Test        bool     `arg:"env:FINCH_TEST"`
+	TLSCA       string   `arg:"--tls-ca,env:FINCH_TLS_CA"`
+	TLSCert     string   `arg:"--tls-cert,env:FINCH_TLS_CERT"`
+	TLSKey      string   `arg:"--tls-key,env:FINCH_TLS_KEY"`
+	Token       string   `arg:"env:FINCH_TOKEN"`
+	Upstream    string   `arg:"--upstream" default:"127.0.0.1:3306"`
+	Verbose     bool     `arg:"-v,--verbose,env:FINCH_VERBOSE"`
+	Version     bool
 }
 
 type CommandLine struct {
@@ -50,22 +92,73 @@ func ParseCommandLine(args []string) (CommandLine, error) {
 
 func printHelp() {
 	fmt.Printf("Usage:\n"+
-		"  finch [options] STAGE_1_FILE [STAGE_N_FILE...]\n\n"+
+		"  finch [options] STAGE_1_FILE|PLAN_FILE [STAGE_N_FILE...]\n"+
+		"  finch [options] --builtin NAME[:prepare|:run]\n"+
+		"  finch [options] --replay LOG_FILE\n"+
+		"  finch [options] --replay-digests DSN\n"+
+		"  finch [options] record --replay-dir DIR\n"+
+		"  finch [options] validate STAGE_1_FILE [STAGE_N_FILE...]\n"+
+		"  finch [options] console STAGE_FILE\n"+
+		"  finch [options] plot STATS_FILE [STATS_FILE...]\n"+
+		"  finch [options] init [DIR]\n"+
+		"  finch [options] --server ADDR submit STAGE_1_FILE [STAGE_N_FILE...]\n"+
+		"  finch schema [stage|all|plan]\n\n"+
 		"Options:\n"+
+		"  --builtin NAME        Run built-in benchmark: %s\n"+
+		"  --checkpoint FILE     Save run state to FILE, resume from FILE on restart\n"+
 		"  --client ADDR[:PORT]  Run as client of server at ADDR\n"+
 		"  --cpu-profile FILE    Save CPU profile of stage execution to FILE\n"+
 		"  --database (-D) DB    Default database on connect\n"+
 		"  --debug               Print debug output to stderr\n"+
+		"  --debug-addr ADDR     Serve pprof and expvar on ADDR, like 127.0.0.1:6060\n"+
+		"  --disable-tag TAG     Remove trx file statements tagged TAG\n"+
+		"  --dry-run             Print workload plan and exit (no MySQL connection)\n"+
+		"  --dry-run-format FMT  Dry run format: text (default), json, or dot (Graphviz)\n"+
 		"  --dsn DSN             MySQL DSN (overrides stage files)\n"+
+		"  --enable-tag TAG      Run only tagged trx file statements with TAG\n"+
+		"  --error-log FILE      Write client errors with statement and values to FILE\n"+
 		"  --help                Print help and exit\n"+
+		"  --history FILE        Append results to FILE (--schedule) (default: finch-history.jsonl)\n"+
+		"  --init-columns DEF    Columns for init, like \"k INT, c VARCHAR(120)\" (init)\n"+
+		"  --init-table NAME     Table name (init) (default: t1)\n"+
+		"  --k8s-selector SEL    Discover compute pods with Kubernetes label selector (server)\n"+
+		"  --listen ADDR:PORT    Listen on ADDR:PORT (record) (default: 127.0.0.1:3307)\n"+
+		"  --log-file FILE       Write log to FILE instead of stderr, rotate at --log-max-size\n"+
+		"  --log-format FMT      Log format: text (default) or json\n"+
+		"  --log-max-files N     Rotated log files to keep (default: 5)\n"+
+		"  --log-max-size N      Rotate log file at N bytes, like 100MB (default: 100MB)\n"+
+		"  --max-runtime D       Stop gracefully after D, like CTRL-C\n"+
+		"  --net-bandwidth N     Limit MySQL bandwidth to N bytes/s, like 10MB (compute)\n"+
+		"  --net-jitter D        Random +/- --net-latency (compute)\n"+
+		"  --net-latency D       Add latency D to each MySQL round trip (compute)\n"+
 		"  --param (-p) KEY=VAL  Set param key=value (override stage files)\n"+
+		"  --plot-dir DIR        Write charts to DIR (plot) (default: dir of stats file)\n"+
+		"  --plot-format FMT     Chart format: svg (default) or png (plot)\n"+
+		"  --queue DIR           Run job queue (server), archive results in DIR\n"+
+		"  --replay FILE         Replay query log FILE (slow, general, or audit log)\n"+
+		"  --replay-digests DSN  Replay statement digests from MySQL at DSN\n"+
+		"  --replay-dir DIR      Save replay stage and trx files in DIR\n"+
+		"  --replay-max-idle D   Max idle time between queries (--replay-mode literal)\n"+
+		"  --replay-mode MODE    Replay mode: fingerprint (default) or literal\n"+
+		"  --replay-speed N      Replay rate multiplier, 0 = unlimited (default: 1)\n"+
+		"  --schedule CRON       Run stages on cron-like schedule until CTRL-C\n"+
 		"  --server ADDR[:PORT]  Run as server on ADDR\n"+
+		"  --standing            Run stages until terminated (client)\n"+
+		"  --table-size N        Rows per table (--builtin, init)\n"+
+		"  --tables N            Number of tables (--builtin)\n"+
 		"  --test                Validate stages, test connections, and exit\n"+
+		"  --tls-ca FILE         CA to verify server (client) or clients (server, mTLS)\n"+
+		"  --tls-cert FILE       TLS certificate for client-server\n"+
+		"  --tls-key FILE        TLS key for client-server\n"+
+		"  --token TOKEN         Client-server shared secret token\n"+
+		"  --upstream ADDR:PORT  MySQL to proxy (record) (default: 127.0.0.1:3306)\n"+
+		"  --verbose (-v)        Print more detail, like full statement fingerprints\n"+
 		"  --version             Print version and exit\n"+
 		"\n"+
 		"Docs:\n"+
 		"  https://square.github.io/finch/\n\n"+
 		"finch %s\n",
+		strings.Join(builtin.Names(), ", "),
 		finch.VERSION,
 	)
 }
@@ -0,0 +1,52 @@
+// Copyright 2024 Block, Inc.
+
+package boot
+
+import (
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/square/finch"
+	"github.com/square/finch/stage"
+)
+
+func init() {
+	expvar.Publish("finch", expvar.Func(func() any {
+		return map[string]any{
+			"version":    finch.VERSION,
+			"goroutines": runtime.NumGoroutine(),
+			"stages":     stage.RunningVars(),
+		}
+	}))
+}
+
+// startDebugServer starts the debug HTTP server (--debug-addr) with pprof
+// profiles at /debug/pprof/ and expvar counters at /debug/vars. It's not
+// started by default because it exposes process internals without auth, so
+// addr should be localhost or a private network.
+func startDebugServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// Listen sync so a bad addr is an error on boot, like the API server
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Debug server listening on %s: /debug/pprof/ and /debug/vars", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("Debug server error: %s", err)
+		}
+	}()
+	return nil
+}
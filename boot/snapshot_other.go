@@ -0,0 +1,13 @@
+// Copyright 2024 Block, Inc.
+
+//go:build !windows
+
+package boot
+
+import (
+	"os"
+	"syscall"
+)
+
+// snapshotSignals print a snapshot of running stages (stage.Snapshot).
+var snapshotSignals = []os.Signal{syscall.SIGUSR1}
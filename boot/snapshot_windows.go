@@ -0,0 +1,13 @@
+// Copyright 2024 Block, Inc.
+
+//go:build windows
+
+package boot
+
+import (
+	"os"
+)
+
+// snapshotSignals print a snapshot of running stages (stage.Snapshot). Windows
+// doesn't have SIGUSR1, so only Enter (interactive) prints a snapshot.
+var snapshotSignals = []os.Signal{}
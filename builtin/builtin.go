@@ -0,0 +1,241 @@
+// Copyright 2024 Block, Inc.
+
+// Package builtin provides built-in benchmarks, like sysbench OLTP and YCSB, selected
+// with --builtin on the command line. The benchmark files are embedded in the
+// binary and written to a directory so they load like any other stage files.
+package builtin
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	human "github.com/dustin/go-humanize"
+)
+
+//go:embed all:sysbench all:tpch all:ycsb
+var files embed.FS
+
+// Options are command line options for built-in benchmarks. Each benchmark
+// uses only some options and ignores the rest.
+type Options struct {
+	Tables    string // --tables
+	TableSize string // --table-size
+}
+
+type benchmark struct {
+	dir     string   // in files
+	prepare []string // stage files to create and load tables
+	run     []string // stage files to run benchmark
+	params  func(Options) ([]string, error)
+}
+
+var benchmarks = map[string]benchmark{
+	"oltp_read_only": {
+		dir:     "sysbench",
+		prepare: []string{"setup.yaml"},
+		run:     []string{"oltp_read_only.yaml"},
+		params:  sysbenchParams,
+	},
+	"oltp_read_write": {
+		dir:     "sysbench",
+		prepare: []string{"setup.yaml"},
+		run:     []string{"oltp_read_write.yaml"},
+		params:  sysbenchParams,
+	},
+	"oltp_write_only": {
+		dir:     "sysbench",
+		prepare: []string{"setup.yaml"},
+		run:     []string{"oltp_write_only.yaml"},
+		params:  sysbenchParams,
+	},
+	"tpch": {
+		dir:     "tpch",
+		prepare: []string{"load.yaml"},
+		run:     []string{"queries.yaml"},
+		params:  tpchParams,
+	},
+	"ycsb_a": ycsb("workload_a.yaml"),
+	"ycsb_b": ycsb("workload_b.yaml"),
+	"ycsb_c": ycsb("workload_c.yaml"),
+	"ycsb_d": ycsb("workload_d.yaml"),
+	"ycsb_e": ycsb("workload_e.yaml"),
+	"ycsb_f": ycsb("workload_f.yaml"),
+}
+
+func ycsb(run string) benchmark {
+	return benchmark{
+		dir:     "ycsb",
+		prepare: []string{"load.yaml"},
+		run:     []string{run},
+		params:  ycsbParams,
+	}
+}
+
+// Names returns the names of all built-in benchmarks, sorted.
+func Names() []string {
+	names := make([]string, 0, len(benchmarks))
+	for name := range benchmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load writes the files for the built-in benchmark to dir, then returns the
+// stage files to load and the params to set (like --param). The spec is the
+// benchmark name, optionally suffixed with ":prepare" to only create and load
+// the tables, or ":run" to only run the benchmark on already loaded tables.
+// By default, both are done: prepare then run.
+func Load(spec string, opts Options, dir string) ([]string, []string, error) {
+	name, phase, _ := strings.Cut(spec, ":")
+	b, ok := benchmarks[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown built-in benchmark: %s; valid benchmarks: %s", name, strings.Join(Names(), ", "))
+	}
+
+	var stages []string
+	switch phase {
+	case "":
+		stages = append(append(stages, b.prepare...), b.run...)
+	case "prepare":
+		stages = b.prepare
+	case "run":
+		stages = b.run
+	default:
+		return nil, nil, fmt.Errorf("invalid built-in benchmark phase: %s: valid phases are :prepare and :run", phase)
+	}
+
+	params, err := b.params(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = fs.WalkDir(files, b.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, path)
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		bytes, err := files.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, bytes, 0644)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot write built-in benchmark files to %s: %s", dir, err)
+	}
+
+	stageFiles := make([]string, len(stages))
+	for i := range stages {
+		stageFiles[i] = filepath.Join(dir, b.dir, stages[i])
+	}
+	return stageFiles, params, nil
+}
+
+func sysbenchParams(opts Options) ([]string, error) {
+	params := []string{}
+	if opts.Tables != "" {
+		n, err := number(opts.Tables)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid --tables %s: must be an integer >= 1", opts.Tables)
+		}
+		params = append(params, fmt.Sprintf("tables=%d", n))
+	}
+	if opts.TableSize != "" {
+		load, err := loadParams("table_size", opts.TableSize)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, load...)
+	}
+	return params, nil
+}
+
+func ycsbParams(opts Options) ([]string, error) {
+	// YCSB has one table, usertable, so --tables is ignored
+	if opts.TableSize == "" {
+		return []string{}, nil
+	}
+	return loadParams("record_count", opts.TableSize)
+}
+
+func tpchParams(opts Options) ([]string, error) {
+	// --table-size is the number of orders, and the other tables are sized
+	// relative to it like TPC-H: 1.5M orders, 150k customers, 200k parts, and
+	// 10k suppliers at scale factor 1. --tables is ignored.
+	if opts.TableSize == "" {
+		return []string{}, nil
+	}
+	n, err := number(opts.TableSize)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid --table-size %s: must be an integer >= 1", opts.TableSize)
+	}
+	const chunk = 1000 // load_chunk in tpch/_all.yaml
+	params := []string{}
+	for _, t := range []struct {
+		name string
+		rows uint64
+	}{
+		{"orders", n},
+		{"customers", n / 10},
+		{"parts", n * 2 / 15},
+		{"suppliers", n / 150},
+	} {
+		if t.rows < 1 {
+			t.rows = 1
+		}
+		params = append(params,
+			fmt.Sprintf("%s=%d", t.name, t.rows),
+			fmt.Sprintf("%s_iter=%d", t.name, (t.rows+chunk-1)/chunk),
+		)
+	}
+	return params, nil
+}
+
+// loadParams returns the param for --table-size (named sizeParam because it
+// differs by benchmark) and the load_batch and load_iter params used to load
+// that many rows.
+func loadParams(sizeParam, tableSize string) ([]string, error) {
+	n, err := number(tableSize)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid --table-size %s: must be an integer >= 1", tableSize)
+	}
+	// Load inserts load_batch rows per INSERT, load_iter times per table.
+	// If the table size isn't a multiple of the batch size, the table will
+	// have a few more rows; it's not exact, but neither is sysbench.
+	batch := uint64(1000)
+	if n < batch {
+		batch = n
+	}
+	iter := (n + batch - 1) / batch
+	return []string{
+		fmt.Sprintf("%s=%d", sizeParam, n),
+		fmt.Sprintf("load_batch=%d", batch),
+		fmt.Sprintf("load_iter=%d", iter),
+	}, nil
+}
+
+// number parses integers like 1000, "1,000", 1k, and 1e3.
+func number(s string) (uint64, error) {
+	s = strings.ReplaceAll(s, ",", "")
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f < 0 || f != math.Trunc(f) {
+			return 0, fmt.Errorf("%s is not an integer", s)
+		}
+		return uint64(f), nil
+	}
+	return human.ParseBytes(s)
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Block, Inc.
+
+package builtin_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/square/finch/builtin"
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+var cwd, _ = os.Getwd()
+
+func TestLoad(t *testing.T) {
+	defer os.Chdir(cwd)
+
+	// Every built-in benchmark must load and parse, with the default params
+	// and with options that change them
+	opts := []builtin.Options{
+		{},
+		{Tables: "16", TableSize: "1e7"},
+	}
+	for _, name := range builtin.Names() {
+		for _, opt := range opts {
+			stageFiles, params, err := builtin.Load(name, opt, t.TempDir())
+			if err != nil {
+				t.Fatalf("%s %+v: %s", name, opt, err)
+			}
+			stages, err := config.Load(stageFiles, params, "", "")
+			if err != nil {
+				t.Fatalf("%s %+v: %s", name, opt, err)
+			}
+			if len(stages) != 2 {
+				t.Errorf("%s: got %d stages, expected 2 (prepare and run)", name, len(stages))
+			}
+			for _, s := range stages {
+				os.Chdir(filepath.Dir(s.File)) // like compute.Server
+				if _, err := trx.Load(s.Trx, data.NewScope(), s.Params); err != nil {
+					t.Errorf("%s %+v: stage %s: %s", name, opt, s.Name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestLoad_Phase(t *testing.T) {
+	stageFiles, _, err := builtin.Load("oltp_read_only:run", builtin.Options{}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stageFiles) != 1 {
+		t.Errorf("got %d stage files, expected 1: %v", len(stageFiles), stageFiles)
+	}
+
+	_, _, err = builtin.Load("oltp_read_only:cleanup", builtin.Options{}, t.TempDir())
+	if err == nil {
+		t.Errorf("no error for invalid phase, expected one")
+	}
+	_, _, err = builtin.Load("oltp_nope", builtin.Options{}, t.TempDir())
+	if err == nil {
+		t.Errorf("no error for unknown benchmark, expected one")
+	}
+}
+
+func TestLoad_SysbenchTables(t *testing.T) {
+	defer os.Chdir(cwd)
+
+	// Every table is prepared, loaded, and queried with prepared statements
+	stageFiles, params, err := builtin.Load("oltp_read_write", builtin.Options{Tables: "3"}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages, err := config.Load(stageFiles, params, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stages {
+		os.Chdir(filepath.Dir(s.File))
+		set, err := trx.Load(s.Trx, data.NewScope(), s.Params)
+		if err != nil {
+			t.Fatalf("stage %s: %s", s.Name, err)
+		}
+		tables := map[string]bool{}
+		for _, name := range set.Order {
+			for _, stmt := range set.Statements[name] {
+				for _, tbl := range reTable.FindAllString(stmt.Query, -1) {
+					tables[tbl] = true
+				}
+				if s.Name == "oltp_read_write" && !stmt.Prepare && !stmt.Begin && !stmt.Commit {
+					t.Errorf("stage %s: not prepared: %s", s.Name, stmt.Query)
+				}
+			}
+		}
+		if len(tables) != 3 || !tables["sbtest1"] || !tables["sbtest2"] || !tables["sbtest3"] {
+			t.Errorf("stage %s: got tables %v, expected sbtest1, sbtest2, sbtest3", s.Name, tables)
+		}
+	}
+}
+
+var reTable = regexp.MustCompile(`sbtest\d+`)
+
+func TestInit(t *testing.T) {
+	defer os.Chdir(cwd)
+
+	// Generated files must load and parse with default and custom columns
+	opts := []builtin.InitOptions{
+		{},
+		{Table: "orders", Columns: "qty SMALLINT, price DECIMAL(10,2), note TEXT, status ENUM('new','done'), doc JSON", TableSize: "1e6"},
+		{Columns: "created DATETIME"}, // no generated columns
+	}
+	for _, opt := range opts {
+		dir := t.TempDir()
+		files, err := builtin.Init(dir, opt)
+		if err != nil {
+			t.Fatalf("%+v: %s", opt, err)
+		}
+		if len(files) != 6 {
+			t.Errorf("%+v: wrote %d files, expected 6: %v", opt, len(files), files)
+		}
+		stageFiles := []string{filepath.Join(dir, "setup.yaml"), filepath.Join(dir, "run.yaml")}
+		stages, err := config.Load(stageFiles, nil, "", "")
+		if err != nil {
+			t.Fatalf("%+v: %s", opt, err)
+		}
+		for _, s := range stages {
+			os.Chdir(filepath.Dir(s.File))
+			if _, err := trx.Load(s.Trx, data.NewScope(), s.Params); err != nil {
+				t.Errorf("%+v: stage %s: %s", opt, s.Name, err)
+			}
+		}
+
+		// Doesn't overwrite files
+		if _, err := builtin.Init(dir, opt); err == nil {
+			t.Errorf("%+v: no error when files exist, expected one", opt)
+		}
+	}
+
+	for _, cols := range []string{"id INT", "k", "k INT, k INT", "g GEOMETRY"} {
+		if _, err := builtin.ParseColumns(cols); err == nil {
+			t.Errorf("no error for invalid columns %q, expected one", cols)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright 2024 Block, Inc.
+
+package builtin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// InitOptions are command line options for finch init, which writes a starter
+// benchmark for one table: stage files for setup (create and load the table) and
+// run (a read-write workload), and their trx files.
+type InitOptions struct {
+	Table     string // --init-table
+	Columns   string // --init-columns
+	TableSize string // --table-size
+}
+
+const (
+	DEFAULT_INIT_TABLE      = "t1"
+	DEFAULT_INIT_COLUMNS    = "k INT, c VARCHAR(120), created DATETIME"
+	DEFAULT_INIT_TABLE_SIZE = "100000"
+)
+
+// Column is a table column for finch init: its definition and how to generate
+// values for it. If Generator is empty, Value is a literal SQL value.
+type Column struct {
+	Name      string
+	Def       string // like "VARCHAR(120)"
+	Generator string
+	Params    map[string]string
+	Value     string
+}
+
+// ParseColumns parses comma-separated column definitions like "k INT, c VARCHAR(120)".
+// Commas in parentheses, like DECIMAL(10,2), are part of the definition. Column
+// id is reserved: finch init adds it as an auto-increment primary key.
+func ParseColumns(defs string) ([]Column, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range defs {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, defs[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, defs[start:])
+
+	cols := []Column{}
+	seen := map[string]bool{}
+	for _, part := range parts {
+		f := strings.Fields(part)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) < 2 {
+			return nil, fmt.Errorf("invalid column %q: must be NAME TYPE, like \"c VARCHAR(120)\"", strings.TrimSpace(part))
+		}
+		name := f[0]
+		if !validColumnName.MatchString(name) {
+			return nil, fmt.Errorf("invalid column name %s: must be letters, numbers, and _", name)
+		}
+		if strings.ToLower(name) == "id" {
+			return nil, fmt.Errorf("column id is reserved: finch init adds it as the auto-increment primary key")
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("duplicate column %s", name)
+		}
+		seen[strings.ToLower(name)] = true
+		col := Column{Name: name, Def: strings.Join(f[1:], " ")}
+		if err := col.setData(); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	return cols, nil
+}
+
+var (
+	validColumnName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	typeLen         = regexp.MustCompile(`^\w+\s*\(\s*(\d+)`)
+)
+
+// setData sets the data generator for the column type, or a literal value for
+// types that Finch doesn't generate, like dates.
+func (c *Column) setData() error {
+	typ := strings.ToUpper(c.Def)
+	if i := strings.IndexAny(typ, "( "); i > 0 {
+		typ = typ[:i]
+	}
+	n := 0 // length, like 120 in VARCHAR(120)
+	if m := typeLen.FindStringSubmatch(c.Def); m != nil {
+		n, _ = strconv.Atoi(m[1])
+	}
+	switch typ {
+	case "TINYINT":
+		c.int("0", "127")
+	case "BOOL", "BOOLEAN":
+		c.int("0", "1")
+	case "SMALLINT":
+		c.int("1", "32767")
+	case "MEDIUMINT":
+		c.int("1", "8388607")
+	case "INT", "INTEGER", "BIGINT":
+		c.int("1", "$params.rows")
+	case "DECIMAL", "DEC", "NUMERIC", "FLOAT", "DOUBLE", "REAL":
+		c.int("1", "1000000")
+	case "CHAR", "VARCHAR", "BINARY", "VARBINARY":
+		if n == 0 {
+			n = 1 // CHAR = CHAR(1)
+		}
+		c.str(n)
+	case "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+		c.str(100)
+	case "DATE", "DATETIME", "TIMESTAMP", "TIME":
+		c.Value = "NOW()"
+	case "YEAR":
+		c.Value = "YEAR(NOW())"
+	case "JSON":
+		c.Value = "'{}'"
+	case "ENUM", "SET":
+		// First value, like 'a' in ENUM('a','b')
+		s := c.Def[strings.Index(c.Def, "(")+1:]
+		if i := strings.IndexAny(s, ",)"); i > 0 {
+			c.Value = strings.TrimSpace(s[:i])
+		}
+		if c.Value == "" {
+			return fmt.Errorf("column %s: invalid %s: no values", c.Name, typ)
+		}
+	default:
+		return fmt.Errorf("column %s: unsupported type %s: use another type, then edit the generated files", c.Name, typ)
+	}
+	return nil
+}
+
+func (c *Column) int(min, max string) {
+	c.Generator = "int"
+	c.Params = map[string]string{"min": min, "max": max}
+}
+
+func (c *Column) str(n int) {
+	c.Generator = "str-fill-az"
+	c.Params = map[string]string{"len": strconv.Itoa(n)}
+}
+
+// Prompt prompts for options not set on the command line, reading answers from
+// in. An empty answer uses the default.
+func Prompt(in io.Reader, out io.Writer, opts *InitOptions) error {
+	r := bufio.NewReader(in)
+	ask := func(q, def string, v *string) error {
+		if *v != "" {
+			return nil // set on command line
+		}
+		fmt.Fprintf(out, "%s [%s]: ", q, def)
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			fmt.Fprintln(out)
+		} else if err != nil {
+			return err
+		}
+		if *v = strings.TrimSpace(line); *v == "" {
+			*v = def
+		}
+		return nil
+	}
+	if err := ask("Table name", DEFAULT_INIT_TABLE, &opts.Table); err != nil {
+		return err
+	}
+	if err := ask("Columns (except id primary key)", DEFAULT_INIT_COLUMNS, &opts.Columns); err != nil {
+		return err
+	}
+	return ask("Rows", DEFAULT_INIT_TABLE_SIZE, &opts.TableSize)
+}
+
+// Init writes a starter benchmark to dir and returns the files written. It
+// doesn't overwrite files: if any exist, it returns an error before writing.
+func Init(dir string, opts InitOptions) ([]string, error) {
+	if opts.Table == "" {
+		opts.Table = DEFAULT_INIT_TABLE
+	}
+	if !validColumnName.MatchString(opts.Table) {
+		return nil, fmt.Errorf("invalid table name %s: must be letters, numbers, and _", opts.Table)
+	}
+	if opts.Columns == "" {
+		opts.Columns = DEFAULT_INIT_COLUMNS
+	}
+	cols, err := ParseColumns(opts.Columns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --init-columns: %s", err)
+	}
+	if opts.TableSize == "" {
+		opts.TableSize = DEFAULT_INIT_TABLE_SIZE
+	}
+	params, err := loadParams("rows", opts.TableSize)
+	if err != nil {
+		return nil, err
+	}
+	p := map[string]string{}
+	for _, kv := range params {
+		k, v, _ := strings.Cut(kv, "=")
+		p[k] = v
+	}
+
+	// Update the first column with a generator, if any
+	update := -1
+	for i := range cols {
+		if cols[i].Generator != "" {
+			update = i
+			break
+		}
+	}
+	tmplData := struct {
+		Table   string
+		Columns []Column
+		Update  *Column
+		Params  map[string]string
+	}{
+		Table:   opts.Table,
+		Columns: cols,
+		Params:  p,
+	}
+	if update >= 0 {
+		tmplData.Update = &cols[update]
+	}
+
+	files := []string{}
+	for _, f := range initFiles {
+		file := filepath.Join(dir, f.name)
+		if _, err := os.Stat(file); err == nil {
+			return nil, fmt.Errorf("%s exists; finch init does not overwrite files", file)
+		}
+		files = append(files, file)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "trx"), 0755); err != nil {
+		return nil, err
+	}
+	for i, f := range initFiles {
+		tmpl, err := template.New(f.name).Delims("[[", "]]").Funcs(initFuncs).Parse(f.tmpl + dataTmpl)
+		if err != nil {
+			return nil, err // bug
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, tmplData); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(files[i], []byte(sb.String()), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// values returns the INSERT values for cols: @name for a generator, else the
+// literal value.
+func values(cols []Column) string {
+	v := make([]string, len(cols))
+	for i, c := range cols {
+		if c.Generator != "" {
+			v[i] = "@" + c.Name
+		} else {
+			v[i] = c.Value
+		}
+	}
+	return strings.Join(v, ", ")
+}
+
+func names(cols []Column) string {
+	v := make([]string, len(cols))
+	for i, c := range cols {
+		v[i] = c.Name
+	}
+	return strings.Join(v, ", ")
+}
+
+var initFuncs = template.FuncMap{
+	"values": values,
+	"names":  names,
+	"generated": func(cols []Column) bool {
+		for _, c := range cols {
+			if c.Generator != "" {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+var initFiles = []struct {
+	name string
+	tmpl string
+}{
+	{"_all.yaml", `# Starter benchmark written by finch init. Edit any file to customize it:
+# https://square.github.io/finch/
+#
+# Run: finch setup.yaml run.yaml
+# Any param can be overridden with --param, like --param clients=16.
+params:
+  rows: "[[.Params.rows]]"
+  load_batch: "[[.Params.load_batch]]" # rows per INSERT in setup
+  load_iter: "[[.Params.load_iter]]"   # = rows / load_batch
+  clients: "4"
+  runtime: "60s"
+
+stats:
+  freq: 5s
+`},
+	{"setup.yaml", `stage:
+  name: setup
+  stats:
+    disable: true
+  workload:
+    - trx: [schema.sql]
+    - trx: [load.sql]
+      iter: $params.load_iter
+  trx:
+    - file: trx/schema.sql
+    - file: trx/load.sql
+      template: true
+[[- if generated .Columns]]
+      data:
+[[- template "data" .Columns]]
+[[- end]]
+`},
+	{"run.yaml", `stage:
+  name: read-write
+  runtime: $params.runtime
+  workload:
+    - clients: $params.clients
+  trx:
+    - file: trx/read-write.sql
+      data:
+        id:
+          generator: "int"
+          params:
+            max: $params.rows
+[[- template "data" .Columns]]
+`},
+	{"trx/schema.sql", `CREATE TABLE IF NOT EXISTS [[.Table]] (
+  id bigint unsigned NOT NULL AUTO_INCREMENT,
+[[- range .Columns]]
+  [[.Name]] [[.Def]],
+[[- end]]
+  PRIMARY KEY (id)
+) ENGINE=InnoDB
+`},
+	{"trx/load.sql", `INSERT INTO [[.Table]] ([[names .Columns]]) VALUES /*!csv {{.Params.load_batch}} ([[values .Columns]]) */
+`},
+	{"trx/read-write.sql", `-- prepare
+SELECT * FROM [[.Table]] WHERE id = @id
+[[- with .Update]]
+
+-- probability: 0.2
+-- prepare
+UPDATE [[$.Table]] SET [[.Name]] = @[[.Name]] WHERE id = @id
+[[- end]]
+
+-- probability: 0.05
+-- prepare
+INSERT INTO [[.Table]] ([[names .Columns]]) VALUES ([[values .Columns]])
+`},
+}
+
+// dataTmpl is the data keys for columns with a generator, shared by setup.yaml
+// and run.yaml.
+const dataTmpl = `[[define "data"]]
+[[- range .]][[if .Generator]]
+        [[.Name]]:
+          generator: "[[.Generator]]"
+          params:
+[[- range $k, $v := .Params]]
+            [[$k]]: [[$v]]
+[[- end]][[end]][[end]]
+[[- end]]`
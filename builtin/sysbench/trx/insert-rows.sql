@@ -0,0 +1 @@
+INSERT INTO sbtest@t VALUES /*!csv {{.Params.load_batch}} (NULL, @k, @c, @pad) */
@@ -0,0 +1,36 @@
+{{- /* One trx per table (sbtest1 to sbtestN) with prepared statements: the
+table name cannot be a prepared statement param, so it's literal in each trx. */ -}}
+{{- range $t := seq .Params.tables}}
+
+BEGIN
+
+-- prepare
+-- copies: 10
+SELECT c FROM sbtest{{$t}} WHERE id=@id
+
+-- prepare
+SELECT c FROM sbtest{{$t}} WHERE id BETWEEN @id_100 AND @PREV
+
+-- prepare
+SELECT SUM(k) FROM sbtest{{$t}} WHERE id BETWEEN @id_100 AND @PREV
+
+-- prepare
+SELECT c FROM sbtest{{$t}} WHERE id BETWEEN @id_100 AND @PREV ORDER BY c
+
+-- prepare
+SELECT DISTINCT c FROM sbtest{{$t}} WHERE id BETWEEN @id_100 AND @PREV ORDER BY c
+
+-- prepare
+UPDATE sbtest{{$t}} SET k=k+1 WHERE id=@id_w
+
+-- prepare
+UPDATE sbtest{{$t}} SET c=@c WHERE id=@id_w
+
+-- prepare
+DELETE FROM sbtest{{$t}} WHERE id=@del_id
+
+-- prepare
+INSERT INTO sbtest{{$t}} (id, k, c, pad) VALUES (@del_id, @k, @c, @pad)
+
+COMMIT
+{{end}}
@@ -0,0 +1,20 @@
+{{- /* One trx per table (sbtest1 to sbtestN) with prepared statements: the
+table name cannot be a prepared statement param, so it's literal in each trx. */ -}}
+{{- range $t := seq .Params.tables}}
+
+BEGIN
+
+-- prepare
+UPDATE sbtest{{$t}} SET k=k+1 WHERE id=@id_w
+
+-- prepare
+UPDATE sbtest{{$t}} SET c=@c WHERE id=@id_w
+
+-- prepare
+DELETE FROM sbtest{{$t}} WHERE id=@del_id
+
+-- prepare
+INSERT INTO sbtest{{$t}} (id, k, c, pad) VALUES (@del_id, @k, @c, @pad)
+
+COMMIT
+{{end}}
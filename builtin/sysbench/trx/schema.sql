@@ -0,0 +1,10 @@
+{{range seq .Params.tables}}
+CREATE TABLE IF NOT EXISTS sbtest{{.}} (
+  id int NOT NULL AUTO_INCREMENT,
+  k int NOT NULL DEFAULT '0',
+  c char(120) NOT NULL DEFAULT '',
+  pad char(60) NOT NULL DEFAULT '',
+  PRIMARY KEY (id)
+  /* Secondary index added after loading rows */
+) ENGINE=InnoDB
+{{end}}
@@ -0,0 +1,5 @@
+{{range seq .Params.tables}}
+ALTER TABLE sbtest{{.}} ADD INDEX k_{{.}} (k)
+
+ANALYZE TABLE sbtest{{.}}
+{{end}}
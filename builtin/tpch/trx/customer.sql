@@ -0,0 +1,17 @@
+{{- /* Each iteration inserts the next chunk of rows: @chunk = 1, 2, 3, ... */ -}}
+INSERT INTO customer
+WITH RECURSIVE seq (n) AS (
+  SELECT (@chunk - 1) * {{.Params.load_chunk}} + 1
+  UNION ALL
+  SELECT n + 1 FROM seq WHERE n < LEAST(@chunk * {{.Params.load_chunk}}, {{.Params.customers}})
+)
+SELECT
+  n,
+  CONCAT('Customer#', LPAD(n, 9, '0')),
+  SUBSTRING(MD5(RAND()), 1, 10 + FLOOR(RAND() * 20)),
+  FLOOR(RAND() * 25),
+  CONCAT(10 + FLOOR(RAND() * 25), '-', 100 + FLOOR(RAND() * 900), '-', 100 + FLOOR(RAND() * 900), '-', 1000 + FLOOR(RAND() * 9000)),
+  ROUND(-999.99 + RAND() * 10999.98, 2),
+  ELT(1 + FLOOR(RAND() * 5), 'AUTOMOBILE', 'BUILDING', 'FURNITURE', 'HOUSEHOLD', 'MACHINERY'),
+  CONCAT(MD5(RAND()), MD5(RAND()))
+FROM seq
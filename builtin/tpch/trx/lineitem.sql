@@ -0,0 +1,47 @@
+{{- /* Each iteration inserts 1-7 line items for each order in the next chunk of
+orders: @chunk = 1, 2, 3, ... NO_MERGE materializes the random values so that
+dates and flags computed from them are consistent. */ -}}
+INSERT INTO lineitem
+WITH
+  o AS (
+    SELECT o_orderkey, o_orderdate, 1 + FLOOR(RAND() * 7) AS n_lines
+    FROM orders
+    WHERE o_orderkey BETWEEN (@chunk - 1) * {{.Params.load_chunk}} + 1 AND @chunk * {{.Params.load_chunk}}
+  ),
+  seq (n) AS (
+    SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7
+  ),
+  li AS (
+    SELECT /*+ NO_MERGE(o) */
+      o_orderkey,
+      o_orderdate,
+      n AS l_linenumber,
+      1 + FLOOR(RAND() * {{.Params.parts}}) AS l_partkey,
+      1 + FLOOR(RAND() * {{.Params.suppliers}}) AS l_suppkey,
+      1 + FLOOR(RAND() * 50) AS l_quantity,
+      900 + RAND() * 1200 AS l_price,
+      FLOOR(RAND() * 11) / 100 AS l_discount,
+      FLOOR(RAND() * 9) / 100 AS l_tax,
+      1 + FLOOR(RAND() * 121) AS ship_days,
+      30 + FLOOR(RAND() * 61) AS commit_days,
+      1 + FLOOR(RAND() * 30) AS receipt_days
+    FROM o JOIN seq ON seq.n <= o.n_lines
+  )
+SELECT /*+ NO_MERGE(li) */
+  o_orderkey,
+  l_partkey,
+  l_suppkey,
+  l_linenumber,
+  l_quantity,
+  ROUND(l_quantity * l_price, 2),
+  l_discount,
+  l_tax,
+  IF(o_orderdate + INTERVAL (ship_days + receipt_days) DAY <= DATE '1995-06-17', ELT(1 + FLOOR(RAND() * 2), 'R', 'A'), 'N'),
+  IF(o_orderdate + INTERVAL ship_days DAY > DATE '1995-06-17', 'O', 'F'),
+  o_orderdate + INTERVAL ship_days DAY,
+  o_orderdate + INTERVAL commit_days DAY,
+  o_orderdate + INTERVAL (ship_days + receipt_days) DAY,
+  ELT(1 + FLOOR(RAND() * 4), 'DELIVER IN PERSON', 'COLLECT COD', 'NONE', 'TAKE BACK RETURN'),
+  ELT(1 + FLOOR(RAND() * 7), 'REG AIR', 'AIR', 'RAIL', 'SHIP', 'TRUCK', 'MAIL', 'FOB'),
+  SUBSTRING(MD5(RAND()), 1, 10 + FLOOR(RAND() * 22))
+FROM li
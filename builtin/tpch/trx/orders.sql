@@ -0,0 +1,19 @@
+{{- /* Each iteration inserts the next chunk of rows: @chunk = 1, 2, 3, ...
+Order dates are 1992-01-01 to 1998-08-02 minus 151 days, like TPC-H. */ -}}
+INSERT INTO orders
+WITH RECURSIVE seq (n) AS (
+  SELECT (@chunk - 1) * {{.Params.load_chunk}} + 1
+  UNION ALL
+  SELECT n + 1 FROM seq WHERE n < LEAST(@chunk * {{.Params.load_chunk}}, {{.Params.orders}})
+)
+SELECT
+  n,
+  1 + FLOOR(RAND() * {{.Params.customers}}),
+  ELT(1 + FLOOR(RAND() * 3), 'F', 'O', 'P'),
+  ROUND(1000 + RAND() * 400000, 2),
+  DATE '1992-01-01' + INTERVAL FLOOR(RAND() * 2406) DAY,
+  ELT(1 + FLOOR(RAND() * 5), '1-URGENT', '2-HIGH', '3-MEDIUM', '4-NOT SPECIFIED', '5-LOW'),
+  CONCAT('Clerk#', LPAD(1 + FLOOR(RAND() * 1000), 9, '0')),
+  0,
+  CONCAT(MD5(RAND()), SUBSTRING(MD5(RAND()), 1, 10 + FLOOR(RAND() * 20)))
+FROM seq
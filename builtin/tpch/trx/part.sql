@@ -0,0 +1,27 @@
+{{- /* Each iteration inserts the next chunk of rows: @chunk = 1, 2, 3, ...
+p_retailprice is the TPC-H formula. */ -}}
+INSERT INTO part
+WITH RECURSIVE seq (n) AS (
+  SELECT (@chunk - 1) * {{.Params.load_chunk}} + 1
+  UNION ALL
+  SELECT n + 1 FROM seq WHERE n < LEAST(@chunk * {{.Params.load_chunk}}, {{.Params.parts}})
+)
+SELECT
+  n,
+  CONCAT_WS(' ',
+    ELT(1 + FLOOR(RAND() * 5), 'almond', 'antique', 'aquamarine', 'azure', 'beige'),
+    ELT(1 + FLOOR(RAND() * 5), 'bisque', 'black', 'blanched', 'blue', 'blush'),
+    ELT(1 + FLOOR(RAND() * 5), 'brown', 'burlywood', 'burnished', 'chartreuse', 'chiffon')),
+  CONCAT('Manufacturer#', 1 + FLOOR(RAND() * 5)),
+  CONCAT('Brand#', 1 + FLOOR(RAND() * 5), 1 + FLOOR(RAND() * 5)),
+  CONCAT_WS(' ',
+    ELT(1 + FLOOR(RAND() * 6), 'STANDARD', 'SMALL', 'MEDIUM', 'LARGE', 'ECONOMY', 'PROMO'),
+    ELT(1 + FLOOR(RAND() * 5), 'ANODIZED', 'BURNISHED', 'PLATED', 'POLISHED', 'BRUSHED'),
+    ELT(1 + FLOOR(RAND() * 5), 'TIN', 'NICKEL', 'BRASS', 'STEEL', 'COPPER')),
+  1 + FLOOR(RAND() * 50),
+  CONCAT_WS(' ',
+    ELT(1 + FLOOR(RAND() * 5), 'SM', 'LG', 'MED', 'JUMBO', 'WRAP'),
+    ELT(1 + FLOOR(RAND() * 8), 'CASE', 'BOX', 'BAG', 'JAR', 'PKG', 'PACK', 'CAN', 'DRUM')),
+  ROUND((90000 + MOD(FLOOR(n / 10), 20001) + 100 * MOD(n, 1000)) / 100, 2),
+  SUBSTRING(MD5(RAND()), 1, 5 + FLOOR(RAND() * 18))
+FROM seq
@@ -0,0 +1,7 @@
+SELECT
+  100.00 * SUM(CASE WHEN p_type LIKE 'PROMO%%' THEN l_extendedprice * (1 - l_discount) ELSE 0 END)
+    / SUM(l_extendedprice * (1 - l_discount)) AS promo_revenue
+FROM lineitem, part
+WHERE l_partkey = p_partkey
+  AND l_shipdate >= DATE '1993-01-01' + INTERVAL @month MONTH
+  AND l_shipdate < DATE '1993-01-01' + INTERVAL (@month + 1) MONTH
@@ -0,0 +1,15 @@
+SELECT
+  n_name,
+  SUM(l_extendedprice * (1 - l_discount)) AS revenue
+FROM customer, orders, lineitem, supplier, nation, region
+WHERE c_custkey = o_custkey
+  AND l_orderkey = o_orderkey
+  AND l_suppkey = s_suppkey
+  AND c_nationkey = s_nationkey
+  AND s_nationkey = n_nationkey
+  AND n_regionkey = r_regionkey
+  AND r_name = ELT(@region, 'AFRICA', 'AMERICA', 'ASIA', 'EUROPE', 'MIDDLE EAST')
+  AND o_orderdate >= DATE '1993-01-01' + INTERVAL @year YEAR
+  AND o_orderdate < DATE '1993-01-01' + INTERVAL (@year + 1) YEAR
+GROUP BY n_name
+ORDER BY revenue DESC
@@ -0,0 +1,7 @@
+SELECT
+  SUM(l_extendedprice * l_discount) AS revenue
+FROM lineitem
+WHERE l_shipdate >= DATE '1993-01-01' + INTERVAL @year YEAR
+  AND l_shipdate < DATE '1993-01-01' + INTERVAL (@year + 1) YEAR
+  AND l_discount BETWEEN @discount / 100 - 0.01 AND @discount / 100 + 0.01
+  AND l_quantity < @quantity
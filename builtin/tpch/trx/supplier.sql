@@ -0,0 +1,16 @@
+{{- /* Each iteration inserts the next chunk of rows: @chunk = 1, 2, 3, ... */ -}}
+INSERT INTO supplier
+WITH RECURSIVE seq (n) AS (
+  SELECT (@chunk - 1) * {{.Params.load_chunk}} + 1
+  UNION ALL
+  SELECT n + 1 FROM seq WHERE n < LEAST(@chunk * {{.Params.load_chunk}}, {{.Params.suppliers}})
+)
+SELECT
+  n,
+  CONCAT('Supplier#', LPAD(n, 9, '0')),
+  SUBSTRING(MD5(RAND()), 1, 10 + FLOOR(RAND() * 20)),
+  FLOOR(RAND() * 25),
+  CONCAT(10 + FLOOR(RAND() * 25), '-', 100 + FLOOR(RAND() * 900), '-', 100 + FLOOR(RAND() * 900), '-', 1000 + FLOOR(RAND() * 9000)),
+  ROUND(-999.99 + RAND() * 10999.98, 2),
+  MD5(RAND())
+FROM seq
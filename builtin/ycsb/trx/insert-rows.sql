@@ -0,0 +1 @@
+INSERT INTO usertable VALUES /*!csv {{.Params.load_batch}} (NULL, {{repeat .Params.field_count ", " "@f"}}) */
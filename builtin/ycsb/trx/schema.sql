@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS usertable (
+  ycsb_key bigint NOT NULL AUTO_INCREMENT,
+{{- range seq .Params.field_count}}
+  field{{.}} varchar({{$.Params.field_length}}) NOT NULL DEFAULT '',
+{{- end}}
+  PRIMARY KEY (ycsb_key)
+) ENGINE=InnoDB
@@ -0,0 +1,8 @@
+{{- /* Workload A: update heavy (50% read, 50% update) */ -}}
+
+-- probability: 0.5
+-- prepare
+SELECT * FROM usertable WHERE ycsb_key = @k
+
+-- probability: 0.5
+UPDATE usertable SET field@fn = @f WHERE ycsb_key = @k
@@ -0,0 +1,8 @@
+{{- /* Workload B: read mostly (95% read, 5% update) */ -}}
+
+-- probability: 0.95
+-- prepare
+SELECT * FROM usertable WHERE ycsb_key = @k
+
+-- probability: 0.05
+UPDATE usertable SET field@fn = @f WHERE ycsb_key = @k
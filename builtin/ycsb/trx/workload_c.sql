@@ -0,0 +1,4 @@
+{{- /* Workload C: read only (100% read) */ -}}
+
+-- prepare
+SELECT * FROM usertable WHERE ycsb_key = @k
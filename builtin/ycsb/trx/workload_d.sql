@@ -0,0 +1,9 @@
+{{- /* Workload D: read latest (95% read, 5% insert) */ -}}
+
+-- probability: 0.95
+-- prepare
+SELECT * FROM usertable WHERE ycsb_key = @k
+
+-- probability: 0.05
+-- prepare
+INSERT INTO usertable VALUES (NULL, {{repeat .Params.field_count ", " "@f"}})
@@ -0,0 +1,8 @@
+{{- /* Workload E: short ranges (95% scan, 5% insert) */ -}}
+
+-- probability: 0.95
+SELECT * FROM usertable WHERE ycsb_key >= @k ORDER BY ycsb_key LIMIT @scan_len
+
+-- probability: 0.05
+-- prepare
+INSERT INTO usertable VALUES (NULL, {{repeat .Params.field_count ", " "@f"}})
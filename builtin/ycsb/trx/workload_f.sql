@@ -0,0 +1,9 @@
+{{- /* Workload F: read-modify-write (50% read, 50% read-modify-write)
+Every iteration reads a record, and half of them then update the same
+record (@k is trx scoped), which is the read-modify-write. */ -}}
+
+-- prepare
+SELECT * FROM usertable WHERE ycsb_key = @k
+
+-- probability: 0.5
+UPDATE usertable SET field@fn = @f WHERE ycsb_key = @k
@@ -0,0 +1,94 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/stats"
+	"github.com/square/finch/trx"
+)
+
+// casClient returns a client that selects @v, then updates where v = @v with
+// -- cas: n that retries from the SELECT, then commits.
+func casClient(t *testing.T, name string, n int) (*Client, *fakeDriver, *stats.Trx) {
+	col := data.NewColumn(nil)
+	trxStats := stats.NewTrx("cas.sql")
+	c, drv := newFakeClient(t, name)
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT v FROM t WHERE id = 1", ResultSet: true, Outputs: []string{"@v"}},
+		{Query: "UPDATE t SET v = v + 1 WHERE id = 1 AND v = %v", Write: true, Inputs: []string{"@v"}, CAS: n, CASFrom: 1},
+		{Query: "COMMIT", Commit: true},
+	}
+	c.Data = []StatementData{
+		{TrxBoundary: trx.BEGIN, Outputs: []interface{}{col}},
+		{Inputs: []data.ValueFunc{col.Values}},
+		{TrxBoundary: trx.END},
+	}
+	c.Stats = []*stats.Trx{trxStats}
+	return c, drv, trxStats
+}
+
+func TestCAS(t *testing.T) {
+	// UPDATE affects 0 rows 3 times, then 1: SELECT and UPDATE are executed
+	// 4 times, and 3 retries are counted
+	c, drv, trxStats := casClient(t, "finch-cas-test", 5)
+	drv.rows = map[string][]int{"UPDATE t SET v = v + 1 WHERE id = 1 AND v = 20": {0, 0, 0}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{}
+	for i := 0; i < 4; i++ {
+		expect = append(expect,
+			"query SELECT v FROM t WHERE id = 1 0",
+			"exec UPDATE t SET v = v + 1 WHERE id = 1 AND v = 20 0",
+		)
+	}
+	expect = append(expect, "exec COMMIT 0")
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+	if n := trxStats.Swap().Retries; n != 3 {
+		t.Errorf("got %d retries, expected 3", n)
+	}
+}
+
+func TestCAS_MaxRetries(t *testing.T) {
+	// UPDATE always affects 0 rows, but it's retried only 2 times per
+	// iteration, then the trx continues (COMMIT), and the count resets on
+	// the next iteration
+	c, drv, trxStats := casClient(t, "finch-cas-max-test", 2)
+	c.Iter = 2
+	drv.rows = map[string][]int{"UPDATE t SET v = v + 1 WHERE id = 1 AND v = 20": {0, 0, 0, 0, 0, 0, 0}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{}
+	for iter := 0; iter < 2; iter++ {
+		for i := 0; i < 3; i++ {
+			expect = append(expect,
+				"query SELECT v FROM t WHERE id = 1 0",
+				"exec UPDATE t SET v = v + 1 WHERE id = 1 AND v = 20 0",
+			)
+		}
+		expect = append(expect, "exec COMMIT 0")
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+	if n := trxStats.Swap().Retries; n != 4 {
+		t.Errorf("got %d retries, expected 4", n)
+	}
+}
@@ -5,10 +5,14 @@ package client
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -40,24 +44,208 @@ type Client struct {
 	DefaultDb        string
 	IterExecGroup    uint32
 	IterExecGroupPtr *uint32
+	IterExecGroupN   uint32 // claim IterExecGroupPtr iterations in chunks of N (see IterChunk)
 	IterClients      uint32
 	IterClientsPtr   *uint32
+	IterClientsN     uint32 // claim IterClientsPtr iterations in chunks of N (see IterChunk)
 	Iter             uint
+	StartDelay       time.Duration
 	QPS              <-chan bool
 	TPS              <-chan bool
+	TrxWeights       []uint    // execute one trx per iteration chosen by weight
+	QueryComment     bool      // prepend /* finch ... */ to every query
+	RunId            string    // run=ID in QueryComment if set
+	QueryHint        string    // optimizer hint /*+ ... */ in SELECT, INSERT, etc.
+	Counters         *Counters // stage-wide counts for config.stage.exit
+	Share            *Share    // clients on this compute if config.stage.compute.elastic
+	Pause            *Pause    // stage paused by server control API
+	Progress         *uint64   // iterations started by clients with Iter, for config.stage.progress
+
+	// MySQL error code => finch.E* flags (default: finch.MySQLErrorHandling)
+	ErrorHandling map[uint16]byte
+
+	// Prepare statements client-side (proxies): don't prepare on the server,
+	// execute with values bound by the driver (DSN interpolateParams=true)
+	ClientPrepare bool
+
+	// Reconnect on failover and measure downtime (config.stage.failover)
+	Failover *Failover
+
+	// Execute on the driver connection, not through database/sql (see fastConn)
+	FastPath bool
+
+	// Clock to measure response time (default: stats.MonotonicClock)
+	Clock stats.Clock
+
+	// Pin to a thread and CPU (config.stage.pin-clients; see pin)
+	Pin bool
+	CPU int
+
+	// Statements in flight on separate connections (see runPipeline)
+	Pipeline uint
+
+	// Connections to round-robin trx across (see connectAll)
+	Connections uint
+
+	// Bound rows scanned per statement and memory of saved columns (0 = no limit)
+	// (config.stage.save-limits)
+	SaveMaxRows   uint
+	SaveMaxMemory uint64
 
 	// Retrun value to DoneChane
 	Error Error
 
 	// --
-	ps     []*sql.Stmt
-	values [][]interface{}
-	conn   *sql.Conn
+	ps       []*sql.Stmt
+	fast     *fastConn        // if FastPath
+	queries  []string         // Statements[].Query with comment and hint, if any
+	tmpl     []*queryTemplate // queries compiled for unprepared, nil if prepared
+	values   [][]interface{}
+	conn     *sql.Conn
+	skip     [][]int    // statements to skip if no rows (trx.NO_ROWS_SKIP)
+	skipIter []uint     // skip statement on this iter
+	rand     *rand.Rand // for trx.Statement.Probability
+	repeat   []int      // passes in repeat block, indexed on last statement
+	trxStmt  []int      // first statement of each trx, and len(Statements), if TrxWeights
+	weights  []uint     // cumulative TrxWeights
+	status   status     // for Status
+	iterEG   uint32     // iterations claimed from IterExecGroupPtr, not run yet
+	iterCG   uint32     // iterations claimed from IterClientsPtr, not run yet
+	saved    []int      // size of saved columns per statement, if SaveMaxMemory
+	savedMem int        // sum of saved
+	trunc    []bool     // logged that statement was truncated at SaveMaxRows
+	preconn  bool       // connected by Preconnect, so Run doesn't connect
+	psFirst  []int      // first statement of prepare multi block, else itself
+	conns    []connSet  // if Connections > 1; current one is in conn, ps, fast
+	connNo   int        // index of current conn in conns
+
+	failoverGen uint64    // Failover.gen when connected
+	downSince   time.Time // first failover error, if down
+}
+
+// Status is a point-in-time view of a running client: whether it's connected,
+// the statement it's executing (or last executed), and its error count. Stage
+// prints it in a snapshot (SIGUSR1) to diagnose clients that appear stuck.
+type Status struct {
+	Connected bool
+	Done      bool
+	Iter      uint64
+	Statement int    // index into Client.Statements; -1 if none yet
+	Query     string // Statements[Statement].Query
+	Errors    uint64
+	LastError string
+}
+
+// status is the lock-free internal state returned by Client.Status. The client
+// writes it every statement and Status reads it from another goroutine, so it's
+// padded to its own cache lines, apart from the fields the client reads every
+// statement.
+type status struct {
+	_         [64]byte
+	connected atomic.Bool
+	done      atomic.Bool
+	iter      atomic.Uint64
+	stmt      atomic.Int32 // +1 so zero value is "none"
+	errors    atomic.Uint64
+	lastErr   atomic.Pointer[string]
+	_         [64]byte
+}
+
+// Status returns the current status of the client. It's safe to call while the
+// client is running.
+func (c *Client) Status() Status {
+	s := Status{
+		Connected: c.status.connected.Load(),
+		Done:      c.status.done.Load(),
+		Iter:      c.status.iter.Load(),
+		Statement: int(c.status.stmt.Load()) - 1,
+		Errors:    c.status.errors.Load(),
+	}
+	if s.Statement >= 0 && s.Statement < len(c.Statements) {
+		s.Query = c.Statements[s.Statement].Query
+	}
+	if err := c.status.lastErr.Load(); err != nil {
+		s.LastError = *err
+	}
+	return s
+}
+
+// Counters are stage-wide counts shared by all clients in a stage. Stage uses
+// them to check config.stage.exit conditions. Access with sync/atomic.
+type Counters struct {
+	Iter   uint64 // iterations started
+	Rows   uint64 // rows affected by writes (INSERT, UPDATE, DELETE, REPLACE)
+	Errors uint64 // query errors
+}
+
+// Share is the share of clients that run on this compute instance when
+// config.stage.compute.elastic is true: the server rebalances clients across
+// compute instances as they join and leave. Instance I of N runs clients
+// with index K (0-indexed in the client group) where K % N == I.
+type Share struct {
+	v uint64 // I<<32 | N
+}
+
+func (s *Share) Set(i, n uint) {
+	atomic.StoreUint64(&s.v, uint64(i)<<32|uint64(n))
+}
+
+func (s *Share) Get() (uint, uint) {
+	v := atomic.LoadUint64(&s.v)
+	return uint(v >> 32), uint(v & 0xFFFFFFFF)
+}
+
+// Active returns true if client k runs on this compute instance. It returns
+// false for all clients until the server sets the share.
+func (s *Share) Active(k uint) bool {
+	i, n := s.Get()
+	return n > 0 && k%n == i
+}
+
+// Pause pauses all clients in a stage between iterations. The server pauses
+// and resumes a stage with the control API (POST /control/pause|resume).
+type Pause struct {
+	v uint32 // 1 = paused
+}
+
+// Set pauses or resumes clients. It returns true if the state changed.
+func (p *Pause) Set(paused bool) bool {
+	var v uint32
+	if paused {
+		v = 1
+	}
+	return atomic.SwapUint32(&p.v, v) != v
+}
+
+func (p *Pause) Paused() bool {
+	return atomic.LoadUint32(&p.v) == 1
 }
 
 type Error struct {
 	Err         error
 	StatementNo int
+	Values      []string // bound values of StatementNo, if any (finch.ErrorValues)
+}
+
+// ErrorContext returns the statement that caused Error, where it's defined in
+// the trx file, and its bound values, if any, like "(query) at file:line values:
+// [1, abc]". Values are truncated to finch.MAX_ERROR_VALUE, and the full values
+// are in the error log (--error-log).
+func (c *Client) ErrorContext() string {
+	return errorContext(c.Statements[c.Error.StatementNo], c.Error.Values)
+}
+
+func errorContext(s *trx.Statement, values []string) string {
+	str := fmt.Sprintf("(%s) at %s", s.Query, statementLine(s))
+	if len(values) > 0 {
+		str += " values: [" + strings.Join(values, ", ") + "]"
+	}
+	return str
+}
+
+// statementLine returns where the statement is defined: "file:line".
+func statementLine(s *trx.Statement) string {
+	return fmt.Sprintf("%s:%d", filepath.Base(s.File), s.Line)
 }
 
 type StatementData struct {
@@ -68,17 +256,168 @@ type StatementData struct {
 }
 
 func (c *Client) Init() error {
+	if c.Clock == nil {
+		c.Clock = stats.MonotonicClock
+	}
 	c.ps = make([]*sql.Stmt, len(c.Statements))
 	c.values = make([][]interface{}, len(c.Statements))
+	c.queries = make([]string, len(c.Statements))
+	c.tmpl = make([]*queryTemplate, len(c.Statements))
 	for i, s := range c.Statements {
 		if len(s.Inputs) > 0 {
 			c.values[i] = make([]interface{}, len(s.Inputs))
 		}
+		c.queries[i] = c.query(s)
+		if !s.Prepare {
+			c.tmpl[i] = newQueryTemplate(c.queries[i])
+		}
 	}
 	c.Error = Error{}
+
+	if c.Pipeline > 1 {
+		if err := c.checkPipeline(); err != nil {
+			return fmt.Errorf("client %s: %s", c.RunLevel.ClientId(), err)
+		}
+	}
+
+	// Repeat block counters are indexed on the last statement in the block
+	for _, s := range c.Statements {
+		if s.Repeat > 0 {
+			c.repeat = make([]int, len(c.Statements))
+			break
+		}
+	}
+
+	// Per-client rand for -- probability and trx weights because the global
+	// rand is locked
+	for _, s := range c.Statements {
+		if s.Probability > 0 {
+			c.rand = rand.New(rand.NewSource(time.Now().UnixNano() + int64(c.RunLevel.Client)))
+			break
+		}
+	}
+
+	// Trx weights (workload.weights): statement range of each trx, and cumulative
+	// weights to choose one trx per iteration
+	if len(c.TrxWeights) > 0 {
+		c.trxStmt = make([]int, 0, len(c.TrxWeights)+1)
+		for i := range c.Statements {
+			if c.Data[i].TrxBoundary&trx.BEGIN != 0 {
+				c.trxStmt = append(c.trxStmt, i)
+			}
+		}
+		if len(c.trxStmt) != len(c.TrxWeights) {
+			return fmt.Errorf("client %s has %d trx weights but %d trx", c.RunLevel.ClientId(), len(c.TrxWeights), len(c.trxStmt))
+		}
+		c.trxStmt = append(c.trxStmt, len(c.Statements))
+		c.weights = make([]uint, len(c.TrxWeights))
+		total := uint(0)
+		for i, w := range c.TrxWeights {
+			total += w
+			c.weights[i] = total
+		}
+		if c.rand == nil {
+			c.rand = rand.New(rand.NewSource(time.Now().UnixNano() + int64(c.RunLevel.Client)))
+		}
+	}
+
+	// For -- if-no-rows: skip, find the statements in the same trx that use the
+	// saved columns. If the SELECT returns no rows, these are skipped on that
+	// iteration.
+	c.skip = make([][]int, len(c.Statements))
+	c.skipIter = make([]uint, len(c.Statements))
+	for i, s := range c.Statements {
+		if s.NoRows != trx.NO_ROWS_SKIP {
+			continue
+		}
+		outputs := map[string]bool{}
+		for _, dataKey := range s.Outputs {
+			outputs[dataKey] = true
+		}
+		for j := i + 1; j < len(c.Statements) && c.Data[j].TrxBoundary&trx.BEGIN == 0; j++ {
+			for _, dataKey := range c.Statements[j].Inputs {
+				if outputs[dataKey] {
+					c.skip[i] = append(c.skip[i], j)
+					break
+				}
+			}
+		}
+	}
+
+	c.saved = make([]int, len(c.Statements))
+	c.trunc = make([]bool, len(c.Statements))
+	c.initPrepare()
 	return nil
 }
 
+// hintKeywords are the statements that can have optimizer hints.
+var hintKeywords = map[string]bool{"SELECT": true, "INSERT": true, "REPLACE": true, "UPDATE": true, "DELETE": true}
+
+// commentValue makes names safe in the query comment: no end of comment, and
+// no spaces so key=value pairs are easy to parse.
+var commentValue = strings.NewReplacer("*/", "", " ", "_")
+
+// unprepared returns the query and args to execute statement i without a
+// server-side prepared statement: values printed into the query, or bound by
+// the driver if the statement is prepared and ClientPrepare is true.
+func (c *Client) unprepared(i int) (string, []interface{}) {
+	if c.ClientPrepare && c.Statements[i].Prepare {
+		return c.queries[i], c.values[i]
+	}
+	if c.tmpl[i] != nil {
+		return c.tmpl[i].format(c.values[i]), nil
+	}
+	return fmt.Sprintf(c.queries[i], c.values[i]...), nil
+}
+
+// query returns the statement query with the optimizer hint (QueryHint) after
+// the first keyword and the comment (QueryComment) prepended, if set. The
+// comment identifies the workload: stage, exec group, client group, client,
+// and trx, so server-side logs, proxies, and performance_schema can attribute
+// queries to the workload. With a run ID (RunId), queries from all stages and
+// computes in one run can be joined with the results.
+func (c *Client) query(s *trx.Statement) string {
+	q := s.Query
+	if c.QueryHint != "" {
+		kw := strings.TrimLeft(q, " \t\n")
+		if n := strings.IndexAny(kw, " \t\n"); n > 0 && hintKeywords[strings.ToUpper(kw[:n])] {
+			hint := c.QueryHint
+			if !s.Prepare {
+				hint = strings.ReplaceAll(hint, "%", "%%") // query is a fmt format
+			}
+			q = kw[:n] + " /*+ " + hint + " */" + kw[n:]
+		}
+	}
+	if c.QueryComment {
+		rl := c.RunLevel
+		run := ""
+		if c.RunId != "" {
+			run = "run=" + commentValue.Replace(c.RunId) + " "
+		}
+		comment := fmt.Sprintf("/* finch %sstage=%s exec-group=%s client-group=%d client=%d trx=%s */ ",
+			run, commentValue.Replace(rl.StageName), commentValue.Replace(rl.ExecGroupName), rl.ClientGroup, rl.Client, commentValue.Replace(s.Trx))
+		if !s.Prepare {
+			comment = strings.ReplaceAll(comment, "%", "%%") // query is a fmt format
+		}
+		q = comment + q
+	}
+	return q
+}
+
+// next returns the next statement to execute after statement i: the first
+// statement in a repeat block if i is the last statement in the block and there
+// are more passes (-- repeat), else i+1.
+func (c *Client) next(i int) int {
+	if c.Statements[i].Repeat > 1 {
+		c.repeat[i] += 1
+		if c.repeat[i] < c.Statements[i].Repeat {
+			return i - c.Statements[i].RepeatFrom
+		}
+		c.repeat[i] = 0
+	}
+	return i + 1
+}
+
 func (c *Client) Connect(ctx context.Context, cerr error, stmtNo int, trxActive bool) error {
 	if ctx.Err() != nil { // finch terminated (CTRL-C)?
 		return ctx.Err()
@@ -90,7 +429,14 @@ func (c *Client) Connect(ctx context.Context, cerr error, stmtNo int, trxActive
 	silent := false
 	// Connect called due to error on query execution?
 	if cerr != nil {
-		errFlags, handled := finch.MySQLErrorHandling[myerr.MySQLErrorCode(cerr)]
+		errHandling := c.ErrorHandling
+		if errHandling == nil {
+			errHandling = finch.MySQLErrorHandling
+		}
+		errFlags, handled := errHandling[myerr.MySQLErrorCode(cerr)]
+		if c.Failover != nil && c.Failover.readOnly(myerr.MySQLErrorCode(cerr)) {
+			handled = false // reconnect to rediscover the writer
+		}
 		if c.Statements[stmtNo].DDL && !handled {
 			return fmt.Errorf("DDL: %s", cerr)
 		}
@@ -110,14 +456,38 @@ func (c *Client) Connect(ctx context.Context, cerr error, stmtNo int, trxActive
 		}
 		silent = (errFlags&finch.Esilent != 0) // log the error (here and below)? uhandled errors are logged
 		if !silent {
-			log.Printf("Client %s reconnect on error: %s (%s)", c.RunLevel.ClientId(), cerr, c.Statements[stmtNo].Query)
+			log.Printf("Client %s reconnect on error: %s %s", c.RunLevel.ClientId(), cerr,
+				errorContext(c.Statements[stmtNo], finch.ErrorValues(c.values[stmtNo], finch.MAX_ERROR_VALUE)))
 		}
 	}
 
+	retryWait := ConnectRetryWait
+	if c.Failover != nil {
+		retryWait = c.Failover.ReconnectWait
+	}
+
+	reconnect := c.conn != nil
 	if c.conn != nil {
+		c.status.connected.Store(false)
+		if c.fast != nil {
+			c.fast.close()
+			c.fast = nil
+		}
+		for i := range c.ps {
+			if c.ps[i] != nil {
+				c.ps[i].Close() // prepared on the old connection
+				c.ps[i] = nil
+			}
+		}
+		if c.Failover != nil || errors.Is(cerr, driver.ErrBadConn) {
+			// Discard the connection, don't return it to the pool, because it
+			// might be connected to the old writer. database/sql discards bad
+			// connections, but not on the fast path, which bypasses it.
+			c.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
 		c.conn.Close()
 		c.conn = nil
-		time.Sleep(ConnectRetryWait)
+		time.Sleep(retryWait)
 	}
 
 	t0 := time.Now()
@@ -128,13 +498,23 @@ func (c *Client) Connect(ctx context.Context, cerr error, stmtNo int, trxActive
 		if c.conn != nil {
 			break // success
 		}
-		time.Sleep(ConnectRetryWait)
+		time.Sleep(retryWait)
 	}
 
 	if ctx.Err() != nil { // finch terminated (CTRL-C)?
 		return ctx.Err()
 	}
 
+	c.status.connected.Store(true)
+	if c.Failover != nil {
+		c.failoverGen = c.Failover.gen.Load()
+	}
+	if reconnect {
+		finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_RECONNECTED, RunLevel: c.RunLevel, Error: cerr})
+	} else {
+		finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_CONNECTED, RunLevel: c.RunLevel})
+	}
+
 	if cerr != nil && !silent {
 		log.Printf("Client %s reconnected in %.3fs", c.RunLevel.ClientId(), time.Now().Sub(t0).Seconds())
 	}
@@ -146,59 +526,96 @@ func (c *Client) Connect(ctx context.Context, cerr error, stmtNo int, trxActive
 		}
 	}
 
-	var err error
-	for i, s := range c.Statements {
-		if !s.Prepare {
-			continue
+	if c.FastPath {
+		if c.fast = newFastConn(c.conn, len(c.Statements)); c.fast == nil {
+			return fmt.Errorf("mysql.fast-path: driver does not implement the required database/sql/driver interfaces")
 		}
-		if c.ps[i] != nil {
-			continue // prepare multi
+	}
+
+	// On reconnect, statements are prepared lazily on first use (see prepare)
+	if reconnect {
+		return nil
+	}
+	for i := range c.Statements {
+		if !c.needPrepare(i) {
+			continue // not prepared, or prepare multi
 		}
-		c.ps[i], err = c.conn.PrepareContext(ctx, s.Query)
-		if err != nil {
-			c.Error.StatementNo = i
+		if err := c.prepare(ctx, i); err != nil {
 			return fmt.Errorf("prepare: %s", err)
 		}
+	}
+	return nil
+}
 
-		// If s.PrepareMulti = 3, it means this ps should be used for 3 statments
-		// including this one, so copy it into the next 2 statements. If = 0, this
-		// loop doesn't run becuase j = 1; j < 0 is immediately false.
-		for j := 1; j < s.PrepareMulti; j++ {
-			c.ps[i+j] = c.ps[i]
-		}
+// Preconnect connects and prepares statements before Run so that connection
+// setup isn't measured in the stage (config.stage.preconnect). It must be
+// called after Init and before Run. It's a no-op for pipelined clients, which
+// connect their lanes in Run. On error, the connection is left for Run to
+// reconnect, which returns the error if it happens again.
+func (c *Client) Preconnect(ctx context.Context) error {
+	if c.Pipeline > 1 {
+		return nil
+	}
+	if err := c.connectAll(ctx); err != nil {
+		return err
 	}
+	c.preconn = true
 	return nil
 }
 
 func (c *Client) Run(ctxExec context.Context) {
 	finch.Debug("run client %s: %d stmts, iter %d/%d/%d", c.RunLevel.ClientId(), len(c.Statements), c.IterExecGroup, c.IterClients, c.Iter)
 	var err error
+	trxActive := false
 	defer func() {
 		if r := recover(); r != nil {
 			b := make([]byte, 4096)
 			n := runtime.Stack(b, false)
 			err = fmt.Errorf("PANIC: %v\n%s", r, string(b[0:n]))
 		}
-		for i := range c.ps {
-			if c.ps[i] == nil {
-				continue
-			}
-			c.ps[i].Close()
-		}
-		if c.conn != nil {
-			c.conn.Close()
+		if trxActive {
+			c.rollback() // before the conn returns to the pool (stage.handoff)
 		}
+		c.releaseIter()
+		c.closeAll()
+		c.status.connected.Store(false)
+		c.status.done.Store(true)
 		// Context cancellation is not an error it's runtime elapsing or CTRL-C
 		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
 			c.Error.Err = err
 		}
+		finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_DONE, RunLevel: c.RunLevel, Iter: uint(c.status.iter.Load()), Error: c.Error.Err})
 		c.DoneChan <- c
 	}()
 
-	if err = c.Connect(ctxExec, nil, -1, false); err != nil {
+	if c.Pin {
+		c.pin()
+	}
+
+	// Stagger client start (workload.start-jitter) so all clients don't
+	// connect and execute at the same time
+	if c.StartDelay > 0 {
+		select {
+		case <-time.After(c.StartDelay):
+		case <-ctxExec.Done():
+			err = ctxExec.Err()
+			return
+		case <-finch.Stopping(ctxExec):
+			return
+		}
+	}
+
+	if c.Pipeline > 1 {
+		err = c.runPipeline(ctxExec)
 		return
 	}
 
+	if !c.preconn {
+		if err = c.connectAll(ctxExec); err != nil {
+			return
+		}
+	}
+
 	var rc data.RunCount
 	rc[data.CONN] = 1 // first MySQL connection ^
 
@@ -208,42 +625,81 @@ func (c *Client) Run(ctxExec context.Context) {
 	rc[data.EXEC_GROUP] = c.RunLevel.ExecGroup
 	rc[data.STAGE] = c.RunLevel.Stage
 
-	var rows *sql.Rows
+	var rows resultRows
 	var res sql.Result
-	var t time.Time
+	var t int64 // Clock
+	var nRows uint
+	var retry int
+	var casRetry int
+	stop := finch.Stopping(ctxExec) // graceful stop (CTRL-C)
 
 	// trxNo indexes into c.Stats and resets to 0 on each iteration. Remember:
 	// these are finch trx (files), not MySQL trx, so trx boundaries mark the
 	// beginning and end of a finch trx (file). User is expected to make finch
 	// trx boundaries meaningful.
 	trxNo := -1
-	trxActive := false
 
 	//
 	// CRITICAL LOOP: no debug or superfluous function calls
 	//
 ITER:
 	for {
-		if c.IterExecGroup > 0 && atomic.AddUint32(c.IterExecGroupPtr, 1) > c.IterExecGroup {
+		trxActive = false // previous iteration, if any, is complete
+		select {
+		case <-stop: // graceful stop (CTRL-C): don't start another iteration
 			return
+		default:
 		}
-		if c.IterClients > 0 && atomic.AddUint32(c.IterClientsPtr, 1) > c.IterClients {
-			return
+		if (c.Share != nil && !c.Share.Active(c.RunLevel.Client-1)) || (c.Pause != nil && c.Pause.Paused()) {
+			// Client runs on another compute instance now (elastic stage);
+			// idle until rebalanced back to this instance. Or stage paused;
+			// idle until resumed.
+			select {
+			case <-time.After(100 * time.Millisecond):
+				continue ITER
+			case <-ctxExec.Done():
+				err = ctxExec.Err()
+				return
+			}
+		}
+		if c.Failover != nil && c.Failover.gen.Load() != c.failoverGen {
+			// DNS flip: reconnect to rediscover the writer
+			if err = c.Connect(ctxExec, nil, -1, false); err != nil {
+				return
+			}
+			rc[data.CONN] += 1
 		}
-		if c.Iter > 0 && rc[data.ITER] == c.Iter {
+		if !c.nextIter(rc[data.ITER]) {
 			return
 		}
 		rc[data.ITER] += 1
+		c.status.iter.Store(uint64(rc[data.ITER]))
+		finch.IterEvent(c.RunLevel, rc[data.ITER])
+		if c.Counters != nil {
+			atomic.AddUint64(&c.Counters.Iter, 1)
+		}
+		if c.Progress != nil {
+			atomic.AddUint64(c.Progress, 1)
+		}
 		trxNo = -1
-		trxActive = false
+		casRetry = 0
+		for i := range c.repeat { // only if -- repeat
+			c.repeat[i] = 0 // reset if prev iter ended (error) in a repeat block
+		}
 
-		for i := range c.Statements {
-			// Idle time
-			if c.Statements[i].Idle != 0 {
-				time.Sleep(c.Statements[i].Idle)
-				continue
+		// Execute all trx, or one trx chosen by weight (workload.weights)
+		first, last := 0, len(c.Statements)
+		if c.weights != nil {
+			w := uint(c.rand.Int63n(int64(c.weights[len(c.weights)-1])))
+			k := 0
+			for c.weights[k] <= w {
+				k++
 			}
+			first, last = c.trxStmt[k], c.trxStmt[k+1]
+			trxNo = k - 1 // += 1 on trx BEGIN
+		}
 
+		for i := first; i < last; i = c.next(i) {
 			// Is this query the start of a new (finch) trx file? This is not
 			// a MySQL trx (either BEGIN or implicit). It marks finch trx scope
 			// "trx" is a trx file in the config assigned to this client.
@@ -251,10 +707,31 @@ ITER:
 				rc[data.TRX] += 1
 				trxNo += 1
 				trxActive = true
+				if c.conns != nil {
+					c.nextConn()
+				}
 			} else if c.Data[i].TrxBoundary&trx.END != 0 {
 				trxActive = false
 			}
 
+			// Idle time, after trx boundary in case idle is first in trx file
+			if c.Statements[i].Idle != 0 {
+				time.Sleep(c.Statements[i].Idle)
+				continue
+			}
+
+			// Skip if previous SELECT returned no rows (-- if-no-rows: skip)
+			if c.skipIter[i] == rc[data.ITER] {
+				continue
+			}
+
+			// Execute on only a fraction of iterations (-- probability: P)
+			if c.Statements[i].Probability > 0 && c.rand.Float64() >= c.Statements[i].Probability {
+				continue
+			}
+			retry = 0
+
+		CAS:
 			// If BEGIN, check TPS rate limiter
 			if c.TPS != nil && c.Statements[i].Begin {
 				<-c.TPS
@@ -268,41 +745,110 @@ ITER:
 			// Generate new data values for this query. A single data generator
 			// can return multiple values, so d makes copy() append, else copy()
 			// would start at [0:] each time
+		GENERATE:
 			rc[data.STATEMENT] += 1
+			c.status.stmt.Store(int32(i + 1))
 			d := 0
 			for _, f := range c.Data[i].Inputs {
 				d += copy(c.values[i][d:], f(rc))
 			}
 
+			// Prepare on first use after reconnect
+			if c.needPrepare(i) {
+				if err = c.prepare(ctxExec, i); err != nil {
+					if myerr.MySQLErrorCode(err) != 0 {
+						err = fmt.Errorf("prepare: %s", err) // SQL error, like on connect
+						return
+					}
+					goto ERROR // connection error: reconnect
+				}
+			}
+
 			if c.Statements[i].ResultSet {
 				//
-				// SELECT
+				// SELECT (or write with RETURNING: MariaDB)
 				//
-				t = time.Now()
-				if c.ps[i] != nil {
+				if c.Statements[i].Limit != nil { // limit rows (RETURNING)
+					if !c.Statements[i].Limit.More(c.conn) {
+						return // chan closed = no more writes
+					}
+				}
+			SELECT:
+				t = c.Clock()
+				if c.fast != nil {
+					rows, err = c.fastQuery(ctxExec, i)
+				} else if c.ps[i] != nil {
 					rows, err = c.ps[i].QueryContext(ctxExec, c.values[i]...)
 				} else {
-					rows, err = c.conn.QueryContext(ctxExec, fmt.Sprintf(c.Statements[i].Query, c.values[i]...))
+					q, args := c.unprepared(i)
+					rows, err = c.conn.QueryContext(ctxExec, q, args...)
 				}
 				if c.Stats[trxNo] != nil {
-					c.Stats[trxNo].Record(stats.READ, time.Now().Sub(t).Microseconds())
+					if c.Statements[i].Write {
+						c.Stats[trxNo].Record(stats.WRITE, c.Clock()-t)
+					} else {
+						c.Stats[trxNo].Record(stats.READ, c.Clock()-t)
+					}
 				}
 				if err != nil {
 					goto ERROR
 				}
-				if c.Data[i].Outputs != nil {
-					// @todo what if no row match? This loop won't happen,
-					// and the column generator won't be called, which will
-					// make it return nil later when used as input to another
-					// query.
+				if c.Data[i].Outputs != nil || c.Statements[i].Write {
+					// If no row matches, this loop won't happen and the column
+					// generators won't be called, so they keep their previous
+					// values (nil if none) unless -- if-no-rows is set (below).
+					nRows = 0
 					for rows.Next() {
-						if err = rows.Scan(c.Data[i].Outputs...); err != nil {
-							rows.Close()
-							goto ERROR
+						if c.Data[i].Outputs != nil {
+							if c.SaveMaxRows > 0 && nRows == c.SaveMaxRows && !c.Statements[i].Write {
+								c.truncated(i)
+								break // config.stage.save-limits.max-rows
+							}
+							if err = rows.Scan(c.Data[i].Outputs...); err != nil {
+								rows.Close()
+								goto ERROR
+							}
 						}
+						nRows++
 					}
 				}
 				rows.Close()
+				if c.SaveMaxMemory > 0 && nRows > 0 && c.Data[i].Outputs != nil {
+					if err = c.saveMemory(i); err != nil {
+						goto ERROR
+					}
+				}
+				if c.Statements[i].Write { // RETURNING: rows returned = rows affected
+					if c.Statements[i].Limit != nil {
+						c.Statements[i].Limit.Affected(int64(nRows))
+					}
+					if c.Counters != nil { // stage.exit.rows
+						atomic.AddUint64(&c.Counters.Rows, uint64(nRows))
+					}
+				}
+				if c.Data[i].Outputs != nil && nRows == 0 && c.Statements[i].NoRows != trx.NO_ROWS_IGNORE {
+					switch c.Statements[i].NoRows {
+					case trx.NO_ROWS_RETRY:
+						if retry < c.Statements[i].NoRowsRetry {
+							retry++
+							goto SELECT
+						}
+					case trx.NO_ROWS_REGENERATE:
+						if retry < c.Statements[i].NoRowsRetry {
+							retry++
+							goto GENERATE
+						}
+					case trx.NO_ROWS_SKIP:
+						for _, j := range c.skip[i] {
+							c.skipIter[j] = rc[data.ITER]
+						}
+					case trx.NO_ROWS_ERROR:
+						err = trx.ErrNoRows
+						c.Error.StatementNo = i
+						c.Error.Values = finch.ErrorValues(c.values[i], finch.MAX_ERROR_VALUE)
+						return
+					}
+				}
 			} else {
 				//
 				// Write or query without result set (e.g. BEGIN, SET, etc.)
@@ -312,22 +858,25 @@ ITER:
 						return // chan closed = no more writes
 					}
 				}
-				t = time.Now()
-				if c.ps[i] != nil { // exec ---------------------------------
+				t = c.Clock()
+				if c.fast != nil { // exec ----------------------------------
+					res, err = c.fastExec(ctxExec, i)
+				} else if c.ps[i] != nil {
 					res, err = c.ps[i].ExecContext(ctxExec, c.values[i]...)
 				} else {
-					res, err = c.conn.ExecContext(ctxExec, fmt.Sprintf(c.Statements[i].Query, c.values[i]...))
+					q, args := c.unprepared(i)
+					res, err = c.conn.ExecContext(ctxExec, q, args...)
 				}
 				if c.Stats[trxNo] != nil { // record stats ------------------
 					switch {
 					case c.Statements[i].Write:
-						c.Stats[trxNo].Record(stats.WRITE, time.Now().Sub(t).Microseconds())
+						c.Stats[trxNo].Record(stats.WRITE, c.Clock()-t)
 					case c.Statements[i].Commit:
-						c.Stats[trxNo].Record(stats.COMMIT, time.Now().Sub(t).Microseconds())
+						c.Stats[trxNo].Record(stats.COMMIT, c.Clock()-t)
 					default:
 						// BEGIN, SET, and other statements that aren't reads or writes
 						// but count and response time will be included in total
-						c.Stats[trxNo].Record(stats.TOTAL, time.Now().Sub(t).Microseconds())
+						c.Stats[trxNo].Record(stats.TOTAL, c.Clock()-t)
 					}
 				}
 				if err != nil { // handle err, if any -----------------------
@@ -337,19 +886,53 @@ ITER:
 					n, _ := res.RowsAffected()
 					c.Statements[i].Limit.Affected(n)
 				}
+				if c.Counters != nil && c.Statements[i].Write { // stage.exit.rows
+					n, _ := res.RowsAffected()
+					atomic.AddUint64(&c.Counters.Rows, uint64(n))
+				}
 				if c.Data[i].InsertId != nil { // insert ID -----------------
 					id, _ := res.LastInsertId()
 					c.Data[i].InsertId.Scan(id)
 				}
+				if c.Statements[i].CAS > 0 { // compare and swap -----------
+					if n, _ := res.RowsAffected(); n == 0 && casRetry < c.Statements[i].CAS {
+						casRetry++
+						if c.Stats[trxNo] != nil {
+							c.Stats[trxNo].Retry()
+						}
+						i -= c.Statements[i].CASFrom // usually SELECT version
+						retry = 0
+						goto CAS
+					}
+					casRetry = 0
+				}
 			} // execute
+			if !c.downSince.IsZero() { // failover downtime ended
+				c.Failover.up(time.Since(c.downSince))
+				c.downSince = time.Time{}
+			}
 			continue // next query
 
 		ERROR:
 			if c.Stats[trxNo] != nil && ctxExec.Err() == nil {
 				c.Stats[trxNo].Error(myerr.MySQLErrorCode(err))
 			}
+			if c.Counters != nil && ctxExec.Err() == nil {
+				atomic.AddUint64(&c.Counters.Errors, 1)
+			}
+			if ctxExec.Err() == nil {
+				c.status.errors.Add(1)
+				errMsg := err.Error()
+				c.status.lastErr.Store(&errMsg)
+				finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_ERROR, RunLevel: c.RunLevel, Iter: rc[data.ITER], Error: err})
+				finch.LogClientError(c.RunLevel.ClientId(), myerr.MySQLErrorCode(err), err, c.Statements[i].Query, statementLine(c.Statements[i]), c.values[i])
+				if c.Failover != nil && c.downSince.IsZero() && failoverError(myerr.MySQLErrorCode(err)) {
+					c.downSince = time.Now()
+				}
+			}
 			if err = c.Connect(ctxExec, err, i, trxActive); err != nil {
 				c.Error.StatementNo = i
+				c.Error.Values = finch.ErrorValues(c.values[i], finch.MAX_ERROR_VALUE)
 				return // unrecoverable error or runtime elapsed (context timeout/cancel)
 			}
 			rc[data.CONN] += 1 // reconnected or recovered after query error
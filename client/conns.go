@@ -0,0 +1,108 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/square/finch"
+)
+
+// A client with Connections > 1 (config.stage.workload.connections) holds that
+// many connections and switches to the next one at the start of every trx, so
+// connection-count scaling (like 10k connections at modest QPS each) can be
+// tested without 10k clients. Trx are round-robin, not statements, because
+// statements in a trx can depend on the connection: an explicit transaction,
+// session variables, and so on.
+//
+// The current connection is always in conn, ps, and fast, so Run and Connect
+// work as usual. nextConn swaps them with the next connSet. Only the current
+// connection is reconnected on error or DNS flip (config.stage.failover); the
+// others are reconnected when they return an error.
+
+// connSet is one connection of a client and its prepared statements.
+type connSet struct {
+	conn *sql.Conn
+	ps   []*sql.Stmt
+	fast *fastConn
+}
+
+// connectAll connects all Connections, or calls Connect if there's only one.
+// Each connection prepares its own statements.
+func (c *Client) connectAll(ctx context.Context) error {
+	if c.Connections <= 1 {
+		return c.Connect(ctx, nil, -1, false)
+	}
+	if c.conns != nil { // Preconnect failed
+		c.closeAll()
+		c.conn, c.fast = nil, nil
+		c.ps = make([]*sql.Stmt, len(c.Statements))
+	}
+	c.conns = make([]connSet, c.Connections)
+	for k := range c.conns {
+		if k > 0 {
+			c.conns[k-1] = connSet{conn: c.conn, ps: c.ps, fast: c.fast}
+			c.conn, c.fast = nil, nil
+			c.ps = make([]*sql.Stmt, len(c.Statements))
+		}
+		c.connNo = k
+		if err := c.Connect(ctx, nil, -1, false); err != nil {
+			return err // closeAll closes connections made so far
+		}
+	}
+	return nil // last conn is current, so nextConn on first trx switches to 0
+}
+
+// nextConn makes the next connection in conns current.
+func (c *Client) nextConn() {
+	c.conns[c.connNo] = connSet{conn: c.conn, ps: c.ps, fast: c.fast}
+	c.connNo = (c.connNo + 1) % len(c.conns)
+	next := c.conns[c.connNo]
+	c.conn, c.ps, c.fast = next.conn, next.ps, next.fast
+}
+
+// closeAll closes all connections and their prepared statements.
+func (c *Client) closeAll() {
+	if c.conns == nil {
+		closeConn(connSet{conn: c.conn, ps: c.ps, fast: c.fast})
+		return
+	}
+	c.conns[c.connNo] = connSet{conn: c.conn, ps: c.ps, fast: c.fast}
+	for _, s := range c.conns {
+		closeConn(s)
+	}
+}
+
+// rollback rolls back the current connection when the client returns in a
+// trx (runtime elapsed or CTRL-C), so the conn doesn't return to the pool with
+// an open trx and its locks, which the next stage would inherit if connections
+// are handed off (config.stage.handoff). If ROLLBACK fails, the conn is
+// discarded instead of returned to the pool.
+func (c *Client) rollback() {
+	if c.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
+	defer cancel()
+	if _, err := c.conn.ExecContext(ctx, "ROLLBACK"); err != nil {
+		finch.Debug("%s: ROLLBACK on exit: %s", c.RunLevel.ClientId(), err)
+		c.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+func closeConn(s connSet) {
+	for i := range s.ps {
+		if s.ps[i] == nil {
+			continue
+		}
+		s.ps[i].Close()
+	}
+	if s.fast != nil {
+		s.fast.close()
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/trx"
+)
+
+func TestConnections(t *testing.T) {
+	c, drv := newFakeClient(t, "finch-connections-test")
+	c.Iter = 3
+	c.Connections = 2
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t", ResultSet: true, Prepare: true},
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN | trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+
+	// Each connection prepares its own statement, and 3 trx on 2 connections
+	// end on the first one: 0, 1, 0
+	if len(c.conns) != 2 || c.conns[0].conn == c.conns[1].conn || c.conns[0].ps[0] == c.conns[1].ps[0] {
+		t.Fatalf("got %d connections %+v, expected 2 different", len(c.conns), c.conns)
+	}
+	if c.connNo != 0 {
+		t.Errorf("current connection %d, expected 0", c.connNo)
+	}
+	expect := []string{
+		"prepare SELECT c FROM t",
+		"prepare SELECT c FROM t",
+		"query stmt SELECT c FROM t 0",
+		"query stmt SELECT c FROM t 0",
+		"query stmt SELECT c FROM t 0",
+		"close SELECT c FROM t",
+		"close SELECT c FROM t",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRollbackOnExit(t *testing.T) {
+	for _, fail := range []string{"", "ROLLBACK"} {
+		// Runtime elapses in the trx, after BEGIN, while SLEEP executes
+		c, drv := newFakeClient(t, "finch-rollback-test"+fail)
+		drv.fail = fail
+		c.Iter = 0
+		c.Statements = []*trx.Statement{
+			{Query: "BEGIN", Begin: true},
+			{Query: "SELECT SLEEP(10)", ResultSet: true},
+			{Query: "COMMIT", Commit: true},
+		}
+		c.Data = []StatementData{{TrxBoundary: trx.BEGIN}, {}, {TrxBoundary: trx.END}}
+		if err := c.Init(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		c.Run(ctx)
+		cancel()
+		<-c.DoneChan
+
+		expect := []string{
+			"exec BEGIN 0",
+			"query SELECT SLEEP(10) 0",
+			"exec ROLLBACK 0",
+		}
+		if diff := deep.Equal(drv.log, expect); diff != nil {
+			t.Errorf("fail %q: %v", fail, diff)
+		}
+
+		// Conn returned to the pool after ROLLBACK, else discarded
+		idle := 1
+		if fail != "" {
+			idle = 0
+		}
+		if n := c.DB.Stats().Idle; n != idle {
+			t.Errorf("fail %q: got %d idle conns, expected %d", fail, n, idle)
+		}
+	}
+}
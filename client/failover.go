@@ -0,0 +1,67 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// failoverErrors are MySQL errors caused by failover: the writer is demoted to
+// read-only, or the connection is killed or lost when the writer restarts.
+var failoverErrors = map[uint16]bool{
+	1053: true, // server shutdown in progress
+	1290: true, // read-only (--read-only option)
+	1836: true, // read-only (Running in read-only mode)
+	1927: true, // connection was killed
+	2013: true, // lost connection to MySQL server during query
+}
+
+// Failover is shared by all clients in a stage for config.stage.failover. It
+// makes clients reconnect on read-only errors (ReconnectOnReadOnly) and after
+// a DNS flip (Flip), and it measures downtime as seen by clients: from the first
+// failover error to the next successful statement.
+type Failover struct {
+	ReconnectOnReadOnly bool
+	ReconnectWait       time.Duration // instead of ConnectRetryWait
+
+	gen    atomic.Uint64 // incremented by Flip
+	events atomic.Uint64 // client downtimes
+	total  atomic.Int64  // microseconds
+	max    atomic.Int64  // microseconds
+}
+
+// Flip makes all clients reconnect before their next iteration.
+func (f *Failover) Flip() {
+	f.gen.Add(1)
+}
+
+// Downtime returns the number of client downtimes, their total duration, and
+// the longest one.
+func (f *Failover) Downtime() (n uint64, total, max time.Duration) {
+	return f.events.Load(), time.Duration(f.total.Load()) * time.Microsecond, time.Duration(f.max.Load()) * time.Microsecond
+}
+
+// readOnly returns true if the client should reconnect on the MySQL error code.
+func (f *Failover) readOnly(code uint16) bool {
+	return f.ReconnectOnReadOnly && (code == 1290 || code == 1836)
+}
+
+// up records one client downtime d.
+func (f *Failover) up(d time.Duration) {
+	us := d.Microseconds()
+	f.events.Add(1)
+	f.total.Add(us)
+	for {
+		max := f.max.Load()
+		if us <= max || f.max.CompareAndSwap(max, us) {
+			return
+		}
+	}
+}
+
+// failoverError returns true if the error is caused by failover: one of the
+// failoverErrors, or code zero which is a lost connection (driver error).
+func failoverError(code uint16) bool {
+	return code == 0 || failoverErrors[code]
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	f := &Failover{ReconnectOnReadOnly: true}
+	if !f.readOnly(1290) || !f.readOnly(1836) {
+		t.Error("read-only errors not reconnect, expected reconnect")
+	}
+	if f.readOnly(1062) {
+		t.Error("duplicate key error is read-only, expected not")
+	}
+	f.ReconnectOnReadOnly = false
+	if f.readOnly(1290) {
+		t.Error("read-only error reconnect with on-read-only ignore, expected not")
+	}
+
+	f.up(2 * time.Second)
+	f.up(500 * time.Millisecond)
+	f.up(time.Second)
+	n, total, max := f.Downtime()
+	if n != 3 {
+		t.Errorf("got %d downtimes, expected 3", n)
+	}
+	if total != 3500*time.Millisecond {
+		t.Errorf("got total %s, expected 3.5s", total)
+	}
+	if max != 2*time.Second {
+		t.Errorf("got max %s, expected 2s", max)
+	}
+}
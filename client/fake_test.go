@@ -0,0 +1,136 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/square/finch"
+	"github.com/square/finch/stats"
+)
+
+// fakeDriver logs queries executed on the driver connection for tests that run
+// a client (see newFakeClient). Pipelined clients use many connections at once,
+// so the log is guarded by fakeMux. Executing fail returns an error, and query
+// "SELECT SLEEP(10)" blocks until the ctx is done. Queries return 2 rows and
+// execs affect 1 row unless rows has counts for the query ("stmt " prefix if
+// prepared), which are used in order. A count < 0 returns an error.
+type fakeDriver struct {
+	log  []string
+	fail string
+	rows map[string][]int
+}
+
+var fakeMux sync.Mutex
+
+func (c *fakeConn) logf(format string, args ...interface{}) {
+	fakeMux.Lock()
+	c.d.log = append(c.d.log, fmt.Sprintf(format, args...))
+	fakeMux.Unlock()
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+type fakeRows struct{ n, max int }
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+// nRows returns the next rows count for query q, else def.
+func (d *fakeDriver) nRows(q string, def int) int {
+	fakeMux.Lock()
+	defer fakeMux.Unlock()
+	if len(d.rows[q]) == 0 {
+		return def
+	}
+	n := d.rows[q][0]
+	d.rows[q] = d.rows[q][1:]
+	return n
+}
+
+func (c *fakeConn) Prepare(q string) (driver.Stmt, error) { return &fakeStmt{c, q}, nil }
+func (c *fakeConn) Close() error                          { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)             { return nil, driver.ErrSkip }
+func (c *fakeConn) PrepareContext(_ context.Context, q string) (driver.Stmt, error) {
+	c.logf("prepare %s", q)
+	return &fakeStmt{c, q}, nil
+}
+func (c *fakeConn) ExecContext(_ context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	c.logf("exec %s %d", q, len(args))
+	if q == c.d.fail {
+		return nil, fmt.Errorf("%s failed", q)
+	}
+	n := c.d.nRows(q, 1)
+	if n < 0 {
+		return nil, fmt.Errorf("%s failed", q)
+	}
+	return driver.RowsAffected(n), nil
+}
+func (c *fakeConn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	c.logf("query %s %d", q, len(args))
+	if q == "SELECT SLEEP(10)" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	n := c.d.nRows(q, 2)
+	if n < 0 {
+		return nil, fmt.Errorf("%s failed", q)
+	}
+	return &fakeRows{max: n}, nil
+}
+
+func (s *fakeStmt) Close() error                               { s.c.logf("close %s", s.query); return nil }
+func (s *fakeStmt) NumInput() int                              { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, driver.ErrSkip }
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, "stmt "+s.query, args)
+}
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, "stmt "+s.query, args)
+}
+
+func (r *fakeRows) Columns() []string { return []string{"c"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == r.max {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = int64(r.n * 10)
+	return nil
+}
+
+// newFakeClient returns a client that runs 1 iteration on a DB that uses a new
+// fakeDriver registered as name, which must be unique, and the driver to check
+// its log. Set Statements and Data, then call Init.
+func newFakeClient(t *testing.T, name string) (*Client, *fakeDriver) {
+	t.Helper()
+	drv := &fakeDriver{}
+	sql.Register(name, drv)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c := &Client{
+		DB:       db,
+		RunLevel: finch.RunLevel{Stage: 1, ExecGroup: 1, ClientGroup: 1, Client: 1},
+		Iter:     1,
+		DoneChan: make(chan *Client, 1),
+		Stats:    []*stats.Trx{nil},
+	}
+	return c, drv
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// resultRows is *sql.Rows or *fastRows: the rows returned by a statement with
+// a result set.
+type resultRows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Close() error
+}
+
+// fastConn is the fast path (config.mysql.fast-path): execute statements on the
+// driver connection directly instead of through database/sql, which locks the
+// connection, converts arguments, and starts a goroutine to watch the context
+// for every query. A client uses its connection (Client.conn) from only one
+// goroutine and holds it until closed, so none of that is needed.
+//
+// The driver connection is used outside sql.Conn.Raw, which database/sql doesn't
+// guarantee is safe, but it is as long as nothing else uses sql.Conn at the same
+// time. The driver must implement driver.ExecerContext, driver.QueryerContext,
+// and driver.ConnPrepareContext, and its statements driver.StmtExecContext and
+// driver.StmtQueryContext, else newFastConn returns nil.
+type fastConn struct {
+	execer   driver.ExecerContext
+	queryer  driver.QueryerContext
+	preparer driver.ConnPrepareContext
+	checker  driver.NamedValueChecker // optional
+	ps       []driver.Stmt            // like Client.ps
+	args     []driver.NamedValue      // reused for each statement
+	rows     fastRows                 // reused for each statement
+}
+
+// newFastConn returns the fast path for conn with n statements, or nil if the
+// driver doesn't implement the required interfaces.
+func newFastConn(conn *sql.Conn, n int) *fastConn {
+	f := &fastConn{ps: make([]driver.Stmt, n)}
+	conn.Raw(func(dc interface{}) error {
+		var ok1, ok2, ok3 bool
+		f.execer, ok1 = dc.(driver.ExecerContext)
+		f.queryer, ok2 = dc.(driver.QueryerContext)
+		f.preparer, ok3 = dc.(driver.ConnPrepareContext)
+		if !ok1 || !ok2 || !ok3 {
+			f = nil
+			return nil
+		}
+		f.checker, _ = dc.(driver.NamedValueChecker)
+		return nil
+	})
+	return f
+}
+
+// prepare prepares the query on the driver connection.
+func (f *fastConn) prepare(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := f.preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	_, ok1 := s.(driver.StmtExecContext)
+	_, ok2 := s.(driver.StmtQueryContext)
+	if !ok1 || !ok2 {
+		s.Close()
+		return nil, fmt.Errorf("fast-path: driver statement does not implement StmtExecContext and StmtQueryContext")
+	}
+	return s, nil
+}
+
+// close closes the driver statements. It must be called before closing the
+// connection.
+func (f *fastConn) close() {
+	for i, s := range f.ps {
+		if s == nil {
+			continue
+		}
+		s.Close()
+		for j := i; j < len(f.ps); j++ { // prepare multi
+			if f.ps[j] == s {
+				f.ps[j] = nil
+			}
+		}
+	}
+}
+
+// named returns values as driver values, like database/sql does. The slice is
+// reused, so it's only valid until the next call.
+func (f *fastConn) named(values []interface{}) ([]driver.NamedValue, error) {
+	f.args = f.args[:0]
+	for i, v := range values {
+		nv := driver.NamedValue{Ordinal: i + 1, Value: v}
+		if !driver.IsValue(v) {
+			var err error
+			if f.checker != nil {
+				err = f.checker.CheckNamedValue(&nv)
+			} else {
+				nv.Value, err = driver.DefaultParameterConverter.ConvertValue(v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("converting argument $%d type: %s", i+1, err)
+			}
+		}
+		f.args = append(f.args, nv)
+	}
+	return f.args, nil
+}
+
+// fastQuery executes statement i with a result set on the fast path. If the
+// driver can't execute the query without preparing it (driver.ErrSkip), like
+// go-sql-driver/mysql with args and without interpolateParams, it falls back
+// to database/sql.
+func (c *Client) fastQuery(ctx context.Context, i int) (resultRows, error) {
+	f := c.fast
+	var args []driver.NamedValue
+	var dr driver.Rows
+	var err error
+	if f.ps[i] != nil {
+		if args, err = f.named(c.values[i]); err != nil {
+			return nil, err
+		}
+		dr, err = f.ps[i].(driver.StmtQueryContext).QueryContext(ctx, args)
+	} else {
+		q, values := c.unprepared(i)
+		if args, err = f.named(values); err != nil {
+			return nil, err
+		}
+		dr, err = f.queryer.QueryContext(ctx, q, args)
+		if err == driver.ErrSkip {
+			return c.conn.QueryContext(ctx, q, values...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.rows.reset(dr)
+	return &f.rows, nil
+}
+
+// fastExec executes statement i without a result set on the fast path, with the
+// same fallback as fastQuery.
+func (c *Client) fastExec(ctx context.Context, i int) (sql.Result, error) {
+	f := c.fast
+	if f.ps[i] != nil {
+		args, err := f.named(c.values[i])
+		if err != nil {
+			return nil, err
+		}
+		return f.ps[i].(driver.StmtExecContext).ExecContext(ctx, args)
+	}
+	q, values := c.unprepared(i)
+	args, err := f.named(values)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.execer.ExecContext(ctx, q, args)
+	if err == driver.ErrSkip {
+		return c.conn.ExecContext(ctx, q, values...)
+	}
+	return res, err
+}
+
+// fastRows is driver.Rows with the resultRows methods of sql.Rows. Values are
+// scanned only into sql.Scanner, which all data generators are, so there's no
+// type conversion.
+type fastRows struct {
+	rows driver.Rows
+	dest []driver.Value
+	err  error
+}
+
+func (r *fastRows) reset(rows driver.Rows) {
+	r.rows = rows
+	r.err = nil
+	n := len(rows.Columns())
+	if cap(r.dest) < n {
+		r.dest = make([]driver.Value, n)
+	}
+	r.dest = r.dest[:n]
+}
+
+func (r *fastRows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if err := r.rows.Next(r.dest); err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return false
+	}
+	return true
+}
+
+func (r *fastRows) Scan(dest ...interface{}) error {
+	if len(dest) != len(r.dest) {
+		return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(r.dest), len(dest))
+	}
+	for i, d := range dest {
+		s, ok := d.(sql.Scanner)
+		if !ok {
+			return fmt.Errorf("fast-path: scan column %d into %T: not an sql.Scanner", i+1, d)
+		}
+		if err := s.Scan(r.dest[i]); err != nil {
+			return fmt.Errorf("sql: Scan error on column index %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *fastRows) Close() error {
+	err := r.rows.Close()
+	r.rows = nil
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
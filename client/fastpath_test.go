@@ -0,0 +1,49 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+func TestFastPath(t *testing.T) {
+	col := data.NewColumn(nil)
+	c, drv := newFakeClient(t, "finch-fast-path-test")
+	c.FastPath = true
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t WHERE id = ?", ResultSet: true, Prepare: true, Inputs: []string{"@id"}, Outputs: []string{"@c"}},
+		{Query: "UPDATE t SET c = %d WHERE id = 1", Write: true, Inputs: []string{"@c"}},
+	}
+	c.Data = []StatementData{
+		{TrxBoundary: trx.BEGIN, Inputs: []data.ValueFunc{func(data.RunCount) []interface{} { return []interface{}{uint64(7)} }}, Outputs: []interface{}{col}},
+		{TrxBoundary: trx.END, Inputs: []data.ValueFunc{col.Values}},
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	if c.fast == nil {
+		t.Fatal("fast path not used")
+	}
+
+	// Unprepared UPDATE has value printed into query, so no args, and the value
+	// is the last column value (20) scanned from the prepared SELECT
+	expect := []string{
+		"prepare SELECT c FROM t WHERE id = ?",
+		"query stmt SELECT c FROM t WHERE id = ? 1",
+		"exec UPDATE t SET c = 20 WHERE id = 1 0",
+		"close SELECT c FROM t WHERE id = ?",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"sync/atomic"
+)
+
+// Shared iteration limits (config.stage.workload.iter-clients and iter-exec-group)
+// are one counter incremented by every client. Incrementing it on every
+// iteration makes it the most contended cache line in the stage, which stops
+// iteration-limited stages from scaling past a few dozen clients. Instead,
+// each client claims a chunk of iterations from the counter and counts them
+// down locally, so the counter is incremented once per chunk.
+//
+// The tradeoff is balance at the end: a client that claimed a chunk runs all of
+// it while other clients find the counter exhausted. IterChunk sizes chunks so
+// that's a small fraction of each client's share of the iterations.
+
+// MaxIterChunk is the maximum number of iterations a client claims at once.
+const MaxIterChunk = 1000
+
+// IterChunk returns the number of iterations to claim at once from a shared
+// limit of iter iterations for n clients: about 1/16 of each client's share,
+// at least 1 and at most MaxIterChunk.
+func IterChunk(iter, n uint) uint32 {
+	if n == 0 {
+		return 1
+	}
+	chunk := iter / (n * 16)
+	if chunk < 1 {
+		return 1
+	}
+	if chunk > MaxIterChunk {
+		return MaxIterChunk
+	}
+	return uint32(chunk)
+}
+
+// nextIter returns true if the client can run iteration n+1: if it hasn't run
+// c.Iter iterations, and if it can claim an iteration from the shared limits.
+// Chunks are capped by the iterations the client has left (c.Iter - n), so
+// the client doesn't claim iterations it can't run.
+func (c *Client) nextIter(n uint) bool {
+	var left uint32 // 0 = no limit
+	if c.Iter > 0 {
+		if n >= c.Iter {
+			return false
+		}
+		left = uint32(c.Iter - n)
+	}
+	if c.IterExecGroup > 0 && !claimIter(c.IterExecGroupPtr, c.IterExecGroup, c.IterExecGroupN, left, &c.iterEG) {
+		return false
+	}
+	if c.IterClients > 0 && !claimIter(c.IterClientsPtr, c.IterClients, c.IterClientsN, left, &c.iterCG) {
+		if c.IterExecGroup > 0 {
+			c.iterEG++ // not run, so released by releaseIter
+		}
+		return false
+	}
+	return true
+}
+
+// releaseIter returns the iterations the client claimed but didn't run to the
+// shared limits when it exits (client group limit reached, error, or stop),
+// so other clients that are still running can run them.
+func (c *Client) releaseIter() {
+	if c.iterEG > 0 {
+		atomic.AddUint32(c.IterExecGroupPtr, ^(c.iterEG - 1)) // -= iterEG
+		c.iterEG = 0
+	}
+	if c.iterCG > 0 {
+		atomic.AddUint32(c.IterClientsPtr, ^(c.iterCG - 1))
+		c.iterCG = 0
+	}
+}
+
+// claimIter returns true if the client can run another iteration of the shared
+// limit max: from the iterations it claimed already (have), else from a new
+// chunk claimed from ptr. It returns false when the limit has been reached.
+// A chunk of 0 is 1 (no chunks), and a chunk is at most left iterations if
+// left > 0. ptr never exceeds max, so iterations released by releaseIter can
+// be claimed again.
+func claimIter(ptr *uint32, max, chunk, left uint32, have *uint32) bool {
+	if *have > 0 {
+		*have--
+		return true
+	}
+	if chunk == 0 {
+		chunk = 1
+	}
+	if left > 0 && chunk > left {
+		chunk = left
+	}
+	for {
+		start := atomic.LoadUint32(ptr)
+		if start >= max {
+			return false
+		}
+		n := chunk
+		if n > max-start {
+			n = max - start // last chunk is partial
+		}
+		if atomic.CompareAndSwapUint32(ptr, start, start+n) {
+			*have = n - 1 // -1 for this iteration
+			return true
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/square/finch/trx"
+)
+
+func TestClaimIter(t *testing.T) {
+	// 10 clients claim chunks of 7 from a shared limit of 1000, which isn't
+	// a multiple of 7, so the last chunk is partial: together they must run
+	// exactly 1000 iterations
+	var ptr uint32
+	var ran uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var have uint32
+			for claimIter(&ptr, 1000, 7, 0, &have) {
+				atomic.AddUint64(&ran, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if ran != 1000 {
+		t.Errorf("ran %d iterations, expected 1000", ran)
+	}
+
+	if n := IterChunk(1000, 10); n != 6 {
+		t.Errorf("IterChunk(1000, 10) = %d, expected 6", n)
+	}
+	if n := IterChunk(10, 100); n != 1 {
+		t.Errorf("IterChunk(10, 100) = %d, expected 1", n)
+	}
+	if n := IterChunk(1000000000, 1); n != MaxIterChunk {
+		t.Errorf("IterChunk(1e9, 1) = %d, expected %d", n, MaxIterChunk)
+	}
+}
+
+// runIter runs c and returns the number of iterations it ran, one statement each
+func runIter(t *testing.T, c *Client, drv *fakeDriver) int {
+	t.Helper()
+	c.Statements = []*trx.Statement{{Query: "SELECT 1", ResultSet: true}}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN | trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	return len(drv.log)
+}
+
+func TestClaimIter_ClientIter(t *testing.T) {
+	// Client 1 runs only 3 iterations (Iter < chunk of 10), so it must not claim
+	// a whole chunk of the shared limit of 20: client 2 runs the other 17
+	var ptr uint32
+	c1, drv1 := newFakeClient(t, "finch-iter-client-1-test")
+	c1.Iter = 3
+	c1.IterClients, c1.IterClientsPtr, c1.IterClientsN = 20, &ptr, 10
+	c2, drv2 := newFakeClient(t, "finch-iter-client-2-test")
+	c2.Iter = 0
+	c2.IterClients, c2.IterClientsPtr, c2.IterClientsN = 20, &ptr, 10
+
+	n1 := runIter(t, c1, drv1)
+	n2 := runIter(t, c2, drv2)
+	if n1 != 3 || n2 != 17 {
+		t.Errorf("clients ran %d and %d iterations, expected 3 and 17", n1, n2)
+	}
+	if ptr != 20 {
+		t.Errorf("shared counter = %d, expected 20", ptr)
+	}
+}
+
+func TestClaimIter_Release(t *testing.T) {
+	// Client 1 claims a chunk of 10 from the exec group limit of 20 but its
+	// client group limit is 2, so it returns the 8 it didn't run when it exits:
+	// client 2 (another client group) runs the other 18
+	var egPtr, cgPtr uint32
+	c1, drv1 := newFakeClient(t, "finch-iter-release-1-test")
+	c1.Iter = 0
+	c1.IterExecGroup, c1.IterExecGroupPtr, c1.IterExecGroupN = 20, &egPtr, 10
+	c1.IterClients, c1.IterClientsPtr, c1.IterClientsN = 2, &cgPtr, 1
+	c2, drv2 := newFakeClient(t, "finch-iter-release-2-test")
+	c2.Iter = 0
+	c2.IterExecGroup, c2.IterExecGroupPtr, c2.IterExecGroupN = 20, &egPtr, 10
+
+	n1 := runIter(t, c1, drv1)
+	n2 := runIter(t, c2, drv2)
+	if n1 != 2 || n2 != 18 {
+		t.Errorf("clients ran %d and %d iterations, expected 2 and 18", n1, n2)
+	}
+	if egPtr != 20 {
+		t.Errorf("exec group counter = %d, expected 20", egPtr)
+	}
+}
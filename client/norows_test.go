@@ -0,0 +1,140 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+// noRowsClient returns a client that selects @c by @id, which is 1, 2, 3, etc.
+// on each call, then updates by @c, then selects 1. Set NoRows and NoRowsRetry
+// on Statements[0].
+func noRowsClient(t *testing.T, name string) (*Client, *fakeDriver) {
+	id := 0
+	col := data.NewColumn(nil)
+	c, drv := newFakeClient(t, name)
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t WHERE id = %d", ResultSet: true, Inputs: []string{"@id"}, Outputs: []string{"@c"}},
+		{Query: "UPDATE t SET c = c + 1 WHERE c = %v", Write: true, Inputs: []string{"@c"}},
+		{Query: "SELECT 1", ResultSet: true},
+	}
+	c.Data = []StatementData{
+		{TrxBoundary: trx.BEGIN, Inputs: []data.ValueFunc{func(data.RunCount) []interface{} { id++; return []interface{}{id} }}, Outputs: []interface{}{col}},
+		{Inputs: []data.ValueFunc{col.Values}},
+		{TrxBoundary: trx.END},
+	}
+	return c, drv
+}
+
+func TestNoRows_Retry(t *testing.T) {
+	// No rows 3 times, but retry only 2 times with the same value (id = 1),
+	// then continue like if-no-rows: ignore: @c is nil
+	c, drv := noRowsClient(t, "finch-no-rows-retry-test")
+	c.Statements[0].NoRows = trx.NO_ROWS_RETRY
+	c.Statements[0].NoRowsRetry = 2
+	drv.rows = map[string][]int{"SELECT c FROM t WHERE id = 1": {0, 0, 0}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{
+		"query SELECT c FROM t WHERE id = 1 0",
+		"query SELECT c FROM t WHERE id = 1 0",
+		"query SELECT c FROM t WHERE id = 1 0",
+		"exec UPDATE t SET c = c + 1 WHERE c = <nil> 0",
+		"query SELECT 1 0",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNoRows_Regenerate(t *testing.T) {
+	// No rows for id 1 and 2, so the generator is called again each time,
+	// then id 3 returns rows before the 5 retries are used
+	c, drv := noRowsClient(t, "finch-no-rows-regenerate-test")
+	c.Statements[0].NoRows = trx.NO_ROWS_REGENERATE
+	c.Statements[0].NoRowsRetry = 5
+	drv.rows = map[string][]int{
+		"SELECT c FROM t WHERE id = 1": {0},
+		"SELECT c FROM t WHERE id = 2": {0},
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{
+		"query SELECT c FROM t WHERE id = 1 0",
+		"query SELECT c FROM t WHERE id = 2 0",
+		"query SELECT c FROM t WHERE id = 3 0",
+		"exec UPDATE t SET c = c + 1 WHERE c = 20 0", // last row scanned
+		"query SELECT 1 0",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNoRows_Skip(t *testing.T) {
+	// No rows on the first iteration skips the UPDATE that uses @c but not
+	// SELECT 1, and only on that iteration
+	c, drv := noRowsClient(t, "finch-no-rows-skip-test")
+	c.Iter = 2
+	c.Statements[0].NoRows = trx.NO_ROWS_SKIP
+	drv.rows = map[string][]int{"SELECT c FROM t WHERE id = 1": {0}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{
+		"query SELECT c FROM t WHERE id = 1 0",
+		"query SELECT 1 0",
+		"query SELECT c FROM t WHERE id = 2 0",
+		"exec UPDATE t SET c = c + 1 WHERE c = 20 0",
+		"query SELECT 1 0",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNoRows_Error(t *testing.T) {
+	// No rows stops the client with ErrNoRows: no other statements are executed
+	c, drv := noRowsClient(t, "finch-no-rows-error-test")
+	c.Iter = 2
+	c.Statements[0].NoRows = trx.NO_ROWS_ERROR
+	drv.rows = map[string][]int{"SELECT c FROM t WHERE id = 1": {0}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	ret := <-c.DoneChan
+	if ret.Error.Err != trx.ErrNoRows {
+		t.Errorf("got error %v, expected trx.ErrNoRows", ret.Error.Err)
+	}
+	if ret.Error.StatementNo != 0 {
+		t.Errorf("got statement %d, expected 0", ret.Error.StatementNo)
+	}
+	expect := []string{
+		"query SELECT c FROM t WHERE id = 1 0",
+		"exec ROLLBACK 0", // client exits in the trx
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"log"
+	"runtime"
+)
+
+// Pinned clients (config.stage.pin-clients) run on one OS thread pinned to one
+// CPU, so a client's state (connection buffers, data generators, stats) stays
+// in that CPU's cache instead of moving between cores as the Go scheduler moves
+// the goroutine. workload.Allocator assigns CPUs (Client.CPU) round-robin from
+// CPUs in each execution group, so the clients running at the same time are
+// spread across all CPUs. It's only useful with clients <= GOMAXPROCS; with more,
+// clients share CPUs and pinning only adds scheduling latency.
+
+func allCPUs() []int {
+	cpus := make([]int, runtime.GOMAXPROCS(0))
+	for i := range cpus {
+		cpus[i] = i
+	}
+	return cpus
+}
+
+// pin locks the client goroutine to its thread and pins the thread to c.CPU.
+// The thread is never unlocked: when Run returns, the goroutine exits locked,
+// so Go terminates the thread rather than reuse a thread pinned to one CPU.
+func (c *Client) pin() {
+	runtime.LockOSThread()
+	if err := pinCPU(c.CPU); err != nil {
+		log.Printf("Client %s: cannot pin to CPU %d: %s", c.RunLevel.ClientId(), c.CPU, err)
+	}
+}
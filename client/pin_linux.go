@@ -0,0 +1,47 @@
+// Copyright 2024 Block, Inc.
+
+//go:build linux
+
+package client
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// cpuSet is a Linux cpu_set_t for up to 1024 CPUs.
+type cpuSet [1024 / 64]uint64
+
+// CPUs returns the CPUs that this process can run on (its affinity, like with
+// taskset), at most GOMAXPROCS because that's how many clients can run at once.
+func CPUs() []int {
+	var set cpuSet
+	_, _, e := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set)))
+	if e != 0 {
+		return allCPUs()
+	}
+	max := runtime.GOMAXPROCS(0)
+	cpus := []int{}
+	for i := 0; i < len(set)*64 && len(cpus) < max; i++ {
+		if set[i/64]&(1<<(i%64)) != 0 {
+			cpus = append(cpus, i)
+		}
+	}
+	if len(cpus) == 0 {
+		return allCPUs()
+	}
+	return cpus
+}
+
+// pinCPU sets the affinity of the calling thread to cpu. The caller must lock
+// the goroutine to the thread (runtime.LockOSThread).
+func pinCPU(cpu int) error {
+	var set cpuSet
+	set[cpu/64] |= 1 << (cpu % 64)
+	_, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(set), uintptr(unsafe.Pointer(&set)))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
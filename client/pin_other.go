@@ -0,0 +1,15 @@
+// Copyright 2024 Block, Inc.
+
+//go:build !linux
+
+package client
+
+// CPUs returns 0..GOMAXPROCS-1 because CPU affinity is only supported on Linux.
+func CPUs() []int {
+	return allCPUs()
+}
+
+// pinCPU is a no-op: clients are locked to a thread but not pinned to a CPU.
+func pinCPU(cpu int) error {
+	return nil
+}
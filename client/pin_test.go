@@ -0,0 +1,26 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	cpus := CPUs()
+	if len(cpus) == 0 || len(cpus) > runtime.GOMAXPROCS(0) {
+		t.Fatalf("got %d CPUs, expected 1 to GOMAXPROCS (%d): %v", len(cpus), runtime.GOMAXPROCS(0), cpus)
+	}
+
+	// Pin in a goroutine that exits locked, like Client.Run, so the pinned
+	// thread is terminated, not reused by the test
+	errChan := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		errChan <- pinCPU(cpus[len(cpus)-1])
+	}()
+	if err := <-errChan; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	myerr "github.com/go-mysql/errors"
+
+	"github.com/square/finch"
+	"github.com/square/finch/data"
+	"github.com/square/finch/stats"
+	"github.com/square/finch/trx"
+)
+
+// A pipelined client (config.stage.workload.pipeline) keeps up to Pipeline
+// statements in flight, each on its own connection (a lane), instead of waiting
+// for each statement to complete before executing the next. This models async
+// application drivers and benchmarks the server under pipelined load rather
+// than strict request-response. The client generates values and dispatches
+// statements in order, but any free lane executes the next statement, so they
+// complete out of order. The client records stats as statements complete, so
+// Stats are still written by one goroutine.
+//
+// Since statements complete out of order on different connections, they must
+// be independent: checkPipeline rejects explicit transactions, saved columns
+// and insert IDs, row limits, CAS, repeat blocks, and trx weights. Errors are
+// counted and logged, and the lane reconnects, but the client keeps running:
+// workload error handling (mysql.flavor and ErrorHandling) doesn't apply.
+
+// pipeJob is one statement dispatched to a lane.
+type pipeJob struct {
+	i     int           // Statements index
+	trxNo int           // Stats index
+	query string        // unprepared query, or empty if prepared
+	args  []interface{} // copy of values
+}
+
+// pipeResult is a pipeJob completed by a lane.
+type pipeResult struct {
+	pipeJob
+	d    int64 // response time (Clock)
+	rows int64 // rows affected or returned
+	err  error
+}
+
+// lane is one connection of a pipelined client.
+type lane struct {
+	c    *Client
+	conn *sql.Conn
+	ps   []*sql.Stmt
+}
+
+// checkPipeline returns an error if a statement can't be pipelined because it
+// depends on the result or connection of another statement.
+func (c *Client) checkPipeline() error {
+	if len(c.TrxWeights) > 0 {
+		return fmt.Errorf("pipeline: trx weights (workload.weights) are not supported")
+	}
+	for _, s := range c.Statements {
+		var why string
+		switch {
+		case s.Begin || s.Commit:
+			why = "explicit transaction (BEGIN or COMMIT)"
+		case len(s.Outputs) > 0 || s.InsertId != "":
+			why = "saved columns or insert ID"
+		case s.Limit != nil:
+			why = "row limit"
+		case s.CAS > 0:
+			why = "-- cas"
+		case s.Repeat > 0:
+			why = "-- repeat"
+		}
+		if why != "" {
+			return fmt.Errorf("pipeline: %s line %d: statements with %s cannot be pipelined; pipelined statements must be independent", s.File, s.Line, why)
+		}
+	}
+	return nil
+}
+
+// runPipeline is Run for a pipelined client. It returns when the client has
+// finished its iterations or ctx is done, after all statements in flight
+// complete.
+func (c *Client) runPipeline(ctx context.Context) error {
+	lanes := make([]*lane, c.Pipeline)
+	for k := range lanes {
+		lanes[k] = &lane{c: c, ps: make([]*sql.Stmt, len(c.Statements))}
+		if err := lanes[k].connect(ctx); err != nil {
+			for _, l := range lanes[:k] {
+				l.close()
+			}
+			return err
+		}
+	}
+	c.status.connected.Store(true)
+	finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_CONNECTED, RunLevel: c.RunLevel})
+
+	jobs := make(chan pipeJob)
+	done := make(chan pipeResult, len(lanes)) // lanes never block
+	var wg sync.WaitGroup
+	for _, l := range lanes {
+		wg.Add(1)
+		go func(l *lane) {
+			defer wg.Done()
+			l.run(ctx, jobs, done)
+		}(l)
+	}
+
+	var rc data.RunCount
+	rc[data.CONN] = 1
+	rc[data.CLIENT] = c.RunLevel.Client
+	rc[data.CLIENT_GROUP] = c.RunLevel.ClientGroup
+	rc[data.EXEC_GROUP] = c.RunLevel.ExecGroup
+	rc[data.STAGE] = c.RunLevel.Stage
+
+	// Send job to the next free lane, recording results while waiting
+	inFlight := 0
+	send := func(job pipeJob) bool {
+		for {
+			select {
+			case jobs <- job:
+				inFlight++
+				return true
+			case r := <-done:
+				inFlight--
+				c.pipeDone(ctx, r)
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+ITER:
+	for !finch.Stopped(ctx) && ctx.Err() == nil {
+		if (c.Share != nil && !c.Share.Active(c.RunLevel.Client-1)) || (c.Pause != nil && c.Pause.Paused()) {
+			// Client runs on another compute instance now (elastic stage), or
+			// stage paused: idle like Run
+			select {
+			case <-time.After(100 * time.Millisecond):
+				continue ITER
+			case <-ctx.Done():
+				break ITER
+			}
+		}
+		if !c.nextIter(rc[data.ITER]) {
+			break
+		}
+		rc[data.ITER] += 1
+		c.status.iter.Store(uint64(rc[data.ITER]))
+		finch.IterEvent(c.RunLevel, rc[data.ITER])
+		if c.Counters != nil {
+			atomic.AddUint64(&c.Counters.Iter, 1)
+		}
+		if c.Progress != nil {
+			atomic.AddUint64(c.Progress, 1)
+		}
+
+		trxNo := -1
+		for i := range c.Statements {
+			if c.Data[i].TrxBoundary&trx.BEGIN != 0 {
+				rc[data.TRX] += 1
+				trxNo += 1
+			}
+			if c.Statements[i].Idle != 0 {
+				time.Sleep(c.Statements[i].Idle)
+				continue
+			}
+			if c.Statements[i].Probability > 0 && c.rand.Float64() >= c.Statements[i].Probability {
+				continue
+			}
+			if c.QPS != nil {
+				<-c.QPS
+			}
+
+			rc[data.STATEMENT] += 1
+			c.status.stmt.Store(int32(i + 1))
+			d := 0
+			for _, f := range c.Data[i].Inputs {
+				d += copy(c.values[i][d:], f(rc))
+			}
+
+			// Values are reused for the next statement, so the job has a copy
+			job := pipeJob{i: i, trxNo: trxNo}
+			if c.Statements[i].Prepare && !c.ClientPrepare {
+				job.args = append([]interface{}(nil), c.values[i]...)
+			} else {
+				q, args := c.unprepared(i)
+				job.query = q
+				job.args = append([]interface{}(nil), args...)
+			}
+			if !send(job) {
+				break ITER
+			}
+		}
+	}
+
+	for ; inFlight > 0; inFlight-- {
+		c.pipeDone(ctx, <-done)
+	}
+	close(jobs)
+	wg.Wait()
+	for _, l := range lanes {
+		l.close()
+	}
+	return ctx.Err()
+}
+
+// pipeDone records the result of a pipelined statement.
+func (c *Client) pipeDone(ctx context.Context, r pipeResult) {
+	s := c.Statements[r.i]
+	if r.err != nil {
+		if ctx.Err() != nil {
+			return // runtime elapsed or CTRL-C, not an error
+		}
+		if c.Stats[r.trxNo] != nil {
+			c.Stats[r.trxNo].Error(myerr.MySQLErrorCode(r.err))
+		}
+		if c.Counters != nil {
+			atomic.AddUint64(&c.Counters.Errors, 1)
+		}
+		c.status.errors.Add(1)
+		errMsg := r.err.Error()
+		c.status.lastErr.Store(&errMsg)
+		finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_ERROR, RunLevel: c.RunLevel, Iter: uint(c.status.iter.Load()), Error: r.err})
+		finch.LogClientError(c.RunLevel.ClientId(), myerr.MySQLErrorCode(r.err), r.err, s.Query, statementLine(s), r.args)
+		return
+	}
+	if c.Stats[r.trxNo] != nil {
+		switch {
+		case s.Write:
+			c.Stats[r.trxNo].Record(stats.WRITE, r.d)
+		case s.ResultSet:
+			c.Stats[r.trxNo].Record(stats.READ, r.d)
+		default:
+			c.Stats[r.trxNo].Record(stats.TOTAL, r.d)
+		}
+	}
+	if c.Counters != nil && s.Write { // stage.exit.rows
+		atomic.AddUint64(&c.Counters.Rows, uint64(r.rows))
+	}
+}
+
+// run executes jobs until the channel is closed. After an error, the lane
+// reconnects before its next job.
+func (l *lane) run(ctx context.Context, jobs <-chan pipeJob, done chan<- pipeResult) {
+	for job := range jobs {
+		r := pipeResult{pipeJob: job}
+		if l.conn == nil {
+			time.Sleep(ConnectRetryWait)
+			if r.err = l.connect(ctx); r.err == nil {
+				finch.SendEvent(finch.Event{Type: finch.EVENT_CLIENT_RECONNECTED, RunLevel: l.c.RunLevel})
+			}
+		}
+		if r.err == nil {
+			t := l.c.Clock()
+			r.rows, r.err = l.exec(ctx, job)
+			r.d = l.c.Clock() - t
+		}
+		if r.err != nil {
+			l.close()
+		}
+		done <- r
+	}
+}
+
+func (l *lane) exec(ctx context.Context, job pipeJob) (int64, error) {
+	ps := l.ps[job.i]
+	if l.c.Statements[job.i].ResultSet {
+		var rows *sql.Rows
+		var err error
+		if ps != nil {
+			rows, err = ps.QueryContext(ctx, job.args...)
+		} else {
+			rows, err = l.conn.QueryContext(ctx, job.query, job.args...)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n := int64(0)
+		for rows.Next() {
+			n++
+		}
+		rows.Close()
+		return n, rows.Err()
+	}
+	var res sql.Result
+	var err error
+	if ps != nil {
+		res, err = ps.ExecContext(ctx, job.args...)
+	} else {
+		res, err = l.conn.ExecContext(ctx, job.query, job.args...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// connect connects the lane like Client.Connect: default database, then prepare
+// statements, but each statement is prepared separately (not PrepareMulti).
+func (l *lane) connect(ctx context.Context) error {
+	c := l.c
+	ctxConn, cancel := context.WithTimeout(ctx, ConnectTimeout)
+	conn, err := c.DB.Conn(ctxConn)
+	cancel()
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	if c.DefaultDb != "" {
+		if _, err := l.conn.ExecContext(ctx, "USE `"+c.DefaultDb+"`"); err != nil {
+			l.close()
+			return err
+		}
+	}
+	for i, s := range c.Statements {
+		if !s.Prepare || c.ClientPrepare {
+			continue
+		}
+		if l.ps[i], err = l.conn.PrepareContext(ctx, c.queries[i]); err != nil {
+			l.close()
+			return fmt.Errorf("prepare: %s", err)
+		}
+	}
+	return nil
+}
+
+func (l *lane) close() {
+	for i := range l.ps {
+		if l.ps[i] != nil {
+			l.ps[i].Close()
+			l.ps[i] = nil
+		}
+	}
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
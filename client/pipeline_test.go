@@ -0,0 +1,86 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/stats"
+	"github.com/square/finch/trx"
+)
+
+func TestPipeline(t *testing.T) {
+	trxStats := stats.NewTrx("t")
+	counters := &Counters{}
+	c, drv := newFakeClient(t, "finch-pipeline-test")
+	c.Iter = 10
+	c.Pipeline = 3
+	c.Counters = counters
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t WHERE id = ?", ResultSet: true, Prepare: true, Inputs: []string{"@id"}},
+		{Query: "UPDATE t SET c = %d WHERE id = 1", Write: true, Inputs: []string{"@c"}},
+	}
+	c.Data = []StatementData{
+		{TrxBoundary: trx.BEGIN, Inputs: []data.ValueFunc{func(data.RunCount) []interface{} { return []interface{}{uint64(7)} }}},
+		{TrxBoundary: trx.END, Inputs: []data.ValueFunc{func(data.RunCount) []interface{} { return []interface{}{uint64(8)} }}},
+	}
+	c.Stats = []*stats.Trx{trxStats}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+
+	// 3 lanes (connections) prepare the SELECT, then 10 iterations execute each
+	// statement once on any lane
+	n := map[string]int{}
+	for _, l := range drv.log {
+		n[l]++
+	}
+	expect := map[string]int{
+		"prepare SELECT c FROM t WHERE id = ?":      3,
+		"query stmt SELECT c FROM t WHERE id = ? 1": 10,
+		"exec UPDATE t SET c = 8 WHERE id = 1 0":    10,
+		"close SELECT c FROM t WHERE id = ?":        3,
+	}
+	if diff := deep.Equal(n, expect); diff != nil {
+		t.Error(diff)
+	}
+	s := trxStats.Swap()
+	if s.N[stats.READ] != 10 || s.N[stats.WRITE] != 10 {
+		t.Errorf("got %d reads and %d writes, expected 10 and 10", s.N[stats.READ], s.N[stats.WRITE])
+	}
+	if counters.Iter != 10 || counters.Rows != 10 {
+		t.Errorf("got %d iter and %d rows, expected 10 and 10", counters.Iter, counters.Rows)
+	}
+
+	// Client runs on another compute instance (elastic stage): it idles,
+	// doesn't execute, until the runtime elapses
+	drv.log = drv.log[:0]
+	c.Share = &Share{}
+	c.Share.Set(1, 2) // instance 2 of 2 runs client 2, not client 1
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	c.Run(ctx)
+	cancel()
+	<-c.DoneChan
+	for _, l := range drv.log {
+		if strings.HasPrefix(l, "query") || strings.HasPrefix(l, "exec") {
+			t.Errorf("inactive client executed %s, expected it to idle", l)
+		}
+	}
+	c.Share = nil
+
+	// Statements that depend on another statement can't be pipelined
+	c.Statements[0].Outputs = []string{"@c"}
+	if err := c.Init(); err == nil {
+		t.Error("no error for pipelined statement with saved columns, expected an error")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+)
+
+// Statements (-- prepare) are prepared on connect, but on reconnect they're
+// prepared lazily on first use. When many clients drop at once, like on
+// failover, every client reconnects at about the same time, and re-preparing
+// every statement on every connection amplifies the reconnect storm. Lazily,
+// each client prepares only the statements it executes, and spreads them over
+// its first iteration. A client with trx weights or -- probability might not
+// execute some statements for a while, or at all.
+//
+// Prepared statements are per connection (MySQL session), so they can't be
+// reused on a new connection. But they're kept, not re-prepared, when the
+// connection is kept: errors handled with finch.Econtinue (mysql.flavor and
+// ErrorHandling) don't reconnect.
+
+// initPrepare sets psFirst. Init calls it.
+func (c *Client) initPrepare() {
+	c.psFirst = make([]int, len(c.Statements))
+	for i := 0; i < len(c.Statements); i++ {
+		c.psFirst[i] = i
+		n := c.Statements[i].PrepareMulti
+		for j := 1; j < n && i+j < len(c.Statements); j++ {
+			c.psFirst[i+j] = i
+		}
+		if n > 1 {
+			i += n - 1
+		}
+	}
+}
+
+// needPrepare returns true if statement i is prepared (-- prepare) but isn't
+// prepared on the current connection yet.
+func (c *Client) needPrepare(i int) bool {
+	if !c.Statements[i].Prepare || c.ClientPrepare {
+		return false
+	}
+	if c.fast != nil {
+		return c.fast.ps[i] == nil
+	}
+	return c.ps[i] == nil
+}
+
+// prepare prepares statement i on the current connection. If it's one of the
+// -- copies of a prepared statement (PrepareMulti), the first copy is prepared
+// for all copies. The error is not wrapped, so
+// the caller can check the MySQL error code.
+func (c *Client) prepare(ctx context.Context, i int) error {
+	k := c.psFirst[i]
+	n := c.Statements[k].PrepareMulti
+	if n < 1 {
+		n = 1
+	}
+	if c.fast != nil {
+		s, err := c.fast.prepare(ctx, c.queries[k])
+		if err != nil {
+			c.Error.StatementNo = k
+			return err
+		}
+		for j := k; j < k+n; j++ {
+			c.fast.ps[j] = s
+		}
+		return nil
+	}
+	ps, err := c.conn.PrepareContext(ctx, c.queries[k])
+	if err != nil {
+		c.Error.StatementNo = k
+		return err
+	}
+	for j := k; j < k+n; j++ {
+		c.ps[j] = ps
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/trx"
+)
+
+func TestPrepareOnReconnect(t *testing.T) {
+	c, drv := newFakeClient(t, "finch-prepare-test")
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t", ResultSet: true, Prepare: true},
+		{Query: "UPDATE t SET c = 1", Write: true, Prepare: true, Probability: 0.000000001}, // never
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN}, {TrxBoundary: trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// First connect prepares all statements
+	if err := c.Connect(context.Background(), nil, -1, false); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"prepare SELECT c FROM t",
+		"prepare UPDATE t SET c = 1",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Reconnect (Run connects again) closes them but prepares only the SELECT
+	// on first use; the UPDATE isn't executed, so it's not prepared
+	ConnectRetryWait = 0
+	defer func() { ConnectRetryWait = 200 * time.Millisecond }()
+	drv.log = drv.log[:0]
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect = []string{
+		"close SELECT c FROM t",
+		"close UPDATE t SET c = 1",
+		"prepare SELECT c FROM t",
+		"query stmt SELECT c FROM t 0",
+		"close SELECT c FROM t",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
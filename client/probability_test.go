@@ -0,0 +1,45 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/square/finch/trx"
+)
+
+func TestProbability(t *testing.T) {
+	// -- probability: 0.3 executes on about 30% of 1,000 iterations. 0 (not
+	// set) and 1 execute on every iteration.
+	c, drv := newFakeClient(t, "finch-probability-test")
+	c.Iter = 1000
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT 1", ResultSet: true},
+		{Query: "SELECT 2", ResultSet: true, Probability: 0.3},
+		{Query: "SELECT 3", ResultSet: true, Probability: 1},
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN}, {}, {TrxBoundary: trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.rand = rand.New(rand.NewSource(1)) // deterministic
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	n := map[string]int{}
+	for _, l := range drv.log {
+		n[l]++
+	}
+	if n["query SELECT 1 0"] != 1000 {
+		t.Errorf("probability 0 executed %d times, expected 1000", n["query SELECT 1 0"])
+	}
+	if got := n["query SELECT 2 0"]; got < 250 || got > 350 {
+		t.Errorf("probability 0.3 executed %d times, expected about 300", got)
+	}
+	if n["query SELECT 3 0"] != 1000 {
+		t.Errorf("probability 1 executed %d times, expected 1000", n["query SELECT 3 0"])
+	}
+}
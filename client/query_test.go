@@ -0,0 +1,234 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch"
+	"github.com/square/finch/trx"
+)
+
+func TestQuery(t *testing.T) {
+	c := &Client{
+		RunLevel: finch.RunLevel{
+			StageName:     "read only",
+			ExecGroupName: "dml1",
+			ClientGroup:   1,
+			Client:        2,
+		},
+		QueryComment: true,
+		QueryHint:    "MAX_EXECUTION_TIME(1000)",
+	}
+
+	got := c.query(&trx.Statement{Trx: "read.sql", Query: "SELECT c FROM t WHERE id=%d"})
+	expect := "/* finch stage=read_only exec-group=dml1 client-group=1 client=2 trx=read.sql */ SELECT /*+ MAX_EXECUTION_TIME(1000) */ c FROM t WHERE id=%d"
+	if got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	// No hint for statements that don't support hints
+	got = c.query(&trx.Statement{Trx: "read.sql", Query: "BEGIN", Prepare: true})
+	expect = "/* finch stage=read_only exec-group=dml1 client-group=1 client=2 trx=read.sql */ BEGIN"
+	if got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	// Run ID first in comment
+	c.RunId = "cq1k2"
+	got = c.query(&trx.Statement{Trx: "read.sql", Query: "BEGIN", Prepare: true})
+	expect = "/* finch run=cq1k2 stage=read_only exec-group=dml1 client-group=1 client=2 trx=read.sql */ BEGIN"
+	if got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	// Neither set = original query
+	c = &Client{}
+	if got = c.query(&trx.Statement{Query: "SELECT 1"}); got != "SELECT 1" {
+		t.Errorf("got %s, expected SELECT 1", got)
+	}
+}
+
+func TestInit_TrxWeights(t *testing.T) {
+	// Two trx: a.sql has 2 statements, b.sql has 1
+	c := &Client{
+		Statements: []*trx.Statement{
+			{Trx: "a.sql", Query: "SELECT 1"},
+			{Trx: "a.sql", Query: "SELECT 2"},
+			{Trx: "b.sql", Query: "SELECT 3"},
+		},
+		Data: []StatementData{
+			{TrxBoundary: trx.BEGIN},
+			{TrxBoundary: trx.END},
+			{TrxBoundary: trx.BEGIN | trx.END},
+		},
+		TrxWeights: []uint{95, 5},
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(c.trxStmt, []int{0, 2, 3}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(c.weights, []uint{95, 100}); diff != nil {
+		t.Error(diff)
+	}
+
+	c.TrxWeights = []uint{1}
+	if err := c.Init(); err == nil {
+		t.Error("1 weight for 2 trx: no error, expected one")
+	}
+}
+
+func TestShare(t *testing.T) {
+	s := &Share{}
+	if s.Active(0) {
+		t.Error("client 0 active before share set, expected inactive")
+	}
+
+	// Instance 2 of 3 (0-indexed 1) runs clients 1, 4, 7, ...
+	s.Set(1, 3)
+	if i, n := s.Get(); i != 1 || n != 3 {
+		t.Errorf("got share %d/%d, expected 1/3", i, n)
+	}
+	active := []uint{}
+	for k := uint(0); k < 8; k++ {
+		if s.Active(k) {
+			active = append(active, k)
+		}
+	}
+	if diff := deep.Equal(active, []uint{1, 4, 7}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Rebalanced: instance 1 of 1 runs all clients
+	s.Set(0, 1)
+	for k := uint(0); k < 8; k++ {
+		if !s.Active(k) {
+			t.Errorf("client %d inactive, expected all active", k)
+		}
+	}
+}
+
+func TestPreconnect(t *testing.T) {
+	c, drv := newFakeClient(t, "finch-preconnect-test")
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT c FROM t", ResultSet: true, Prepare: true},
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN | trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Preconnect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(drv.log, []string{"prepare SELECT c FROM t"}); diff != nil {
+		t.Errorf("before Run: %v", diff)
+	}
+
+	// Run uses the preconnected connection and statement: no second prepare
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := []string{
+		"prepare SELECT c FROM t",
+		"query stmt SELECT c FROM t 0",
+		"close SELECT c FROM t",
+	}
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	c := &Client{
+		Statements: []*trx.Statement{
+			{Query: "SELECT 1", File: "/tmp/trx/read.sql", Line: 1},
+			{Query: "INSERT INTO t VALUES (?, ?)", File: "/tmp/trx/write.sql", Line: 3},
+		},
+		Error: Error{
+			StatementNo: 1,
+			Values:      finch.ErrorValues([]interface{}{1, []byte("abc")}, finch.MAX_ERROR_VALUE),
+		},
+	}
+	expect := "(INSERT INTO t VALUES (?, ?)) at write.sql:3 values: [1, abc]"
+	if got := c.ErrorContext(); got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+
+	c.Error = Error{StatementNo: 0}
+	expect = "(SELECT 1) at read.sql:1"
+	if got := c.ErrorContext(); got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	events := make(chan finch.Event, 10)
+	finch.SetEvents(events, 2)
+	defer finch.SetEvents(nil, 0)
+
+	c, _ := newFakeClient(t, "finch-events-test")
+	c.Iter = 4
+	c.Statements = []*trx.Statement{{Query: "SELECT c FROM t", ResultSet: true}}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN | trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	<-c.DoneChan
+	close(events)
+
+	got := []string{}
+	for e := range events {
+		got = append(got, fmt.Sprintf("%s %d", e.Type, e.Iter))
+	}
+	expect := []string{
+		finch.EVENT_CLIENT_CONNECTED + " 0",
+		finch.EVENT_CLIENT_ITER + " 2",
+		finch.EVENT_CLIENT_ITER + " 4",
+		finch.EVENT_CLIENT_DONE + " 4",
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestStop(t *testing.T) {
+	// Graceful stop: client finishes the current iteration (SELECT and COMMIT),
+	// then returns without error
+	c, drv := newFakeClient(t, "finch-stop-test")
+	c.Iter = 0
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT 1", ResultSet: true},
+		{Query: "COMMIT", Commit: true},
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN}, {TrxBoundary: trx.END}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, done := finch.WithStop(context.Background())
+	defer done()
+	go c.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+	finch.Stop()
+	select {
+	case ret := <-c.DoneChan:
+		if ret.Error.Err != nil {
+			t.Error(ret.Error.Err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not stop")
+	}
+	fakeMux.Lock()
+	defer fakeMux.Unlock()
+	if n := len(drv.log); n == 0 || n%2 != 0 || drv.log[n-1] != "exec COMMIT 0" {
+		t.Errorf("got %d queries, expected whole iterations ending with COMMIT: %v", n, drv.log)
+	}
+}
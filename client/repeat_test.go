@@ -0,0 +1,82 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/trx"
+)
+
+// repeatClient returns a client with repeat block SELECT 1, SELECT 2 executed
+// 3 times (-- repeat: 3) between SELECT 0 and SELECT 3.
+func repeatClient(t *testing.T, name string) (*Client, *fakeDriver) {
+	c, drv := newFakeClient(t, name)
+	c.Statements = []*trx.Statement{
+		{Query: "SELECT 0", ResultSet: true},
+		{Query: "SELECT 1", ResultSet: true},
+		{Query: "SELECT 2", ResultSet: true, Repeat: 3, RepeatFrom: 1},
+		{Query: "SELECT 3", ResultSet: true},
+	}
+	c.Data = []StatementData{{TrxBoundary: trx.BEGIN}, {}, {}, {TrxBoundary: trx.END}}
+	return c, drv
+}
+
+// repeatLog is the log of one iteration of repeatClient.
+var repeatLog = []string{
+	"query SELECT 0 0",
+	"query SELECT 1 0",
+	"query SELECT 2 0",
+	"query SELECT 1 0",
+	"query SELECT 2 0",
+	"query SELECT 1 0",
+	"query SELECT 2 0",
+	"query SELECT 3 0",
+}
+
+func TestRepeat(t *testing.T) {
+	c, drv := repeatClient(t, "finch-repeat-test")
+	c.Iter = 2
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := append(append([]string{}, repeatLog...), repeatLog...)
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRepeat_ResetOnError(t *testing.T) {
+	// Error on the second pass exits the block and the iteration. The next
+	// iteration executes the block 3 times, not the 2 passes that were left.
+	ConnectRetryWait = 0
+	defer func() { ConnectRetryWait = 200 * time.Millisecond }()
+	c, drv := repeatClient(t, "finch-repeat-error-test")
+	c.Iter = 2
+	drv.rows = map[string][]int{"SELECT 2": {2, -1}}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+	if ret := <-c.DoneChan; ret.Error.Err != nil {
+		t.Fatal(ret.Error.Err)
+	}
+	expect := append([]string{
+		"query SELECT 0 0",
+		"query SELECT 1 0",
+		"query SELECT 2 0",
+		"query SELECT 1 0",
+		"query SELECT 2 0", // error
+	}, repeatLog...)
+	if diff := deep.Equal(drv.log, expect); diff != nil {
+		t.Error(diff)
+	}
+}
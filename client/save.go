@@ -0,0 +1,58 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"fmt"
+	"log"
+
+	human "github.com/dustin/go-humanize"
+
+	"github.com/square/finch/data"
+)
+
+// Saved columns (-- save-columns) are scanned from every row of a SELECT, so an
+// accidentally unbounded SELECT (like a missing WHERE) scans the whole table
+// and, for large values, saves a lot of memory in every client. Limits are set
+// by config.stage.save-limits: SaveMaxRows stops scanning a result set after
+// that many rows (the rest are discarded), and SaveMaxMemory bounds the total
+// size of saved values per client.
+
+// ErrSaveMemory is returned when saved columns exceed SaveMaxMemory.
+var ErrSaveMemory = fmt.Errorf("saved columns exceed save-limits.max-memory")
+
+// truncated logs once per statement that its result set was truncated at
+// SaveMaxRows.
+func (c *Client) truncated(i int) {
+	if c.trunc[i] {
+		return
+	}
+	c.trunc[i] = true
+	log.Printf("Client %s: %s line %d: result set truncated at save-limits.max-rows=%d; saved columns are from the last row scanned",
+		c.RunLevel.ClientId(), c.Statements[i].File, c.Statements[i].Line, c.SaveMaxRows)
+}
+
+// saveMemory updates the size of columns saved by statement i and returns
+// ErrSaveMemory if the total exceeds SaveMaxMemory. In that case, the columns
+// are freed (nil) so the memory can be reclaimed.
+func (c *Client) saveMemory(i int) error {
+	n := 0
+	for _, o := range c.Data[i].Outputs {
+		if z, ok := o.(data.Sizer); ok {
+			n += z.Size()
+		}
+	}
+	c.savedMem += n - c.saved[i]
+	c.saved[i] = n
+	if uint64(c.savedMem) <= c.SaveMaxMemory {
+		return nil
+	}
+	for _, o := range c.Data[i].Outputs {
+		if z, ok := o.(data.Sizer); ok {
+			z.Free()
+		}
+	}
+	c.savedMem -= n
+	c.saved[i] = 0
+	return fmt.Errorf("%w: %s > %s", ErrSaveMemory, human.IBytes(uint64(c.savedMem+n)), human.IBytes(c.SaveMaxMemory))
+}
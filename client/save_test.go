@@ -0,0 +1,47 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+func TestSaveMemory(t *testing.T) {
+	col1 := data.NewColumn(nil)
+	col2 := data.NewColumn(nil)
+	c := &Client{
+		Statements:    []*trx.Statement{{Query: "SELECT a FROM t"}, {Query: "SELECT b FROM t"}},
+		Data:          []StatementData{{Outputs: []interface{}{col1}}, {Outputs: []interface{}{col2}}},
+		SaveMaxMemory: 100,
+		saved:         make([]int, 2),
+		trunc:         make([]bool, 2),
+	}
+
+	col1.Scan(make([]byte, 60))
+	if err := c.saveMemory(0); err != nil {
+		t.Fatalf("got error %v, expected nil (60 < 100)", err)
+	}
+
+	// Same statement again replaces its saved value, doesn't add to it
+	col1.Scan(make([]byte, 50))
+	if err := c.saveMemory(0); err != nil {
+		t.Fatalf("got error %v, expected nil (rescan of statement 0)", err)
+	}
+
+	// Second statement puts the client over the limit, so its value is freed
+	col2.Scan(make([]byte, 50))
+	err := c.saveMemory(1)
+	if !errors.Is(err, ErrSaveMemory) {
+		t.Fatalf("got error %v, expected ErrSaveMemory", err)
+	}
+	if v := col2.Values(data.RunCount{}); v[0] != nil {
+		t.Errorf("statement 1 column = %v, expected nil (freed)", v[0])
+	}
+	if c.savedMem != c.saved[0] || c.saved[1] != 0 {
+		t.Errorf("savedMem = %d, saved = %v, expected only statement 0", c.savedMem, c.saved)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+// Step is the result of executing one statement with Client.Step.
+type Step struct {
+	Statement    int           // index into Client.Statements
+	Next         int           // next statement to execute (see Client.next)
+	Query        string        // query executed: with values unless prepared
+	Values       []interface{} // generated input values, if any
+	Duration     time.Duration // response time (or idle time)
+	Columns      []string      // result set columns, if any
+	Rows         [][]string    // result set rows, up to maxRows
+	NRows        int           // total rows in result set
+	RowsAffected int64
+	InsertId     int64
+	Err          error
+}
+
+// Step executes statement i once and returns the result. It's used by finch
+// console to debug trx files one statement at a time, so unlike Run, it doesn't
+// record stats or apply rate limits, data limits, probability, retries, or error
+// handling. Outputs (save-columns and save-insert-id) are saved as usual, so the
+// next statements use them. rc is updated like Run. Call Connect first and
+// Close when done.
+func (c *Client) Step(ctx context.Context, i int, rc *data.RunCount, maxRows int) Step {
+	st := Step{Statement: i}
+	defer func() { st.Next = c.next(i) }()
+	if c.Data[i].TrxBoundary&trx.BEGIN != 0 {
+		rc[data.TRX] += 1
+	}
+	if c.Statements[i].Idle != 0 {
+		time.Sleep(c.Statements[i].Idle)
+		st.Duration = c.Statements[i].Idle
+		return st
+	}
+
+	rc[data.STATEMENT] += 1
+	d := 0
+	for _, f := range c.Data[i].Inputs {
+		d += copy(c.values[i][d:], f(*rc))
+	}
+	if len(c.values[i]) > 0 {
+		st.Values = append([]interface{}{}, c.values[i]...)
+	}
+	var args []interface{}
+	if c.ps[i] != nil {
+		st.Query = c.queries[i]
+	} else {
+		st.Query, args = c.unprepared(i)
+	}
+
+	if c.Statements[i].ResultSet {
+		t := time.Now()
+		var rows *sql.Rows
+		if c.ps[i] != nil {
+			rows, st.Err = c.ps[i].QueryContext(ctx, c.values[i]...)
+		} else {
+			rows, st.Err = c.conn.QueryContext(ctx, st.Query, args...)
+		}
+		if st.Err != nil {
+			st.Duration = time.Since(t)
+			return st
+		}
+		defer rows.Close()
+		st.Columns, _ = rows.Columns()
+		vals := make([]interface{}, len(st.Columns))
+		ptrs := make([]interface{}, len(st.Columns))
+		for j := range vals {
+			ptrs[j] = &vals[j]
+		}
+		for rows.Next() {
+			if st.Err = rows.Scan(ptrs...); st.Err != nil {
+				break
+			}
+			st.NRows++
+			for j, out := range c.Data[i].Outputs { // save-columns
+				if s, ok := out.(sql.Scanner); ok && j < len(vals) {
+					s.Scan(vals[j])
+				}
+			}
+			if st.NRows > maxRows {
+				continue
+			}
+			row := make([]string, len(vals))
+			for j, v := range vals {
+				switch v := v.(type) {
+				case nil:
+					row[j] = "NULL"
+				case []byte:
+					row[j] = string(v)
+				default:
+					row[j] = fmt.Sprintf("%v", v)
+				}
+			}
+			st.Rows = append(st.Rows, row)
+		}
+		if st.Err == nil {
+			st.Err = rows.Err()
+		}
+		st.Duration = time.Since(t)
+		return st
+	}
+
+	t := time.Now()
+	var res sql.Result
+	if c.ps[i] != nil {
+		res, st.Err = c.ps[i].ExecContext(ctx, c.values[i]...)
+	} else {
+		res, st.Err = c.conn.ExecContext(ctx, st.Query, args...)
+	}
+	st.Duration = time.Since(t)
+	if st.Err != nil {
+		return st
+	}
+	st.RowsAffected, _ = res.RowsAffected()
+	st.InsertId, _ = res.LastInsertId()
+	if c.Data[i].InsertId != nil { // save-insert-id
+		c.Data[i].InsertId.Scan(st.InsertId)
+	}
+	return st
+}
+
+// Close closes prepared statements and the connection opened by Connect. It's
+// only needed with Step because Run closes them when it returns.
+func (c *Client) Close() {
+	for i := range c.ps {
+		if c.ps[i] != nil {
+			c.ps[i].Close()
+			c.ps[i] = nil
+		}
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.status.connected.Store(false)
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Block, Inc.
+
+package client
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryTemplate(t *testing.T) {
+	// Output must be identical to fmt.Sprintf, including wrong types and counts
+	tests := []struct {
+		query  string
+		values []interface{}
+	}{
+		{"SELECT c FROM t WHERE id=%d", []interface{}{int64(5)}},
+		{"SELECT c FROM t WHERE id BETWEEN %d AND %d LIMIT 1", []interface{}{int64(-3), uint64(7)}},
+		{"INSERT INTO t VALUES (%d, '%s', %v, '%v')", []interface{}{1, "a'b", []byte("xyz"), uint(2)}},
+		{"SELECT '%s' LIKE 'a%%'", []interface{}{[]byte("abc")}},
+		{"SELECT %v, %v, %v", []interface{}{[]byte("abc"), 1.5, nil}},
+		{"SELECT %d, %s", []interface{}{"str", int64(1)}},
+		{"SELECT 100%%", nil},
+		{"SELECT %d, %d", []interface{}{int64(1)}},
+		{"SELECT %d", []interface{}{int64(1), int64(2)}},
+	}
+	for _, test := range tests {
+		qt := newQueryTemplate(test.query)
+		if qt == nil {
+			t.Errorf("%s: nil template", test.query)
+			continue
+		}
+		expect := fmt.Sprintf(test.query, test.values...)
+		if got := qt.format(test.values); got != expect {
+			t.Errorf("got %s, expected %s", got, expect)
+		}
+	}
+
+	// Other verbs, flags, and width: client uses fmt.Sprintf
+	for _, query := range []string{"SELECT %x", "SELECT %05d", "SELECT 100%"} {
+		if newQueryTemplate(query) != nil {
+			t.Errorf("%s: got template, expected nil", query)
+		}
+	}
+}
+
+func Benchmark_QueryTemplate(b *testing.B) {
+	// Compare to fmt.Sprintf:
+	// go test -bench=Query -benchmem
+	qt := newQueryTemplate("SELECT c FROM t WHERE id BETWEEN %d AND %d AND k = '%s'")
+	values := []interface{}{int64(1000), int64(1100), "abcdefghijklmnop"}
+	for n := 0; n < b.N; n++ {
+		qt.format(values)
+	}
+}
+
+func Benchmark_QuerySprintf(b *testing.B) {
+	query := "SELECT c FROM t WHERE id BETWEEN %d AND %d AND k = '%s'"
+	values := []interface{}{int64(1000), int64(1100), "abcdefghijklmnop"}
+	for n := 0; n < b.N; n++ {
+		_ = fmt.Sprintf(query, values...)
+	}
+}
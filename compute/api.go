@@ -1,6 +1,8 @@
 package compute
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,16 +15,22 @@ import (
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/square/finch"
 	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
 	"github.com/square/finch/stats"
 )
 
 type API struct {
 	*sync.Mutex
 	httpServer *http.Server
-	stage      *stageMeta // current stage
+	grpcServer *grpc.Server // if addr is grpc://
+	stage      *stageMeta   // current stage
 	prev       map[string]string
+	ctl        *control // control API, set by Server
+	queue      *Queue   // job queue, set by Server.RunQueue
 }
 
 const (
@@ -38,24 +46,61 @@ type stageMeta struct {
 	nRemotes uint
 	bootChan chan ack         // 1. <-client after booting stage
 	runChan  chan struct{}    // 2. server closes to signal clients to run
+	stopChan chan struct{}    // API.Stage closes when it sets done=true
 	doneChan chan ack         // 3. <-client after running stage
 	stats    *stats.Collector // receives stats from clients while running
 	booted   bool
 	done     bool
+	elastic  bool            // config.stage.compute.elastic
+	share    bool            // config.stage.compute.Share()
+	paused   bool            // control API
+	pods     map[string]bool // Kubernetes compute pods; nil allows any client
 	clients  map[string]*client
 }
 
 type client struct {
-	name  string
-	stage *stageMeta
-	state byte
+	name     string
+	stage    *stageMeta
+	state    byte
+	instance uint           // config.Stage.Instance
+	seen     time.Time      // last request or heartbeat, for lost
+	progress stats.Instance // last stats received, for GET /status
+	// Shared stage (elastic or on-lost: reassign)
+	share  *proto.Share  // set by rebalance
+	notify chan struct{} // gRPC: rebalance -> Run stream
 }
 
-func NewAPI(addr string) *API {
+func NewAPI(addr string, auth Auth) *API {
 	a := &API{
 		Mutex: &sync.Mutex{},
 	}
 
+	tlsConfig, err := auth.serverTLS()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if auth.Token != "" && tlsConfig == nil {
+		log.Println("WARNING: --token without TLS: clients send the token in plaintext")
+	}
+
+	// gRPC server that client instances call (--server grpc://ADDR)
+	if strings.HasPrefix(addr, proto.GRPC_SCHEME) {
+		addr = strings.TrimPrefix(addr, proto.GRPC_SCHEME)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.grpcServer = grpc.NewServer(auth.grpcServerOptions(tlsConfig)...)
+		proto.RegisterComputeServer(a.grpcServer, grpcAPI{a})
+		go func() {
+			log.Println("Listening on", addr, "(gRPC)")
+			if err := a.grpcServer.Serve(ln); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		return a
+	}
+
 	// HTTP server that client instances calls
 	mux := http.NewServeMux()
 	mux.HandleFunc("/boot", a.boot)
@@ -63,9 +108,19 @@ func NewAPI(addr string) *API {
 	mux.HandleFunc("/run", a.run)
 	mux.HandleFunc("/stats", a.stats)
 	mux.HandleFunc("/ping", a.ping)
+	mux.HandleFunc("/live", a.live)
+	mux.HandleFunc("/log", a.log)
+	mux.HandleFunc("/status", a.status)    // control API
+	mux.HandleFunc("/errors", a.errors)    // control API
+	mux.HandleFunc("/control/", a.control) // control API
+	mux.HandleFunc("/jobs", a.jobs)        // job queue
+	root := http.NewServeMux()
+	root.Handle("/", auth.handler(mux)) // --token
+	root.Handle("/ui/", uiHandler())    // web UI (no token, see ui.go)
 	a.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   root,
+		TLSConfig: tlsConfig, // --tls-*
 	}
 
 	// Make sure we can bind to addr:port. ListenAndServe will return an error
@@ -79,7 +134,12 @@ func NewAPI(addr string) *API {
 	}
 	ln.Close()
 	go func() {
-		if err := a.httpServer.ListenAndServe(); err != nil {
+		if tlsConfig != nil {
+			err = a.httpServer.ListenAndServeTLS("", "") // cert in TLSConfig
+		} else {
+			err = a.httpServer.ListenAndServe()
+		}
+		if err != nil {
 			log.Fatal(err)
 		}
 		log.Println("Listening on", addr)
@@ -112,6 +172,9 @@ func (a *API) Stage(newStage *stageMeta) error {
 	// Signal clients that stage has stopped early
 	finch.Debug("stop old stage %s (%s)", oldStage.cfg.Name, oldStage.cfg.Id)
 	oldStage.Lock()
+	if !oldStage.done {
+		close(oldStage.stopChan) // gRPC clients
+	}
 	oldStage.done = true
 	if oldStage.cfg.Test {
 		close(oldStage.runChan)
@@ -164,42 +227,12 @@ func (a *API) boot(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Wait until there's a stage that's not done booting (needs more instances)
 		log.Printf("Remote %s ready to boot\n", rc.name)
-		for {
-			// Has server set a stage?
-			a.Lock()
-			stage := a.stage // copy ptr
-			if stage == nil || stage.done {
-				a.Unlock()
-				goto RETRY // no stage
-			}
-
-			// Is the stage still booting (waiting for instances)?
-			stage.Lock()
-			if stage.booted || len(stage.clients) == int(stage.nRemotes) {
-				stage.Unlock()
-				a.Unlock()
-				goto RETRY // stage is full
-			}
-
-			// Stage is ready and there's a space for this client
-			stage.clients[rc.name] = rc
-			rc.stage = stage
-			rc.state = booting // advance client state
-
-			// Unwind locks before sending stage config via HTTP in case net is slow
-			stage.Unlock()
-			a.Unlock()
-
-			finch.Debug("assigned %s to stage %s (%s): %d of %d clients", rc.name, stage.cfg.Name, stage.cfg.Id,
-				len(stage.clients), stage.nRemotes)
-			json.NewEncoder(w).Encode(stage.cfg) // send stage config
-			return
-
-		RETRY:
-			time.Sleep(200 * time.Millisecond)
+		stage := a.assign(r.Context(), rc)
+		if stage == nil {
+			return // client gone
 		}
+		json.NewEncoder(w).Encode(rc.stageConfig()) // send stage config
 	} else {
 		// POST /boot: client is ack'ing previous GET /boot; body is error message, if any
 		if rc.state != booting {
@@ -215,18 +248,237 @@ func (a *API) boot(w http.ResponseWriter, r *http.Request) {
 		r.Body.Close()
 		w.WriteHeader(http.StatusOK)
 
-		// Remote might fail to boot. If that's the case, do not advance its state;
-		// it should call GET /boot again to reset itself and try again.
-		var clientErr error
-		if string(body) != "" {
-			// Don't advance state: client failed to boot, so it's not ready to run
-			clientErr = fmt.Errorf("%s", string(body))
-		} else {
-			rc.state = runnable // advance client state (successful boot)
+		rc.booted(string(body))
+	}
+}
+
+// assign waits until there's a stage that's not done booting (needs more
+// instances), then assigns the client to it and returns the stage. It returns
+// nil if ctx is cancelled first (the client is gone).
+func (a *API) assign(ctx context.Context, rc *client) *stageMeta {
+	for {
+		// Has server set a stage?
+		a.Lock()
+		stage := a.stage // copy ptr
+		if stage == nil || stage.done {
+			a.Unlock()
+			goto RETRY // no stage
+		}
+
+		// Is the stage still booting (waiting for instances)?
+		stage.Lock()
+		if stage.pods != nil && !stage.pods[rc.name] {
+			stage.Unlock()
+			a.Unlock()
+			finch.Debug("client %s is not a compute pod", rc.name)
+			goto RETRY // not discovered, or not ready when stage started
+		}
+		// An elastic stage accepts clients while running
+		if (stage.booted && !stage.elastic) || len(stage.clients) == int(stage.nRemotes) {
+			stage.Unlock()
+			a.Unlock()
+			goto RETRY // stage is full
+		}
+
+		// Stage is ready and there's a space for this client
+		rc.instance = stage.instance()
+		stage.clients[rc.name] = rc
+		rc.stage = stage
+		rc.state = booting // advance client state
+		rc.seen = time.Now()
+
+		// Unwind locks before sending stage config via the network in case it's slow
+		stage.Unlock()
+		a.Unlock()
+
+		finch.Debug("assigned %s to stage %s (%s): %d of %d clients", rc.name, stage.cfg.Name, stage.cfg.Id,
+			len(stage.clients), stage.nRemotes)
+		return stage
+
+	RETRY:
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// instance returns the lowest compute instance number not used by the local
+// instance (1) or clients. The caller must lock the stage.
+func (m *stageMeta) instance() uint {
+	used := map[uint]bool{}
+	if !m.cfg.Compute.DisableLocal {
+		used[1] = true
+	}
+	for _, rc := range m.clients {
+		used[rc.instance] = true
+	}
+	i := uint(1)
+	for used[i] {
+		i++
+	}
+	return i
+}
+
+// stageConfig returns the stage config to send to the client: the same for
+// all clients except the compute instance number, compute vars, and target
+// (compute.targets).
+func (rc *client) stageConfig() config.Stage {
+	n := rc.stage.nRemotes
+	if !rc.stage.cfg.Compute.DisableLocal {
+		n += 1
+	}
+	cfg, _ := rc.stage.cfg.ComputeVars(rc.instance, n) // checked in Server.run
+	cfg = cfg.ComputeTarget(rc.instance)
+	cfg.Instance = rc.instance
+	return cfg
+}
+
+// booted acks the boot. Remote might fail to boot (errMsg not empty). If that's
+// the case, do not advance its state; it should boot again to reset itself and
+// try again.
+func (rc *client) booted(errMsg string) {
+	var clientErr error
+	if errMsg != "" {
+		// Don't advance state: client failed to boot, so it's not ready to run
+		clientErr = fmt.Errorf("%s", errMsg)
+	} else {
+		rc.state = runnable // advance client state (successful boot)
+	}
+	rc.stage.bootChan <- ack{name: rc.name, err: clientErr}
+}
+
+// done acks that the client is done running the stage. If lost is true, the
+// client didn't finish; the server lost it while running.
+func (rc *client) done(errMsg string, lost bool) {
+	rc.stage.Lock()
+	if rc.stage.clients[rc.name] != rc {
+		rc.stage.Unlock()
+		return // already done: lost
+	}
+	delete(rc.stage.clients, rc.name)
+	rc.stage.Unlock()
+
+	// Tell server client completed stage
+	var clientErr error
+	if errMsg != "" {
+		clientErr = fmt.Errorf("%s", errMsg)
+	}
+	rc.stage.doneChan <- ack{name: rc.name, err: clientErr, lost: lost}
+	rc.state = ready // advance client state (ready to run another stage)
+}
+
+// rebalance sets the client share of a shared stage and notifies the client.
+// HTTP clients receive the share on the next GET /ping, and gRPC clients
+// receive it immediately on the Run stream.
+func (m *stageMeta) rebalance(name string, share proto.Share) {
+	m.Lock()
+	defer m.Unlock()
+	rc, ok := m.clients[name]
+	if !ok {
+		return
+	}
+	rc.share = &share
+	select {
+	case rc.notify <- struct{}{}:
+	default: // already notified
+	}
+}
+
+// control returns the current client control state: its share if the stage
+// is shared, and whether the stage is paused.
+func (rc *client) control(cmd string) *proto.Control {
+	rc.stage.Lock()
+	defer rc.stage.Unlock()
+	ctl := &proto.Control{Cmd: cmd, Paused: rc.stage.paused}
+	if rc.stage.share {
+		ctl.Share = rc.share
+	}
+	return ctl
+}
+
+// pause pauses or resumes the stage on all clients. Like rebalance, HTTP
+// clients receive it on the next GET /ping, and gRPC clients immediately.
+func (m *stageMeta) pause(paused bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.paused = paused
+	for _, rc := range m.clients {
+		select {
+		case rc.notify <- struct{}{}:
+		default: // already notified
+		}
+	}
+}
+
+// runShare returns the client share when the client starts running a shared
+// stage, waiting for the server to set it if the client joined while running.
+// It returns nil if the stage isn't shared.
+func (rc *client) runShare(ctx context.Context) *proto.Share {
+	for {
+		rc.stage.Lock()
+		shared, share := rc.stage.share, rc.share
+		rc.stage.Unlock()
+		if !shared || share != nil {
+			return share
+		}
+		select {
+		case <-rc.notify:
+		case <-rc.stage.stopChan:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// lost returns running clients that haven't sent a heartbeat in the timeout:
+// HTTP clients send GET /ping every second, and gRPC clients send a heartbeat
+// on the Run stream every second. Any request or stats count as a heartbeat,
+// too. (gRPC clients are also lost immediately if the Run stream fails.)
+func (m *stageMeta) lost(timeout time.Duration) []*client {
+	m.Lock()
+	defer m.Unlock()
+	lost := []*client{}
+	for _, rc := range m.clients {
+		if rc.state != running || time.Since(rc.seen) < timeout {
+			continue
 		}
-		rc.stage.bootChan <- ack{name: rc.name, err: clientErr}
+		lost = append(lost, rc)
+	}
+	return lost
+}
 
+// trxFile reads and returns stage trx file i to send to the client.
+func (rc *client) trxFile(i int) ([]byte, error) {
+	s := rc.stage.cfg // shortcut
+	if i < 0 || i > len(s.Trx)-1 {
+		return nil, fmt.Errorf("file number %d out of range for stage %s", i, s.Name)
+	}
+	log.Printf("Sending file %s to %s...", s.Trx[i].File, rc.name)
+	bytes, err := ioutil.ReadFile(s.Trx[i].File)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("Sent file %s to %s", s.Trx[i].File, rc.name)
+	return bytes, nil
+}
+
+// dataFile reads and returns a stage data file (config.Stage.DataFiles) to send
+// to the client. Only data files with a checksum can be sent.
+func (rc *client) dataFile(name string) ([]byte, error) {
+	s := rc.stage.cfg // shortcut
+	if _, ok := s.Checksums[name]; !ok {
+		return nil, fmt.Errorf("unknown data file %s for stage %s", name, s.Name)
+	}
+	log.Printf("Sending data file %s to %s...", name, rc.name)
+	bytes, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Sent data file %s to %s", name, rc.name)
+	return bytes, nil
 }
 
 func (a *API) file(w http.ResponseWriter, r *http.Request) {
@@ -253,6 +505,17 @@ func (a *API) file(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Data file 'data=NAME' instead of trx file 'i=N'
+	if vals, ok := q["data"]; ok && len(vals) > 0 {
+		bytes, err := rc.dataFile(vals[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(bytes)
+		return
+	}
+
 	vals, ok = q["i"]
 	if !ok {
 		http.Error(w, "missing i param in URL query: i=N", http.StatusBadRequest)
@@ -271,23 +534,12 @@ func (a *API) file(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "i param is negative", http.StatusBadRequest)
 		return
 	}
-	s := rc.stage.cfg // shortcut
-	if i > len(s.Trx)-1 {
-		http.Error(w, "i param out of range for stage "+s.Name, http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Sending file %s to %s...", s.Trx[i].File, rc.name)
-
-	// Read file and send it to the client instance
-	bytes, err := ioutil.ReadFile(s.Trx[i].File)
+	bytes, err := rc.trxFile(i)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
 	w.Write(bytes)
-	log.Printf("Sent file %s to %s", s.Trx[i].File, rc.name)
 }
 
 func (a *API) run(w http.ResponseWriter, r *http.Request) {
@@ -318,8 +570,13 @@ func (a *API) run(w http.ResponseWriter, r *http.Request) {
 		}
 		rc.stage.Unlock()
 
+		var body []byte = []byte{0}
+		if share := rc.runShare(r.Context()); share != nil {
+			body, _ = json.Marshal(share)
+		}
+
 		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte{0}); err != nil {
+		if _, err := w.Write(body); err != nil {
 			log.Printf("Lost client %s on stage %s, but it will return\n", rc.name, rc.stage.cfg.Name)
 			return
 		}
@@ -340,18 +597,7 @@ func (a *API) run(w http.ResponseWriter, r *http.Request) {
 		}
 		r.Body.Close()
 		w.WriteHeader(http.StatusOK)
-
-		rc.stage.Lock()
-		delete(rc.stage.clients, rc.name)
-		rc.stage.Unlock()
-
-		// Tell server client completed stage
-		var clientErr error
-		if string(body) != "" {
-			clientErr = fmt.Errorf("%s", string(body))
-		}
-		rc.stage.doneChan <- ack{name: rc.name, err: clientErr}
-		rc.state = ready // advance client state (ready to run another stage)
+		rc.done(string(body), false)
 	}
 }
 
@@ -369,20 +615,41 @@ func (a *API) stats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	// Clients send a batch of stats, gzip-compressed (see stats.Server)
+	var body []byte
+	var err error
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(r.Body); err == nil {
+			body, err = io.ReadAll(gz)
+		}
+	} else {
+		body, err = io.ReadAll(r.Body)
+	}
+	r.Body.Close()
 	if err != nil {
-		log.Printf("error reading error from client: %s", err)
+		log.Printf("error reading stats from client %s: %s", rc.name, err)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	r.Body.Close()
 	w.WriteHeader(http.StatusOK)
 
-	var s stats.Instance
-	if err := json.Unmarshal(body, &s); err != nil {
+	batch, err := stats.DecodeInstances(body)
+	if err != nil {
 		log.Printf("Invalid stats from %s: %s", rc.name, err)
 		return
 	}
+	for _, s := range batch {
+		rc.recvStats(s)
+	}
+}
 
+// recvStats saves the client progress for GET /status and sends its stats to
+// the collector.
+func (rc *client) recvStats(s stats.Instance) {
+	rc.stage.Lock()
+	rc.progress = stats.Instance{Interval: s.Interval, Runtime: s.Runtime, Clients: s.Clients}
+	rc.stage.Unlock()
 	if rc.stage.stats != nil {
 		rc.stage.stats.Recv(s)
 	}
@@ -401,7 +668,66 @@ func (a *API) ping(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusResetContent) // reset
 		return
 	}
-	w.WriteHeader(http.StatusOK) // keep running
+	w.WriteHeader(http.StatusOK)                         // keep running
+	json.NewEncoder(w).Encode(rc.control(proto.CMD_RUN)) // share and pause
+}
+
+// log prints log lines from a client (POST /log). See logStream.
+func (a *API) log(w http.ResponseWriter, r *http.Request) {
+	rc, get, ok := a.client(w, r, false)
+	if !ok {
+		return // client() wrote error response
+	}
+	if get {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var lines []string
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body.Close()
+	rc.printLog(lines)
+	w.WriteHeader(http.StatusOK)
+}
+
+// printLog prints log lines from the client tagged by its name. The lines are
+// printed as-is (not logged) because they have the client timestamp and file.
+func (rc *client) printLog(lines []string) {
+	for _, line := range lines {
+		fmt.Fprintf(log.Writer(), "[%s] %s\n", rc.name, clean(line))
+	}
+}
+
+// live returns the cluster-wide live stats (stats.Live) of the current stage:
+// the last reported interval from all compute instances combined. Unlike the
+// other endpoints, it's for users, not clients, so it doesn't require a client
+// name: curl http://server:33075/live
+func (a *API) live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	a.Lock()
+	m := a.stage
+	a.Unlock()
+	if m == nil || m.stats == nil {
+		w.WriteHeader(http.StatusNoContent) // no stage or stats disabled
+		return
+	}
+	live := m.stats.Live()
+	if live == nil {
+		w.WriteHeader(http.StatusNoContent) // no interval reported yet
+		return
+	}
+	bytes, err := json.Marshal(live)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
 }
 
 // --------------------------------------------------------------------------
@@ -448,13 +774,25 @@ func (a *API) client(w http.ResponseWriter, r *http.Request, boot bool) (*client
 	}
 	sid := clean(vals[0])
 
+	rc, status := a.lookup(name, sid, get, boot)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return nil, false, false
+	}
+	return rc, get, true // success
+}
+
+// lookup returns the client with the given name assigned to the current stage.
+// If get and boot are true, it returns a new client that's not assigned yet.
+// If not ok, it returns a nil client and http.StatusGone, which means the
+// client is out of sync and should reset.
+func (a *API) lookup(name, sid string, get, boot bool) (*client, int) {
 	a.Lock()
 	defer a.Unlock()
 
 	// Has server set a stage? Instances can connect before server is ready.
 	if a.stage == nil {
-		w.WriteHeader(http.StatusGone)
-		return nil, false, false
+		return nil, http.StatusGone
 	}
 
 	a.stage.Lock()
@@ -469,18 +807,18 @@ func (a *API) client(w http.ResponseWriter, r *http.Request, boot bool) (*client
 		if get && boot {
 			finch.Debug("new client")
 			rc = &client{
-				name:  name,
-				state: ready,
+				name:   name,
+				state:  ready,
+				notify: make(chan struct{}, 1),
 			}
-			// Do not add to stage.clients; that's done in boot() if this client
-			// is assigned to the stage
-			return rc, get, true // success (new client)
+			// Do not add to stage.clients; that's done in assign() if this
+			// client is assigned to the stage
+			return rc, http.StatusOK // success (new client)
 		}
 
 		// Instance not assigned to stage and not booting, so it's out of sync
 		log.Printf("Unknown client: %s", name)
-		w.WriteHeader(http.StatusGone) // reset
-		return nil, false, false
+		return nil, http.StatusGone // reset
 	}
 
 	// Instance is assigned to the stage, but check stage ID to make sure a bad
@@ -489,11 +827,11 @@ func (a *API) client(w http.ResponseWriter, r *http.Request, boot bool) (*client
 	// has changed.
 	if !a.stage.done && a.stage.cfg.Id != sid {
 		log.Printf("Wrong stage ID: %s: client %s != current %s", name, sid, a.stage.cfg.Id)
-		w.WriteHeader(http.StatusGone) // reset
-		return nil, false, false
+		return nil, http.StatusGone // reset
 	}
+	rc.seen = time.Now()
 
-	return rc, get, true // success
+	return rc, http.StatusOK // success
 }
 
 // clean removes \n\r to avoid code scanning alert "Log entries created from user input".
@@ -0,0 +1,172 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+)
+
+func TestLost(t *testing.T) {
+	m := &stageMeta{
+		Mutex:    &sync.Mutex{},
+		doneChan: make(chan ack, 2),
+		clients:  map[string]*client{},
+	}
+	now := time.Now()
+	m.clients["r1"] = &client{name: "r1", stage: m, state: running, seen: now}
+	m.clients["r2"] = &client{name: "r2", stage: m, state: running, seen: now.Add(-10 * time.Second)}
+	m.clients["r3"] = &client{name: "r3", stage: m, state: runnable, seen: now.Add(-10 * time.Second)}
+
+	// Only r2: running without a recent heartbeat (r3 isn't running yet)
+	lost := m.lost(5 * time.Second)
+	if len(lost) != 1 || lost[0].name != "r2" {
+		t.Fatalf("got lost clients %+v, expected r2", lost)
+	}
+
+	lost[0].done("no heartbeat", true)
+	a := <-m.doneChan
+	if a.name != "r2" || !a.lost || a.err == nil {
+		t.Errorf("got ack %+v, expected r2 lost with error", a)
+	}
+
+	// Lost client is removed, so a late done ack from it is ignored
+	lost[0].done("", false)
+	select {
+	case a := <-m.doneChan:
+		t.Errorf("got ack %+v, expected none", a)
+	default:
+	}
+	if len(m.lost(5*time.Second)) != 0 {
+		t.Error("r2 lost again, expected it removed")
+	}
+}
+
+func TestLogStream(t *testing.T) {
+	out := log.Writer()
+	defer log.SetOutput(out)
+	log.SetOutput(io.Discard)
+
+	var sent []string
+	ls := streamLogs(func(ctx context.Context, lines []string) error {
+		sent = append(sent, lines...)
+		return nil
+	})
+	log.Printf("line 1")
+	log.Printf("line 2\nline 3")
+	ls.stop()
+	ls.stop() // idempotent
+	log.Printf("not sent")
+
+	if len(sent) != 3 || !strings.HasSuffix(sent[0], "line 1") || sent[2] != "line 3" {
+		t.Errorf("sent %q, expected 3 lines", sent)
+	}
+	if log.Writer() != io.Discard {
+		t.Error("original log output not restored")
+	}
+}
+
+func TestControl(t *testing.T) {
+	a := &API{Mutex: &sync.Mutex{}, ctl: newControl("local")}
+	do := func(method, path string) (int, proto.Status) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if strings.HasPrefix(path, "/control/") {
+			a.control(w, r)
+		} else {
+			a.status(w, r)
+		}
+		var s proto.Status
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, s
+	}
+
+	// No stage yet
+	code, s := do("GET", "/status")
+	if code != http.StatusOK || s.State != proto.STATE_IDLE {
+		t.Errorf("got %d %+v, expected 200 and state idle", code, s)
+	}
+	if code, _ := do("POST", "/control/pause"); code != http.StatusConflict {
+		t.Errorf("got %d, expected 409 without stage", code)
+	}
+	if code, _ := do("POST", "/control/foo"); code != http.StatusNotFound {
+		t.Errorf("got %d, expected 404 for invalid action", code)
+	}
+	if code, _ := do("GET", "/control/stop"); code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d, expected 405 for GET", code)
+	}
+
+	// Stage 1 of 2 with one remote, paused while booting
+	ctx, cancel := context.WithCancel(context.Background())
+	a.ctl.next(1, 2, cancel)
+	m := &stageMeta{Mutex: &sync.Mutex{}, clients: map[string]*client{}}
+	m.clients["r1"] = &client{name: "r1", stage: m, state: running, instance: 2, notify: make(chan struct{}, 1)}
+	if _, s = do("POST", "/control/pause"); !s.Paused {
+		t.Errorf("got %+v, expected paused", s)
+	}
+	a.ctl.boot(config.Stage{Name: "s1", Id: "abc"}, nil, m)
+	a.ctl.run()
+	if ctl := m.clients["r1"].control(proto.CMD_RUN); !ctl.Paused {
+		t.Errorf("remote control %+v, expected paused", ctl)
+	}
+	_, s = do("GET", "/status")
+	if s.State != proto.STATE_RUNNING || s.Stage != "s1" || s.StageNo != 1 || s.Stages != 2 || len(s.Computes) != 1 || s.Computes[0].Name != "r1" {
+		t.Errorf("got status %+v, expected stage s1 (1 of 2) running on r1", s)
+	}
+	if _, s = do("POST", "/control/resume"); s.Paused || m.paused {
+		t.Errorf("got %+v, expected resumed", s)
+	}
+
+	// Skip stops the stage but not the remaining stages; stop stops both
+	do("POST", "/control/skip")
+	if ctx.Err() == nil || a.ctl.stop() {
+		t.Error("skip: stage not stopped, or remaining stages stopped")
+	}
+	do("POST", "/control/stop")
+	if !a.ctl.stop() {
+		t.Error("stop: remaining stages not stopped")
+	}
+
+	a.ctl.done()
+	if code, _ := do("POST", "/control/stop"); code != http.StatusConflict {
+		t.Errorf("got %d, expected 409 after last stage", code)
+	}
+
+	// Recent errors
+	for i := 0; i < maxErrors+1; i++ {
+		a.ctl.error("r1", fmt.Errorf("error %d", i))
+	}
+	w := httptest.NewRecorder()
+	a.errors(w, httptest.NewRequest("GET", "/errors", nil))
+	var errs []proto.StageError
+	if err := json.Unmarshal(w.Body.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != maxErrors || errs[0].Error != "error 1" || errs[0].Compute != "r1" || errs[0].Stage != "s1" {
+		t.Errorf("got %d errors, first %+v; expected %d, first error 1 on r1 in s1", len(errs), errs[0], maxErrors)
+	}
+}
+
+func TestUI(t *testing.T) {
+	w := httptest.NewRecorder()
+	uiHandler().ServeHTTP(w, httptest.NewRequest("GET", "/ui/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "GET /status") {
+		t.Errorf("got %d, expected 200 and index.html", w.Code)
+	}
+}
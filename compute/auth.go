@@ -0,0 +1,211 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+)
+
+// Auth is client-server authentication and encryption from the command line.
+// If Token is set, the server requires it from clients. If TLS is set, the
+// server uses TLS (cert and key are required), and if TLS.CA is set, the server
+// requires client certificates signed by the CA (mTLS). Clients use TLS if TLS
+// is set or the server address is https://; TLS.CA verifies the server, and
+// TLS.Cert and TLS.Key are the client certificate for mTLS.
+type Auth struct {
+	Token string     // --token
+	TLS   config.TLS // --tls-ca, --tls-cert, --tls-key
+}
+
+// Validate validates the TLS files.
+func (a Auth) Validate() error {
+	return a.TLS.Validate()
+}
+
+// serverTLS returns the server TLS config, or nil if TLS is not set.
+func (a Auth) serverTLS() (*tls.Config, error) {
+	if !a.TLS.Set() {
+		return nil, nil
+	}
+	if a.TLS.Cert == "" || a.TLS.Key == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key are required for server TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(a.TLS.Cert, a.TLS.Key)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if a.TLS.CA != "" { // mTLS
+		ca, err := os.ReadFile(a.TLS.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("--tls-ca %s: no certificates", a.TLS.CA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// clientTLS returns the client TLS config, or nil if TLS is not set and
+// the server address isn't https://.
+func (a Auth) clientTLS(addr string) (*tls.Config, error) {
+	host := strings.TrimPrefix(addr, "https://")
+	if i := strings.LastIndex(host, ":"); i > 0 {
+		host = host[:i]
+	}
+	tlsConfig, err := a.TLS.LoadTLS(host)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && strings.HasPrefix(addr, "https://") {
+		tlsConfig = &tls.Config{ServerName: host} // system CA
+	}
+	return tlsConfig, nil
+}
+
+// validToken returns true if the token is not required or matches.
+func (a Auth) validToken(token string) bool {
+	if a.Token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+// --------------------------------------------------------------------------
+// HTTP
+
+// handler wraps the API handler to require the token: "Authorization: Bearer TOKEN".
+func (a Auth) handler(next http.Handler) http.Handler {
+	if a.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.validToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpClient sets finch.MakeHTTPClient to make HTTP clients that use TLS and
+// send the token. It's global because the stats reporter that sends stats to
+// the server makes its own client.
+func (a Auth) httpClient(tlsConfig *tls.Config) {
+	if a.Token == "" && tlsConfig == nil {
+		return
+	}
+	finch.MakeHTTPClient = func() *http.Client {
+		tr := &http.Transport{
+			MaxIdleConns:    1,
+			IdleConnTimeout: 1 * time.Hour,
+			TLSClientConfig: tlsConfig,
+		}
+		return &http.Client{Transport: tokenTransport{token: a.Token, next: tr}}
+	}
+}
+
+type tokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return t.next.RoundTrip(r)
+}
+
+// --------------------------------------------------------------------------
+// gRPC
+
+// grpcServerOptions returns the server TLS credentials and token interceptors.
+func (a Auth) grpcServerOptions(tlsConfig *tls.Config) []grpc.ServerOption {
+	opts := []grpc.ServerOption{}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if a.Token != "" {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := a.grpcToken(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := a.grpcToken(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	return opts
+}
+
+func (a Auth) grpcToken(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if v := md.Get("authorization"); len(v) > 0 {
+		token = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	if !a.validToken(token) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+// grpcDialOptions returns the client TLS (or insecure) credentials and token.
+func (a Auth) grpcDialOptions(tlsConfig *tls.Config) []grpc.DialOption {
+	opts := []grpc.DialOption{}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if a.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds{token: a.Token, tls: tlsConfig != nil}))
+	}
+	return opts
+}
+
+type tokenCreds struct {
+	token string
+	tls   bool
+}
+
+func (c tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c tokenCreds) RequireTransportSecurity() bool {
+	return c.tls
+}
@@ -0,0 +1,67 @@
+package compute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth_HTTPToken(t *testing.T) {
+	auth := Auth{Token: "secret"}
+	h := auth.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/boot", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("Authorization %q: got status %d, expected %d", test.header, w.Code, test.status)
+		}
+	}
+
+	// Client transport sets the header
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	tr := tokenTransport{token: "secret", next: http.DefaultTransport}
+	resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, expected 200", resp.StatusCode)
+	}
+}
+
+func TestAuth_GRPCToken(t *testing.T) {
+	api := NewAPI("grpc://127.0.0.1:33077", Auth{Token: "secret"})
+	defer api.grpcServer.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tr, err := newGRPCTransport("remote1", "127.0.0.1:33077", Auth{Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.boot(ctx)
+	if err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("got error %v, expected token error", err)
+	}
+}
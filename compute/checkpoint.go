@@ -0,0 +1,126 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+	"github.com/square/finch/stats"
+)
+
+// Checkpoint is the server run state saved in the checkpoint file (--checkpoint)
+// before and after each stage. If the server crashes or is restarted during a
+// long multi-stage run, it resumes from the checkpoint with the same stage files:
+// stages done are skipped, and the stage that was running is run again from the
+// start. The file is removed when all stages are done.
+type Checkpoint struct {
+	Run     string            `json:"run"` // run ID, kept on resume
+	Started time.Time         `json:"started"`
+	Updated time.Time         `json:"updated"`
+	Stages  []CheckpointStage `json:"stages"`
+}
+
+// CheckpointStage is the state of one stage in a Checkpoint.
+type CheckpointStage struct {
+	No       uint        `json:"no"`
+	Name     string      `json:"name"`
+	File     string      `json:"file"`
+	State    string      `json:"state"` // "" (not run), proto.STATE_RUNNING, or proto.STATE_DONE
+	Started  time.Time   `json:"started,omitempty"`
+	Finished time.Time   `json:"finished,omitempty"`
+	Stats    *stats.Live `json:"stats,omitempty"` // last reported stats, if any
+}
+
+// loadCheckpoint loads the checkpoint file for stages, or returns a new
+// checkpoint if the file doesn't exist. It returns an error if the checkpoint
+// is for different stages.
+func loadCheckpoint(file string, stages []config.Stage) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Started: time.Now(),
+		Stages:  make([]CheckpointStage, len(stages)),
+	}
+	for i := range stages {
+		cp.Stages[i] = CheckpointStage{
+			No:   uint(i + 1),
+			Name: stages[i].Name,
+			File: stages[i].File,
+		}
+	}
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+		return nil, err
+	}
+	var saved Checkpoint
+	if err := json.Unmarshal(bytes, &saved); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %s", file, err)
+	}
+	if len(saved.Stages) != len(cp.Stages) {
+		return nil, fmt.Errorf("checkpoint %s has %d stages but running %d; remove the file to start a new run", file, len(saved.Stages), len(cp.Stages))
+	}
+	for i := range saved.Stages {
+		if saved.Stages[i].Name != cp.Stages[i].Name || saved.Stages[i].File != cp.Stages[i].File {
+			return nil, fmt.Errorf("checkpoint %s stage %d is %s (%s) but running %s (%s); remove the file to start a new run",
+				file, i+1, saved.Stages[i].Name, saved.Stages[i].File, cp.Stages[i].Name, cp.Stages[i].File)
+		}
+	}
+	return &saved, nil
+}
+
+// done returns true if stage number n (1-indexed) is done.
+func (cp *Checkpoint) done(n int) bool {
+	return cp.Stages[n-1].State == proto.STATE_DONE
+}
+
+// save writes the checkpoint file atomically: a temp file renamed to the file,
+// so a crash while saving doesn't corrupt the last checkpoint.
+func (cp *Checkpoint) save(file string) error {
+	cp.Updated = time.Now()
+	bytes, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".finch-checkpoint-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// resume logs the stages done in a previous run and returns the number done.
+func (cp *Checkpoint) resume(file string) uint {
+	n := uint(0)
+	for _, s := range cp.Stages {
+		if s.State != proto.STATE_DONE {
+			continue
+		}
+		n++
+		if s.Stats != nil {
+			log.Printf("Checkpoint: stage %d %s done at %s: %.0f QPS, %.0f TPS, %d errors", s.No, s.Name, s.Finished.Format(time.RFC3339), s.Stats.QPS, s.Stats.TPS, s.Stats.Errors)
+		} else {
+			log.Printf("Checkpoint: stage %d %s done at %s", s.No, s.Name, s.Finished.Format(time.RFC3339))
+		}
+	}
+	if n > 0 {
+		log.Printf("Resuming from checkpoint %s: %d of %d stages done", file, n, len(cp.Stages))
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package compute
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+	"github.com/square/finch/stats"
+)
+
+func TestCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.json")
+	stages := []config.Stage{
+		{Name: "load", File: "/finch/load.yaml"},
+		{Name: "run", File: "/finch/run.yaml"},
+	}
+
+	// New checkpoint if file doesn't exist
+	cp, err := loadCheckpoint(file, stages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Stages) != 2 || cp.done(1) || cp.done(2) {
+		t.Fatalf("got new checkpoint %+v, expected 2 stages not done", cp)
+	}
+
+	// Save stage 1 done and reload
+	cp.Stages[0].State = proto.STATE_DONE
+	cp.Stages[0].Stats = &stats.Live{QPS: 100}
+	cp.Stages[1].State = proto.STATE_RUNNING
+	if err := cp.save(file); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = loadCheckpoint(file, stages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.done(1) || cp.done(2) {
+		t.Errorf("got stage 1 done %t, stage 2 done %t; expected true, false", cp.done(1), cp.done(2))
+	}
+	if cp.Stages[0].Stats == nil || cp.Stages[0].Stats.QPS != 100 {
+		t.Errorf("got stage 1 stats %+v, expected QPS 100", cp.Stages[0].Stats)
+	}
+	if n := cp.resume(file); n != 1 {
+		t.Errorf("resume returned %d stages done, expected 1", n)
+	}
+
+	// Different stages
+	_, err = loadCheckpoint(file, []config.Stage{{Name: "other", File: "/finch/other.yaml"}, stages[1]})
+	if err == nil || !strings.Contains(err.Error(), "remove the file") {
+		t.Errorf("got error %v for different stages, expected one", err)
+	}
+	_, err = loadCheckpoint(file, stages[0:1])
+	if err == nil {
+		t.Error("no error for different number of stages, expected one")
+	}
+}
+
+func TestServer_Checkpoint(t *testing.T) {
+	// All stages done: Run skips them (no MySQL) and removes the checkpoint
+	dir := t.TempDir()
+	file := filepath.Join(dir, "checkpoint.json")
+	stages := []config.Stage{{Name: "done", File: filepath.Join(dir, "done.yaml")}}
+	cp, err := loadCheckpoint(file, stages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Stages[0].State = proto.STATE_DONE
+	if err := cp.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer("local", "", false, Auth{})
+	s.Checkpoint = file
+	if err := s.Run(context.Background(), stages); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file exists after all stages done, expected it removed (stat: %v)", err)
+	}
+}
@@ -4,7 +4,9 @@ package compute
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -27,58 +29,125 @@ import (
 type Client struct {
 	name string
 	addr string
+	// Standing runs stages until terminated (--standing), for example jobs
+	// from a server job queue, instead of running one stage and exiting.
+	Standing bool
 	// --
-	gds    *data.Scope
-	client *proto.Client
+	gds *data.Scope
+	t   transport
 }
 
-func NewClient(name, addr string) *Client {
-	if !strings.HasPrefix(addr, "http://") {
-		addr = "http://" + addr
-	}
+// transport is the client side of the client-server protocol: HTTP (default)
+// or gRPC if the server address is grpc://ADDR.
+type transport interface {
+	// boot waits for the server to assign the client to a stage and returns
+	// the stage config.
+	boot(ctx context.Context) (config.Stage, error)
+
+	// bootAck tells the server that the client booted the stage, or failed
+	// to boot if bootErr is not nil.
+	bootAck(ctx context.Context, bootErr error) error
+
+	// file returns stage trx file i.
+	file(ctx context.Context, cfg config.Stage, i int) ([]byte, error)
+
+	// dataFile returns stage data file name (config.Stage.DataFiles).
+	dataFile(ctx context.Context, cfg config.Stage, name string) ([]byte, error)
+
+	// waitRun waits for the signal to run the booted stage. It returns false
+	// if the stage was reset instead (boot --test). The returned control has
+	// the client share if the stage is elastic.
+	waitRun(ctx context.Context) (bool, *proto.Control, error)
 
-	return &Client{
+	// watch returns when the server is lost or the server stops the stage
+	// while running, or after doneChan is closed. It calls control when the
+	// server sends a new client share (elastic stage) or pauses or resumes
+	// the stage (control API).
+	watch(ctx context.Context, stageName string, doneChan <-chan struct{}, control func(proto.Control)) (lostServer bool, stageDone bool)
+
+	// log sends client log lines to the server (see logStream).
+	log(ctx context.Context, lines []string) error
+
+	// done tells the server that the client is done running the stage.
+	done(ctx context.Context, runErr error) error
+
+	// reset clears stage state after running a stage.
+	reset()
+
+	// reporter returns the stats reporter name and options that sends stats
+	// to the server.
+	reporter() (string, map[string]string)
+}
+
+func NewClient(name, addr string, auth Auth) (*Client, error) {
+	c := &Client{
 		name: name,
-		addr: strings.TrimSuffix(addr, "/"),
-		// --
-		gds:    data.NewScope(),
-		client: proto.NewClient(name, addr),
+		gds:  data.NewScope(),
+	}
+	if strings.HasPrefix(addr, proto.GRPC_SCHEME) {
+		c.addr = strings.TrimPrefix(addr, proto.GRPC_SCHEME)
+		t, err := newGRPCTransport(name, c.addr, auth)
+		if err != nil {
+			return nil, err
+		}
+		c.t = t
+		return c, nil
+	}
+
+	tlsConfig, err := auth.clientTLS(addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		addr = "https://" + strings.TrimPrefix(addr, "https://")
+	} else if !strings.HasPrefix(addr, "http://") {
+		addr = "http://" + addr
 	}
+	c.addr = strings.TrimSuffix(addr, "/")
+	auth.httpClient(tlsConfig) // before proto.NewClient
+	c.t = &httpTransport{
+		addr:   c.addr,
+		name:   name,
+		client: proto.NewClient(name, c.addr),
+	}
+	return c, nil
 }
 
 func (c *Client) Run(ctxFinch context.Context) error {
-	//for {
-	c.gds.Reset() // keep data from globally-scoped generators; delete the rest
-	if err := c.run(ctxFinch); err != nil {
-		if ctxFinch.Err() != nil {
+	for {
+		c.gds.Reset() // keep data from globally-scoped generators; delete the rest
+		if err := c.run(ctxFinch); err != nil {
+			if ctxFinch.Err() != nil {
+				return nil
+			}
+			log.Println(err)
+			if errors.Is(err, proto.ErrUnauthorized) {
+				return err // don't retry: server rejected --token
+			}
+			time.Sleep(2 * time.Second) // prevent uncontrolled error loop
+		}
+		if !c.Standing || ctxFinch.Err() != nil {
 			return nil
 		}
-		log.Println(err)
-		time.Sleep(2 * time.Second) // prevent uncontrolled error loop
 	}
-	//}
-	return nil
 }
 
 func (c *Client) run(ctxFinch context.Context) error {
 	// ------------------------------------------------------------------
-	// Fetch stage fails (wait for GET /boot to return)
-	var cfg config.Stage
+	// Fetch stage fails (wait for server to assign a stage)
 	log.Printf("Waiting to boot from %s...", c.addr)
-	c.client.PrintErrors = false
-	_, body, err := c.client.Get(ctxFinch, "/boot", nil, proto.R{2 * time.Second, 1 * time.Second, -1})
+	cfg, err := c.t.boot(ctxFinch)
 	if err != nil {
 		return err
 	}
-	c.client.PrintErrors = true
-	if err := json.Unmarshal(body, &cfg); err != nil {
-		return fmt.Errorf("cannot decode stage config file from server: %s", err)
-	}
 	stageName := cfg.Name
-	c.client.StageId = cfg.Id
-	defer func() { c.client.StageId = "" }()
+	defer c.t.reset()
 	fmt.Printf("#\n# %s (%s)\n#\n", stageName, cfg.Id)
 
+	// Stream log to server until done (or error)
+	logs := streamLogs(c.t.log)
+	defer logs.stop()
+
 	// ----------------------------------------------------------------------
 	// Fetch all stage and trx files from server, put in local temp dir
 	tmpdir, err := os.MkdirTemp("", "finch")
@@ -92,6 +161,9 @@ func (c *Client) run(ctxFinch context.Context) error {
 	if err := c.getTrxFiles(ctxFinch, cfg, tmpdir); err != nil {
 		return err
 	}
+	if err := c.getDataFiles(ctxFinch, cfg, tmpdir); err != nil {
+		return err
+	}
 
 	// ------------------------------------------------------------------
 	// Local boot and ack
@@ -101,27 +173,31 @@ func (c *Client) run(ctxFinch context.Context) error {
 		}
 		delete(cfg.Stats.Report, k)
 	}
-	cfg.Stats.Report["server"] = map[string]string{
-		"server":   c.addr,
-		"client":   c.name,
-		"stage-id": c.client.StageId,
+	reporter, opts := c.t.reporter()
+	cfg.Stats.Report[reporter] = opts
+	hostname := c.name
+	if cfg.Target != "" {
+		log.Printf("[%s] Compute instance %d target: %s", stageName, cfg.Instance, cfg.Target)
+		hostname += "@" + cfg.Target // like trx stats for workload[].target
 	}
-	stats, err := stats.NewCollector(cfg.Stats, c.name, 1)
+	stats, err := stats.NewCollector(cfg.Stats, hostname, 1)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("[%s] Booting", stageName)
+	cfg.Checkpoint = "" // only the server checkpoints
+
+	log.Printf("[%s] Booting (run %s)", stageName, cfg.RunId)
 	local := stage.New(cfg, c.gds, stats)
 	if err := local.Prepare(ctxFinch); err != nil {
 		log.Printf("[%s] Boot error, notifying server: %s", stageName, err)
-		c.client.Send(ctxFinch, "/boot", err.Error(), proto.R{500 * time.Millisecond, 100 * time.Millisecond, 3}) // don't care if this fails
-		return err                                                                                                // return original error not Send error
+		c.t.bootAck(ctxFinch, err) // don't care if this fails
+		return err                 // return original error not bootAck error
 	}
 
 	// Boot ack; don't continue on error because we're no longer in sync with server
 	log.Printf("[%s] Boot successful, notifying server", stageName)
-	if err := c.client.Send(ctxFinch, "/boot", nil, proto.R{1 * time.Second, 100 * time.Millisecond, 10}); err != nil {
+	if err := c.t.bootAck(ctxFinch, nil); err != nil {
 		log.Printf("[%s] Sending book ack to server failed: %s", stageName, err)
 		return err
 	}
@@ -130,54 +206,48 @@ func (c *Client) run(ctxFinch context.Context) error {
 	// Wait for run signal. This might be a little while if server is for
 	// other remote instances.
 	log.Printf("[%s] Waiting for run signal", stageName)
-	resp, _, err := c.client.Get(ctxFinch, "/run", nil, proto.R{60 * time.Second, 100 * time.Millisecond, 3})
+	run, ctl, err := c.t.waitRun(ctxFinch)
 	if err != nil {
 		log.Printf("[%s] Timeout waiting for run signal after successful boot, giving up (is the server offline?)", stageName)
 		return err
 	}
-	if resp.StatusCode == http.StatusResetContent {
+	if !run {
 		log.Printf("[%s] Boot test successful", stageName)
 		return nil
 	}
+	if ctl.Share != nil { // elastic stage
+		local.Rebalance(ctl.Share.I, ctl.Share.N)
+		stats.SetInterval(ctl.Share.Interval)
+	}
+	local.Pause(ctl.Paused)
 
 	// ----------------------------------------------------------------------
-	// Local run and ack
+	// Local run and ack. Each stage run has its own graceful stop (CTRL-C).
+	ctxFinch, stopDone := finch.WithStop(ctxFinch)
+	defer stopDone()
 	ctxRun, cancelRun := context.WithCancel(ctxFinch)
 	doneChan := make(chan struct{})
-	defer close(doneChan)
 	lostServer := false
 	stageDone := false
 	go func() {
 		defer cancelRun()
-		for {
-			time.Sleep(1 * time.Second)
-			select {
-			case <-doneChan:
-				finch.Debug("stop check goroutine stopped")
-				return
-			default:
+		lostServer, stageDone = c.t.watch(ctxFinch, stageName, doneChan, func(ctl proto.Control) {
+			if ctl.Share != nil {
+				local.Rebalance(ctl.Share.I, ctl.Share.N)
 			}
-			resp, _, err := c.client.Get(ctxFinch, "/ping", nil, proto.R{500 * time.Millisecond, 100 * time.Millisecond, 5})
-			if err != nil {
-				log.Printf("[%s] Lost contact with server while running, aborting", stageName)
-				lostServer = true
-				return
-			}
-			if resp.StatusCode == http.StatusResetContent {
-				stageDone = true
-				log.Printf("[%s] Server stopped stage", stageName)
-				return
-			}
-		}
+			local.Pause(ctl.Paused)
+		})
 	}()
 
 	local.Run(ctxRun)
+	close(doneChan)
 	log.Printf("[%s] Run stopped: %v (lost server:%v stage stopped:%v); sending done signal to server (5s timeout)", stageName, err, lostServer, stageDone)
 
 	// Run ack; ok if this fails because we're done, nothing left to sync with server
+	logs.stop() // before done because server removes client from stage
 	ctxDone, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer ctxCancel()
-	if err := c.client.Send(ctxDone, "/run", err, proto.R{500 * time.Millisecond, 100 * time.Millisecond, 3}); err != nil {
+	if err := c.t.done(ctxDone, err); err != nil {
 		log.Printf("[%s] Sending done signal to server failed, ignoring: %s", stageName, err)
 	}
 
@@ -192,15 +262,10 @@ func (c *Client) getTrxFiles(ctxFinch context.Context, cfg config.Stage, tmpdir
 			continue
 		}
 		log.Printf("Fetching stage %s file %s...", cfg.Name, trx[i].File)
-		ref := [][]string{
-			{"stage", cfg.Name},
-			{"i", fmt.Sprintf("%d", i)},
-		}
-		resp, body, err := c.client.Get(ctxFinch, "/file", ref, proto.R{5 * time.Second, 100 * time.Millisecond, 3})
+		body, err := c.t.file(ctxFinch, cfg, i)
 		if err != nil {
-			return err // Get retries so error is final
+			return err // transport retries so error is final
 		}
-		finch.Debug("%+v", resp)
 
 		filename := filepath.Join(tmpdir, filepath.Base(trx[i].File))
 		f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0440)
@@ -218,3 +283,174 @@ func (c *Client) getTrxFiles(ctxFinch context.Context, cfg config.Stage, tmpdir
 	}
 	return nil
 }
+
+// getDataFiles fetches data files (config.Stage.DataFiles) from the server unless
+// a local file has the same checksum, and changes trx[].data[].params.file
+// to the fetched file.
+func (c *Client) getDataFiles(ctxFinch context.Context, cfg config.Stage, tmpdir string) error {
+	files := cfg.DataFiles()
+	for i, name := range files {
+		sum, ok := cfg.Checksums[name]
+		if !ok {
+			return fmt.Errorf("server did not send checksum for data file %s", name)
+		}
+		if local, err := checksum(name); err == nil && local == sum {
+			log.Printf("Have local stage %s data file %s; not fetching from server", cfg.Name, name)
+			continue
+		}
+		log.Printf("Fetching stage %s data file %s...", cfg.Name, name)
+		body, err := c.t.dataFile(ctxFinch, cfg, name)
+		if err != nil {
+			return err // transport retries so error is final
+		}
+		if got := fmt.Sprintf("%x", sha256.Sum256(body)); got != sum {
+			return fmt.Errorf("data file %s checksum mismatch: got %s, expected %s", name, got, sum)
+		}
+
+		// Prefix file number because different dirs can have same file name
+		filename := filepath.Join(tmpdir, fmt.Sprintf("data-%d-%s", i, filepath.Base(name)))
+		if err := os.WriteFile(filename, body, 0440); err != nil {
+			return err
+		}
+		finch.Debug("wrote %s", filename)
+		for _, trx := range cfg.Trx {
+			for _, d := range trx.Data {
+				if d.Params["file"] == name {
+					d.Params["file"] = filename
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+// httpTransport is the HTTP client (default).
+type httpTransport struct {
+	addr   string
+	name   string
+	client *proto.Client
+}
+
+var _ transport = &httpTransport{}
+
+func (t *httpTransport) boot(ctx context.Context) (config.Stage, error) {
+	// Wait for GET /boot to return
+	var cfg config.Stage
+	t.client.PrintErrors = false
+	_, body, err := t.client.Get(ctx, "/boot", nil, proto.R{2 * time.Second, 1 * time.Second, -1})
+	if err != nil {
+		return cfg, err
+	}
+	t.client.PrintErrors = true
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return cfg, fmt.Errorf("cannot decode stage config file from server: %s", err)
+	}
+	t.client.StageId = cfg.Id
+	return cfg, nil
+}
+
+func (t *httpTransport) bootAck(ctx context.Context, bootErr error) error {
+	if bootErr != nil {
+		return t.client.Send(ctx, "/boot", bootErr.Error(), proto.R{500 * time.Millisecond, 100 * time.Millisecond, 3})
+	}
+	return t.client.Send(ctx, "/boot", nil, proto.R{1 * time.Second, 100 * time.Millisecond, 10})
+}
+
+func (t *httpTransport) file(ctx context.Context, cfg config.Stage, i int) ([]byte, error) {
+	ref := [][]string{
+		{"stage", cfg.Name},
+		{"i", fmt.Sprintf("%d", i)},
+	}
+	resp, body, err := t.client.Get(ctx, "/file", ref, proto.R{5 * time.Second, 100 * time.Millisecond, 3})
+	if err != nil {
+		return nil, err // Get retries so error is final
+	}
+	finch.Debug("%+v", resp)
+	return body, nil
+}
+
+func (t *httpTransport) waitRun(ctx context.Context) (bool, *proto.Control, error) {
+	resp, body, err := t.client.Get(ctx, "/run", nil, proto.R{60 * time.Second, 100 * time.Millisecond, 3})
+	if err != nil {
+		return false, nil, err
+	}
+	if resp.StatusCode == http.StatusResetContent {
+		return false, nil, nil
+	}
+	return true, &proto.Control{Cmd: proto.CMD_RUN, Share: share(body)}, nil
+}
+
+// share returns the elastic stage client share in the body of GET /run,
+// or nil if the body doesn't have one.
+func share(body []byte) *proto.Share {
+	if len(body) <= 1 { // 1 byte = run signal
+		return nil
+	}
+	var s proto.Share
+	if err := json.Unmarshal(body, &s); err != nil {
+		log.Printf("Invalid share from server: %s: %s", body, err)
+		return nil
+	}
+	return &s
+}
+
+func (t *httpTransport) watch(ctx context.Context, stageName string, doneChan <-chan struct{}, control func(proto.Control)) (bool, bool) {
+	for {
+		time.Sleep(1 * time.Second)
+		select {
+		case <-doneChan:
+			finch.Debug("stop check goroutine stopped")
+			return false, false
+		default:
+		}
+		resp, body, err := t.client.Get(ctx, "/ping", nil, proto.R{500 * time.Millisecond, 100 * time.Millisecond, 5})
+		if err != nil {
+			log.Printf("[%s] Lost contact with server while running, aborting", stageName)
+			return true, false
+		}
+		if resp.StatusCode == http.StatusResetContent {
+			log.Printf("[%s] Server stopped stage", stageName)
+			return false, true
+		}
+		var ctl proto.Control
+		if err := json.Unmarshal(body, &ctl); err != nil {
+			log.Printf("Invalid ping reply from server: %s: %s", body, err)
+			continue
+		}
+		control(ctl)
+	}
+}
+
+func (t *httpTransport) done(ctx context.Context, runErr error) error {
+	return t.client.Send(ctx, "/run", runErr, proto.R{500 * time.Millisecond, 100 * time.Millisecond, 3})
+}
+
+func (t *httpTransport) dataFile(ctx context.Context, cfg config.Stage, name string) ([]byte, error) {
+	ref := [][]string{
+		{"stage", cfg.Name},
+		{"data", name},
+	}
+	_, body, err := t.client.Get(ctx, "/file", ref, proto.R{5 * time.Second, 100 * time.Millisecond, 3})
+	if err != nil {
+		return nil, err // Get retries so error is final
+	}
+	return body, nil
+}
+
+func (t *httpTransport) log(ctx context.Context, lines []string) error {
+	return t.client.Send(ctx, "/log", lines, proto.R{1 * time.Second, 100 * time.Millisecond, 2})
+}
+
+func (t *httpTransport) reset() {
+	t.client.StageId = ""
+}
+
+func (t *httpTransport) reporter() (string, map[string]string) {
+	return "server", map[string]string{
+		"server":   t.addr,
+		"client":   t.name,
+		"stage-id": t.client.StageId,
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+	"github.com/square/finch/stage"
+	"github.com/square/finch/stats"
+)
+
+// Control actions: POST /control/ACTION
+const (
+	CONTROL_STOP   = "stop"   // stop current stage and don't run remaining stages
+	CONTROL_SKIP   = "skip"   // stop current stage and run next stage
+	CONTROL_PAUSE  = "pause"  // pause clients on all compute instances
+	CONTROL_RESUME = "resume" // resume paused clients
+)
+
+// maxErrors is the number of recent errors returned by GET /errors.
+const maxErrors = 100
+
+// control is the server run status and control actions for users (not clients)
+// to query and control the server while it runs stages, for example external
+// orchestration and dashboards. Server updates it as it runs stages, and the
+// API returns it on GET /status and changes it on POST /control/ACTION.
+type control struct {
+	*sync.Mutex
+	name    string // Server.name
+	state   string // proto.STATE_*
+	stageNo uint
+	nStages uint
+	cfg     config.Stage
+	started time.Time    // when stage started running
+	local   *stage.Stage // nil if config.stage.compute.disable-local
+	m       *stageMeta   // remotes
+	paused  bool
+	stopped bool               // CONTROL_STOP
+	cancel  context.CancelFunc // stops current stage
+	errors  []proto.StageError // last maxErrors
+}
+
+func newControl(name string) *control {
+	return &control{
+		Mutex: &sync.Mutex{},
+		name:  name,
+		state: proto.STATE_IDLE,
+	}
+}
+
+// next sets the next stage (1-indexed) and the func to stop it. Stage 1 resets
+// CONTROL_STOP for the next job in a queue.
+func (c *control) next(stageNo, nStages uint, cancel context.CancelFunc) {
+	c.Lock()
+	defer c.Unlock()
+	if stageNo == 1 {
+		c.stopped = false
+	}
+	c.stageNo = stageNo
+	c.nStages = nStages
+	c.cancel = cancel
+	c.cfg = config.Stage{}
+	c.local = nil
+	c.m = nil
+	c.paused = false
+	c.state = proto.STATE_BOOTING
+}
+
+// boot sets the stage config (with Id), local instance (nil if none), and stage
+// metadata for remotes after the local instance has booted. If the stage was
+// paused while booting, the instances start paused.
+func (c *control) boot(cfg config.Stage, local *stage.Stage, m *stageMeta) {
+	c.Lock()
+	defer c.Unlock()
+	c.cfg = cfg
+	c.local = local
+	c.m = m
+	if c.paused {
+		c.pause()
+	}
+}
+
+// run sets the state to running when the server signals instances to run.
+func (c *control) run() {
+	c.Lock()
+	defer c.Unlock()
+	c.state = proto.STATE_RUNNING
+	c.started = time.Now()
+}
+
+// done sets the state to done after all stages.
+func (c *control) done() {
+	c.Lock()
+	defer c.Unlock()
+	c.state = proto.STATE_DONE
+	c.cancel = nil
+	c.local = nil
+	c.m = nil
+}
+
+// stop returns true if CONTROL_STOP was issued: don't run remaining stages.
+func (c *control) stop() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.stopped
+}
+
+// live returns the last reported stats of the current or last stage, or nil if
+// none.
+func (c *control) live() *stats.Live {
+	c.Lock()
+	defer c.Unlock()
+	if c.m == nil || c.m.stats == nil {
+		return nil
+	}
+	return c.m.stats.Live()
+}
+
+// status returns the server status with the local and remote compute instances.
+func (c *control) status() proto.Status {
+	c.Lock()
+	defer c.Unlock()
+	s := proto.Status{
+		State:    c.state,
+		Stage:    c.cfg.Name,
+		StageId:  c.cfg.Id,
+		RunId:    c.cfg.RunId,
+		StageNo:  c.stageNo,
+		Stages:   c.nStages,
+		Limit:    c.cfg.Runtime,
+		Paused:   c.paused,
+		Computes: []proto.ComputeStatus{},
+	}
+	if c.state == proto.STATE_RUNNING {
+		s.Runtime = time.Since(c.started).Seconds()
+	}
+	if c.local != nil {
+		local := proto.ComputeStatus{
+			Name:     c.name,
+			Instance: c.cfg.Instance,
+			State:    proto.STATE_BOOTED,
+		}
+		if c.state == proto.STATE_RUNNING {
+			local.State = proto.STATE_RUNNING
+		}
+		s.Computes = append(s.Computes, local)
+	}
+	if c.m != nil {
+		s.Computes = append(s.Computes, c.m.computes()...)
+	}
+	return s
+}
+
+// error saves a stage error from a compute instance for GET /errors.
+func (c *control) error(compute string, err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.errors = append(c.errors, proto.StageError{
+		Time:    time.Now(),
+		Stage:   c.cfg.Name,
+		Compute: compute,
+		Error:   err.Error(),
+	})
+	if len(c.errors) > maxErrors {
+		c.errors = c.errors[len(c.errors)-maxErrors:]
+	}
+}
+
+// recentErrors returns a copy of the recent errors, oldest first.
+func (c *control) recentErrors() []proto.StageError {
+	c.Lock()
+	defer c.Unlock()
+	return append([]proto.StageError{}, c.errors...)
+}
+
+// action does a control action. It returns false if there's no stage to
+// control: before the first stage, or after the last stage.
+func (c *control) action(action string) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.cancel == nil {
+		return false
+	}
+	switch action {
+	case CONTROL_STOP, CONTROL_SKIP:
+		log.Printf("[%s] Stopping stage: control: %s", c.cfg.Name, action)
+		c.stopped = action == CONTROL_STOP
+		c.cancel()
+	case CONTROL_PAUSE, CONTROL_RESUME:
+		c.paused = action == CONTROL_PAUSE
+		c.pause()
+	}
+	return true
+}
+
+// pause pauses or resumes local and remote instances. The caller must lock c.
+func (c *control) pause() {
+	if c.local != nil {
+		c.local.Pause(c.paused)
+	}
+	if c.m != nil {
+		c.m.pause(c.paused)
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// status returns the server run status (GET /status). Like GET /live, it's for
+// users, not clients: curl http://server:33075/status
+func (a *API) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeStatus(w)
+}
+
+// errors returns recent stage errors (GET /errors), oldest first. MySQL errors
+// are counted in GET /live.
+func (a *API) errors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	errs := []proto.StageError{}
+	if a.ctl != nil {
+		errs = a.ctl.recentErrors()
+	}
+	bytes, err := json.Marshal(errs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+// control does a control action (POST /control/ACTION) and returns the server
+// run status. It returns 409 Conflict if there's no stage to control.
+func (a *API) control(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	action := strings.TrimPrefix(r.URL.Path, "/control/")
+	switch action {
+	case CONTROL_STOP, CONTROL_SKIP, CONTROL_PAUSE, CONTROL_RESUME:
+	default:
+		http.Error(w, "invalid action: "+clean(action)+"; valid actions: stop, skip, pause, resume", http.StatusNotFound)
+		return
+	}
+	if a.ctl == nil || !a.ctl.action(action) {
+		http.Error(w, "no stage running", http.StatusConflict)
+		return
+	}
+	a.writeStatus(w)
+}
+
+func (a *API) writeStatus(w http.ResponseWriter) {
+	s := proto.Status{State: proto.STATE_IDLE, Computes: []proto.ComputeStatus{}}
+	if a.ctl != nil {
+		s = a.ctl.status()
+	}
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+// computes returns the status of remote compute instances, sorted by instance
+// number.
+func (m *stageMeta) computes() []proto.ComputeStatus {
+	m.Lock()
+	defer m.Unlock()
+	computes := make([]proto.ComputeStatus, 0, len(m.clients))
+	for _, rc := range m.clients {
+		c := proto.ComputeStatus{
+			Name:     rc.name,
+			Instance: rc.instance,
+			State:    clientStates[rc.state],
+			Interval: rc.progress.Interval,
+			Runtime:  rc.progress.Runtime,
+			Clients:  rc.progress.Clients,
+		}
+		if !rc.seen.IsZero() {
+			c.Seen = time.Since(rc.seen).Seconds()
+		}
+		computes = append(computes, c)
+	}
+	sort.Slice(computes, func(i, j int) bool {
+		if computes[i].Instance != computes[j].Instance {
+			return computes[i].Instance < computes[j].Instance
+		}
+		return computes[i].Name < computes[j].Name
+	})
+	return computes
+}
+
+var clientStates = map[byte]string{
+	ready:    proto.STATE_IDLE,
+	booting:  proto.STATE_BOOTING,
+	runnable: proto.STATE_BOOTED,
+	running:  proto.STATE_RUNNING,
+}
@@ -0,0 +1,519 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+	"github.com/square/finch/stats"
+)
+
+// grpcAPI is the gRPC server (--server grpc://ADDR). It implements the same
+// client state machine as the HTTP API, so it wraps and shares the API state.
+type grpcAPI struct {
+	*API
+}
+
+var _ proto.ComputeServer = grpcAPI{}
+
+// errReset is returned when the client is out of sync and should reset, like
+// HTTP status 410 Gone.
+var errReset = status.Error(codes.NotFound, "reset")
+
+func (a grpcAPI) Boot(ctx context.Context, in *proto.BootRequest) (*proto.BootReply, error) {
+	rc, code := a.lookup(clean(in.Name), "", true, true)
+	if code != http.StatusOK {
+		return nil, errReset
+	}
+	if rc.state != ready {
+		return nil, status.Error(codes.FailedPrecondition, "client not ready to boot")
+	}
+	log.Printf("Remote %s ready to boot (gRPC)\n", rc.name)
+	stage := a.assign(ctx, rc)
+	if stage == nil {
+		return nil, ctx.Err() // client gone
+	}
+	cfg, err := json.Marshal(rc.stageConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &proto.BootReply{Stage: cfg}, nil
+}
+
+func (a grpcAPI) BootAck(ctx context.Context, in *proto.Ack) (*proto.Empty, error) {
+	rc, code := a.lookup(clean(in.Name), clean(in.StageId), false, false)
+	if code != http.StatusOK {
+		return nil, errReset
+	}
+	if rc.state != booting {
+		return nil, status.Error(codes.FailedPrecondition, "client not booting")
+	}
+	rc.booted(in.Error)
+	return &proto.Empty{}, nil
+}
+
+func (a grpcAPI) File(ctx context.Context, in *proto.FileRequest) (*proto.FileReply, error) {
+	rc, code := a.lookup(clean(in.Name), clean(in.StageId), false, false)
+	if code != http.StatusOK {
+		return nil, errReset
+	}
+	if rc.state != booting {
+		return nil, status.Error(codes.FailedPrecondition, "client not booting")
+	}
+	var bytes []byte
+	var err error
+	if in.Data != "" {
+		bytes, err = rc.dataFile(in.Data)
+	} else {
+		bytes, err = rc.trxFile(in.I)
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &proto.FileReply{Data: bytes}, nil
+}
+
+func (a grpcAPI) Log(ctx context.Context, in *proto.LogRequest) (*proto.Empty, error) {
+	rc, code := a.lookup(clean(in.Name), clean(in.StageId), false, false)
+	if code != http.StatusOK {
+		return nil, errReset
+	}
+	rc.printLog(in.Lines)
+	return &proto.Empty{}, nil
+}
+
+// Run is the bidirectional stream for running a booted stage. The first message
+// from the client identifies it, then the server sends CMD_RUN or CMD_RESET.
+// While running, the client sends stats and heartbeats, and the server sends
+// CMD_STOP if the stage is stopped early. The last message from the client is its done ack.
+func (a grpcAPI) Run(stream proto.Compute_RunServer) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	rc, code := a.lookup(clean(in.Name), clean(in.StageId), false, false)
+	if code != http.StatusOK {
+		return errReset
+	}
+	if rc.state != runnable {
+		return status.Error(codes.FailedPrecondition, "client not runnable")
+	}
+
+	// Remote is waiting for next stage to run
+	log.Printf("Remote %s waiting to start...", rc.name)
+	select {
+	case <-rc.stage.runChan: // closed in Server.Run, or api.Stage if --test
+	case <-rc.stage.stopChan:
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+
+	rc.stage.Lock()
+	if rc.stage.done {
+		delete(rc.stage.clients, rc.name)
+		rc.stage.Unlock()
+		return stream.Send(&proto.Control{Cmd: proto.CMD_RESET})
+	}
+	rc.stage.Unlock()
+
+	rc.runShare(stream.Context()) // wait for share, if shared stage
+	run := rc.control(proto.CMD_RUN)
+	if err := stream.Send(run); err != nil {
+		log.Printf("Lost client %s on stage %s: %s", rc.name, rc.stage.cfg.Name, err)
+		rc.done(err.Error(), true)
+		return err
+	}
+	log.Printf("Started client %s on stage %s (gRPC)\n", rc.name, rc.stage.cfg.Name)
+	rc.state = running // advance client state
+
+	// Push stop to client if server stops the stage early, share if the
+	// server rebalances an elastic stage, and pause or resume (control API).
+	// This replaces the client polling GET /ping with HTTP.
+	ctx, cancel := context.WithCancel(stream.Context())
+	stopped := make(chan struct{})
+	defer func() {
+		cancel()
+		<-stopped // don't send after return
+	}()
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-rc.notify:
+				ctl := rc.control(proto.CMD_PAUSE)
+				if ctl.Share != nil {
+					ctl.Cmd = proto.CMD_SHARE // and pause
+				}
+				if err := stream.Send(ctl); err != nil {
+					return
+				}
+			case <-rc.stage.stopChan:
+				log.Printf("Stage done, stopping %s", rc.name)
+				stream.Send(&proto.Control{Cmd: proto.CMD_STOP})
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			// Unlike HTTP, the server knows immediately when the client is
+			// lost, so ack it as done (with an error) to not wait for it
+			log.Printf("Lost client %s on stage %s: %s", rc.name, rc.stage.cfg.Name, err)
+			rc.done(fmt.Sprintf("lost client: %s", err), true)
+			return err
+		}
+		rc.stage.Lock()
+		rc.seen = time.Now() // heartbeat
+		member := rc.stage.clients[rc.name] == rc
+		rc.stage.Unlock()
+		if !member {
+			log.Printf("Client %s was lost on stage %s, resetting it", rc.name, rc.stage.cfg.Name)
+			return errReset
+		}
+		if in.Done {
+			rc.done(in.Error, false)
+			return nil
+		}
+		if in.Stats == nil {
+			continue
+		}
+		batch, err := stats.DecodeInstances(in.Stats)
+		if err != nil {
+			log.Printf("Invalid stats from %s: %s", rc.name, err)
+			continue
+		}
+		for _, s := range batch {
+			rc.recvStats(s)
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// grpcTransport is the gRPC client (--client grpc://ADDR).
+type grpcTransport struct {
+	name string
+	addr string // without grpc://
+	// --
+	client       *proto.ComputeClient
+	stageId      string
+	stream       proto.Compute_RunClient
+	cancelStream context.CancelFunc
+	recvDone     chan struct{} // closed when watch returns
+	*sync.Mutex                // serializes stream.Send: stats and done
+}
+
+var _ transport = &grpcTransport{}
+
+func newGRPCTransport(name, addr string, auth Auth) (*grpcTransport, error) {
+	tlsConfig, err := auth.clientTLS(addr)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := grpc.Dial(addr, auth.grpcDialOptions(tlsConfig)...)
+	if err != nil {
+		return nil, err
+	}
+	t := &grpcTransport{
+		name:   name,
+		addr:   addr,
+		client: proto.NewComputeClient(cc),
+		Mutex:  &sync.Mutex{},
+	}
+	grpcClients.Lock()
+	grpcClients.t[name] = t
+	grpcClients.Unlock()
+	return t, nil
+}
+
+func (t *grpcTransport) boot(ctx context.Context) (config.Stage, error) {
+	var cfg config.Stage
+	for {
+		// Boot blocks until the server assigns this client to a stage.
+		// WaitForReady makes it wait for the server to be online, too.
+		reply, err := t.client.Boot(ctx, &proto.BootRequest{Name: t.name}, grpc.WaitForReady(true))
+		if err == nil {
+			if err := json.Unmarshal(reply.Stage, &cfg); err != nil {
+				return cfg, fmt.Errorf("cannot decode stage config file from server: %s", err)
+			}
+			t.stageId = cfg.Id
+			return cfg, nil
+		}
+		if ctx.Err() != nil {
+			return cfg, ctx.Err()
+		}
+		if status.Code(err) == codes.Unauthenticated {
+			return cfg, fmt.Errorf("server rejected token (--token): %s", err)
+		}
+		finch.Debug("boot: %s", err)
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func (t *grpcTransport) bootAck(ctx context.Context, bootErr error) error {
+	in := &proto.Ack{Name: t.name, StageId: t.stageId}
+	if bootErr != nil {
+		in.Error = bootErr.Error()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return t.client.BootAck(ctx, in)
+}
+
+func (t *grpcTransport) file(ctx context.Context, cfg config.Stage, i int) ([]byte, error) {
+	reply, err := t.client.File(ctx, &proto.FileRequest{Name: t.name, StageId: t.stageId, I: i})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+func (t *grpcTransport) dataFile(ctx context.Context, cfg config.Stage, name string) ([]byte, error) {
+	reply, err := t.client.File(ctx, &proto.FileRequest{Name: t.name, StageId: t.stageId, Data: name})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+func (t *grpcTransport) log(ctx context.Context, lines []string) error {
+	return t.client.Log(ctx, &proto.LogRequest{Name: t.name, StageId: t.stageId, Lines: lines})
+}
+
+func (t *grpcTransport) waitRun(ctx context.Context) (bool, *proto.Control, error) {
+	var ctxStream context.Context
+	ctxStream, t.cancelStream = context.WithCancel(ctx)
+	stream, err := t.client.Run(ctxStream, grpc.UseCompressor(gzip.Name)) // mostly stats
+	if err != nil {
+		return false, nil, err
+	}
+	if err := stream.Send(&proto.RunMsg{Name: t.name, StageId: t.stageId}); err != nil {
+		return false, nil, err
+	}
+	ctl, err := stream.Recv()
+	if err != nil {
+		return false, nil, err
+	}
+	if ctl.Cmd != proto.CMD_RUN {
+		return false, nil, nil // reset
+	}
+	t.Lock()
+	t.stream = stream
+	t.recvDone = make(chan struct{})
+	t.Unlock()
+	return true, ctl, nil
+}
+
+func (t *grpcTransport) watch(ctx context.Context, stageName string, doneChan <-chan struct{}, control func(proto.Control)) (bool, bool) {
+	defer close(t.recvDone)
+
+	// Heartbeat every second, like GET /ping with HTTP, so the server can
+	// detect a hung client (compute.heartbeat-timeout)
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.send(&proto.RunMsg{Name: t.name, StageId: t.stageId})
+			case <-doneChan:
+				return
+			case <-stopHeartbeat:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		ctl, err := t.stream.Recv()
+		if err != nil {
+			select {
+			case <-doneChan:
+				return false, false // server closed stream after done ack
+			default:
+			}
+			if err != io.EOF {
+				log.Printf("[%s] Lost contact with server while running, aborting: %s", stageName, err)
+			}
+			return true, false
+		}
+		switch ctl.Cmd {
+		case proto.CMD_STOP:
+			log.Printf("[%s] Server stopped stage", stageName)
+			return false, true
+		case proto.CMD_SHARE, proto.CMD_PAUSE:
+			control(*ctl)
+		}
+	}
+}
+
+func (t *grpcTransport) done(ctx context.Context, runErr error) error {
+	in := &proto.RunMsg{Name: t.name, StageId: t.stageId, Done: true}
+	if runErr != nil {
+		in.Error = runErr.Error()
+	}
+	if err := t.send(in); err != nil {
+		return err
+	}
+	t.Lock()
+	t.stream.CloseSend() // heartbeat might be sending
+	t.Unlock()
+
+	// Wait for the server to close the stream after it receives done. watch
+	// might have returned early (server stopped stage), so receive until the
+	// stream is closed, which is immediate if watch already saw it closed.
+	select {
+	case <-t.recvDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := t.stream.Recv(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err() // reset cancels the stream
+	}
+}
+
+func (t *grpcTransport) reset() {
+	t.Lock()
+	defer t.Unlock()
+	if t.cancelStream != nil {
+		t.cancelStream()
+	}
+	t.stageId = ""
+	t.stream = nil
+	t.cancelStream = nil
+}
+
+func (t *grpcTransport) reporter() (string, map[string]string) {
+	return "grpc", map[string]string{
+		"server": t.addr,
+		"client": t.name,
+	}
+}
+
+func (t *grpcTransport) send(m *proto.RunMsg) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.stream == nil {
+		return fmt.Errorf("not running")
+	}
+	return t.stream.Send(m)
+}
+
+// --------------------------------------------------------------------------
+
+// grpcClients maps client names to their gRPC transport so the "grpc" stats
+// reporter can send stats on the client's Run stream.
+var grpcClients = struct {
+	*sync.Mutex
+	t map[string]*grpcTransport
+}{
+	Mutex: &sync.Mutex{},
+	t:     map[string]*grpcTransport{},
+}
+
+func init() {
+	stats.Register("grpc", grpcReporterFactory{})
+}
+
+type grpcReporterFactory struct{}
+
+func (f grpcReporterFactory) Make(name string, opts map[string]string) (stats.Reporter, error) {
+	grpcClients.Lock()
+	t, ok := grpcClients.t[opts["client"]]
+	grpcClients.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no gRPC client %s", opts["client"])
+	}
+	r := grpcReporter{
+		t:         t,
+		statsChan: make(chan stats.Instance, 5),
+		doneChan:  make(chan struct{}),
+	}
+	go r.report()
+	return r, nil
+}
+
+// grpcReporter is a stats.Reporter that sends stats on the gRPC Run stream.
+// Like stats.Server, it sends async so a slow network doesn't block the
+// stats.Collector.
+type grpcReporter struct {
+	t         *grpcTransport
+	statsChan chan stats.Instance
+	doneChan  chan struct{}
+}
+
+var _ stats.Reporter = grpcReporter{}
+
+func (r grpcReporter) Report(from []stats.Instance) {
+	if len(from) != 1 {
+		panic(fmt.Sprintf("compute/grpcReporter.Report passed %d stats, expected 1", len(from)))
+	}
+	select {
+	case r.statsChan <- from[0]:
+	default:
+		log.Printf("Stats dropped because server is not responding: %+v", from[0])
+	}
+}
+
+func (r grpcReporter) Stop() {
+	finch.Debug("stopping")
+	close(r.statsChan)
+	select {
+	case <-r.doneChan:
+		finch.Debug("remote stats done")
+	case <-time.After(5 * time.Second):
+		log.Println("Timeout sending last stats")
+	}
+}
+
+func (r grpcReporter) report() {
+	defer close(r.doneChan)
+	for s := range r.statsChan {
+		batch := stats.Batch(s, r.statsChan)
+		b, err := json.Marshal(batch)
+		if err != nil {
+			log.Printf("Failed to encode stats: %s\n%+v\n", err, batch)
+			continue
+		}
+		if err := r.t.send(&proto.RunMsg{Name: r.t.name, StageId: r.t.stageId, Stats: b}); err != nil {
+			log.Printf("Failed to send stats: %s\n%+v\n", err, batch)
+			continue
+		}
+		finch.Debug("sent %d stats to %s", len(batch), r.t.addr)
+	}
+}
@@ -0,0 +1,143 @@
+package compute
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+)
+
+func TestGRPC(t *testing.T) {
+	trxFile := filepath.Join(t.TempDir(), "trx.sql")
+	if err := os.WriteFile(trxFile, []byte("SELECT 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dataFile := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(dataFile, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewAPI("grpc://127.0.0.1:33076", Auth{})
+	defer api.grpcServer.Stop()
+
+	m := &stageMeta{
+		Mutex: &sync.Mutex{},
+		cfg: config.Stage{
+			Name: "test",
+			Id:   "abc",
+			Trx: []config.Trx{{
+				Name: "trx.sql",
+				File: trxFile,
+				Data: map[string]config.Data{"w": {Generator: "list", Params: map[string]string{"file": dataFile}}},
+			}},
+		},
+		nRemotes: 1,
+		bootChan: make(chan ack, 1),
+		runChan:  make(chan struct{}),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan ack, 1),
+		clients:  map[string]*client{},
+	}
+	var err error
+	if m.cfg.Checksums, err = checksums(m.cfg.DataFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Stage(m); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tr, err := newGRPCTransport("remote1", "127.0.0.1:33076", Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Boot
+	cfg, err := tr.boot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "test" || cfg.Id != "abc" {
+		t.Errorf("got stage %s (%s), expected test (abc)", cfg.Name, cfg.Id)
+	}
+	bytes, err := tr.file(ctx, cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != "SELECT 1" {
+		t.Errorf("got file %q, expected SELECT 1", string(bytes))
+	}
+	if _, err := tr.file(ctx, cfg, 1); err == nil {
+		t.Error("no error for file out of range, expected one")
+	}
+	bytes, err = tr.dataFile(ctx, cfg, dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != "a\nb\n" {
+		t.Errorf("got data file %q, expected a\\nb\\n", string(bytes))
+	}
+	if _, err := tr.dataFile(ctx, cfg, trxFile); err == nil {
+		t.Error("no error for file that's not a data file, expected one")
+	}
+	if err := tr.log(ctx, []string{"remote log line"}); err != nil {
+		t.Error(err)
+	}
+	if err := tr.bootAck(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case a := <-m.bootChan:
+		if a.name != "remote1" || a.err != nil {
+			t.Errorf("got boot ack %+v, expected remote1 without error", a)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for boot ack")
+	}
+
+	// Run: server signals run, then pushes stop when the stage is stopped early
+	close(m.runChan)
+	run, _, err := tr.waitRun(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run {
+		t.Fatal("got reset, expected run")
+	}
+	doneChan := make(chan struct{})
+	watchChan := make(chan bool, 1)
+	go func() {
+		_, stageDone := tr.watch(ctx, "test", doneChan, func(proto.Control) {})
+		watchChan <- stageDone
+	}()
+	go api.Stage(nil) // stop stage
+	select {
+	case stageDone := <-watchChan:
+		if !stageDone {
+			t.Error("stage not stopped, expected stop from server")
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for stop")
+	}
+
+	close(doneChan)
+	if err := tr.done(ctx, nil); err != nil {
+		t.Error(err)
+	}
+	select {
+	case a := <-m.doneChan:
+		if a.name != "remote1" || a.err != nil {
+			t.Errorf("got done ack %+v, expected remote1 without error", a)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for done ack")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// In-cluster service account files mounted in every pod
+const k8sServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// K8s discovers compute pods with the Kubernetes API (--k8s-selector) when the
+// server runs in a pod: running and ready pods in the same namespace that match
+// a label selector. Before each stage, the server sets the number of compute
+// instances to the number of pods, and only pods can boot as clients. A client
+// name is its hostname, which is the pod name by default, so scaling compute
+// pods (kubectl scale) needs no per-pod flags or stage file changes.
+type K8s struct {
+	selector  string
+	namespace string
+	url       string // API server
+	token     string // service account
+	client    *http.Client
+}
+
+// NewK8s returns a K8s with the in-cluster config of the pod: API server from
+// env vars, and token, CA, and namespace from the service account. The service
+// account must be allowed to list pods.
+func NewK8s(selector string) (*K8s, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("--k8s-selector: not running in Kubernetes: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := os.ReadFile(k8sServiceAccount + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("--k8s-selector: %s", err)
+	}
+	namespace, err := os.ReadFile(k8sServiceAccount + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("--k8s-selector: %s", err)
+	}
+	ca, err := os.ReadFile(k8sServiceAccount + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("--k8s-selector: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("--k8s-selector: no certificates in %s/ca.crt", k8sServiceAccount)
+	}
+	k := &K8s{
+		selector:  selector,
+		namespace: strings.TrimSpace(string(namespace)),
+		url:       "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			Timeout:   10 * time.Second,
+		},
+	}
+	return k, nil
+}
+
+// k8sPodList is the part of a Kubernetes PodList that K8s uses.
+type k8sPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string  `json:"name"`
+			DeletionTimestamp *string `json:"deletionTimestamp"`
+		} `json:"metadata"`
+		Status struct {
+			Phase      string `json:"phase"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// Pods returns the names of running and ready pods that match the selector,
+// sorted. Pods being deleted are not returned.
+func (k *K8s) Pods(ctx context.Context) ([]string, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s", k.url, url.PathEscape(k.namespace), url.QueryEscape(k.selector))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list pods %s: %s: %s", k.selector, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var list k8sPodList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	pods := []string{}
+	for _, pod := range list.Items {
+		if pod.Metadata.DeletionTimestamp != nil || pod.Status.Phase != "Running" {
+			continue
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == "Ready" && c.Status == "True" {
+				pods = append(pods, pod.Metadata.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(pods)
+	return pods, nil
+}
@@ -0,0 +1,51 @@
+package compute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestK8s_Pods(t *testing.T) {
+	var gotPath, gotSelector, gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotSelector = r.URL.Query().Get("labelSelector")
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"items": [
+			{"metadata": {"name": "finch-2"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}},
+			{"metadata": {"name": "finch-1"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}},
+			{"metadata": {"name": "finch-3"}, "status": {"phase": "Pending", "conditions": []}},
+			{"metadata": {"name": "finch-4"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False"}]}},
+			{"metadata": {"name": "finch-5", "deletionTimestamp": "2024-01-10T00:00:00Z"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	k := &K8s{
+		selector:  "app=finch-compute",
+		namespace: "bench",
+		url:       ts.URL,
+		token:     "abc",
+		client:    ts.Client(),
+	}
+	pods, err := k.Pods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(pods, []string{"finch-1", "finch-2"}); diff != nil {
+		t.Error(diff)
+	}
+	if gotPath != "/api/v1/namespaces/bench/pods" {
+		t.Errorf("got path %s, expected /api/v1/namespaces/bench/pods", gotPath)
+	}
+	if gotSelector != "app=finch-compute" {
+		t.Errorf("got labelSelector %s, expected app=finch-compute", gotSelector)
+	}
+	if gotAuth != "Bearer abc" {
+		t.Errorf("got Authorization %s, expected Bearer abc", gotAuth)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLogLines is the maximum number of log lines buffered between sends.
+// More lines are dropped (and counted) to bound memory if the server is slow
+// or unreachable.
+const maxLogLines = 1000
+
+// logStream streams client log output to the server while running a stage, so
+// the server prints client errors, reconnects, and panics (recovered by clients)
+// tagged by compute name. It's the log output (log.SetOutput) and writes to the
+// original output, too, so the client still prints its log locally.
+type logStream struct {
+	*sync.Mutex
+	out     io.Writer // original log output
+	send    func(ctx context.Context, lines []string) error
+	lines   []string
+	dropped uint
+	// --
+	stopOnce *sync.Once
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+var _ io.Writer = &logStream{}
+
+// streamLogs sets the log output to a new logStream that sends log lines every
+// second. Call stop to restore the original log output.
+func streamLogs(send func(ctx context.Context, lines []string) error) *logStream {
+	ls := &logStream{
+		Mutex:    &sync.Mutex{},
+		out:      log.Writer(),
+		send:     send,
+		lines:    []string{},
+		stopOnce: &sync.Once{},
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	log.SetOutput(ls)
+	go ls.run()
+	return ls
+}
+
+func (ls *logStream) Write(p []byte) (int, error) {
+	n, err := ls.out.Write(p)
+	lines := strings.Split(strings.TrimSuffix(string(p), "\n"), "\n")
+	ls.Lock()
+	if len(ls.lines)+len(lines) > maxLogLines {
+		ls.dropped += uint(len(lines))
+	} else {
+		ls.lines = append(ls.lines, lines...)
+	}
+	ls.Unlock()
+	return n, err
+}
+
+func (ls *logStream) run() {
+	defer close(ls.doneChan)
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ls.flush()
+		case <-ls.stopChan:
+			return
+		}
+	}
+}
+
+// flush sends buffered log lines. On error, it prints to the original output
+// because logging would write to the stream.
+func (ls *logStream) flush() {
+	ls.Lock()
+	lines, dropped := ls.lines, ls.dropped
+	ls.lines = []string{}
+	ls.dropped = 0
+	ls.Unlock()
+	if dropped > 0 {
+		lines = append(lines, fmt.Sprintf("(%d log lines dropped)", dropped))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := ls.send(ctx, lines); err != nil {
+		fmt.Fprintf(ls.out, "Error sending %d log lines to server: %s\n", len(lines), err)
+	}
+}
+
+// stop restores the original log output and sends the remaining log lines.
+// It's safe to call more than once.
+func (ls *logStream) stop() {
+	ls.stopOnce.Do(func() {
+		log.SetOutput(ls.out)
+		close(ls.stopChan)
+		<-ls.doneChan
+		ls.flush()
+	})
+}
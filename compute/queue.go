@@ -0,0 +1,349 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+)
+
+// LoadFunc loads and validates the stage files of a job with the job params,
+// like stage files on the command line.
+type LoadFunc func(stageFiles, params []string) ([]config.Stage, error)
+
+// Queue is a benchmark job queue (--queue DIR): jobs submitted to the server
+// (POST /jobs or finch submit) run one at a time in the order submitted, and
+// the results of each job are archived in DIR/JOB_ID/:
+//
+//	job.json        proto.Job
+//	finch.log       server log output while the job ran
+//	NN-STAGE.csv    stats of stage NN (CSV reporter)
+//
+// Jobs are kept in memory, so queued jobs are lost if the server stops.
+type Queue struct {
+	*sync.Mutex
+	dir  string
+	load LoadFunc
+	// --
+	jobs []*proto.Job  // all jobs in the order submitted
+	next chan struct{} // Submit signals Run
+}
+
+func NewQueue(dir string, load LoadFunc) (*Queue, error) {
+	dir, err := filepath.Abs(dir) // Server.Run changes the working dir
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Queue{
+		Mutex: &sync.Mutex{},
+		dir:   dir,
+		load:  load,
+		jobs:  []*proto.Job{},
+		next:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Submit queues a job and returns it with its ID. Stage files must be absolute
+// paths on the server. They're not loaded until the job runs because loading
+// changes the working dir, which can't be done while a stage is running.
+func (q *Queue) Submit(job proto.Job) (proto.Job, error) {
+	if len(job.Stages) == 0 {
+		return job, fmt.Errorf("no stage files")
+	}
+	for _, file := range job.Stages {
+		if !filepath.IsAbs(file) {
+			return job, fmt.Errorf("stage file %s: not an absolute path", file)
+		}
+		if !config.FileExists(file) {
+			return job, fmt.Errorf("stage file %s: does not exist on server", file)
+		}
+	}
+	job.Id = xid.New().String()
+	job.State = proto.JOB_QUEUED
+	job.Submitted = time.Now()
+	job.Error = ""
+	job.Dir = filepath.Join(q.dir, job.Id)
+
+	q.Lock()
+	q.jobs = append(q.jobs, &job)
+	q.Unlock()
+	select {
+	case q.next <- struct{}{}:
+	default: // already signaled
+	}
+	log.Printf("Queued job %s: %s", job.Id, strings.Join(job.Stages, " "))
+	return job, nil
+}
+
+// Cancel cancels a queued job. It returns false if the job doesn't exist or
+// isn't queued. (To stop a running job, use POST /control/stop.)
+func (q *Queue) Cancel(id string) bool {
+	q.Lock()
+	defer q.Unlock()
+	for _, job := range q.jobs {
+		if job.Id != id || job.State != proto.JOB_QUEUED {
+			continue
+		}
+		job.State = proto.JOB_CANCELED
+		log.Printf("Canceled job %s", id)
+		return true
+	}
+	return false
+}
+
+// Jobs returns a copy of all jobs in the order submitted.
+func (q *Queue) Jobs() []proto.Job {
+	q.Lock()
+	defer q.Unlock()
+	jobs := make([]proto.Job, len(q.jobs))
+	for i := range q.jobs {
+		jobs[i] = *q.jobs[i]
+	}
+	return jobs
+}
+
+// pop returns the next queued job and sets it running, waiting for a job to be
+// submitted if there are none. It returns nil when ctx is cancelled.
+func (q *Queue) pop(ctx context.Context) *proto.Job {
+	for {
+		q.Lock()
+		for _, job := range q.jobs {
+			if job.State == proto.JOB_QUEUED {
+				job.State = proto.JOB_RUNNING
+				job.Started = time.Now()
+				q.Unlock()
+				return job
+			}
+		}
+		q.Unlock()
+		select {
+		case <-q.next:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// finish sets the final state of a job.
+func (q *Queue) finish(job *proto.Job, state string, err error) {
+	q.Lock()
+	defer q.Unlock()
+	job.State = state
+	job.Finished = time.Now()
+	if err != nil {
+		job.Error = err.Error()
+	}
+}
+
+// save writes DIR/JOB_ID/job.json.
+func (q *Queue) save(job *proto.Job) error {
+	q.Lock()
+	bytes, err := json.MarshalIndent(job, "", "  ")
+	q.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(job.Dir, "job.json"), bytes, 0644)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// archiveStats adds a CSV reporter to each stage that writes stats to the job
+// archive dir, unless the stage already has a CSV reporter or stats disabled.
+func archiveStats(stages []config.Stage, dir string) {
+	for i := range stages {
+		if config.True(stages[i].Stats.Disable) {
+			continue
+		}
+		if _, ok := stages[i].Stats.Report["csv"]; ok {
+			continue
+		}
+		if stages[i].Stats.Report == nil {
+			stages[i].Stats.Report = map[string]map[string]string{}
+		}
+		file := fmt.Sprintf("%02d-%s.csv", i+1, unsafeFileChars.ReplaceAllString(stages[i].Name, "_"))
+		stages[i].Stats.Report["csv"] = map[string]string{"file": filepath.Join(dir, file)}
+	}
+}
+
+// RunQueue runs jobs from the queue one at a time until ctxFinch is cancelled.
+// A job fails if its stages fail to load or a stage returns an error, and it's
+// stopped by POST /control/stop. Either way, the next job runs.
+func (s *Server) RunQueue(ctxFinch context.Context, q *Queue) error {
+	if s.api == nil || s.api.httpServer == nil {
+		return fmt.Errorf("--queue requires --server ADDR (HTTP, not gRPC)")
+	}
+	s.api.Lock()
+	s.api.queue = q
+	s.api.Unlock()
+	log.Printf("Job queue: %s", q.dir)
+
+	for {
+		log.Println("Waiting for jobs...")
+		job := q.pop(ctxFinch)
+		if job == nil {
+			return nil // ctxFinch cancelled
+		}
+		state, err := s.runJob(ctxFinch, q, job)
+		q.finish(job, state, err)
+		if err := q.save(job); err != nil {
+			log.Printf("Error saving job %s: %s", job.Id, err)
+		}
+		log.Printf("Job %s %s", job.Id, state)
+		if ctxFinch.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (s *Server) runJob(ctxFinch context.Context, q *Queue, job *proto.Job) (string, error) {
+	log.Printf("Running job %s", job.Id)
+	if err := os.MkdirAll(job.Dir, 0755); err != nil {
+		return proto.JOB_FAILED, err
+	}
+	if err := q.save(job); err != nil {
+		return proto.JOB_FAILED, err
+	}
+
+	// Archive the server log while the job runs
+	logFile, err := os.Create(filepath.Join(job.Dir, "finch.log"))
+	if err != nil {
+		return proto.JOB_FAILED, err
+	}
+	defer logFile.Close()
+	out := log.Writer()
+	log.SetOutput(io.MultiWriter(out, logFile))
+	defer log.SetOutput(out)
+
+	stages, err := q.load(job.Stages, job.Params)
+	if err != nil {
+		log.Printf("Error loading job %s: %s", job.Id, err)
+		return proto.JOB_FAILED, err
+	}
+	archiveStats(stages, job.Dir)
+	for i := range stages {
+		stages[i].RunId = job.Id // job ID is the run ID
+	}
+
+	if err := s.Run(ctxFinch, stages); err != nil {
+		log.Printf("Error running job %s: %s", job.Id, err)
+		return proto.JOB_FAILED, err
+	}
+	if ctxFinch.Err() != nil || s.ctl.stop() {
+		return proto.JOB_STOPPED, nil
+	}
+	return proto.JOB_DONE, nil
+}
+
+// --------------------------------------------------------------------------
+
+// jobs handles the job queue API: GET /jobs returns all jobs, POST /jobs submits
+// a job (proto.Job with Stages and Params), and DELETE /jobs?id=ID cancels a
+// queued job. It returns 404 Not Found if the server isn't running a queue.
+func (a *API) jobs(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	q := a.queue
+	a.Unlock()
+	if q == nil {
+		http.Error(w, "no job queue (--queue)", http.StatusNotFound)
+		return
+	}
+
+	var reply interface{}
+	switch r.Method {
+	case http.MethodGet:
+		reply = q.Jobs()
+	case http.MethodPost:
+		var job proto.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		job, err := q.Submit(job)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply = job
+	case http.MethodDelete:
+		if !q.Cancel(r.URL.Query().Get("id")) {
+			http.Error(w, "job not found or not queued", http.StatusConflict)
+			return
+		}
+		reply = q.Jobs()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(reply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+// Submit submits a job to the server at addr (finch submit) and returns the
+// queued job.
+func Submit(ctx context.Context, addr string, auth Auth, job proto.Job) (proto.Job, error) {
+	tlsConfig, err := auth.clientTLS(addr)
+	if err != nil {
+		return job, err
+	}
+	if tlsConfig != nil {
+		addr = "https://" + strings.TrimPrefix(addr, "https://")
+	} else if !strings.HasPrefix(addr, "http://") {
+		addr = "http://" + addr
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		return job, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(addr, "/")+"/jobs", bytes.NewReader(body))
+	if err != nil {
+		return job, err
+	}
+	client := &http.Client{
+		Transport: tokenTransport{token: auth.Token, next: &http.Transport{TLSClientConfig: tlsConfig}},
+		Timeout:   10 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return job, err
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return job, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return job, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var queued proto.Job
+	if err := json.Unmarshal(body, &queued); err != nil {
+		return job, err
+	}
+	return queued, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/proto"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	stageFile := filepath.Join(dir, "stage.yaml")
+	if err := os.WriteFile(stageFile, []byte("stage:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewQueue(filepath.Join(dir, "jobs"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit via API (finch submit)
+	a := &API{Mutex: &sync.Mutex{}}
+	ts := httptest.NewServer(http.HandlerFunc(a.jobs))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Submit(ctx, ts.URL, Auth{}, proto.Job{Stages: []string{stageFile}}); err == nil {
+		t.Error("no error without queue, expected one")
+	}
+	a.queue = q
+	for _, file := range []string{"stage.yaml", filepath.Join(dir, "nonexistent.yaml")} {
+		if _, err := Submit(ctx, ts.URL, Auth{}, proto.Job{Stages: []string{file}}); err == nil {
+			t.Errorf("no error for stage file %s, expected one", file)
+		}
+	}
+	job1, err := Submit(ctx, ts.URL, Auth{}, proto.Job{Stages: []string{stageFile}, Params: []string{"k=v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job1.Id == "" || job1.State != proto.JOB_QUEUED || job1.Dir != filepath.Join(dir, "jobs", job1.Id) || len(job1.Params) != 1 {
+		t.Errorf("got job %+v, expected queued with id, dir, and params", job1)
+	}
+	job2, _ := q.Submit(proto.Job{Stages: []string{stageFile}})
+	job3, _ := q.Submit(proto.Job{Stages: []string{stageFile}})
+
+	// Cancel job 2, so jobs run in order 1, 3
+	if !q.Cancel(job2.Id) {
+		t.Error("cancel job 2 failed")
+	}
+	if q.Cancel(job2.Id) {
+		t.Error("canceled job 2 twice, expected false")
+	}
+	for _, id := range []string{job1.Id, job3.Id} {
+		job := q.pop(ctx)
+		if job == nil || job.Id != id || job.State != proto.JOB_RUNNING {
+			t.Fatalf("got job %+v, expected %s running", job, id)
+		}
+		q.finish(job, proto.JOB_DONE, nil)
+	}
+	ctxPop, cancelPop := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelPop()
+	if job := q.pop(ctxPop); job != nil {
+		t.Errorf("got job %+v, expected none", job)
+	}
+
+	states := []string{}
+	for _, job := range q.Jobs() {
+		states = append(states, job.State)
+	}
+	if len(states) != 3 || states[0] != proto.JOB_DONE || states[1] != proto.JOB_CANCELED || states[2] != proto.JOB_DONE {
+		t.Errorf("got job states %v, expected done, canceled, done", states)
+	}
+}
+
+func TestArchiveStats(t *testing.T) {
+	disable := true
+	stages := []config.Stage{
+		{Name: "load tables"},
+		{Name: "run", Stats: config.Stats{Report: map[string]map[string]string{"csv": {"file": "my.csv"}}}},
+		{Name: "off", Stats: config.Stats{Disable: &disable}},
+	}
+	archiveStats(stages, "/jobs/1")
+	if file := stages[0].Stats.Report["csv"]["file"]; file != "/jobs/1/01-load_tables.csv" {
+		t.Errorf("stage 1 csv file %s, expected /jobs/1/01-load_tables.csv", file)
+	}
+	if file := stages[1].Stats.Report["csv"]["file"]; file != "my.csv" {
+		t.Errorf("stage 2 csv file %s, expected my.csv", file)
+	}
+	if _, ok := stages[2].Stats.Report["csv"]; ok {
+		t.Error("stage 3 has csv reporter, expected none because stats disabled")
+	}
+}
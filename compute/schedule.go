@@ -0,0 +1,211 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/square/finch/config"
+)
+
+// Schedule is a cron-like schedule for recurring runs (--schedule). The spec is
+// five space-separated fields in local time:
+//
+//	minute (0-59) hour (0-23) day-of-month (1-31) month (1-12) day-of-week (0-6, 0=Sunday)
+//
+// Each field is "*", a value, a range "N-M", a list "A,B,C", or any of those
+// with a step "/S", like "*/15". As in cron, if both day-of-month and
+// day-of-week are restricted (not "*"), a day matches if either matches.
+// Aliases @hourly, @daily, @weekly, and @monthly are also valid.
+type Schedule struct {
+	spec   string
+	fields [5]uint64 // bit N set = value N matches
+	domAll bool      // day-of-month is *
+	dowAll bool      // day-of-week is *
+}
+
+var scheduleAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+var scheduleBounds = [5][2]uint{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+var scheduleFieldNames = [5]string{"minute", "hour", "day-of-month", "month", "day-of-week"}
+
+func ParseSchedule(spec string) (Schedule, error) {
+	s := Schedule{spec: spec}
+	if alias, ok := scheduleAliases[strings.TrimSpace(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("invalid schedule %q: has %d fields, expected 5: minute hour day-of-month month day-of-week", s.spec, len(fields))
+	}
+	for i, field := range fields {
+		bits, err := parseScheduleField(field, scheduleBounds[i][0], scheduleBounds[i][1])
+		if err != nil {
+			return s, fmt.Errorf("invalid schedule %q: %s: %s", s.spec, scheduleFieldNames[i], err)
+		}
+		s.fields[i] = bits
+	}
+	s.domAll = fields[2] == "*"
+	s.dowAll = fields[4] == "*"
+	return s, nil
+}
+
+func parseScheduleField(field string, min, max uint) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if n := strings.Index(part, "/"); n > -1 {
+			v, err := strconv.ParseUint(part[n+1:], 10, 8)
+			if err != nil || v == 0 {
+				return 0, fmt.Errorf("invalid step in %s", part)
+			}
+			step = uint(v)
+			part = part[:n]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			v, err := strconv.ParseUint(bounds[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %s", part)
+			}
+			lo, hi = uint(v), uint(v)
+			if len(bounds) == 2 {
+				v, err := strconv.ParseUint(bounds[1], 10, 8)
+				if err != nil {
+					return 0, fmt.Errorf("invalid range %s", part)
+				}
+				hi = uint(v)
+			} else if step > 1 {
+				hi = max // "N/S" = N through max every S
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%s out of range %d-%d", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t that matches the schedule, truncated to
+// the minute. It returns the zero time if there's no match in the next 5 years,
+// which is only possible for dates like February 30.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !s.match(3, uint(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.day(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.match(1, uint(t.Hour())) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.match(0, uint(t.Minute())) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s Schedule) match(field int, v uint) bool {
+	return s.fields[field]&(1<<v) != 0
+}
+
+func (s Schedule) day(t time.Time) bool {
+	dom := s.match(2, uint(t.Day()))
+	dow := s.match(4, uint(t.Weekday()))
+	if s.domAll || s.dowAll {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// historyStats adds a history reporter to each stage that appends the stage
+// results to file, unless the stage already has a history reporter or stats
+// disabled. All stages get the same run ID.
+func historyStats(stages []config.Stage, file, run string) {
+	for i := range stages {
+		if config.True(stages[i].Stats.Disable) {
+			continue
+		}
+		if _, ok := stages[i].Stats.Report["history"]; ok {
+			continue
+		}
+		if stages[i].Stats.Report == nil {
+			stages[i].Stats.Report = map[string]map[string]string{}
+		}
+		stages[i].Stats.Report["history"] = map[string]string{
+			"file":  file,
+			"stage": stages[i].Name,
+			"run":   run,
+		}
+	}
+}
+
+// RunSchedule runs stages at each time in the schedule until ctxFinch is
+// cancelled, appending the results of every run to the history file (stats
+// reporter "history"). Stages are loaded before each run, so changes to stage
+// and trx files take effect on the next run. If a run is still running at the
+// next scheduled time, that time is skipped. A run that fails to load or
+// returns an error is logged, and the schedule continues.
+func (s *Server) RunSchedule(ctxFinch context.Context, sched Schedule, load func() ([]config.Stage, error), history string) error {
+	log.Printf("Schedule: %s, history: %s", sched, history)
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule %s has no next run", sched)
+		}
+		log.Printf("Next run at %s", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctxFinch.Done():
+			return nil
+		}
+
+		run := xid.New().String()
+		log.Printf("Running scheduled run %s", run)
+		stages, err := load()
+		if err != nil {
+			log.Printf("Error loading scheduled run %s: %s", run, err)
+			s.ctl.error(s.name, err)
+			continue
+		}
+		for i := range stages {
+			stages[i].RunId = run
+		}
+		historyStats(stages, history, run)
+		if err := s.Run(ctxFinch, stages); err != nil {
+			log.Printf("Error in scheduled run %s: %s", run, err)
+		}
+		if ctxFinch.Err() != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package compute
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/finch/config"
+)
+
+func TestSchedule(t *testing.T) {
+	// Wed Jan 10 2024 10:07
+	now := time.Date(2024, 1, 10, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 1, 11, 2, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},        // Sunday
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},         // monthly
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},       // leap day
+		{"0 0 13 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},       // 13th or Friday
+		{"5,10 1,3 * * 1-5", time.Date(2024, 1, 11, 1, 5, 0, 0, time.UTC)}, // weekdays
+		{"0 0 31 2 *", time.Time{}},                                        // never
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			s, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(now); !got.Equal(test.next) {
+				t.Errorf("got %s, expected %s", got, test.next)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("no error for %q, expected one", spec)
+		}
+	}
+}
+
+func TestHistoryStats(t *testing.T) {
+	disable := true
+	stages := []config.Stage{
+		{Name: "a"},
+		{Name: "b", Stats: config.Stats{Disable: &disable}},
+	}
+	historyStats(stages, "/tmp/history.jsonl", "run1")
+	expect := map[string]string{"file": "/tmp/history.jsonl", "stage": "a", "run": "run1"}
+	got := stages[0].Stats.Report["history"]
+	if len(got) != 3 || got["file"] != expect["file"] || got["stage"] != "a" || got["run"] != "run1" {
+		t.Errorf("got history opts %v, expected %v", got, expect)
+	}
+	if _, ok := stages[1].Stats.Report["history"]; ok {
+		t.Error("history reporter added to stage with stats disabled")
+	}
+}
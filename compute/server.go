@@ -4,17 +4,26 @@ package compute
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/xid"
 
 	"github.com/square/finch"
 	"github.com/square/finch/config"
 	"github.com/square/finch/data"
+	"github.com/square/finch/hook"
+	"github.com/square/finch/load"
+	"github.com/square/finch/proto"
 	"github.com/square/finch/stage"
 	"github.com/square/finch/stats"
 )
@@ -28,41 +37,125 @@ type Server struct {
 	// --
 	gds *data.Scope // global data scope
 	cfg config.Stage
+	ctl *control // control API
+
+	// K8s discovers compute pods (--k8s-selector), or nil to disable.
+	K8s *K8s
+
+	// Checkpoint is the checkpoint file (--checkpoint) to resume a run if
+	// the server is restarted, or "" to disable. See Checkpoint.
+	Checkpoint string
 }
 
 type ack struct {
 	name string // "" for local, else remote.name
 	err  error
+	lost bool // done ack: client lost while running (config.stage.compute.on-lost)
 }
 
-func NewServer(name, addr string, test bool) *Server {
+func NewServer(name, addr string, test bool, auth Auth) *Server {
 	s := &Server{
 		name: name,
 		test: test,
 		gds:  data.NewScope(), // global data
+		ctl:  newControl(name),
 	}
 	if addr != "" {
-		s.api = NewAPI(finch.WithPort(addr, finch.DEFAULT_SERVER_PORT))
+		s.api = NewAPI(finch.WithPort(addr, finch.DEFAULT_SERVER_PORT), auth)
+		s.api.ctl = s.ctl
 	}
 	return s
 }
 
 func (s *Server) Run(ctxFinch context.Context, stages []config.Stage) error {
-	for _, cfg := range stages {
+	defer s.ctl.done()
+
+	// Graceful stop (first CTRL-C or --max-runtime) stops only this run, not
+	// the next one, like the next job in the queue or the next scheduled run
+	ctxFinch, stopDone := finch.WithStop(ctxFinch)
+	defer stopDone()
+
+	// Run ID is the same for all stages and computes so results, query comments,
+	// and logs from one run can be joined. It's set by RunSchedule and runJob.
+	run := ""
+	if len(stages) > 0 {
+		run = stages[0].RunId
+	}
+	if run == "" {
+		run = xid.New().String()
+	}
+
+	var cp *Checkpoint
+	if s.Checkpoint != "" {
+		var err error
+		if cp, err = loadCheckpoint(s.Checkpoint, stages); err != nil {
+			return err
+		}
+		cp.resume(s.Checkpoint)
+		if cp.Run != "" {
+			run = cp.Run // resumed
+		}
+		cp.Run = run
+	}
+
+	log.Printf("Run %s", run)
+	for i := range stages {
+		stages[i].RunId = run
+	}
+
+	for i, cfg := range stages {
+		if cp != nil {
+			if cp.done(i + 1) {
+				log.Printf("Skipping stage %d %s: done in checkpoint", i+1, cfg.Name)
+				continue
+			}
+			cp.Stages[i].State = proto.STATE_RUNNING
+			cp.Stages[i].Started = time.Now()
+			if err := cp.save(s.Checkpoint); err != nil {
+				return fmt.Errorf("checkpoint: %s", err)
+			}
+		}
+
 		// cd dir of config file so relative file paths in config work
 		if err := os.Chdir(filepath.Dir(cfg.File)); err != nil {
 			return err
 		}
 
-		if err := s.run(ctxFinch, cfg); err != nil {
+		// Control API can stop (or skip) the stage: POST /control/stop|skip
+		ctxStage, cancelStage := context.WithCancel(ctxFinch)
+		s.ctl.next(uint(i+1), uint(len(stages)), cancelStage)
+		err := s.run(ctxStage, cfg)
+		cancelStage()
+		if err != nil {
 			return err
 		}
 
-		if ctxFinch.Err() != nil {
-			finch.Debug("finch terminated")
+		if ctxFinch.Err() != nil || finch.Stopped(ctxFinch) {
+			finch.Debug("finch terminated or stopped")
+			return nil // stage still running in checkpoint, so it runs again on resume
+		}
+
+		if cp != nil {
+			cp.Stages[i].State = proto.STATE_DONE
+			cp.Stages[i].Finished = time.Now()
+			cp.Stages[i].Stats = s.ctl.live()
+			if err := cp.save(s.Checkpoint); err != nil {
+				return fmt.Errorf("checkpoint: %s", err)
+			}
+		}
+
+		if s.ctl.stop() {
+			log.Println("Stopped by control API, not running remaining stages")
 			return nil
 		}
 	}
+
+	// All stages done: remove checkpoint so the next run starts from the beginning
+	if cp != nil {
+		if err := os.Remove(s.Checkpoint); err != nil {
+			log.Printf("Error removing checkpoint: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -72,6 +165,28 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 	stageName := cfg.Name
 
 	nInstances := finch.Uint(cfg.Compute.Instances)
+
+	// Kubernetes: compute pods are the remote instances (see K8s)
+	var pods map[string]bool
+	if s.K8s != nil {
+		names, err := s.K8s.Pods(ctxFinch)
+		if err != nil {
+			return fmt.Errorf("kubernetes: %s", err)
+		}
+		if len(names) == 0 && cfg.Compute.DisableLocal {
+			return fmt.Errorf("kubernetes: no compute pods match %s and compute.disable-local=true", s.K8s.selector)
+		}
+		log.Printf("[%s] Kubernetes: %d compute pods: %s", stageName, len(names), strings.Join(names, ", "))
+		pods = map[string]bool{}
+		for _, name := range names {
+			pods[name] = true
+		}
+		nInstances = uint(len(names))
+		if !cfg.Compute.DisableLocal {
+			nInstances += 1
+		}
+	}
+
 	nRemotes := nInstances - 1 // -1 for local unless..
 	if cfg.Compute.DisableLocal {
 		nRemotes += 1 // no local, so all instances are remote
@@ -83,18 +198,84 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 		fmt.Printf("#\n# %s (%s)\n#\n", stageName, cfg.Id)
 	}
 
+	// Skip stage or trx if their skip-if probes are true, e.g. data already loaded.
+	// Not with --test, which validates every stage and trx without running them.
+	if !s.test {
+		if hook.SkipIf(ctxFinch, cfg.SkipIf, cfg) {
+			log.Printf("[%s] Skipping stage: skip-if true: %s", stageName, cfg.SkipIf)
+			return nil
+		}
+		for _, trx := range cfg.Trx {
+			if !hook.SkipIf(ctxFinch, trx.SkipIf, cfg) {
+				continue
+			}
+			log.Printf("[%s] Skipping trx %s: skip-if true: %s", stageName, trx.Name, trx.SkipIf)
+			var ok bool
+			if cfg, ok = cfg.RemoveTrx(trx.Name); !ok {
+				log.Printf("[%s] Skipping stage: all trx skipped", stageName)
+				return nil
+			}
+		}
+	}
+
+	// Run stage.before hooks before Prepare and load planning because a hook
+	// might change MySQL (e.g. restart it or create the table to load) in ways
+	// the stage depends on
+	if !s.test && len(cfg.Before) > 0 {
+		if err := hook.Run(ctxFinch, hook.BEFORE, cfg.Before, cfg); err != nil {
+			return err
+		}
+	}
+
+	// Plan the load (stage.load): make trx files and workload to load the table
+	if cfg.Load != nil {
+		dir, err := os.MkdirTemp("", "finch-load-")
+		if err != nil {
+			return fmt.Errorf("cannot make temp dir: %s", err)
+		}
+		if !finch.Debugging {
+			defer os.RemoveAll(dir)
+		}
+		if cfg, err = load.Plan(ctxFinch, cfg, dir); err != nil {
+			return err
+		}
+	}
+
+	// Checksum data files (like the list generator file) so remotes can fetch
+	// them from the server, or use an identical local copy
+	if nRemotes > 0 {
+		if cfg.Checksums, err = checksums(cfg.DataFiles()); err != nil {
+			return err
+		}
+	}
+
+	// Check compute vars before remotes boot because they're replaced for each
+	// remote in client.stageConfig, which can't return an error
+	if _, err := cfg.ComputeVars(1, nInstances); err != nil {
+		return err
+	}
+
+	runStats(&cfg)
 	m := &stageMeta{
 		Mutex:    &sync.Mutex{},
 		cfg:      cfg,
 		nRemotes: nRemotes,
 		bootChan: make(chan ack, nInstances),
 		runChan:  make(chan struct{}),
+		stopChan: make(chan struct{}),
 		doneChan: make(chan ack, nInstances),
 		clients:  map[string]*client{},
+		elastic:  cfg.Compute.Elastic,
+		share:    cfg.Compute.Share(),
+		pods:     pods,
 	}
 
 	if !config.True(cfg.Stats.Disable) {
-		m.stats, err = stats.NewCollector(cfg.Stats, s.name, nInstances)
+		hostname := s.name
+		if t := cfg.ComputeTarget(1).Target; t != "" && !cfg.Compute.DisableLocal {
+			hostname += "@" + t // like trx stats for workload[].target
+		}
+		m.stats, err = stats.NewCollector(cfg.Stats, hostname, nInstances)
 		if err != nil {
 			return err
 		}
@@ -107,12 +288,24 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 	// exact same config.
 	var local *stage.Stage
 	if !cfg.Compute.DisableLocal {
-		local = stage.New(cfg, s.gds, m.stats)
+		localCfg := cfg
+		if nRemotes > 0 {
+			localCfg.Instance = 1 // remotes are 2..n (see stageMeta.instance)
+		}
+		if localCfg, err = localCfg.ComputeVars(1, nInstances); err != nil {
+			return err
+		}
+		localCfg = localCfg.ComputeTarget(1)
+		if localCfg.Target != "" {
+			log.Printf("[%s] Compute instance 1 (local) target: %s", stageName, localCfg.Target)
+		}
+		local = stage.New(localCfg, s.gds, m.stats)
 		if err := local.Prepare(ctxFinch); err != nil {
 			return err
 		}
 		m.bootChan <- ack{name: s.name} // must ack local, too
 	}
+	s.ctl.boot(cfg, local, m)
 
 	// Set stage in API to trigger remote instances to boot
 	if s.api != nil && nRemotes > 0 {
@@ -124,18 +317,25 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 	// Wait for the required number instances to boot. If running only local,
 	// this will be instant because local already booted and acked above.
 	// But with remotes, this might take a few milliseconds over the network.
+	// An elastic stage runs as soon as one instance boots; the rest join while
+	// it's running.
+	nBoot := nInstances
+	if cfg.Compute.Elastic {
+		nBoot = 1
+	}
 	if nInstances > 1 {
-		log.Printf("Waiting for %d instances to boot...", nInstances)
+		log.Printf("Waiting for %d instances to boot...", nBoot)
 	}
-	booted := uint(0)
-	for booted < nInstances {
+	running := map[string]bool{} // instance names
+	for uint(len(running)) < nBoot {
 		select {
 		case ack := <-m.bootChan:
 			if ack.err != nil {
 				log.Printf("Remote %s error on boot: %s", ack.name, ack.err)
+				s.ctl.error(ack.name, fmt.Errorf("boot: %s", ack.err))
 				continue
 			}
-			booted += 1
+			running[ack.name] = true
 			if nInstances > 1 {
 				log.Printf("%s booted", ack.name)
 			}
@@ -144,7 +344,7 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 		}
 	}
 
-	// Close stage in API to prevent remotes from joining
+	// Close stage in API to prevent remotes from joining, unless elastic
 	m.Lock()
 	m.booted = true
 	m.Unlock()
@@ -158,30 +358,104 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 	// ----------------------------------------------------------------------
 
 	finch.Debug("run %s", stageName)
+	if cfg.Compute.Share() {
+	BOOTED:
+		for { // include remotes that booted after the first instance
+			select {
+			case ack := <-m.bootChan:
+				if ack.err == nil {
+					running[ack.name] = true
+				}
+			default:
+				break BOOTED
+			}
+		}
+		s.rebalance(m, local, running)
+	}
 	close(m.runChan) // signal remotes to run
+	s.ctl.run()
 
+	ctxRun, cancelRun := context.WithCancel(ctxFinch) // on-lost: fail
+	defer cancelRun()
 	if local != nil { // start local instance
 		go func() {
-			local.Run(ctxFinch)
+			local.Run(ctxRun)
 			m.doneChan <- ack{name: s.name}
 		}()
 	}
 
+	// Elastic stage: remotes join (bootChan) and leave (doneChan, or lost)
+	// while running, and the workload is rebalanced each time
+	var bootChan <-chan ack
+	if cfg.Compute.Elastic {
+		bootChan = m.bootChan
+	}
+
+	// Remotes that stop sending heartbeats are lost: hung, or the network
+	// or host failed. Without this, the server waits forever for their
+	// done ack.
+	var lostTicker <-chan time.Time
+	heartbeatTimeout, _ := time.ParseDuration(cfg.Compute.HeartbeatTimeout)
+	if nRemotes > 0 && heartbeatTimeout > 0 {
+		t := time.NewTicker(1 * time.Second)
+		defer t.Stop()
+		lostTicker = t.C
+	}
+	var lostErr error // on-lost: fail
+
 	// Wait for instances to finish running
-	running := booted
-	for running > 0 {
+	for len(running) > 0 {
 		select {
 		case ack := <-m.doneChan:
-			running -= 1
+			delete(running, ack.name)
 			if ack.err != nil {
 				log.Printf("%s error running stage %s: %s", ack.name, stageName, ack.err)
+				if ack.lost {
+					s.ctl.error(ack.name, fmt.Errorf("lost: %s", ack.err))
+				} else {
+					s.ctl.error(ack.name, ack.err)
+				}
 			}
 			if nInstances > 1 {
 				log.Printf("%s completed stage %s", ack.name, stageName)
-				if running > 0 {
-					log.Printf("%d/%d instances running", running, nInstances)
+				if len(running) > 0 {
+					log.Printf("%d/%d instances running", len(running), nInstances)
 				}
 			}
+			if ack.lost {
+				switch cfg.Compute.OnLost {
+				case config.LOST_FAIL:
+					if lostErr == nil {
+						lostErr = fmt.Errorf("lost compute instance %s: %s", ack.name, ack.err)
+						log.Printf("[%s] Stopping stage: on-lost: %s", stageName, config.LOST_FAIL)
+						cancelRun()
+						if s.api != nil {
+							s.api.Stage(nil)
+						}
+					}
+				case config.LOST_REASSIGN:
+					log.Printf("[%s] Reassigning clients of %s to %d instances", stageName, ack.name, len(running))
+				default:
+					log.Printf("[%s] Continuing without %s", stageName, ack.name)
+				}
+			}
+			if len(running) > 0 && (cfg.Compute.Elastic || (ack.lost && cfg.Compute.OnLost == config.LOST_REASSIGN)) {
+				s.rebalance(m, local, running)
+			}
+		case ack := <-bootChan:
+			if ack.err != nil {
+				log.Printf("Remote %s error on boot: %s", ack.name, ack.err)
+				s.ctl.error(ack.name, fmt.Errorf("boot: %s", ack.err))
+				continue
+			}
+			running[ack.name] = true
+			log.Printf("%s joined stage %s: %d/%d instances running", ack.name, stageName, len(running), nInstances)
+			s.rebalance(m, local, running)
+		case <-lostTicker:
+			for _, rc := range m.lost(heartbeatTimeout) {
+				log.Printf("Lost %s while running stage %s: no heartbeat for %s", rc.name, stageName, heartbeatTimeout)
+				rc.done(fmt.Sprintf("no heartbeat for %s", heartbeatTimeout), true)
+			}
 		case <-ctxFinch.Done():
 			// Signal remote instances to stop early and (maybe) send finals stats
 			if s.api != nil {
@@ -190,5 +464,88 @@ func (s *Server) run(ctxFinch context.Context, cfg config.Stage) error {
 		}
 	}
 
+	if lostErr != nil {
+		return lostErr
+	}
+
+	if len(cfg.After) > 0 {
+		if ctxFinch.Err() != nil || finch.Stopped(ctxFinch) {
+			log.Printf("[%s] Finch terminated or stage stopped, not running after hooks", stageName)
+			return nil
+		}
+		if err := hook.Run(ctxFinch, hook.AFTER, cfg.After, cfg); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// rebalance assigns each running instance of a shared stage its share of
+// the workload: instance i of n, ordered by name with local first. Remotes
+// receive their share from the API.
+func (s *Server) rebalance(m *stageMeta, local *stage.Stage, running map[string]bool) {
+	names := make([]string, 0, len(running))
+	for name := range running {
+		if name != s.name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if local != nil {
+		names = append([]string{s.name}, names...)
+	}
+	n := uint(len(names))
+	interval := uint(0)
+	if m.stats != nil {
+		m.stats.SetInstances(n)
+		interval = m.stats.IntervalNo()
+	}
+	for i, name := range names {
+		if name == s.name {
+			local.Rebalance(uint(i), n)
+			continue
+		}
+		m.rebalance(name, proto.Share{I: uint(i), N: n, Interval: interval})
+	}
+}
+
+// runStats sets option run (the run ID) for each stats reporter, unless already
+// set, so results from all stages in a run can be joined.
+func runStats(cfg *config.Stage) {
+	for name, opts := range cfg.Stats.Report {
+		if opts == nil {
+			opts = map[string]string{}
+			cfg.Stats.Report[name] = opts
+		}
+		if _, ok := opts["run"]; !ok {
+			opts["run"] = cfg.RunId
+		}
+	}
+}
+
+// checksums returns the SHA-256 checksum of each file, keyed on file name.
+func checksums(files []string) (map[string]string, error) {
+	sums := map[string]string{}
+	for _, file := range files {
+		sum, err := checksum(file)
+		if err != nil {
+			return nil, fmt.Errorf("data file: %s", err)
+		}
+		sums[file] = sum
+	}
+	return sums, nil
+}
+
+func checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
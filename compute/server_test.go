@@ -32,7 +32,7 @@ func TestServer_Run1Stage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	s := compute.NewServer("local", "", false)
+	s := compute.NewServer("local", "", false, compute.Auth{})
 
 	err = s.Run(context.Background(), stages)
 	if err != nil {
@@ -0,0 +1,22 @@
+// Copyright 2024 Block, Inc.
+
+package compute
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The web UI (GET /ui/) is a dashboard for distributed runs: connected computes,
+// stage progress, live throughput and latency charts, and recent errors. It's
+// static files that poll the control API, so it's served without the token
+// (the page sends the token on API requests).
+
+//go:embed ui
+var uiFiles embed.FS
+
+func uiHandler() http.Handler {
+	files, _ := fs.Sub(uiFiles, "ui") // can't fail: ui is embedded
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+}
@@ -3,6 +3,7 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -58,63 +59,93 @@ func Load(stageFiles []string, kvparams []string, dsn, db string) ([]Stage, erro
 		params[f[0]] = f[1]
 	}
 
-	for n, fileName := range stageFiles {
+	// Stage files and plan files (top-level "stages") expanded into their
+	// stages in dependency order
+	refs := []stageRef{}
+	for _, fileName := range stageFiles {
+		bytes, err := read(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if !isPlan(bytes) {
+			refs = append(refs, stageRef{file: fileName, bytes: bytes, params: params})
+			continue
+		}
+		planRefs, err := loadPlan(fileName, bytes, params)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, planRefs...)
+	}
+
+	for _, ref := range refs {
+		fileName := ref.file
+
 		// Load base file (_all.yaml) once for the dir, if it exists
 		dir := filepath.Dir(fileName)
 		b, ok := base[dir]
 		if !ok {
 			baseFile := filepath.Join(dir, "_all.yaml")
 			if FileExists(baseFile) {
-				finch.Debug("base: %s", baseFile)
-				bytes, err := read(baseFile)
+				b, err = loadBase(baseFile, nil)
 				if err != nil {
 					return nil, err
-				} else {
-					var newb Base
-					if err := yaml.UnmarshalStrict(bytes, &newb); err != nil {
-						return nil, fmt.Errorf("cannot decode YAML in %s: %s", fileName, err)
-					}
-					base[dir] = newb
-					b = newb
-					finch.Debug("base: %+v", b)
 				}
+				finch.Debug("base: %+v", b)
 			} else {
 				finch.Debug("base: none in %s", dir)
 			}
-
-			// --param foo=bar on command line overrides .params in stage files
-			if len(b.Params) > 0 {
-				if b.Params == nil {
-					b.Params = map[string]string{}
-				}
-				for k, v := range params {
-					b.Params[k] = v
-				}
-			}
-
 			base[dir] = b
 		}
 
 		// Load stage file, which includes and overwrite the optional base config (b)
-		bytes, err := read(fileName)
-		if err != nil {
-			return nil, err
-		}
 		absFile, err := filepath.Abs(fileName)
 		if err != nil {
 			return nil, err
 		}
-		f := &stageFile{Stage: Stage{
-			File: absFile,
-			N:    uint(n + 1),
-		}}
-		if err := yaml.UnmarshalStrict(bytes, f); err != nil {
+		f := &stageFile{}
+		if ref.inline != nil {
+			f.Stage = *ref.inline
+		} else if err := yaml.UnmarshalStrict(ref.bytes, f); err != nil {
 			return nil, fmt.Errorf("cannot decode YAML in %s: %s", fileName, err)
 		}
+		f.Stage.File = absFile
+		f.Stage.N = uint(len(stages) + 1)
+		if ref.name != "" {
+			f.Stage.Name = ref.name // plan stages[].name
+		}
+		if ref.skip {
+			f.Stage.Disable = true // plan stages[].if is false
+		}
+
+		// stage.base overrides _all.yaml, and the stage file overrides both
+		if f.Stage.Base != "" {
+			baseFile := f.Stage.Base
+			if !filepath.IsAbs(baseFile) {
+				baseFile = filepath.Join(filepath.Dir(fileName), baseFile)
+			}
+			sb, err := loadBase(baseFile, nil)
+			if err != nil {
+				return nil, fmt.Errorf("in %s: base: %s", fileName, err)
+			}
+			sb.With(b)
+			b = sb
+		}
 
 		// Set stage with defaults (base)
 		f.Stage.With(b)
 
+		// Plan params and --param foo=bar on command line override params in
+		// base and stage files
+		if len(ref.params) > 0 {
+			if f.Stage.Params == nil {
+				f.Stage.Params = map[string]string{}
+			}
+			for k, v := range ref.params {
+				f.Stage.Params[k] = v
+			}
+		}
+
 		// --dsn and --database on command line override config files
 		f.Stage.CommandLine(dsn, db)
 
@@ -132,6 +163,15 @@ func Load(stageFiles []string, kvparams []string, dsn, db string) ([]Stage, erro
 		if err := f.Stage.Validate(); err != nil {
 			return nil, fmt.Errorf("%s invalid: %s", fileName, err)
 		}
+		if f.Stage.Disable {
+			if ref.name != "" {
+				log.Printf("Skipping disabled stage %s in %s", ref.name, fileName)
+			} else {
+				log.Printf("Skipping disabled stage %s", fileName)
+			}
+			os.Chdir(cwd)
+			continue
+		}
 		stages = append(stages, f.Stage)
 		finch.Debug("%+v", f.Stage)
 
@@ -140,6 +180,40 @@ func Load(stageFiles []string, kvparams []string, dsn, db string) ([]Stage, erro
 	return stages, nil
 }
 
+// loadBase loads a base file and, recursively, the base files it includes
+// (base), which are relative to the including file. Files is the stack of
+// including files to detect cycles.
+func loadBase(fileName string, files []string) (Base, error) {
+	finch.Debug("base: %s", fileName)
+	fileName = filepath.Clean(fileName)
+	for _, f := range files {
+		if f == fileName {
+			return Base{}, fmt.Errorf("base cycle: %s -> %s", strings.Join(files, " -> "), fileName)
+		}
+	}
+	bytes, err := read(fileName)
+	if err != nil {
+		return Base{}, err
+	}
+	var b Base
+	if err := yaml.UnmarshalStrict(bytes, &b); err != nil {
+		return Base{}, fmt.Errorf("cannot decode YAML in %s: %s", fileName, err)
+	}
+	if b.Base == "" {
+		return b, nil
+	}
+	baseFile := b.Base
+	if !filepath.IsAbs(baseFile) {
+		baseFile = filepath.Join(filepath.Dir(fileName), baseFile)
+	}
+	def, err := loadBase(baseFile, append(files, fileName))
+	if err != nil {
+		return Base{}, err
+	}
+	b.With(def)
+	return b, nil
+}
+
 func read(filePath string) ([]byte, error) {
 	finch.Debug("read %s", filePath)
 	file, err := filepath.Abs(filePath)
@@ -149,7 +223,42 @@ func read(filePath string) ([]byte, error) {
 	if _, err := os.Stat(file); err != nil {
 		return nil, err
 	}
-	return ioutil.ReadFile(file)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return envVars(b)
+}
+
+// reEnvVar matches ${VAR} and ${VAR:-default}, and escaped $${VAR}. It does
+// not match ${params.foo} or ${sys.foo} because "." is not valid in an
+// environment variable name.
+var reEnvVar = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// envVars replaces ${VAR} with the value of environment variable VAR, or the
+// default value if ${VAR:-default} and VAR is not set. It's applied to the
+// whole file before YAML decoding so it works for any value, even booleans
+// and numbers, whereas Vars only applies to certain string values. $${VAR} is
+// replaced with a literal ${VAR}, like for shell variables in hook exec.
+func envVars(b []byte) ([]byte, error) {
+	var err error
+	b = reEnvVar.ReplaceAllFunc(b, func(v []byte) []byte {
+		if bytes.HasPrefix(v, []byte("$$")) {
+			return v[1:] // escaped
+		}
+		m := reEnvVar.FindSubmatch(v)
+		if val, ok := os.LookupEnv(string(m[1])); ok {
+			return []byte(val)
+		}
+		if bytes.Contains(v, []byte(":-")) {
+			return m[2] // default value (can be empty: ${VAR:-})
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s not set (is it spelled correctly?)", m[1])
+		}
+		return v
+	})
+	return b, err
 }
 
 // ValidFreq validates the freq value for the given config section and returns
@@ -201,7 +310,9 @@ var reHumanNumber = regexp.MustCompile(`([\d,]*\d+(?i:[MKGBI]*))`) // 1M or 1,00
 var reAllDigits = regexp.MustCompile(`^\d+$`)
 
 // Vars changes $params.foo and $FOO to param values and environment variable
-// values, respectively, and human numbers to integers (1k -> 1000).
+// values, respectively, and human numbers to integers (1k -> 1000). Compute
+// vars ($compute.instance) are left as-is unless set in params; see
+// Stage.ComputeVars.
 // "${var}" is also valid but YAML requires string quotes around {}.
 func Vars(s string, params map[string]string, numbers bool) (string, error) {
 	for _, r := range varRE {
@@ -223,6 +334,14 @@ func Vars(s string, params map[string]string, numbers bool) (string, error) {
 				}
 				rep = append(rep, v[0], val)
 				finch.Debug("param: %s -> %v (user-defined)", s, rep)
+			case strings.HasPrefix(p, "compute."):
+				// Compute vars are set in params by Stage.ComputeVars; until
+				// then, they're left as-is
+				val, ok := params[p]
+				if !ok {
+					val = v[0]
+				}
+				rep = append(rep, v[0], val)
 			case strings.HasPrefix(p, "sys."):
 				k := strings.TrimPrefix(p, "sys.")
 				val, ok := finch.SystemParams[k]
@@ -293,3 +412,15 @@ func parseInt(s string) error {
 	_, err := strconv.ParseUint(s, 10, 32)
 	return err
 }
+
+// parsePercent returns an error if s is not a percentage 0-100.
+func parsePercent(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a number: %s", s, err)
+	}
+	if f < 0 || f > 100 {
+		return fmt.Errorf("'%s' is not a percentage: must be 0 to 100", s)
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package config_test
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -22,6 +25,25 @@ func TestValidate_Stage(t *testing.T) {
 	if err != nil {
 		t.Errorf("stage with disable=true and zero trx returned an error, experted err=nil: %v", err)
 	}
+
+	// Load instead of trx
+	c = config.Stage{Load: &config.TableLoad{Table: "t", Rows: "1k"}}
+	if err := c.Vars(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("stage with load and zero trx returned an error, expected err=nil: %v", err)
+	}
+	if c.Load.Rows != "1000" || c.Load.Clients != "1" {
+		t.Errorf("got rows %s clients %s, expected 1000 and 1", c.Load.Rows, c.Load.Clients)
+	}
+	c = config.Stage{
+		Load: &config.TableLoad{Table: "t", Rows: "1000"},
+		Trx:  []config.Trx{{File: "../test/trx/001.sql"}},
+	}
+	if err := c.Validate(); err == nil {
+		t.Error("stage with load and trx returned err=nil, expected validation error")
+	}
 }
 
 func TestVars(t *testing.T) {
@@ -50,6 +72,7 @@ func TestVars(t *testing.T) {
 		{"rows: 1,000", "rows: 1000", true},
 		{"size: 1GiB", "size: 1073741824", true},
 		{"(1, 2, 'foo')", "(1, 2, 'foo')", true},
+		{"db: bench_$compute.instance", "db: bench_$compute.instance", true}, // compute var left as-is
 		// numbers=false
 		{"db.abd6b.us-east-1.rds.amazonaws.com", "db.abd6b.us-east-1.rds.amazonaws.com", false},
 	}
@@ -66,6 +89,49 @@ func TestVars(t *testing.T) {
 	}
 }
 
+func TestComputeVars(t *testing.T) {
+	stage := config.Stage{
+		Name:   "test",
+		Params: map[string]string{"foo": "bar"},
+		MySQL:  config.MySQL{Db: "bench_$compute.instance"},
+		Trx: []config.Trx{{
+			Name: "trx.sql",
+			Data: map[string]config.Data{"id": {Generator: "int", Params: map[string]string{"min": "${compute.instance}000", "max": "$compute.instances"}}},
+		}},
+	}
+	got, err := stage.ComputeVars(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MySQL.Db != "bench_2" {
+		t.Errorf("got db %s, expected bench_2", got.MySQL.Db)
+	}
+	if diff := deep.Equal(got.Trx[0].Data["id"].Params, map[string]string{"min": "2000", "max": "3"}); diff != nil {
+		t.Error(diff)
+	}
+	expect := map[string]string{"foo": "bar", "compute.instance": "2", "compute.instances": "3"}
+	if diff := deep.Equal(got.Params, expect); diff != nil {
+		t.Error(diff)
+	}
+	if stage.MySQL.Db != "bench_$compute.instance" || len(stage.Params) != 1 {
+		t.Errorf("original stage changed: %+v", stage)
+	}
+
+	// Set in params, compute vars work in trx files (ParamVars)
+	q, err := config.ParamVars("SELECT * FROM t$compute.instance LIMIT $params.foo", got.Params, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != "SELECT * FROM t2 LIMIT bar" {
+		t.Errorf("got %s, expected SELECT * FROM t2 LIMIT bar", q)
+	}
+
+	stage.Name = "test-$compute.foo"
+	if _, err := stage.ComputeVars(1, 1); err == nil {
+		t.Error("no error for unknown compute var, expected one")
+	}
+}
+
 func TestLoadWithBase(t *testing.T) {
 	stages, err := config.Load([]string{"../test/config/b1/stage.yaml"}, nil, "", "")
 	if err != nil {
@@ -80,13 +146,20 @@ func TestLoadWithBase(t *testing.T) {
 		Name: "test",
 		File: fileName,
 		Compute: config.Compute{
-			Instances: "1",
+			HeartbeatTimeout: "5s",
+			Instances:        "1",
+			MaxCPU:           "90",
+			MaxGCPause:       "5",
+			OnClientBound:    config.BOUND_WARN,
+			OnLost:           config.LOST_CONTINUE,
 		},
 		Params: map[string]string{
 			"foo": "test",
 		},
+		Progress: config.DEFAULT_PROGRESS,
 		Stats: config.Stats{
-			Freq: "0s",
+			Clock: config.CLOCK_MONOTONIC,
+			Freq:  "0s",
 			Report: map[string]map[string]string{
 				"stdout": map[string]string{
 					"each-instance": "true",
@@ -104,3 +177,534 @@ func TestLoadWithBase(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestLoadEnvVars(t *testing.T) {
+	t.Setenv("FINCH_TEST_NAME", "env")
+	t.Setenv("FINCH_TEST_ROWS", "5k")
+
+	// --param overrides params in stage file (foo) and can set new ones (host)
+	params := []string{"foo=cli", "host=db.local"}
+	stages, err := config.Load([]string{"../test/config/env/stage.yaml"}, params, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stages[0]
+	if s.Name != "env" {
+		t.Errorf("got name %s, expected env (from env var)", s.Name)
+	}
+	if s.Disable {
+		t.Errorf("stage disabled, expected default false")
+	}
+	expect := map[string]string{"rows": "5000", "foo": "cli", "host": "db.local"}
+	if diff := deep.Equal(s.Params, expect); diff != nil {
+		t.Error(diff)
+	}
+	if s.MySQL.Hostname != "db.local" || s.MySQL.Db != "" {
+		t.Errorf("got mysql.hostname '%s' db '%s', expected 'db.local' and ''", s.MySQL.Hostname, s.MySQL.Db)
+	}
+
+	// $${VAR} is escaped for the shell, not replaced at load
+	if len(s.Before) != 1 || s.Before[0].Exec != "echo ${FINCH_STAGE} ${HOME:-none} > /dev/null" {
+		t.Errorf("got before hooks %+v, expected exec with ${FINCH_STAGE} and ${HOME:-none}", s.Before)
+	}
+
+	// Env var without default must be set
+	os.Unsetenv("FINCH_TEST_NAME")
+	_, err = config.Load([]string{"../test/config/env/stage.yaml"}, params, "", "")
+	if err == nil {
+		t.Errorf("no error for unset env var, expected one")
+	}
+}
+
+func TestLoad_StageBase(t *testing.T) {
+	// Precedence: stage file > stage.base (profiles/common.yaml) > its base
+	// (cluster.yaml) > _all.yaml
+	stages, err := config.Load([]string{"../test/config/base/stage.yaml"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stages[0]
+	expect := map[string]string{
+		"rows":    "100",    // _all.yaml
+		"foo":     "common", // profiles/common.yaml
+		"clients": "8",      // stage.yaml
+	}
+	if diff := deep.Equal(s.Params, expect); diff != nil {
+		t.Error(diff)
+	}
+	if s.MySQL.Hostname != "primary.local" || s.MySQL.Username != "bench" {
+		t.Errorf("got mysql %s@%s, expected bench@primary.local from cluster.yaml", s.MySQL.Username, s.MySQL.Hostname)
+	}
+	if s.Stats.Freq != "5s" {
+		t.Errorf("got stats.freq %s, expected 5s from profiles/common.yaml", s.Stats.Freq)
+	}
+	if _, ok := s.Stats.Report["stdout"]; !ok {
+		t.Errorf("no stdout stats report, expected it from profiles/common.yaml")
+	}
+	replica, ok := s.Targets["replica"]
+	if !ok {
+		t.Fatalf("no replica target, expected it from cluster.yaml")
+	}
+	if replica.Hostname != "replica.local" || replica.Username != "bench" {
+		t.Errorf("got replica %s@%s, expected bench@replica.local", replica.Username, replica.Hostname)
+	}
+
+	_, err = config.Load([]string{"../test/config/base/cycle.yaml"}, nil, "", "")
+	if err == nil {
+		t.Errorf("no error for base cycle, expected one")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	// The schema files in the docs must match the schema because users and
+	// editors use the files. To update: finch schema > docs/static/schema/stage.json,
+	// and the same for all.json (finch schema all) and plan.json (finch schema plan)
+	for _, file := range []string{"stage", "all", "plan"} {
+		schema, err := config.Schema(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bytes, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(bytes) + "\n"
+		expect, err := os.ReadFile(filepath.Join("../docs/static/schema", file+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(expect) {
+			t.Errorf("docs/static/schema/%s.json is out of date: run finch schema %s to update it", file, file)
+		}
+	}
+
+	// Stage file properties come from yaml tags
+	s, _ := config.Schema("stage")
+	stage := s["properties"].(map[string]interface{})["stage"].(map[string]interface{})
+	props := stage["properties"].(map[string]interface{})
+	for _, p := range []string{"name", "runtime", "trx", "workload", "mysql"} {
+		if _, ok := props[p]; !ok {
+			t.Errorf("stage property %s not in schema", p)
+		}
+	}
+	if _, ok := props["file"]; ok {
+		t.Errorf("stage property file in schema, expected it to be skipped (yaml:\"-\")")
+	}
+}
+
+func TestLoadPlan(t *testing.T) {
+	// Stages in dependency order, warmup skipped because its if is false
+	stages, err := config.Load([]string{"../test/config/plan/plan.yaml"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, s := range stages {
+		got = append(got, s.Name)
+	}
+	if diff := deep.Equal(got, []string{"setup", "bench"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(stages) == 2 {
+		// Plan params override stage file params
+		if stages[0].Params["rows"] != "100" {
+			t.Errorf("got setup rows %s, expected 100 from plan params", stages[0].Params["rows"])
+		}
+		if stages[1].N != 2 || stages[1].Runtime != "1s" {
+			t.Errorf("got bench N %d runtime %s, expected 2 and 1s", stages[1].N, stages[1].Runtime)
+		}
+	}
+
+	// --param overrides plan params
+	stages, err = config.Load([]string{"../test/config/plan/plan.yaml"}, []string{"warmup=yes"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = []string{}
+	for _, s := range stages {
+		got = append(got, s.Name)
+	}
+	if diff := deep.Equal(got, []string{"setup", "warmup", "bench"}); diff != nil {
+		t.Error(diff)
+	}
+
+	_, err = config.Load([]string{"../test/config/plan/cycle.yaml"}, nil, "", "")
+	if err == nil {
+		t.Errorf("no error for dependency cycle, expected one")
+	}
+}
+
+func TestHook(t *testing.T) {
+	// Exec hooks interpolate only params, not shell variables
+	h := config.Hook{Exec: `echo $params.foo ${params.foo} $1 $(date)`}
+	if err := h.Vars(map[string]string{"foo": "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if h.Exec != `echo bar bar $1 $(date)` {
+		t.Errorf("got exec '%s', expected 'echo bar bar $1 $(date)'", h.Exec)
+	}
+	if err := h.Validate(); err != nil {
+		t.Error(err)
+	}
+	if h.OnError != config.HOOK_FATAL {
+		t.Errorf("got on-error '%s', expected default %s", h.OnError, config.HOOK_FATAL)
+	}
+
+	invalid := []config.Hook{
+		{},
+		{Exec: "true", SQL: "SELECT 1"},
+		{Exec: "true", OnError: "ignore"},
+		{SQL: "SELECT 1", Timeout: "soon"},
+	}
+	for i, h := range invalid {
+		if err := h.Validate(); err == nil {
+			t.Errorf("invalid hook %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestRemoveTrx(t *testing.T) {
+	c := config.Stage{
+		Trx: []config.Trx{{Name: "load"}, {Name: "read"}},
+		Workload: []config.ClientGroup{
+			{Trx: []string{"load"}},
+			{Trx: []string{"load", "read"}},
+		},
+	}
+	got, ok := c.RemoveTrx("load")
+	if !ok {
+		t.Errorf("got false, expected true: read trx left")
+	}
+	expect := config.Stage{
+		Trx:      []config.Trx{{Name: "read"}},
+		Workload: []config.ClientGroup{{Trx: []string{"read"}}},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if len(c.Trx) != 2 || len(c.Workload[1].Trx) != 2 {
+		t.Errorf("original stage modified: %+v", c)
+	}
+
+	// Only trx assigned to a client group, other trx not run
+	c.Workload = c.Workload[0:1]
+	if _, ok := c.RemoveTrx("load"); ok {
+		t.Errorf("got true, expected false: no client groups left")
+	}
+
+	// Auto-allocated workload
+	c.Workload = nil
+	if _, ok := c.RemoveTrx("load"); !ok {
+		t.Errorf("got false, expected true: read trx left")
+	}
+	c.Trx = c.Trx[0:1]
+	if _, ok := c.RemoveTrx("load"); ok {
+		t.Errorf("got true, expected false: no trx left")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	// No files but server-name and min-version: TLS with system CA
+	c := config.TLS{ServerName: "db.example.com", MinVersion: "1.2"}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Set() {
+		t.Fatal("TLS not set, expected set")
+	}
+	tlsConfig, err := c.LoadTLS("proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ServerName != "db.example.com" {
+		t.Errorf("got ServerName %s, expected db.example.com", tlsConfig.ServerName)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("got MinVersion %x, expected %x", tlsConfig.MinVersion, tls.VersionTLS12)
+	}
+
+	c = config.TLS{MinVersion: "1.4"}
+	if err := c.Validate(); err == nil {
+		t.Error("min-version 1.4: no error, expected one")
+	}
+
+	// Nothing set = no TLS
+	c = config.TLS{}
+	if c.Set() {
+		t.Error("empty TLS set, expected not set")
+	}
+}
+
+func TestValidate_MySQL(t *testing.T) {
+	c := config.MySQL{Socket: "/tmp/mysql.sock", Pipe: "MySQL"}
+	if err := c.Validate(); err == nil {
+		t.Error("socket and pipe: no error, expected one")
+	}
+	c = config.MySQL{Pipe: "MySQL"}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	c = config.MySQL{Compress: "zstd"}
+	if err := c.Validate(); err == nil {
+		t.Error("compress zstd: no error, expected one")
+	}
+	b := true
+	c = config.MySQL{Compress: config.COMPRESS_ZLIB, TLS: config.TLS{SkipVerify: &b}}
+	if err := c.Validate(); err == nil {
+		t.Error("compress and tls: no error, expected one")
+	}
+	c = config.MySQL{Compress: config.COMPRESS_ZLIB, Hostname: "db.abd6b.us-east-1.rds.amazonaws.com:3306"}
+	if err := c.Validate(); err == nil {
+		t.Error("compress and RDS auto TLS: no error, expected one")
+	}
+	c = config.MySQL{Compress: config.COMPRESS_ZLIB, Hostname: "db.abd6b.us-east-1.rds.amazonaws.com", DisableAutoTLS: &b}
+	if err := c.Validate(); err != nil {
+		t.Errorf("compress and RDS with disable-auto-tls: %s", err)
+	}
+
+	c = config.MySQL{Protocol: config.PROTOCOL_X, Socket: "/tmp/mysqlx.sock"}
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+	c = config.MySQL{Protocol: config.PROTOCOL_X, Compress: config.COMPRESS_ZLIB}
+	if err := c.Validate(); err == nil {
+		t.Error("protocol x and compress: no error, expected one")
+	}
+	c = config.MySQL{Protocol: config.PROTOCOL_X, Flavor: config.FLAVOR_VITESS}
+	if err := c.Validate(); err == nil {
+		t.Error("protocol x and flavor vitess: no error, expected one")
+	}
+	c = config.MySQL{Protocol: "http"}
+	if err := c.Validate(); err == nil {
+		t.Error("protocol http: no error, expected one")
+	}
+}
+
+func TestValidate_Targets(t *testing.T) {
+	stage := func(target string) config.Stage {
+		return config.Stage{
+			Name: "test",
+			MySQL: config.MySQL{
+				Hostname: "primary",
+				Username: "bench",
+			},
+			Targets: map[string]config.MySQL{
+				"replica": {Hostname: "replica"},
+			},
+			Trx: []config.Trx{
+				{File: "../test/trx/001.sql"},
+			},
+			Workload: []config.ClientGroup{
+				{Target: target},
+			},
+		}
+	}
+
+	c := stage("replica")
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expect := config.MySQL{Hostname: "replica", Username: "bench"}
+	if diff := deep.Equal(c.Targets["replica"], expect); diff != nil {
+		t.Error(diff)
+	}
+
+	c = stage("other")
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "not defined in test.targets") {
+		t.Errorf("got error '%v', expected undefined target error", err)
+	}
+}
+
+func TestComputeTarget(t *testing.T) {
+	c := config.Stage{
+		Name: "test",
+		MySQL: config.MySQL{
+			Hostname: "primary",
+			Username: "bench",
+		},
+		Targets: map[string]config.MySQL{
+			"region_a": {Hostname: "a"},
+			"region_b": {Hostname: "b"},
+		},
+		Compute: config.Compute{
+			Instances: "4",
+			Targets:   []string{"region_a", "region_b"},
+		},
+		Trx: []config.Trx{
+			{File: "../test/trx/001.sql"},
+		},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []string{"region_a", "region_b", "region_a", "region_b"} {
+		got := c.ComputeTarget(uint(i + 1))
+		if got.Target != expect || got.MySQL.Hostname != expect[len(expect)-1:] || got.MySQL.Username != "bench" {
+			t.Errorf("instance %d: got target %s, mysql %+v; expected target %s", i+1, got.Target, got.MySQL, expect)
+		}
+	}
+	if c.Target != "" || c.MySQL.Hostname != "primary" {
+		t.Errorf("ComputeTarget changed the stage: target %s, mysql %+v", c.Target, c.MySQL)
+	}
+
+	c.Compute.Targets = []string{"region_c"}
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "not defined in test.targets") {
+		t.Errorf("got error '%v', expected undefined target error", err)
+	}
+}
+
+func TestValidate_Weights(t *testing.T) {
+	trx := []config.Trx{{Name: "a"}, {Name: "b"}}
+	valid := config.ClientGroup{Trx: []string{"a", "b"}, Weights: []string{"95", "5"}}
+	if err := valid.Validate(trx); err != nil {
+		t.Error(err)
+	}
+	invalid := []config.ClientGroup{
+		{Trx: []string{"a", "b"}, Weights: []string{"95"}},
+		{Trx: []string{"a", "b"}, Weights: []string{"0", "0"}},
+		{Trx: []string{"a", "b"}, Weights: []string{"95", "x"}},
+	}
+	for i, cg := range invalid {
+		if err := cg.Validate(trx); err == nil {
+			t.Errorf("invalid weights %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	tags := config.Tags{Enable: []string{"a"}, Disable: []string{"b"}}
+	if err := tags.Validate(); err != nil {
+		t.Error(err)
+	}
+	keep := map[string]bool{
+		"":    true, // untagged
+		"a":   true,
+		"b":   false,
+		"c":   false, // not enabled
+		"a b": false, // disable wins
+	}
+	for s, expect := range keep {
+		if got := tags.Keep(strings.Fields(s)); got != expect {
+			t.Errorf("Keep(%s) = %t, expected %t", s, got, expect)
+		}
+	}
+
+	invalid := []config.Tags{
+		{Enable: []string{""}},
+		{Disable: []string{""}},
+		{Enable: []string{"a"}, Disable: []string{"a"}},
+	}
+	for i, tags := range invalid {
+		if err := tags.Validate(); err == nil {
+			t.Errorf("invalid tags %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestValidate_DDL(t *testing.T) {
+	ddl := config.DDL{SQL: "ALTER TABLE t ADD INDEX (c)"}
+	if err := ddl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ddl.Delay != "10s" || ddl.After != "10s" {
+		t.Errorf("got delay %s and after %s, expected default 10s", ddl.Delay, ddl.After)
+	}
+	invalid := []config.DDL{
+		{},
+		{SQL: "ALTER TABLE t ADD INDEX (c)", Delay: "x"},
+		{SQL: "ALTER TABLE t ADD INDEX (c)", After: "-1s"},
+	}
+	for i, ddl := range invalid {
+		if err := ddl.Validate(); err == nil {
+			t.Errorf("invalid ddl %d: no error, expected one", i)
+		}
+	}
+
+	// DDL requires 1 local compute instance, like load
+	stage := config.Stage{
+		Name:    "ddl",
+		DDL:     &config.DDL{SQL: "ALTER TABLE t ADD INDEX (c)"},
+		Trx:     []config.Trx{{File: "../test/trx/001.sql"}},
+		Compute: config.Compute{Instances: "2"},
+	}
+	if err := stage.Validate(); err == nil {
+		t.Errorf("ddl with 2 compute instances: no error, expected one")
+	}
+}
+
+func TestValidate_Exit(t *testing.T) {
+	exit := config.Exit{Runtime: "1h", Iter: "1000"}
+	if err := exit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if exit.When != config.EXIT_ANY {
+		t.Errorf("got when %s, expected default %s", exit.When, config.EXIT_ANY)
+	}
+	invalid := []config.Exit{
+		{},
+		{When: "x", Iter: "1"},
+		{Runtime: "x"},
+		{Rows: "-1"},
+	}
+	for i, exit := range invalid {
+		if err := exit.Validate(); err == nil {
+			t.Errorf("invalid exit %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestValidate_StartAfter(t *testing.T) {
+	trx := []config.Trx{{Name: "a"}}
+	for _, v := range []string{"", "0s", "5m"} {
+		cg := config.ClientGroup{Trx: []string{"a"}, StartAfter: v}
+		if err := cg.Validate(trx); err != nil {
+			t.Errorf("start-after %q: %s", v, err)
+		}
+	}
+	for _, v := range []string{"5", "-1s", "x"} {
+		cg := config.ClientGroup{Trx: []string{"a"}, StartAfter: v}
+		if err := cg.Validate(trx); err == nil {
+			t.Errorf("start-after %q: no error, expected one", v)
+		}
+	}
+}
+
+func TestValidate_Compute(t *testing.T) {
+	c := config.Compute{}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.HeartbeatTimeout != "5s" || c.OnLost != config.LOST_CONTINUE {
+		t.Errorf("got heartbeat-timeout %s and on-lost %s, expected defaults 5s and %s", c.HeartbeatTimeout, c.OnLost, config.LOST_CONTINUE)
+	}
+	if c.MaxCPU != "90" || c.MaxGCPause != "5" || c.OnClientBound != config.BOUND_WARN {
+		t.Errorf("got max-cpu %s, max-gc-pause %s, and on-client-bound %s, expected defaults 90, 5, and %s", c.MaxCPU, c.MaxGCPause, c.OnClientBound, config.BOUND_WARN)
+	}
+	if c.Share() {
+		t.Error("Share is true, expected false by default")
+	}
+	c = config.Compute{OnLost: config.LOST_REASSIGN}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Share() {
+		t.Error("Share is false with on-lost reassign, expected true")
+	}
+	invalid := []config.Compute{
+		{OnLost: "x"},
+		{HeartbeatTimeout: "0"},
+		{HeartbeatTimeout: "x"},
+		{MaxCPU: "101"},
+		{MaxCPU: "x"},
+		{MaxGCPause: "-1"},
+		{OnClientBound: "x"},
+	}
+	for i, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("invalid compute %d: no error, expected one", i)
+		}
+	}
+}
@@ -5,19 +5,57 @@ package config
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	human "github.com/dustin/go-humanize"
 
 	"github.com/square/finch"
 )
 
-// Base represents a base config file: _all.yaml. If it exists, it applies to
-// all stage config files in the directory.
+// Base represents a base config file: _all.yaml, or a file included by
+// stage.base. If _all.yaml exists, it applies to all stage config files in the
+// directory. A base file can include another base file (base), which it overrides.
 type Base struct {
-	MySQL  MySQL             `yaml:"mysql,omitempty"`
-	Params map[string]string `yaml:"params,omitempty"`
-	Stats  Stats             `yaml:"stats,omitempty"`
+	Base    string            `yaml:"base,omitempty"`
+	MySQL   MySQL             `yaml:"mysql,omitempty"`
+	Params  map[string]string `yaml:"params,omitempty"`
+	Stats   Stats             `yaml:"stats,omitempty"`
+	Targets map[string]MySQL  `yaml:"targets,omitempty"`
+}
+
+// With sets values from def that are not set in c, so c overrides def.
+func (c *Base) With(def Base) {
+	if len(def.Params) > 0 {
+		if c.Params == nil {
+			c.Params = map[string]string{}
+		}
+		for k, v := range def.Params {
+			if _, ok := c.Params[k]; !ok {
+				c.Params[k] = v
+			}
+		}
+	}
+	c.MySQL.With(def.MySQL)
+	c.Stats.With(def.Stats)
+	if len(def.Targets) > 0 {
+		if c.Targets == nil {
+			c.Targets = map[string]MySQL{}
+		}
+		for name, t := range def.Targets {
+			if _, ok := c.Targets[name]; !ok {
+				c.Targets[name] = t
+			}
+		}
+	}
 }
 
 func (c *Base) Validate() error {
@@ -33,26 +71,50 @@ func (c *Base) Validate() error {
 // Stage represents one stage config file. The stage config overwrites any base
 // config (_all.yaml).
 type Stage struct {
-	Compute  Compute           `yaml:"compute,omitempty"`
-	Disable  bool              `yaml:"disable"`
-	File     string            `yaml:"-"`
-	Id       string            `yaml:"-"`
-	Name     string            `yaml:"name"`
-	MySQL    MySQL             `yaml:"mysql,omitempty"`
-	N        uint              `yaml:"-"`
-	Params   map[string]string `yaml:"params,omitempty"`
-	QPS      string            `yaml:"qps,omitempty"` // uint
-	Runtime  string            `yaml:"runtime,omitempty"`
-	Stats    Stats             `yaml:"stats,omitempty"`
-	TPS      string            `yaml:"tps,omitempty"` // uint
-	Test     bool              `yaml:"-"`
-	Trx      []Trx             `yaml:"trx,omitempty"`
-	Workload []ClientGroup     `yaml:"workload,omitempty"`
+	After        []Hook            `yaml:"after,omitempty"`
+	Base         string            `yaml:"base,omitempty"`
+	Before       []Hook            `yaml:"before,omitempty"`
+	Checkpoint   string            `yaml:"checkpoint,omitempty"`
+	Checksums    map[string]string `yaml:"-"` // DataFiles SHA-256 checksums for remotes
+	Compute      Compute           `yaml:"compute,omitempty"`
+	DDL          *DDL              `yaml:"ddl,omitempty"`
+	Disable      bool              `yaml:"disable"`
+	Exit         *Exit             `yaml:"exit,omitempty"`
+	Failover     *Failover         `yaml:"failover,omitempty"`
+	File         string            `yaml:"-"`
+	GroupRepl    *GroupRepl        `yaml:"group-replication,omitempty"`
+	Handoff      bool              `yaml:"handoff,omitempty"`
+	Id           string            `yaml:"-"`
+	Instance     uint              `yaml:"-"` // compute instance number (1-indexed) if distributed
+	Load         *TableLoad        `yaml:"load,omitempty"`
+	Name         string            `yaml:"name"`
+	MySQL        MySQL             `yaml:"mysql,omitempty"`
+	N            uint              `yaml:"-"`
+	Params       map[string]string `yaml:"params,omitempty"`
+	PinClients   bool              `yaml:"pin-clients,omitempty"`
+	Preconnect   bool              `yaml:"preconnect,omitempty"`
+	PreconnRate  string            `yaml:"preconnect-rate,omitempty"` // uint
+	Progress     string            `yaml:"progress,omitempty"`
+	QPS          string            `yaml:"qps,omitempty"` // uint
+	QueryComment bool              `yaml:"query-comment,omitempty"`
+	QueryHint    string            `yaml:"query-hint,omitempty"`
+	RunId        string            `yaml:"-"` // same for all stages in a run; set by server
+	Runtime      string            `yaml:"runtime,omitempty"`
+	SaveLimits   *SaveLimits       `yaml:"save-limits,omitempty"`
+	SkipIf       string            `yaml:"skip-if,omitempty"`
+	Stats        Stats             `yaml:"stats,omitempty"`
+	Tags         Tags              `yaml:"tags,omitempty"`
+	Target       string            `yaml:"-"` // compute.targets assigned to this instance
+	Targets      map[string]MySQL  `yaml:"targets,omitempty"`
+	TPS          string            `yaml:"tps,omitempty"` // uint
+	Test         bool              `yaml:"-"`
+	Trx          []Trx             `yaml:"trx,omitempty"`
+	Workload     []ClientGroup     `yaml:"workload,omitempty"`
 }
 
 func (c *Stage) With(b Base) {
-	// Apply base config to stage before reading stage config file. This means
-	// any base config values are overwritten if set in the stage config file.
+	// Apply base config to stage after reading stage config file: only values
+	// not set in the stage config file are set from the base config.
 	if len(b.Params) > 0 {
 		if c.Params == nil {
 			c.Params = map[string]string{}
@@ -65,20 +127,18 @@ func (c *Stage) With(b Base) {
 	}
 
 	c.MySQL.With(b.MySQL)
+	c.Stats.With(b.Stats)
 
-	// Stats has a map, so copy in all fields manually
-	c.Stats.Disable = setBool(c.Stats.Disable, b.Stats.Disable)
-	c.Stats.Freq = b.Stats.Freq
-	if len(b.Stats.Report) > 0 {
-		c.Stats.Report = map[string]map[string]string{}
-		for r := range b.Stats.Report {
-			c.Stats.Report[r] = map[string]string{}
-			for k, v := range b.Stats.Report[r] {
-				c.Stats.Report[r][k] = v
+	if len(b.Targets) > 0 {
+		if c.Targets == nil {
+			c.Targets = map[string]MySQL{}
+		}
+		for name, t := range b.Targets {
+			if _, ok := c.Targets[name]; !ok {
+				c.Targets[name] = t
 			}
 		}
 	}
-
 }
 
 func (c *Stage) CommandLine(dsn, db string) {
@@ -104,6 +164,24 @@ func (c *Stage) CommandLine(dsn, db string) {
 	}
 }
 
+// CommandLineTags adds --enable-tag and --disable-tag to stage.tags. It's
+// called after Load because Validate copies stage.tags to each trx.
+func (c *Stage) CommandLineTags(enable, disable []string) error {
+	if len(enable) == 0 && len(disable) == 0 {
+		return nil
+	}
+	finch.Debug("--enable-tag %v --disable-tag %v", enable, disable)
+	c.Tags.Enable = append(c.Tags.Enable, enable...)
+	c.Tags.Disable = append(c.Tags.Disable, disable...)
+	if err := c.Tags.Validate(); err != nil {
+		return err
+	}
+	for i := range c.Trx {
+		c.Trx[i].Tags = c.Tags
+	}
+	return nil
+}
+
 func (c *Stage) Vars() error {
 	var err error
 
@@ -124,6 +202,10 @@ func (c *Stage) Vars() error {
 	if err != nil {
 		return err
 	}
+	c.Progress, err = Vars(c.Progress, c.Params, false)
+	if err != nil {
+		return fmt.Errorf("in progress: %s", err)
+	}
 	c.QPS, err = Vars(c.QPS, c.Params, true)
 	if err != nil {
 		return err
@@ -132,15 +214,75 @@ func (c *Stage) Vars() error {
 	if err != nil {
 		return err
 	}
+	c.PreconnRate, err = Vars(c.PreconnRate, c.Params, true)
+	if err != nil {
+		return fmt.Errorf("in preconnect-rate: %s", err)
+	}
+	c.SkipIf, err = Vars(c.SkipIf, c.Params, false)
+	if err != nil {
+		return fmt.Errorf("in skip-if: %s", err)
+	}
+	c.QueryHint, err = Vars(c.QueryHint, c.Params, false)
+	if err != nil {
+		return fmt.Errorf("in query-hint: %s", err)
+	}
+	c.Checkpoint, err = Vars(c.Checkpoint, c.Params, false)
+	if err != nil {
+		return fmt.Errorf("in checkpoint: %s", err)
+	}
 	if err := c.Compute.Vars(c.Params); err != nil {
 		return fmt.Errorf("in compute: %s", err)
 	}
+	for i := range c.Before {
+		if err := c.Before[i].Vars(c.Params); err != nil {
+			return fmt.Errorf("in before: %s", err)
+		}
+	}
+	for i := range c.After {
+		if err := c.After[i].Vars(c.Params); err != nil {
+			return fmt.Errorf("in after: %s", err)
+		}
+	}
 	if err := c.MySQL.Vars(c.Params); err != nil {
 		return fmt.Errorf("in mysql: %s", err)
 	}
+	for name, t := range c.Targets {
+		if err := t.Vars(c.Params); err != nil {
+			return fmt.Errorf("in targets.%s: %s", name, err)
+		}
+		c.Targets[name] = t
+	}
 	if err := c.Stats.Vars(c.Params); err != nil {
 		return fmt.Errorf("in stats: %s", err)
 	}
+	if err := c.Tags.Vars(c.Params); err != nil {
+		return fmt.Errorf("in tags: %s", err)
+	}
+	if c.Load != nil {
+		if err := c.Load.Vars(c.Params); err != nil {
+			return fmt.Errorf("in load: %s", err)
+		}
+	}
+	if c.DDL != nil {
+		if err := c.DDL.Vars(c.Params); err != nil {
+			return fmt.Errorf("in ddl: %s", err)
+		}
+	}
+	if c.Exit != nil {
+		if err := c.Exit.Vars(c.Params); err != nil {
+			return fmt.Errorf("in exit: %s", err)
+		}
+	}
+	if c.Failover != nil {
+		if err := c.Failover.Vars(c.Params); err != nil {
+			return fmt.Errorf("in failover: %s", err)
+		}
+	}
+	if c.SaveLimits != nil {
+		if err := c.SaveLimits.Vars(c.Params); err != nil {
+			return fmt.Errorf("in save-limits: %s", err)
+		}
+	}
 	for i := range c.Trx {
 		if err := c.Trx[i].Vars(c.Params); err != nil {
 			return fmt.Errorf("in trx: %s", err)
@@ -154,6 +296,67 @@ func (c *Stage) Vars() error {
 	return nil
 }
 
+// Compute vars are per compute instance: $compute.instance is the instance
+// number (1-indexed), and $compute.instances is the number of instances. Vars
+// leaves them as-is because they're not known until the server assigns each
+// instance, then the server calls ComputeVars for each instance.
+const (
+	COMPUTE_INSTANCE  = "compute.instance"
+	COMPUTE_INSTANCES = "compute.instances"
+)
+
+var reComputeVar = regexp.MustCompile(`\$\{?compute\.[\w-]*\}?`)
+
+// ComputeVars returns a copy of the stage with compute vars replaced for one
+// instance of n instances. The vars are also set in Params for trx files, which
+// are loaded on each compute instance. It returns an error for an unknown
+// compute var, like $compute.foo.
+func (c Stage) ComputeVars(instance, n uint) (Stage, error) {
+	bytes, err := json.Marshal(c) // deep copy, like sending to remotes
+	if err != nil {
+		return c, err
+	}
+	i, ns := strconv.FormatUint(uint64(instance), 10), strconv.FormatUint(uint64(n), 10)
+	r := strings.NewReplacer( // instances before instance because it's a prefix
+		"${"+COMPUTE_INSTANCES+"}", ns,
+		"$"+COMPUTE_INSTANCES, ns,
+		"${"+COMPUTE_INSTANCE+"}", i,
+		"$"+COMPUTE_INSTANCE, i,
+	)
+	js := r.Replace(string(bytes))
+	if v := reComputeVar.FindString(js); v != "" {
+		return c, fmt.Errorf("unknown compute var %s; valid vars are $%s and $%s", v, COMPUTE_INSTANCE, COMPUTE_INSTANCES)
+	}
+	var cp Stage
+	if err := json.Unmarshal([]byte(js), &cp); err != nil {
+		return c, err
+	}
+	if cp.Params == nil {
+		cp.Params = map[string]string{}
+	}
+	cp.Params[COMPUTE_INSTANCE] = i
+	cp.Params[COMPUTE_INSTANCES] = ns
+	return cp, nil
+}
+
+// ComputeTarget returns a copy of the stage with the target assigned to compute
+// instance number (1-indexed) by compute.targets: instances are assigned targets
+// in order, round-robin, and the target replaces the stage mysql config. Client
+// groups with a target (workload[].target) still use that target. If
+// compute.targets is not set, the stage is returned unchanged.
+func (c Stage) ComputeTarget(instance uint) Stage {
+	if len(c.Compute.Targets) == 0 || instance == 0 {
+		return c
+	}
+	c.Target = c.Compute.Targets[(instance-1)%uint(len(c.Compute.Targets))]
+	c.MySQL = c.Targets[c.Target] // validated
+	return c
+}
+
+// DEFAULT_PROGRESS is how often the stage prints the progress of exec groups
+// with known bounds (stage.progress).
+const DEFAULT_PROGRESS = "30s"
+
 func (c *Stage) Validate() error {
 	if c.Disable {
 		return nil
@@ -163,13 +366,26 @@ func (c *Stage) Validate() error {
 		c.Name = filepath.Base(c.File)
 	}
 
-	if len(c.Trx) == 0 {
+	if c.Load != nil {
+		if len(c.Trx) > 0 || len(c.Workload) > 0 {
+			return fmt.Errorf("stage %s has load and trx or workload; specify only load, or trx and workload", c.Name)
+		}
+		if err := c.Load.Validate(); err != nil {
+			return fmt.Errorf("%s.load: %s", c.Name, err)
+		}
+	} else if len(c.Trx) == 0 {
 		return fmt.Errorf("stage %s has zero trx files and is not disabled; specify at least 1 trx file or %s.disable = true", c.Name, c.Name)
 	}
 
+	if err := c.Tags.Validate(); err != nil {
+		return fmt.Errorf("%s.tags: %s", c.Name, err)
+	}
+
 	// Trx list: must validate before Workload because Workload reference trx by name
 	seen := map[string]string{}
 	for i := range c.Trx {
+		c.Trx[i].Tags = c.Tags // statement filter applied when trx file loaded
+
 		if c.Trx[i].File == "" {
 			return fmt.Errorf("no file specified for trx %d", i+1)
 		}
@@ -220,6 +436,11 @@ func (c *Stage) Validate() error {
 		if err := c.Workload[i].Validate(c.Trx); err != nil {
 			return err
 		}
+		if t := c.Workload[i].Target; t != "" {
+			if _, ok := c.Targets[t]; !ok {
+				return fmt.Errorf("%s.workload[%d].target: '%s' not defined in %s.targets", c.Name, i, t, c.Name)
+			}
+		}
 
 		if c.Workload[i].Group != "" {
 			if last, ok := names[c.Workload[i].Group]; !ok {
@@ -257,60 +478,679 @@ func (c *Stage) Validate() error {
 		return err
 	}
 
-	if err := parseInt(c.QPS); err != nil {
-		return fmt.Errorf("tps: '%s' is not an integer: %s", c.QPS, err)
+	// Progress: "0" disables
+	if c.Progress == "" {
+		c.Progress = DEFAULT_PROGRESS
+	} else if c.Progress != "0" {
+		if err := ValidFreq(c.Progress, "stage.progress"); err != nil {
+			return err
+		}
+	}
+
+	if c.Exit != nil {
+		if err := c.Exit.Validate(); err != nil {
+			return fmt.Errorf("%s.exit: %s", c.Name, err)
+		}
+	}
+
+	if c.SaveLimits != nil {
+		if err := c.SaveLimits.Validate(); err != nil {
+			return fmt.Errorf("%s.save-limits: %s", c.Name, err)
+		}
+	}
+
+	if c.Failover != nil {
+		if err := c.Failover.Validate(); err != nil {
+			return fmt.Errorf("%s.failover: %s", c.Name, err)
+		}
+	}
+
+	if c.GroupRepl != nil {
+		if c.MySQL.NotMySQL() || c.MySQL.Proxy() {
+			return fmt.Errorf("%s.group-replication does not work with mysql.flavor: %s", c.Name, c.MySQL.Flavor)
+		}
+		if True(c.GroupRepl.SpreadWrites) && c.MySQL.DSN != "" {
+			return fmt.Errorf("%s.group-replication.spread-writes does not work with mysql.dsn because members inherit mysql settings; use mysql.hostname", c.Name)
+		}
+	}
+
+	if err := parseInt(c.QPS); err != nil {
+		return fmt.Errorf("tps: '%s' is not an integer: %s", c.QPS, err)
+	}
+	if err := parseInt(c.TPS); err != nil {
+		return fmt.Errorf("tps: '%s' is not an integer: %s", c.TPS, err)
+	}
+	if err := parseInt(c.PreconnRate); err != nil {
+		return fmt.Errorf("preconnect-rate: '%s' is not an integer: %s", c.PreconnRate, err)
+	}
+
+	if err := c.MySQL.Validate(); err != nil {
+		return err
+	}
+
+	// Targets inherit stage mysql settings, like username and password, but
+	// not the connection address
+	def := c.MySQL
+	def.DSN, def.Hostname, def.Socket, def.Pipe = "", "", "", ""
+	for name, t := range c.Targets {
+		if name == "" {
+			return fmt.Errorf("%s.targets: empty target name", c.Name)
+		}
+		if t.DSN == "" && t.Hostname == "" && t.Socket == "" && t.Pipe == "" {
+			return fmt.Errorf("%s.targets.%s: dsn, hostname, socket, or pipe is required", c.Name, name)
+		}
+		t.With(def)
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("%s.targets.%s: %s", c.Name, name, err)
+		}
+		c.Targets[name] = t
+	}
+
+	if err := c.Compute.Validate(); err != nil {
+		return err
+	}
+	for i, t := range c.Compute.Targets {
+		if _, ok := c.Targets[t]; !ok {
+			return fmt.Errorf("%s.compute.targets[%d]: '%s' not defined in %s.targets", c.Name, i, t, c.Name)
+		}
+	}
+	if c.Load != nil && (c.Compute.Instances != "1" || c.Compute.DisableLocal) {
+		return fmt.Errorf("%s.load requires 1 local compute instance because each instance would load the same rows", c.Name)
+	}
+
+	if c.DDL != nil {
+		if c.Load != nil {
+			return fmt.Errorf("stage %s has load and ddl; specify only one", c.Name)
+		}
+		if err := c.DDL.Validate(); err != nil {
+			return fmt.Errorf("%s.ddl: %s", c.Name, err)
+		}
+		if c.Compute.Instances != "1" || c.Compute.DisableLocal {
+			return fmt.Errorf("%s.ddl requires 1 local compute instance because each instance would execute the DDL", c.Name)
+		}
+	}
+
+	for i := range c.Before {
+		if err := c.Before[i].Validate(); err != nil {
+			return fmt.Errorf("%s.before[%d]: %s", c.Name, i, err)
+		}
+	}
+	for i := range c.After {
+		if err := c.After[i].Validate(); err != nil {
+			return fmt.Errorf("%s.after[%d]: %s", c.Name, i, err)
+		}
+	}
+
+	if err := c.Stats.Validate(); err != nil {
+		return err
+	}
+	if True(c.Stats.TiDBStatus) && c.MySQL.Flavor != FLAVOR_TIDB {
+		return fmt.Errorf("%s.stats.tidb-status requires mysql.flavor: %s", c.Name, FLAVOR_TIDB)
+	}
+	if c.MySQL.NotMySQL() && c.Load != nil {
+		return fmt.Errorf("%s.load does not work with mysql.flavor: %s", c.Name, c.MySQL.Flavor)
+	}
+	if c.MySQL.Flavor == FLAVOR_SQLITE {
+		for i := range c.Workload {
+			if c.Workload[i].Db != "" {
+				return fmt.Errorf("%s.workload[%d].db does not work with mysql.flavor: %s because SQLite has no USE; set mysql.dsn", c.Name, i, FLAVOR_SQLITE)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RemoveTrx returns a copy of the stage without the named trx, which is also
+// removed from workload client groups. A client group with explicit trx is
+// removed if it has no trx left. It returns false if the stage has no trx or
+// client groups left, so it has nothing to run. The stage must be validated first.
+func (c Stage) RemoveTrx(name string) (Stage, bool) {
+	trx := make([]Trx, 0, len(c.Trx))
+	for _, t := range c.Trx {
+		if t.Name != name {
+			trx = append(trx, t)
+		}
+	}
+	c.Trx = trx
+
+	if len(c.Workload) == 0 {
+		return c, len(c.Trx) > 0 // auto-allocated, so all trx left
+	}
+	workload := make([]ClientGroup, 0, len(c.Workload))
+	for _, cg := range c.Workload {
+		if len(cg.Trx) == 0 {
+			workload = append(workload, cg)
+			continue
+		}
+		names := make([]string, 0, len(cg.Trx))
+		for _, t := range cg.Trx {
+			if t != name {
+				names = append(names, t)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		cg.Trx = names
+		workload = append(workload, cg)
+	}
+	c.Workload = workload
+	return c, len(c.Trx) > 0 && len(c.Workload) > 0
+}
+
+// --------------------------------------------------------------------------
+
+const (
+	LOST_FAIL     = "fail"
+	LOST_CONTINUE = "continue"
+	LOST_REASSIGN = "reassign"
+)
+
+const (
+	BOUND_WARN  = "warn"
+	BOUND_ABORT = "abort"
+)
+
+// DataFiles returns the unique data files used by data generators, like the
+// list generator: trx[].data[].params.file. Remote compute instances fetch
+// these files from the server.
+func (c Stage) DataFiles() []string {
+	seen := map[string]bool{}
+	files := []string{}
+	for _, trx := range c.Trx {
+		for _, d := range trx.Data {
+			file := d.Params["file"]
+			if file == "" || seen[file] {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+type Compute struct {
+	DisableLocal     bool     `yaml:"disable-local,omitempty"`
+	Elastic          bool     `yaml:"elastic,omitempty"`           // instances join and leave while running
+	HeartbeatTimeout string   `yaml:"heartbeat-timeout,omitempty"` // duration
+	Instances        string   `yaml:"instances,omitempty"`         // uint
+	MaxCPU           string   `yaml:"max-cpu,omitempty"`           // percent of CPUs used by Finch
+	MaxGCPause       string   `yaml:"max-gc-pause,omitempty"`      // percent of time paused for GC
+	OnClientBound    string   `yaml:"on-client-bound,omitempty"`   // BOUND_WARN (default) or BOUND_ABORT
+	OnLost           string   `yaml:"on-lost,omitempty"`           // LOST_CONTINUE (default), LOST_FAIL, or LOST_REASSIGN
+	Targets          []string `yaml:"targets,omitempty"`           // stage.targets assigned to instances round-robin
+}
+
+func (c *Compute) Vars(params map[string]string) error {
+	var err error
+	c.Instances, err = Vars(c.Instances, params, true)
+	if err != nil {
+		return err
+	}
+	c.MaxCPU, err = Vars(c.MaxCPU, params, false)
+	if err != nil {
+		return err
+	}
+	c.MaxGCPause, err = Vars(c.MaxGCPause, params, false)
+	if err != nil {
+		return err
+	}
+	for i := range c.Targets {
+		c.Targets[i], err = Vars(c.Targets[i], params, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compute) Validate() error {
+	if err := parseInt(c.Instances); err != nil {
+		return fmt.Errorf("instances: '%s' is not an integer: %s", c.Instances, err)
+	}
+	if c.Instances == "" {
+		c.Instances = "1"
+	}
+	if err := ValidFreq(c.HeartbeatTimeout, "compute.heartbeat-timeout"); err != nil {
+		return err
+	}
+	if c.HeartbeatTimeout == "" {
+		c.HeartbeatTimeout = "5s"
+	}
+	if c.MaxCPU == "" {
+		c.MaxCPU = "90"
+	}
+	if err := parsePercent(c.MaxCPU); err != nil {
+		return fmt.Errorf("max-cpu: %s", err)
+	}
+	if c.MaxGCPause == "" {
+		c.MaxGCPause = "5"
+	}
+	if err := parsePercent(c.MaxGCPause); err != nil {
+		return fmt.Errorf("max-gc-pause: %s", err)
+	}
+	switch c.OnClientBound {
+	case "":
+		c.OnClientBound = BOUND_WARN
+	case BOUND_WARN, BOUND_ABORT:
+	default:
+		return fmt.Errorf("invalid on-client-bound: %s: valid values are %s and %s", c.OnClientBound, BOUND_WARN, BOUND_ABORT)
+	}
+	switch c.OnLost {
+	case "":
+		c.OnLost = LOST_CONTINUE
+	case LOST_FAIL, LOST_CONTINUE, LOST_REASSIGN:
+	default:
+		return fmt.Errorf("invalid on-lost: %s: valid values are %s, %s, and %s", c.OnLost, LOST_CONTINUE, LOST_FAIL, LOST_REASSIGN)
+	}
+	return nil
+}
+
+// Share returns true if compute instances share clients: each instance runs
+// a share of the clients that the server rebalances when instances join or
+// leave (elastic) or are lost (on-lost: reassign).
+func (c Compute) Share() bool {
+	return c.Elastic || c.OnLost == LOST_REASSIGN
+}
+
+// --------------------------------------------------------------------------
+
+const (
+	HOOK_FATAL = "fatal"
+	HOOK_WARN  = "warn"
+)
+
+// Hook is a shell command (exec) or SQL statement (sql) that runs before or
+// after a stage: stage.before and stage.after.
+type Hook struct {
+	Exec    string `yaml:"exec,omitempty"`
+	SQL     string `yaml:"sql,omitempty"`
+	OnError string `yaml:"on-error,omitempty"` // HOOK_FATAL (default) or HOOK_WARN
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// reParamVar matches only $params.foo and ${params.foo}, and compute vars.
+var reParamVar = regexp.MustCompile(`\$\{?((?:params|compute)\.[\w-]+)\}?`)
+
+// ParamVars is like Vars but replaces only $params.foo and ${params.foo}, and
+// compute vars ($compute.instance), not $sys or environment variables, so other $ in the string are not changed, like
+// shell variables ($1) in exec hooks or JSON paths ('$.a') in SQL. If numbers
+// is true, a param value that's a human-readable number, like 100k, is replaced
+// with the machine number, like 100000.
+func ParamVars(s string, params map[string]string, numbers bool) (string, error) {
+	var err error
+	s = reParamVar.ReplaceAllStringFunc(s, func(v string) string {
+		p := reParamVar.FindStringSubmatch(v)[1]
+		val, verr := Vars("$"+p, params, false)
+		if verr == nil && numbers && reHumanNumber.FindString(val) == val {
+			val, verr = Vars(val, nil, true)
+		}
+		if verr != nil && err == nil {
+			err = verr
+		}
+		return val
+	})
+	return s, err
+}
+
+func (c *Hook) Vars(params map[string]string) error {
+	var err error
+	c.Exec, err = ParamVars(c.Exec, params, false) // not shell vars like $1 and $(date)
+	if err != nil {
+		return err
+	}
+	c.SQL, err = Vars(c.SQL, params, false)
+	if err != nil {
+		return err
+	}
+	c.Timeout, err = Vars(c.Timeout, params, false)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Hook) Validate() error {
+	if (c.Exec == "") == (c.SQL == "") {
+		return fmt.Errorf("specify either exec or sql")
+	}
+	switch c.OnError {
+	case "":
+		c.OnError = HOOK_FATAL
+	case HOOK_FATAL, HOOK_WARN:
+	default:
+		return fmt.Errorf("invalid on-error: %s: valid values are %s and %s", c.OnError, HOOK_FATAL, HOOK_WARN)
+	}
+	if err := ValidFreq(c.Timeout, "timeout"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+// TableLoad is stage.load: a parallel data load that Finch plans automatically
+// (see package load) instead of trx files and workload.
+type TableLoad struct {
+	Table          string          `yaml:"table"`
+	Rows           string          `yaml:"rows"`              // uint
+	Clients        string          `yaml:"clients,omitempty"` // uint
+	Batch          string          `yaml:"batch,omitempty"`   // uint
+	Begin          string          `yaml:"begin,omitempty"`   // int
+	Columns        map[string]Data `yaml:"columns,omitempty"` // keyed on column name
+	RebuildIndexes bool            `yaml:"rebuild-indexes,omitempty"`
+}
+
+func (c *TableLoad) Vars(params map[string]string) error {
+	var err error
+	c.Table, err = Vars(c.Table, params, false)
+	if err != nil {
+		return err
+	}
+	c.Rows, err = Vars(c.Rows, params, true)
+	if err != nil {
+		return err
+	}
+	c.Clients, err = Vars(c.Clients, params, true)
+	if err != nil {
+		return err
+	}
+	c.Batch, err = Vars(c.Batch, params, true)
+	if err != nil {
+		return err
+	}
+	c.Begin, err = Vars(c.Begin, params, true)
+	if err != nil {
+		return err
+	}
+	for k := range c.Columns {
+		d := c.Columns[k]
+		if err := d.Vars(params); err != nil {
+			return err
+		}
+		c.Columns[k] = d
+	}
+	return nil
+}
+
+func (c *TableLoad) Validate() error {
+	if c.Table == "" {
+		return fmt.Errorf("table not set")
+	}
+	if n, err := strconv.ParseUint(c.Rows, 10, 64); err != nil || n == 0 {
+		return fmt.Errorf("rows: '%s' is not an integer > 0", c.Rows)
+	}
+	if err := parseInt(c.Clients); err != nil {
+		return fmt.Errorf("clients: '%s' is not an integer: %s", c.Clients, err)
+	}
+	if c.Clients == "" || c.Clients == "0" {
+		c.Clients = "1"
+	}
+	if err := parseInt(c.Batch); err != nil {
+		return fmt.Errorf("batch: '%s' is not an integer: %s", c.Batch, err)
+	}
+	if c.Begin != "" {
+		if _, err := strconv.ParseInt(c.Begin, 10, 64); err != nil {
+			return fmt.Errorf("begin: '%s' is not an integer: %s", c.Begin, err)
+		}
+	}
+	for col, d := range c.Columns {
+		if d.Generator == "" {
+			return fmt.Errorf("columns[%s].generator not set", col)
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+// DDL is stage.ddl: an online DDL benchmark. The stage trx and workload run as
+// the foreground workload while Finch executes the DDL statement once in the
+// background, which measures the DDL duration and its impact on the workload.
+type DDL struct {
+	SQL   string `yaml:"sql"`
+	Delay string `yaml:"delay,omitempty"` // duration: run workload before DDL
+	After string `yaml:"after,omitempty"` // duration: run workload after DDL
+}
+
+func (c *DDL) Vars(params map[string]string) error {
+	var err error
+	c.SQL, err = Vars(c.SQL, params, false)
+	if err != nil {
+		return err
+	}
+	c.Delay, err = Vars(c.Delay, params, false)
+	if err != nil {
+		return err
+	}
+	c.After, err = Vars(c.After, params, false)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *DDL) Validate() error {
+	if c.SQL == "" {
+		return fmt.Errorf("sql not set")
+	}
+	if c.Delay == "" {
+		c.Delay = "10s"
+	}
+	if d, err := time.ParseDuration(c.Delay); err != nil || d < 0 {
+		return fmt.Errorf("delay: '%s' is not a duration >= 0", c.Delay)
+	}
+	if c.After == "" {
+		c.After = "10s"
+	}
+	if d, err := time.ParseDuration(c.After); err != nil || d < 0 {
+		return fmt.Errorf("after: '%s' is not a duration >= 0", c.After)
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+
+const (
+	EXIT_ANY = "any"
+	EXIT_ALL = "all"
+)
+
+// Exit is stage.exit: stage exit conditions for all clients in the stage. The
+// stage stops when any (default) or all of runtime, iter, and rows are reached.
+// The error budget stops the stage when exhausted regardless of when.
+type Exit struct {
+	When    string `yaml:"when,omitempty"`    // EXIT_ANY or EXIT_ALL
+	Runtime string `yaml:"runtime,omitempty"` // duration
+	Iter    string `yaml:"iter,omitempty"`    // uint
+	Rows    string `yaml:"rows,omitempty"`    // uint
+	Errors  string `yaml:"errors,omitempty"`  // uint
+}
+
+func (c *Exit) Vars(params map[string]string) error {
+	var err error
+	c.When, err = Vars(c.When, params, false)
+	if err != nil {
+		return err
+	}
+	c.Runtime, err = Vars(c.Runtime, params, false)
+	if err != nil {
+		return err
+	}
+	c.Iter, err = Vars(c.Iter, params, true)
+	if err != nil {
+		return err
+	}
+	c.Rows, err = Vars(c.Rows, params, true)
+	if err != nil {
+		return err
+	}
+	c.Errors, err = Vars(c.Errors, params, true)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SaveLimits is stage.save-limits: bounds on SELECT results that clients scan
+// to save columns (-- save-columns), so an accidental unbounded SELECT doesn't
+// run the compute out of memory. MaxRows is per statement execution: clients
+// stop scanning after that many rows (the rest are discarded). MaxMemory is per
+// client: the total size of saved column values. If it's exceeded, the saved
+// values are freed and the statement returns an error.
+type SaveLimits struct {
+	MaxRows   string `yaml:"max-rows,omitempty"`   // uint
+	MaxMemory string `yaml:"max-memory,omitempty"` // bytes, like 64MB
+}
+
+// DEFAULT_SAVE_MAX_MEMORY is stage.save-limits.max-memory if not set, including
+// if stage.save-limits is not set.
+const DEFAULT_SAVE_MAX_MEMORY = "64MB"
+
+func (c *SaveLimits) Vars(params map[string]string) error {
+	var err error
+	c.MaxRows, err = Vars(c.MaxRows, params, true)
+	if err != nil {
+		return err
+	}
+	c.MaxMemory, err = Vars(c.MaxMemory, params, false)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *SaveLimits) Validate() error {
+	if err := parseInt(c.MaxRows); err != nil {
+		return fmt.Errorf("max-rows: '%s' is not an integer: %s", c.MaxRows, err)
 	}
-	if err := parseInt(c.TPS); err != nil {
-		return fmt.Errorf("tps: '%s' is not an integer: %s", c.TPS, err)
+	if c.MaxMemory == "" {
+		c.MaxMemory = DEFAULT_SAVE_MAX_MEMORY
+	} else if _, err := human.ParseBytes(c.MaxMemory); err != nil {
+		return fmt.Errorf("max-memory: '%s' is not a size: %s", c.MaxMemory, err)
 	}
+	return nil
+}
 
-	if err := c.MySQL.Validate(); err != nil {
-		return err
+func (c *Exit) Validate() error {
+	switch c.When {
+	case "":
+		c.When = EXIT_ANY
+	case EXIT_ANY, EXIT_ALL:
+	default:
+		return fmt.Errorf("invalid when: %s: valid values are: %s, %s", c.When, EXIT_ANY, EXIT_ALL)
 	}
-
-	if err := c.Compute.Validate(); err != nil {
-		return err
+	if c.Runtime == "" && c.Iter == "" && c.Rows == "" && c.Errors == "" {
+		return fmt.Errorf("no exit condition: set at least one of runtime, iter, rows, or errors")
 	}
-
-	if err := c.Stats.Validate(); err != nil {
+	if err := ValidFreq(c.Runtime, "stage.exit.runtime"); err != nil {
 		return err
 	}
-
+	if err := parseInt(c.Iter); err != nil {
+		return fmt.Errorf("iter: '%s' is not an integer: %s", c.Iter, err)
+	}
+	if c.Rows != "" {
+		if _, err := strconv.ParseUint(c.Rows, 10, 64); err != nil {
+			return fmt.Errorf("rows: '%s' is not an integer: %s", c.Rows, err)
+		}
+	}
+	if err := parseInt(c.Errors); err != nil {
+		return fmt.Errorf("errors: '%s' is not an integer: %s", c.Errors, err)
+	}
 	return nil
 }
 
 // --------------------------------------------------------------------------
 
-type Compute struct {
-	DisableLocal bool   `yaml:"disable-local,omitempty"`
-	Instances    string `yaml:"instances,omitempty"` // uint
+const (
+	FAILOVER_RECONNECT = "reconnect"
+	FAILOVER_IGNORE    = "ignore"
+
+	DEFAULT_FAILOVER_DNS_FREQ       = "1s"
+	DEFAULT_FAILOVER_RECONNECT_WAIT = "200ms"
+)
+
+// Failover is stage.failover: detect failover, like Aurora or RDS, and measure
+// downtime as seen by clients. A failover demotes the writer to read-only, then
+// the cluster endpoint DNS flips to the new writer. On each condition, clients
+// reconnect to rediscover the writer (default) or ignore it.
+type Failover struct {
+	DNSFreq       string `yaml:"dns-freq,omitempty"`       // duration; "0" disables
+	OnDNSFlip     string `yaml:"on-dns-flip,omitempty"`    // FAILOVER_RECONNECT (default) or FAILOVER_IGNORE
+	OnReadOnly    string `yaml:"on-read-only,omitempty"`   // FAILOVER_RECONNECT (default) or FAILOVER_IGNORE
+	ReconnectWait string `yaml:"reconnect-wait,omitempty"` // duration
 }
 
-func (c *Compute) Vars(params map[string]string) error {
+func (c *Failover) Vars(params map[string]string) error {
 	var err error
-	c.Instances, err = Vars(c.Instances, params, true)
+	c.DNSFreq, err = Vars(c.DNSFreq, params, false)
+	if err != nil {
+		return err
+	}
+	c.OnDNSFlip, err = Vars(c.OnDNSFlip, params, false)
+	if err != nil {
+		return err
+	}
+	c.OnReadOnly, err = Vars(c.OnReadOnly, params, false)
+	if err != nil {
+		return err
+	}
+	c.ReconnectWait, err = Vars(c.ReconnectWait, params, false)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *Compute) Validate() error {
-	if err := parseInt(c.Instances); err != nil {
-		return fmt.Errorf("instances: '%s' is not an integer: %s", c.Instances, err)
+func (c *Failover) Validate() error {
+	if c.DNSFreq == "" {
+		c.DNSFreq = DEFAULT_FAILOVER_DNS_FREQ
+	} else if c.DNSFreq != "0" {
+		if err := ValidFreq(c.DNSFreq, "stage.failover.dns-freq"); err != nil {
+			return err
+		}
 	}
-	if c.Instances == "" {
-		c.Instances = "1"
+	if c.ReconnectWait == "" {
+		c.ReconnectWait = DEFAULT_FAILOVER_RECONNECT_WAIT
+	}
+	if d, err := time.ParseDuration(c.ReconnectWait); err != nil || d < 0 {
+		return fmt.Errorf("reconnect-wait: '%s' is not a duration >= 0", c.ReconnectWait)
+	}
+	for _, v := range []*string{&c.OnDNSFlip, &c.OnReadOnly} {
+		switch *v {
+		case "":
+			*v = FAILOVER_RECONNECT
+		case FAILOVER_RECONNECT, FAILOVER_IGNORE:
+		default:
+			return fmt.Errorf("invalid value: %s: valid values are %s and %s", *v, FAILOVER_RECONNECT, FAILOVER_IGNORE)
+		}
 	}
 	return nil
 }
 
 // --------------------------------------------------------------------------
 
+// GroupRepl is stage.group-replication: discover Group Replication (or InnoDB
+// Cluster) members from performance_schema, handle member-change errors, and
+// report per-member throughput. With spread-writes, client groups without a
+// target are split across the PRIMARY members (multi-primary mode).
+type GroupRepl struct {
+	SpreadWrites *bool `yaml:"spread-writes,omitempty"`
+}
+
+// --------------------------------------------------------------------------
+
 type Trx struct {
-	Name string
-	File string
-	Data map[string]Data
+	Name     string
+	File     string
+	Data     map[string]Data
+	Template bool
+	Raw      bool
+	SkipIf   string `yaml:"skip-if,omitempty"`
+	Tags     Tags   `yaml:"-"` // stage.tags
 }
 
 func (c *Trx) Vars(params map[string]string) error {
@@ -323,6 +1163,10 @@ func (c *Trx) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.SkipIf, err = Vars(c.SkipIf, params, false)
+	if err != nil {
+		return err
+	}
 	for k := range c.Data {
 		d := c.Data[k]
 		if err := d.Vars(params); err != nil {
@@ -333,11 +1177,81 @@ func (c *Trx) Vars(params map[string]string) error {
 	return nil
 }
 
+// Tags enables or disables statements by tag (-- tags: in a trx file). A statement
+// with a disabled tag is removed. If any tags are enabled, a tagged statement is
+// removed unless it has an enabled tag. Untagged statements are never removed.
+type Tags struct {
+	Enable  []string `yaml:"enable,omitempty"`
+	Disable []string `yaml:"disable,omitempty"`
+}
+
+func (c *Tags) Vars(params map[string]string) error {
+	var err error
+	for i := range c.Enable {
+		c.Enable[i], err = Vars(c.Enable[i], params, false)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range c.Disable {
+		c.Disable[i], err = Vars(c.Disable[i], params, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Tags) Validate() error {
+	enabled := map[string]bool{}
+	for _, tag := range c.Enable {
+		if tag == "" {
+			return fmt.Errorf("enable: empty tag")
+		}
+		enabled[tag] = true
+	}
+	for _, tag := range c.Disable {
+		if tag == "" {
+			return fmt.Errorf("disable: empty tag")
+		}
+		if enabled[tag] {
+			return fmt.Errorf("tag %s is enabled and disabled", tag)
+		}
+	}
+	return nil
+}
+
+// Keep returns true if a statement with the given tags is kept.
+func (c Tags) Keep(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, d := range c.Disable {
+			if tag == d {
+				return false
+			}
+		}
+	}
+	if len(c.Enable) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, e := range c.Enable {
+			if tag == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type Data struct {
 	Name      string            `yaml:"name"`      // @id
 	Generator string            `yaml:"generator"` // data.Generator type
 	Scope     string            `yaml:"scope"`
-	Params    map[string]string `yaml:"params"` // Generator-specific params
+	Params    map[string]string `yaml:"params"`          // Generator-specific params
+	Batch     uint              `yaml:"batch,omitempty"` // data.BatchWriter
 }
 
 func (c *Data) Vars(params map[string]string) error {
@@ -366,21 +1280,27 @@ func (c *Data) Vars(params map[string]string) error {
 // --------------------------------------------------------------------------
 
 type ClientGroup struct {
-	Clients       string   `yaml:"clients,omitempty"` // uint
+	Clients       string   `yaml:"clients,omitempty"`     // uint
+	Connections   string   `yaml:"connections,omitempty"` // uint
 	Db            string   `yaml:"db,omitempty"`
 	DisableStats  bool     `yaml:"disable-stats,omitempty"`
 	Iter          string   `yaml:"iter,omitempty"`            // uint
 	IterClients   string   `yaml:"iter-clients,omitempty"`    // uint
 	IterExecGroup string   `yaml:"iter-exec-group,omitempty"` // uint
 	Group         string   `yaml:"group,omitempty"`
+	Pipeline      string   `yaml:"pipeline,omitempty"`       // uint
 	QPS           string   `yaml:"qps,omitempty"`            // uint
 	QPSClients    string   `yaml:"qps-clients,omitempty"`    // uint
 	QPSExecGroup  string   `yaml:"qps-exec-group,omitempty"` // uint
 	Runtime       string   `yaml:"runtime,omitempty"`
+	StartAfter    string   `yaml:"start-after,omitempty"`
+	StartJitter   string   `yaml:"start-jitter,omitempty"`
+	Target        string   `yaml:"target,omitempty"`
 	TPS           string   `yaml:"tps,omitempty"`
 	TPSClients    string   `yaml:"tps-clients,omitempty"`
 	TPSExecGroup  string   `yaml:"tps-exec-group,omitempty"`
 	Trx           []string `yaml:"trx,omitempty"`
+	Weights       []string `yaml:"weights,omitempty"` // uint, one per trx
 }
 
 func (c *ClientGroup) Validate(w []Trx) error {
@@ -401,6 +1321,16 @@ func (c *ClientGroup) Validate(w []Trx) error {
 		return fmt.Errorf("iter-exec-group: '%s' is not an integer: %s", c.IterExecGroup, err)
 	}
 
+	if err := parseInt(c.Pipeline); err != nil {
+		return fmt.Errorf("pipeline: '%s' is not an integer: %s", c.Pipeline, err)
+	}
+	if err := parseInt(c.Connections); err != nil {
+		return fmt.Errorf("connections: '%s' is not an integer: %s", c.Connections, err)
+	}
+	if finch.Uint(c.Connections) > 1 && finch.Uint(c.Pipeline) > 1 {
+		return fmt.Errorf("connections and pipeline are mutually exclusive: pipelined clients have one connection per statement in flight")
+	}
+
 	if err := parseInt(c.QPS); err != nil {
 		return fmt.Errorf("iter: '%s' is not an integer: %s", c.QPS, err)
 	}
@@ -424,6 +1354,31 @@ func (c *ClientGroup) Validate(w []Trx) error {
 	if err := ValidFreq(c.Runtime, "workload.runtime"); err != nil {
 		return err
 	}
+	if err := ValidFreq(c.StartJitter, "workload.start-jitter"); err != nil {
+		return err
+	}
+	if c.StartAfter != "" {
+		if d, err := time.ParseDuration(c.StartAfter); err != nil || d < 0 {
+			return fmt.Errorf("start-after: '%s' is not a duration >= 0", c.StartAfter)
+		}
+	}
+
+	if len(c.Weights) > 0 {
+		if len(c.Weights) != len(c.Trx) {
+			return fmt.Errorf("weights: has %d weights but %d trx: specify one weight for each trx", len(c.Weights), len(c.Trx))
+		}
+		total := uint64(0)
+		for i, w := range c.Weights {
+			n, err := strconv.ParseUint(w, 10, 32)
+			if err != nil {
+				return fmt.Errorf("weights[%d]: '%s' is not an integer: %s", i, w, err)
+			}
+			total += n
+		}
+		if total == 0 {
+			return fmt.Errorf("weights: all weights are zero")
+		}
+	}
 	return nil
 }
 
@@ -433,10 +1388,34 @@ func (c *ClientGroup) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.Target, err = Vars(c.Target, params, false)
+	if err != nil {
+		return err
+	}
 	c.Clients, err = Vars(c.Clients, params, true)
 	if err != nil {
 		return err
 	}
+	c.Iter, err = Vars(c.Iter, params, true)
+	if err != nil {
+		return err
+	}
+	c.IterClients, err = Vars(c.IterClients, params, true)
+	if err != nil {
+		return err
+	}
+	c.IterExecGroup, err = Vars(c.IterExecGroup, params, true)
+	if err != nil {
+		return err
+	}
+	c.Pipeline, err = Vars(c.Pipeline, params, true)
+	if err != nil {
+		return err
+	}
+	c.Connections, err = Vars(c.Connections, params, true)
+	if err != nil {
+		return err
+	}
 	c.QPS, err = Vars(c.QPS, params, true)
 	if err != nil {
 		return err
@@ -465,6 +1444,14 @@ func (c *ClientGroup) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.StartJitter, err = Vars(c.StartJitter, params, false)
+	if err != nil {
+		return err
+	}
+	c.StartAfter, err = Vars(c.StartAfter, params, false)
+	if err != nil {
+		return err
+	}
 	c.Group, err = Vars(c.Group, params, false)
 	if err != nil {
 		return err
@@ -475,36 +1462,110 @@ func (c *ClientGroup) Vars(params map[string]string) error {
 			return err
 		}
 	}
+	for i := range c.Weights {
+		c.Weights[i], err = Vars(c.Weights[i], params, true)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // --------------------------------------------------------------------------
 
 type MySQL struct {
+	Auth           Auth   `yaml:"auth,omitempty"`
+	Compress       string `yaml:"compress,omitempty"` // COMPRESS_* const
 	Db             string `yaml:"db,omitempty"`
 	DSN            string `yaml:"dsn,omitempty"`
+	Flavor         string `yaml:"flavor,omitempty"` // FLAVOR_* const
 	Hostname       string `yaml:"hostname,omitempty"`
 	MyCnf          string `yaml:"mycnf,omitempty"`
 	Password       string `yaml:"password,omitempty"`
 	PasswordFile   string `yaml:"password-file,omitempty"`
+	Pipe           string `yaml:"pipe,omitempty"`     // Windows named pipe
+	Protocol       string `yaml:"protocol,omitempty"` // PROTOCOL_* const
+	Secret         Secret `yaml:"secret,omitempty"`
 	Socket         string `yaml:"socket,omitempty"`
 	TimeoutConnect string `yaml:"timeout-connect,omitempty"`
 	TLS            TLS    `yaml:"tls,omitempty"`
 	Username       string `yaml:"username,omitempty"`
 
 	DisableAutoTLS *bool `yaml:"disable-auto-tls,omitempty"`
+	FastPath       *bool `yaml:"fast-path,omitempty"` // client.fastConn
+}
+
+// RDSAddr matches Amazon RDS hostnames with optional :port suffix, which
+// enable TLS automatically unless mysql.disable-auto-tls is true.
+var RDSAddr = regexp.MustCompile(`rds\.amazonaws\.com(:\d+)?$`)
+
+// COMPRESS_ZLIB is mysql.compress for zlib protocol compression, the only
+// compression supported (see dbconn/compress.go).
+const COMPRESS_ZLIB = "zlib"
+
+// mysql.flavor values. TiDB handles retryable TiDB errors (finch.TiDBErrorHandling)
+// and AUTO_RANDOM primary keys in stage.load. MariaDB handles MariaDB errors
+// (finch.MariaDBErrorHandling). Vitess and ProxySQL are proxies: see Proxy.
+// SQLite and ClickHouse are not MySQL: mysql.dsn is for their driver (see
+// dbconn.Drivers). SQLite is for developing trx files locally, so its stats are
+// not comparable. ClickHouse is for bulk insert and analytical SELECT
+// benchmarks: it has no transactions (see ClientPrepare).
+const (
+	FLAVOR_MYSQL      = "mysql" // default
+	FLAVOR_MARIADB    = "mariadb"
+	FLAVOR_TIDB       = "tidb"
+	FLAVOR_VITESS     = "vitess"
+	FLAVOR_PROXYSQL   = "proxysql"
+	FLAVOR_SQLITE     = "sqlite"
+	FLAVOR_CLICKHOUSE = "clickhouse"
+)
+
+// mysql.protocol values. The X Protocol (mysqlx package) executes SQL and
+// document store CRUD statements to compare JSON document workloads between
+// classic SQL access and the X DevAPI.
+const (
+	PROTOCOL_CLASSIC = "classic" // default
+	PROTOCOL_X       = "x"
+)
+
+// Proxy returns true if the flavor is a proxy layer (vitess or proxysql), which
+// handles its transient errors, prepares statements client-side, and sets the
+// workload.db on connect instead of executing USE.
+func (c MySQL) Proxy() bool {
+	return c.Flavor == FLAVOR_VITESS || c.Flavor == FLAVOR_PROXYSQL
+}
+
+// ClientPrepare returns true if statements with prepare are prepared client-side
+// and workload.db is the connection database: proxies (see Proxy) and ClickHouse,
+// which has no server-side prepared statements and no session for USE over HTTP.
+func (c MySQL) ClientPrepare() bool {
+	return c.Proxy() || c.Flavor == FLAVOR_CLICKHOUSE
+}
+
+// NotMySQL returns true if the flavor is not MySQL protocol (sqlite or clickhouse),
+// so mysql.dsn is required and MySQL-specific features, like stage.load, don't
+// work.
+func (c MySQL) NotMySQL() bool {
+	return c.Flavor == FLAVOR_SQLITE || c.Flavor == FLAVOR_CLICKHOUSE
 }
 
 // With returns the MySQL config c with defaults from def. It's called in
 // dbconn/factory.setDSN to apply any defaults from MySQL.MyCnf (a my.cnf
 // defaults file), which mimics how MySQL works.
 func (c *MySQL) With(def MySQL) {
+	c.Auth.With(def.Auth)
+	if c.Compress == "" {
+		c.Compress = def.Compress
+	}
 	if c.Db == "" {
 		c.Db = def.Db
 	}
 	if c.DSN == "" {
 		c.DSN = def.DSN
 	}
+	if c.Flavor == "" {
+		c.Flavor = def.Flavor
+	}
 	if c.Hostname == "" {
 		c.Hostname = def.Hostname
 	}
@@ -517,6 +1578,15 @@ func (c *MySQL) With(def MySQL) {
 	if c.PasswordFile == "" && def.PasswordFile != "" {
 		c.PasswordFile = def.PasswordFile
 	}
+	if c.Pipe == "" {
+		c.Pipe = def.Pipe
+	}
+	if c.Protocol == "" {
+		c.Protocol = def.Protocol
+	}
+	if c.Secret.Source == "" {
+		c.Secret = def.Secret
+	}
 	if c.Socket == "" {
 		c.Socket = def.Socket
 	}
@@ -527,11 +1597,19 @@ func (c *MySQL) With(def MySQL) {
 		c.Username = def.Username
 	}
 	c.DisableAutoTLS = setBool(c.DisableAutoTLS, def.DisableAutoTLS)
+	c.FastPath = setBool(c.FastPath, def.FastPath)
 	c.TLS.With(def.TLS)
 }
 
 func (c *MySQL) Vars(params map[string]string) error {
 	var err error
+	if err := c.Auth.Vars(params); err != nil {
+		return err
+	}
+	c.Compress, err = Vars(c.Compress, params, false)
+	if err != nil {
+		return err
+	}
 	c.Db, err = Vars(c.Db, params, false)
 	if err != nil {
 		return err
@@ -540,6 +1618,14 @@ func (c *MySQL) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.Flavor, err = Vars(c.Flavor, params, false)
+	if err != nil {
+		return err
+	}
+	c.Hostname, err = Vars(c.Hostname, params, false)
+	if err != nil {
+		return err
+	}
 	c.MyCnf, err = Vars(c.MyCnf, params, false)
 	if err != nil {
 		return err
@@ -556,6 +1642,21 @@ func (c *MySQL) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.Pipe, err = Vars(c.Pipe, params, false)
+	if err != nil {
+		return err
+	}
+	c.Protocol, err = Vars(c.Protocol, params, false)
+	if err != nil {
+		return err
+	}
+	if err := c.Secret.Vars(params); err != nil {
+		return err
+	}
+	c.Socket, err = Vars(c.Socket, params, false)
+	if err != nil {
+		return err
+	}
 	c.TimeoutConnect, err = Vars(c.TimeoutConnect, params, false)
 	if err != nil {
 		return err
@@ -567,6 +1668,56 @@ func (c *MySQL) Vars(params map[string]string) error {
 }
 
 func (c *MySQL) Validate() error {
+	if c.Socket != "" && c.Pipe != "" {
+		return fmt.Errorf("mysql.socket and mysql.pipe are mutually exclusive")
+	}
+	switch c.Compress {
+	case "", COMPRESS_ZLIB:
+	case "zstd":
+		return fmt.Errorf("mysql.compress: zstd is not supported; use %s", COMPRESS_ZLIB)
+	default:
+		return fmt.Errorf("invalid mysql.compress: %s; valid value is %s", c.Compress, COMPRESS_ZLIB)
+	}
+	if c.Compress != "" && c.TLS.Set() {
+		return fmt.Errorf("mysql.compress and mysql.tls are mutually exclusive")
+	}
+	if c.Compress != "" && RDSAddr.MatchString(c.Hostname) && !True(c.DisableAutoTLS) {
+		return fmt.Errorf("mysql.compress does not work with automatic TLS for Amazon RDS hostname %s; set mysql.disable-auto-tls: true", c.Hostname)
+	}
+	switch c.Flavor {
+	case "", FLAVOR_MYSQL, FLAVOR_MARIADB, FLAVOR_TIDB, FLAVOR_VITESS, FLAVOR_PROXYSQL:
+	case FLAVOR_SQLITE:
+		if c.DSN == "" {
+			return fmt.Errorf("mysql.flavor: %s requires mysql.dsn: SQLite database, like \"dev.db\" or \"file::memory:?cache=shared\"", FLAVOR_SQLITE)
+		}
+	case FLAVOR_CLICKHOUSE:
+		if c.DSN == "" {
+			return fmt.Errorf("mysql.flavor: %s requires mysql.dsn: native (\"clickhouse://host:9000/db\") or HTTP (\"http://host:8123/db\")", FLAVOR_CLICKHOUSE)
+		}
+	default:
+		return fmt.Errorf("invalid mysql.flavor: %s; valid values are %s, %s, %s, %s, %s, %s, and %s", c.Flavor, FLAVOR_MYSQL, FLAVOR_MARIADB, FLAVOR_TIDB, FLAVOR_VITESS, FLAVOR_PROXYSQL, FLAVOR_SQLITE, FLAVOR_CLICKHOUSE)
+	}
+	switch c.Protocol {
+	case "", PROTOCOL_CLASSIC:
+	case PROTOCOL_X:
+		if c.NotMySQL() || c.Proxy() {
+			return fmt.Errorf("mysql.protocol: %s does not work with mysql.flavor: %s", PROTOCOL_X, c.Flavor)
+		}
+		if c.TLS.Set() || c.Compress != "" || c.Pipe != "" || c.Auth.Set() {
+			return fmt.Errorf("mysql.protocol: %s does not support mysql.auth, mysql.tls, mysql.compress, or mysql.pipe", PROTOCOL_X)
+		}
+	default:
+		return fmt.Errorf("invalid mysql.protocol: %s; valid values are %s and %s", c.Protocol, PROTOCOL_CLASSIC, PROTOCOL_X)
+	}
+	if err := c.Secret.Validate(); err != nil {
+		return fmt.Errorf("mysql.secret: %s", err)
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -579,12 +1730,109 @@ func (c MySQL) Redacted() string {
 
 // --------------------------------------------------------------------------
 
+// Auth is mysql.auth: authentication plugin options for servers that require
+// more than mysql_native_password and caching_sha2_password with TLS. See
+// dbconn.setDSN.
+type Auth struct {
+	AllowCleartext  *bool  `yaml:"allow-cleartext,omitempty"`   // mysql_clear_password (PAM, LDAP)
+	AllowNative     *bool  `yaml:"allow-native,omitempty"`      // mysql_native_password (default: true)
+	ServerPublicKey string `yaml:"server-public-key,omitempty"` // PEM file: caching_sha2_password and sha256_password without TLS
+}
+
+func (c *Auth) With(def Auth) {
+	if c.ServerPublicKey == "" {
+		c.ServerPublicKey = def.ServerPublicKey
+	}
+	c.AllowCleartext = setBool(c.AllowCleartext, def.AllowCleartext)
+	c.AllowNative = setBool(c.AllowNative, def.AllowNative)
+}
+
+func (c *Auth) Vars(params map[string]string) error {
+	var err error
+	c.ServerPublicKey, err = Vars(c.ServerPublicKey, params, false)
+	return err
+}
+
+func (c Auth) Validate() error {
+	if c.ServerPublicKey != "" && !FileExists(c.ServerPublicKey) {
+		return fmt.Errorf("mysql.auth.server-public-key: %s: file does not exist", c.ServerPublicKey)
+	}
+	return nil
+}
+
+// Set returns true if any auth option is set that changes the driver default.
+func (c Auth) Set() bool {
+	return True(c.AllowCleartext) || (c.AllowNative != nil && !*c.AllowNative) || c.ServerPublicKey != ""
+}
+
+// --------------------------------------------------------------------------
+
+const (
+	SECRET_ENV   = "env"
+	SECRET_FILE  = "file"
+	SECRET_VAULT = "vault"
+	SECRET_AWS   = "aws"
+)
+
+// Secret is mysql.secret: MySQL credentials from a secret source that are
+// resolved when connecting instead of stored in the config. See dbconn.
+type Secret struct {
+	Source      string `yaml:"source,omitempty"` // SECRET_* const
+	Name        string `yaml:"name,omitempty"`   // env var, file, Vault path, or AWS secret ID
+	PasswordKey string `yaml:"password-key,omitempty"`
+	UsernameKey string `yaml:"username-key,omitempty"`
+	Refresh     string `yaml:"refresh,omitempty"`
+}
+
+func (c *Secret) Vars(params map[string]string) error {
+	var err error
+	c.Name, err = Vars(c.Name, params, false)
+	if err != nil {
+		return err
+	}
+	c.Refresh, err = Vars(c.Refresh, params, false)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Secret) Validate() error {
+	switch c.Source {
+	case "":
+		return nil // no secret
+	case SECRET_ENV, SECRET_FILE, SECRET_VAULT, SECRET_AWS:
+	default:
+		return fmt.Errorf("invalid source: %s: valid sources are %s, %s, %s, and %s", c.Source, SECRET_ENV, SECRET_FILE, SECRET_VAULT, SECRET_AWS)
+	}
+	if c.Name == "" {
+		return fmt.Errorf("name not set")
+	}
+	if c.PasswordKey == "" {
+		c.PasswordKey = "password"
+	}
+	if c.UsernameKey == "" {
+		c.UsernameKey = "username"
+	}
+	if c.Source == SECRET_AWS {
+		// dbconn runs "aws secretsmanager get-secret-value"
+		if _, err := exec.LookPath("aws"); err != nil {
+			return fmt.Errorf("source aws requires the AWS CLI, but aws is not in PATH: %s", err)
+		}
+	}
+	return ValidFreq(c.Refresh, "mysql.secret.refresh")
+}
+
+// --------------------------------------------------------------------------
+
 type TLS struct {
 	CA         string `yaml:"ca,omitempty"`   // ssl-ca
 	Cert       string `yaml:"cert,omitempty"` // ssl-cert
 	Key        string `yaml:"key,omitempty"`  // ssl-key
 	SkipVerify *bool  `yaml:"skip-verify,omitempty"`
 	Disable    *bool  `yaml:"disable,omitempty"`
+	ServerName string `yaml:"server-name,omitempty"` // default: hostname
+	MinVersion string `yaml:"min-version,omitempty"` // tlsVersions key
 
 	// ssl-mode from a my.cnf (see dbconn.ParseMyCnf)
 	MySQLMode string `yaml:"-"`
@@ -603,14 +1851,34 @@ func (c *TLS) With(def TLS) {
 	if c.MySQLMode == "" {
 		c.MySQLMode = def.MySQLMode
 	}
+	if c.ServerName == "" {
+		c.ServerName = def.ServerName
+	}
+	if c.MinVersion == "" {
+		c.MinVersion = def.MinVersion
+	}
 	c.SkipVerify = setBool(c.SkipVerify, def.SkipVerify)
 	c.Disable = setBool(c.Disable, def.Disable)
 }
 
+// tlsVersions maps config.tls.min-version values to Go TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
 func (c *TLS) Validate() error {
-	if True(c.Disable) || (c.Cert == "" && c.Key == "" && c.CA == "") {
+	if True(c.Disable) {
 		return nil // no TLS
 	}
+	if _, ok := tlsVersions[c.MinVersion]; c.MinVersion != "" && !ok {
+		return fmt.Errorf("config.tls.min-version: %s: invalid value; valid values are 1.0, 1.1, 1.2, and 1.3", c.MinVersion)
+	}
+	if c.Cert == "" && c.Key == "" && c.CA == "" {
+		return nil // no files: system CA, if TLS is set
+	}
 
 	// Any files specified must exist
 	if c.CA != "" && !FileExists(c.CA) {
@@ -658,14 +1926,25 @@ func (c *TLS) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.ServerName, err = Vars(c.ServerName, params, false)
+	if err != nil {
+		return err
+	}
+	c.MinVersion, err = Vars(c.MinVersion, params, false)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-// Set return true if TLS is not disabled and at least one file is specified.
+// Set return true if TLS is not disabled and at least one file is specified,
+// or server-name, min-version, or skip-verify is set to use TLS with the
+// system CA, like a TLS-required server with a public certificate.
 // If not set, Blip ignores the TLS config. If set, Blip validates, loads, and
 // registers the TLS config.
 func (c TLS) Set() bool {
-	return !True(c.Disable) && c.MySQLMode != "DISABLED" && (c.CA != "" || c.Cert != "" || c.Key != "")
+	return !True(c.Disable) && c.MySQLMode != "DISABLED" &&
+		(c.CA != "" || c.Cert != "" || c.Key != "" || c.ServerName != "" || c.MinVersion != "" || True(c.SkipVerify))
 }
 
 func (c TLS) LoadTLS(server string) (*tls.Config, error) {
@@ -676,10 +1955,15 @@ func (c TLS) LoadTLS(server string) (*tls.Config, error) {
 
 	// Either ServerName or InsecureSkipVerify is required else Go will
 	// return an error saying that. If both are set, Go seems to ignore
-	// ServerName.
+	// ServerName. Set server-name when the certificate name differs from
+	// the hostname, like connecting through a TLS-terminating proxy.
+	if c.ServerName != "" {
+		server = c.ServerName
+	}
 	tlsConfig := &tls.Config{
 		ServerName:         server,
 		InsecureSkipVerify: True(c.SkipVerify),
+		MinVersion:         tlsVersions[c.MinVersion], // 0 = Go default
 	}
 
 	// Root CA (optional)
@@ -709,9 +1993,49 @@ func (c TLS) LoadTLS(server string) (*tls.Config, error) {
 // --------------------------------------------------------------------------
 
 type Stats struct {
-	Disable *bool                        `yaml:"disable"`
-	Freq    string                       `yaml:"freq,omitempty"`
-	Report  map[string]map[string]string `yaml:"report,omitempty"`
+	Clock           string                       `yaml:"clock,omitempty"`
+	ClockResolution string                       `yaml:"clock-resolution,omitempty"`
+	Cumulative      *bool                        `yaml:"cumulative"`
+	Disable         *bool                        `yaml:"disable"`
+	Freq            string                       `yaml:"freq,omitempty"`
+	Report          map[string]map[string]string `yaml:"report,omitempty"`
+	TiDBStatus      *bool                        `yaml:"tidb-status,omitempty"`
+}
+
+// stats.clock values. The monotonic clock reads the time for every statement,
+// which is accurate but, at very high QPS, measurably limits throughput. The
+// coarse clock is a time that a ticker updates every stats.clock-resolution,
+// so reading it is nearly free, but response times are only accurate to the
+// resolution.
+const (
+	CLOCK_MONOTONIC = "monotonic" // default
+	CLOCK_COARSE    = "coarse"
+)
+
+// With sets values from def that are not set in c. Stats has a map, so all
+// fields are copied manually.
+func (c *Stats) With(def Stats) {
+	c.Cumulative = setBool(c.Cumulative, def.Cumulative)
+	c.Disable = setBool(c.Disable, def.Disable)
+	c.TiDBStatus = setBool(c.TiDBStatus, def.TiDBStatus)
+	if c.Freq == "" {
+		c.Freq = def.Freq
+	}
+	if c.Clock == "" {
+		c.Clock = def.Clock
+	}
+	if c.ClockResolution == "" {
+		c.ClockResolution = def.ClockResolution
+	}
+	if len(c.Report) == 0 && len(def.Report) > 0 {
+		c.Report = map[string]map[string]string{}
+		for r := range def.Report {
+			c.Report[r] = map[string]string{}
+			for k, v := range def.Report[r] {
+				c.Report[r][k] = v
+			}
+		}
+	}
 }
 
 func (c *Stats) Validate() error {
@@ -722,6 +2046,26 @@ func (c *Stats) Validate() error {
 			return err
 		}
 	}
+	switch c.Clock {
+	case "":
+		c.Clock = CLOCK_MONOTONIC
+	case CLOCK_MONOTONIC, CLOCK_COARSE:
+	default:
+		return fmt.Errorf("invalid stats.clock: %s; valid values: %s, %s", c.Clock, CLOCK_MONOTONIC, CLOCK_COARSE)
+	}
+	if c.ClockResolution == "" {
+		if c.Clock == CLOCK_COARSE {
+			c.ClockResolution = "100us"
+		}
+	} else {
+		d, err := time.ParseDuration(c.ClockResolution)
+		if err != nil {
+			return fmt.Errorf("invalid stats.clock-resolution: %s: %s", c.ClockResolution, err)
+		}
+		if d < time.Microsecond {
+			return fmt.Errorf("invalid stats.clock-resolution: %s: must be at least 1us", c.ClockResolution)
+		}
+	}
 	if len(c.Report) == 0 {
 		c.Report = map[string]map[string]string{
 			"stdout": {"each-instance": "true"},
@@ -745,6 +2089,10 @@ func (c *Stats) Vars(params map[string]string) error {
 	if err != nil {
 		return err
 	}
+	c.ClockResolution, err = Vars(c.ClockResolution, params, false)
+	if err != nil {
+		return err
+	}
 	for _, r := range c.Report {
 		for k, v := range r {
 			r[k], err = Vars(v, params, false)
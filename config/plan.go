@@ -0,0 +1,211 @@
+// Copyright 2024 Block, Inc.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/finch"
+)
+
+// planFile represents a plan file layout: multiple stages with dependencies
+// and shared params, run in dependency order:
+//
+//	params:
+//	  rows: 1M
+//	stages:
+//	  - name: setup
+//	    file: setup.yaml
+//	  - name: benchmark
+//	    depends-on: [setup]
+//	    if: $params.run
+//	    stage:
+//	      runtime: 60s
+//	      trx:
+//	        - file: read.sql
+//
+// A plan file is detected by the top-level "stages" instead of "stage".
+type planFile struct {
+	Params map[string]string `yaml:"params,omitempty"`
+	Stages []PlanStage       `yaml:"stages"`
+}
+
+// PlanStage is one stage in a plan file: a stage file or an inline stage.
+type PlanStage struct {
+	Name      string            `yaml:"name,omitempty"`
+	File      string            `yaml:"file,omitempty"`
+	Stage     *Stage            `yaml:"stage,omitempty"`
+	DependsOn []string          `yaml:"depends-on,omitempty"`
+	If        string            `yaml:"if,omitempty"`
+	Params    map[string]string `yaml:"params,omitempty"`
+}
+
+// stageRef is a stage to load: a stage file or an inline stage from a plan.
+// Load makes Stage from stageRef.
+type stageRef struct {
+	file   string            // stage file, or plan file if inline != nil
+	bytes  []byte            // stage file contents if inline == nil
+	inline *Stage            // plan stages[].stage
+	name   string            // plan stages[].name
+	params map[string]string // plan params + stages[].params
+	skip   bool              // plan stages[].if is false
+}
+
+// isPlan returns true if the YAML has top-level "stages".
+func isPlan(b []byte) bool {
+	var top map[string]interface{}
+	if err := yaml.Unmarshal(b, &top); err != nil {
+		return false // not a plan; error reported when decoded as stage file
+	}
+	_, ok := top["stages"]
+	return ok
+}
+
+// loadPlan returns the stages in the plan file in dependency order: a stage is
+// after all stages it depends on, else stages are in file order. A stage that's
+// skipped (if false) counts as done for stages that depend on it. The params
+// are from --param, which override plan params.
+func loadPlan(fileName string, b []byte, params map[string]string) ([]stageRef, error) {
+	var p planFile
+	if err := yaml.UnmarshalStrict(b, &p); err != nil {
+		return nil, fmt.Errorf("cannot decode YAML in %s: %s", fileName, err)
+	}
+	if len(p.Stages) == 0 {
+		return nil, fmt.Errorf("plan %s has no stages", fileName)
+	}
+
+	refs := make([]stageRef, len(p.Stages))
+	index := map[string]int{} // name -> refs index
+	for i, ps := range p.Stages {
+		if (ps.File == "") == (ps.Stage == nil) {
+			return nil, fmt.Errorf("plan %s stages[%d]: specify either file or stage", fileName, i)
+		}
+		if ps.Name == "" {
+			if ps.File == "" {
+				return nil, fmt.Errorf("plan %s stages[%d]: name is required for an inline stage", fileName, i)
+			}
+			ps.Name = filepath.Base(ps.File)
+			p.Stages[i].Name = ps.Name
+		}
+		if _, ok := index[ps.Name]; ok {
+			return nil, fmt.Errorf("plan %s: duplicate stage name %s", fileName, ps.Name)
+		}
+		index[ps.Name] = i
+
+		// Params: plan params < stage params < --param
+		r := stageRef{
+			file:   fileName,
+			inline: ps.Stage,
+			name:   ps.Name,
+			params: map[string]string{},
+		}
+		for k, v := range p.Params {
+			r.params[k] = v
+		}
+		for k, v := range ps.Params {
+			r.params[k] = v
+		}
+		for k, v := range params {
+			r.params[k] = v
+		}
+
+		if ps.File != "" {
+			r.file = ps.File
+			if !filepath.IsAbs(r.file) {
+				r.file = filepath.Join(filepath.Dir(fileName), r.file)
+			}
+			var err error
+			if r.bytes, err = read(r.file); err != nil {
+				return nil, fmt.Errorf("plan %s stage %s: %s", fileName, ps.Name, err)
+			}
+		}
+
+		if ps.If != "" {
+			expr, err := Vars(ps.If, r.params, false)
+			if err != nil {
+				return nil, fmt.Errorf("plan %s stage %s: if: %s", fileName, ps.Name, err)
+			}
+			ok, err := IfTrue(expr)
+			if err != nil {
+				return nil, fmt.Errorf("plan %s stage %s: if: %s", fileName, ps.Name, err)
+			}
+			finch.Debug("plan stage %s: if %s = %t", ps.Name, expr, ok)
+			r.skip = !ok
+		}
+		refs[i] = r
+	}
+
+	// Dependency order (topological sort, stable by file order)
+	for _, ps := range p.Stages {
+		for _, dep := range ps.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("plan %s stage %s depends on unknown stage %s", fileName, ps.Name, dep)
+			}
+		}
+	}
+	order := make([]stageRef, 0, len(refs))
+	done := make([]bool, len(refs))
+	for len(order) < len(refs) {
+		next := -1
+	STAGES:
+		for i, ps := range p.Stages {
+			if done[i] {
+				continue
+			}
+			for _, dep := range ps.DependsOn {
+				if !done[index[dep]] {
+					continue STAGES
+				}
+			}
+			next = i
+			break
+		}
+		if next < 0 {
+			cycle := []string{}
+			for i := range refs {
+				if !done[i] {
+					cycle = append(cycle, refs[i].name)
+				}
+			}
+			return nil, fmt.Errorf("plan %s has a dependency cycle among stages: %s", fileName, strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		order = append(order, refs[next])
+	}
+	return order, nil
+}
+
+// IfTrue evaluates a condition: VALUE, !VALUE, A == B, or A != B. A single
+// value is true unless it's empty, "0", "false", "no", or "off" (case-insensitive).
+// Interpolate the condition with Vars first.
+func IfTrue(expr string) (bool, error) {
+	for _, op := range []string{"==", "!="} {
+		if a, b, ok := strings.Cut(expr, op); ok {
+			eq := strings.TrimSpace(a) == strings.TrimSpace(b)
+			if op == "!=" {
+				return !eq, nil
+			}
+			return eq, nil
+		}
+	}
+	not := false
+	if strings.HasPrefix(expr, "!") {
+		not = true
+		expr = strings.TrimSpace(strings.TrimPrefix(expr, "!"))
+	}
+	if strings.ContainsAny(expr, " 	") {
+		return false, fmt.Errorf("'%s': expected VALUE, !VALUE, A == B, or A != B", expr)
+	}
+	var v bool
+	switch strings.ToLower(expr) {
+	case "", "0", "false", "no", "off":
+		v = false
+	default:
+		v = true
+	}
+	return v != not, nil
+}
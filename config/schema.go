@@ -0,0 +1,311 @@
+// Copyright 2024 Block, Inc.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/square/finch"
+)
+
+const SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns the JSON Schema for a stage file, or for the base file if
+// file is "all" (_all.yaml), or for a plan file if file is "plan". The schema
+// is made from the yaml tags of the config structs, so it accepts the same
+// fields as Load. Finch decodes all scalar values as strings, so string fields
+// accept any scalar, and boolean fields accept "${VAR}" because environment
+// variables are interpolated before decoding.
+func Schema(file string) (map[string]interface{}, error) {
+	var s map[string]interface{}
+	switch file {
+	case "", "stage":
+		s = schemaOf(reflect.TypeOf(stageFile{}))
+		s["title"] = "Finch stage file"
+		s["required"] = []string{"stage"}
+	case "all":
+		s = schemaOf(reflect.TypeOf(Base{}))
+		s["title"] = "Finch _all.yaml"
+	case "plan":
+		s = schemaOf(reflect.TypeOf(planFile{}))
+		s["title"] = "Finch plan file"
+		s["required"] = []string{"stages"}
+	default:
+		return nil, fmt.Errorf("invalid schema %s: valid schemas are stage, all, and plan", file)
+	}
+	s["$schema"] = SCHEMA_DRAFT
+	return s, nil
+}
+
+// schemaOf returns the JSON Schema for type t. Structs are objects with
+// additionalProperties false because Load uses yaml.UnmarshalStrict.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "boolean"},
+				map[string]interface{}{"type": "string", "pattern": `^\$\{.+\}$`},
+			},
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": []string{"string", "number", "boolean"}}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name) // yaml.v2 default
+			}
+			p := schemaOf(f.Type)
+			key := t.Name() + "." + name
+			if d, ok := schemaDesc[key]; ok {
+				p["description"] = d
+			}
+			if e, ok := schemaEnum[key]; ok {
+				p["enum"] = e
+			}
+			props[name] = p
+		}
+		s := map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if req, ok := schemaRequired[t.Name()]; ok {
+			s["required"] = req
+		}
+		return s
+	}
+	return map[string]interface{}{}
+}
+
+var schemaRequired = map[string][]string{
+	"Stage": {"trx"},
+	"Trx":   {"file"},
+	"Data":  {"generator"},
+}
+
+var schemaEnum = map[string][]string{
+	"Data.scope":              scopes(),
+	"Hook.on-error":           {"", HOOK_FATAL, HOOK_WARN},
+	"Exit.when":               {"", EXIT_ANY, EXIT_ALL},
+	"Failover.on-dns-flip":    {"", FAILOVER_RECONNECT, FAILOVER_IGNORE},
+	"Failover.on-read-only":   {"", FAILOVER_RECONNECT, FAILOVER_IGNORE},
+	"Compute.on-client-bound": {"", BOUND_WARN, BOUND_ABORT},
+	"MySQL.compress":          {"", COMPRESS_ZLIB},
+	"MySQL.flavor":            {"", FLAVOR_MYSQL, FLAVOR_MARIADB, FLAVOR_TIDB, FLAVOR_VITESS, FLAVOR_PROXYSQL, FLAVOR_SQLITE, FLAVOR_CLICKHOUSE},
+	"MySQL.protocol":          {"", PROTOCOL_CLASSIC, PROTOCOL_X},
+	"TLS.min-version":         {"", "1.0", "1.1", "1.2", "1.3"},
+	"Secret.source":           {"", SECRET_ENV, SECRET_FILE, SECRET_VAULT, SECRET_AWS},
+	"Stats.clock":             {"", CLOCK_MONOTONIC, CLOCK_COARSE},
+}
+
+func scopes() []string {
+	s := []string{
+		finch.SCOPE_GLOBAL,
+		finch.SCOPE_STAGE,
+		finch.SCOPE_WORKLOAD,
+		finch.SCOPE_EXEC_GROUP,
+		finch.SCOPE_CLIENT_GROUP,
+		finch.SCOPE_CLIENT,
+		finch.SCOPE_ITER,
+		finch.SCOPE_TRX,
+		finch.SCOPE_STATEMENT,
+		finch.SCOPE_ROW,
+		finch.SCOPE_VALUE,
+	}
+	sort.Strings(s)
+	return append([]string{""}, s...) // "" = default (statement)
+}
+
+// schemaDesc is keyed on struct type name + "." + yaml field name.
+var schemaDesc = map[string]string{
+	"stageFile.stage": "Stage configuration",
+
+	"planFile.params": "User-defined params for all stages in the plan: $params.KEY (overrides stage files)",
+	"planFile.stages": "Stages to run in dependency order",
+
+	"PlanStage.name":       "Stage name used in depends-on (default: base file name)",
+	"PlanStage.file":       "Stage file, relative to the plan file",
+	"PlanStage.stage":      "Inline stage, like the stage section of a stage file",
+	"PlanStage.depends-on": "Stage names that must run before this stage",
+	"PlanStage.if":         "Skip the stage unless the condition is true: VALUE, !VALUE, A == B, or A != B",
+	"PlanStage.params":     "User-defined params for this stage (overrides plan params)",
+
+	"Base.base":    "Base file that this file overrides, relative to this file",
+	"Base.mysql":   "MySQL connection for all stages in the directory",
+	"Base.params":  "User-defined params for all stages in the directory: $params.KEY",
+	"Base.stats":   "Statistics collection and reporting for all stages in the directory",
+	"Base.targets": "Named MySQL targets for all stages in the directory",
+
+	"Stage.after":             "Hooks to run after the stage: shell commands or SQL statements",
+	"Stage.base":              "Base file with shared mysql, params, stats, and targets (overrides _all.yaml), relative to the stage file",
+	"Stage.before":            "Hooks to run before the stage: shell commands or SQL statements",
+	"Stage.checkpoint":        "File to checkpoint rows inserted (-- rows limits) so an interrupted load resumes where it left off",
+	"Stage.compute":           "Compute instances (distributed Finch)",
+	"Stage.ddl":               "Online DDL benchmark: execute a DDL statement while the workload runs",
+	"Stage.disable":           "Disable the stage if true",
+	"Stage.exit":              "Stage exit conditions for all clients: runtime, iterations, rows written, and error budget",
+	"Stage.failover":          "Detect failover (Aurora, RDS): reconnect on read-only errors and DNS flips, and report client downtime",
+	"Stage.group-replication": "Group Replication (InnoDB Cluster): discover members, handle member-change errors, and report per-member throughput",
+	"Stage.name":              "Stage name (default: base file name)",
+	"Stage.mysql":             "MySQL connection (overrides _all.yaml)",
+	"Stage.params":            "User-defined params: $params.KEY (overrides _all.yaml)",
+	"Stage.preconnect":        "Connect all clients and prepare statements before the stage starts, so connection setup isn't in the first stats interval",
+	"Stage.preconnect-rate":   "Max connections per second when preconnect is true (default: 0, no limit)",
+	"Stage.handoff":           "Keep client connections when the stage finishes for the next stage with the same DSN to reuse instead of reconnecting",
+	"Stage.pin-clients":       "Pin each client to a thread and CPU, spread across GOMAXPROCS CPUs in each execution group (Linux)",
+	"Stage.progress":          "How often to print progress and ETA of execution groups with known bounds (rows, iterations, runtime), like 1m (default: 30s; 0 disables)",
+	"Stage.qps":               "Queries per second limit for all clients (default: 0, unlimited)",
+	"Stage.query-comment":     "Prepend /* finch stage=... client=... trx=... */ to every query",
+	"Stage.query-hint":        "Optimizer hint added as /*+ HINT */ to SELECT, INSERT, REPLACE, UPDATE, and DELETE statements",
+	"Stage.runtime":           "How long to run the stage, like 60s (default: 0, unlimited)",
+	"Stage.save-limits":       "Bounds on SELECT results scanned to save columns: max rows per statement and max memory per client",
+	"Stage.skip-if":           "SQL probe: skip the stage if the first column of the first row is true, like SELECT COUNT(*) >= 1000 FROM t",
+	"Stage.stats":             "Statistics collection and reporting (overrides _all.yaml)",
+	"Stage.tags":              "Enable or disable trx file statements by tag (-- tags: in the trx file)",
+	"Stage.targets":           "Named MySQL targets for client groups (workload.target), like a primary and a replica",
+	"Stage.tps":               "Transactions per second limit for all clients (default: 0, unlimited)",
+	"Stage.trx":               "Trx files to load",
+	"Stage.workload":          "Client groups that execute trx (default: auto-allocated)",
+
+	"Compute.disable-local":     "If true, the local Finch instance does not count as 1 compute",
+	"Compute.elastic":           "If true, the stage runs with the instances that have booted, instances can join and leave while running (up to instances), and clients are rebalanced across instances",
+	"Compute.heartbeat-timeout": "Remote compute instance is lost if no heartbeat (ping or stats) for this duration while running (default: 5s)",
+	"Compute.instances":         "Number of compute instances required to run the stage (default: 1)",
+	"Compute.max-cpu":           "Compute is client-bound if Finch uses more than this percent of its CPUs (default: 90; 0 to disable)",
+	"Compute.max-gc-pause":      "Compute is client-bound if Finch is paused for Go garbage collection more than this percent of the time (default: 5; 0 to disable)",
+	"Compute.on-client-bound":   "What to do when a compute instance is client-bound: warn (default) or abort (stop the stage)",
+	"Compute.on-lost":           "What to do when a remote compute instance is lost: continue (default), fail, or reassign (rebalance its clients to the remaining instances)",
+	"Compute.targets":           "Targets (stage.targets) assigned to compute instances in order, round-robin: the target replaces mysql on the instance",
+
+	"Hook.exec":     "Shell command to run (sh -c) in the stage file directory",
+	"Hook.sql":      "SQL statement to execute",
+	"Hook.on-error": "If the hook fails: fatal (default) to stop Finch, or warn to log a warning and continue",
+	"Hook.timeout":  "Hook timeout, like 30s (default: none)",
+
+	"Exit.when":    "Stop when any (default) or all of runtime, iter, and rows are reached",
+	"Exit.runtime": "Stage runtime, like 60s",
+	"Exit.iter":    "Total iterations by all clients",
+	"Exit.rows":    "Total rows affected by INSERT, UPDATE, DELETE, and REPLACE statements by all clients",
+	"Exit.errors":  "Error budget: stop when all clients have this many query errors, regardless of when",
+
+	"SaveLimits.max-rows":   "Max rows scanned per statement execution to save columns; the rest are discarded (0 = no limit)",
+	"SaveLimits.max-memory": "Max total size of saved column values per client, like 64MB (default: 64MB)",
+
+	"Failover.dns-freq":       "How often to resolve mysql.hostname to detect DNS flips, like 1s (default); 0 disables",
+	"Failover.on-dns-flip":    "What to do when mysql.hostname resolves to new addresses: reconnect (default) or ignore",
+	"Failover.on-read-only":   "What to do on a read-only error (demoted writer): reconnect (default) or ignore",
+	"Failover.reconnect-wait": "Wait between reconnect attempts, like 200ms (default)",
+
+	"GroupRepl.spread-writes": "Split client groups without a target across PRIMARY members (multi-primary)",
+
+	"DDL.sql":   "DDL statement to execute once, like ALTER TABLE or CREATE INDEX",
+	"DDL.delay": "How long to run the workload before the DDL (default: 10s)",
+	"DDL.after": "How long to run the workload after the DDL completes, then the stage ends (default: 10s)",
+
+	"TableLoad.table":           "Table to load: table or db.table",
+	"TableLoad.rows":            "Number of rows to load (rounded up to a multiple of batch x clients)",
+	"TableLoad.clients":         "Number of clients, each loading a unique chunk of the primary key (default: 1)",
+	"TableLoad.batch":           "Rows per INSERT (default: auto-sized, max 1000)",
+	"TableLoad.begin":           "First primary key value (default: 1)",
+	"TableLoad.columns":         "Data generators for columns, keyed on column name (default: based on column type)",
+	"TableLoad.rebuild-indexes": "Drop secondary indexes before the load and add them after",
+
+	"Trx.name":     "Trx name used in workload.trx (default: base file name)",
+	"Trx.file":     "Trx file, relative to the stage file",
+	"Trx.data":     "Data keys in the trx file, keyed on name without @ prefix",
+	"Trx.template": "Execute the trx file as a Go template before parsing it",
+	"Trx.raw":      "Execute the file verbatim as plain SQL, like the mysql client",
+	"Trx.skip-if":  "SQL probe: skip the trx if the first column of the first row is true",
+
+	"Tags.enable":  "Run only statements with these tags (untagged statements always run)",
+	"Tags.disable": "Remove statements with these tags",
+
+	"Data.name":      "Data key name",
+	"Data.generator": "Data generator name, like int or str-fill-az",
+	"Data.scope":     "Data scope (default: statement)",
+	"Data.params":    "Generator-specific params",
+	"Data.batch":     "Generate values for this many calls at once (default: 0, disabled)",
+
+	"ClientGroup.clients":         "Number of clients (default: 1)",
+	"ClientGroup.db":              "Default database for clients",
+	"ClientGroup.disable-stats":   "Disable statistics for clients",
+	"ClientGroup.iter":            "Max iterations per client (default: 0, unlimited)",
+	"ClientGroup.iter-clients":    "Max iterations for all clients in the client group",
+	"ClientGroup.iter-exec-group": "Max iterations for all clients in the execution group",
+	"ClientGroup.group":           "Execution group name",
+	"ClientGroup.connections":     "Connections per client; the client round-robins trx across them (default: 1)",
+	"ClientGroup.pipeline":        "Statements in flight per client, each on its own connection, completing out of order (default: 0, request-response)",
+	"ClientGroup.qps":             "Max queries per second per client",
+	"ClientGroup.qps-clients":     "Max queries per second for all clients in the client group",
+	"ClientGroup.qps-exec-group":  "Max queries per second for all clients in the execution group",
+	"ClientGroup.runtime":         "Client group runtime, like 60s (default: stage runtime)",
+	"ClientGroup.start-after":     "Start the execution group this long after the stage starts, concurrently with other execution groups",
+	"ClientGroup.start-jitter":    "Random delay [0, start-jitter) before each client starts",
+	"ClientGroup.tps":             "Max transactions per second per client",
+	"ClientGroup.tps-clients":     "Max transactions per second for all clients in the client group",
+	"ClientGroup.tps-exec-group":  "Max transactions per second for all clients in the execution group",
+	"ClientGroup.target":          "Named target (stage.targets) to connect to (default: stage mysql)",
+	"ClientGroup.trx":             "Trx names to execute, in order (default: all trx)",
+	"ClientGroup.weights":         "Trx weights, one per trx: each iteration executes one trx chosen by weight (default: all trx in order)",
+
+	"MySQL.auth":             "Authentication plugin options",
+	"MySQL.compress":         "Protocol compression: zlib (default: none)",
+	"MySQL.db":               "Default database on connect",
+	"MySQL.dsn":              "Data source name (overrides all other MySQL settings)",
+	"MySQL.flavor":           "Server flavor: mysql (default), mariadb, tidb, vitess, proxysql, sqlite, or clickhouse (handle flavor-specific errors and features)",
+	"MySQL.hostname":         "Hostname or IP[:port]",
+	"MySQL.mycnf":            "my.cnf file to read defaults from",
+	"MySQL.password":         "Password",
+	"MySQL.password-file":    "File that contains the password",
+	"MySQL.pipe":             "Windows named pipe, like MySQL or \\\\.\\pipe\\MySQL",
+	"MySQL.protocol":         "Client protocol: classic (default) or x (X Protocol for SQL and document store CRUD statements)",
+	"MySQL.secret":           "Credentials from a secret source (overrides password and password-file)",
+	"MySQL.socket":           "Unix socket file (overrides hostname)",
+	"MySQL.timeout-connect":  "Connection timeout, like 10s",
+	"MySQL.tls":              "TLS (SSL) settings",
+	"MySQL.username":         "Username",
+	"MySQL.disable-auto-tls": "Disable automatic TLS for Amazon RDS hostnames",
+	"MySQL.fast-path":        "Execute on the driver connection, bypassing database/sql, for higher max QPS per CPU core",
+
+	"Secret.source":       "Secret source: env, file, vault, or aws",
+	"Secret.name":         "Environment variable, file, Vault path, or AWS Secrets Manager secret ID",
+	"Secret.password-key": "Password key if the secret is a JSON object (default: password)",
+	"Secret.username-key": "Username key if the secret is a JSON object (default: username)",
+	"Secret.refresh":      "Resolve the secret again on connect after this period, like 5m (default: once)",
+
+	"Auth.allow-cleartext":   "Allow mysql_clear_password for PAM or LDAP authentication (sends the password in cleartext; use TLS)",
+	"Auth.allow-native":      "Allow mysql_native_password (default: true)",
+	"Auth.server-public-key": "Server RSA public key file (PEM) for caching_sha2_password and sha256_password without TLS (default: request from server)",
+
+	"TLS.ca":          "Certificate authority file (ssl-ca)",
+	"TLS.cert":        "Client certificate file (ssl-cert)",
+	"TLS.key":         "Client key file (ssl-key)",
+	"TLS.skip-verify": "Do not verify the server certificate",
+	"TLS.disable":     "Disable TLS",
+	"TLS.server-name": "Server name to verify the server certificate (default: hostname)",
+	"TLS.min-version": "Minimum TLS version: 1.0, 1.1, 1.2, or 1.3 (default: Go default)",
+
+	"Stats.clock":            "Clock for response time: monotonic (default) or coarse (faster, accurate only to clock-resolution)",
+	"Stats.clock-resolution": "Coarse clock update frequency, like 1ms (default: 100us)",
+	"Stats.cumulative":       "Report cumulative stats instead of interval stats",
+	"Stats.disable":          "Disable statistics",
+	"Stats.freq":             "Reporting frequency, like 5s (default: 0, report once at the end)",
+	"Stats.report":           "Stats reporters, like stdout or csv, keyed on name, with reporter-specific params",
+	"Stats.tidb-status":      "Print TiDB status variables (GC, schema version) at stage start and end (mysql.flavor: tidb)",
+}
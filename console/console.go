@@ -0,0 +1,246 @@
+// Copyright 2024 Block, Inc.
+
+// Package console implements finch console: an interactive prompt to execute
+// trx files one statement at a time against MySQL to debug them before running
+// a stage at scale.
+package console
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/dbconn"
+	"github.com/square/finch/trx"
+	"github.com/square/finch/workload"
+)
+
+// MAX_ROWS is the max number of result set rows printed for each statement.
+const MAX_ROWS = 10
+
+const help = `Commands:
+  Enter, n, next   Execute next statement
+  r, rest          Execute rest of iteration
+  i, iter          Start new iteration (from first statement)
+  t, trx [NAME]    List trx, or switch to trx NAME (new client)
+  h, help          Print this help
+  q, quit          Quit (or CTRL-D)
+`
+
+// Console executes one trx with one client step-by-step. Data keys are scoped
+// like a stage with one client, and save-columns and save-insert-id work, so
+// each iteration is like an iteration in the stage. Rate limits, data limits,
+// probability, and error handling are not applied.
+type Console struct {
+	cfg    config.Stage
+	gds    *data.Scope
+	trxSet *trx.Set
+	out    io.Writer
+	// --
+	trx    string
+	c      *client.Client
+	rc     data.RunCount
+	next   int  // next statement in c.Statements
+	inIter bool // true after first statement of iteration
+}
+
+func New(cfg config.Stage, out io.Writer) *Console {
+	return &Console{
+		cfg: cfg,
+		gds: data.NewScope(),
+		out: out,
+	}
+}
+
+// Run loads the trx files of the stage, then reads and executes commands from
+// in until quit, EOF, or ctx is cancelled.
+func (con *Console) Run(ctx context.Context, in io.Reader) error {
+	if con.cfg.Load != nil || len(con.cfg.Trx) == 0 {
+		return fmt.Errorf("stage %s has no trx files", con.cfg.Name)
+	}
+	dbconn.SetConfig(con.cfg.MySQL)
+	dbconn.SetTargets(con.cfg.Targets)
+	var err error
+	con.trxSet, err = trx.Load(con.cfg.Trx, con.gds, con.cfg.Params)
+	if err != nil {
+		return err
+	}
+	if err := con.setTrx(ctx, con.trxSet.Order[0]); err != nil {
+		return err
+	}
+	defer func() {
+		if con.c != nil {
+			con.c.Close()
+		}
+	}()
+	fmt.Fprintf(con.out, "Stage %s: %d trx. Type h for help.\n", con.cfg.Name, len(con.trxSet.Order))
+
+	lines := bufio.NewScanner(in)
+	for ctx.Err() == nil {
+		fmt.Fprintf(con.out, "%s:%d> ", con.trx, con.next+1)
+		if !lines.Scan() {
+			fmt.Fprintln(con.out)
+			return lines.Err()
+		}
+		f := strings.Fields(lines.Text())
+		cmd := ""
+		if len(f) > 0 {
+			cmd = f[0]
+		}
+		switch cmd {
+		case "", "n", "next":
+			con.step(ctx)
+		case "r", "rest":
+			for con.step(ctx) {
+			}
+		case "i", "iter":
+			con.next = 0
+			con.inIter = false
+		case "t", "trx":
+			if len(f) == 1 {
+				for _, name := range con.trxSet.Order {
+					fmt.Fprintf(con.out, "  %s (%d statements)\n", name, len(con.trxSet.Statements[name]))
+				}
+				continue
+			}
+			if err := con.setTrx(ctx, f[1]); err != nil {
+				fmt.Fprintf(con.out, "Error: %s\n", err)
+			}
+		case "h", "help":
+			fmt.Fprint(con.out, help)
+		case "q", "quit", "exit":
+			return nil
+		default:
+			fmt.Fprintf(con.out, "Unknown command: %s. Type h for help.\n", cmd)
+		}
+	}
+	return ctx.Err()
+}
+
+// setTrx allocates a new client to execute trx name, and connects it to MySQL.
+func (con *Console) setTrx(ctx context.Context, name string) error {
+	if _, ok := con.trxSet.Statements[name]; !ok {
+		return fmt.Errorf("no trx %s; type t to list trx", name)
+	}
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: con.cfg.Name,
+		TrxSet:    con.trxSet,
+		Workload: []config.ClientGroup{{
+			Clients: "1",
+			Trx:     []string{name},
+			Db:      consoleDb(con.cfg.Workload),
+		}},
+		Proxy: con.cfg.MySQL.ClientPrepare(),
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		return err
+	}
+	clients, err := a.Clients(groups, false)
+	if err != nil {
+		return err
+	}
+	c := clients[0][0].Clients[0]
+	if err := c.Init(); err != nil {
+		return err
+	}
+	if err := c.Connect(ctx, nil, -1, false); err != nil {
+		return err
+	}
+	if con.c != nil {
+		con.c.Close()
+	}
+	con.c = c
+	con.trx = name
+	con.rc = data.RunCount{}
+	con.rc[data.CONN] = 1
+	con.rc[data.CLIENT] = c.RunLevel.Client
+	con.rc[data.CLIENT_GROUP] = c.RunLevel.ClientGroup
+	con.rc[data.EXEC_GROUP] = c.RunLevel.ExecGroup
+	con.rc[data.STAGE] = c.RunLevel.Stage
+	con.next = 0
+	con.inIter = false
+	return nil
+}
+
+// consoleDb returns the default database of the first client group, if any,
+// because the console client doesn't use the stage workload.
+func consoleDb(cgs []config.ClientGroup) string {
+	if len(cgs) > 0 {
+		return cgs[0].Db
+	}
+	return ""
+}
+
+// step executes the next statement and prints the result. It returns false at
+// the end of the iteration or on error.
+func (con *Console) step(ctx context.Context) bool {
+	if con.next >= len(con.c.Statements) {
+		fmt.Fprintf(con.out, "End of iteration %d. Press Enter to start next iteration.\n", con.rc[data.ITER])
+		con.next = 0
+		con.inIter = false
+		return false
+	}
+	if !con.inIter {
+		con.rc[data.ITER] += 1
+		con.inIter = true
+	}
+	s := con.c.Statements[con.next]
+	st := con.c.Step(ctx, con.next, &con.rc, MAX_ROWS)
+	con.next = st.Next
+	con.print(s, st)
+	return st.Err == nil
+}
+
+func (con *Console) print(s *trx.Statement, st client.Step) {
+	w := con.out
+	fmt.Fprintf(w, "[%s:%d] ", filepath.Base(s.File), s.Line)
+	if s.Idle != 0 {
+		fmt.Fprintf(w, "idle %s\n", s.Idle)
+		return
+	}
+	fmt.Fprintln(w, st.Query)
+	if len(st.Values) > 0 {
+		vals := make([]string, len(st.Values))
+		for i, v := range st.Values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			vals[i] = fmt.Sprintf("%v", v)
+		}
+		fmt.Fprintf(w, "  values: %s = %s\n", strings.Join(s.Inputs, ", "), strings.Join(vals, ", "))
+	}
+	if st.Err != nil {
+		fmt.Fprintf(w, "  %s: error: %s\n", st.Duration, st.Err)
+		return
+	}
+	if !s.ResultSet {
+		fmt.Fprintf(w, "  %s: %d rows affected", st.Duration, st.RowsAffected)
+		if st.InsertId > 0 {
+			fmt.Fprintf(w, ", insert id %d", st.InsertId)
+		}
+		fmt.Fprintln(w)
+		return
+	}
+	fmt.Fprintf(w, "  %s: %d rows\n", st.Duration, st.NRows)
+	if len(st.Rows) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 1, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintf(tw, " \t%s\t\n", strings.Join(st.Columns, "\t"))
+	for _, row := range st.Rows {
+		fmt.Fprintf(tw, " \t%s\t\n", strings.Join(row, "\t"))
+	}
+	tw.Flush()
+	if st.NRows > len(st.Rows) {
+		fmt.Fprintf(w, "  ... %d more rows\n", st.NRows-len(st.Rows))
+	}
+}
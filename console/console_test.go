@@ -0,0 +1,66 @@
+// Copyright 2024 Block, Inc.
+
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+	"github.com/square/finch/trx"
+)
+
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	con := New(config.Stage{}, &buf)
+
+	s := &trx.Statement{File: "/tmp/read.sql", Line: 3, ResultSet: true, Inputs: []string{"@id"}}
+	st := client.Step{
+		Query:    "SELECT c FROM t WHERE id=5",
+		Values:   []interface{}{5},
+		Duration: 2 * time.Millisecond,
+		Columns:  []string{"c"},
+		Rows:     [][]string{{"abc"}},
+		NRows:    3,
+	}
+	con.print(s, st)
+	expect := "[read.sql:3] SELECT c FROM t WHERE id=5\n" +
+		"  values: @id = 5\n" +
+		"  2ms: 3 rows\n" +
+		"  |c   |\n" +
+		"  |abc |\n" +
+		"  ... 2 more rows\n"
+	if diff := deep.Equal(buf.String(), expect); diff != nil {
+		t.Logf("%s", buf.String())
+		t.Error(diff)
+	}
+
+	buf.Reset()
+	s = &trx.Statement{File: "write.sql", Line: 1, Write: true}
+	st = client.Step{
+		Query:        "INSERT INTO t VALUES (NULL)",
+		Duration:     time.Millisecond,
+		RowsAffected: 1,
+		InsertId:     9,
+	}
+	con.print(s, st)
+	expect = "[write.sql:1] INSERT INTO t VALUES (NULL)\n" +
+		"  1ms: 1 rows affected, insert id 9\n"
+	if diff := deep.Equal(buf.String(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	buf.Reset()
+	st = client.Step{Query: "INSERT INTO t VALUES (NULL)", Duration: time.Millisecond, Err: fmt.Errorf("Error 1062")}
+	con.print(s, st)
+	expect = "[write.sql:1] INSERT INTO t VALUES (NULL)\n" +
+		"  1ms: error: Error 1062\n"
+	if diff := deep.Equal(buf.String(), expect); diff != nil {
+		t.Error(diff)
+	}
+}
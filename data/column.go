@@ -60,6 +60,30 @@ func (g *Column) Scan(any interface{}) error {
 	return nil
 }
 
+// Size returns the approximate number of bytes used to save the value: the
+// capacity of the buffer for []byte values, else the length of a string or 8.
+// Clients sum it to enforce config.stage.save-limits.max-memory.
+func (g *Column) Size() int {
+	if g.useBytes {
+		return g.bytes.Cap()
+	}
+	if s, ok := g.val.(string); ok {
+		return len(s)
+	}
+	if g.val == nil {
+		return 0
+	}
+	return 8
+}
+
+// Free releases the saved value, including the buffer for []byte values.
+// The column value is nil until the next Scan.
+func (g *Column) Free() {
+	g.useBytes = false
+	g.bytes = nil
+	g.val = nil
+}
+
 func (g *Column) Values(_ RunCount) []interface{} {
 	if g.useBytes {
 		return []interface{}{g.bytes.String()}
@@ -13,6 +13,43 @@ import (
 
 type ValueFunc func(RunCount) []interface{}
 
+// ValueWriter is implemented by generators that write values into dst, which
+// has one element for each value (n from Format), instead of returning a new
+// slice. ScopedGenerator reuses dst for each new value so clients don't allocate
+// a slice for every statement, which adds up to a lot of GC at high QPS.
+// A generator must not keep dst.
+type ValueWriter interface {
+	WriteValues(dst []interface{}, rc RunCount)
+}
+
+// BatchWriter is implemented by generators that can write values for many
+// calls at once: dst has n*batch elements where n is from Format, so the
+// generator writes batch sets of values, one after the other. It's used when
+// a data key is configured with batch (config.stage.trx[].data.d.batch) to
+// amortize the cost of generating values, like locking the global random
+// source or allocating strings, over many iterations. Only generators whose
+// values don't depend on the RunCount or when they're called can implement
+// it because the values are generated ahead of time. A generator must not keep
+// dst.
+type BatchWriter interface {
+	WriteBatch(dst []interface{}, rc RunCount)
+}
+
+// values returns a new slice of n values from w, for Generator.Values.
+func values(w ValueWriter, n int, rc RunCount) []interface{} {
+	v := make([]interface{}, n)
+	w.WriteValues(v, rc)
+	return v
+}
+
+// Sizer is implemented by generators that save values (Scan), like Column,
+// to report and release the memory used by saved values. Clients use it to
+// enforce config.stage.save-limits.max-memory.
+type Sizer interface {
+	Size() int
+	Free()
+}
+
 // Generator generates data values for a data key (@d).
 type Generator interface {
 	Format() (uint, string)
@@ -33,13 +70,17 @@ func init() {
 	Register("int-range", f)
 	Register("int-range-seq", f)
 	Register("auto-inc", f)
+	Register("int-chunk", f)
 	// String
 	Register("str-fill-az", f)
+	Register("list", f)
 	// ID
 	Register("xid", f)
 	Register("client-id", f)
 	// Column
 	Register("column", f)
+	// Table
+	Register("table", f)
 }
 
 // Factory makes data generators from day keys (@d).
@@ -67,9 +108,13 @@ func (f factory) Make(name, dataKey string, params map[string]string) (Generator
 		g, err = NewIntRangeSeq(params)
 	case "auto-inc":
 		g, err = NewAutoInc(params)
+	case "int-chunk":
+		g, err = NewIntChunk(params)
 	// String
 	case "str-fill-az":
 		g, err = NewStrFillAz(params)
+	case "list":
+		g, err = NewList(params)
 	// ID
 	case "xid":
 		g = NewXid()
@@ -78,6 +123,9 @@ func (f factory) Make(name, dataKey string, params map[string]string) (Generator
 	// Column
 	case "column":
 		g = NewColumn(params)
+	// Table
+	case "table":
+		g, err = NewTable(params)
 	default:
 		err = fmt.Errorf("built-in data factory cannot make %s data generator", name)
 	}
@@ -113,6 +161,31 @@ func Make(name, dataKey string, params map[string]string) (Generator, error) {
 	return f.Make(name, dataKey, params)
 }
 
+// Partitioned returns true if the generator supports param partition: "I/N",
+// which makes its values unique to compute instance I of N. Stage sets it
+// automatically for distributed stages (config.stage.compute.instances > 1).
+func Partitioned(generator string) bool {
+	switch generator {
+	case "auto-inc", "int-chunk", "int-range-seq":
+		return true
+	}
+	return false
+}
+
+// partitionFrom returns param partition "I/N" as 0-indexed i of n. If the
+// param isn't set, it returns 0 of 1 (one partition: all values).
+func partitionFrom(params map[string]string) (int64, int64, error) {
+	s, ok := params["partition"]
+	if !ok {
+		return 0, 1, nil
+	}
+	var i, n int64
+	if _, err := fmt.Sscanf(s, "%d/%d", &i, &n); err != nil || n < 1 || i < 1 || i > n {
+		return 0, 0, fmt.Errorf("invalid partition=%s: must be I/N where 1 <= I <= N", s)
+	}
+	return i - 1, n, nil
+}
+
 func int64From(params map[string]string, key string, n *int64, required bool) error {
 	s, ok := params[key]
 	if !ok {
@@ -30,8 +30,10 @@ func (g *Xid) Copy() Generator {
 	return NewXid()
 }
 
-func (g *Xid) Values(c RunCount) []interface{} {
-	return []interface{}{xid.New().String()}
+func (g *Xid) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *Xid) WriteValues(dst []interface{}, _ RunCount) {
+	dst[0] = xid.New().String()
 }
 
 // --------------------------------------------------------------------------
@@ -81,14 +83,14 @@ func (g *ClientId) Format() (uint, string)     { return uint(len(g.ids)), "%d" }
 func (g *ClientId) Scan(any interface{}) error { return nil }
 func (g *ClientId) Copy() Generator            { return &ClientId{ids: g.ids} }
 
-func (g *ClientId) Values(rc RunCount) []interface{} {
+func (g *ClientId) Values(rc RunCount) []interface{} { return values(g, len(g.ids), rc) }
+
+func (g *ClientId) WriteValues(dst []interface{}, rc RunCount) {
 	// This data generator can be shared (e.g. client-group scope), so the
 	// caller can be a different client each time, so don't save the last value
-	// and don't return something like g.val (a struct field) because Go slices
-	// are pointers, so each call would overwrite the return value of the previous.
-	val := make([]interface{}, len(g.ids)) // a new slice each call
+	// in the generator; write only to dst, which the caller (ScopedGenerator)
+	// keeps per client.
 	for i := range g.ids {
-		val[i] = rc[g.ids[i]]
+		dst[i] = rc[g.ids[i]]
 	}
-	return val
 }
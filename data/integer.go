@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/square/finch"
 )
@@ -18,16 +19,21 @@ import (
 type Int struct {
 	min    int64
 	max    int64
-	dist   byte    // normal|uniform
+	dist   byte    // normal|uniform|zipfian|latest
 	mean   float64 // dist=normal
 	stddev float64 // dist=normal
+	zipf   *zipfian
+	rnd    *rand.Rand // WriteBatch
 }
 
 var _ Generator = &Int{}
+var _ BatchWriter = &Int{}
 
 const (
 	dist_uniform byte = iota
 	dist_normal
+	dist_zipfian
+	dist_latest
 )
 
 func NewInt(params map[string]string) (*Int, error) {
@@ -43,8 +49,15 @@ func NewInt(params map[string]string) (*Int, error) {
 	if err := int64From(params, "max", &g.max, false); err != nil {
 		return nil, err
 	}
+	if g.max < g.min {
+		return nil, fmt.Errorf("invalid int: min %d > max %d", g.min, g.max)
+	}
+	if r := g.max - g.min; r < 0 || r == math.MaxInt64 {
+		return nil, fmt.Errorf("invalid int: range [%d, %d] has more than %d values", g.min, g.max, int64(math.MaxInt64))
+	}
 
-	switch strings.ToLower(params["dist"]) {
+	dist := strings.ToLower(params["dist"])
+	switch dist {
 	case "normal":
 		g.dist = dist_normal
 		var mean int64
@@ -66,12 +79,26 @@ func NewInt(params map[string]string) (*Int, error) {
 		} else {
 			g.stddev = (float64(g.max) - float64(g.min)) / 8.0
 		}
+	case "zipfian", "latest":
+		g.dist = dist_zipfian
+		if dist == "latest" {
+			g.dist = dist_latest
+		}
+		theta := 0.99 // same as YCSB
+		if s, ok := params["theta"]; ok {
+			var err error
+			theta, err = strconv.ParseFloat(s, 64)
+			if err != nil || theta <= 0 || theta >= 1 {
+				return nil, fmt.Errorf("invalid theta=%s: must be > 0 and < 1", s)
+			}
+		}
+		g.zipf = newZipfian(g.max-g.min+1, theta)
 	case "uniform":
 		g.dist = dist_uniform
 	default:
 		g.dist = dist_uniform
 	}
-	finch.Debug("rand int [%d, %d] dist %d (uni %d, norm %d)", g.min, g.max, g.dist, dist_uniform, dist_normal)
+	finch.Debug("rand int [%d, %d] dist %s", g.min, g.max, dist)
 	return g, nil
 }
 
@@ -81,29 +108,103 @@ func (g *Int) Scan(any interface{}) error { return nil }
 
 func (g *Int) Copy() Generator {
 	c := *g
+	c.rnd = nil
 	return &c
 }
 
-func (g *Int) Values(_ RunCount) []interface{} {
+func (g *Int) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *Int) WriteValues(dst []interface{}, _ RunCount) {
 	switch g.dist {
 	case dist_normal:
 		v := int64(math.Floor(rand.NormFloat64()*g.stddev + g.mean))
 		if v < g.min || v > g.max {
 			v = int64(math.Floor(rand.NormFloat64()*g.stddev + g.mean))
 			if v < g.min || v > g.max {
-				return []interface{}{int64(g.mean)}
+				v = int64(g.mean)
 			}
 		}
-		return []interface{}{v}
+		dst[0] = v
+	case dist_zipfian:
+		dst[0] = g.min + g.zipf.next() // hot values near min
+	case dist_latest:
+		dst[0] = g.max - g.zipf.next() // hot values near max
 	default: // uniform
-		v := rand.Int63n(g.max)
-		if v < g.min {
-			v = g.min
+		dst[0] = g.min + rand.Int63n(g.max-g.min+1) // [min, max]
+	}
+}
+
+// WriteBatch writes uniform values from a random source that belongs to this
+// generator, so it doesn't lock the global random source for every value.
+// Other distributions are written one at a time like WriteValues.
+func (g *Int) WriteBatch(dst []interface{}, rc RunCount) {
+	if g.dist != dist_uniform {
+		for i := range dst {
+			g.WriteValues(dst[i:i+1], rc)
 		}
-		return []interface{}{v}
+		return
+	}
+	if g.rnd == nil {
+		g.rnd = newRand()
+	}
+	n := g.max - g.min + 1
+	for i := range dst {
+		dst[i] = g.min + g.rnd.Int63n(n)
+	}
+}
+
+// newRand returns a random source for WriteBatch, which is called by only one
+// client (scope), so it doesn't need the lock of the global random source.
+func newRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// zipfian returns values in [0, n) with a Zipfian distribution: 0 is the most
+// frequent value, 1 the next most frequent, and so on. It's the algorithm from
+// "Quickly Generating Billion-Record Synthetic Databases" by Gray et al., which
+// is what YCSB uses. Computing zetan is O(n), so it's done once in newZipfian;
+// the struct is read-only after that, so copies can share it.
+type zipfian struct {
+	n     float64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+	half  float64 // 1 + 0.5^theta
+}
+
+func newZipfian(n int64, theta float64) *zipfian {
+	zetan := 0.0
+	for i := int64(1); i <= n; i++ {
+		zetan += 1 / math.Pow(float64(i), theta)
+	}
+	zeta2 := 1 + math.Pow(0.5, theta)
+	return &zipfian{
+		n:     float64(n),
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta2/zetan),
+		half:  zeta2,
 	}
 }
 
+func (z *zipfian) next() int64 {
+	u := rand.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < z.half && z.n > 1 {
+		return 1
+	}
+	v := int64(z.n * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if v >= int64(z.n) {
+		v = int64(z.n) - 1
+	}
+	return v
+}
+
 // --------------------------------------------------------------------------
 
 // IntGaps implements the int-gaps data generator.
@@ -112,9 +213,11 @@ type IntGaps struct {
 	input_max    int64
 	output_start float64
 	slope        float64
+	rnd          *rand.Rand // WriteBatch
 }
 
 var _ Generator = &IntGaps{}
+var _ BatchWriter = &IntGaps{}
 
 func NewIntGaps(params map[string]string) (*IntGaps, error) {
 	// https://stackoverflow.com/questions/5731863/mapping-a-numeric-range-onto-another
@@ -159,8 +262,19 @@ func (g *IntGaps) Copy() Generator {
 	return c
 }
 
-func (g *IntGaps) Values(_ RunCount) []interface{} {
-	return []interface{}{int64(g.output_start + float64(rand.Int63n(g.input_max))*g.slope)}
+func (g *IntGaps) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *IntGaps) WriteValues(dst []interface{}, _ RunCount) {
+	dst[0] = int64(g.output_start + float64(rand.Int63n(g.input_max))*g.slope)
+}
+
+func (g *IntGaps) WriteBatch(dst []interface{}, _ RunCount) {
+	if g.rnd == nil {
+		g.rnd = newRand()
+	}
+	for i := range dst {
+		dst[i] = int64(g.output_start + float64(g.rnd.Int63n(g.input_max))*g.slope)
+	}
 }
 
 // --------------------------------------------------------------------------
@@ -172,9 +286,11 @@ type IntRange struct {
 	min    int64
 	max    int64
 	v      []int64
+	rnd    *rand.Rand // WriteBatch
 }
 
 var _ Generator = &IntRange{}
+var _ BatchWriter = &IntRange{}
 
 func NewIntRange(params map[string]string) (*IntRange, error) {
 	g := &IntRange{
@@ -211,16 +327,31 @@ func (g *IntRange) Copy() Generator {
 	return gCopy
 }
 
-func (g *IntRange) Values(_ RunCount) []interface{} {
+func (g *IntRange) Values(rc RunCount) []interface{} { return values(g, 2, rc) }
+
+func (g *IntRange) WriteValues(dst []interface{}, _ RunCount) {
 	// MySQL BETWEEN is closed interval [min, max], so if random min (lower)
 	// is 10 and size is 3, then 10+3=13 but that's 4 values: 10, 11, 12, 13.
 	// So we -1 to make BETWEEEN 10 AND 12, which is 3 values.
 	lower := g.min + rand.Int63n(g.max-g.min)
+	g.write(dst, lower)
+}
+
+func (g *IntRange) WriteBatch(dst []interface{}, _ RunCount) {
+	if g.rnd == nil {
+		g.rnd = newRand()
+	}
+	for i := 0; i < len(dst); i += 2 {
+		g.write(dst[i:i+2], g.min+g.rnd.Int63n(g.max-g.min))
+	}
+}
+
+func (g *IntRange) write(dst []interface{}, lower int64) {
 	upper := lower + g.size - 1
 	if upper > g.max {
 		upper = g.max
 	}
-	return []interface{}{lower, upper}
+	dst[0], dst[1] = lower, upper
 }
 
 // --------------------------------------------------------------------------
@@ -231,6 +362,8 @@ type IntRangeSeq struct {
 	end    int64
 	size   int64
 	n      int64
+	first  int64 // begin of this partition
+	stride int64 // size * partitions
 	params map[string]string
 	*sync.Mutex
 }
@@ -262,6 +395,18 @@ func NewIntRangeSeq(params map[string]string) (*IntRangeSeq, error) {
 	if g.size > (g.end - g.begin) {
 		return nil, fmt.Errorf("invalid int-range-seq: size (%d) > end (%d) - begin (%d)", g.size, g.end, g.begin)
 	}
+
+	// Partition i of n: chunks i, i+n, i+2n, etc.
+	i, n, err := partitionFrom(params)
+	if err != nil {
+		return nil, err
+	}
+	g.first = g.begin + i*g.size
+	g.stride = g.size * n
+	if g.first > g.end {
+		return nil, fmt.Errorf("invalid int-range-seq: partition %s begins after end (%d)", params["partition"], g.end)
+	}
+	g.n = g.first
 	return g, nil
 }
 
@@ -274,18 +419,20 @@ func (g *IntRangeSeq) Copy() Generator {
 	return c
 }
 
-func (g *IntRangeSeq) Values(_ RunCount) []interface{} {
+func (g *IntRangeSeq) Values(rc RunCount) []interface{} { return values(g, 2, rc) }
+
+func (g *IntRangeSeq) WriteValues(dst []interface{}, _ RunCount) {
 	g.Lock()
 	if g.n > g.end {
-		g.n = g.begin // reset  [begin, m]
+		g.n = g.first // reset  [begin, m]
 	}
 	n, m := g.n, g.n+g.size-1 // next chunk [n, m]
-	g.n += g.size
+	g.n += g.stride
 	if m > g.end {
 		m = g.end // short chunk [n, end]
 	}
 	g.Unlock()
-	return []interface{}{n, m}
+	dst[0], dst[1] = n, m
 }
 
 // --------------------------------------------------------------------------
@@ -319,6 +466,15 @@ func NewAutoInc(params map[string]string) (*AutoInc, error) {
 		}
 		g.step = i
 	}
+
+	// Partition i of n: every nth value, offset by i. Values wrap around like
+	// uint64, so the first value is start + step*(i+1).
+	i, n, err := partitionFrom(params)
+	if err != nil {
+		return nil, err
+	}
+	g.i = g.i + g.step*uint64(i+1) - g.step*uint64(n)
+	g.step *= uint64(n)
 	return g, nil
 }
 
@@ -333,6 +489,73 @@ func (g *AutoInc) Copy() Generator {
 	}
 }
 
-func (g *AutoInc) Values(_ RunCount) []interface{} {
-	return []interface{}{atomic.AddUint64(&g.i, g.step)}
+func (g *AutoInc) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *AutoInc) WriteValues(dst []interface{}, _ RunCount) {
+	dst[0] = atomic.AddUint64(&g.i, g.step)
+}
+
+// --------------------------------------------------------------------------
+
+// IntChunk implements the int-chunk data generator.
+type IntChunk struct {
+	begin  int64
+	size   int64
+	n      int64 // next value
+	init   bool  // n set on first call
+	i, m   int64 // partition i of m
+	params map[string]string
+}
+
+var _ Generator = &IntChunk{}
+
+func NewIntChunk(params map[string]string) (*IntChunk, error) {
+	g := &IntChunk{
+		begin:  1,
+		size:   finch.ROWS,
+		params: params,
+	}
+	if err := int64From(params, "begin", &g.begin, false); err != nil {
+		return nil, err
+	}
+	if err := int64From(params, "size", &g.size, false); err != nil {
+		return nil, err
+	}
+	if g.size < 1 {
+		return nil, fmt.Errorf("invalid int-chunk: size (%d) < 1", g.size)
+	}
+	var err error
+	if g.i, g.m, err = partitionFrom(params); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *IntChunk) Name() string               { return "int-chunk" }
+func (g *IntChunk) Format() (uint, string)     { return 1, "%d" }
+func (g *IntChunk) Scan(any interface{}) error { return nil }
+
+func (g *IntChunk) Copy() Generator {
+	c, _ := NewIntChunk(g.params)
+	return c
+}
+
+func (g *IntChunk) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *IntChunk) WriteValues(dst []interface{}, rc RunCount) {
+	// Client N (1-indexed in its client group) starts at its chunk: client 1
+	// [begin, begin+size-1], client 2 [begin+size, begin+size*2-1], etc.
+	// With partition i of m, chunks are interleaved: client N on partition i
+	// has chunk (N-1)*m + i.
+	if !g.init {
+		client := int64(rc[CLIENT])
+		if client > 0 {
+			client -= 1
+		}
+		g.n = g.begin + (client*g.m+g.i)*g.size
+		g.init = true
+	}
+	n := g.n
+	g.n += 1
+	dst[0] = n
 }
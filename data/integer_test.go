@@ -46,6 +46,96 @@ func TestInteger_Int(t *testing.T) {
 	deep.CompareUnexportedFields = false
 }
 
+func TestInteger_IntUniformRange(t *testing.T) {
+	// Values are in [min, max], and both min and max are reachable, including
+	// from WriteBatch
+	g, err := data.NewInt(map[string]string{"min": "-2", "max": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int64]bool{}
+	batch := make([]interface{}, 100)
+	for i := 0; i < 100; i++ {
+		seen[g.Values(data.RunCount{})[0].(int64)] = true
+		g.WriteBatch(batch, data.RunCount{})
+		for _, v := range batch {
+			seen[v.(int64)] = true
+		}
+	}
+	for v := range seen {
+		if v < -2 || v > 2 {
+			t.Errorf("value %d out of bounds [-2, 2]", v)
+		}
+	}
+	for v := int64(-2); v <= 2; v++ {
+		if !seen[v] {
+			t.Errorf("value %d never generated, expected all values in [-2, 2]", v)
+		}
+	}
+
+	// min = max is one value
+	g, err = data.NewInt(map[string]string{"min": "5", "max": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := g.Values(data.RunCount{})[0].(int64); v != 5 {
+		t.Errorf("got %d, expected 5 when min = max = 5", v)
+	}
+
+	// min > max and ranges that overflow int64 are errors for every
+	// distribution, not a panic when generating values
+	for _, dist := range []string{"uniform", "normal", "zipfian"} {
+		if _, err := data.NewInt(map[string]string{"min": "10", "max": "1", "dist": dist}); err == nil {
+			t.Errorf("%s: no error for min > max, expected one", dist)
+		}
+	}
+	if _, err := data.NewInt(map[string]string{"min": "0", "max": "9223372036854775807"}); err == nil {
+		t.Error("no error for range [0, MaxInt64], expected one")
+	}
+	if _, err := data.NewInt(map[string]string{"min": "-9223372036854775808", "max": "1"}); err == nil {
+		t.Error("no error for range [MinInt64, 1], expected one")
+	}
+}
+
+func TestInteger_IntZipfian(t *testing.T) {
+	r := data.RunCount{}
+	for _, dist := range []string{"zipfian", "latest"} {
+		g, err := data.NewInt(map[string]string{
+			"min":  "1",
+			"max":  "1000",
+			"dist": dist,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The hot value is min for zipfian and max for latest. With theta 0.99,
+		// it's about 13% of values, so it must be the most frequent value.
+		hot := int64(1)
+		if dist == "latest" {
+			hot = 1000
+		}
+		count := map[int64]int{}
+		for i := 0; i < 10000; i++ {
+			v := g.Values(r)[0].(int64)
+			if v < 1 || v > 1000 {
+				t.Fatalf("%s: value %d out of bounds [1, 1000]", dist, v)
+			}
+			count[v]++
+		}
+		for v, n := range count {
+			if v != hot && n > count[hot] {
+				t.Errorf("%s: value %d (%d times) more frequent than hot value %d (%d times)", dist, v, n, hot, count[hot])
+			}
+		}
+	}
+
+	_, err := data.NewInt(map[string]string{"dist": "zipfian", "theta": "1.5"})
+	if err == nil {
+		t.Errorf("no error for theta=1.5, expected one")
+	}
+}
+
 func TestInteger_AutoInc(t *testing.T) {
 	g, _ := data.NewAutoInc(nil)
 	r := data.RunCount{}
@@ -214,3 +304,94 @@ func TestInteger_IntGaps(t *testing.T) {
 		t.Errorf("got %d unique values, expected 19, 20, or 21 (20%% of 100)", len(v))
 	}
 }
+
+func TestInteger_IntChunk(t *testing.T) {
+	params := map[string]string{"size": "100"}
+
+	// Client 1: [1, 100]
+	g, err := data.NewIntChunk(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := data.RunCount{}
+	r[data.CLIENT] = 1
+	for _, i := range []int64{1, 2, 3} {
+		v := g.Values(r)
+		if v[0].(int64) != i {
+			t.Errorf("client 1: got %v, expected %d", v[0], i)
+		}
+	}
+
+	// Client 3: [201, 300]
+	g = g.Copy().(*data.IntChunk)
+	r[data.CLIENT] = 3
+	for _, i := range []int64{201, 202} {
+		v := g.Values(r)
+		if v[0].(int64) != i {
+			t.Errorf("client 3: got %v, expected %d", v[0], i)
+		}
+	}
+
+	// begin=0
+	g, _ = data.NewIntChunk(map[string]string{"begin": "0", "size": "10"})
+	r[data.CLIENT] = 2
+	for _, i := range []int64{10, 11} {
+		v := g.Values(r)
+		if v[0].(int64) != i {
+			t.Errorf("begin 0 client 2: got %v, expected %d", v[0], i)
+		}
+	}
+
+	if _, err := data.NewIntChunk(map[string]string{"size": "0"}); err == nil {
+		t.Error("no error for size 0, expected one")
+	}
+}
+
+func TestInteger_Partition(t *testing.T) {
+	r := data.RunCount{}
+
+	// auto-inc: partitions 1/2 and 2/2 interleave values
+	for partition, expect := range map[string][]uint64{"1/2": {1, 3, 5}, "2/2": {2, 4, 6}} {
+		g, err := data.NewAutoInc(map[string]string{"partition": partition})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []uint64{}
+		for range expect {
+			got = append(got, g.Values(r)[0].(uint64))
+		}
+		if diff := deep.Equal(got, expect); diff != nil {
+			t.Errorf("auto-inc partition %s: %v", partition, diff)
+		}
+	}
+
+	// int-chunk: client 2 on partition 2/3 has chunk (2-1)*3 + 1 = 4: [401, 500]
+	g, err := data.NewIntChunk(map[string]string{"size": "100", "partition": "2/3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r[data.CLIENT] = 2
+	if v := g.Values(r); v[0].(int64) != 401 {
+		t.Errorf("int-chunk partition 2/3 client 2: got %v, expected 401", v[0])
+	}
+
+	// int-range-seq: partition 2/2 has chunks 2, 4, etc., then restarts at 2
+	g2, err := data.NewIntRangeSeq(map[string]string{"begin": "1", "end": "40", "size": "10", "partition": "2/2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := [][]interface{}{}
+	for i := 0; i < 3; i++ {
+		got = append(got, g2.Values(r))
+	}
+	expect := [][]interface{}{{int64(11), int64(20)}, {int64(31), int64(40)}, {int64(11), int64(20)}}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Errorf("int-range-seq partition 2/2: %v", diff)
+	}
+
+	for _, partition := range []string{"0/2", "3/2", "x", "1/0"} {
+		if _, err := data.NewAutoInc(map[string]string{"partition": partition}); err == nil {
+			t.Errorf("partition %s: no error, expected one", partition)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Block, Inc.
+
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/square/finch"
+)
+
+// List implements the list data generator.
+type List struct {
+	values     [][]string // [line][column], read-only, shared by copies
+	columns    int
+	quoteValue bool
+}
+
+var _ Generator = &List{}
+
+func NewList(params map[string]string) (*List, error) {
+	file := params["file"]
+	if file == "" {
+		return nil, fmt.Errorf("list requires param file")
+	}
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) == 0 {
+		return nil, fmt.Errorf("list file %s is empty", file)
+	}
+	columns := 1
+	if s, ok := params["columns"]; ok {
+		columns, err = strconv.Atoi(s)
+		if err != nil || columns < 1 {
+			return nil, fmt.Errorf("invalid list columns=%s: must be an integer >= 1", s)
+		}
+	}
+	// One value per line, or columns values separated by tabs. An empty line
+	// is an empty string value, but the newline at end of file doesn't make
+	// another value.
+	lines := strings.Split(strings.TrimSuffix(string(bytes), "\n"), "\n")
+	values := make([][]string, len(lines))
+	for i, line := range lines {
+		if columns == 1 {
+			values[i] = []string{line}
+			continue
+		}
+		values[i] = strings.Split(line, "\t")
+		if len(values[i]) != columns {
+			return nil, fmt.Errorf("list file %s line %d has %d values, expected %d (columns)", file, i+1, len(values[i]), columns)
+		}
+	}
+	finch.Debug("list %s: %d values", file, len(values))
+	return &List{
+		values:     values,
+		columns:    columns,
+		quoteValue: finch.Bool(params["quote-value"]),
+	}, nil
+}
+
+func (g *List) Name() string               { return "list" }
+func (g *List) Scan(any interface{}) error { return nil }
+
+func (g *List) Format() (uint, string) {
+	if g.quoteValue {
+		return uint(g.columns), "'%s'"
+	}
+	return uint(g.columns), "%s"
+}
+
+func (g *List) Copy() Generator {
+	c := *g
+	return &c
+}
+
+func (g *List) Values(rc RunCount) []interface{} { return values(g, g.columns, rc) }
+
+func (g *List) WriteValues(dst []interface{}, _ RunCount) {
+	for i, v := range g.values[rand.Intn(len(g.values))] {
+		dst[i] = v
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 Block, Inc.
+
+package data_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/finch/data"
+)
+
+func TestList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "values.txt")
+	if err := os.WriteFile(file, []byte("a\n\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := data.NewList(map[string]string{"file": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty line is an empty string value, but trailing newline is not a value
+	got := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		v := g.Values(data.RunCount{})
+		if len(v) != 1 {
+			t.Fatalf("got %d values, expected 1: %v", len(v), v)
+		}
+		got[v[0].(string)] = true
+	}
+	if len(got) != 3 || !got["a"] || !got[""] || !got["c"] {
+		t.Errorf("got values %v, expected a, empty string, and c", got)
+	}
+
+	_, f := g.Format()
+	if f != "%s" {
+		t.Errorf("got format %s, expected %%s", f)
+	}
+	g, _ = data.NewList(map[string]string{"file": file, "quote-value": "yes"})
+	_, f = g.Format()
+	if f != "'%s'" {
+		t.Errorf("got format %s, expected '%%s' with quote-value", f)
+	}
+
+	_, err = data.NewList(map[string]string{})
+	if err == nil {
+		t.Errorf("no error without file param, expected one")
+	}
+}
+
+func TestList_Columns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "values.txt")
+	if err := os.WriteFile(file, []byte("1\t'a'\n2\t'b'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := data.NewList(map[string]string{"file": file, "columns": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := g.Format(); n != 2 {
+		t.Errorf("got %d values from Format, expected 2", n)
+	}
+
+	// Values on the same line are returned together: never 1 and 'b'
+	for i := 0; i < 1000; i++ {
+		v := g.Values(data.RunCount{})
+		if len(v) != 2 {
+			t.Fatalf("got %d values, expected 2: %v", len(v), v)
+		}
+		if !(v[0] == "1" && v[1] == "'a'") && !(v[0] == "2" && v[1] == "'b'") {
+			t.Fatalf("got values %v, expected [1 'a'] or [2 'b']", v)
+		}
+	}
+
+	if err := os.WriteFile(file, []byte("1\t'a'\n2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = data.NewList(map[string]string{"file": file, "columns": "2"}); err == nil {
+		t.Errorf("no error for line with 1 of 2 values, expected one")
+	}
+	if _, err = data.NewList(map[string]string{"file": file, "columns": "0"}); err == nil {
+		t.Errorf("no error for columns=0, expected one")
+	}
+}
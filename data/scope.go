@@ -41,6 +41,7 @@ type Key struct {
 	Statement uint      // statement number (1-indexed) in trx file
 	Column    int       // -1: none, 0: insert ID, >=1: column
 	Scope     string    // finch.SCOPE_*
+	Batch     uint      // values for this many calls generated at once (BatchWriter)
 	Generator Generator `deep:"-"` // original (copy 0) from which others are copied
 }
 
@@ -99,6 +100,8 @@ func (s *Scope) Copy(keyName string, rl finch.RunLevel) *ScopedGenerator {
 		switch k.Generator.Name() {
 		case "column":
 			k.Scope = finch.SCOPE_TRX
+		case "table":
+			k.Scope = finch.SCOPE_ITER
 		default:
 			k.Scope = finch.SCOPE_STATEMENT
 		}
@@ -117,6 +120,9 @@ func (s *Scope) Copy(keyName string, rl finch.RunLevel) *ScopedGenerator {
 			CopyNo:   s.CopyCount[keyName],
 		}
 		s.CopyOf[keyName] = NewScopedGenerator(id, k.Generator.Copy())
+		if k.Batch > 1 {
+			s.CopyOf[keyName].batch(k.Batch)
+		}
 		s.CopiedAt[k.Name] = rl
 	}
 	return s.CopyOf[keyName]
@@ -147,9 +153,14 @@ func (s *Scope) Reset() {
 type ScopedGenerator struct {
 	id           Id                     // identify this copy of the real Generator for debugging
 	g            Generator              // real Generator:
+	w            ValueWriter            //   real Generator if Reuse and it writes values in place, else nil
 	sno          byte                   //   scope number in RunCount (if singleClient == true)
 	last         RunCount               //   last time value was generated
 	vals         []interface{}          //   last value
+	bw           BatchWriter            //   real Generator if batched, else nil
+	buf          []interface{}          //   batch of values (s.vals is a slice of it)
+	bn           int                    //   values per call (n from Format)
+	bi           int                    //   next value in buf
 	singleClient bool                   // Single client scopes (typical): STATEMENT, TRX, ITER, CILENT
 	oneTime      bool                   // One time scopes: STAGE and GLOBAL
 	cgMux        *sync.RWMutex          // Multi client: client-group, exec-group, workload
@@ -187,11 +198,55 @@ func NewScopedGenerator(id Id, g Generator) *ScopedGenerator {
 	return s
 }
 
+// batch makes the ScopedGenerator generate values for n calls at once if the
+// real Generator is a BatchWriter and the scope is single client or VALUE:
+// multi client and one time scopes are shared, so there's nothing to batch.
+func (s *ScopedGenerator) batch(n uint) {
+	bw, ok := s.g.(BatchWriter)
+	if !ok || (!s.singleClient && s.id.Scope != finch.SCOPE_VALUE) {
+		return
+	}
+	nv, _ := s.g.Format()
+	s.bw = bw
+	s.bn = int(nv)
+	s.buf = make([]interface{}, s.bn*int(n))
+	s.bi = len(s.buf) // write first batch on first call
+}
+
+// Reuse makes the ScopedGenerator write new values into one slice (s.vals)
+// instead of returning a new slice for each new value if the real Generator is
+// a ValueWriter and the scope is single client or VALUE. It's only for callers
+// that copy the values before calling again, like the client: workload calls
+// it for statement inputs, so there's no need to allocate a new slice for
+// every statement. Multi client and one time scopes always return a new slice
+// because other clients might be reading the last value.
+func (s *ScopedGenerator) Reuse() {
+	if !s.singleClient && s.id.Scope != finch.SCOPE_VALUE {
+		return
+	}
+	s.w, _ = s.g.(ValueWriter)
+}
+
 func (s *ScopedGenerator) Name() string               { return s.g.Name() }
 func (s *ScopedGenerator) Id() Id                     { return s.id }
 func (s *ScopedGenerator) Format() (uint, string)     { return s.g.Format() }
 func (s *ScopedGenerator) Scan(any interface{}) error { return s.g.Scan(any) }
 
+// Size returns the size of the saved value if the real Generator is a Sizer,
+// else 0.
+func (s *ScopedGenerator) Size() int {
+	if z, ok := s.g.(Sizer); ok {
+		return z.Size()
+	}
+	return 0
+}
+
+func (s *ScopedGenerator) Free() {
+	if z, ok := s.g.(Sizer); ok {
+		z.Free()
+	}
+}
+
 func (s *ScopedGenerator) Copy() Generator {
 	panic("cannot copy ScopedGenerator") // only real Generator is copied
 }
@@ -211,10 +266,36 @@ func (s *ScopedGenerator) Call(cnt RunCount) []interface{} {
 		return v
 	}
 	s.last[s.sno] = cnt[s.sno] // save last run counter value
-	s.vals = s.g.Values(cnt)   // generate new data value
+	s.vals = s.values(cnt)     // generate new data value
+	return s.vals
+}
+
+// values returns new values from the real Generator: the next values in the
+// batch if batched, written into s.vals if it's a ValueWriter, else a new slice.
+func (s *ScopedGenerator) values(cnt RunCount) []interface{} {
+	if s.bw != nil {
+		if s.bi == len(s.buf) {
+			s.bw.WriteBatch(s.buf, cnt)
+			s.bi = 0
+		}
+		v := s.buf[s.bi : s.bi+s.bn : s.bi+s.bn]
+		s.bi += s.bn
+		return v
+	}
+	if s.w == nil {
+		return s.g.Values(cnt)
+	}
+	if s.vals == nil {
+		n, _ := s.g.Format()
+		s.vals = make([]interface{}, n)
+	}
+	s.w.WriteValues(s.vals, cnt)
 	return s.vals
 }
 
+// Values returns the values for the scope: new values if the scope run count
+// has changed, else the last values. After Reuse, the slice might be reused
+// for the next values, so the caller must copy the values.
 func (s *ScopedGenerator) Values(cnt RunCount) []interface{} {
 	/*
 		This func called in performance critical path: Client.Run.
@@ -255,7 +336,7 @@ func (s *ScopedGenerator) Values(cnt RunCount) []interface{} {
 	}
 
 	// VALUE scope
-	return s.g.Values(cnt)
+	return s.values(cnt)
 }
 
 // RunCount counts execution (or changes) at each level in the order defined
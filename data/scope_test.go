@@ -145,3 +145,74 @@ func TestScope_PREV(t *testing.T) {
 		t.Errorf("got Generator for @PREV, expected nil: %+v", g2)
 	}
 }
+
+func TestScopedGenerator_WriteValues(t *testing.T) {
+	// By default, every new value is a new slice, so callers can keep values
+	table, err := data.NewTable(map[string]string{"tables": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := data.NewScopedGenerator(data.Id{Scope: finch.SCOPE_STATEMENT, Type: "table", DataKey: "@t"}, table)
+	r := data.RunCount{}
+	r[data.STATEMENT] = 1
+	v1 := g.Values(r)
+	r[data.STATEMENT] = 2
+	if v2 := g.Values(r); &v1[0] == &v2[0] {
+		t.Errorf("got reused value slice without Reuse, expected new slice")
+	}
+
+	// With Reuse, single client scope reuses one value slice, and table names
+	// are boxed once, so new values don't allocate
+	g.Reuse()
+	v1 = g.Values(r)
+	allocs := testing.AllocsPerRun(100, func() {
+		r[data.STATEMENT] += 1
+		g.Values(r)
+	})
+	if allocs != 0 {
+		t.Errorf("got %.1f allocs per value, expected 0", allocs)
+	}
+	if v2 := g.Values(r); &v1[0] != &v2[0] {
+		t.Errorf("got new value slice, expected reused slice")
+	}
+
+	// Multi client scope returns a new slice each call
+	g = data.NewScopedGenerator(data.Id{Scope: finch.SCOPE_CLIENT_GROUP, Type: "table", DataKey: "@t"}, table.Copy())
+	g.Reuse()
+	r[data.ITER] = 1
+	v1 = g.Values(r)
+	r[data.ITER] = 2
+	if v2 := g.Values(r); &v1[0] == &v2[0] {
+		t.Errorf("got reused value slice for client-group scope, expected new slice")
+	}
+}
+
+func TestScopedGenerator_Batch(t *testing.T) {
+	// int-range writes 2 values per call, so a batch of 4 is 8 values; check
+	// that 10 calls (2 batches + 2) return valid ranges
+	g, err := data.NewIntRange(map[string]string{"min": "1", "max": "1000", "size": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := data.NewScope()
+	scope.Keys["@r"] = data.Key{
+		Name:      "@r",
+		Scope:     finch.SCOPE_STATEMENT,
+		Batch:     4,
+		Column:    -1,
+		Generator: g,
+	}
+	sg := scope.Copy("@r", finch.RunLevel{Stage: 1, ExecGroup: 1, ClientGroup: 1, Client: 1, Trx: 1, Query: 1})
+	r := data.RunCount{}
+	for i := 1; i <= 10; i++ {
+		r[data.STATEMENT] = uint(i)
+		v := sg.Values(r)
+		if len(v) != 2 {
+			t.Fatalf("call %d: got %d values, expected 2: %v", i, len(v), v)
+		}
+		lower, upper := v[0].(int64), v[1].(int64)
+		if lower < 1 || upper > 1000 || upper-lower != 9 && upper != 1000 {
+			t.Errorf("call %d: got range [%d, %d], expected size 10 in [1, 1000]", i, lower, upper)
+		}
+	}
+}
@@ -16,6 +16,7 @@ type StrFillAz struct {
 }
 
 var _ Generator = &StrFillAz{}
+var _ BatchWriter = &StrFillAz{}
 
 // https://stackoverflow.com/questions/22892120/how-to-generate-a-random-string-of-a-fixed-length-in-go
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -50,11 +51,27 @@ func (g *StrFillAz) Copy() Generator {
 	}
 }
 
-func (g *StrFillAz) Values(_ RunCount) []interface{} {
+func (g *StrFillAz) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *StrFillAz) WriteValues(dst []interface{}, _ RunCount) {
+	dst[0] = g.fill(g.len)
+}
+
+// WriteBatch fills one string for all values and slices it, so there's one
+// allocation for the batch instead of one for each value.
+func (g *StrFillAz) WriteBatch(dst []interface{}, _ RunCount) {
+	s := g.fill(g.len * int64(len(dst)))
+	for i := range dst {
+		dst[i] = s[int64(i)*g.len : int64(i+1)*g.len]
+	}
+}
+
+// fill returns a string of n random letters.
+func (g *StrFillAz) fill(n int64) string {
 	sb := strings.Builder{}
-	sb.Grow(int(g.len))
+	sb.Grow(int(n))
 	// A src.Int63() generates 63 random bits, enough for letterIdxMax characters!
-	for i, cache, remain := g.len-1, g.src.Int63(), letterIdxMax; i >= 0; {
+	for i, cache, remain := n-1, g.src.Int63(), letterIdxMax; i >= 0; {
 		if remain == 0 {
 			cache, remain = g.src.Int63(), letterIdxMax
 		}
@@ -65,5 +82,5 @@ func (g *StrFillAz) Values(_ RunCount) []interface{} {
 		cache >>= letterIdxBits
 		remain--
 	}
-	return []interface{}{sb.String()}
+	return sb.String()
 }
@@ -31,3 +31,14 @@ func TestString_StrFillAz(t *testing.T) {
 		}
 	}
 }
+
+func TestString_StrFillAzBatch(t *testing.T) {
+	g, _ := data.NewStrFillAz(map[string]string{"len": "5"})
+	dst := make([]interface{}, 3)
+	g.WriteBatch(dst, data.RunCount{})
+	for i := range dst {
+		if s := dst[i].(string); len(s) != 5 {
+			t.Errorf("value %d: got len %d, expected 5: %s", i, len(s), s)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Block, Inc.
+
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// Table implements the table data generator: table names PREFIX1..PREFIXn
+// selected round-robin or randomly. It's used in place of a table name in SQL
+// to run one trx file against many tables, like "SELECT c FROM @t WHERE ...".
+// The default scope is iter (see trx.File) so every statement in an iteration
+// uses the same table.
+type Table struct {
+	names  []string
+	vals   []interface{} // names as interface values, boxed once
+	random bool
+	n      int  // next table (round-robin)
+	init   bool // n set on first call
+	params map[string]string
+}
+
+var _ Generator = &Table{}
+
+const (
+	TABLE_ROUND_ROBIN = "round-robin"
+	TABLE_RANDOM      = "random"
+)
+
+func NewTable(params map[string]string) (*Table, error) {
+	var tables int64
+	if err := int64From(params, "tables", &tables, true); err != nil {
+		return nil, err
+	}
+	if tables < 1 {
+		return nil, fmt.Errorf("invalid table: tables (%d) < 1", tables)
+	}
+	begin := int64(1)
+	if err := int64From(params, "begin", &begin, false); err != nil {
+		return nil, err
+	}
+	prefix := params["prefix"]
+	if prefix == "" {
+		prefix = "t"
+	}
+
+	g := &Table{
+		names:  make([]string, tables),
+		params: params,
+	}
+	g.vals = make([]interface{}, tables)
+	for i := range g.names {
+		g.names[i] = prefix + strconv.FormatInt(begin+int64(i), 10)
+		g.vals[i] = g.names[i]
+	}
+
+	switch params["select"] {
+	case "", TABLE_ROUND_ROBIN:
+	case TABLE_RANDOM:
+		g.random = true
+	default:
+		return nil, fmt.Errorf("invalid table: select: %s: valid values are %s and %s", params["select"], TABLE_ROUND_ROBIN, TABLE_RANDOM)
+	}
+	return g, nil
+}
+
+func (g *Table) Name() string               { return "table" }
+func (g *Table) Format() (uint, string)     { return 1, "%s" }
+func (g *Table) Scan(any interface{}) error { return nil }
+
+func (g *Table) Copy() Generator {
+	c, _ := NewTable(g.params)
+	return c
+}
+
+func (g *Table) Values(rc RunCount) []interface{} { return values(g, 1, rc) }
+
+func (g *Table) WriteValues(dst []interface{}, rc RunCount) {
+	if g.random {
+		dst[0] = g.vals[rand.Intn(len(g.vals))]
+		return
+	}
+	// Client N (1-indexed in its client group) starts at table N so clients
+	// don't all start on the first table
+	if !g.init {
+		if rc[CLIENT] > 0 {
+			g.n = int(rc[CLIENT]-1) % len(g.names)
+		}
+		g.init = true
+	}
+	dst[0] = g.vals[g.n]
+	g.n = (g.n + 1) % len(g.names)
+}
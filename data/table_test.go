@@ -0,0 +1,52 @@
+// Copyright 2024 Block, Inc.
+
+package data_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/data"
+)
+
+func TestTable(t *testing.T) {
+	// Round-robin: client 2 starts at the second table
+	g, err := data.NewTable(map[string]string{"tables": "3", "prefix": "sbtest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := data.RunCount{}
+	r[data.CLIENT] = 2
+	got := []interface{}{}
+	for i := 0; i < 4; i++ {
+		got = append(got, g.Values(r)[0])
+	}
+	expect := []interface{}{"sbtest2", "sbtest3", "sbtest1", "sbtest2"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Random
+	g, err = data.NewTable(map[string]string{"tables": "2", "begin": "0", "select": "random"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		v := g.Values(r)[0]
+		if v != "t0" && v != "t1" {
+			t.Fatalf("got %v, expected t0 or t1", v)
+		}
+	}
+
+	invalid := []map[string]string{
+		{},
+		{"tables": "0"},
+		{"tables": "2", "select": "weighted"},
+	}
+	for _, params := range invalid {
+		if _, err := data.NewTable(params); err == nil {
+			t.Errorf("no error for params %v, expected one", params)
+		}
+	}
+}
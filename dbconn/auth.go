@@ -0,0 +1,38 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// loadPublicKey loads an RSA public key from a PEM file for
+// mysql.auth.server-public-key, like the mysql client --server-public-key-path.
+// The file is the server public_key.pem or the value of
+// caching_sha2_password_rsa_public_key.
+func loadPublicKey(file string) (*rsa.PublicKey, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return nil, fmt.Errorf("mysql.auth.server-public-key: %s: no PEM data", file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if rsaKey, err2 := x509.ParsePKCS1PublicKey(block.Bytes); err2 == nil {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("mysql.auth.server-public-key: %s: %s", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("mysql.auth.server-public-key: %s: not an RSA public key", file)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/dbconn"
+)
+
+func TestMake_Auth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "public_key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := false
+	tr := true
+	dbconn.SetConfig(config.MySQL{
+		Socket:   "/tmp/mysql.sock",
+		Username: "u",
+		Auth: config.Auth{
+			AllowCleartext:  &tr,
+			AllowNative:     &f,
+			ServerPublicKey: file,
+		},
+	})
+	db, dsn, err := dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	for _, param := range []string{"allowCleartextPasswords=true", "allowNativePasswords=false", "serverPubKey=benchmark"} {
+		if !strings.Contains(dsn, param) {
+			t.Errorf("DSN %s does not have %s", dsn, param)
+		}
+	}
+
+	// Not a PEM file
+	os.WriteFile(file, []byte("not a key"), 0600)
+	dbconn.SetConfig(config.MySQL{
+		Auth: config.Auth{ServerPublicKey: file},
+	})
+	if _, _, err := dbconn.Make(); err == nil {
+		t.Error("no error for invalid public key file, expected one")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The MySQL driver doesn't support protocol compression ("compression not
+// implemented yet"), so compressConn implements it below the driver: the
+// driver uses the uncompressed protocol, and compressConn sets the compression
+// capability in the handshake response and then compresses writes and
+// decompresses reads after the server OK. Only zlib is supported. It cannot
+// be used with TLS because the driver wraps the connection in TLS.
+//
+// Protocol: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_compression.html
+
+const (
+	clientCompress   = 0x00000020 // capability flag
+	minCompressBytes = 50         // smaller packets are sent uncompressed, like MySQL
+	maxPacketBytes   = 1<<24 - 1
+)
+
+func init() {
+	for _, n := range []string{"tcp", "unix", "pipe"} {
+		mysql.RegisterDialContext(n+"+zlib", dialCompress(n))
+	}
+}
+
+// dialCompress returns a driver dial func for the base network (tcp, unix, or
+// pipe) that returns a compressConn. The dial reads the server greeting to
+// return an error if the server doesn't support compression.
+func dialCompress(network string) mysql.DialContextFunc {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr) // shape.go
+		if err != nil {
+			return nil, err
+		}
+
+		c := &compressConn{Conn: conn}
+		if err := c.readPacket(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if !serverCompress(c.r[4:]) {
+			conn.Close()
+			return nil, fmt.Errorf("mysql.compress: MySQL server %s does not support compression", addr)
+		}
+		return c, nil
+	}
+}
+
+// serverCompress returns true if the server greeting (protocol v10) has the
+// compression capability.
+func serverCompress(payload []byte) bool {
+	if len(payload) < 1 || payload[0] != 10 {
+		return false
+	}
+	i := bytes.IndexByte(payload[1:], 0) // server version: null-terminated
+	if i < 0 {
+		return false
+	}
+	p := 1 + i + 1 + 4 + 8 + 1 // version, conn ID, auth-plugin-data-part-1, filler
+	if len(payload) < p+2 {
+		return false
+	}
+	return binary.LittleEndian.Uint16(payload[p:])&clientCompress != 0
+}
+
+type compressConn struct {
+	net.Conn
+	handshake bool   // handshake response written
+	compress  bool   // server OK after handshake: compression on
+	seq       byte   // next compressed packet sequence ID
+	r         []byte // unread bytes for the driver
+	zbuf      bytes.Buffer
+}
+
+var _ net.Conn = &compressConn{}
+
+// readPacket reads one uncompressed packet (header and payload) into r.
+func (c *compressConn) readPacket() error {
+	var header [4]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return err
+	}
+	n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	c.r = make([]byte, 4+n)
+	copy(c.r, header[:])
+	_, err := io.ReadFull(c.Conn, c.r[4:])
+	return err
+}
+
+// readCompressed reads one compressed packet and decompresses its payload,
+// which is one or more uncompressed packets, into r.
+func (c *compressConn) readCompressed() error {
+	var header [7]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return err
+	}
+	n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	c.seq = header[3] + 1
+	size := int(header[4]) | int(header[5])<<8 | int(header[6])<<16
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return err
+	}
+	if size == 0 {
+		c.r = payload // not compressed
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	c.r = make([]byte, size)
+	_, err = io.ReadFull(zr, c.r)
+	return err
+}
+
+func (c *compressConn) Read(p []byte) (int, error) {
+	for len(c.r) == 0 {
+		var err error
+		if c.compress {
+			err = c.readCompressed()
+		} else {
+			err = c.readPacket()
+			// After the handshake response, the server sends auth switch or
+			// more data (0xFE, 0x01) until OK (0x00). Compression starts after OK.
+			if err == nil && c.handshake && len(c.r) > 4 && c.r[4] == 0x00 {
+				c.compress = true
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.r)
+	c.r = c.r[n:]
+	return n, nil
+}
+
+// Write writes p, which the driver always writes as one packet (header and
+// payload). Before compression, it sets the compression capability in the
+// handshake response.
+func (c *compressConn) Write(p []byte) (int, error) {
+	if !c.compress {
+		if !c.handshake && len(p) >= 8 {
+			p[4] |= clientCompress // client capabilities (lower byte)
+			c.handshake = true
+		}
+		return c.Conn.Write(p)
+	}
+	if len(p) >= 4 && p[3] == 0 {
+		c.seq = 0 // new command
+	}
+	for off := 0; off < len(p); off += maxPacketBytes {
+		end := off + maxPacketBytes
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := c.writeCompressed(p[off:end]); err != nil {
+			return off, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *compressConn) writeCompressed(b []byte) error {
+	payload := b
+	size := 0 // 0 = not compressed
+	if len(b) >= minCompressBytes {
+		c.zbuf.Reset()
+		zw := zlib.NewWriter(&c.zbuf)
+		zw.Write(b)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if c.zbuf.Len() < len(b) {
+			payload = c.zbuf.Bytes()
+			size = len(b)
+		}
+	}
+	pkt := make([]byte, 7+len(payload))
+	pkt[0], pkt[1], pkt[2] = byte(len(payload)), byte(len(payload)>>8), byte(len(payload)>>16)
+	pkt[3] = c.seq
+	pkt[4], pkt[5], pkt[6] = byte(size), byte(size>>8), byte(size>>16)
+	copy(pkt[7:], payload)
+	c.seq++
+	_, err := c.Conn.Write(pkt)
+	return err
+}
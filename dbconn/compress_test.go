@@ -0,0 +1,113 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+// Fake MySQL server: greeting, handshake response, OK, then one compressed
+// command and compressed response.
+func TestCompressConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	query := append([]byte{0x03}, bytes.Repeat([]byte("SELECT 1 "), 20)...) // COM_QUERY
+	serverErr := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err.Error()
+			return
+		}
+		defer conn.Close()
+
+		// Greeting: protocol 10, version, conn ID, auth data, filler, capabilities (with compress)
+		g := []byte{10}
+		g = append(g, []byte("8.0.0\x00")...)
+		g = append(g, 1, 0, 0, 0)
+		g = append(g, make([]byte, 8+1)...)
+		g = append(g, clientCompress, 0)
+		conn.Write(append([]byte{byte(len(g)), 0, 0, 0}, g...))
+
+		// Handshake response must have compress capability
+		var h [4]byte
+		io.ReadFull(conn, h[:])
+		resp := make([]byte, int(h[0]))
+		io.ReadFull(conn, resp)
+		if resp[0]&clientCompress == 0 {
+			serverErr <- "compress capability not set in handshake response"
+			return
+		}
+		conn.Write([]byte{7, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0}) // OK
+
+		// Compressed COM_QUERY
+		var ch [7]byte
+		io.ReadFull(conn, ch[:])
+		if ch[3] != 0 {
+			serverErr <- "compressed seq not 0"
+			return
+		}
+		payload := make([]byte, int(ch[0])|int(ch[1])<<8|int(ch[2])<<16)
+		io.ReadFull(conn, payload)
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			serverErr <- err.Error()
+			return
+		}
+		pkt, _ := io.ReadAll(zr)
+		if !bytes.Equal(pkt[4:], query) {
+			serverErr <- "wrong query: " + string(pkt)
+			return
+		}
+
+		// Uncompressed (size 0) OK response, compressed seq 1
+		ok := []byte{7, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0}
+		conn.Write(append([]byte{byte(len(ok)), 0, 0, 1, 0, 0, 0}, ok...))
+		serverErr <- ""
+	}()
+
+	conn, err := dialCompress("tcp")(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	read := func() []byte {
+		var h [4]byte
+		if _, err := io.ReadFull(conn, h[:]); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, int(h[0]))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	read() // greeting
+	resp := append([]byte{32, 0, 0, 1}, make([]byte, 32)...)
+	if _, err := conn.Write(resp); err != nil {
+		t.Fatal(err)
+	}
+	if b := read(); b[0] != 0x00 {
+		t.Fatalf("got packet %x, expected OK", b)
+	}
+	if _, err := conn.Write(append([]byte{byte(len(query)), 0, 0, 0}, query...)); err != nil {
+		t.Fatal(err)
+	}
+	if b := read(); b[0] != 0x00 {
+		t.Errorf("got packet %x, expected OK", b)
+	}
+	if msg := <-serverErr; msg != "" {
+		t.Error(msg)
+	}
+}
@@ -0,0 +1,8 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	_ "github.com/ClickHouse/clickhouse-go/v2" // mysql.flavor: clickhouse
+	_ "modernc.org/sqlite"                     // mysql.flavor: sqlite (pure Go, no cgo)
+)
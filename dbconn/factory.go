@@ -4,10 +4,12 @@
 package dbconn
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"regexp"
@@ -18,30 +20,128 @@ import (
 	"github.com/square/finch"
 	"github.com/square/finch/aws"
 	"github.com/square/finch/config"
+	"github.com/square/finch/mysqlx"
 )
 
 // rdsAddr matches Amazon RDS hostnames with optional :port suffix.
 // It's used to automatically load the Amazon RDS CA and enable TLS,
 // unless config.aws.disable-auto-tls is true.
-var rdsAddr = regexp.MustCompile(`rds\.amazonaws\.com(:\d+)?$`)
+var rdsAddr = config.RDSAddr
 
 // portSuffix matches optional :port suffix on addresses. It's used to
 // strip the port suffix before passing the hostname to LoadTLS.
 var portSuffix = regexp.MustCompile(`:\d+$`)
 
-var f = &factory{}
+// Drivers are the database/sql driver names for mysql.flavor values that aren't
+// MySQL. Finch includes modernc.org/sqlite ("sqlite") and
+// github.com/ClickHouse/clickhouse-go/v2 ("clickhouse"): see drivers.go. A
+// custom build can set the name for another driver, like "sqlite3" for
+// github.com/mattn/go-sqlite3. mysql.dsn is passed to the driver as-is.
+var Drivers = map[string]string{
+	config.FLAVOR_SQLITE:     "sqlite",
+	config.FLAVOR_CLICKHOUSE: "clickhouse",
+}
+
+var f = &factory{tlsName: "benchmark"}
 
 type factory struct {
-	cfg config.MySQL
-	dsn string
+	cfg     config.MySQL
+	dsn     string
+	conn    *connector // if mysql.secret.refresh
+	tlsName string     // registered TLS config name
+	targets map[string]*factory
 }
 
 func SetConfig(cfg config.MySQL) {
 	f.cfg = cfg
 	f.dsn = ""
+	f.conn = nil
+	f.tlsName = "benchmark"
+	f.targets = nil
 }
 
+// SetTargets sets the named targets (config.stage.targets) for MakeTarget.
+// Call it after SetConfig, which clears the targets.
+func SetTargets(targets map[string]config.MySQL) {
+	f.targets = make(map[string]*factory, len(targets))
+	for name, cfg := range targets {
+		f.targets[name] = &factory{
+			cfg:     cfg,
+			tlsName: "benchmark-" + name,
+		}
+	}
+}
+
+// Make makes a new *sql.DB for the MySQL config set by SetConfig. It also
+// returns the DSN with the password redacted.
 func Make() (*sql.DB, string, error) {
+	return f.make()
+}
+
+// MakeTarget is like Make but for the named target set by SetTargets. If the
+// name is empty, it's the same as Make.
+func MakeTarget(name string) (*sql.DB, string, error) {
+	if name == "" {
+		return f.make()
+	}
+	t, ok := f.targets[name]
+	if !ok {
+		return nil, "", fmt.Errorf("target %s not set", name)
+	}
+	return t.make()
+}
+
+// MakeDb is like MakeTarget but connections use database db instead of mysql.db.
+// Proxies (mysql.flavor vitess or proxysql) route on the connection database,
+// and ClickHouse over HTTP has no session for USE, so it's used for workload.db
+// instead of USE (see config.MySQL.ClientPrepare).
+func MakeDb(target, db string) (*sql.DB, string, error) {
+	t := f
+	if target != "" {
+		var ok bool
+		if t, ok = f.targets[target]; !ok {
+			return nil, "", fmt.Errorf("target %s not set", target)
+		}
+	}
+	if t.dsn == "" {
+		if err := t.setDSN(); err != nil {
+			return nil, "", err
+		}
+	}
+	dsn := withDb(t.dsn, db)
+	if _, ok := Drivers[t.cfg.Flavor]; ok {
+		return openDriver(t.cfg.Flavor, dsn)
+	}
+	finch.Debug("dsn: %s", RedactedDSN(dsn))
+	if t.conn != nil {
+		conn := *t.conn
+		conn.dsn = withDb(conn.dsn, db)
+		return sql.OpenDB(conn), RedactedDSN(dsn), nil
+	}
+	sqlDb, err := sql.Open(t.driver(), dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	return sqlDb, RedactedDSN(dsn), nil
+}
+
+// withDb returns the DSN with database db. Like the driver, the database is
+// after the last "/" and before "?", if any.
+func withDb(dsn, db string) string {
+	i := strings.LastIndex(dsn, "/")
+	if i < 0 {
+		return dsn
+	}
+	rest := dsn[i+1:]
+	if j := strings.IndexByte(rest, '?'); j >= 0 {
+		rest = rest[j:]
+	} else {
+		rest = ""
+	}
+	return dsn[:i+1] + db + rest
+}
+
+func (f *factory) make() (*sql.DB, string, error) {
 	// Parse MySQL params and set DSN on first call. There's only 1 DSN for
 	// all clients, so this only needs to be done once.
 	if f.dsn == "" {
@@ -49,21 +149,72 @@ func Make() (*sql.DB, string, error) {
 			return nil, "", err
 		}
 	}
+
+	// Not MySQL (mysql.flavor sqlite or clickhouse): mysql.dsn is for the driver,
+	// which must be in the build
+	if _, ok := Drivers[f.cfg.Flavor]; ok {
+		return openDriver(f.cfg.Flavor, f.dsn)
+	}
+
 	finch.Debug("dsn: %s", RedactedDSN(f.dsn))
 
+	// With mysql.secret.refresh, the connector resolves the secret on connect
+	// so new connections use rotated credentials
+	if f.conn != nil {
+		return sql.OpenDB(*f.conn), RedactedDSN(f.dsn), nil
+	}
+
 	// Make new sql.DB (conn pool) for each client group; see the call to
 	// this func in workload/workload.go.
-	db, err := sql.Open("mysql", f.dsn)
+	db, err := sql.Open(f.driver(), f.dsn)
 	if err != nil {
 		return nil, "", err
 	}
 	return db, RedactedDSN(f.dsn), nil
 }
 
+// driver returns the database/sql driver name for mysql.protocol: "mysqlx" for
+// the X Protocol (see package mysqlx), else "mysql". Both use the same DSN format.
+func (f *factory) driver() string {
+	if f.cfg.Protocol == config.PROTOCOL_X {
+		return "mysqlx"
+	}
+	return "mysql"
+}
+
+// openDriver opens dsn with the driver for flavor (Drivers). It returns an error
+// if the driver isn't registered because Finch was built without it. The DSN
+// is returned as-is because driver DSN formats vary, so it can't be redacted.
+func openDriver(flavor, dsn string) (*sql.DB, string, error) {
+	name := Drivers[flavor]
+	registered := false
+	for _, d := range sql.Drivers() {
+		if d == name {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return nil, "", fmt.Errorf("mysql.flavor: %s requires database/sql driver %s, but Finch was built without it: build Finch with the driver (see dbconn.Drivers)", flavor, name)
+	}
+	db, err := sql.Open(name, dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	return db, dsn, nil
+}
+
 func (f *factory) setDSN() error {
 	// --dsn or mysql.dsn (in that order) overrides all
 	if f.cfg.DSN != "" {
 		f.dsn = f.cfg.DSN
+		if f.cfg.Proxy() && !strings.Contains(f.dsn, "interpolateParams=") {
+			if strings.Contains(f.dsn, "?") {
+				f.dsn += "&interpolateParams=true"
+			} else {
+				f.dsn += "?interpolateParams=true"
+			}
+		}
 		return nil
 	}
 
@@ -84,19 +235,25 @@ func (f *factory) setDSN() error {
 	}
 
 	// ----------------------------------------------------------------------
-	// TCP or Unix socket
+	// TCP, Unix socket, or Windows named pipe
 
 	net := ""
 	addr := ""
 	if f.cfg.Socket != "" {
 		net = "unix"
 		addr = f.cfg.Socket
+	} else if f.cfg.Pipe != "" {
+		net = "pipe" // registered in init below
+		addr = f.cfg.Pipe
 	} else {
 		net = "tcp"
 		if f.cfg.Hostname == "" {
 			f.cfg.Hostname = "127.0.0.1"
 		}
 		addr = f.cfg.Hostname
+		if f.cfg.Protocol == config.PROTOCOL_X && !portSuffix.MatchString(addr) {
+			addr += ":" + mysqlx.DEFAULT_PORT // else the DSN default is 3306
+		}
 	}
 
 	// ----------------------------------------------------------------------
@@ -104,11 +261,16 @@ func (f *factory) setDSN() error {
 
 	params := []string{"parseTime=true"}
 
+	// Proxies: prepare statements client-side (see client.Client.ClientPrepare)
+	if f.cfg.Proxy() {
+		params = append(params, "interpolateParams=true")
+	}
+
 	// Go says "either ServerName or InsecureSkipVerify must be specified".
-	// This is a pathological case: socket and TLS but no hostname to verify
+	// This is a pathological case: socket (or pipe) and TLS but no hostname to verify
 	// and user didn't explicitly set skip-verify=true. So we set this latter
 	// automatically because Go will certainly error if we don't.
-	if net == "unix" && f.cfg.TLS.Set() && f.cfg.Hostname == "" && !config.True(f.cfg.TLS.SkipVerify) {
+	if net != "tcp" && f.cfg.TLS.Set() && f.cfg.Hostname == "" && f.cfg.TLS.ServerName == "" && !config.True(f.cfg.TLS.SkipVerify) {
 		b := true
 		f.cfg.TLS.SkipVerify = &b
 		finch.Debug("auto-enabled skip-verify on socket with TLS but no hostname")
@@ -120,18 +282,57 @@ func (f *factory) setDSN() error {
 		return err
 	}
 	if tlsConfig != nil {
-		mysql.RegisterTLSConfig("benchmark", tlsConfig)
-		params = append(params, "tls=benchmark")
+		mysql.RegisterTLSConfig(f.tlsName, tlsConfig)
+		params = append(params, "tls="+f.tlsName)
 		finch.Debug("TLS enabled")
 	}
 
 	// Use built-in Amazon RDS CA
-	if rdsAddr.MatchString(addr) && !config.True(f.cfg.DisableAutoTLS) && tlsConfig == nil {
+	if rdsAddr.MatchString(addr) && !config.True(f.cfg.DisableAutoTLS) && tlsConfig == nil && f.cfg.Protocol != config.PROTOCOL_X {
 		finch.Debug("auto AWS TLS: hostname has suffix .rds.amazonaws.com")
 		aws.RegisterRDSCA() // safe to call multiple times
 		params = append(params, "tls=rds")
 	}
 
+	// ----------------------------------------------------------------------
+	// Authentication plugins (see auth.go)
+
+	// mysql_clear_password sends the password as-is, which PAM and LDAP
+	// require, so it should only be used with TLS or a socket
+	if config.True(f.cfg.Auth.AllowCleartext) {
+		params = append(params, "allowCleartextPasswords=true")
+		if net == "tcp" && tlsConfig == nil && !rdsAddr.MatchString(addr) {
+			log.Println("WARNING: mysql.auth.allow-cleartext without TLS: the password is sent in cleartext")
+		}
+	}
+	if f.cfg.Auth.AllowNative != nil && !*f.cfg.Auth.AllowNative {
+		params = append(params, "allowNativePasswords=false")
+	}
+
+	// Without a server public key, the driver requests it from the server for
+	// caching_sha2_password and sha256_password full authentication without TLS,
+	// which trusts the server
+	if f.cfg.Auth.ServerPublicKey != "" {
+		key, err := loadPublicKey(f.cfg.Auth.ServerPublicKey)
+		if err != nil {
+			return err
+		}
+		mysql.RegisterServerPubKey(f.tlsName, key)
+		params = append(params, "serverPubKey="+f.tlsName)
+		finch.Debug("server public key: %s", f.cfg.Auth.ServerPublicKey)
+	}
+
+	// ----------------------------------------------------------------------
+	// Compression (see compress.go)
+
+	if f.cfg.Compress != "" {
+		if tlsConfig != nil || (rdsAddr.MatchString(addr) && !config.True(f.cfg.DisableAutoTLS)) {
+			return fmt.Errorf("mysql.compress does not work with TLS; set mysql.disable-auto-tls=true for Amazon RDS")
+		}
+		net += "+" + f.cfg.Compress // registered in compress.go
+		finch.Debug("compression: %s", f.cfg.Compress)
+	}
+
 	// ----------------------------------------------------------------------
 	// Credentials (user:pass)
 
@@ -144,6 +345,24 @@ func (f *factory) setDSN() error {
 		password = string(bytes)
 	}
 
+	// mysql.secret overrides password and password-file, and sets the username
+	// if the secret has one and mysql.username is not set
+	username := f.cfg.Username
+	if f.cfg.Secret.Source != "" {
+		sec := newSecret(f.cfg.Secret)
+		secretUsername, secretPassword, err := sec.credentials(context.Background())
+		if err != nil {
+			return err
+		}
+		password = secretPassword
+		if f.cfg.Username == "" {
+			f.cfg.Username = secretUsername
+		}
+		if f.cfg.Secret.Refresh != "" {
+			f.conn = &connector{username: username, secret: sec, x: f.cfg.Protocol == config.PROTOCOL_X}
+		}
+	}
+
 	if f.cfg.Username == "" {
 		f.cfg.Username = "finch" // default username
 		finch.Debug("using default MySQL username")
@@ -160,9 +379,14 @@ func (f *factory) setDSN() error {
 	// ----------------------------------------------------------------------
 	// Set DSN
 
-	f.dsn = fmt.Sprintf("%s@%s(%s)/%s", cred, net, addr, f.cfg.Db)
+	dsn := fmt.Sprintf("@%s(%s)/%s", net, addr, f.cfg.Db)
 	if len(params) > 0 {
-		f.dsn += "?" + strings.Join(params, "&")
+		dsn += "?" + strings.Join(params, "&")
+	}
+	f.dsn = cred + dsn
+	if f.conn != nil {
+		f.conn.defaultUsername = f.cfg.Username
+		f.conn.dsn = dsn
 	}
 
 	return nil
@@ -239,4 +463,5 @@ func (n null) Print(v ...interface{}) {}
 
 func init() {
 	mysql.SetLogger(null{})
+	mysql.RegisterDialContext("pipe", dialPipe)
 }
@@ -3,6 +3,9 @@
 package dbconn_test
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -10,6 +13,7 @@ import (
 
 	"github.com/square/finch/config"
 	"github.com/square/finch/dbconn"
+	"github.com/square/finch/mysqlx"
 	"github.com/square/finch/test"
 )
 
@@ -90,3 +94,180 @@ func TestMake_Config(t *testing.T) {
 		t.Errorf("SELECT @@version: got %s, expected 8.0.34", got)
 	}
 }
+
+func TestMakeDb(t *testing.T) {
+	dbconn.SetConfig(config.MySQL{
+		Hostname: "127.0.0.1:3306",
+		Username: "finch",
+		Password: "pw",
+		Db:       "a",
+		Flavor:   config.FLAVOR_PROXYSQL,
+	})
+	db, dsn, err := dbconn.MakeDb("", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBName != "b" {
+		t.Errorf("got db %s, expected b (DSN: %s)", cfg.DBName, dsn)
+	}
+	if !cfg.InterpolateParams {
+		t.Errorf("interpolateParams not set with proxysql flavor (DSN: %s)", dsn)
+	}
+
+	// Connections from Make use mysql.db
+	db, dsn, err = dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if !strings.Contains(dsn, "/a?") {
+		t.Errorf("Make DSN %s does not have db a", dsn)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	dbconn.SetConfig(config.MySQL{
+		Hostname: "127.0.0.1:3306",
+		Username: "finch",
+		Password: "pw",
+		Db:       "a",
+	})
+	key, err := dbconn.HandoffKey("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := dbconn.HandoffKey("", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == keyB {
+		t.Fatalf("same key for db a and b: %s", key)
+	}
+
+	db1, _, err := dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2, _, err := dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbconn.Keep(key, db1)
+	dbconn.Keep(key, db2)
+
+	// Next stage with same config (so same DSN) takes the first, but not for
+	// a different DSN
+	dbconn.SetConfig(config.MySQL{
+		Hostname: "127.0.0.1:3306",
+		Username: "finch",
+		Password: "pw",
+		Db:       "a",
+	})
+	key2, _ := dbconn.HandoffKey("", "")
+	if key2 != key {
+		t.Fatalf("got key %s, expected %s", key2, key)
+	}
+	if got := dbconn.Take(keyB); got != nil {
+		t.Error("took db for different DSN")
+	}
+	if got := dbconn.Take(key2); got != db1 {
+		t.Error("did not take first db kept")
+	}
+	if n := dbconn.CloseKept(); n != 1 {
+		t.Errorf("closed %d, expected 1 (db2 not taken)", n)
+	}
+	if got := dbconn.Take(key2); got != nil {
+		t.Error("took db after CloseKept")
+	}
+	db1.Close()
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestMake_SQLite(t *testing.T) {
+	dbconn.SetConfig(config.MySQL{
+		DSN:    "dev.db",
+		Flavor: config.FLAVOR_SQLITE,
+	})
+	defer func(name string) { dbconn.Drivers[config.FLAVOR_SQLITE] = name }(dbconn.Drivers[config.FLAVOR_SQLITE])
+
+	// Driver not registered
+	dbconn.Drivers[config.FLAVOR_SQLITE] = "finch-test-sqlite"
+	if _, _, err := dbconn.Make(); err == nil {
+		t.Error("no error without SQLite driver, expected one")
+	}
+
+	// Custom build registers another SQLite driver
+	sql.Register("finch-test-sqlite", testDriver{})
+	db, dsn, err := dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if dsn != "dev.db" {
+		t.Errorf("got DSN %s, expected dev.db", dsn)
+	}
+}
+
+func TestMakeDb_ClickHouse(t *testing.T) {
+	dbconn.SetConfig(config.MySQL{
+		DSN:    "http://127.0.0.1:8123/a?compress=1",
+		Flavor: config.FLAVOR_CLICKHOUSE,
+	})
+	// Finch includes the ClickHouse driver (dbconn/drivers.go), and workload.db
+	// is the connection database (HTTP has no USE)
+	db, dsn, err := dbconn.MakeDb("", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if dsn != "http://127.0.0.1:8123/b?compress=1" {
+		t.Errorf("got DSN %s, expected http://127.0.0.1:8123/b?compress=1", dsn)
+	}
+}
+
+func TestMake_X(t *testing.T) {
+	// X Protocol port is the default, not 3306
+	dbconn.SetConfig(config.MySQL{
+		Hostname: "db1",
+		Username: "u",
+		Password: "p",
+		Protocol: config.PROTOCOL_X,
+	})
+	db, dsn, err := dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, ok := db.Driver().(mysqlx.Driver); !ok {
+		t.Errorf("got driver %T, expected mysqlx.Driver", db.Driver())
+	}
+	if !strings.Contains(dsn, "@tcp(db1:33060)/") {
+		t.Errorf("got DSN %s, expected tcp(db1:33060)", dsn)
+	}
+
+	// Explicit port
+	dbconn.SetConfig(config.MySQL{
+		Hostname: "db1:3307",
+		Username: "u",
+		Password: "p",
+		Protocol: config.PROTOCOL_X,
+	})
+	db, dsn, err = dbconn.Make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !strings.Contains(dsn, "@tcp(db1:3307)/") {
+		t.Errorf("got DSN %s, expected tcp(db1:3307)", dsn)
+	}
+}
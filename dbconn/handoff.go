@@ -0,0 +1,80 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// Stages hand off connections (config.stage.handoff) by keeping the *sql.DB of
+// each client group when the stage finishes: clients close their connections,
+// which returns them to the idle pool of the *sql.DB instead of disconnecting
+// (if its max idle connections is large enough). The next stage takes a kept
+// *sql.DB for a client group with the same DSN, so its clients reuse the idle
+// connections instead of reconnecting all at once. Kept *sql.DB are keyed by
+// DSN, which HandoffKey returns.
+
+var (
+	kept    = map[string][]*sql.DB{}
+	keptMux sync.Mutex
+)
+
+// HandoffKey returns the key for Keep and Take: the DSN that MakeDb(target, db)
+// uses, or MakeTarget(target) if db is empty. It must be called after SetConfig
+// and SetTargets for the stage.
+func HandoffKey(target, db string) (string, error) {
+	t := f
+	if target != "" {
+		var ok bool
+		if t, ok = f.targets[target]; !ok {
+			return "", nil // MakeTarget returns the error
+		}
+	}
+	if t.dsn == "" {
+		if err := t.setDSN(); err != nil {
+			return "", err
+		}
+	}
+	if db == "" {
+		return t.dsn, nil
+	}
+	return withDb(t.dsn, db), nil
+}
+
+// Keep keeps db for the next stage to Take.
+func Keep(key string, db *sql.DB) {
+	keptMux.Lock()
+	kept[key] = append(kept[key], db)
+	keptMux.Unlock()
+}
+
+// Take returns a *sql.DB kept by the previous stage for the same key, or nil if
+// none.
+func Take(key string) *sql.DB {
+	keptMux.Lock()
+	defer keptMux.Unlock()
+	dbs := kept[key]
+	if len(dbs) == 0 {
+		return nil
+	}
+	db := dbs[0]
+	kept[key] = dbs[1:]
+	return db
+}
+
+// CloseKept closes every *sql.DB that was kept but not taken, which closes
+// their idle connections. It returns the number closed.
+func CloseKept() int {
+	keptMux.Lock()
+	defer keptMux.Unlock()
+	n := 0
+	for key, dbs := range kept {
+		for _, db := range dbs {
+			db.Close()
+			n++
+		}
+		delete(kept, key)
+	}
+	return n
+}
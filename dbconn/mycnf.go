@@ -32,6 +32,13 @@ func ParseMyCnf(file string) (config.MySQL, error) {
 		cfg.Hostname += ":" + port
 	}
 
+	// Authentication plugin options (config.Auth)
+	if mycnf.Section("client").HasKey("enable-cleartext-plugin") {
+		b, _ := mycnf.Section("client").Key("enable-cleartext-plugin").Bool()
+		cfg.Auth.AllowCleartext = &b
+	}
+	cfg.Auth.ServerPublicKey = mycnf.Section("client").Key("server-public-key-path").String()
+
 	// Translate MySQL ssl-* vars to config.TLS. The vars don't line up
 	// perfectly because MySQL has several levels of TLS verification:
 	//   https://dev.mysql.com/doc/refman/8.0/en/connection-options.html#option_general_ssl-mode
@@ -0,0 +1,33 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// pipePath returns the full Windows named pipe path: mysql.pipe can be the
+// pipe name, like "MySQL", or the full path, like `\\.\pipe\MySQL`.
+func pipePath(name string) string {
+	if strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\pipe\` + name
+}
+
+// pipeConn is a net.Conn for a Windows named pipe opened as a file.
+type pipeConn struct {
+	*os.File
+}
+
+var _ net.Conn = pipeConn{}
+
+func (c pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.Name()) }
+func (c pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.Name()) }
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
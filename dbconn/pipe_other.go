@@ -0,0 +1,15 @@
+// Copyright 2024 Block, Inc.
+
+//go:build !windows
+
+package dbconn
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+func dialPipe(ctx context.Context, addr string) (net.Conn, error) {
+	return nil, fmt.Errorf("mysql.pipe %s: named pipes are supported only on Windows; use mysql.socket", addr)
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Block, Inc.
+
+//go:build windows
+
+package dbconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// errPipeBusy is ERROR_PIPE_BUSY: all pipe instances are busy.
+const errPipeBusy = syscall.Errno(231)
+
+// dialPipe opens the Windows named pipe. If all pipe instances are busy, it
+// retries until ctx is done, like the MySQL client.
+func dialPipe(ctx context.Context, addr string) (net.Conn, error) {
+	path := pipePath(addr)
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err == nil {
+			return pipeConn{f}, nil
+		}
+		if !errors.Is(err, errPipeBusy) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
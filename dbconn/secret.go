@@ -0,0 +1,199 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/mysqlx"
+)
+
+// secret resolves MySQL credentials from config.mysql.secret. The credentials
+// are cached until the refresh period (if any) elapses, then resolved again on
+// the next connect so that rotated credentials are used for new connections.
+type secret struct {
+	cfg     config.Secret
+	refresh time.Duration
+	*sync.Mutex
+	// --
+	username string
+	password string
+	at       time.Time // when resolved
+}
+
+func newSecret(cfg config.Secret) *secret {
+	s := &secret{
+		cfg:   cfg,
+		Mutex: &sync.Mutex{},
+	}
+	if cfg.Refresh != "" {
+		s.refresh, _ = time.ParseDuration(cfg.Refresh) // already validated
+	}
+	return s
+}
+
+// credentials returns the username (empty if the secret doesn't have one)
+// and password.
+func (s *secret) credentials(ctx context.Context) (string, string, error) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.at.IsZero() && (s.refresh == 0 || time.Since(s.at) < s.refresh) {
+		return s.username, s.password, nil // cached
+	}
+
+	val, err := s.fetch(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("mysql.secret %s %s: %s", s.cfg.Source, s.cfg.Name, err)
+	}
+
+	// A JSON object has username and password keys, else the whole value is
+	// the password
+	username := ""
+	password := strings.TrimSpace(val)
+	var obj map[string]interface{}
+	if strings.HasPrefix(password, "{") && json.Unmarshal([]byte(password), &obj) == nil {
+		if data, ok := obj["data"].(map[string]interface{}); ok && s.cfg.Source == config.SECRET_VAULT {
+			obj = data // Vault KV v1 response: {"data": {...}}
+			if data, ok := obj["data"].(map[string]interface{}); ok {
+				obj = data // Vault KV v2 response: {"data": {"data": {...}}}
+			}
+		}
+		p, ok := obj[s.cfg.PasswordKey]
+		if !ok {
+			return "", "", fmt.Errorf("mysql.secret %s %s: no %s key", s.cfg.Source, s.cfg.Name, s.cfg.PasswordKey)
+		}
+		password = fmt.Sprintf("%v", p)
+		if u, ok := obj[s.cfg.UsernameKey]; ok {
+			username = fmt.Sprintf("%v", u)
+		}
+	}
+	finch.Debug("resolved mysql.secret %s %s (username %s)", s.cfg.Source, s.cfg.Name, username)
+
+	s.username = username
+	s.password = password
+	s.at = time.Now()
+	return s.username, s.password, nil
+}
+
+// fetch returns the raw secret value from the source.
+func (s *secret) fetch(ctx context.Context) (string, error) {
+	switch s.cfg.Source {
+	case config.SECRET_ENV:
+		val, ok := os.LookupEnv(s.cfg.Name)
+		if !ok {
+			return "", fmt.Errorf("environment variable not set")
+		}
+		return val, nil
+	case config.SECRET_FILE:
+		b, err := os.ReadFile(s.cfg.Name)
+		return string(b), err
+	case config.SECRET_VAULT:
+		return s.vault(ctx)
+	case config.SECRET_AWS:
+		cmd := exec.CommandContext(ctx, "aws", "secretsmanager", "get-secret-value",
+			"--secret-id", s.cfg.Name, "--query", "SecretString", "--output", "text")
+		out, err := cmd.Output()
+		if err != nil {
+			if e, ok := err.(*exec.ExitError); ok {
+				return "", fmt.Errorf("aws secretsmanager: %s: %s", err, strings.TrimSpace(string(e.Stderr)))
+			}
+			return "", fmt.Errorf("aws secretsmanager: %s", err)
+		}
+		return string(out), nil
+	}
+	panic("invalid mysql.secret.source: " + s.cfg.Source) // already validated
+}
+
+// vault reads the secret from HashiCorp Vault at $VAULT_ADDR/v1/NAME using
+// the token from $VAULT_TOKEN or ~/.vault-token, like the vault CLI.
+func (s *secret) vault(ctx context.Context) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		b, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("VAULT_TOKEN not set and cannot read ~/.vault-token: %s", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(s.cfg.Name, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return string(b), nil
+}
+
+// --------------------------------------------------------------------------
+
+// connector makes new MySQL connections with the current secret credentials.
+// It's used when mysql.secret.refresh is set so that new connections use
+// rotated credentials.
+type connector struct {
+	username        string // mysql.username, else secret username
+	defaultUsername string // if neither ^ is set
+	dsn             string // DSN without credentials: "@tcp(addr)/db?params"
+	secret          *secret
+	x               bool // mysql.protocol: x
+}
+
+var _ driver.Connector = connector{}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	username, password, err := c.secret.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		username = c.username
+	} else if username == "" {
+		username = c.defaultUsername
+	}
+	mc, err := c.Driver().(driver.DriverContext).OpenConnector(username + ":" + password + c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return mc.Connect(ctx)
+}
+
+func (c connector) Driver() driver.Driver {
+	if c.x {
+		return mysqlx.Driver{}
+	}
+	return mysql.MySQLDriver{}
+}
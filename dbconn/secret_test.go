@@ -0,0 +1,141 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/square/finch/config"
+)
+
+func credentials(t *testing.T, cfg config.Secret) (string, string) {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	username, password, err := newSecret(cfg).credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return username, password
+}
+
+func TestSecret(t *testing.T) {
+	// Plain value is the password
+	t.Setenv("FINCH_TEST_SECRET", "s3cret\n")
+	u, p := credentials(t, config.Secret{Source: config.SECRET_ENV, Name: "FINCH_TEST_SECRET"})
+	if u != "" || p != "s3cret" {
+		t.Errorf("env: got %q %q, expected \"\" \"s3cret\"", u, p)
+	}
+
+	// JSON object with custom keys
+	file := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(file, []byte(`{"user":"bench","pass":"abc"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u, p = credentials(t, config.Secret{Source: config.SECRET_FILE, Name: file, UsernameKey: "user", PasswordKey: "pass"})
+	if u != "bench" || p != "abc" {
+		t.Errorf("file: got %q %q, expected \"bench\" \"abc\"", u, p)
+	}
+
+	// Vault KV v2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/finch" || r.Header.Get("X-Vault-Token") != "tok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"username":"vu","password":"vp"},"metadata":{}}}`))
+	}))
+	defer ts.Close()
+	t.Setenv("VAULT_ADDR", ts.URL)
+	t.Setenv("VAULT_TOKEN", "tok")
+	u, p = credentials(t, config.Secret{Source: config.SECRET_VAULT, Name: "secret/data/finch"})
+	if u != "vu" || p != "vp" {
+		t.Errorf("vault: got %q %q, expected \"vu\" \"vp\"", u, p)
+	}
+
+	// Errors: env not set, JSON without password key, Vault denied
+	invalid := []config.Secret{
+		{Source: config.SECRET_ENV, Name: "FINCH_TEST_SECRET_NOT_SET"},
+		{Source: config.SECRET_FILE, Name: file},
+		{Source: config.SECRET_VAULT, Name: "secret/data/other"},
+	}
+	for i, cfg := range invalid {
+		cfg.Validate()
+		if _, _, err := newSecret(cfg).credentials(context.Background()); err == nil {
+			t.Errorf("invalid secret %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestSecret_Refresh(t *testing.T) {
+	t.Setenv("FINCH_TEST_SECRET", "one")
+	cfg := config.Secret{Source: config.SECRET_ENV, Name: "FINCH_TEST_SECRET", Refresh: "1ms"}
+	cfg.Validate()
+	s := newSecret(cfg)
+	_, p, _ := s.credentials(context.Background())
+	if p != "one" {
+		t.Fatalf("got password %q, expected \"one\"", p)
+	}
+	os.Setenv("FINCH_TEST_SECRET", "two")
+	time.Sleep(5 * time.Millisecond)
+	_, p, _ = s.credentials(context.Background())
+	if p != "two" {
+		t.Errorf("got password %q after refresh, expected \"two\"", p)
+	}
+
+	// Without refresh, the first value is cached
+	cfg.Refresh = ""
+	s = newSecret(cfg)
+	s.credentials(context.Background())
+	os.Setenv("FINCH_TEST_SECRET", "three")
+	_, p, _ = s.credentials(context.Background())
+	if p != "two" {
+		t.Errorf("got password %q without refresh, expected cached \"two\"", p)
+	}
+}
+
+func TestSecret_AWS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake aws CLI is a shell script")
+	}
+
+	// No aws CLI in PATH is a config error
+	t.Setenv("PATH", t.TempDir())
+	cfg := config.Secret{Source: config.SECRET_AWS, Name: "finch/db"}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("no error when aws CLI not in PATH, expected one")
+	}
+
+	// Fake aws CLI that prints the secret only for the expected args
+	bin := t.TempDir()
+	script := `#!/bin/sh
+if [ "$*" = "secretsmanager get-secret-value --secret-id finch/db --query SecretString --output text" ]; then
+  echo '{"username":"au","password":"ap"}'
+  exit 0
+fi
+echo "unexpected args: $*" >&2
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(bin, "aws"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	u, p := credentials(t, config.Secret{Source: config.SECRET_AWS, Name: "finch/db"})
+	if u != "au" || p != "ap" {
+		t.Errorf("aws: got %q %q, expected \"au\" \"ap\"", u, p)
+	}
+
+	cfg = config.Secret{Source: config.SECRET_AWS, Name: "finch/other"}
+	cfg.Validate()
+	if _, _, err := newSecret(cfg).credentials(context.Background()); err == nil {
+		t.Errorf("aws CLI error: no error, expected one")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/time/rate"
+
+	"github.com/square/finch"
+)
+
+// Shape is network shaping for all MySQL connections on a compute instance
+// (--net-latency, --net-jitter, and --net-bandwidth) to model clients in other
+// zones or regions from a single lab. Latency is added once per round trip:
+// when the client writes after reading, which is when it sends a new request,
+// and once on connect.
+type Shape struct {
+	Latency   time.Duration // added per round trip
+	Jitter    time.Duration // random +/- latency
+	Bandwidth uint64        // bytes/s each direction; 0 = unlimited
+}
+
+func (s Shape) enabled() bool {
+	return s.Latency > 0 || s.Jitter > 0 || s.Bandwidth > 0
+}
+
+// delay returns latency +/- random jitter, but not less than zero.
+func (s Shape) delay() time.Duration {
+	d := s.Latency
+	if s.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*s.Jitter)+1)) - s.Jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+var shape Shape
+
+// SetShape sets network shaping for all new MySQL connections. Call it once
+// on startup, before connecting. It registers dial funcs for the driver networks
+// (tcp, unix, and pipe); compressed networks are shaped in dialCompress.
+func SetShape(s Shape) {
+	shape = s
+	if !s.enabled() {
+		return
+	}
+	finch.Debug("network shape: %+v", s)
+	for _, n := range []string{"tcp", "unix", "pipe"} {
+		network := n
+		mysql.RegisterDialContext(network, func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		})
+	}
+}
+
+// dial dials the base network (tcp, unix, or pipe) and returns a shapedConn if
+// network shaping is set.
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch network {
+	case "pipe":
+		conn, err = dialPipe(ctx, addr)
+	case "tcp":
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "3306") // driver only does this for "tcp"
+		}
+		fallthrough
+	default:
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+	}
+	if !shape.enabled() {
+		return conn, nil
+	}
+	time.Sleep(shape.delay()) // connect round trip
+	return newShapedConn(conn, shape), nil
+}
+
+// shapedConn adds latency and limits bandwidth. The driver uses a connection
+// from one goroutine at a time, so it's not guarded.
+type shapedConn struct {
+	net.Conn
+	s    Shape
+	read bool          // last op was read, so next write is a new round trip
+	r    *rate.Limiter // nil if unlimited
+	w    *rate.Limiter
+}
+
+func newShapedConn(conn net.Conn, s Shape) *shapedConn {
+	c := &shapedConn{
+		Conn: conn,
+		s:    s,
+	}
+	if s.Bandwidth > 0 {
+		burst := 16384 // max bytes per read or write
+		if s.Bandwidth < uint64(burst) {
+			burst = int(s.Bandwidth)
+		}
+		c.r = rate.NewLimiter(rate.Limit(s.Bandwidth), burst)
+		c.w = rate.NewLimiter(rate.Limit(s.Bandwidth), burst)
+	}
+	return c
+}
+
+func (c *shapedConn) Read(p []byte) (int, error) {
+	c.read = true
+	if c.r == nil {
+		return c.Conn.Read(p)
+	}
+	if len(p) > c.r.Burst() {
+		p = p[:c.r.Burst()]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.r.WaitN(context.Background(), n)
+	}
+	return n, err
+}
+
+func (c *shapedConn) Write(p []byte) (int, error) {
+	if c.read {
+		c.read = false
+		time.Sleep(c.s.delay())
+	}
+	if c.w == nil {
+		return c.Conn.Write(p)
+	}
+	n := 0
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > c.w.Burst() {
+			chunk = chunk[:c.w.Burst()]
+		}
+		c.w.WaitN(context.Background(), len(chunk))
+		m, err := c.Conn.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Block, Inc.
+
+package dbconn
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestShapedConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		server, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		io.Copy(server, server) // echo
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	latency := 50 * time.Millisecond
+	c := newShapedConn(client, Shape{Latency: latency})
+	c.read = true // like after the server greeting
+	buf := make([]byte, 1)
+
+	// New request: delayed
+	t0 := time.Now()
+	if _, err := c.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(t0); d < latency {
+		t.Errorf("first write took %s, expected at least %s", d, latency)
+	}
+
+	// Same request (no read between writes): not delayed
+	t0 = time.Now()
+	if _, err := c.Write([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(t0); d >= latency {
+		t.Errorf("second write took %s, expected less than %s", d, latency)
+	}
+
+	// Read response, then next request is delayed again
+	for i := 0; i < 2; i++ {
+		if _, err := c.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t0 = time.Now()
+	if _, err := c.Write([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(t0); d < latency {
+		t.Errorf("write after read took %s, expected at least %s", d, latency)
+	}
+}
+
+func TestShapedConn_Bandwidth(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	// 1,000 bytes/s: burst is 1,000 bytes, so 2,000 bytes takes at least 1s
+	c := newShapedConn(client, Shape{Bandwidth: 1000})
+	t0 := time.Now()
+	n, err := c.Write(make([]byte, 2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2000 {
+		t.Errorf("wrote %d bytes, expected 2000", n)
+	}
+	if d := time.Since(t0); d < 900*time.Millisecond {
+		t.Errorf("write took %s, expected about 1s", d)
+	}
+}
+
+func TestShape_Delay(t *testing.T) {
+	s := Shape{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		d := s.delay()
+		if d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("got delay %s, expected 5ms-15ms", d)
+		}
+	}
+	s = Shape{Latency: 1 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := s.delay(); d < 0 {
+			t.Fatalf("got negative delay %s", d)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Block, Inc.
+
+package finch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	EVENT_STAGE_START        = "stage-start"
+	EVENT_STAGE_DONE         = "stage-done"
+	EVENT_CLIENT_CONNECTED   = "client-connected"
+	EVENT_CLIENT_RECONNECTED = "client-reconnected"
+	EVENT_CLIENT_ERROR       = "client-error"
+	EVENT_CLIENT_ITER        = "client-iter"
+	EVENT_CLIENT_DONE        = "client-done"
+)
+
+// Event is a stage or client lifecycle event sent to the channel set by
+// SetEvents. RunLevel is the stage (stage events) or the client (client
+// events). Iter is the client iteration: a multiple of iterEvery when it starts
+// for EVENT_CLIENT_ITER, the current iteration for EVENT_CLIENT_ERROR, and the
+// last iteration for EVENT_CLIENT_DONE. Error is the statement error for
+// EVENT_CLIENT_ERROR, the error that caused EVENT_CLIENT_RECONNECTED (if known),
+// or the error that stopped the client for EVENT_CLIENT_DONE (nil if none).
+type Event struct {
+	Type     string
+	Time     time.Time
+	RunLevel RunLevel
+	Iter     uint
+	Error    error
+}
+
+type eventSink struct {
+	c         chan<- Event
+	iterEvery uint
+	dropped   atomic.Uint64
+}
+
+var events atomic.Pointer[eventSink]
+
+// SetEvents sets the channel that receives lifecycle events, for programs that
+// embed Finch as a library to react to run progress without parsing the log.
+// Events are sent without blocking, so clients never wait on a slow receiver:
+// if the channel is full, the event is dropped (see EventsDropped). Use a
+// buffered channel large enough for the number of clients. If iterEvery > 0,
+// clients send EVENT_CLIENT_ITER every iterEvery iterations. Set a nil channel
+// to stop sending events.
+func SetEvents(c chan<- Event, iterEvery uint) {
+	if c == nil {
+		events.Store(nil)
+		return
+	}
+	events.Store(&eventSink{c: c, iterEvery: iterEvery})
+}
+
+// EventsDropped returns the number of events dropped because the channel set by
+// SetEvents was full.
+func EventsDropped() uint64 {
+	if e := events.Load(); e != nil {
+		return e.dropped.Load()
+	}
+	return 0
+}
+
+// SendEvent sends the event if SetEvents was called, else it does nothing.
+// Time is set if zero.
+func SendEvent(ev Event) {
+	e := events.Load()
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case e.c <- ev:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// IterEvent sends EVENT_CLIENT_ITER if iter is a multiple of iterEvery (see
+// SetEvents). Clients call it every iteration, so it returns quickly when
+// there are no events.
+func IterEvent(rl RunLevel, iter uint) {
+	e := events.Load()
+	if e == nil || e.iterEvery == 0 || iter%e.iterEvery != 0 {
+		return
+	}
+	SendEvent(Event{Type: EVENT_CLIENT_ITER, RunLevel: rl, Iter: iter})
+}
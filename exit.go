@@ -0,0 +1,63 @@
+// Copyright 2024 Block, Inc.
+
+package finch
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Exit codes returned by the finch binary so scripts can branch on the type of
+// failure. If more than one failure occurs, the first one sets the exit code.
+const (
+	EXIT_OK           = 0 // all stages ran successfully
+	EXIT_ERROR        = 1 // any other error
+	EXIT_CONFIG       = 2 // invalid command line, stage file, or trx file
+	EXIT_CONNECT      = 3 // cannot connect to MySQL
+	EXIT_CLIENT_ERROR = 4 // client stopped on error (MySQL error handling or DDL)
+	EXIT_THRESHOLD    = 5 // stage stopped by exit.errors or compute.on-client-bound: abort
+)
+
+// ExitError is an error with an exit code. Use errors.As to get it.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError returns err with exit code EXIT_CONFIG, or nil if err is nil.
+func ConfigError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return ExitError{Code: EXIT_CONFIG, Err: err}
+}
+
+var exitCode atomic.Int32
+
+// Fail sets the exit code for a failure that doesn't return an error, like a
+// client error that stops a client while the stage continues running. Only the
+// first call sets the exit code.
+func Fail(code int) {
+	exitCode.CompareAndSwap(EXIT_OK, int32(code))
+}
+
+// ExitCode returns the exit code of the run: EXIT_OK if err is nil and Fail
+// was not called, the code of an ExitError in err, else EXIT_ERROR.
+func ExitCode(err error) int {
+	if err == nil {
+		return int(exitCode.Load())
+	}
+	var e ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return EXIT_ERROR
+}
@@ -3,6 +3,7 @@
 package finch
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -129,6 +131,7 @@ func RunLevelIsValid(s string) bool {
 var (
 	CPUProfile io.Writer // --cpu-profile FILE
 	Debugging  = false
+	Verbose    = false // --verbose
 	debugLog   = log.New(os.Stderr, "", log.LstdFlags|log.Lmicroseconds)
 )
 
@@ -141,6 +144,64 @@ func Debug(msg string, v ...interface{}) {
 	debugLog.Printf(msg, v...)
 }
 
+type stopKey struct{}
+
+// stops are the graceful stop channels of runs in progress (see WithStop):
+// true if closed by Stop.
+var stops = struct {
+	*sync.Mutex
+	chans map[chan struct{}]bool
+}{Mutex: &sync.Mutex{}, chans: map[chan struct{}]bool{}}
+
+// WithStop returns a copy of ctx for one run that Stop stops gracefully, and
+// a func to call when the run is done. Each run has its own stop signal, so
+// a run that starts after Stop (like the next job in the server queue) is not
+// stopped.
+func WithStop(ctx context.Context) (context.Context, func()) {
+	c := make(chan struct{})
+	stops.Lock()
+	stops.chans[c] = false
+	stops.Unlock()
+	done := func() {
+		stops.Lock()
+		delete(stops.chans, c)
+		stops.Unlock()
+	}
+	return context.WithValue(ctx, stopKey{}, c), done
+}
+
+// Stop requests a graceful stop (first CTRL-C or --max-runtime) of runs in
+// progress: clients finish their current iteration instead of being
+// interrupted, so stats are complete.
+func Stop() {
+	stops.Lock()
+	defer stops.Unlock()
+	for c, closed := range stops.chans {
+		if !closed {
+			close(c)
+			stops.chans[c] = true
+		}
+	}
+}
+
+// Stopping returns a channel that's closed when the run of ctx is stopped, or
+// nil (never closed) if ctx is not from WithStop. Clients get it once and
+// check it before each iteration because it must be fast.
+func Stopping(ctx context.Context) <-chan struct{} {
+	c, _ := ctx.Value(stopKey{}).(chan struct{})
+	return c
+}
+
+// Stopped returns true if the run of ctx is stopped.
+func Stopped(ctx context.Context) bool {
+	select {
+	case <-Stopping(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
 var MakeHTTPClient func() *http.Client = func() *http.Client {
 	tr := &http.Transport{
 		MaxIdleConns:    1,
@@ -204,4 +265,79 @@ var MySQLErrorHandling = map[uint16]byte{
 	1836: Erollback | Econtinue, // read-only (Running in read-only mode)
 }
 
+// TiDBErrorHandling is retryable TiDB errors that MySQL never returns. They're
+// handled in addition to MySQLErrorHandling when mysql.flavor is tidb.
+var TiDBErrorHandling = map[uint16]byte{
+	8002: Erollback | Econtinue, // SELECT FOR UPDATE write conflict
+	8022: Erollback | Econtinue, // trx commit failed, safe to retry
+	8028: Erollback | Econtinue, // information schema changed (DDL during trx)
+	9001: Erollback | Econtinue, // PD server timeout
+	9002: Erollback | Econtinue, // TiKV server timeout
+	9003: Erollback | Econtinue, // TiKV server busy
+	9005: Erollback | Econtinue, // region unavailable
+	9007: Erollback | Econtinue, // write conflict
+}
+
+// VitessErrorHandling is transient errors that vtgate returns, like when the
+// vttablet trx pool is full. They're handled in addition to MySQLErrorHandling
+// when mysql.flavor is vitess. Error 1105 (vttablet not serving, reparent) is
+// not handled because vtgate returns it for any unknown error.
+var VitessErrorHandling = map[uint16]byte{
+	1203: Erollback | Econtinue, // resource exhausted: trx pool full
+}
+
+// ProxySQLErrorHandling is transient errors that ProxySQL returns when a backend
+// is unavailable. They're handled in addition to MySQLErrorHandling when
+// mysql.flavor is proxysql. A lost connection to the backend is a driver error
+// (invalid or bad connection), not a MySQL error code, so the client reconnects.
+//
+// Error 9001 is also a TiDB error (TiDBErrorHandling) but flavor maps are
+// mutually exclusive: only the map for mysql.flavor is used.
+var ProxySQLErrorHandling = map[uint16]byte{
+	9001: Erollback | Econtinue, // max connect timeout reached while reaching hostgroup
+}
+
+// MariaDBErrorHandling is MariaDB errors that MySQL never returns, including
+// Galera (MariaDB Cluster). They're handled in addition to MySQLErrorHandling
+// when mysql.flavor is mariadb.
+var MariaDBErrorHandling = map[uint16]byte{
+	1047: Erollback | Econtinue, // Galera: WSREP has not yet prepared node for application use
+	1969: Econtinue,             // query killed: max_statement_time exceeded
+	4084: Eabort,                // sequence has run out (NEXTVAL without CYCLE)
+}
+
+// GroupReplicationErrorHandling is Group Replication errors when a member
+// changes (leaves, joins, or is expelled) or a multi-primary certification
+// conflict rolls back the trx. They're handled in addition to MySQLErrorHandling
+// when stage.group-replication is set.
+var GroupReplicationErrorHandling = map[uint16]byte{
+	3100: Erollback | Econtinue, // error on observer while running replication hook (member not ONLINE)
+	3101: Econtinue,             // plugin instructed the server to rollback the trx (certification conflict)
+}
+
+// ErrorHandling returns MySQLErrorHandling plus the errors for the flavor, like
+// TiDBErrorHandling, and other errors, like GroupReplicationErrorHandling. Nil
+// maps are ignored. If all are nil, it returns MySQLErrorHandling.
+func ErrorHandling(flavor ...map[uint16]byte) map[uint16]byte {
+	var m map[uint16]byte
+	for _, errs := range flavor {
+		if errs == nil {
+			continue
+		}
+		if m == nil {
+			m = make(map[uint16]byte, len(MySQLErrorHandling)+len(errs))
+			for code, flags := range MySQLErrorHandling {
+				m[code] = flags
+			}
+		}
+		for code, flags := range errs {
+			m[code] = flags
+		}
+	}
+	if m == nil {
+		return MySQLErrorHandling
+	}
+	return m
+}
+
 var ModifyDB func(*sql.DB, RunLevel)
@@ -1,8 +1,18 @@
 package finch_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/go-test/deep"
+
 	"github.com/square/finch"
 )
 
@@ -80,3 +90,246 @@ func TestRunLevelGreaterThan(t *testing.T) {
 		t.Errorf("Client changed but got false for ITER")
 	}
 }
+
+func TestParseLogLine(t *testing.T) {
+	const now = "2024-01-10T02:05:00.000000Z"
+	tests := []struct {
+		line   string
+		expect finch.LogRecord
+	}{
+		{
+			line:   "stage.go:272: [load] Running for 1m0s",
+			expect: finch.LogRecord{Time: now, Level: "info", Source: "stage.go:272", Stage: "load", Msg: "Running for 1m0s"},
+		},
+		{
+			line:   "stage.go:506: [load] WARNING: 2 clients did not stop, statistics are not accurate",
+			expect: finch.LogRecord{Time: now, Level: "warn", Source: "stage.go:506", Stage: "load", Msg: "WARNING: 2 clients did not stop, statistics are not accurate"},
+		},
+		{
+			line: "client.go:303: Client 1(load)/e1(dml1)/g1/c2 reconnect on error: Error 1062 (23000): Duplicate entry '1' for key 'PRIMARY' (INSERT INTO t VALUES (1))",
+			expect: finch.LogRecord{Time: now, Level: "error", Source: "client.go:303", Client: "1(load)/e1(dml1)/g1/c2", ErrorCode: 1062,
+				Msg: "Client 1(load)/e1(dml1)/g1/c2 reconnect on error: Error 1062 (23000): Duplicate entry '1' for key 'PRIMARY' (INSERT INTO t VALUES (1))"},
+		},
+		{
+			line:   "DEBUG config.go:47 cwd /tmp",
+			expect: finch.LogRecord{Time: now, Level: "debug", Source: "config.go:47", Msg: "cwd /tmp"},
+		},
+	}
+	for _, test := range tests {
+		got := finch.ParseLogLine(now, test.line)
+		if diff := deep.Equal(got, test.expect); diff != nil {
+			t.Errorf("%s: %v", test.line, diff)
+		}
+	}
+
+	// One JSON object per line
+	var buf bytes.Buffer
+	if _, err := finch.NewJSONLog(&buf).Write([]byte("a.go:1: one\nb.go:2: two\n")); err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected 2:\n%s", len(lines), buf.String())
+	}
+	var r finch.LogRecord
+	if err := json.Unmarshal(lines[1], &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Msg != "two" || r.Source != "b.go:2" || r.Time == "" {
+		t.Errorf("got %+v, expected msg two, source b.go:2, and time", r)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "finch.log")
+	lf, err := finch.NewLogFile(file, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+
+	// Each write is 6 bytes and max size is 10, so every write after the first
+	// rotates. Only 2 rotated files are kept.
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := map[string]string{
+		file:        "line4\n",
+		file + ".1": "line3\n",
+		file + ".2": "line2\n",
+	}
+	for f, content := range expect {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("%s: got %q, expected %q", filepath.Base(f), b, content)
+		}
+	}
+	if _, err := os.Stat(file + ".3"); err == nil {
+		t.Errorf("%s.3 exists, expected only 2 rotated files", file)
+	}
+}
+
+func TestLogClientError(t *testing.T) {
+	var buf bytes.Buffer
+	finch.SetErrorLog(&buf, true)
+	defer finch.SetErrorLog(nil, false)
+
+	finch.LogClientError("1(s)/e1(e)/g1/c1", 1062, errors.New("Error 1062 (23000): Duplicate entry"), "INSERT INTO t VALUES (?, ?)", "t.sql:3", []interface{}{1, []byte("a")})
+	var got finch.ClientError
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%s: %s", err, buf.String())
+	}
+	got.Time = ""
+	expect := finch.ClientError{
+		Client:    "1(s)/e1(e)/g1/c1",
+		ErrorCode: 1062,
+		Error:     "Error 1062 (23000): Duplicate entry",
+		Query:     "INSERT INTO t VALUES (?, ?)",
+		Statement: "t.sql:3",
+		Values:    []string{"1", "a"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	buf.Reset()
+	finch.SetErrorLog(&buf, false)
+	finch.LogClientError("1(s)/e1(e)/g1/c1", 0, errors.New("timeout"), "SELECT 1", "", nil)
+	if line := buf.String(); !strings.HasSuffix(line, " 1(s)/e1(e)/g1/c1 timeout (SELECT 1)\n") {
+		t.Errorf("got text line %q, expected client, error, and query", line)
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	long := strings.Repeat("x", finch.MAX_ERROR_VALUE+10)
+	got := finch.ErrorValues([]interface{}{1, []byte("abc"), []byte{0x00, 0xff}, long}, finch.MAX_ERROR_VALUE)
+	expect := []string{
+		"1",
+		"abc",
+		`"\x00\xff"`,
+		strings.Repeat("x", finch.MAX_ERROR_VALUE) + fmt.Sprintf("...(%d bytes)", len(long)),
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got := finch.ErrorValues(nil, finch.MAX_ERROR_VALUE); got != nil {
+		t.Errorf("got %v, expected nil for no values", got)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	// No channel: nothing sent, nothing dropped
+	finch.SendEvent(finch.Event{Type: finch.EVENT_STAGE_START})
+	if n := finch.EventsDropped(); n != 0 {
+		t.Errorf("got %d dropped events without a channel, expected 0", n)
+	}
+
+	events := make(chan finch.Event, 2)
+	finch.SetEvents(events, 10)
+	defer finch.SetEvents(nil, 0)
+
+	rl := finch.RunLevel{Stage: 1, ExecGroup: 1, ClientGroup: 1, Client: 1}
+	for i := uint(1); i <= 25; i++ {
+		finch.IterEvent(rl, i)
+	}
+	for _, iter := range []uint{10, 20} {
+		select {
+		case e := <-events:
+			if e.Type != finch.EVENT_CLIENT_ITER || e.Iter != iter || e.RunLevel != rl || e.Time.IsZero() {
+				t.Errorf("got %+v, expected %s iter %d", e, finch.EVENT_CLIENT_ITER, iter)
+			}
+		default:
+			t.Fatalf("no event for iter %d", iter)
+		}
+	}
+
+	// Channel full: events are dropped, not blocking
+	for i := 0; i < 3; i++ {
+		finch.SendEvent(finch.Event{Type: finch.EVENT_STAGE_DONE})
+	}
+	if n := finch.EventsDropped(); n != 1 {
+		t.Errorf("got %d dropped events, expected 1", n)
+	}
+}
+
+func TestStop(t *testing.T) {
+	ctx, done := finch.WithStop(context.Background())
+	if finch.Stopped(ctx) {
+		t.Fatal("Stopped is true before Stop")
+	}
+	finch.Stop()
+	finch.Stop() // idempotent
+	if !finch.Stopped(ctx) {
+		t.Error("Stopped is false after Stop")
+	}
+	select {
+	case <-finch.Stopping(ctx):
+	default:
+		t.Error("Stopping channel not closed after Stop")
+	}
+	done()
+
+	// Next run isn't stopped by the previous Stop, and a ctx without a stop
+	// is never stopped
+	ctx, done = finch.WithStop(context.Background())
+	defer done()
+	if finch.Stopped(ctx) {
+		t.Error("next run Stopped is true, expected false")
+	}
+	if finch.Stopped(context.Background()) || finch.Stopping(context.Background()) != nil {
+		t.Error("ctx without stop is stopped, expected not")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := finch.ExitCode(nil); got != finch.EXIT_OK {
+		t.Errorf("ExitCode(nil) = %d, expected %d", got, finch.EXIT_OK)
+	}
+	if got := finch.ExitCode(errors.New("boom")); got != finch.EXIT_ERROR {
+		t.Errorf("ExitCode(err) = %d, expected %d", got, finch.EXIT_ERROR)
+	}
+	err := fmt.Errorf("stage: %w", finch.ConfigError(errors.New("bad")))
+	if got := finch.ExitCode(err); got != finch.EXIT_CONFIG {
+		t.Errorf("ExitCode(config err) = %d, expected %d", got, finch.EXIT_CONFIG)
+	}
+	if err.Error() != "stage: bad" {
+		t.Errorf("got error %q, expected \"stage: bad\"", err.Error())
+	}
+	if finch.ConfigError(nil) != nil {
+		t.Error("ConfigError(nil) is not nil")
+	}
+
+	// First failure sets the exit code
+	finch.Fail(finch.EXIT_CLIENT_ERROR)
+	finch.Fail(finch.EXIT_THRESHOLD)
+	if got := finch.ExitCode(nil); got != finch.EXIT_CLIENT_ERROR {
+		t.Errorf("ExitCode(nil) after Fail = %d, expected %d", got, finch.EXIT_CLIENT_ERROR)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	if _, ok := finch.ErrorHandling(nil)[9007]; ok {
+		t.Error("TiDB error 9007 handled without tidb")
+	}
+	m := finch.ErrorHandling(finch.TiDBErrorHandling)
+	if m[9007] != finch.Erollback|finch.Econtinue {
+		t.Errorf("TiDB error 9007 flags = %d, expected rollback|continue", m[9007])
+	}
+	if m[1213] != finch.MySQLErrorHandling[1213] {
+		t.Error("MySQL error 1213 not handled with tidb")
+	}
+	if _, ok := finch.MySQLErrorHandling[9007]; ok {
+		t.Error("ErrorHandling modified MySQLErrorHandling")
+	}
+
+	// Flavor and Group Replication; nil flavor ignored
+	m = finch.ErrorHandling(nil, finch.GroupReplicationErrorHandling)
+	if m[3101] != finch.Econtinue || m[1213] != finch.MySQLErrorHandling[1213] {
+		t.Errorf("Group Replication error 3101 flags = %d, 1213 flags = %d, expected continue and MySQL flags", m[3101], m[1213])
+	}
+}
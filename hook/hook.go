@@ -0,0 +1,133 @@
+// Copyright 2024 Block, Inc.
+
+// Package hook runs stage hooks: shell commands or SQL statements before or
+// after a stage (config.stage.before and config.stage.after), and skip-if SQL
+// probes (config.stage.skip-if and config.stage.trx.skip-if).
+package hook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/dbconn"
+)
+
+const (
+	BEFORE = "before"
+	AFTER  = "after"
+)
+
+// Run runs the hooks in order. If a hook fails and its on-error is fatal, Run
+// returns the error and does not run the remaining hooks. If on-error is warn,
+// Run logs the error and runs the next hook. Exec hooks run in the current
+// working directory, which is the stage file directory. SQL hooks connect to
+// MySQL with the stage MySQL config.
+func Run(ctx context.Context, when string, hooks []config.Hook, cfg config.Stage) error {
+	for i, h := range hooks {
+		err := run(ctx, when, h, cfg)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s.%s[%d] failed: %s", cfg.Name, when, i, err)
+		if h.OnError == config.HOOK_WARN {
+			log.Printf("[%s] WARNING: %s", cfg.Name, err)
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+func run(ctx context.Context, when string, h config.Hook, cfg config.Stage) error {
+	if h.Timeout != "" {
+		d, _ := time.ParseDuration(h.Timeout) // already validated
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	if h.Exec != "" {
+		log.Printf("[%s] %s: exec: %s", cfg.Name, when, h.Exec)
+		cmd := exec.CommandContext(ctx, "sh", "-c", h.Exec)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"FINCH_STAGE="+cfg.Name,
+			"FINCH_HOOK="+when,
+		)
+		return cmd.Run()
+	}
+
+	log.Printf("[%s] %s: sql: %s", cfg.Name, when, h.SQL)
+	dbconn.SetConfig(cfg.MySQL)
+	db, _, err := dbconn.Make()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, h.SQL)
+	return err
+}
+
+// SkipIf executes the skip-if SQL probe and returns true if the first column
+// of the first row is true (see config.IfTrue). Other columns and rows are
+// ignored. No rows or NULL is false. If the probe fails, like when the table
+// doesn't exist yet, SkipIf logs the error and returns false so the stage or
+// trx runs.
+func SkipIf(ctx context.Context, query string, cfg config.Stage) bool {
+	if query == "" {
+		return false
+	}
+	dbconn.SetConfig(cfg.MySQL)
+	db, _, err := dbconn.Make()
+	if err != nil {
+		log.Printf("[%s] skip-if error, not skipping: %s", cfg.Name, err)
+		return false
+	}
+	defer db.Close()
+	skip, err := skipIf(ctx, db, query)
+	if err != nil {
+		log.Printf("[%s] skip-if error, not skipping: %s: %s", cfg.Name, query, err)
+		return false
+	}
+	return skip
+}
+
+func skipIf(ctx context.Context, db *sql.DB, query string) (bool, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, rows.Err() // no rows
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	vals := make([]interface{}, len(cols))
+	for i := range vals {
+		vals[i] = &sql.NullString{}
+	}
+	if err := rows.Scan(vals...); err != nil {
+		return false, err
+	}
+	val := vals[0].(*sql.NullString)
+	if !val.Valid {
+		return false, nil
+	}
+	skip, err := config.IfTrue(val.String)
+	if err != nil {
+		return false, err
+	}
+	finch.Debug("skip-if %s = %s (%t)", query, val.String, skip)
+	return skip, nil
+}
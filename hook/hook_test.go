@@ -0,0 +1,77 @@
+package hook_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/hook"
+)
+
+func TestRun_Exec(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cfg := config.Stage{Name: "test"}
+	hooks := []config.Hook{
+		{Exec: "echo $FINCH_STAGE $FINCH_HOOK > " + out, OnError: config.HOOK_FATAL},
+	}
+	if err := hook.Run(context.Background(), hook.BEFORE, hooks, cfg); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "test before\n" {
+		t.Errorf("got '%s', expected 'test before'", string(b))
+	}
+
+	// Braces, like from $${FINCH_STAGE} in a stage file: the shell expands it
+	hooks = []config.Hook{
+		{Exec: "echo ${FINCH_STAGE}-${FINCH_HOOK} > " + out, OnError: config.HOOK_FATAL},
+	}
+	if err := hook.Run(context.Background(), hook.AFTER, hooks, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "test-after\n" {
+		t.Errorf("got '%s', expected 'test-after'", string(b))
+	}
+
+	// Warn: error logged, next hook runs
+	hooks = []config.Hook{
+		{Exec: "exit 1", OnError: config.HOOK_WARN},
+		{Exec: "echo ok > " + out, OnError: config.HOOK_FATAL},
+	}
+	if err := hook.Run(context.Background(), hook.AFTER, hooks, cfg); err != nil {
+		t.Errorf("got error with on-error warn, expected nil: %s", err)
+	}
+	b, _ = os.ReadFile(out)
+	if string(b) != "ok\n" {
+		t.Errorf("second hook did not run after first hook failed with on-error warn")
+	}
+
+	// Fatal: error returned, next hook does not run
+	hooks = []config.Hook{
+		{Exec: "exit 1", OnError: config.HOOK_FATAL},
+		{Exec: "echo no > " + out, OnError: config.HOOK_FATAL},
+	}
+	if err := hook.Run(context.Background(), hook.AFTER, hooks, cfg); err == nil {
+		t.Errorf("no error with on-error fatal, expected one")
+	}
+	b, _ = os.ReadFile(out)
+	if string(b) != "ok\n" {
+		t.Errorf("second hook ran after first hook failed with on-error fatal")
+	}
+
+	// Timeout
+	hooks = []config.Hook{
+		{Exec: "exec sleep 5", OnError: config.HOOK_FATAL, Timeout: "100ms"},
+	}
+	if err := hook.Run(context.Background(), hook.BEFORE, hooks, cfg); err == nil {
+		t.Errorf("no error on timeout, expected one")
+	}
+}
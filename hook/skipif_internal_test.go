@@ -0,0 +1,96 @@
+package hook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fakeResults are the columns and rows returned by fakeDriver for each query.
+var fakeResults = map[string]struct {
+	cols []string
+	rows [][]driver.Value
+}{
+	"true":       {[]string{"c1"}, [][]driver.Value{{"1"}}},
+	"false":      {[]string{"c1"}, [][]driver.Value{{"0"}}},
+	"multi":      {[]string{"c1", "c2", "c3"}, [][]driver.Value{{"1", int64(5), nil}, {"0", int64(6), nil}}},
+	"multi-last": {[]string{"c1", "c2"}, [][]driver.Value{{"0", "1"}}},
+	"null":       {[]string{"c1"}, [][]driver.Value{{nil}}},
+	"no-rows":    {[]string{"c1"}, nil},
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	r, ok := fakeResults[s.query]
+	if !ok {
+		return nil, errors.New("table doesn't exist")
+	}
+	return &fakeRows{cols: r.cols, rows: r.rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSkipIf(t *testing.T) {
+	sql.Register("hook-skip-if", fakeDriver{})
+	db, err := sql.Open("hook-skip-if", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		skip  bool
+		err   bool
+	}{
+		{"true", true, false},
+		{"false", false, false},
+		{"multi", true, false},       // first column of first row
+		{"multi-last", false, false}, // not last column
+		{"null", false, false},
+		{"no-rows", false, false},
+		{"missing", false, true}, // query error
+	}
+	for _, tt := range tests {
+		skip, err := skipIf(context.Background(), db, tt.query)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, expected error %t", tt.query, err, tt.err)
+		}
+		if skip != tt.skip {
+			t.Errorf("%s: got skip %t, expected %t", tt.query, skip, tt.skip)
+		}
+	}
+}
@@ -115,6 +115,43 @@ func (lm *Rows) More(_ *sql.Conn) bool {
 	return more
 }
 
+// N returns the number of rows affected, including the offset.
+func (lm *Rows) N() int64 {
+	lm.Lock()
+	defer lm.Unlock()
+	return lm.n
+}
+
+// Max returns the rows limit.
+func (lm *Rows) Max() int64 {
+	return lm.max
+}
+
+// Resume sets the number of rows affected to n, which replaces the offset.
+// This is used to resume a load from a checkpoint.
+func (lm *Rows) Resume(n int64) {
+	lm.Lock()
+	lm.n = n
+	lm.pn = n
+	lm.p = float64(n) / float64(lm.max) * 100
+	lm.Unlock()
+}
+
+// RowsLimit returns the Rows limit in d, which can be combined by Or, or nil
+// if d has no Rows limit.
+func RowsLimit(d Data) *Rows {
+	switch lm := d.(type) {
+	case *Rows:
+		return lm
+	case or:
+		if r := RowsLimit(lm.a); r != nil {
+			return r
+		}
+		return RowsLimit(lm.b)
+	}
+	return nil
+}
+
 // --------------------------------------------------------------------------
 
 type SizeFunc func(*sql.Conn) (uint64, error)
@@ -255,3 +292,92 @@ func (lm *Size) More(conn *sql.Conn) bool {
 
 	return bytes < lm.max
 }
+
+// --------------------------------------------------------------------------
+
+// TableRows limits inserts to a number of rows in a table counted by MySQL
+// (SELECT COUNT(*)) instead of the client-side count of rows affected, which
+// can drift from the actual number of rows due to errors, retries, duplicate
+// keys ignored, or other clients. Since counting rows is slow for large tables,
+// it counts when the estimated rows (last count + rows affected since) reach
+// the next check, which is halfway from the last count to max.
+type TableRows struct {
+	max   int64
+	tbl   string
+	count func(*sql.Conn) (int64, error)
+	rows  int64 // last count
+	n     int64 // rows affected since last count
+	check int64 // count again when rows+n >= check
+	done  bool
+	t     time.Time
+	*sync.Mutex
+}
+
+var _ Data = &TableRows{}
+
+func NewTableRows(max int64, tbl string) *TableRows {
+	if max == 0 {
+		return nil
+	}
+	finch.Debug("limit table rows %s = %d", tbl, max)
+	lm := &TableRows{
+		max:   max,
+		tbl:   tbl,
+		Mutex: &sync.Mutex{},
+	}
+	lm.count = func(conn *sql.Conn) (int64, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		var n int64
+		err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+lm.tbl).Scan(&n)
+		return n, err
+	}
+	return lm
+}
+
+func (lm *TableRows) Affected(n int64) {
+	lm.Lock()
+	lm.n += n
+	lm.Unlock()
+}
+
+func (lm *TableRows) More(conn *sql.Conn) bool {
+	lm.Lock()
+	defer lm.Unlock()
+	if lm.done {
+		return false
+	}
+	first := lm.t.IsZero()
+	if !first && lm.rows+lm.n < lm.check {
+		return true // not time to check; presume there's more to load
+	}
+
+	rows, err := lm.count(conn)
+	if err != nil {
+		log.Printf("Error counting rows in %s: %s", lm.tbl, err)
+		lm.done = true
+		return false
+	}
+	if first {
+		log.Printf("Table rows limit: %s %s (has %s rows)", lm.tbl, humanize.Comma(lm.max), humanize.Comma(rows))
+	} else {
+		d := time.Now().Sub(lm.t)
+		rate := float64(rows-lm.rows) / d.Seconds()
+		log.Printf("%s: %s / %s rows = %.1f%% in %s: %s rows/s (%s rows affected)\n",
+			lm.tbl, humanize.Comma(rows), humanize.Comma(lm.max), float64(rows)/float64(lm.max)*100,
+			d.Round(time.Second), humanize.Comma(int64(rate)), humanize.Comma(lm.n))
+	}
+	lm.t = time.Now()
+	lm.rows = rows
+	lm.n = 0
+	if rows >= lm.max {
+		lm.done = true
+		return false
+	}
+	next := (lm.max - rows) / 2
+	if next < 1 {
+		next = 1
+	}
+	lm.check = rows + next
+	return true
+}
@@ -0,0 +1,40 @@
+package limit
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestTableRows(t *testing.T) {
+	// Fake server-side count: 90% of rows affected are inserted, like when
+	// some inserts fail or are ignored, so the client-side count drifts
+	rows := int64(0)
+	counts := 0
+	lm := NewTableRows(100, "t")
+	lm.count = func(*sql.Conn) (int64, error) {
+		counts++
+		return rows, nil
+	}
+
+	affected := int64(0)
+	for lm.More(nil) {
+		lm.Affected(10)
+		affected += 10
+		rows += 9
+		if affected > 1000 {
+			t.Fatal("More never returned false")
+		}
+	}
+	if rows < 100 {
+		t.Errorf("stopped at %d rows, expected >= 100", rows)
+	}
+	if affected <= 100 {
+		t.Errorf("%d rows affected, expected > 100 because client count drifts", affected)
+	}
+	if counts >= int(affected/10) {
+		t.Errorf("counted %d times for %d More calls, expected fewer", counts, affected/10)
+	}
+	if lm.More(nil) {
+		t.Error("More true after limit reached, expected false")
+	}
+}
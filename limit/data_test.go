@@ -28,3 +28,24 @@ func TestOr(t *testing.T) {
 		t.Error("More true, expected false when one limit reached")
 	}
 }
+
+func TestRowsLimit(t *testing.T) {
+	r1 := limit.NewRows(100, 10)
+	if got := limit.RowsLimit(r1); got != r1 {
+		t.Errorf("got %v, expected Rows limit", got)
+	}
+	if got := limit.RowsLimit(limit.Or(limit.NewSize(100, "100", "", "t"), r1)); got != r1 {
+		t.Errorf("got %v, expected Rows limit in Or", got)
+	}
+	if got := limit.RowsLimit(nil); got != nil {
+		t.Errorf("got %v, expected nil", got)
+	}
+
+	if r1.N() != 10 {
+		t.Errorf("got N %d, expected offset 10", r1.N())
+	}
+	r1.Resume(100)
+	if r1.More(nil) {
+		t.Error("More true after Resume(max), expected false")
+	}
+}
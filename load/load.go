@@ -0,0 +1,530 @@
+// Copyright 2024 Block, Inc.
+
+// Package load plans a parallel data load (config.stage.load). Given a table and
+// row count, Plan reads the table definition from MySQL, then makes the trx
+// files and workload to load the table: clients insert multi-row INSERT batches,
+// and each client inserts a unique chunk of the primary key space.
+package load
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/dbconn"
+)
+
+const (
+	MAX_BATCH        = 1000  // max rows per INSERT
+	MAX_PLACEHOLDERS = 65535 // MySQL limit for prepared statements
+	MAX_STR_LEN      = 255   // max str-fill-az len for string columns
+)
+
+// Trx names in the plan
+const (
+	TRX_DROP_INDEXES = "drop-indexes"
+	TRX_LOAD         = "load"
+	TRX_ADD_INDEXES  = "add-indexes"
+)
+
+type column struct {
+	name       string
+	dataType   string // information_schema.COLUMNS.DATA_TYPE: int, varchar, etc.
+	unsigned   bool
+	nullable   bool
+	hasDefault bool
+	generated  bool // virtual or stored generated column
+	autoRandom bool // TiDB AUTO_RANDOM
+	sequence   bool // MariaDB DEFAULT NEXTVAL(seq)
+	maxLen     int64
+	precision  int64
+	scale      int64
+}
+
+type index struct {
+	name   string
+	unique bool
+	typ    string   // BTREE, FULLTEXT, SPATIAL, etc.
+	parts  []string // quoted columns with optional (sub_part) and DESC
+}
+
+type table struct {
+	db        string
+	name      string
+	columns   []column
+	pk        []string // primary key columns
+	indexes   []index  // secondary indexes
+	maxPacket int64    // @@max_allowed_packet
+}
+
+// Plan returns a copy of the stage with trx and workload that execute the load
+// (cfg.Load). It reads the table definition from MySQL and writes the trx files
+// in dir. The stage must be validated first.
+func Plan(ctx context.Context, cfg config.Stage, dir string) (config.Stage, error) {
+	dbconn.SetConfig(cfg.MySQL)
+	db, _, err := dbconn.Make()
+	if err != nil {
+		return cfg, err
+	}
+	defer db.Close()
+
+	t, err := describe(ctx, db, cfg.Load.Table, cfg.MySQL.Flavor == config.FLAVOR_TIDB)
+	if err != nil {
+		return cfg, fmt.Errorf("load %s: %s", cfg.Load.Table, err)
+	}
+	return plan(t, cfg, dir)
+}
+
+// describe reads the table definition from MySQL. If tidb is true, it also reads
+// AUTO_RANDOM columns from SHOW CREATE TABLE because information_schema doesn't
+// report them. A MariaDB sequence is an error because it's not a table.
+func describe(ctx context.Context, db *sql.DB, tableName string, tidb bool) (table, error) {
+	t := table{name: tableName}
+	if dbName, tblName, ok := strings.Cut(tableName, "."); ok {
+		t.db, t.name = dbName, tblName
+	} else {
+		var cur sql.NullString
+		if err := db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&cur); err != nil {
+			return t, err
+		}
+		if !cur.Valid {
+			return t, fmt.Errorf("no database: specify db.table or mysql.db")
+		}
+		t.db = cur.String
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&t.maxPacket); err != nil {
+		return t, err
+	}
+
+	var tableType string
+	err := db.QueryRowContext(ctx, "SELECT TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", t.db, t.name).Scan(&tableType)
+	if err != nil && err != sql.ErrNoRows {
+		return t, err
+	}
+	if tableType == "SEQUENCE" {
+		return t, fmt.Errorf("%s.%s is a sequence, not a table", t.db, t.name)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA,
+COALESCE(CHARACTER_MAXIMUM_LENGTH, 0), COALESCE(NUMERIC_PRECISION, 0), COALESCE(NUMERIC_SCALE, 0)
+FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`, t.db, t.name)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c column
+		var colType, nullable, extra string
+		var def sql.NullString
+		if err := rows.Scan(&c.name, &c.dataType, &colType, &nullable, &def, &extra, &c.maxLen, &c.precision, &c.scale); err != nil {
+			return t, err
+		}
+		c.hasDefault = def.Valid
+		c.sequence = isNextval(def.String)
+		c.dataType = strings.ToLower(c.dataType)
+		c.unsigned = strings.Contains(strings.ToLower(colType), "unsigned")
+		c.nullable = nullable == "YES"
+		c.generated = strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
+		t.columns = append(t.columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+	if len(t.columns) == 0 {
+		return t, fmt.Errorf("table %s.%s does not exist", t.db, t.name)
+	}
+	if tidb {
+		var name, ddl string
+		if err := db.QueryRowContext(ctx, "SHOW CREATE TABLE "+quote(t.db)+"."+quote(t.name)).Scan(&name, &ddl); err != nil {
+			return t, err
+		}
+		for _, col := range autoRandomColumns(ddl) {
+			if i := indexOf(t.columns, col); i >= 0 {
+				t.columns[i].autoRandom = true
+			}
+		}
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME, SUB_PART, INDEX_TYPE, COLLATION
+FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX`, t.db, t.name)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ string
+		var nonUnique int
+		var col, collation sql.NullString
+		var subPart sql.NullInt64
+		if err := rows.Scan(&name, &nonUnique, &col, &subPart, &typ, &collation); err != nil {
+			return t, err
+		}
+		if name == "PRIMARY" {
+			t.pk = append(t.pk, col.String)
+			continue
+		}
+		if !col.Valid {
+			return t, fmt.Errorf("index %s is a functional index, which is not supported", name)
+		}
+		part := quote(col.String)
+		if subPart.Valid {
+			part += fmt.Sprintf("(%d)", subPart.Int64)
+		}
+		if collation.String == "D" {
+			part += " DESC"
+		}
+		if n := len(t.indexes); n > 0 && t.indexes[n-1].name == name {
+			t.indexes[n-1].parts = append(t.indexes[n-1].parts, part)
+			continue
+		}
+		t.indexes = append(t.indexes, index{
+			name:   name,
+			unique: nonUnique == 0,
+			typ:    typ,
+			parts:  []string{part},
+		})
+	}
+	return t, rows.Err()
+}
+
+// plan makes the trx files and workload for the table.
+func plan(t table, cfg config.Stage, dir string) (config.Stage, error) {
+	lc := cfg.Load
+	rows, _ := strconv.ParseInt(lc.Rows, 10, 64)       // validated
+	clients, _ := strconv.ParseInt(lc.Clients, 10, 64) // validated
+	begin := int64(1)
+	if lc.Begin != "" {
+		begin, _ = strconv.ParseInt(lc.Begin, 10, 64) // validated
+	}
+
+	// Primary key: chunked by client unless load.columns overrides it. Other
+	// primary keys (composite or none) are not chunked, so load.columns must
+	// set generators for composite primary key columns.
+	var pk string
+	if len(t.pk) == 1 {
+		pk = t.pk[0]
+		if _, ok := lc.Columns[pk]; ok {
+			pk = ""
+		}
+	} else {
+		for _, c := range t.pk {
+			if i := indexOf(t.columns, c); i >= 0 && t.columns[i].serverValue() {
+				continue
+			}
+			if _, ok := lc.Columns[c]; !ok {
+				return cfg, fmt.Errorf("primary key (%s) is not a single column; set load.columns for primary key columns", strings.Join(t.pk, ", "))
+			}
+		}
+	}
+
+	// AUTO_RANDOM (TiDB) or sequence (MariaDB) primary key: the server generates
+	// values, and inserting values is an error (AUTO_RANDOM) or bypasses the
+	// sequence, so don't insert the column
+	if i := indexOf(t.columns, pk); pk != "" && i >= 0 && t.columns[i].serverValue() {
+		pk = ""
+	}
+
+	// Columns to insert and their data generators
+	cols := []string{}
+	vals := []string{}
+	data := map[string]config.Data{}
+	rowBytes := int64(0) // estimated
+	for i, c := range t.columns {
+		var d config.Data
+		if userData, ok := lc.Columns[c.name]; ok {
+			d = userData
+		} else if c.name == pk {
+			if !isInt(c.dataType) {
+				return cfg, fmt.Errorf("primary key column %s is %s, not an integer; set load.columns.%s", c.name, c.dataType, c.name)
+			}
+			d = config.Data{Generator: "int-chunk"} // params set below
+		} else if c.generated || c.serverValue() {
+			continue
+		} else {
+			var ok bool
+			if d, ok = generator(c); !ok {
+				if c.nullable || c.hasDefault {
+					continue // MySQL sets NULL or default value
+				}
+				return cfg, fmt.Errorf("cannot generate values for column %s (%s); set load.columns.%s", c.name, c.dataType, c.name)
+			}
+		}
+		if n, err := strconv.ParseInt(d.Params["len"], 10, 64); err == nil && d.Generator == "str-fill-az" {
+			rowBytes += n + 4 // 'str',
+		} else {
+			rowBytes += 20
+		}
+		key := dataKey(i, c.name)
+		data[key] = d
+		cols = append(cols, quote(c.name))
+		vals = append(vals, "@"+key)
+	}
+	for col := range lc.Columns {
+		found := false
+		for _, c := range t.columns {
+			if c.name == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return cfg, fmt.Errorf("load.columns.%s: no such column in table %s.%s", col, t.db, t.name)
+		}
+	}
+
+	if len(cols) == 0 {
+		return cfg, finch.ConfigError(fmt.Errorf("no columns to insert in table %s.%s: every column is generated, set by the server, or nullable or has a default and no generator; set load.columns", t.db, t.name))
+	}
+
+	// Batch size (rows per INSERT): auto-sized to fit in half max_allowed_packet
+	// and the max number of placeholders, unless load.batch is set
+	perClient := (rows + clients - 1) / clients
+	batch, _ := strconv.ParseInt(lc.Batch, 10, 64)
+	if batch == 0 {
+		batch = MAX_BATCH
+		if rowBytes > 0 && t.maxPacket > 0 && t.maxPacket/2/rowBytes < batch {
+			batch = t.maxPacket / 2 / rowBytes
+		}
+		if n := MAX_PLACEHOLDERS / int64(len(cols)); n < batch {
+			batch = n
+		}
+	}
+	if batch > perClient {
+		batch = perClient
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	iter := (perClient + batch - 1) / batch
+	perClient = iter * batch // rounded up to a multiple of batch
+
+	if pk != "" {
+		key := dataKey(indexOf(t.columns, pk), pk)
+		data[key] = config.Data{
+			Generator: "int-chunk",
+			Params: map[string]string{
+				"begin": strconv.FormatInt(begin, 10),
+				"size":  strconv.FormatInt(perClient, 10),
+			},
+		}
+	}
+
+	// Trx files
+	tbl := quote(t.db) + "." + quote(t.name)
+	insert := fmt.Sprintf("-- prepare\nINSERT INTO %s (%s) VALUES /*!csv %d (%s)*/\n",
+		tbl, strings.Join(cols, ", "), batch, strings.Join(vals, ", "))
+	cfg.Trx = []config.Trx{}
+	cfg.Workload = []config.ClientGroup{}
+
+	rebuild := lc.RebuildIndexes && len(t.indexes) > 0
+	if rebuild {
+		drop := make([]string, len(t.indexes))
+		for i, idx := range t.indexes {
+			drop[i] = "DROP INDEX " + quote(idx.name)
+		}
+		trx, err := writeTrx(dir, TRX_DROP_INDEXES, fmt.Sprintf("ALTER TABLE %s %s\n", tbl, strings.Join(drop, ", ")))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Trx = append(cfg.Trx, trx)
+		cfg.Workload = append(cfg.Workload, config.ClientGroup{
+			Group:   TRX_DROP_INDEXES,
+			Clients: "1",
+			Iter:    "1",
+			Trx:     []string{TRX_DROP_INDEXES},
+		})
+	}
+
+	trx, err := writeTrx(dir, TRX_LOAD, insert)
+	if err != nil {
+		return cfg, err
+	}
+	trx.Data = data
+	cfg.Trx = append(cfg.Trx, trx)
+	cfg.Workload = append(cfg.Workload, config.ClientGroup{
+		Group:   TRX_LOAD,
+		Clients: strconv.FormatInt(clients, 10),
+		Iter:    strconv.FormatInt(iter, 10),
+		Trx:     []string{TRX_LOAD},
+	})
+
+	if rebuild {
+		add := make([]string, len(t.indexes))
+		for i, idx := range t.indexes {
+			kind := "INDEX"
+			switch {
+			case idx.typ == "FULLTEXT" || idx.typ == "SPATIAL":
+				kind = idx.typ + " INDEX"
+			case idx.unique:
+				kind = "UNIQUE INDEX"
+			}
+			add[i] = fmt.Sprintf("ADD %s %s (%s)", kind, quote(idx.name), strings.Join(idx.parts, ", "))
+		}
+		alter := fmt.Sprintf("ALTER TABLE %s %s", tbl, strings.Join(add, ", "))
+		log.Printf("[%s] Secondary indexes dropped before and added after load; if the load fails, add them manually: %s", cfg.Name, alter)
+		trx, err := writeTrx(dir, TRX_ADD_INDEXES, alter+"\n")
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Trx = append(cfg.Trx, trx)
+		cfg.Workload = append(cfg.Workload, config.ClientGroup{
+			Group:   TRX_ADD_INDEXES,
+			Clients: "1",
+			Iter:    "1",
+			Trx:     []string{TRX_ADD_INDEXES},
+		})
+	}
+
+	log.Printf("[%s] Load %s: %d rows: %d clients x %d rows (%d INSERT x %d rows)", cfg.Name, tbl, clients*perClient, clients, perClient, iter, batch)
+
+	cfg.Load = nil // now it's a normal stage with trx and workload
+	return cfg, nil
+}
+
+// generator returns the default data generator for the column, or false if
+// there's no default for the column data type.
+func generator(c column) (config.Data, bool) {
+	switch {
+	case isInt(c.dataType):
+		return config.Data{
+			Generator: "int",
+			Params:    map[string]string{"max": strconv.FormatUint(intMax(c.dataType, c.unsigned), 10)},
+		}, true
+	case isNumber(c.dataType):
+		max := uint64(1000000)
+		if c.dataType == "decimal" && c.precision-c.scale < 6 {
+			max = 1
+			for i := int64(0); i < c.precision-c.scale; i++ {
+				max *= 10
+			}
+			max -= 1
+		}
+		return config.Data{
+			Generator: "int",
+			Params:    map[string]string{"max": strconv.FormatUint(max, 10)},
+		}, true
+	case isString(c.dataType):
+		n := c.maxLen
+		if n > MAX_STR_LEN {
+			n = MAX_STR_LEN
+		}
+		if n < 1 {
+			return config.Data{}, false
+		}
+		return config.Data{
+			Generator: "str-fill-az",
+			Params:    map[string]string{"len": strconv.FormatInt(n, 10)},
+		}, true
+	}
+	return config.Data{}, false
+}
+
+func isInt(dataType string) bool {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+func isNumber(dataType string) bool {
+	switch dataType {
+	case "decimal", "float", "double":
+		return true
+	}
+	return false
+}
+
+func isString(dataType string) bool {
+	switch dataType {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return true
+	}
+	return false
+}
+
+// intMax returns the max value for the integer type, limited to max int64
+// because the int generator is int64.
+func intMax(dataType string, unsigned bool) uint64 {
+	var bits uint
+	switch dataType {
+	case "tinyint":
+		bits = 8
+	case "smallint":
+		bits = 16
+	case "mediumint":
+		bits = 24
+	case "int", "integer":
+		bits = 32
+	default:
+		bits = 64
+	}
+	if !unsigned || bits == 64 {
+		bits -= 1
+	}
+	return 1<<bits - 1
+}
+
+var reNotWord = regexp.MustCompile(`[^\w]`)
+
+// dataKey returns the data key (without @) for column i. The zero-padded number
+// makes keys unique and ensures no key is a prefix of another.
+func dataKey(i int, col string) string {
+	return fmt.Sprintf("c%04d_%s", i+1, reNotWord.ReplaceAllString(col, "_"))
+}
+
+var reAutoRandom = regexp.MustCompile("(?mi)^\\s*`((?:[^`]|``)+)`[^\\n]*\\bAUTO_RANDOM\\b")
+
+// autoRandomColumns returns the AUTO_RANDOM columns in a TiDB CREATE TABLE,
+// like "`id` bigint NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */".
+func autoRandomColumns(ddl string) []string {
+	cols := []string{}
+	for _, m := range reAutoRandom.FindAllStringSubmatch(ddl, -1) {
+		cols = append(cols, strings.ReplaceAll(m[1], "``", "`"))
+	}
+	return cols
+}
+
+var reNextval = regexp.MustCompile(`(?i)^\s*nextval\s*\(`)
+
+// isNextval returns true if the MariaDB column default is a sequence, like
+// "nextval(`test`.`s`)". MySQL has no sequences, so it's always false.
+func isNextval(def string) bool {
+	return reNextval.MatchString(def)
+}
+
+// serverValue returns true if the server generates the column value: TiDB
+// AUTO_RANDOM or MariaDB DEFAULT NEXTVAL(seq).
+func (c column) serverValue() bool {
+	return c.autoRandom || c.sequence
+}
+
+func indexOf(columns []column, name string) int {
+	for i := range columns {
+		if columns[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func quote(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+func writeTrx(dir, name, sql string) (config.Trx, error) {
+	file := filepath.Join(dir, name+".sql")
+	if err := os.WriteFile(file, []byte(sql), 0644); err != nil {
+		return config.Trx{}, err
+	}
+	return config.Trx{Name: name, File: file}, nil
+}
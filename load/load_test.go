@@ -0,0 +1,231 @@
+package load
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+var testTable = table{
+	db:   "test",
+	name: "t",
+	columns: []column{
+		{name: "id", dataType: "int", unsigned: true},
+		{name: "k", dataType: "tinyint"},
+		{name: "c", dataType: "varchar", maxLen: 10},
+		{name: "created", dataType: "timestamp", hasDefault: true},
+		{name: "v", dataType: "int", generated: true},
+	},
+	pk: []string{"id"},
+	indexes: []index{
+		{name: "k", typ: "BTREE", parts: []string{"`k`"}},
+		{name: "c", typ: "BTREE", unique: true, parts: []string{"`c`(5)", "`k` DESC"}},
+	},
+	maxPacket: 67108864,
+}
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Stage{
+		Name: "load",
+		Load: &config.TableLoad{
+			Table:          "t",
+			Rows:           "1000",
+			Clients:        "3",
+			Batch:          "100",
+			RebuildIndexes: true,
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := plan(testTable, cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Load != nil {
+		t.Errorf("Load not nil after plan, expected nil")
+	}
+
+	// 1000 rows / 3 clients = 334 rows, rounded up to 4 batches of 100 rows
+	expectWorkload := []config.ClientGroup{
+		{Group: TRX_DROP_INDEXES, Clients: "1", Iter: "1", Trx: []string{TRX_DROP_INDEXES}},
+		{Group: TRX_LOAD, Clients: "3", Iter: "4", Trx: []string{TRX_LOAD}},
+		{Group: TRX_ADD_INDEXES, Clients: "1", Iter: "1", Trx: []string{TRX_ADD_INDEXES}},
+	}
+	if diff := deep.Equal(got.Workload, expectWorkload); diff != nil {
+		t.Error(diff)
+	}
+
+	if len(got.Trx) != 3 {
+		t.Fatalf("got %d trx, expected 3: %+v", len(got.Trx), got.Trx)
+	}
+	expectData := map[string]config.Data{
+		"c0001_id": {Generator: "int-chunk", Params: map[string]string{"begin": "1", "size": "400"}},
+		"c0002_k":  {Generator: "int", Params: map[string]string{"max": "127"}},
+		"c0003_c":  {Generator: "str-fill-az", Params: map[string]string{"len": "10"}},
+	}
+	if diff := deep.Equal(got.Trx[1].Data, expectData); diff != nil {
+		t.Error(diff)
+	}
+
+	files := map[string]string{
+		TRX_DROP_INDEXES: "ALTER TABLE `test`.`t` DROP INDEX `k`, DROP INDEX `c`\n",
+		TRX_LOAD:         "-- prepare\nINSERT INTO `test`.`t` (`id`, `k`, `c`) VALUES /*!csv 100 (@c0001_id, @c0002_k, @c0003_c)*/\n",
+		TRX_ADD_INDEXES:  "ALTER TABLE `test`.`t` ADD INDEX `k` (`k`), ADD UNIQUE INDEX `c` (`c`(5), `k` DESC)\n",
+	}
+	for name, expect := range files {
+		b, err := os.ReadFile(filepath.Join(dir, name+".sql"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expect {
+			t.Errorf("%s: got '%s', expected '%s'", name, string(b), expect)
+		}
+	}
+
+	// Generated trx files must load
+	if _, err := trx.Load(got.Trx, data.NewScope(), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlan_Errors(t *testing.T) {
+	tbl := testTable
+	tbl.columns = append([]column{}, testTable.columns...)
+	tbl.columns = append(tbl.columns, column{name: "j", dataType: "json"})
+	cfg := config.Stage{
+		Name: "load",
+		Load: &config.TableLoad{Table: "t", Rows: "10"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plan(tbl, cfg, t.TempDir()); err == nil {
+		t.Error("no error for NOT NULL json column without default, expected one")
+	}
+
+	// load.columns sets generator for the column
+	cfg.Load.Columns = map[string]config.Data{"j": {Generator: "list", Params: map[string]string{"file": "json.txt"}}}
+	if _, err := plan(tbl, cfg, t.TempDir()); err != nil {
+		t.Error(err)
+	}
+
+	// Composite primary key requires load.columns
+	tbl.pk = []string{"id", "k"}
+	if _, err := plan(tbl, cfg, t.TempDir()); err == nil {
+		t.Error("no error for composite primary key, expected one")
+	}
+}
+
+func TestPlan_NoColumns(t *testing.T) {
+	// No primary key, and MySQL sets every column (NULL or default)
+	tbl := table{
+		db:   "test",
+		name: "t",
+		columns: []column{
+			{name: "j", dataType: "json", nullable: true},
+			{name: "b", dataType: "blob", hasDefault: true},
+		},
+		maxPacket: 64 * 1024 * 1024,
+	}
+	cfg := config.Stage{
+		Name: "load",
+		Load: &config.TableLoad{Table: "t", Rows: "10"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := plan(tbl, cfg, t.TempDir())
+	if err == nil {
+		t.Fatal("no error for table with no columns to insert, expected one")
+	}
+	if finch.ExitCode(err) != finch.EXIT_CONFIG {
+		t.Errorf("got exit code %d, expected config error (%d): %s", finch.ExitCode(err), finch.EXIT_CONFIG, err)
+	}
+}
+
+func TestPlan_AutoRandom(t *testing.T) {
+	ddl := "CREATE TABLE `t` (\n" +
+		"  `id` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */,\n" +
+		"  `k` tinyint(4) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`) /*T![clustered_index] CLUSTERED */\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 /*T![auto_rand_base] AUTO_RANDOM_BASE=30001 */"
+	if diff := deep.Equal(autoRandomColumns(ddl), []string{"id"}); diff != nil {
+		t.Error(diff)
+	}
+
+	tbl := testTable
+	tbl.columns = append([]column{}, testTable.columns...)
+	tbl.columns[0].autoRandom = true
+	cfg := config.Stage{
+		Name: "load",
+		Load: &config.TableLoad{Table: "t", Rows: "10"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	got, err := plan(tbl, cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectData := map[string]config.Data{
+		"c0002_k": {Generator: "int", Params: map[string]string{"max": "127"}},
+		"c0003_c": {Generator: "str-fill-az", Params: map[string]string{"len": "10"}},
+	}
+	if diff := deep.Equal(got.Trx[0].Data, expectData); diff != nil {
+		t.Error(diff)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, TRX_LOAD+".sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "-- prepare\nINSERT INTO `test`.`t` (`k`, `c`) VALUES /*!csv 10 (@c0002_k, @c0003_c)*/\n"
+	if string(b) != expect {
+		t.Errorf("got '%s', expected '%s'", string(b), expect)
+	}
+}
+
+func TestPlan_Sequence(t *testing.T) {
+	for def, expect := range map[string]bool{
+		"nextval(`test`.`s`)": true,
+		"NEXTVAL(s)":          true,
+		"0":                   false,
+		"'nextval(s)'":        false,
+	} {
+		if got := isNextval(def); got != expect {
+			t.Errorf("isNextval(%s) = %t, expected %t", def, got, expect)
+		}
+	}
+
+	tbl := testTable
+	tbl.columns = append([]column{}, testTable.columns...)
+	tbl.columns[0].sequence = true
+	cfg := config.Stage{
+		Name: "load",
+		Load: &config.TableLoad{Table: "t", Rows: "10"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := plan(tbl, cfg, dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, TRX_LOAD+".sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "-- prepare\nINSERT INTO `test`.`t` (`k`, `c`) VALUES /*!csv 10 (@c0002_k, @c0003_c)*/\n"
+	if string(b) != expect {
+		t.Errorf("got '%s', expected '%s'", string(b), expect)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Block, Inc.
+
+package finch
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+// LogRecord is one log line with --log-format json. Only Time, Level, and Msg
+// are always set; other fields are parsed from the message if present.
+type LogRecord struct {
+	Time      string `json:"time"`                 // RFC 3339 with microseconds
+	Level     string `json:"level"`                // debug, info, warn, or error
+	Source    string `json:"source,omitempty"`     // file:line
+	Stage     string `json:"stage,omitempty"`      // "[stage] ..." prefix
+	Client    string `json:"client,omitempty"`     // RunLevel.ClientId
+	ErrorCode uint16 `json:"error-code,omitempty"` // MySQL error code
+	Msg       string `json:"msg"`
+}
+
+var (
+	reLogSource    = regexp.MustCompile(`^([\w.-]+\.go:\d+):? `)
+	reLogStage     = regexp.MustCompile(`^\[([^\]]+)\] `)
+	reLogClient    = regexp.MustCompile(`\d+\([^)]*\)/e\d+\([^)]*\)/g\d+/c\d+`)
+	reLogErrorCode = regexp.MustCompile(`Error (\d+)(?: \(\w+\))?:`)
+	reLogError     = regexp.MustCompile(`(?i)\b(error|errors|panic|failed)\b`)
+)
+
+// JSONLog is a log output (log.SetOutput) that writes each log line as a
+// LogRecord: one JSON object per line. Finch logs free-form messages with the
+// log package, so JSONLog parses fields from each message by convention: "[stage]"
+// prefix, client IDs, "WARNING", and MySQL "Error N" codes. Set log flags to
+// log.Lshortfile (or 0) because JSONLog adds the time.
+type JSONLog struct {
+	out io.Writer
+	*sync.Mutex
+}
+
+var _ io.Writer = &JSONLog{}
+
+func NewJSONLog(out io.Writer) *JSONLog {
+	return &JSONLog{
+		out:   out,
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (l *JSONLog) Write(p []byte) (int, error) {
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	var buf []byte
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		bytes, err := json.Marshal(ParseLogLine(now, line))
+		if err != nil {
+			return 0, err
+		}
+		buf = append(append(buf, bytes...), '\n')
+	}
+	l.Lock()
+	defer l.Unlock()
+	if _, err := l.out.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ParseLogLine returns the LogRecord for one log line.
+func ParseLogLine(time, line string) LogRecord {
+	r := LogRecord{Time: time, Level: "info"}
+	if rest, ok := strings.CutPrefix(line, "DEBUG "); ok { // Debug
+		r.Level = "debug"
+		line = rest
+	}
+	if m := reLogSource.FindStringSubmatch(line); m != nil {
+		r.Source = m[1]
+		line = line[len(m[0]):]
+	}
+	if m := reLogStage.FindStringSubmatch(line); m != nil {
+		r.Stage = m[1]
+		line = line[len(m[0]):]
+	}
+	r.Msg = strings.TrimSpace(line)
+	r.Client = reLogClient.FindString(line)
+	if m := reLogErrorCode.FindStringSubmatch(line); m != nil {
+		code, _ := strconv.ParseUint(m[1], 10, 16)
+		r.ErrorCode = uint16(code)
+	}
+	if r.Level == "info" {
+		switch {
+		case strings.Contains(line, "WARNING"):
+			r.Level = "warn"
+		case r.ErrorCode > 0 || reLogError.MatchString(line):
+			r.Level = "error"
+		}
+	}
+	return r
+}
+
+// SetLogFormat sets the log format for all output, including debug:
+// LOG_FORMAT_TEXT (default) or LOG_FORMAT_JSON.
+func SetLogFormat(format string) {
+	if format != LOG_FORMAT_JSON {
+		return
+	}
+	log.SetFlags(log.Lshortfile)
+	log.SetOutput(NewJSONLog(log.Writer()))
+	debugLog.SetFlags(0)
+	debugLog.SetOutput(NewJSONLog(debugLog.Writer()))
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 Block, Inc.
+
+package finch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LogFile is a log output (log.SetOutput) that writes to a file and rotates it
+// when it reaches a max size: FILE is renamed FILE.1, FILE.1 is renamed FILE.2,
+// and so on up to maxFiles rotated files; the oldest is removed.
+type LogFile struct {
+	name     string
+	maxSize  int64 // bytes, 0 = no rotation
+	maxFiles int   // rotated files to keep, 0 = none (truncate on rotation)
+	f        *os.File
+	size     int64
+	*sync.Mutex
+}
+
+var _ io.Writer = &LogFile{}
+
+// NewLogFile opens (or creates) the log file and appends to it.
+func NewLogFile(name string, maxSize int64, maxFiles int) (*LogFile, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &LogFile{
+		name:     name,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		f:        f,
+		size:     fi.Size(),
+		Mutex:    &sync.Mutex{},
+	}, nil
+}
+
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts rotated files, and opens a new file.
+// The caller must hold the lock.
+func (l *LogFile) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	if l.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.name, l.maxFiles))
+		for i := l.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.name, i), fmt.Sprintf("%s.%d", l.name, i+1))
+		}
+		if err := os.Rename(l.name, l.name+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.name, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	l.size = 0
+	return nil
+}
+
+func (l *LogFile) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.f.Close()
+}
+
+// SetLogOutput sets the output of all logging, including debug. Call it before
+// SetLogFormat, which wraps the output.
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
+	debugLog.SetOutput(w)
+}
+
+// --------------------------------------------------------------------------
+
+// ClientError is one client error in the error log (--error-log).
+type ClientError struct {
+	Time      string   `json:"time"`
+	Client    string   `json:"client"`
+	ErrorCode uint16   `json:"error-code,omitempty"`
+	Error     string   `json:"error"`
+	Query     string   `json:"query"`
+	Statement string   `json:"statement,omitempty"` // trx file:line
+	Values    []string `json:"values,omitempty"`    // bound values, if any
+}
+
+var (
+	errorLog     io.Writer
+	errorLogJSON bool
+	errorLogMux  = &sync.Mutex{}
+)
+
+// SetErrorLog sets the output for LogClientError. If json is true, each error is
+// one ClientError JSON object per line; else, it's one line of text.
+func SetErrorLog(w io.Writer, json bool) {
+	errorLogMux.Lock()
+	errorLog = w
+	errorLogJSON = json
+	errorLogMux.Unlock()
+}
+
+// MAX_ERROR_VALUE is the max length of a bound value in error messages (see
+// ErrorValues) except the error log, which has full values.
+const MAX_ERROR_VALUE = 64
+
+// ErrorValues returns bound values as strings for error messages. Byte values
+// are strings, and strings with non-printable characters (binary data) are
+// quoted with escapes so they don't garble the log. If max > 0, longer values
+// are truncated to max bytes followed by "...(N bytes)".
+func ErrorValues(values []interface{}, max int) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	s := make([]string, len(values))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		str := fmt.Sprintf("%v", v)
+		n := len(str)
+		if max > 0 && n > max {
+			str = str[:max]
+		}
+		if !utf8.ValidString(str) || strings.IndexFunc(str, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			str = strconv.Quote(str)
+		}
+		if max > 0 && n > max {
+			str += fmt.Sprintf("...(%d bytes)", n)
+		}
+		s[i] = str
+	}
+	return s
+}
+
+// LogClientError writes a client error to the error log, if set, with the
+// statement text, where it's defined (trx file:line), and its bound values.
+// Unlike the main log, every error is written, including errors that are
+// handled silently (MySQLErrorHandling).
+func LogClientError(clientId string, errorCode uint16, err error, query, statement string, values []interface{}) {
+	errorLogMux.Lock()
+	defer errorLogMux.Unlock()
+	if errorLog == nil {
+		return
+	}
+	e := ClientError{
+		Time:      time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		Client:    clientId,
+		ErrorCode: errorCode,
+		Error:     err.Error(),
+		Query:     query,
+		Statement: statement,
+		Values:    ErrorValues(values, 0),
+	}
+	if errorLogJSON {
+		bytes, _ := json.Marshal(e)
+		errorLog.Write(append(bytes, '\n'))
+		return
+	}
+	line := fmt.Sprintf("%s %s %s (%s)", e.Time, e.Client, e.Error, strings.Join(strings.Fields(e.Query), " "))
+	if e.Statement != "" {
+		line += " at " + e.Statement
+	}
+	if len(e.Values) > 0 {
+		line += " values: [" + strings.Join(e.Values, ", ") + "]"
+	}
+	errorLog.Write([]byte(line + "\n"))
+}
@@ -0,0 +1,662 @@
+// Copyright 2024 Block, Inc.
+
+// Package mysqlx is a minimal database/sql driver for the MySQL X Protocol
+// (mysql.protocol: x). It executes SQL statements and document store CRUD
+// statements (see crud.go) so that JSON document workloads can be compared
+// between classic SQL access and the X DevAPI. It implements only what Finch
+// needs: MYSQL41 and SHA256_MEMORY authentication without TLS, statement
+// arguments, result sets, and rows affected and insert ID from notices.
+package mysqlx
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DEFAULT_PORT is the X Protocol port (mysqlx_port).
+const DEFAULT_PORT = "33060"
+
+// Driver is the "mysqlx" database/sql driver. The DSN has the same format as
+// the MySQL driver, like "finch:amazing@tcp(127.0.0.1:33060)/finch", but only
+// user, password, net (tcp or unix), address, and database are used. The port
+// must be explicit because the MySQL DSN default is 3306, not DEFAULT_PORT.
+type Driver struct{}
+
+var _ driver.DriverContext = Driver{}
+
+func init() {
+	sql.Register("mysqlx", Driver{})
+}
+
+func (d Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSConfig != "" {
+		return nil, fmt.Errorf("mysqlx: TLS is not supported")
+	}
+	return connector{cfg: cfg}, nil
+}
+
+type connector struct {
+	cfg *mysql.Config
+}
+
+func (c connector) Driver() driver.Driver {
+	return Driver{}
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	d := net.Dialer{Timeout: c.cfg.Timeout}
+	nc, err := d.DialContext(ctx, c.cfg.Net, c.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := newConn(nc)
+	if err := cn.auth(ctx, c.cfg.User, c.cfg.Passwd, c.cfg.DBName); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// --------------------------------------------------------------------------
+
+// conn is one X Protocol session. Like the MySQL driver, it's not safe for
+// concurrent use; database/sql serializes calls.
+type conn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	bad  bool   // fatal error or I/O error: see ResetSession
+	stop func() // stops watch
+}
+
+var (
+	_ driver.ConnBeginTx                    = &conn{}
+	_ driver.ExecerContext                  = &conn{}
+	_ driver.QueryerContext                 = &conn{}
+	_ driver.Pinger                         = &conn{}
+	_ driver.SessionResetter                = &conn{}
+	_ driver.Validator                      = &conn{}
+	_ driver.NamedValueChecker              = &conn{}
+	_ driver.ConnPrepareContext             = &conn{}
+	_ driver.StmtExecContext                = stmt{}
+	_ driver.StmtQueryContext               = stmt{}
+	_ driver.RowsColumnTypeDatabaseTypeName = &rows{}
+)
+
+func newConn(nc net.Conn) *conn {
+	return &conn{nc: nc, r: bufio.NewReader(nc)}
+}
+
+// auth authenticates with MYSQL41, which works with mysql_native_password
+// accounts, then SHA256_MEMORY, which works with caching_sha2_password accounts
+// after the user has connected once with the classic protocol (the password
+// hash is cached in memory). Other mechanisms require TLS.
+func (c *conn) auth(ctx context.Context, user, pass, db string) error {
+	err := c.authMech(ctx, "MYSQL41", user, pass, db)
+	if err == nil {
+		return nil
+	}
+	if merr, ok := err.(*mysql.MySQLError); !ok || merr.Number != 1045 {
+		return err
+	}
+	return c.authMech(ctx, "SHA256_MEMORY", user, pass, db)
+}
+
+func (c *conn) authMech(ctx context.Context, mech, user, pass, db string) error {
+	if err := c.send(ctx, sessAuthenticateStart, msg{}.str(1, mech)); err != nil {
+		return err
+	}
+	typ, payload, err := c.recv(ctx)
+	if err != nil {
+		return err
+	}
+	if typ != msgAuthenticateContinue {
+		return c.unexpected(typ, payload)
+	}
+	f, err := decode(payload)
+	if err != nil {
+		return err
+	}
+	salt := first(f, 1).b
+	var data string
+	switch mech {
+	case "MYSQL41":
+		data = db + "\x00" + user + "\x00" + scrambleMySQL41(pass, salt)
+	default:
+		data = db + "\x00" + user + "\x00" + scrambleSHA256(pass, salt)
+	}
+	if err := c.send(ctx, sessAuthenticateContinue, msg{}.str(1, data)); err != nil {
+		return err
+	}
+	for {
+		typ, payload, err = c.recv(ctx)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case msgNotice:
+			continue
+		case msgAuthenticateOk:
+			return nil
+		default:
+			return c.unexpected(typ, payload)
+		}
+	}
+}
+
+// scrambleMySQL41 returns the MYSQL41 auth response: like mysql_native_password,
+// but hex-encoded with a "*" prefix. An empty password has no response.
+func scrambleMySQL41(pass string, salt []byte) string {
+	if pass == "" {
+		return ""
+	}
+	h1 := sha1.Sum([]byte(pass))
+	h2 := sha1.Sum(h1[:])
+	s := sha1.New()
+	s.Write(salt)
+	s.Write(h2[:])
+	h3 := s.Sum(nil)
+	for i := range h3 {
+		h3[i] ^= h1[i]
+	}
+	return "*" + strings.ToUpper(hex.EncodeToString(h3))
+}
+
+// scrambleSHA256 returns the SHA256_MEMORY auth response: like
+// caching_sha2_password fast auth, but hex-encoded.
+func scrambleSHA256(pass string, nonce []byte) string {
+	if pass == "" {
+		return ""
+	}
+	h1 := sha256.Sum256([]byte(pass))
+	h2 := sha256.Sum256(h1[:])
+	s := sha256.New()
+	s.Write(h2[:])
+	s.Write(nonce)
+	h3 := s.Sum(nil)
+	for i := range h3 {
+		h3[i] ^= h1[i]
+	}
+	return hex.EncodeToString(h3)
+}
+
+// send writes one message. The context deadline, if any, applies to the write
+// and all reads until the next send.
+func (c *conn) send(ctx context.Context, typ byte, payload msg) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	c.watch(ctx)
+	if err := writeMsg(c.nc, typ, payload); err != nil {
+		c.bad = true
+		return err
+	}
+	return nil
+}
+
+// watch sets the conn deadline from ctx and, if ctx can be cancelled, interrupts
+// reads and writes when it's cancelled. It replaces the previous watch, so it
+// applies until the next statement.
+func (c *conn) watch(ctx context.Context) {
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
+	d, _ := ctx.Deadline()
+	c.nc.SetDeadline(d) // zero clears
+	if ctx.Done() == nil {
+		return
+	}
+	quit := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.nc.SetDeadline(time.Now())
+		case <-quit:
+		}
+	}()
+	c.stop = func() { close(quit) }
+}
+
+// recv reads one message. An Error message is returned as a *mysql.MySQLError,
+// like the MySQL driver, so Finch error handling works the same for both
+// protocols.
+func (c *conn) recv(ctx context.Context) (byte, []byte, error) {
+	typ, payload, err := readMsg(c.r)
+	if err != nil {
+		c.bad = true
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		if err == io.EOF {
+			return 0, nil, driver.ErrBadConn
+		}
+		return 0, nil, err
+	}
+	if typ != msgError {
+		return typ, payload, nil
+	}
+	f, err := decode(payload)
+	if err != nil {
+		c.bad = true
+		return 0, nil, err
+	}
+	if first(f, 1).u == 1 { // Error.Severity.FATAL
+		c.bad = true
+	}
+	merr := &mysql.MySQLError{
+		Number:  uint16(first(f, 2).u),
+		Message: string(first(f, 3).b),
+	}
+	copy(merr.SQLState[:], first(f, 4).b)
+	return msgError, nil, merr
+}
+
+func (c *conn) unexpected(typ byte, payload []byte) error {
+	c.bad = true
+	return fmt.Errorf("mysqlx: unexpected server message type %d (%d bytes)", typ, len(payload))
+}
+
+// exec sends the statement and returns its rows. The caller must close the rows.
+func (c *conn) exec(ctx context.Context, query string, args []driver.NamedValue) (*rows, error) {
+	typ, payload, err := statement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.send(ctx, typ, payload); err != nil {
+		return nil, err
+	}
+	r := &rows{c: c, ctx: ctx}
+	if err := r.meta(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.exec(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return result{rowsAffected: r.rowsAffected, insertId: r.insertId}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.exec(ctx, query, args)
+}
+
+// CheckNamedValue converts values like database/sql does by default, but it's
+// needed for uint64, which the default converter rejects if > MaxInt64.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case uint64:
+		nv.Value = int64(v)
+		if v > 1<<63-1 {
+			nv.Value = fmt.Sprintf("%d", v)
+		}
+		return nil
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext returns a statement that's executed as-is: X Protocol prepared
+// statements are not implemented, so "-- prepare" has no effect on the server.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
+	return stmt{c: c, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := "START TRANSACTION"
+	if opts.ReadOnly {
+		start += " READ ONLY"
+	}
+	if _, err := c.ExecContext(ctx, start, nil); err != nil {
+		return nil, err
+	}
+	return tx{c: c}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "DO 1", nil)
+	return err
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	return !c.bad
+}
+
+func (c *conn) Close() error {
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
+	if !c.bad {
+		c.nc.SetDeadline(time.Now().Add(time.Second))
+		writeMsg(c.nc, conClose, nil) // best effort
+	}
+	c.bad = true
+	return c.nc.Close()
+}
+
+// --------------------------------------------------------------------------
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s stmt) Close() error  { return nil }
+func (s stmt) NumInput() int { return -1 }
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: args[i]}
+	}
+	return nv
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t tx) Commit() error {
+	_, err := t.c.ExecContext(context.Background(), "COMMIT", nil)
+	return err
+}
+
+func (t tx) Rollback() error {
+	_, err := t.c.ExecContext(context.Background(), "ROLLBACK", nil)
+	return err
+}
+
+type result struct {
+	rowsAffected int64
+	insertId     int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.insertId, nil }
+func (r result) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// --------------------------------------------------------------------------
+
+// rows reads a result set as it's streamed. Statements without a result set
+// (like INSERT) have no columns. Close reads the rest of the result set and
+// StmtExecuteOk, so the conn is ready for the next statement.
+type rows struct {
+	c       *conn
+	ctx     context.Context
+	names   []string
+	types   []uint64
+	pending []byte // first Row read by meta
+	done    bool   // FetchDone: no more rows
+	closed  bool   // StmtExecuteOk
+
+	rowsAffected int64
+	insertId     int64
+}
+
+// meta reads notices and column metadata up to the first row or the end of
+// the result.
+func (r *rows) meta() error {
+	for {
+		typ, payload, err := r.c.recv(r.ctx)
+		if err != nil {
+			if typ == msgError {
+				r.closed = true // error ends the statement
+			}
+			return err
+		}
+		switch typ {
+		case msgColumnMetaData:
+			f, err := decode(payload)
+			if err != nil {
+				return err
+			}
+			r.types = append(r.types, first(f, 1).u)
+			r.names = append(r.names, string(first(f, 2).b))
+		case msgRow:
+			r.pending = payload
+			return nil
+		case msgFetchDone:
+			r.done = true
+			return nil
+		case msgStmtExecuteOk:
+			r.done, r.closed = true, true
+			return nil
+		default:
+			if err := r.other(typ, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// other handles notices and messages between result sets.
+func (r *rows) other(typ byte, payload []byte) error {
+	switch typ {
+	case msgNotice:
+		return r.notice(payload)
+	case msgFetchDoneMoreResultsets, msgFetchDoneMoreOutParams:
+		// Only the first result set is returned; the rest are discarded by Close
+		r.done = true
+		return nil
+	case msgOk:
+		return nil
+	}
+	return r.c.unexpected(typ, payload)
+}
+
+// notice sets rowsAffected and insertId from session state notices.
+func (r *rows) notice(payload []byte) error {
+	frame, err := decode(payload)
+	if err != nil {
+		return err
+	}
+	if first(frame, 1).u != noticeSessionStateChanged {
+		return nil // warnings, etc.
+	}
+	state, err := decode(first(frame, 3).b)
+	if err != nil {
+		return err
+	}
+	v, err := scalarValue(first(state, 2).b)
+	if err != nil {
+		return err
+	}
+	var n int64
+	switch v := v.(type) {
+	case int64:
+		n = v
+	case uint64:
+		n = int64(v)
+	default:
+		return nil
+	}
+	switch first(state, 1).u {
+	case stateRowsAffected:
+		r.rowsAffected = n
+	case stateInsertId:
+		r.insertId = n
+	}
+	return nil
+}
+
+func (r *rows) Columns() []string {
+	return r.names
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	switch r.types[i] {
+	case colSint:
+		return "BIGINT"
+	case colUint:
+		return "UNSIGNED BIGINT"
+	case colDouble:
+		return "DOUBLE"
+	case colFloat:
+		return "FLOAT"
+	}
+	return ""
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	payload := r.pending
+	r.pending = nil
+	for payload == nil {
+		typ, p, err := r.c.recv(r.ctx)
+		if err != nil {
+			if typ == msgError {
+				r.done, r.closed = true, true
+			}
+			return err
+		}
+		switch typ {
+		case msgRow:
+			payload = p
+		case msgFetchDone:
+			r.done = true
+			return io.EOF
+		case msgStmtExecuteOk:
+			r.done, r.closed = true, true
+			return io.EOF
+		default:
+			if err := r.other(typ, p); err != nil {
+				return err
+			}
+			if r.done {
+				return io.EOF
+			}
+		}
+	}
+	f, err := decode(payload)
+	if err != nil {
+		return err
+	}
+	for i := range dest {
+		if i >= len(f[1]) || i >= len(r.types) {
+			dest[i] = nil
+			continue
+		}
+		if dest[i], err = column(r.types[i], f[1][i].b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close reads the rest of the result up to StmtExecuteOk, which is preceded by
+// notices with rows affected and insert ID.
+func (r *rows) Close() error {
+	for !r.closed {
+		typ, payload, err := r.c.recv(r.ctx)
+		if err != nil {
+			if typ == msgError {
+				r.closed = true
+			}
+			return err
+		}
+		switch typ {
+		case msgStmtExecuteOk:
+			r.closed = true
+		case msgRow, msgColumnMetaData, msgFetchDone, msgFetchDoneMoreResultsets, msgFetchDoneMoreOutParams:
+		case msgNotice:
+			if err := r.notice(payload); err != nil {
+				return err
+			}
+		default:
+			return r.c.unexpected(typ, payload)
+		}
+	}
+	r.done = true
+	return nil
+}
+
+// statement returns the X Protocol message for the query: a document store CRUD
+// statement (see parseCrud) or, by default, SQL (Sql.StmtExecute).
+func statement(query string, args []driver.NamedValue) (byte, msg, error) {
+	c, err := parseCrud(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	if c != nil {
+		return c.encode(args)
+	}
+	m := msg{}.str(1, query)
+	for _, a := range args {
+		s, err := scalar(a.Value)
+		if err != nil {
+			return 0, nil, err
+		}
+		m = m.embed(2, msg{}.uint(1, 1).embed(2, s)) // Any{type: SCALAR, scalar}
+	}
+	return sqlStmtExecute, m.str(3, "sql"), nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Block, Inc.
+
+package mysqlx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var salt = []byte("01234567890123456789")
+
+// fakeServer accepts one connection, authenticates it with MYSQL41, and
+// responds to statements by SQL text.
+func fakeServer(t *testing.T, ln net.Listener) {
+	nc, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	recv := func() (byte, map[int32][]string) {
+		typ, payload, err := readMsg(r)
+		if err != nil {
+			return 0, nil
+		}
+		f, err := decode(payload)
+		if err != nil {
+			t.Error(err)
+		}
+		s := map[int32][]string{}
+		for n, v := range f {
+			for _, v := range v {
+				s[int32(n)] = append(s[int32(n)], string(v.b))
+			}
+		}
+		return typ, s
+	}
+
+	// Auth
+	if typ, f := recv(); typ != sessAuthenticateStart || f[1][0] != "MYSQL41" {
+		t.Errorf("got message %d %v, expected AuthenticateStart MYSQL41", typ, f)
+		return
+	}
+	writeMsg(nc, msgAuthenticateContinue, msg{}.bytes(1, salt))
+	_, f := recv()
+	if expect := "finch\x00u\x00" + scrambleMySQL41("p", salt); f[1][0] != expect {
+		t.Errorf("got auth data %q, expected %q", f[1][0], expect)
+	}
+	writeMsg(nc, msgAuthenticateOk, nil)
+
+	rowsAffected := func(param, n uint64) msg {
+		v := msg{}.uint(1, vUint).uint(3, n)
+		state := msg{}.uint(1, param).embed(2, v)
+		return msg{}.uint(1, noticeSessionStateChanged).uint(2, 2).embed(3, state)
+	}
+	for {
+		typ, f := recv()
+		if typ == 0 || typ == conClose {
+			return
+		}
+		if typ != sqlStmtExecute {
+			t.Errorf("got message %d, expected StmtExecute", typ)
+			return
+		}
+		switch f[1][0] {
+		case "SELECT id, name, d FROM t":
+			writeMsg(nc, msgColumnMetaData, msg{}.uint(1, colSint).str(2, "id"))
+			writeMsg(nc, msgColumnMetaData, msg{}.uint(1, colBytes).str(2, "name"))
+			writeMsg(nc, msgColumnMetaData, msg{}.uint(1, colDouble).str(2, "d"))
+			d := make([]byte, 8)
+			binary.LittleEndian.PutUint64(d, math.Float64bits(1.5))
+			writeMsg(nc, msgRow, msg{}.bytes(1, []byte{0}).bytes(1, []byte("a\x00")).bytes(1, d)) // zigzag 0
+			writeMsg(nc, msgRow, msg{}.bytes(1, []byte{4}).bytes(1, nil).bytes(1, d))             // zigzag 2, NULL name
+			writeMsg(nc, msgFetchDone, nil)
+			writeMsg(nc, msgStmtExecuteOk, nil)
+		case "INSERT INTO t VALUES (?)":
+			writeMsg(nc, msgNotice, rowsAffected(stateRowsAffected, 3))
+			writeMsg(nc, msgNotice, rowsAffected(stateInsertId, 7))
+			writeMsg(nc, msgStmtExecuteOk, nil)
+		default:
+			writeMsg(nc, msgError, msg{}.uint(1, 0).uint(2, 1146).str(3, "Table doesn't exist").str(4, "42S02"))
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	go fakeServer(t, ln)
+
+	db, err := sql.Open("mysqlx", "u:p@tcp("+ln.Addr().String()+")/finch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	res, err := db.Exec("INSERT INTO t VALUES (?)", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := res.RowsAffected()
+	id, _ := res.LastInsertId()
+	if n != 3 || id != 7 {
+		t.Errorf("got rows affected %d, insert id %d; expected 3 and 7", n, id)
+	}
+
+	rows, err := db.Query("SELECT id, name, d FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var id int64
+		var name sql.NullString
+		var d float64
+		if err := rows.Scan(&id, &name, &d); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name.String)
+		if d != 1.5 {
+			t.Errorf("got d %f, expected 1.5", d)
+		}
+		if id != int64(len(got)-1)*2 {
+			t.Errorf("got id %d, expected %d", id, (len(got)-1)*2)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "" {
+		t.Errorf("got names %v, expected [a ]", got)
+	}
+
+	// Errors are MySQL errors, and the conn is still good
+	_, err = db.Exec("SELECT * FROM nope")
+	var merr *mysql.MySQLError
+	if !errors.As(err, &merr) || merr.Number != 1146 || string(merr.SQLState[:]) != "42S02" {
+		t.Errorf("got error %v, expected MySQL error 1146", err)
+	}
+	if _, err := db.Exec("INSERT INTO t VALUES (?)", 2); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScramble(t *testing.T) {
+	// mysql_native_password hash of "p" is SHA1(SHA1("p")), so a server can
+	// verify the scramble: SHA1(salt + hash) XOR scramble = SHA1("p")
+	if got := scrambleMySQL41("", salt); got != "" {
+		t.Errorf("got %s for empty password, expected empty string", got)
+	}
+	got := scrambleMySQL41("p", salt)
+	if len(got) != 41 || got[0] != '*' {
+		t.Fatalf("got %s, expected * + 40 hex digits", got)
+	}
+	scramble, err := hex.DecodeString(got[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1 := sha1.Sum([]byte("p"))
+	h2 := sha1.Sum(h1[:])
+	h3 := sha1.Sum(append(append([]byte{}, salt...), h2[:]...))
+	for i := range scramble {
+		scramble[i] ^= h3[i]
+	}
+	if !bytes.Equal(scramble, h1[:]) {
+		t.Errorf("scramble does not verify")
+	}
+	if got := scrambleSHA256("p", salt); len(got) != 64 {
+		t.Errorf("got %s, expected 64 hex digits", got)
+	}
+}
@@ -0,0 +1,520 @@
+// Copyright 2024 Block, Inc.
+
+package mysqlx
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Document store CRUD statements are written like SQL in trx files and executed
+// as X Protocol CRUD messages (Mysqlx.Crud), not SQL, which is how the X DevAPI
+// accesses collections:
+//
+//	FIND   coll [WHERE cond] [LIMIT n]
+//	ADD    coll {json}
+//	MODIFY coll SET path = value [, path = value ...] [WHERE cond] [LIMIT n]
+//	REMOVE coll [WHERE cond] [LIMIT n]
+//
+// coll is a collection name, optionally prefixed by a schema: "db.coll". cond
+// compares document paths, like "$.user.id" or "user.id", to literal values or
+// "?" with operators =, ==, !=, <>, <, <=, >, >=, and LIKE, combined with AND
+// (&&), OR (||), and parentheses. In ADD, "?" in the JSON document is replaced
+// by the JSON encoding of the value.
+const (
+	crudCmdFind   = "FIND"
+	crudCmdAdd    = "ADD"
+	crudCmdModify = "MODIFY"
+	crudCmdRemove = "REMOVE"
+)
+
+// IsCrud returns true if the query is a document store CRUD statement.
+func IsCrud(query string) bool {
+	switch strings.ToUpper(firstWord(query)) {
+	case crudCmdFind, crudCmdAdd, crudCmdModify, crudCmdRemove:
+		return true
+	}
+	return false
+}
+
+func firstWord(s string) string {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	i := strings.IndexFunc(s, func(r rune) bool { return !(unicode.IsLetter(r) || r == '_') })
+	if i < 0 {
+		return s
+	}
+	return s[:i]
+}
+
+// crud is a parsed document store CRUD statement.
+type crud struct {
+	cmd        string
+	schema     string
+	collection string
+	criteria   *expr
+	limit      int64 // 0 = no limit
+	doc        string
+	set        []setOp
+	nArgs      int // number of "?" in criteria and set values
+}
+
+type setOp struct {
+	path  []string
+	value *expr
+}
+
+// expr is a Mysqlx.Expr.Expr: document path, literal, placeholder, or operator.
+type expr struct {
+	path     []string    // IDENT
+	literal  interface{} // LITERAL (json.RawMessage for a JSON object or array)
+	position int         // PLACEHOLDER if >= 0
+	op       string      // OPERATOR
+	params   []*expr
+}
+
+// parseCrud parses the query if it's a document store CRUD statement, else it
+// returns nil.
+func parseCrud(query string) (*crud, error) {
+	if !IsCrud(query) {
+		return nil, nil
+	}
+	p := &parser{s: strings.TrimSpace(query)}
+	c := &crud{cmd: strings.ToUpper(p.word())}
+	coll := p.word()
+	if coll == "" {
+		return nil, fmt.Errorf("%s: missing collection name", c.cmd)
+	}
+	if db, name, ok := strings.Cut(coll, "."); ok {
+		c.schema, c.collection = db, name
+	} else {
+		c.collection = coll
+	}
+	var err error
+	switch c.cmd {
+	case crudCmdAdd:
+		c.doc = strings.TrimSpace(p.s[p.i:])
+		if !strings.HasPrefix(c.doc, "{") {
+			return nil, fmt.Errorf("ADD %s: missing JSON document", coll)
+		}
+		c.nArgs = len(placeholders(c.doc))
+		return c, nil
+	case crudCmdModify:
+		if !p.keyword("SET") {
+			return nil, fmt.Errorf("MODIFY %s: missing SET", coll)
+		}
+		for {
+			op := setOp{path: p.path()}
+			if op.path == nil {
+				return nil, fmt.Errorf("MODIFY %s: missing document path after SET", coll)
+			}
+			if !p.token("=") {
+				return nil, fmt.Errorf("MODIFY %s: missing = after %s", coll, strings.Join(op.path, "."))
+			}
+			if op.value, err = p.value(); err != nil {
+				return nil, fmt.Errorf("MODIFY %s: %s", coll, err)
+			}
+			c.set = append(c.set, op)
+			if !p.token(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("WHERE") {
+		if c.criteria, err = p.or(); err != nil {
+			return nil, fmt.Errorf("%s %s WHERE: %s", c.cmd, coll, err)
+		}
+	}
+	if p.keyword("LIMIT") {
+		n := p.word()
+		if c.limit, err = strconv.ParseInt(n, 10, 64); err != nil || c.limit < 1 {
+			return nil, fmt.Errorf("%s %s: invalid LIMIT %s: must be an integer >= 1", c.cmd, coll, n)
+		}
+	}
+	if p.skip(); p.i < len(p.s) {
+		return nil, fmt.Errorf("%s %s: unexpected text: %s", c.cmd, coll, p.s[p.i:])
+	}
+	c.nArgs = p.nArgs
+	return c, nil
+}
+
+// encode returns the X Protocol message type and payload for the statement.
+func (c *crud) encode(args []driver.NamedValue) (byte, msg, error) {
+	if len(args) != c.nArgs {
+		return 0, nil, fmt.Errorf("%s %s: %d values for %d ?", c.cmd, c.collection, len(args), c.nArgs)
+	}
+	coll := msg{}.str(1, c.collection)
+	if c.schema != "" {
+		coll = coll.str(2, c.schema)
+	}
+	const document = 1 // Mysqlx.Crud.DataModel.DOCUMENT
+
+	if c.cmd == crudCmdAdd {
+		doc, err := interpolate(c.doc, args)
+		if err != nil {
+			return 0, nil, err
+		}
+		lit := msg{}.uint(1, vOctets).embed(5, msg{}.bytes(1, []byte(doc)).uint(2, contentTypeJSON))
+		field := msg{}.uint(1, 2).embed(4, lit) // Expr{type: LITERAL}
+		m := msg{}.embed(1, coll).uint(2, document).embed(4, msg{}.embed(1, field))
+		return crudInsert, m, nil
+	}
+
+	scalars := make([]msg, len(args))
+	for i := range args {
+		s, err := scalar(args[i].Value)
+		if err != nil {
+			return 0, nil, err
+		}
+		scalars[i] = s
+	}
+	var criteria, limit msg
+	if c.criteria != nil {
+		var err error
+		if criteria, err = c.criteria.encode(); err != nil {
+			return 0, nil, err
+		}
+	}
+	if c.limit > 0 {
+		limit = msg{}.uint(1, uint64(c.limit))
+	}
+
+	var typ byte
+	var m msg
+	switch c.cmd {
+	case crudCmdFind:
+		typ = crudFind
+		m = msg{}.embed(2, coll).uint(3, document)
+		if criteria != nil {
+			m = m.embed(5, criteria)
+		}
+		if limit != nil {
+			m = m.embed(6, limit)
+		}
+		for _, s := range scalars {
+			m = m.embed(11, s)
+		}
+	case crudCmdModify:
+		typ = crudUpdate
+		m = msg{}.embed(2, coll).uint(3, document)
+		if criteria != nil {
+			m = m.embed(4, criteria)
+		}
+		if limit != nil {
+			m = m.embed(5, limit)
+		}
+		for _, op := range c.set {
+			v, err := op.value.encode()
+			if err != nil {
+				return 0, nil, err
+			}
+			const itemSet = 3 // Mysqlx.Crud.UpdateOperation.ITEM_SET
+			m = m.embed(7, msg{}.embed(1, documentPath(op.path)).uint(2, itemSet).embed(3, v))
+		}
+		for _, s := range scalars {
+			m = m.embed(8, s)
+		}
+	case crudCmdRemove:
+		typ = crudDelete
+		m = msg{}.embed(1, coll).uint(2, document)
+		if criteria != nil {
+			m = m.embed(3, criteria)
+		}
+		if limit != nil {
+			m = m.embed(4, limit)
+		}
+		for _, s := range scalars {
+			m = m.embed(6, s)
+		}
+	}
+	return typ, m, nil
+}
+
+// documentPath returns a Mysqlx.Expr.ColumnIdentifier with a document path of
+// members, like ["user", "id"] for $.user.id.
+func documentPath(path []string) msg {
+	id := msg{}
+	for _, member := range path {
+		id = id.embed(1, msg{}.uint(1, 1).str(2, member)) // DocumentPathItem{type: MEMBER}
+	}
+	return id
+}
+
+func (e *expr) encode() (msg, error) {
+	switch {
+	case e.path != nil:
+		return msg{}.uint(1, 1).embed(2, documentPath(e.path)), nil
+	case e.op != "":
+		op := msg{}.str(1, e.op)
+		for _, p := range e.params {
+			m, err := p.encode()
+			if err != nil {
+				return nil, err
+			}
+			op = op.embed(2, m)
+		}
+		return msg{}.uint(1, 5).embed(6, op), nil
+	case e.position >= 0:
+		return msg{}.uint(1, 6).uint(7, uint64(e.position)), nil
+	}
+	if doc, ok := e.literal.(json.RawMessage); ok {
+		lit := msg{}.uint(1, vOctets).embed(5, msg{}.bytes(1, doc).uint(2, contentTypeJSON))
+		return msg{}.uint(1, 2).embed(4, lit), nil
+	}
+	lit, err := scalar(e.literal)
+	if err != nil {
+		return nil, err
+	}
+	return msg{}.uint(1, 2).embed(4, lit), nil
+}
+
+// placeholders returns the offsets of "?" outside JSON strings in doc.
+func placeholders(doc string) []int {
+	var pos []int
+	inString := false
+	for i := 0; i < len(doc); i++ {
+		switch ch := doc[i]; {
+		case inString && ch == '\\':
+			i++ // escaped char
+		case ch == '"':
+			inString = !inString
+		case ch == '?' && !inString:
+			pos = append(pos, i)
+		}
+	}
+	return pos
+}
+
+// interpolate replaces each "?" outside JSON strings with the JSON encoding of
+// the corresponding arg.
+func interpolate(doc string, args []driver.NamedValue) (string, error) {
+	var b strings.Builder
+	prev := 0
+	for n, i := range placeholders(doc) {
+		v := args[n].Value
+		if bytes, ok := v.([]byte); ok {
+			v = string(bytes)
+		}
+		j, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(doc[prev:i])
+		b.Write(j)
+		prev = i + 1
+	}
+	b.WriteString(doc[prev:])
+	return b.String(), nil
+}
+
+// --------------------------------------------------------------------------
+
+// parser is a simple recursive descent parser for CRUD statements.
+type parser struct {
+	s     string
+	i     int
+	nArgs int
+}
+
+func (p *parser) skip() {
+	for p.i < len(p.s) && unicode.IsSpace(rune(p.s[p.i])) {
+		p.i++
+	}
+}
+
+// word returns the next word: letters, digits, _, $, and ".".
+func (p *parser) word() string {
+	p.skip()
+	start := p.i
+	for p.i < len(p.s) {
+		ch := rune(p.s[p.i])
+		if !(unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_' || ch == '$' || ch == '.') {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// keyword consumes the next word if it's kw (case-insensitive).
+func (p *parser) keyword(kw string) bool {
+	i := p.i
+	if w := p.word(); strings.EqualFold(w, kw) {
+		return true
+	}
+	p.i = i
+	return false
+}
+
+// token consumes the next token if it's t.
+func (p *parser) token(t string) bool {
+	p.skip()
+	if strings.HasPrefix(p.s[p.i:], t) {
+		p.i += len(t)
+		return true
+	}
+	return false
+}
+
+// path returns the next document path, like $.a.b or a.b, as its members.
+func (p *parser) path() []string {
+	i := p.i
+	w := p.word()
+	w = strings.TrimPrefix(strings.TrimPrefix(w, "$"), ".")
+	if w == "" || unicode.IsDigit(rune(w[0])) {
+		p.i = i
+		return nil
+	}
+	return strings.Split(w, ".")
+}
+
+func (p *parser) or() (*expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.token("||") || p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &expr{op: "||", params: []*expr{left, right}, position: -1}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (*expr, error) {
+	left, err := p.cmp()
+	if err != nil {
+		return nil, err
+	}
+	for p.token("&&") || p.keyword("AND") {
+		right, err := p.cmp()
+		if err != nil {
+			return nil, err
+		}
+		left = &expr{op: "&&", params: []*expr{left, right}, position: -1}
+	}
+	return left, nil
+}
+
+// cmpOps are comparison operators and their X Protocol names, longest first so
+// that "<=" is matched before "<".
+var cmpOps = []struct{ token, op string }{
+	{"==", "=="},
+	{"!=", "!="},
+	{"<>", "!="},
+	{">=", ">="},
+	{"<=", "<="},
+	{"=", "=="},
+	{">", ">"},
+	{"<", "<"},
+}
+
+func (p *parser) cmp() (*expr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("LIKE") {
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &expr{op: "like", params: []*expr{left, right}, position: -1}, nil
+	}
+	for _, c := range cmpOps {
+		if p.token(c.token) {
+			right, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return &expr{op: c.op, params: []*expr{left, right}, position: -1}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) operand() (*expr, error) {
+	if p.token("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.token(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+	if path := p.path(); path != nil {
+		switch strings.ToLower(strings.Join(path, ".")) {
+		case "true":
+			return &expr{literal: true, position: -1}, nil
+		case "false":
+			return &expr{literal: false, position: -1}, nil
+		case "null":
+			return &expr{literal: nil, position: -1}, nil
+		}
+		return &expr{path: path, position: -1}, nil
+	}
+	return p.value()
+}
+
+// value returns the next literal value or placeholder.
+func (p *parser) value() (*expr, error) {
+	p.skip()
+	if p.i >= len(p.s) {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch ch := p.s[p.i]; {
+	case ch == '?':
+		p.i++
+		e := &expr{position: p.nArgs}
+		p.nArgs++
+		return e, nil
+	case ch == '\'' || ch == '"':
+		end := p.i + 1
+		var b strings.Builder
+		for ; end < len(p.s) && p.s[end] != ch; end++ {
+			if p.s[end] == '\\' && end+1 < len(p.s) {
+				end++
+			}
+			b.WriteByte(p.s[end])
+		}
+		if end >= len(p.s) {
+			return nil, fmt.Errorf("unterminated string: %s", p.s[p.i:])
+		}
+		p.i = end + 1
+		return &expr{literal: b.String(), position: -1}, nil
+	case ch == '{' || ch == '[':
+		d := json.NewDecoder(strings.NewReader(p.s[p.i:]))
+		var doc json.RawMessage
+		if err := d.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON value: %s", err)
+		}
+		p.i += int(d.InputOffset())
+		return &expr{literal: doc, position: -1}, nil
+	}
+	w := p.word()
+	switch strings.ToLower(w) {
+	case "true":
+		return &expr{literal: true, position: -1}, nil
+	case "false":
+		return &expr{literal: false, position: -1}, nil
+	case "null":
+		return &expr{literal: nil, position: -1}, nil
+	}
+	if w == "" && p.token("-") {
+		w = "-" + p.word()
+	}
+	if n, err := strconv.ParseInt(w, 10, 64); err == nil {
+		return &expr{literal: n, position: -1}, nil
+	}
+	if f, err := strconv.ParseFloat(w, 64); err == nil {
+		return &expr{literal: f, position: -1}, nil
+	}
+	return nil, fmt.Errorf("invalid value: %s", p.s[p.i-len(w):])
+}
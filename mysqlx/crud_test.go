@@ -0,0 +1,138 @@
+// Copyright 2024 Block, Inc.
+
+package mysqlx
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseCrud(t *testing.T) {
+	// Not CRUD: SQL
+	c, err := parseCrud("SELECT * FROM t WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != nil {
+		t.Errorf("got crud for SQL, expected nil")
+	}
+
+	c, err = parseCrud("FIND app.users WHERE $.age >= ? AND (name = 'bob' OR active) LIMIT 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &crud{
+		cmd:        crudCmdFind,
+		schema:     "app",
+		collection: "users",
+		criteria: &expr{
+			op:       "&&",
+			position: -1,
+			params: []*expr{
+				{op: ">=", position: -1, params: []*expr{{path: []string{"age"}, position: -1}, {position: 0}}},
+				{op: "||", position: -1, params: []*expr{
+					{op: "==", position: -1, params: []*expr{{path: []string{"name"}, position: -1}, {literal: "bob", position: -1}}},
+					{path: []string{"active"}, position: -1},
+				}},
+			},
+		},
+		limit: 5,
+		nArgs: 1,
+	}
+	if diff := deep.Equal(c, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	c, err = parseCrud(`modify users SET $.address.city = ?, tags = ["a", "b"], n = -1 WHERE _id <> ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.cmd != crudCmdModify || len(c.set) != 3 || c.nArgs != 2 {
+		t.Fatalf("got %+v, expected MODIFY with 3 SET and 2 args", c)
+	}
+	if diff := deep.Equal(c.set[0].path, []string{"address", "city"}); diff != nil {
+		t.Error(diff)
+	}
+	if c.set[0].value.position != 0 || c.criteria.params[1].position != 1 {
+		t.Errorf("got placeholder positions %d and %d, expected 0 and 1", c.set[0].value.position, c.criteria.params[1].position)
+	}
+	if c.set[2].value.literal != int64(-1) {
+		t.Errorf("got n = %v, expected -1", c.set[2].value.literal)
+	}
+
+	for _, q := range []string{
+		"FIND",
+		"FIND users WHERE",
+		"FIND users LIMIT 0",
+		"FIND users ORDER BY name",
+		"ADD users",
+		"MODIFY users WHERE a = 1",
+		"REMOVE users WHERE (a = 1",
+	} {
+		if _, err := parseCrud(q); err == nil {
+			t.Errorf("%s: no error, expected one", q)
+		}
+	}
+}
+
+func TestCrudEncode(t *testing.T) {
+	c, err := parseCrud(`ADD users {"name": ?, "note": "why?", "age": ?}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, m, err := c.encode([]driver.NamedValue{{Value: []byte(`b"ob`)}, {Value: int64(42)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != crudInsert {
+		t.Errorf("got message type %d, expected %d", typ, crudInsert)
+	}
+
+	// Insert.row[0].field[0].literal.v_octets.value
+	f, _ := decode(m)
+	f, _ = decode(first(f, 4).b)
+	f, _ = decode(first(f, 1).b)
+	f, _ = decode(first(f, 4).b)
+	f, _ = decode(first(f, 5).b)
+	expect := `{"name": "b\"ob", "note": "why?", "age": 42}`
+	if got := string(first(f, 1).b); got != expect {
+		t.Errorf("got doc %s, expected %s", got, expect)
+	}
+	if first(f, 2).u != contentTypeJSON {
+		t.Errorf("got content type %d, expected JSON", first(f, 2).u)
+	}
+
+	// Wrong number of values
+	if _, _, err := c.encode(nil); err == nil {
+		t.Error("no error for 0 values, expected one")
+	}
+
+	c, err = parseCrud(`REMOVE users WHERE _id = ? LIMIT 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, m, err = c.encode([]driver.NamedValue{{Value: "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != crudDelete {
+		t.Errorf("got message type %d, expected %d", typ, crudDelete)
+	}
+	f, _ = decode(m)
+	coll, _ := decode(first(f, 1).b)
+	if string(first(coll, 1).b) != "users" {
+		t.Errorf("got collection %s, expected users", first(coll, 1).b)
+	}
+	if len(f[3]) != 1 || len(f[4]) != 1 || len(f[6]) != 1 {
+		t.Errorf("got %d criteria, %d limit, %d args; expected 1 each", len(f[3]), len(f[4]), len(f[6]))
+	}
+	arg, err := scalarValue(first(f, 6).b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg != "abc" {
+		t.Errorf("got arg %v, expected abc", arg)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Block, Inc.
+
+package mysqlx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Client message types (Mysqlx.ClientMessages.Type)
+const (
+	conClose                 = 3
+	sessAuthenticateStart    = 4
+	sessAuthenticateContinue = 5
+	sqlStmtExecute           = 12
+	crudFind                 = 17
+	crudInsert               = 18
+	crudUpdate               = 19
+	crudDelete               = 20
+)
+
+// Server message types (Mysqlx.ServerMessages.Type)
+const (
+	msgOk                      = 0
+	msgError                   = 1
+	msgAuthenticateContinue    = 3
+	msgAuthenticateOk          = 4
+	msgNotice                  = 11
+	msgColumnMetaData          = 12
+	msgRow                     = 13
+	msgFetchDone               = 14
+	msgFetchDoneMoreResultsets = 16
+	msgStmtExecuteOk           = 17
+	msgFetchDoneMoreOutParams  = 18
+)
+
+// Mysqlx.Datatypes.Scalar.Type
+const (
+	vSint   = 1
+	vUint   = 2
+	vNull   = 3
+	vOctets = 4
+	vDouble = 5
+	vFloat  = 6
+	vBool   = 7
+	vString = 8
+)
+
+// Mysqlx.Resultset.ColumnMetaData.FieldType
+const (
+	colSint   = 1
+	colUint   = 2
+	colDouble = 5
+	colFloat  = 6
+	colBytes  = 7
+	colEnum   = 16
+)
+
+// Mysqlx.Notice.SessionStateChanged.Parameter
+const (
+	stateInsertId     = 3
+	stateRowsAffected = 4
+)
+
+const (
+	noticeSessionStateChanged = 3 // Mysqlx.Notice.Frame.Type
+	contentTypeJSON           = 2 // Mysqlx.Resultset.ContentType_BYTES.JSON
+)
+
+// writeMsg writes one X Protocol message: 4-byte little-endian length (type +
+// payload), 1-byte type, and the protobuf payload.
+func writeMsg(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5, 5+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)+1))
+	buf[4] = typ
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+// readMsg reads one X Protocol message and returns its type and payload.
+func readMsg(r *bufio.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[:4])
+	if n == 0 {
+		return 0, nil, fmt.Errorf("invalid X Protocol message: zero length")
+	}
+	payload := make([]byte, n-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
+
+// msg is a protobuf message encoded with protowire, which avoids generated code
+// for the few X Protocol messages that Finch uses.
+type msg []byte
+
+func (m msg) str(num protowire.Number, s string) msg {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendString(m, s)
+}
+
+func (m msg) bytes(num protowire.Number, b []byte) msg {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendBytes(m, b)
+}
+
+func (m msg) uint(num protowire.Number, v uint64) msg {
+	m = protowire.AppendTag(m, num, protowire.VarintType)
+	return protowire.AppendVarint(m, v)
+}
+
+func (m msg) sint(num protowire.Number, v int64) msg {
+	return m.uint(num, protowire.EncodeZigZag(v))
+}
+
+func (m msg) double(num protowire.Number, v float64) msg {
+	m = protowire.AppendTag(m, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(m, math.Float64bits(v))
+}
+
+func (m msg) bool(num protowire.Number, v bool) msg {
+	if v {
+		return m.uint(num, 1)
+	}
+	return m.uint(num, 0)
+}
+
+func (m msg) embed(num protowire.Number, sub msg) msg {
+	return m.bytes(num, sub)
+}
+
+// field is one decoded protobuf field: u for varint and fixed types, b for bytes.
+type field struct {
+	u uint64
+	b []byte
+}
+
+// decode returns the fields of a protobuf message by field number. Repeated
+// fields have multiple values in order.
+func decode(b []byte) (map[protowire.Number][]field, error) {
+	fields := map[protowire.Number][]field{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		var f field
+		switch typ {
+		case protowire.VarintType:
+			f.u, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.u = uint64(v)
+		case protowire.Fixed64Type:
+			f.u, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields[num] = append(fields[num], f)
+	}
+	return fields, nil
+}
+
+// first returns the first value of field num, or the zero value.
+func first(fields map[protowire.Number][]field, num protowire.Number) field {
+	if f := fields[num]; len(f) > 0 {
+		return f[0]
+	}
+	return field{}
+}
+
+// scalar encodes a driver.Value as a Mysqlx.Datatypes.Scalar.
+func scalar(v interface{}) (msg, error) {
+	m := msg{}
+	switch v := v.(type) {
+	case nil:
+		m = m.uint(1, vNull)
+	case int64:
+		m = m.uint(1, vSint).sint(2, v)
+	case float64:
+		m = m.uint(1, vDouble).double(6, v)
+	case bool:
+		m = m.uint(1, vBool).bool(8, v)
+	case []byte:
+		m = m.uint(1, vOctets).embed(5, msg{}.bytes(1, v))
+	case string:
+		m = m.uint(1, vString).embed(9, msg{}.str(1, v))
+	case time.Time:
+		m = m.uint(1, vString).embed(9, msg{}.str(1, v.Format("2006-01-02 15:04:05.999999")))
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+	return m, nil
+}
+
+// scalarValue decodes a Mysqlx.Datatypes.Scalar, like the values of a session
+// state notice.
+func scalarValue(b []byte) (interface{}, error) {
+	s, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	switch first(s, 1).u {
+	case vSint:
+		return protowire.DecodeZigZag(first(s, 2).u), nil
+	case vUint:
+		return first(s, 3).u, nil
+	case vString:
+		str, err := decode(first(s, 9).b)
+		if err != nil {
+			return nil, err
+		}
+		return string(first(str, 1).b), nil
+	}
+	return nil, nil
+}
+
+// column decodes a row field of the column type. An empty field is NULL.
+// Types without a simple encoding, like DECIMAL and DATETIME, are returned as
+// raw bytes because Finch only saves column values, it doesn't interpret them.
+func column(typ uint64, b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, nil // NULL
+	}
+	switch typ {
+	case colSint:
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		return protowire.DecodeZigZag(v), nil
+	case colUint:
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if v > math.MaxInt64 {
+			return []byte(fmt.Sprintf("%d", v)), nil
+		}
+		return int64(v), nil
+	case colDouble:
+		if len(b) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+		}
+	case colFloat:
+		if len(b) == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+		}
+	case colBytes, colEnum:
+		return append([]byte{}, b[:len(b)-1]...), nil // trailing \0
+	}
+	return append([]byte{}, b...), nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 Block, Inc.
+
+// Package plot implements "finch plot": it reads stats written by the csv or
+// history reporter and renders charts of throughput, latency, and errors as SVG
+// or PNG files, so results can be visualized without another tool.
+package plot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/square/finch/stats"
+)
+
+const (
+	FORMAT_SVG = "svg"
+	FORMAT_PNG = "png"
+)
+
+// Options are the command line options for finch plot.
+type Options struct {
+	Dir    string // output dir; default: dir of stats file
+	Format string // FORMAT_SVG (default) or FORMAT_PNG
+}
+
+// Chart is one chart: a line for each series.
+type Chart struct {
+	Name   string // file name suffix, like "qps"
+	Title  string
+	XLabel string
+	YLabel string
+	Series []Series
+}
+
+// Series is one line in a Chart.
+type Series struct {
+	Name string
+	X    []float64
+	Y    []float64
+}
+
+// Plot reads the stats file and writes its charts to files named like the stats
+// file with the chart name and format: stats.csv -> stats-qps.svg. It returns
+// the files written.
+func Plot(file string, opts Options) ([]string, error) {
+	switch opts.Format {
+	case "":
+		opts.Format = FORMAT_SVG
+	case FORMAT_SVG, FORMAT_PNG:
+	default:
+		return nil, fmt.Errorf("invalid plot format: %s: valid formats are %s and %s", opts.Format, FORMAT_SVG, FORMAT_PNG)
+	}
+	charts, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = filepath.Dir(file)
+	}
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	written := []string{}
+	for _, c := range charts {
+		out := filepath.Join(dir, base+"-"+c.Name+"."+opts.Format)
+		f, err := os.Create(out)
+		if err != nil {
+			return written, err
+		}
+		if opts.Format == FORMAT_PNG {
+			err = PNG(f, c)
+		} else {
+			err = SVG(f, c)
+		}
+		if err != nil {
+			f.Close()
+			return written, fmt.Errorf("%s: %s", out, err)
+		}
+		if err := f.Close(); err != nil {
+			return written, err
+		}
+		written = append(written, out)
+	}
+	return written, nil
+}
+
+// Read reads a stats file from the csv reporter (periodic stats: charts over
+// runtime) or history reporter (JSON lines: charts over runs) and returns its
+// charts: throughput, latency, and errors.
+func Read(file string) ([]Chart, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var charts []Chart
+	if b := bytes.TrimSpace(data); len(b) > 0 && b[0] == '{' {
+		charts, err = readHistory(data)
+	} else {
+		charts, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return charts, nil
+}
+
+// readCSV reads a csv reporter file. Each compute (last column) is a separate
+// series if there are stats from more than one.
+func readCSV(b []byte) ([]Chart, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[name] = i
+	}
+	for _, name := range []string{"runtime", "QPS", "TPS", "errors", "compute"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("not a Finch CSV stats file: no %s column", name)
+		}
+	}
+	var percentiles []string // total, like P99.9, not r_P99.9
+	for _, name := range header {
+		if strings.HasPrefix(name, "P") {
+			percentiles = append(percentiles, name)
+		}
+	}
+
+	// Rows by compute, in order seen
+	rows := map[string][][]string{}
+	computes := []string{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) != len(header) {
+			continue
+		}
+		compute := rec[col["compute"]]
+		if _, ok := rows[compute]; !ok {
+			computes = append(computes, compute)
+		}
+		rows[compute] = append(rows[compute], rec)
+	}
+	if len(computes) == 0 {
+		return nil, fmt.Errorf("no stats")
+	}
+
+	series := func(compute string, names ...string) []Series {
+		s := make([]Series, len(names))
+		for i, name := range names {
+			s[i].Name = name
+			if len(computes) > 1 {
+				s[i].Name += " " + compute
+			}
+			for _, rec := range rows[compute] {
+				x, _ := strconv.ParseFloat(rec[col["runtime"]], 64)
+				y, _ := strconv.ParseFloat(rec[col[name]], 64)
+				s[i].X = append(s[i].X, x)
+				s[i].Y = append(s[i].Y, y)
+			}
+		}
+		return s
+	}
+
+	qps := Chart{Name: "qps", Title: "Throughput", XLabel: "runtime (s)", YLabel: "per second"}
+	lat := Chart{Name: "latency", Title: "Latency", XLabel: "runtime (s)", YLabel: "microseconds"}
+	errs := Chart{Name: "errors", Title: "Errors", XLabel: "runtime (s)", YLabel: "count"}
+	for _, compute := range computes {
+		qps.Series = append(qps.Series, series(compute, "QPS", "r_QPS", "w_QPS", "TPS")...)
+		lat.Series = append(lat.Series, series(compute, percentiles...)...)
+		if _, ok := col["retries"]; ok { // csv option retries
+			errs.Series = append(errs.Series, series(compute, "errors", "retries")...)
+		} else {
+			errs.Series = append(errs.Series, series(compute, "errors")...)
+		}
+	}
+	return []Chart{qps, lat, errs}, nil
+}
+
+// readHistory reads a history reporter file. X is the run number (line number
+// per stage), and each stage is a separate series if there's more than one.
+func readHistory(b []byte) ([]Chart, error) {
+	recs := map[string][]stats.HistoryRecord{}
+	stages := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec stats.HistoryRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if _, ok := recs[rec.Stage]; !ok {
+			stages = append(stages, rec.Stage)
+		}
+		recs[rec.Stage] = append(recs[rec.Stage], rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no stats")
+	}
+
+	qps := Chart{Name: "qps", Title: "Throughput", XLabel: "run", YLabel: "per second"}
+	lat := Chart{Name: "latency", Title: "Latency", XLabel: "run", YLabel: "microseconds"}
+	errs := Chart{Name: "errors", Title: "Errors", XLabel: "run", YLabel: "count"}
+	for _, stage := range stages {
+		series := func(name string, y func(stats.HistoryRecord) float64) Series {
+			s := Series{Name: name}
+			if len(stages) > 1 {
+				s.Name += " " + stage
+			}
+			for n, rec := range recs[stage] {
+				s.X = append(s.X, float64(n+1))
+				s.Y = append(s.Y, y(rec))
+			}
+			return s
+		}
+		qps.Series = append(qps.Series,
+			series("QPS", func(r stats.HistoryRecord) float64 { return r.QPS }),
+			series("r_QPS", func(r stats.HistoryRecord) float64 { return r.ReadQPS }),
+			series("w_QPS", func(r stats.HistoryRecord) float64 { return r.WriteQPS }),
+			series("TPS", func(r stats.HistoryRecord) float64 { return r.TPS }),
+		)
+		for _, p := range percentileNames(recs[stage]) {
+			p := p
+			lat.Series = append(lat.Series, series(p, func(r stats.HistoryRecord) float64 { return float64(r.Percentiles[p]) }))
+		}
+		errs.Series = append(errs.Series,
+			series("errors", func(r stats.HistoryRecord) float64 { return float64(r.Errors) }),
+			series("retries", func(r stats.HistoryRecord) float64 { return float64(r.Retries) }),
+		)
+	}
+	return []Chart{qps, lat, errs}, nil
+}
+
+// percentileNames returns the percentile names in the records ordered by
+// percentile: P50, P95, P99, P99.9.
+func percentileNames(recs []stats.HistoryRecord) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, rec := range recs {
+		for p := range rec.Percentiles {
+			if !seen[p] {
+				seen[p] = true
+				names = append(names, p)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return percentileValue(names[i]) < percentileValue(names[j])
+	})
+	return names
+}
+
+// percentileValue returns the value of a percentile name: P99.9 = 99.9.
+func percentileValue(name string) float64 {
+	_, nP, err := stats.ParsePercentiles(name)
+	if err != nil || len(nP) == 0 {
+		return 0
+	}
+	return nP[0]
+}
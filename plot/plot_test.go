@@ -0,0 +1,128 @@
+// Copyright 2024 Block, Inc.
+
+package plot_test
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/finch/plot"
+	"github.com/square/finch/stats"
+)
+
+func TestPlot_CSV(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "stats.csv")
+	r, err := stats.NewCSV(map[string]string{"file": file, "percentiles": "P95,P99.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint(1); i <= 3; i++ {
+		s := stats.NewStats()
+		s.Record(stats.READ, 100*int64(i))
+		s.Record(stats.WRITE, 200)
+		r.Report([]stats.Instance{{Hostname: "local", Clients: 1, Interval: i, Seconds: 1.0, Runtime: float64(i), Total: s}})
+	}
+	r.Stop()
+
+	charts, err := plot.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charts) != 3 {
+		t.Fatalf("got %d charts, expected 3", len(charts))
+	}
+	lat := charts[1]
+	if len(lat.Series) != 2 || lat.Series[0].Name != "P95" || lat.Series[1].Name != "P99.9" {
+		t.Fatalf("got latency series %+v, expected P95 and P99.9", lat.Series)
+	}
+	qps := charts[0].Series[0]
+	if qps.Name != "QPS" {
+		t.Errorf("got series %s, expected QPS", qps.Name)
+	}
+	if len(qps.X) != 3 || qps.X[2] != 3 || qps.Y[2] != 2 {
+		t.Errorf("got QPS X %v Y %v, expected 3 points, last (3, 2)", qps.X, qps.Y)
+	}
+
+	written, err := plot.Plot(file, plot.Options{Format: plot.FORMAT_PNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"stats-qps.png", "stats-latency.png", "stats-errors.png"}
+	if len(written) != len(expect) {
+		t.Fatalf("wrote %v, expected %v", written, expect)
+	}
+	for i := range written {
+		if filepath.Base(written[i]) != expect[i] {
+			t.Errorf("wrote %s, expected %s", written[i], expect[i])
+		}
+		b, err := os.ReadFile(written[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := png.Decode(bytes.NewReader(b)); err != nil {
+			t.Errorf("%s: %s", written[i], err)
+		}
+	}
+}
+
+func TestPlot_History(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "history.jsonl")
+	for run := 1; run <= 2; run++ {
+		for _, stage := range []string{"read", "write"} {
+			r, err := stats.NewHistory(map[string]string{"file": file, "stage": stage})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := stats.NewStats()
+			s.Record(stats.READ, 100)
+			r.Report([]stats.Instance{{Hostname: "local", Clients: 1, Interval: 1, Seconds: 1.0, Runtime: 1, Total: s}})
+			r.Stop()
+		}
+	}
+
+	charts, err := plot.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qps := charts[0]
+	if len(qps.Series) != 8 { // 4 per stage
+		t.Fatalf("got %d QPS series, expected 8", len(qps.Series))
+	}
+	if qps.Series[0].Name != "QPS read" || qps.Series[4].Name != "QPS write" {
+		t.Errorf("got series %s and %s, expected QPS read and QPS write", qps.Series[0].Name, qps.Series[4].Name)
+	}
+	if len(qps.Series[4].X) != 2 || qps.Series[4].X[1] != 2 {
+		t.Errorf("got X %v, expected runs 1 and 2", qps.Series[4].X)
+	}
+
+	written, err := plot.Plot(file, plot.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "<svg") || !strings.Contains(string(b), "QPS read") {
+		t.Errorf("%s is not an SVG chart:\n%s", written[0], b)
+	}
+}
+
+func TestPlot_InvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stats.csv")
+	if err := os.WriteFile(file, []byte("a,b,c\n1,2,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plot.Read(file); err == nil {
+		t.Error("no error reading non-Finch CSV file, expected an error")
+	}
+	if _, err := plot.Plot(file, plot.Options{Format: "gif"}); err == nil {
+		t.Error("no error for format gif, expected an error")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Block, Inc.
+
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+// PNG writes the chart as a PNG image. Text is drawn with a small built-in
+// bitmap font (uppercase only), so there are no font dependencies.
+func PNG(w io.Writer, c Chart) error {
+	cv := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+	render(c, cv)
+	return png.Encode(w, cv.img)
+}
+
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+var _ canvas = &pngCanvas{}
+
+func (cv *pngCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	for i := int(x); i < int(x+w); i++ {
+		for j := int(y); j < int(y+h); j++ {
+			cv.img.SetRGBA(i, j, c)
+		}
+	}
+}
+
+// line draws a line with Bresenham's algorithm.
+func (cv *pngCanvas) line(x1, y1, x2, y2 float64, c color.RGBA) {
+	cv.plotLine(int(math.Round(x1)), int(math.Round(y1)), int(math.Round(x2)), int(math.Round(y2)), c)
+}
+
+func (cv *pngCanvas) plotLine(x0, y0, x1, y1 int, c color.RGBA) {
+	dx, sx := abs(x1-x0), 1
+	if x0 > x1 {
+		sx = -1
+	}
+	dy, sy := -abs(y1-y0), 1
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		cv.img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// polyline draws lines 2px wide to match the SVG stroke.
+func (cv *pngCanvas) polyline(x, y []float64, c color.RGBA) {
+	for i := 1; i < len(x); i++ {
+		cv.line(x[i-1], y[i-1], x[i], y[i], c)
+		cv.line(x[i-1], y[i-1]+1, x[i], y[i]+1, c)
+	}
+}
+
+const (
+	glyphW     = 3
+	glyphH     = 5
+	glyphScale = 2
+	glyphSpace = 1 // between glyphs, unscaled
+)
+
+// text draws s with the bitmap font. y is the baseline, like SVG.
+func (cv *pngCanvas) text(x, y float64, s string, anchor int, c color.RGBA) {
+	s = strings.ToUpper(s)
+	w := float64(len(s)*(glyphW+glyphSpace)*glyphScale - glyphSpace*glyphScale)
+	switch anchor {
+	case anchorMiddle:
+		x -= w / 2
+	case anchorEnd:
+		x -= w
+	}
+	top := int(y) - glyphH*glyphScale
+	for i, r := range s {
+		g, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		left := int(x) + i*(glyphW+glyphSpace)*glyphScale
+		for n, bit := range g {
+			if bit != '#' {
+				continue
+			}
+			px := left + (n%glyphW)*glyphScale
+			py := top + (n/glyphW)*glyphScale
+			cv.rect(float64(px), float64(py), glyphScale, glyphScale, c)
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// glyphs is a 3x5 bitmap font: 5 rows of 3 pixels, # = set.
+var glyphs = map[rune]string{
+	' ': "...............",
+	'0': "####.##.##.####",
+	'1': ".#.##..#..#.###",
+	'2': "###..#####..###",
+	'3': "###..####..####",
+	'4': "#.##.####..#..#",
+	'5': "####..###..####",
+	'6': "####..####.####",
+	'7': "###..#..#..#..#",
+	'8': "####.#####.####",
+	'9': "####.####..####",
+	'A': ".#.#.#####.##.#",
+	'B': "##.#.###.#.###.",
+	'C': "####..#..#..###",
+	'D': "##.#.##.##.###.",
+	'E': "####..####..###",
+	'F': "####..###..#...",
+	'G': "####..#.##.####",
+	'H': "#.##.#####.##.#",
+	'I': "###.#..#..#.###",
+	'J': "..#..#..##.####",
+	'K': "#.##.###.#.##.#",
+	'L': "#..#..#..#..###",
+	'M': "#.#####.##.##.#",
+	'N': "##.#.##.##.##.#",
+	'O': "####.##.##.####",
+	'P': "####.#####..#..",
+	'Q': ".#.#.##.###..##",
+	'R': "####.###.#.##.#",
+	'S': "####..###..####",
+	'T': "###.#..#..#..#.",
+	'U': "#.##.##.##.####",
+	'V': "#.##.##.##.#.#.",
+	'W': "#.##.##.#####.#",
+	'X': "#.##.#.#.#.##.#",
+	'Y': "#.##.#.#..#..#.",
+	'Z': "###..#.#.#..###",
+	'.': "............#..",
+	',': ".........#.#...",
+	'-': "......###......",
+	'_': "............###",
+	':': "....#.....#....",
+	'/': "..#..#.#.#..#..",
+	'(': ".#.#..#..#...#.",
+	')': ".#...#..#..#.#.",
+	'%': "#.#..#.#.#..#.#",
+	'@': "####.##.##..###",
+	'>': "#...#...#.#.#..",
+	'<': "..#.#.#...#...#",
+	'=': "...###...###...",
+	'+': "....#.###.#....",
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Block, Inc.
+
+package plot
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+)
+
+const (
+	width  = 800
+	height = 400
+
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 40
+	marginBottom = 50
+
+	nTicks = 5
+)
+
+// Text anchors
+const (
+	anchorStart = iota
+	anchorMiddle
+	anchorEnd
+)
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	grid  = color.RGBA{221, 221, 221, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// palette is the color of each series, in order, repeating if there are more.
+var palette = []color.RGBA{
+	{31, 119, 180, 255},
+	{255, 127, 14, 255},
+	{44, 160, 44, 255},
+	{214, 39, 40, 255},
+	{148, 103, 189, 255},
+	{140, 86, 75, 255},
+	{227, 119, 194, 255},
+	{127, 127, 127, 255},
+}
+
+// canvas is what render draws on: SVG or PNG. Coordinates are pixels with 0,0
+// at top left.
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	line(x1, y1, x2, y2 float64, c color.RGBA)
+	polyline(x, y []float64, c color.RGBA)
+	text(x, y float64, s string, anchor int, c color.RGBA)
+}
+
+// render draws the chart: title, axes with grid lines and tick labels, one line
+// per series, and a legend. Series with no data are skipped, and series that
+// are all zero (like r_QPS for a write-only workload) are not drawn but listed
+// in the legend so it's clear they're zero, not missing.
+func render(c Chart, cv canvas) {
+	cv.rect(0, 0, width, height, white)
+	cv.text(width/2, marginTop/2+4, c.Title, anchorMiddle, black)
+
+	// Data range; Y always starts at zero
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMax := 0.0
+	for _, s := range c.Series {
+		for i := range s.X {
+			xMin = math.Min(xMin, s.X[i])
+			xMax = math.Max(xMax, s.X[i])
+			yMax = math.Max(yMax, s.Y[i])
+		}
+	}
+	if math.IsInf(xMin, 1) {
+		xMin, xMax = 0, 1
+	}
+	if xMax == xMin {
+		xMax = xMin + 1
+	}
+	yStep := niceStep(yMax / nTicks)
+	yMax = yStep * math.Ceil(yMax/yStep)
+	if yMax == 0 {
+		yMax = yStep * nTicks
+	}
+
+	plotW := float64(width - marginLeft - marginRight)
+	plotH := float64(height - marginTop - marginBottom)
+	px := func(x float64) float64 { return marginLeft + (x-xMin)/(xMax-xMin)*plotW }
+	py := func(y float64) float64 { return marginTop + plotH - y/yMax*plotH }
+
+	// Grid and tick labels
+	for y := 0.0; y <= yMax+yStep/2; y += yStep {
+		cv.line(marginLeft, py(y), marginLeft+plotW, py(y), grid)
+		cv.text(marginLeft-6, py(y)+4, label(y), anchorEnd, black)
+	}
+	xStep := niceStep((xMax - xMin) / nTicks)
+	for x := math.Ceil(xMin/xStep) * xStep; x <= xMax+xStep/1e6; x += xStep {
+		cv.line(px(x), marginTop, px(x), marginTop+plotH, grid)
+		cv.text(px(x), marginTop+plotH+16, label(x), anchorMiddle, black)
+	}
+	cv.line(marginLeft, marginTop, marginLeft, marginTop+plotH, black)
+	cv.line(marginLeft, marginTop+plotH, marginLeft+plotW, marginTop+plotH, black)
+	cv.text(marginLeft+plotW/2, height-10, c.XLabel, anchorMiddle, black)
+	cv.text(marginLeft, marginTop-8, c.YLabel, anchorStart, black)
+
+	// Series and legend
+	n := 0
+	for _, s := range c.Series {
+		if len(s.X) == 0 {
+			continue
+		}
+		color := palette[n%len(palette)]
+		zero := true
+		x := make([]float64, len(s.X))
+		y := make([]float64, len(s.Y))
+		for i := range s.X {
+			x[i] = px(s.X[i])
+			y[i] = py(s.Y[i])
+			if s.Y[i] != 0 {
+				zero = false
+			}
+		}
+		name := s.Name
+		if zero {
+			name += " (0)"
+		} else {
+			cv.polyline(x, y, color)
+		}
+		ly := float64(marginTop + 10 + n*16)
+		cv.rect(width-marginRight-150, ly-8, 10, 10, color)
+		cv.text(width-marginRight-135, ly+1, name, anchorStart, black)
+		n++
+	}
+}
+
+// niceStep returns a round tick step >= v: 1, 2, 5, 10, 20, 50, etc.
+func niceStep(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*p >= v {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// label returns a short tick label: 1500 = "1.5k", 2000000 = "2M".
+func label(v float64) string {
+	switch {
+	case math.Abs(v) >= 1e9:
+		return strconv.FormatFloat(v/1e9, 'f', -1, 64) + "G"
+	case math.Abs(v) >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'f', -1, 64) + "M"
+	case math.Abs(v) >= 1e3:
+		return strconv.FormatFloat(v/1e3, 'f', -1, 64) + "k"
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Block, Inc.
+
+package plot
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// SVG writes the chart as an SVG image.
+func SVG(w io.Writer, c Chart) error {
+	cv := &svgCanvas{}
+	fmt.Fprintf(&cv.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	render(c, cv)
+	cv.b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, cv.b.String())
+	return err
+}
+
+type svgCanvas struct {
+	b strings.Builder
+}
+
+var _ canvas = &svgCanvas{}
+
+func (cv *svgCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	fmt.Fprintf(&cv.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, hex(c))
+}
+
+func (cv *svgCanvas) line(x1, y1, x2, y2 float64, c color.RGBA) {
+	fmt.Fprintf(&cv.b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", x1, y1, x2, y2, hex(c))
+}
+
+func (cv *svgCanvas) polyline(x, y []float64, c color.RGBA) {
+	pts := make([]string, len(x))
+	for i := range x {
+		pts[i] = fmt.Sprintf("%.1f,%.1f", x[i], y[i])
+	}
+	fmt.Fprintf(&cv.b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", strings.Join(pts, " "), hex(c))
+}
+
+func (cv *svgCanvas) text(x, y float64, s string, anchor int, c color.RGBA) {
+	a := "start"
+	switch anchor {
+	case anchorMiddle:
+		a = "middle"
+	case anchorEnd:
+		a = "end"
+	}
+	fmt.Fprintf(&cv.b, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s">%s</text>`+"\n", x, y, a, hex(c), html.EscapeString(s))
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,276 @@
+// Copyright 2024 Block, Inc.
+
+package proto
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// gRPC transport (--server grpc://ADDR and --client grpc://ADDR) between the
+// server and remote compute instances. It's the same protocol as HTTP, but the
+// run phase is one bidirectional stream instead of polling: the client streams
+// stats and its done ack, and the server pushes control commands (run, reset,
+// stop, share, pause). Messages are JSON (see codec) because config.Stage and stats.Instance
+// are already JSON, so there's no protoc-generated code.
+
+const GRPC_SCHEME = "grpc://"
+
+// Control commands the server sends on the Run stream
+const (
+	CMD_RUN   = "run"   // start running the booted stage
+	CMD_RESET = "reset" // stage done before it ran (boot --test or new stage)
+	CMD_STOP  = "stop"  // server stopped the stage while running
+	CMD_SHARE = "share" // rebalance elastic stage (Control.Share)
+	CMD_PAUSE = "pause" // pause or resume stage (Control.Paused)
+)
+
+type BootRequest struct {
+	Name string `json:"name"`
+}
+
+type BootReply struct {
+	Stage json.RawMessage `json:"stage"` // config.Stage
+}
+
+type Ack struct {
+	Name    string `json:"name"`
+	StageId string `json:"stage-id"`
+	Error   string `json:"error,omitempty"`
+}
+
+type FileRequest struct {
+	Name    string `json:"name"`
+	StageId string `json:"stage-id"`
+	I       int    `json:"i"`
+	Data    string `json:"data,omitempty"` // data file name instead of trx file I
+}
+
+type FileReply struct {
+	Data []byte `json:"data"`
+}
+
+type LogRequest struct {
+	Name    string   `json:"name"`
+	StageId string   `json:"stage-id"`
+	Lines   []string `json:"lines"`
+}
+
+// RunMsg is sent by the client on the Run stream: first with only Name and
+// StageId to wait for CMD_RUN, then with Stats while running (or without as
+// a heartbeat every second), and last with Done true.
+type RunMsg struct {
+	Name    string          `json:"name"`
+	StageId string          `json:"stage-id"`
+	Stats   json.RawMessage `json:"stats,omitempty"` // stats.Instance
+	Done    bool            `json:"done,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Control is sent by the server on the Run stream. With HTTP, it's the reply to
+// GET /ping (Cmd is CMD_RUN: keep running).
+type Control struct {
+	Cmd    string `json:"cmd"`
+	Share  *Share `json:"share,omitempty"`  // CMD_RUN and CMD_SHARE if elastic stage
+	Paused bool   `json:"paused,omitempty"` // stage paused (control API)
+}
+
+type Empty struct{}
+
+// --------------------------------------------------------------------------
+
+// codec marshals messages as JSON. It's registered as "json" and used by
+// clients with grpc.CallContentSubtype; servers use it automatically based
+// on the content subtype the client sends.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (codec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (codec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// --------------------------------------------------------------------------
+
+// ComputeServer is the server side of the gRPC service, implemented by the
+// compute server API.
+type ComputeServer interface {
+	Boot(context.Context, *BootRequest) (*BootReply, error)
+	BootAck(context.Context, *Ack) (*Empty, error)
+	File(context.Context, *FileRequest) (*FileReply, error)
+	Log(context.Context, *LogRequest) (*Empty, error)
+	Run(Compute_RunServer) error
+}
+
+type Compute_RunServer interface {
+	Send(*Control) error
+	Recv() (*RunMsg, error)
+	grpc.ServerStream
+}
+
+type computeRunServer struct {
+	grpc.ServerStream
+}
+
+func (s *computeRunServer) Send(m *Control) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *computeRunServer) Recv() (*RunMsg, error) {
+	m := new(RunMsg)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func RegisterComputeServer(s *grpc.Server, srv ComputeServer) {
+	s.RegisterService(&computeServiceDesc, srv)
+}
+
+var computeServiceDesc = grpc.ServiceDesc{
+	ServiceName: "finch.Compute",
+	HandlerType: (*ComputeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Boot",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(BootRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(ComputeServer).Boot(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/finch.Compute/Boot"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(ComputeServer).Boot(ctx, req.(*BootRequest))
+				})
+			},
+		},
+		{
+			MethodName: "BootAck",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(Ack)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(ComputeServer).BootAck(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/finch.Compute/BootAck"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(ComputeServer).BootAck(ctx, req.(*Ack))
+				})
+			},
+		},
+		{
+			MethodName: "File",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(FileRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(ComputeServer).File(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/finch.Compute/File"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(ComputeServer).File(ctx, req.(*FileRequest))
+				})
+			},
+		},
+		{
+			MethodName: "Log",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(LogRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(ComputeServer).Log(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/finch.Compute/Log"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(ComputeServer).Log(ctx, req.(*LogRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Run",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(ComputeServer).Run(&computeRunServer{stream})
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// --------------------------------------------------------------------------
+
+// ComputeClient is the client side of the gRPC service, used by compute.Client.
+type ComputeClient struct {
+	cc *grpc.ClientConn
+}
+
+type Compute_RunClient interface {
+	Send(*RunMsg) error
+	Recv() (*Control, error)
+	grpc.ClientStream
+}
+
+type computeRunClient struct {
+	grpc.ClientStream
+}
+
+func (c *computeRunClient) Send(m *RunMsg) error {
+	return c.ClientStream.SendMsg(m)
+}
+
+func (c *computeRunClient) Recv() (*Control, error) {
+	m := new(Control)
+	if err := c.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func NewComputeClient(cc *grpc.ClientConn) *ComputeClient {
+	return &ComputeClient{cc: cc}
+}
+
+func (c *ComputeClient) Boot(ctx context.Context, in *BootRequest, opts ...grpc.CallOption) (*BootReply, error) {
+	out := new(BootReply)
+	err := c.cc.Invoke(ctx, "/finch.Compute/Boot", in, out, append(opts, grpc.CallContentSubtype("json"))...)
+	return out, err
+}
+
+func (c *ComputeClient) BootAck(ctx context.Context, in *Ack, opts ...grpc.CallOption) error {
+	return c.cc.Invoke(ctx, "/finch.Compute/BootAck", in, new(Empty), append(opts, grpc.CallContentSubtype("json"))...)
+}
+
+func (c *ComputeClient) File(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileReply, error) {
+	out := new(FileReply)
+	err := c.cc.Invoke(ctx, "/finch.Compute/File", in, out, append(opts, grpc.CallContentSubtype("json"))...)
+	return out, err
+}
+
+func (c *ComputeClient) Log(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) error {
+	return c.cc.Invoke(ctx, "/finch.Compute/Log", in, new(Empty), append(opts, grpc.CallContentSubtype("json"))...)
+}
+
+func (c *ComputeClient) Run(ctx context.Context, opts ...grpc.CallOption) (Compute_RunClient, error) {
+	stream, err := c.cc.NewStream(ctx, &computeServiceDesc.Streams[0], "/finch.Compute/Run", append(opts, grpc.CallContentSubtype("json"))...)
+	if err != nil {
+		return nil, err
+	}
+	return &computeRunClient{stream}, nil
+}
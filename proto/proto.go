@@ -4,6 +4,7 @@ package proto
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -19,6 +20,91 @@ import (
 
 var ErrFailed = errors.New("request failed after attempts, or context cancelled")
 
+var ErrUnauthorized = errors.New("server rejected token (--token)")
+
+// Share is sent by the server to compute instances running an elastic stage
+// (config.stage.compute.elastic): the instance is I of N instances, 0-indexed.
+// Interval is the current stats interval for an instance that joins a stage
+// that's already running.
+type Share struct {
+	I        uint `json:"i"`
+	N        uint `json:"n"`
+	Interval uint `json:"interval,omitempty"`
+}
+
+// Status is the server run status returned by GET /status (control API).
+// Runtime is seconds since the current stage started running.
+type Status struct {
+	State    string          `json:"state"` // STATE_*
+	Stage    string          `json:"stage,omitempty"`
+	StageId  string          `json:"stage-id,omitempty"`
+	RunId    string          `json:"run-id,omitempty"`
+	StageNo  uint            `json:"stage-no"` // 1-indexed
+	Stages   uint            `json:"stages"`
+	Runtime  float64         `json:"runtime"`
+	Limit    string          `json:"limit,omitempty"` // config.stage.runtime
+	Paused   bool            `json:"paused"`
+	Computes []ComputeStatus `json:"computes"`
+}
+
+// Run states in Status.State and ComputeStatus.State
+const (
+	STATE_IDLE    = "idle"    // no stage yet (server), or waiting for stage (compute)
+	STATE_BOOTING = "booting" // preparing stage
+	STATE_BOOTED  = "booted"  // waiting for run signal
+	STATE_RUNNING = "running"
+	STATE_DONE    = "done" // all stages done (server)
+)
+
+// ComputeStatus is the status of one compute instance in Status. Interval,
+// Runtime, and Clients are from the last stats the instance sent, and Seen
+// is seconds since the server last heard from the instance. These are zero
+// for the local instance, which doesn't send stats or heartbeats.
+type ComputeStatus struct {
+	Name     string  `json:"name"`
+	Instance uint    `json:"instance,omitempty"`
+	State    string  `json:"state"` // STATE_*
+	Interval uint    `json:"interval"`
+	Runtime  float64 `json:"runtime"`
+	Clients  uint    `json:"clients"`
+	Seen     float64 `json:"seen"`
+}
+
+// StageError is a recent stage error returned by GET /errors (control API):
+// a compute instance failed to boot, returned an error running the stage, or
+// was lost.
+type StageError struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Compute string    `json:"compute"`
+	Error   string    `json:"error"`
+}
+
+// Job is a benchmark job in the server job queue (--queue): stage files (on the
+// server) run sequentially like stage files on the command line. Clients submit
+// only Stages and Params (--param KEY=VAL); the server sets the rest.
+type Job struct {
+	Id        string    `json:"id"`
+	Stages    []string  `json:"stages"`
+	Params    []string  `json:"params,omitempty"`
+	State     string    `json:"state"` // JOB_*
+	Error     string    `json:"error,omitempty"`
+	Dir       string    `json:"dir"` // archive dir on server
+	Submitted time.Time `json:"submitted"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Job states in Job.State
+const (
+	JOB_QUEUED   = "queued"
+	JOB_RUNNING  = "running"
+	JOB_DONE     = "done"
+	JOB_FAILED   = "failed"   // load or stage error
+	JOB_STOPPED  = "stopped"  // POST /control/stop or CTRL-C
+	JOB_CANCELED = "canceled" // DELETE /jobs before it ran
+)
+
 type R struct {
 	Timeout time.Duration
 	Wait    time.Duration
@@ -32,6 +118,7 @@ type Client struct {
 	client      *http.Client
 	StageId     string
 	PrintErrors bool
+	Gzip        bool // compress request bodies (Content-Encoding: gzip)
 }
 
 func NewClient(name, server string) *Client {
@@ -56,9 +143,17 @@ func (c *Client) request(ctx context.Context, method string, endpoint string, pa
 	url := c.URL(endpoint, params)
 	finch.Debug("%s %s", method, url)
 
-	buf := new(bytes.Buffer)
+	var reqBody []byte
 	if data != nil {
-		json.NewEncoder(buf).Encode(data)
+		buf := new(bytes.Buffer)
+		if c.Gzip {
+			gz := gzip.NewWriter(buf)
+			json.NewEncoder(gz).Encode(data)
+			gz.Close()
+		} else {
+			json.NewEncoder(buf).Encode(data)
+		}
+		reqBody = buf.Bytes()
 	}
 
 	var err error
@@ -69,7 +164,10 @@ func (c *Client) request(ctx context.Context, method string, endpoint string, pa
 	for r.Tries == -1 || try < r.Tries {
 		try += 1
 		ctxReq, cancelReq := context.WithTimeout(ctx, r.Timeout)
-		req, _ = http.NewRequestWithContext(ctxReq, method, url, buf)
+		req, _ = http.NewRequestWithContext(ctxReq, method, url, bytes.NewReader(reqBody))
+		if c.Gzip && reqBody != nil {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
 		resp, err = c.client.Do(req)
 		cancelReq()
 		if err != nil {
@@ -87,6 +185,8 @@ func (c *Client) request(ctx context.Context, method string, endpoint string, pa
 			return resp, body, nil // success
 		case http.StatusResetContent:
 			return resp, nil, nil // reset
+		case http.StatusUnauthorized:
+			return resp, nil, ErrUnauthorized // don't retry
 		default:
 			goto RETRY
 		}
@@ -0,0 +1,391 @@
+// Copyright 2024 Block, Inc.
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MySQL client/server protocol: https://dev.mysql.com/doc/dev/mysql-server/latest/PAGE_PROTOCOL.html
+
+const (
+	comQuit        = 0x01
+	comInitDB      = 0x02
+	comQuery       = 0x03
+	comStmtPrepare = 0x16
+	comStmtExecute = 0x17
+	comStmtClose   = 0x19
+)
+
+// Capabilities removed from the server greeting so the client doesn't use
+// them and the proxy can read the commands: TLS and compression would hide
+// the commands, and query attributes change the COM_STMT_EXECUTE format.
+const (
+	clientConnectWithDB   = 0x00000008
+	clientCompress        = 0x00000020
+	clientSSL             = 0x00000800
+	clientSecureConn      = 0x00008000
+	clientPluginAuthLenec = 0x00200000
+	clientQueryAttributes = 0x08000000
+	clientZstdCompression = 0x04000000
+
+	stripCapabilities = clientCompress | clientSSL | clientQueryAttributes | clientZstdCompression
+)
+
+const maxPacketSize = 1<<24 - 1
+
+// packet is one MySQL protocol packet.
+type packet struct {
+	seq     byte
+	payload []byte
+}
+
+// readPacket reads one packet. Large payloads (>= 16 MB) are split into
+// multiple packets; each is returned separately.
+func readPacket(r io.Reader) (packet, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return packet{}, nil, err
+	}
+	n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	raw := make([]byte, 4+n)
+	copy(raw, header[:])
+	if _, err := io.ReadFull(r, raw[4:]); err != nil {
+		return packet{}, nil, err
+	}
+	return packet{seq: header[3], payload: raw[4:]}, raw, nil
+}
+
+// greeting returns the connection ID from the server greeting (protocol v10)
+// and removes capabilities in stripCapabilities. The payload is modified in
+// place. If the greeting is not protocol v10, it's not modified.
+func greeting(payload []byte) uint64 {
+	if len(payload) < 1 || payload[0] != 10 {
+		return 0
+	}
+	// version: null-terminated string
+	i := bytes.IndexByte(payload[1:], 0)
+	if i < 0 {
+		return 0
+	}
+	p := 1 + i + 1
+	if len(payload) < p+4 {
+		return 0
+	}
+	conn := uint64(binary.LittleEndian.Uint32(payload[p:]))
+	p += 4 + 8 + 1 // conn ID, auth-plugin-data-part-1, filler
+	if len(payload) < p+2 {
+		return conn
+	}
+	lower := binary.LittleEndian.Uint16(payload[p:])
+	binary.LittleEndian.PutUint16(payload[p:], lower&^uint16(stripCapabilities&0xFFFF))
+	p += 2 + 1 + 2 // lower capabilities, charset, status
+	if len(payload) < p+2 {
+		return conn
+	}
+	upper := binary.LittleEndian.Uint16(payload[p:])
+	binary.LittleEndian.PutUint16(payload[p:], upper&^uint16(stripCapabilities>>16))
+	return conn
+}
+
+// handshakeDb returns the database from the client handshake response, if any.
+func handshakeDb(payload []byte) string {
+	if len(payload) < 32 {
+		return ""
+	}
+	caps := binary.LittleEndian.Uint32(payload)
+	if caps&clientConnectWithDB == 0 {
+		return ""
+	}
+	p := 32 // capabilities, max packet size, charset, filler
+	i := bytes.IndexByte(payload[p:], 0)
+	if i < 0 {
+		return ""
+	}
+	p += i + 1 // username
+	switch {
+	case caps&clientPluginAuthLenec != 0:
+		n, size := lenencInt(payload[p:])
+		p += size + int(n)
+	case caps&clientSecureConn != 0:
+		if p >= len(payload) {
+			return ""
+		}
+		p += 1 + int(payload[p])
+	default:
+		i := bytes.IndexByte(payload[p:], 0)
+		if i < 0 {
+			return ""
+		}
+		p += i + 1
+	}
+	if p >= len(payload) {
+		return ""
+	}
+	db, _, _ := bytes.Cut(payload[p:], []byte{0})
+	return string(db)
+}
+
+// prepareOK returns the statement ID and number of params from a
+// COM_STMT_PREPARE OK response, or false if the payload isn't one.
+func prepareOK(payload []byte) (uint32, int, bool) {
+	if len(payload) < 12 || payload[0] != 0x00 {
+		return 0, 0, false
+	}
+	id := binary.LittleEndian.Uint32(payload[1:])
+	params := int(binary.LittleEndian.Uint16(payload[7:]))
+	return id, params, true
+}
+
+// stmt is a prepared statement.
+type stmt struct {
+	query  string
+	params int
+	types  []byte // [type, flags] per param, from last execute that sent them
+}
+
+// execute returns the statement ID and param values as SQL literals from a
+// COM_STMT_EXECUTE payload. Param types are saved in the statement because
+// they are only sent when they change.
+func execute(payload []byte, stmts map[uint32]*stmt) (*stmt, []string, error) {
+	if len(payload) < 10 {
+		return nil, nil, fmt.Errorf("COM_STMT_EXECUTE too short: %d bytes", len(payload))
+	}
+	id := binary.LittleEndian.Uint32(payload[1:])
+	s, ok := stmts[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("COM_STMT_EXECUTE unknown statement ID %d", id)
+	}
+	if s.params == 0 {
+		return s, nil, nil
+	}
+	p := 10 // command, stmt ID, flags, iteration count
+	nullBitmap := payload[p : p+(s.params+7)/8]
+	p += len(nullBitmap)
+	if p >= len(payload) {
+		return nil, nil, fmt.Errorf("COM_STMT_EXECUTE truncated")
+	}
+	if payload[p] == 1 { // new params bound: types follow
+		p++
+		if len(payload) < p+s.params*2 {
+			return nil, nil, fmt.Errorf("COM_STMT_EXECUTE truncated param types")
+		}
+		s.types = append(s.types[:0], payload[p:p+s.params*2]...)
+		p += s.params * 2
+	} else {
+		p++
+	}
+	if len(s.types) != s.params*2 {
+		return nil, nil, fmt.Errorf("COM_STMT_EXECUTE no param types")
+	}
+
+	values := make([]string, s.params)
+	for i := 0; i < s.params; i++ {
+		if nullBitmap[i/8]&(1<<(i%8)) != 0 {
+			values[i] = "NULL"
+			continue
+		}
+		v, n, err := binaryValue(payload[p:], s.types[i*2], s.types[i*2+1]&0x80 != 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("param %d: %s", i+1, err)
+		}
+		values[i] = v
+		p += n
+	}
+	return s, values, nil
+}
+
+// binaryValue returns the SQL literal and size of a value in the binary protocol.
+func binaryValue(b []byte, typ byte, unsigned bool) (string, int, error) {
+	need := func(n int) error {
+		if len(b) < n {
+			return fmt.Errorf("type %d: need %d bytes, have %d", typ, n, len(b))
+		}
+		return nil
+	}
+	switch typ {
+	case 0x06: // NULL
+		return "NULL", 0, nil
+	case 0x01: // TINY
+		if err := need(1); err != nil {
+			return "", 0, err
+		}
+		if unsigned {
+			return strconv.FormatUint(uint64(b[0]), 10), 1, nil
+		}
+		return strconv.FormatInt(int64(int8(b[0])), 10), 1, nil
+	case 0x02, 0x0d: // SHORT, YEAR
+		if err := need(2); err != nil {
+			return "", 0, err
+		}
+		v := binary.LittleEndian.Uint16(b)
+		if unsigned {
+			return strconv.FormatUint(uint64(v), 10), 2, nil
+		}
+		return strconv.FormatInt(int64(int16(v)), 10), 2, nil
+	case 0x03, 0x09: // LONG, INT24
+		if err := need(4); err != nil {
+			return "", 0, err
+		}
+		v := binary.LittleEndian.Uint32(b)
+		if unsigned {
+			return strconv.FormatUint(uint64(v), 10), 4, nil
+		}
+		return strconv.FormatInt(int64(int32(v)), 10), 4, nil
+	case 0x08: // LONGLONG
+		if err := need(8); err != nil {
+			return "", 0, err
+		}
+		v := binary.LittleEndian.Uint64(b)
+		if unsigned {
+			return strconv.FormatUint(v, 10), 8, nil
+		}
+		return strconv.FormatInt(int64(v), 10), 8, nil
+	case 0x04: // FLOAT
+		if err := need(4); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32), 4, nil
+	case 0x05: // DOUBLE
+		if err := need(8); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64), 8, nil
+	case 0x07, 0x0a, 0x0c: // TIMESTAMP, DATE, DATETIME
+		if err := need(1); err != nil {
+			return "", 0, err
+		}
+		n := int(b[0])
+		if err := need(1 + n); err != nil {
+			return "", 0, err
+		}
+		d := b[1 : 1+n]
+		var year, month, day, hour, min, sec, usec int
+		if n >= 4 {
+			year, month, day = int(binary.LittleEndian.Uint16(d)), int(d[2]), int(d[3])
+		}
+		if n >= 7 {
+			hour, min, sec = int(d[4]), int(d[5]), int(d[6])
+		}
+		if n >= 11 {
+			usec = int(binary.LittleEndian.Uint32(d[7:]))
+		}
+		v := fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+		if typ != 0x0a {
+			v += fmt.Sprintf(" %02d:%02d:%02d", hour, min, sec)
+			if usec > 0 {
+				v += fmt.Sprintf(".%06d", usec)
+			}
+		}
+		return "'" + v + "'", 1 + n, nil
+	case 0x0b: // TIME
+		if err := need(1); err != nil {
+			return "", 0, err
+		}
+		n := int(b[0])
+		if err := need(1 + n); err != nil {
+			return "", 0, err
+		}
+		d := b[1 : 1+n]
+		var neg bool
+		var days, hour, min, sec, usec int
+		if n >= 8 {
+			neg, days, hour, min, sec = d[0] == 1, int(binary.LittleEndian.Uint32(d[1:])), int(d[5]), int(d[6]), int(d[7])
+		}
+		if n >= 12 {
+			usec = int(binary.LittleEndian.Uint32(d[8:]))
+		}
+		v := fmt.Sprintf("%02d:%02d:%02d", days*24+hour, min, sec)
+		if usec > 0 {
+			v += fmt.Sprintf(".%06d", usec)
+		}
+		if neg {
+			v = "-" + v
+		}
+		return "'" + v + "'", 1 + n, nil
+	}
+
+	// All other types are length-encoded strings: VARCHAR, BLOB, DECIMAL, JSON, etc.
+	n, size := lenencInt(b)
+	if size == 0 || len(b) < size+int(n) {
+		return "", 0, fmt.Errorf("type %d: truncated string", typ)
+	}
+	return quote(string(b[size : size+int(n)])), size + int(n), nil
+}
+
+// lenencInt returns a length-encoded integer and its size in bytes, or size 0
+// if b is too short.
+func lenencInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, 0
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:])), 3
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, 0
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, 0
+		}
+		return binary.LittleEndian.Uint64(b[1:]), 9
+	}
+	return uint64(b[0]), 1
+}
+
+// quote returns s as a quoted and escaped SQL string literal.
+func quote(s string) string {
+	return "'" + strings.NewReplacer(
+		"\\", "\\\\",
+		"'", "\\'",
+		"\x00", "\\0",
+		"\x1a", "\\Z",
+	).Replace(s) + "'"
+}
+
+// interpolate replaces "?" placeholders in a prepared statement with values.
+// Placeholders in quoted strings, identifiers, and comments are ignored.
+func interpolate(query string, values []string) string {
+	var sb strings.Builder
+	sb.Grow(len(query))
+	v := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch c {
+		case '\'', '"', '`':
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if query[j] == '\\' && c != '`' {
+					j++
+				}
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			sb.WriteString(query[i : j+1])
+			i = j
+		case '?':
+			if v < len(values) {
+				sb.WriteString(values[v])
+				v++
+			} else {
+				sb.WriteByte(c)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Block, Inc.
+
+// Package record implements "finch record": a pass-through MySQL proxy that
+// captures statements (and prepared statement values) from clients and writes
+// them to a log in MySQL general query log format, which can be replayed with
+// --replay or made into stage and trx files by the replay package.
+package record
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/finch"
+)
+
+const (
+	DEFAULT_LISTEN   = "127.0.0.1:3307"
+	DEFAULT_UPSTREAM = "127.0.0.1:3306"
+)
+
+// Proxy is a pass-through MySQL proxy that records client commands.
+type Proxy struct {
+	Listen   string // addr:port to listen on for clients
+	Upstream string // addr:port of MySQL
+
+	w  *bufio.Writer // general log
+	mu *sync.Mutex   // guards w
+	wg sync.WaitGroup
+	n  uint64 // queries recorded, guarded by mu
+}
+
+// NewProxy returns a proxy that writes the general log to w.
+func NewProxy(listen, upstream string, w io.Writer) *Proxy {
+	return &Proxy{
+		Listen:   listen,
+		Upstream: upstream,
+		w:        bufio.NewWriter(w),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Run runs the proxy until ctx is cancelled, then closes all connections and
+// flushes the log. It returns the number of queries recorded.
+func (p *Proxy) Run(ctx context.Context, ready chan<- string) (uint64, error) {
+	ln, err := net.Listen("tcp", p.Listen)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Recording on %s, proxy to %s (CTRL-C to stop)", ln.Addr(), p.Upstream)
+	if ready != nil {
+		ready <- ln.Addr().String()
+	}
+
+	// Header like mysqld general log so the file looks familiar
+	p.mu.Lock()
+	fmt.Fprintf(p.w, "finch record, Version: %s. started with:\nTcp port: %s  Unix socket: \nTime                 Id Command    Argument\n", finch.VERSION, p.Listen)
+	p.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		client, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break // stopped
+			}
+			log.Printf("Error accepting connection: %s", err)
+			continue
+		}
+		p.wg.Add(1)
+		go p.proxy(ctx, client)
+	}
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.n, p.w.Flush()
+}
+
+// proxy copies packets between client and MySQL until either closes the
+// connection or ctx is cancelled, recording client commands.
+func (p *Proxy) proxy(ctx context.Context, client net.Conn) {
+	defer p.wg.Done()
+	defer client.Close()
+
+	server, err := net.Dial("tcp", p.Upstream)
+	if err != nil {
+		log.Printf("Error connecting to %s: %s", p.Upstream, err)
+		return
+	}
+	defer server.Close()
+
+	// Close both connections on ctx cancel to stop the io loops
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+			server.Close()
+		case <-done:
+		}
+	}()
+
+	c := &conn{
+		p:     p,
+		stmts: map[uint32]*stmt{},
+	}
+
+	// Server greeting: connection ID and remove capabilities like TLS that
+	// would prevent recording
+	pkt, raw, err := readPacket(server)
+	if err != nil {
+		return
+	}
+	c.id = greeting(pkt.payload)
+	if _, err := client.Write(raw); err != nil {
+		return
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		defer client.Close()
+		for {
+			pkt, raw, err := readPacket(server)
+			if err != nil {
+				return
+			}
+			c.response(pkt)
+			if _, err := client.Write(raw); err != nil {
+				return
+			}
+		}
+	}()
+
+	var buf []byte // payload split over multiple packets
+	for {
+		pkt, raw, err := readPacket(client)
+		if err != nil {
+			break
+		}
+		// Record before sending to MySQL so state for the response, like
+		// COM_STMT_PREPARE, is set before the response is read
+		if len(buf) > 0 || len(pkt.payload) == maxPacketSize {
+			buf = append(buf, pkt.payload...)
+			if len(pkt.payload) < maxPacketSize {
+				c.command(packet{seq: pkt.seq, payload: buf})
+				buf = nil
+			}
+		} else {
+			c.command(pkt)
+		}
+		if _, err := server.Write(raw); err != nil {
+			break
+		}
+	}
+	server.Close()
+	<-serverDone
+}
+
+// conn is the recording state of one proxied connection.
+type conn struct {
+	p       *Proxy
+	id      uint64
+	mu      sync.Mutex
+	stmts   map[uint32]*stmt // prepared statements
+	prepare string           // query of COM_STMT_PREPARE waiting for response
+	auth    bool             // handshake response logged
+}
+
+// command records a client command. Commands are packets with sequence 0;
+// other client packets are part of the connection handshake.
+func (c *conn) command(pkt packet) {
+	if pkt.seq != 0 {
+		if !c.auth && pkt.seq == 1 && len(pkt.payload) >= 32 {
+			c.auth = true
+			c.log("Connect", "finch@record on "+handshakeDb(pkt.payload)+" using TCP/IP")
+		}
+		return
+	}
+	if len(pkt.payload) == 0 {
+		return
+	}
+	arg := string(pkt.payload[1:])
+	switch pkt.payload[0] {
+	case comQuery:
+		c.log("Query", arg)
+	case comInitDB:
+		c.log("Init DB", arg)
+	case comQuit:
+		c.log("Quit", "")
+	case comStmtPrepare:
+		c.mu.Lock()
+		c.prepare = arg
+		c.mu.Unlock()
+	case comStmtExecute:
+		c.mu.Lock()
+		s, values, err := execute(pkt.payload, c.stmts)
+		c.mu.Unlock()
+		if err != nil {
+			finch.Debug("conn %d: %s", c.id, err)
+			return
+		}
+		c.log("Execute", interpolate(s.query, values))
+	case comStmtClose:
+		if len(pkt.payload) >= 5 {
+			c.mu.Lock()
+			delete(c.stmts, uint32(pkt.payload[1])|uint32(pkt.payload[2])<<8|uint32(pkt.payload[3])<<16|uint32(pkt.payload[4])<<24)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// response saves the statement ID and number of params from the response to
+// COM_STMT_PREPARE, which is the first response packet (sequence 1).
+func (c *conn) response(pkt packet) {
+	if pkt.seq != 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prepare == "" {
+		return
+	}
+	if id, params, ok := prepareOK(pkt.payload); ok {
+		c.stmts[id] = &stmt{query: c.prepare, params: params}
+	}
+	c.prepare = ""
+}
+
+// log writes a general log line: TIME ID COMMAND\tARGUMENT.
+func (c *conn) log(command, arg string) {
+	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	fmt.Fprintf(c.p.w, "%s\t%7d %s\t%s\n", ts, c.id, command, strings.TrimSpace(arg))
+	if command == "Query" || command == "Execute" {
+		c.p.n++
+	}
+}
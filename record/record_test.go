@@ -0,0 +1,153 @@
+// Copyright 2024 Block, Inc.
+
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/square/finch/record"
+	"github.com/square/finch/replay"
+)
+
+func writePacket(w io.Writer, seq byte, payload []byte) error {
+	n := len(payload)
+	_, err := w.Write(append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...))
+	return err
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var h [4]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, int(h[0])|int(h[1])<<8|int(h[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return h[3], payload, err
+}
+
+var ok = []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+// fakeMySQL accepts one connection and responds to the handshake and commands
+// with the minimum packets for the test.
+func fakeMySQL(t *testing.T, ln net.Listener) {
+	c, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	// Greeting: protocol 10, version, conn ID 42, salt, all capabilities
+	g := []byte{10}
+	g = append(g, []byte("8.0.36\x00")...)
+	g = binary.LittleEndian.AppendUint32(g, 42)
+	g = append(g, []byte("12345678\x00")...)
+	g = append(g, 0xff, 0xff, 0x21, 0x02, 0x00, 0xff, 0xff, 21)
+	g = append(g, make([]byte, 10)...)
+	g = append(g, []byte("123456789012\x00mysql_native_password\x00")...)
+	writePacket(c, 0, g)
+
+	if _, _, err := readPacket(c); err != nil { // handshake response
+		return
+	}
+	writePacket(c, 2, ok)
+
+	for {
+		_, cmd, err := readPacket(c)
+		if err != nil || len(cmd) == 0 || cmd[0] == 0x01 { // COM_QUIT
+			return
+		}
+		if cmd[0] == 0x16 { // COM_STMT_PREPARE: stmt 1, 0 columns, 2 params
+			writePacket(c, 1, []byte{0x00, 1, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0})
+			continue
+		}
+		writePacket(c, 1, ok)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go fakeMySQL(t, ln)
+
+	var out bytes.Buffer
+	p := record.NewProxy("127.0.0.1:0", ln.Addr().String(), &out)
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan string, 1)
+	doneChan := make(chan uint64)
+	go func() {
+		n, err := p.Run(ctx, ready)
+		if err != nil {
+			t.Error(err)
+		}
+		doneChan <- n
+	}()
+
+	c, err := net.Dial("tcp", <-ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Greeting must not have TLS capability (0x0800)
+	_, g, err := readPacket(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := binary.LittleEndian.Uint16(g[len("\x0a8.0.36\x00")+4+9:])
+	if caps&0x0800 != 0 {
+		t.Errorf("TLS capability not removed from server greeting: %x", caps)
+	}
+
+	// Handshake response: CONNECT_WITH_DB | SECURE_CONNECTION, user u, no auth, db shop
+	h := binary.LittleEndian.AppendUint32(nil, 0x00008008|0x0200)
+	h = append(h, make([]byte, 28)...)
+	h = append(h, []byte("u\x00\x00shop\x00")...)
+	writePacket(c, 1, h)
+	readPacket(c)
+
+	writePacket(c, 0, append([]byte{0x03}, []byte("SELECT 1")...)) // COM_QUERY
+	readPacket(c)
+
+	writePacket(c, 0, append([]byte{0x16}, []byte("SELECT c FROM t WHERE id = ? AND c = ?")...)) // COM_STMT_PREPARE
+	readPacket(c)
+
+	// COM_STMT_EXECUTE: stmt 1, no flags, iteration 1, null bitmap, new params
+	// bound, types LONGLONG and VARCHAR, values 7 and "it's"
+	e := []byte{0x17, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0x00, 1, 0x08, 0x00, 0x0f, 0x00}
+	e = binary.LittleEndian.AppendUint64(e, 7)
+	e = append(e, 4)
+	e = append(e, []byte("it's")...)
+	writePacket(c, 0, e)
+	readPacket(c)
+
+	writePacket(c, 0, []byte{0x01}) // COM_QUIT
+	c.Close()
+
+	cancel()
+	n := <-doneChan
+	if n != 2 {
+		t.Errorf("recorded %d queries, expected 2", n)
+	}
+
+	queries, err := replay.ParseLog(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("got %d queries, expected 2: %+v", len(queries), queries)
+	}
+	if queries[0].SQL != "SELECT 1" || queries[0].Conn != 42 || queries[0].Db != "shop" {
+		t.Errorf("got query 1 %+v, expected SELECT 1 on conn 42 db shop", queries[0])
+	}
+	if queries[1].SQL != `SELECT c FROM t WHERE id = 7 AND c = 'it\'s'` {
+		t.Errorf("got query 2 %s", queries[1].SQL)
+	}
+}
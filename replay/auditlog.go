@@ -0,0 +1,70 @@
+// Copyright 2024 Block, Inc.
+
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type auditRecord struct {
+	AuditRecord struct {
+		Name         string      `json:"name"`
+		Timestamp    string      `json:"timestamp"`
+		ConnectionId json.Number `json:"connection_id"`
+		Status       int         `json:"status"`
+		SQLText      string      `json:"sqltext"`
+		Db           string      `json:"db"`
+	} `json:"audit_record"`
+}
+
+// ParseAuditLog parses a Percona Server audit log in JSON format (audit_log_format
+// = JSON), one record per line, and returns the queries in the order logged.
+// Only successful Query records are returned.
+func ParseAuditLog(r io.Reader) ([]Query, error) {
+	queries := []Query{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // queries can be long
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec auditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		a := rec.AuditRecord
+		if a.Name != "Query" || a.Status != 0 {
+			continue
+		}
+		q := strings.TrimSuffix(strings.TrimSpace(a.SQLText), ";")
+		if q == "" {
+			continue
+		}
+		conn, _ := strconv.ParseUint(a.ConnectionId.String(), 10, 64)
+		queries = append(queries, Query{Time: auditTime(a.Timestamp), Conn: conn, Db: a.Db, SQL: q})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// auditTime parses the audit record timestamp: 2024-01-02T03:04:05 UTC.
+func auditTime(s string) time.Time {
+	if t, err := time.Parse("2006-01-02T15:04:05 MST", s); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Block, Inc.
+
+package replay
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/square/finch"
+)
+
+// Digest is one row from performance_schema.events_statements_summary_by_digest.
+type Digest struct {
+	Db        string        // SCHEMA_NAME
+	Sample    string        // QUERY_SAMPLE_TEXT
+	Count     uint64        // COUNT_STAR
+	Time      time.Duration // SUM_TIMER_WAIT
+	FirstSeen time.Time     // FIRST_SEEN
+	LastSeen  time.Time     // LAST_SEEN
+}
+
+const digestQuery = `SELECT COALESCE(SCHEMA_NAME, ''), QUERY_SAMPLE_TEXT, COUNT_STAR, SUM_TIMER_WAIT,
+UNIX_TIMESTAMP(FIRST_SEEN), UNIX_TIMESTAMP(LAST_SEEN)
+FROM performance_schema.events_statements_summary_by_digest
+WHERE QUERY_SAMPLE_TEXT IS NOT NULL AND QUERY_SAMPLE_TRUNCATED = 'NO'
+AND (SCHEMA_NAME IS NULL OR SCHEMA_NAME NOT IN ('mysql', 'performance_schema', 'information_schema', 'sys'))
+ORDER BY COUNT_STAR DESC`
+
+// ReadDigests reads statement digests from the MySQL server. It requires MySQL
+// 8.0 or newer for the query sample text. Digests with truncated samples and
+// digests in system databases are not returned.
+func ReadDigests(db *sql.DB) ([]Digest, error) {
+	rows, err := db.Query(digestQuery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read performance_schema.events_statements_summary_by_digest (MySQL 8.0 or newer is required): %s", err)
+	}
+	defer rows.Close()
+	digests := []Digest{}
+	for rows.Next() {
+		var d Digest
+		var ps uint64
+		var first, last float64
+		if err := rows.Scan(&d.Db, &d.Sample, &d.Count, &ps, &first, &last); err != nil {
+			return nil, err
+		}
+		d.Time = time.Duration(ps / 1000) // picoseconds -> nanoseconds
+		d.FirstSeen = unixTime(first)
+		d.LastSeen = unixTime(last)
+		digests = append(digests, d)
+	}
+	return digests, rows.Err()
+}
+
+func unixTime(sec float64) time.Time {
+	s, frac := math.Modf(sec)
+	return time.Unix(int64(s), int64(frac*1e9))
+}
+
+// LoadDigests reads statement digests from the MySQL server at dsn and
+// synthesizes a workload like Load in fingerprint mode: one statement per
+// digest, executed with probability proportional to its execution count.
+// The only values for each statement are from the digest query sample.
+func LoadDigests(dsn string, opts Options, dir string) ([]string, []string, error) {
+	if opts.Mode != "" && opts.Mode != MODE_FINGERPRINT {
+		return nil, nil, fmt.Errorf("invalid --replay-mode %s: digests can only be replayed in fingerprint mode", opts.Mode)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	digests, err := ReadDigests(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := Synthesize(digests, opts, dir); err != nil {
+		return nil, nil, err
+	}
+	return []string{filepath.Join(dir, "replay.yaml")}, nil, nil
+}
+
+// Synthesize writes stage and trx files to dir for the digests. The QPS and
+// runtime are the total execution count over the time from the first first-seen
+// to the last last-seen. The number of clients is the average number of queries
+// executing concurrently: total query time divided by runtime.
+func Synthesize(digests []Digest, opts Options, dir string) error {
+	if opts.Speed < 0 {
+		return fmt.Errorf("invalid --replay-speed %f: must be >= 0", opts.Speed)
+	}
+	set := newDigestSet()
+	dbs := map[string]bool{}
+	var first, last time.Time
+	var total time.Duration
+	for _, d := range digests {
+		if d.Count == 0 || !set.add(d.Sample, d.Count) {
+			continue
+		}
+		dbs[d.Db] = true
+		total += d.Time
+		if first.IsZero() || d.FirstSeen.Before(first) {
+			first = d.FirstSeen
+		}
+		if d.LastSeen.After(last) {
+			last = d.LastSeen
+		}
+	}
+	runtime := last.Sub(first)
+	clients := 1
+	if runtime > 0 {
+		clients = int(math.Ceil(float64(total) / float64(runtime)))
+	}
+	finch.Debug("digests: %d queries in %s, %s query time, %d clients", set.total, runtime, total, clients)
+	return set.write(clients, onlyDb(dbs), runtime, opts, dir)
+}
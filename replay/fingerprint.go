@@ -0,0 +1,164 @@
+// Copyright 2024 Block, Inc.
+
+package replay
+
+import (
+	"strings"
+)
+
+// Literal is a literal value in a query, like 1 or 'abc'.
+type Literal struct {
+	Value  string // unquoted and unescaped
+	Quoted bool   // true if string literal, false if number
+}
+
+// Fingerprint returns the query with literals replaced by "?" and whitespace
+// collapsed, and the literals in the order they occur. Comments are removed
+// except version comments (/*! */) and optimizer hints (/*+ */). Queries that
+// differ only in literal values have the same fingerprint.
+func Fingerprint(query string) (string, []Literal) {
+	var fp strings.Builder
+	literals := []Literal{}
+	fp.Grow(len(query))
+
+	space := false // pending space, written before the next non-space char
+	write := func(s string) {
+		if space && fp.Len() > 0 {
+			fp.WriteByte(' ')
+		}
+		space = false
+		fp.WriteString(s)
+	}
+
+	n := len(query)
+	for i := 0; i < n; i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+
+		case c == '\'' || c == '"':
+			// String literal: 'it''s' or 'it\'s' -> it's
+			var v strings.Builder
+			j := i + 1
+			for ; j < n; j++ {
+				if query[j] == '\\' && j+1 < n {
+					j++
+					v.WriteByte(unescape(query[j]))
+					continue
+				}
+				if query[j] == c {
+					if j+1 < n && query[j+1] == c {
+						j++
+						v.WriteByte(c)
+						continue
+					}
+					break
+				}
+				v.WriteByte(query[j])
+			}
+			write("?")
+			literals = append(literals, Literal{Value: v.String(), Quoted: true})
+			i = j
+
+		case c == '`':
+			// Quoted identifier: copy verbatim
+			j := strings.IndexByte(query[i+1:], '`')
+			if j < 0 {
+				write(query[i:])
+				i = n
+				break
+			}
+			write(query[i : i+j+2])
+			i += j + 1
+
+		case c == '#' || (c == '-' && i+2 < n && query[i+1] == '-' && (query[i+2] == ' ' || query[i+2] == '\t')) || (c == '-' && i+2 == n && query[i+1] == '-'):
+			// Comment to end of line
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				i = n
+			} else {
+				i += j
+			}
+			space = true
+
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			j := strings.Index(query[i+2:], "*/")
+			end := n
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			if i+2 < n && (query[i+2] == '!' || query[i+2] == '+') {
+				write(query[i:end]) // keep version comments and hints
+			} else {
+				space = true
+			}
+			i = end - 1
+
+		case isDigit(c) && !identChar(fp.String(), space):
+			// Number: 1, 1.5, 1e-3, 0xFF
+			j := i + 1
+			if c == '0' && j < n && (query[j] == 'x' || query[j] == 'X') {
+				for j++; j < n && isHex(query[j]); j++ {
+				}
+			} else {
+				for ; j < n && (isDigit(query[j]) || query[j] == '.'); j++ {
+				}
+				if j < n && (query[j] == 'e' || query[j] == 'E') {
+					k := j + 1
+					if k < n && (query[k] == '+' || query[k] == '-') {
+						k++
+					}
+					if k < n && isDigit(query[k]) {
+						for j = k; j < n && isDigit(query[j]); j++ {
+						}
+					}
+				}
+			}
+			write("?")
+			literals = append(literals, Literal{Value: query[i:j]})
+			i = j - 1
+
+		default:
+			write(string(c))
+		}
+	}
+	return fp.String(), literals
+}
+
+// identChar returns true if the last char written to s is part of an identifier,
+// like the 1 in t1, so a following digit is not a number literal.
+func identChar(s string, space bool) bool {
+	if space || s == "" {
+		return false
+	}
+	c := s[len(s)-1]
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// unescape returns the char for a MySQL string escape sequence: \n -> newline.
+func unescape(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 26
+	}
+	return c // \' \" \\ and others are the char itself
+}
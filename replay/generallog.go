@@ -0,0 +1,82 @@
+// Copyright 2024 Block, Inc.
+
+package replay
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A general log line is TIME ID COMMAND\tARGUMENT. In MySQL 5.7 and newer,
+// TIME is RFC 3339 on every line. In older versions, TIME is YYMMDD H:MM:SS
+// and only on the first line in each second.
+var reGeneralLine = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\S+|\d{6}\s+\d{1,2}:\d\d:\d\d)?\s+(\d+) ([A-Z][a-z]+(?: [A-Za-z]+)?)(?:\t(.*))?$`)
+
+// ParseGeneralLog parses a MySQL general query log and returns the queries in
+// the order logged. Only Query and Execute commands (with values, as logged)
+// are returned. Connect and Init DB set Query.Db for the connection.
+func ParseGeneralLog(r io.Reader) ([]Query, error) {
+	queries := []Query{}
+	db := map[uint64]string{} // connection ID -> current db
+
+	var (
+		t    time.Time // last logged time
+		conn uint64    // of current command
+		sql  []string  // query lines, if current command is a query
+	)
+	flush := func() {
+		q := strings.TrimSuffix(strings.TrimSpace(strings.Join(sql, "\n")), ";")
+		sql = nil
+		if q == "" {
+			return
+		}
+		queries = append(queries, Query{Time: t, Conn: conn, Db: db[conn], SQL: q})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // queries can be long
+	for scanner.Scan() {
+		line := scanner.Text()
+		m := reGeneralLine.FindStringSubmatch(line)
+		if m == nil {
+			// Server start lines at the top of the log (and after a restart)
+			if strings.Contains(line, ", Version: ") || strings.HasPrefix(line, "Tcp port: ") || strings.HasPrefix(line, "Time ") {
+				continue
+			}
+			if sql != nil {
+				sql = append(sql, line) // multi-line query
+			}
+			continue
+		}
+
+		flush()
+		if f := strings.Fields(m[1]); len(f) == 1 {
+			t = slowTime(f[0], "")
+		} else if len(f) == 2 {
+			t = slowTime(f[0], f[1])
+		}
+		conn, _ = strconv.ParseUint(m[2], 10, 64)
+		switch m[3] {
+		case "Query", "Execute":
+			sql = []string{m[4]}
+		case "Init DB":
+			db[conn] = m[4]
+		case "Connect":
+			// user@host on db using TCP/IP
+			if _, after, ok := strings.Cut(m[4], " on "); ok {
+				db[conn], _, _ = strings.Cut(after, " ")
+			}
+		case "Quit":
+			delete(db, conn)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return queries, nil
+}
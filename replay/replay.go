@@ -0,0 +1,467 @@
+// Copyright 2024 Block, Inc.
+
+// Package replay makes stage and trx files from a MySQL query log, selected
+// with --replay on the command line. Like built-in benchmarks, the files are
+// written to a directory so they load like any other stage files.
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/finch"
+)
+
+const (
+	MODE_FINGERPRINT = "fingerprint"
+	MODE_LITERAL     = "literal"
+)
+
+// MaxValues is the maximum number of values saved per data key in fingerprint
+// mode. If a query has more, a random sample of MaxValues is saved.
+var MaxValues = 10000
+
+// Options are command line options for replay.
+type Options struct {
+	Mode    string        // --replay-mode: fingerprint (default) or literal
+	Speed   float64       // --replay-speed: 1.0 = original rate, 0 = unlimited
+	MaxIdle time.Duration // --replay-max-idle: 0 = no max
+}
+
+// Query is one query from a log.
+type Query struct {
+	Time time.Time // zero if not logged
+	Conn uint64    // connection (thread) ID
+	Db   string    // current database, if known
+	SQL  string    // without trailing semicolon
+}
+
+// Load parses the query log file, writes stage and trx files to dir, then
+// returns the stage files to load and the params to set (like --param).
+func Load(file string, opts Options, dir string) ([]string, []string, error) {
+	if opts.Speed < 0 {
+		return nil, nil, fmt.Errorf("invalid --replay-speed %f: must be >= 0", opts.Speed)
+	}
+	if opts.MaxIdle < 0 {
+		return nil, nil, fmt.Errorf("invalid --replay-max-idle %s: must be >= 0", opts.MaxIdle)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	queries, err := ParseLog(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %s", file, err)
+	}
+	if len(queries) == 0 {
+		return nil, nil, fmt.Errorf("no queries in %s", file)
+	}
+	finch.Debug("replay %s: %d queries", file, len(queries))
+
+	switch opts.Mode {
+	case "", MODE_FINGERPRINT:
+		err = fingerprint(queries, opts, dir)
+	case MODE_LITERAL:
+		err = literal(queries, opts, dir)
+	default:
+		return nil, nil, fmt.Errorf("invalid --replay-mode %s: valid modes are fingerprint and literal", opts.Mode)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{filepath.Join(dir, "replay.yaml")}, nil, nil
+}
+
+// ParseLog detects the log format—slow query log, general query log, or
+// Percona Server JSON audit log—and parses it with ParseSlowLog, ParseGeneralLog,
+// or ParseAuditLog.
+func ParseLog(r io.Reader) ([]Query, error) {
+	br := bufio.NewReader(r)
+	parse, err := detect(br)
+	if err != nil {
+		return nil, err
+	}
+	return parse(br)
+}
+
+func detect(br *bufio.Reader) (func(io.Reader) ([]Query, error), error) {
+	buf, err := br.Peek(64 * 1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# Time:") || strings.HasPrefix(line, "# User@Host:"):
+			return ParseSlowLog, nil
+		case strings.HasPrefix(line, `{"audit_record"`):
+			return ParseAuditLog, nil
+		case reGeneralLine.MatchString(line):
+			return ParseGeneralLog, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown log format: expected MySQL slow query log, general query log, or Percona Server JSON audit log")
+}
+
+// --------------------------------------------------------------------------
+
+// digest is one fingerprint and the literal values seen for its "?", sampled
+// by query so values from the same query stay together.
+type digest struct {
+	fp     string
+	parts  []string // fp split on "?"
+	n      int      // number of "?"
+	count  uint64
+	values []string // [sample] tab-separated values for each "?", escaped and quoted
+}
+
+// digestSet is the set of fingerprints of all queries.
+type digestSet struct {
+	byFp  map[string]*digest
+	total uint64 // queries
+}
+
+func newDigestSet() *digestSet {
+	return &digestSet{byFp: map[string]*digest{}}
+}
+
+// add adds count executions of the query. It returns false if the query is
+// skipped because it cannot be replayed (see skip).
+func (s *digestSet) add(query string, count uint64) bool {
+	fp, literals := Fingerprint(query)
+	if skip(fp) {
+		finch.Debug("skip: %s", fp)
+		return false
+	}
+	d, ok := s.byFp[fp]
+	if !ok {
+		parts := strings.Split(fp, "?")
+		if len(parts)-1 != len(literals) {
+			finch.Debug("skip: ? in query: %s", fp)
+			return false
+		}
+		d = &digest{
+			fp:    fp,
+			parts: parts,
+			n:     len(literals),
+		}
+		s.byFp[fp] = d
+	}
+	d.count += count
+	s.total += count
+
+	// Reservoir sample so values are uniform over the whole log
+	if d.n == 0 {
+		return true // no literals
+	}
+	i := len(d.values)
+	if i >= MaxValues {
+		r := rand.Int63n(int64(d.count))
+		if r >= int64(MaxValues) {
+			return true
+		}
+		i = int(r)
+	}
+	vals := make([]string, len(literals))
+	for j, l := range literals {
+		vals[j] = escape(l.Value)
+		if l.Quoted {
+			vals[j] = "'" + vals[j] + "'"
+		}
+	}
+	if i == len(d.values) {
+		d.values = append(d.values, strings.Join(vals, "\t"))
+	} else {
+		d.values[i] = strings.Join(vals, "\t")
+	}
+	return true
+}
+
+func fingerprint(queries []Query, opts Options, dir string) error {
+	set := newDigestSet()
+	conns := map[uint64]bool{}
+	dbs := map[string]bool{}
+	for _, q := range queries {
+		if set.add(q.SQL, 1) {
+			conns[q.Conn] = true
+			dbs[q.Db] = true
+		}
+	}
+	first, last := timeRange(queries)
+	return set.write(len(conns), onlyDb(dbs), last.Sub(first), opts, dir)
+}
+
+// onlyDb returns the database if all queries used the same one, else "".
+func onlyDb(dbs map[string]bool) string {
+	if len(dbs) != 1 {
+		return ""
+	}
+	for db := range dbs {
+		return db
+	}
+	return ""
+}
+
+// write writes the stage file and trx file replay.sql with one statement per
+// fingerprint, most frequent first, executed with the same probability it has
+// in the original workload. The workload has the given number of clients
+// using the default database db (if not empty), limited to the original QPS
+// over duration d (scaled by speed).
+func (s *digestSet) write(clients int, db string, d time.Duration, opts Options, dir string) error {
+	if s.total == 0 {
+		return fmt.Errorf("no queries to replay after skipping transaction statements and queries with user variables")
+	}
+
+	digests := make([]*digest, 0, len(s.byFp))
+	for _, d := range s.byFp {
+		digests = append(digests, d)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		if digests[i].count == digests[j].count {
+			return digests[i].fp < digests[j].fp
+		}
+		return digests[i].count > digests[j].count
+	})
+
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		return err
+	}
+
+	var sql strings.Builder
+	trx := stageTrx{File: "replay.sql", Data: map[string]stageData{}}
+	for n, d := range digests {
+		if n > 0 {
+			sql.WriteString("\n")
+		}
+		if d.count < s.total {
+			p := float64(d.count) / float64(s.total)
+			fmt.Fprintf(&sql, "-- probability: %s\n", strconv.FormatFloat(math.Max(p, 0.000001), 'f', -1, 64))
+		}
+		for i, part := range d.parts {
+			sql.WriteString(strings.ReplaceAll(part, "%", "%%"))
+			if i == len(d.parts)-1 {
+				break
+			}
+			// One data key for all "?" in the query so the values are from the
+			// same query: @q1 for the first "?" and @PREV for the rest
+			key := fmt.Sprintf("q%d", n+1)
+			if i == 0 {
+				sql.WriteString("@" + key)
+			} else {
+				sql.WriteString("@PREV")
+			}
+			if next := d.parts[i+1]; next != "" && (next[0] == '-' || identChar(next[:1], false)) {
+				sql.WriteString(" ") // keep next char out of the data key name
+			}
+		}
+		if d.n > 0 {
+			key := fmt.Sprintf("q%d", n+1)
+			file := filepath.Join("data", key+".txt")
+			if err := os.WriteFile(filepath.Join(dir, file), []byte(strings.Join(d.values, "\n")+"\n"), 0644); err != nil {
+				return err
+			}
+			params := map[string]string{"file": file}
+			if d.n > 1 {
+				params["columns"] = strconv.Itoa(d.n)
+			}
+			trx.Data[key] = stageData{Generator: "list", Params: params}
+		}
+		sql.WriteString("\n")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "replay.sql"), []byte(sql.String()), 0644); err != nil {
+		return err
+	}
+	if len(trx.Data) == 0 {
+		trx.Data = nil
+	}
+
+	if clients < 1 {
+		clients = 1
+	}
+	stage := stageConfig{
+		Name: "replay",
+		Workload: []stageClientGroup{
+			{Clients: strconv.Itoa(clients), Db: db, Trx: []string{"replay.sql"}},
+		},
+		Trx: []stageTrx{trx},
+	}
+	setRate(&stage, d, s.total, opts.Speed)
+	return writeStage(stage, dir)
+}
+
+// skip returns true if the fingerprint cannot be replayed as a single statement
+// in random order: transaction statements (there's no transaction to begin or
+// commit), and queries with user variables (which look like data keys).
+func skip(fp string) bool {
+	if strings.Contains(fp, "@") {
+		return true
+	}
+	u := strings.ToUpper(fp)
+	for _, prefix := range []string{"BEGIN", "COMMIT", "ROLLBACK", "START TRANSACTION", "SET AUTOCOMMIT"} {
+		if strings.HasPrefix(u, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// escape returns a string literal value escaped for SQL. The value is written
+// to a list generator file, one query per line and values separated by tabs, so
+// newlines and tabs must be escaped, too.
+func escape(s string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		"'", "\\'",
+		"\n", "\\n",
+		"\t", "\\t",
+		"\r", "\\r",
+		"\x00", "\\0",
+		"\x1a", "\\Z",
+	).Replace(s)
+}
+
+// --------------------------------------------------------------------------
+
+func literal(queries []Query, opts Options, dir string) error {
+	conns := []uint64{}
+	byConn := map[uint64][]Query{}
+	for _, q := range queries {
+		if _, ok := byConn[q.Conn]; !ok {
+			conns = append(conns, q.Conn) // in order of first query
+		}
+		byConn[q.Conn] = append(byConn[q.Conn], q)
+	}
+
+	// One raw trx file per connection, executed once by one client, so each
+	// connection's queries are replayed in order on one MySQL connection. All
+	// clients start together, and idle time before each query reproduces the
+	// original timing (scaled by speed) relative to the first query in the log.
+	first, _ := timeRange(queries)
+	stage := stageConfig{Name: "replay"}
+	for _, conn := range conns {
+		var sql strings.Builder
+		db := ""
+		prev := first
+		for _, q := range byConn[conn] {
+			if opts.Speed > 0 && !q.Time.IsZero() && !prev.IsZero() {
+				if idle := idleTime(q.Time.Sub(prev), opts); idle > 0 {
+					fmt.Fprintf(&sql, "-- idle: %s\n", idle)
+				}
+				prev = q.Time
+			}
+			if q.Db != db && q.Db != "" {
+				fmt.Fprintf(&sql, "USE `%s`;\n", q.Db)
+				db = q.Db
+			}
+			sql.WriteString(q.SQL)
+			sql.WriteString(";\n")
+		}
+		file := fmt.Sprintf("conn-%d.sql", conn)
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(sql.String()), 0644); err != nil {
+			return err
+		}
+		stage.Workload = append(stage.Workload, stageClientGroup{
+			Group: "replay",
+			Iter:  "1",
+			Trx:   []string{file},
+		})
+		stage.Trx = append(stage.Trx, stageTrx{File: file, Raw: true})
+	}
+	return writeStage(stage, dir)
+}
+
+// idleTime returns the original time between queries scaled by speed, capped
+// at max idle, and rounded to microseconds.
+func idleTime(d time.Duration, opts Options) time.Duration {
+	d = time.Duration(float64(d) / opts.Speed)
+	if opts.MaxIdle > 0 && d > opts.MaxIdle {
+		d = opts.MaxIdle
+	}
+	return d.Round(time.Microsecond)
+}
+
+// --------------------------------------------------------------------------
+
+// timeRange returns the first and last query times, or zero times if the log
+// doesn't have query times.
+func timeRange(queries []Query) (first, last time.Time) {
+	for _, q := range queries {
+		if q.Time.IsZero() {
+			continue
+		}
+		if first.IsZero() || q.Time.Before(first) {
+			first = q.Time
+		}
+		if q.Time.After(last) {
+			last = q.Time
+		}
+	}
+	return first, last
+}
+
+// setRate sets stage QPS to the original rate of n queries over duration d
+// scaled by speed, and stage runtime to d scaled by speed.
+func setRate(stage *stageConfig, d time.Duration, n uint64, speed float64) {
+	if d < time.Second {
+		d = time.Second // avoid divide by zero and sub-second runtime
+	}
+	finch.Debug("replay: %d queries in %s", n, d)
+
+	if speed > 0 {
+		qps := uint64(math.Ceil(float64(n) / d.Seconds() * speed))
+		stage.QPS = strconv.FormatUint(qps, 10)
+		d = time.Duration(float64(d) / speed)
+	}
+	stage.Runtime = fmt.Sprintf("%ds", int64(math.Ceil(d.Seconds())))
+}
+
+type stageFile struct {
+	Stage stageConfig `yaml:"stage"`
+}
+
+type stageConfig struct {
+	Name     string             `yaml:"name"`
+	Runtime  string             `yaml:"runtime,omitempty"`
+	QPS      string             `yaml:"qps,omitempty"`
+	Workload []stageClientGroup `yaml:"workload,omitempty"`
+	Trx      []stageTrx         `yaml:"trx"`
+}
+
+type stageClientGroup struct {
+	Clients string   `yaml:"clients,omitempty"`
+	Db      string   `yaml:"db,omitempty"`
+	Group   string   `yaml:"group,omitempty"`
+	Iter    string   `yaml:"iter,omitempty"`
+	Trx     []string `yaml:"trx"`
+}
+
+type stageTrx struct {
+	File string               `yaml:"file"`
+	Raw  bool                 `yaml:"raw,omitempty"`
+	Data map[string]stageData `yaml:"data,omitempty"`
+}
+
+type stageData struct {
+	Generator string            `yaml:"generator"`
+	Params    map[string]string `yaml:"params,omitempty"`
+}
+
+func writeStage(stage stageConfig, dir string) error {
+	bytes, err := yaml.Marshal(stageFile{Stage: stage})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "replay.yaml"), bytes, 0644)
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Block, Inc.
+
+package replay_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/replay"
+	"github.com/square/finch/trx"
+)
+
+var cwd, _ = os.Getwd()
+var slowLog = filepath.Join(cwd, "../test/replay/slow.log")
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query    string
+		fp       string
+		literals []replay.Literal
+	}{
+		{
+			query:    "SELECT c FROM t1 WHERE id=1",
+			fp:       "SELECT c FROM t1 WHERE id=?",
+			literals: []replay.Literal{{Value: "1"}},
+		},
+		{
+			query: "UPDATE  t\n  SET c = 'it''s', d = \"a\\nb\"  WHERE id IN (1.5, -2e3, 0xFF)",
+			fp:    "UPDATE t SET c = ?, d = ? WHERE id IN (?, -?, ?)",
+			literals: []replay.Literal{
+				{Value: "it's", Quoted: true},
+				{Value: "a\nb", Quoted: true},
+				{Value: "1.5"},
+				{Value: "2e3"},
+				{Value: "0xFF"},
+			},
+		},
+		{
+			query:    "SELECT /*+ NO_INDEX(t) */ `col 1` FROM t /* comment */ WHERE a = 'x' -- end",
+			fp:       "SELECT /*+ NO_INDEX(t) */ `col 1` FROM t WHERE a = ?",
+			literals: []replay.Literal{{Value: "x", Quoted: true}},
+		},
+	}
+	for _, test := range tests {
+		fp, literals := replay.Fingerprint(test.query)
+		if fp != test.fp {
+			t.Errorf("got fingerprint '%s', expected '%s'", fp, test.fp)
+		}
+		if diff := deep.Equal(literals, test.literals); diff != nil {
+			t.Errorf("%s: %v", test.query, diff)
+		}
+	}
+}
+
+func TestParseSlowLog(t *testing.T) {
+	f, err := os.Open(slowLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := replay.ParseSlowLog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := func(s int) time.Time {
+		return time.Date(2024, 1, 2, 3, 4, s, 0, time.UTC)
+	}
+	expect := []replay.Query{
+		{Time: ts(5), Conn: 10, Db: "shop", SQL: "SELECT c FROM t1 WHERE id = 1"},
+		{Time: ts(6), Conn: 11, SQL: "SELECT c FROM t1 WHERE id = 22"},
+		{Time: ts(7), Conn: 10, Db: "shop", SQL: "UPDATE t1\n   SET c = 'it''s 100%'\n WHERE id = 3"},
+		{Time: ts(8), Conn: 11, SQL: "COMMIT"},
+		{Time: ts(9), Conn: 10, Db: "shop", SQL: "SELECT c FROM t1 WHERE id = 333"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseGeneralLog(t *testing.T) {
+	f, err := os.Open("../test/replay/general.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := replay.ParseLog(f) // detect general log
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := func(ms int) time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, ms*int(time.Millisecond), time.UTC)
+	}
+	expect := []replay.Query{
+		{Time: ts(100), Conn: 10, Db: "shop", SQL: "SELECT c FROM t1 WHERE id = 1"},
+		{Time: ts(400), Conn: 11, Db: "shop", SQL: "UPDATE t1\n   SET c = 'x'\n WHERE id = 2"},
+		{Time: ts(700), Conn: 10, Db: "shop", SQL: "SELECT c FROM t1 WHERE id = 3"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseAuditLog(t *testing.T) {
+	f, err := os.Open("../test/replay/audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := replay.ParseLog(f) // detect audit log
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []replay.Query{
+		{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Conn: 10, Db: "shop", SQL: "SELECT c FROM t1 WHERE id = 1"},
+		{Time: time.Date(2024, 1, 2, 3, 4, 7, 0, time.UTC), Conn: 11, SQL: "UPDATE t1 SET c = 'x' WHERE id = 2"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	defer os.Chdir(cwd)
+
+	for _, mode := range []string{"fingerprint", "literal"} {
+		dir := t.TempDir()
+		stageFiles, params, err := replay.Load(slowLog, replay.Options{Mode: mode, Speed: 2}, dir)
+		if err != nil {
+			t.Fatalf("%s: %s", mode, err)
+		}
+		stages, err := config.Load(stageFiles, params, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", mode, err)
+		}
+		if len(stages) != 1 {
+			t.Fatalf("%s: got %d stages, expected 1", mode, len(stages))
+		}
+		s := stages[0]
+		os.Chdir(filepath.Dir(s.File)) // like compute.Server
+		set, err := trx.Load(s.Trx, data.NewScope(), s.Params)
+		if err != nil {
+			t.Fatalf("%s: %s", mode, err)
+		}
+
+		switch mode {
+		case "fingerprint":
+			// COMMIT is skipped; 3 SELECT and 1 UPDATE in 4s at 2x speed
+			// = 2 QPS for 4s/2 = 2s
+			if s.QPS != "2" {
+				t.Errorf("got QPS %s, expected 2", s.QPS)
+			}
+			if s.Runtime != "2s" {
+				t.Errorf("got runtime %s, expected 2s", s.Runtime)
+			}
+			if s.Workload[0].Clients != "2" {
+				t.Errorf("got %s clients, expected 2 (one per connection)", s.Workload[0].Clients)
+			}
+			stmts := set.Statements["replay.sql"]
+			if len(stmts) != 2 {
+				t.Fatalf("got %d statements, expected 2", len(stmts))
+			}
+			if stmts[0].Query != "SELECT c FROM t1 WHERE id = %s" || stmts[0].Probability != 0.75 {
+				t.Errorf("got statement 1 %+v", *stmts[0])
+			}
+			if stmts[1].Query != "UPDATE t1 SET c = %s WHERE id = %s" || stmts[1].Probability != 0.25 {
+				t.Errorf("got statement 2 %+v", *stmts[1])
+			}
+			// Values from the same query are on one line, quoted as in the query,
+			// so @q2 and @PREV return values that occurred together
+			bytes, _ := os.ReadFile(filepath.Join(dir, "data", "q2.txt"))
+			if string(bytes) != "'it\\'s 100%'\t3\n" {
+				t.Errorf("got q2 values %q, expected 'it\\'s 100%%'<tab>3", string(bytes))
+			}
+			vals := set.Data.Keys["@q2"].Generator.Values(data.RunCount{})
+			if diff := deep.Equal(vals, []interface{}{"'it\\'s 100%'", "3"}); diff != nil {
+				t.Errorf("@q2 values: %v", diff)
+			}
+		case "literal":
+			// Original timing at 2x speed instead of QPS
+			if s.QPS != "" {
+				t.Errorf("got QPS %s, expected none", s.QPS)
+			}
+			if len(s.Workload) != 2 {
+				t.Fatalf("got %d client groups, expected 2 (one per connection)", len(s.Workload))
+			}
+			got := []string{}
+			for _, stmt := range set.Statements["conn-10.sql"] {
+				if stmt.Idle > 0 {
+					got = append(got, "idle "+stmt.Idle.String())
+				} else {
+					got = append(got, stmt.Query)
+				}
+			}
+			expect := []string{
+				"USE `shop`",
+				"SELECT c FROM t1 WHERE id = 1",
+				"idle 1s",
+				"UPDATE t1\n   SET c = 'it''s 100%%'\n WHERE id = 3",
+				"idle 1s",
+				"SELECT c FROM t1 WHERE id = 333",
+			}
+			if diff := deep.Equal(got, expect); diff != nil {
+				t.Errorf("conn-10.sql: %v", diff)
+			}
+			stmts := set.Statements["conn-11.sql"]
+			if len(stmts) != 4 || stmts[0].Idle != 500*time.Millisecond {
+				t.Errorf("got conn-11.sql statements %+v, expected idle 500ms then SELECT, idle, COMMIT", stmts)
+			}
+		}
+	}
+
+	_, _, err := replay.Load(slowLog, replay.Options{Mode: "foo"}, t.TempDir())
+	if err == nil {
+		t.Errorf("no error for invalid mode, expected one")
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	defer os.Chdir(cwd)
+
+	t0 := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	digests := []replay.Digest{
+		{
+			Db:        "shop",
+			Sample:    "SELECT c FROM t1 WHERE id = 5",
+			Count:     900,
+			Time:      150 * time.Second,
+			FirstSeen: t0,
+			LastSeen:  t0.Add(100 * time.Second),
+		},
+		{
+			Db:        "shop",
+			Sample:    "UPDATE t1 SET c = 'x' WHERE id = 7",
+			Count:     100,
+			Time:      50 * time.Second,
+			FirstSeen: t0.Add(10 * time.Second),
+			LastSeen:  t0.Add(90 * time.Second),
+		},
+	}
+	dir := t.TempDir()
+	if err := replay.Synthesize(digests, replay.Options{Speed: 1}, dir); err != nil {
+		t.Fatal(err)
+	}
+	stages, err := config.Load([]string{filepath.Join(dir, "replay.yaml")}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stages[0]
+	os.Chdir(filepath.Dir(s.File)) // like compute.Server
+	set, err := trx.Load(s.Trx, data.NewScope(), s.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1,000 queries in 100s = 10 QPS, and 200s query time in 100s = 2 clients
+	if s.QPS != "10" || s.Runtime != "100s" {
+		t.Errorf("got QPS %s runtime %s, expected 10 and 100s", s.QPS, s.Runtime)
+	}
+	if s.Workload[0].Clients != "2" || s.Workload[0].Db != "shop" {
+		t.Errorf("got %s clients db %s, expected 2 clients db shop", s.Workload[0].Clients, s.Workload[0].Db)
+	}
+	stmts := set.Statements["replay.sql"]
+	if len(stmts) != 2 || stmts[0].Probability != 0.9 || stmts[1].Probability != 0.1 {
+		t.Errorf("got statements %+v, expected SELECT (p=0.9) and UPDATE (p=0.1)", stmts)
+	}
+}
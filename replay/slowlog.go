@@ -0,0 +1,102 @@
+// Copyright 2024 Block, Inc.
+
+package replay
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reSlowTime = regexp.MustCompile(`^# Time: (\S+)(?:\s+(\S+))?`)
+	reSlowId   = regexp.MustCompile(`Id:\s*(\d+)`)
+	reSlowTS   = regexp.MustCompile(`(?i)^SET timestamp=(\d+);?$`)
+)
+
+// ParseSlowLog parses a MySQL slow query log and returns the queries in the
+// order logged. Administrator commands, "use db" (which sets Query.Db), and
+// "SET timestamp" (which sets Query.Time if there's no "# Time" header) are
+// not returned as queries.
+func ParseSlowLog(r io.Reader) ([]Query, error) {
+	queries := []Query{}
+	db := map[uint64]string{} // connection ID -> current db
+
+	var (
+		t    time.Time // from # Time or SET timestamp
+		conn uint64    // from # User@Host: ... Id: N
+		sql  []string  // query lines
+	)
+	flush := func() {
+		q := strings.TrimSuffix(strings.TrimSpace(strings.Join(sql, "\n")), ";")
+		sql = sql[:0]
+		if q == "" {
+			return
+		}
+		queries = append(queries, Query{Time: t, Conn: conn, Db: db[conn], SQL: q})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // queries can be long
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Header lines: # Time, # User@Host, # Query_time, etc. The first one
+		// ends the previous query.
+		if strings.HasPrefix(line, "#") {
+			flush()
+			if m := reSlowTime.FindStringSubmatch(line); m != nil {
+				t = slowTime(m[1], m[2])
+			} else if strings.HasPrefix(line, "# User@Host:") {
+				if m := reSlowId.FindStringSubmatch(line); m != nil {
+					conn, _ = strconv.ParseUint(m[1], 10, 64)
+				}
+			}
+			continue
+		}
+
+		// Server start lines at the top of the log (and after a restart)
+		if strings.Contains(line, ", Version: ") || strings.HasPrefix(line, "Tcp port: ") || strings.HasPrefix(line, "Time ") {
+			continue
+		}
+
+		// Lines before the query: use db; SET timestamp=N;
+		if len(sql) == 0 {
+			trimmed := strings.TrimSpace(line)
+			lower := strings.ToLower(trimmed)
+			if strings.HasPrefix(lower, "use ") {
+				db[conn] = strings.Trim(strings.TrimSuffix(trimmed[4:], ";"), " `")
+				continue
+			}
+			if m := reSlowTS.FindStringSubmatch(trimmed); m != nil {
+				if t.IsZero() {
+					ts, _ := strconv.ParseInt(m[1], 10, 64)
+					t = time.Unix(ts, 0)
+				}
+				continue
+			}
+		}
+
+		sql = append(sql, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return queries, nil
+}
+
+// slowTime parses the "# Time" header, which is RFC 3339 in MySQL 5.7 and
+// newer (2024-01-02T03:04:05.123456Z), and YYMMDD H:MM:SS in older versions.
+func slowTime(date, clock string) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, date); err == nil {
+		return t
+	}
+	if t, err := time.Parse("060102 15:04:05", date+" "+clock); err == nil {
+		return t
+	}
+	return time.Time{}
+}
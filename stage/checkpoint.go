@@ -0,0 +1,140 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/square/finch"
+	"github.com/square/finch/limit"
+	"github.com/square/finch/trx"
+)
+
+// CHECKPOINT_FREQ is how often Run writes config.stage.checkpoint.
+var CHECKPOINT_FREQ = 5 * time.Second
+
+// checkpoint is the config.stage.checkpoint file: rows inserted by statements
+// with a rows limit (-- rows: N), keyed on "trx:N" where N is the statement
+// number in the trx file, starting at 1.
+type checkpoint struct {
+	Stage string           `json:"stage"`
+	Rows  map[string]int64 `json:"rows"`
+}
+
+// rowsLimits returns the rows limits in the trx set keyed like checkpoint.Rows.
+func rowsLimits(trxSet *trx.Set) map[string]*limit.Rows {
+	rows := map[string]*limit.Rows{}
+	for trxName, stmts := range trxSet.Statements {
+		for i, stmt := range stmts {
+			if lm := limit.RowsLimit(stmt.Limit); lm != nil {
+				rows[fmt.Sprintf("%s:%d", trxName, i+1)] = lm
+			}
+		}
+	}
+	return rows
+}
+
+// statefulGenerators are data generators that return the next value in a
+// sequence. Their position isn't checkpointed, so on resume they start over
+// and re-generate values already inserted, like duplicate primary keys.
+var statefulGenerators = map[string]bool{
+	"auto-inc":      true,
+	"int-chunk":     true,
+	"int-range-seq": true,
+}
+
+// statefulInputs returns the data keys of statement k (keyed like
+// checkpoint.Rows) that use a stateful generator, if any.
+func statefulInputs(trxSet *trx.Set, k string) []string {
+	var keys []string
+	for trxName, stmts := range trxSet.Statements {
+		for i, stmt := range stmts {
+			if fmt.Sprintf("%s:%d", trxName, i+1) != k {
+				continue
+			}
+			for _, name := range stmt.Inputs {
+				if key, ok := trxSet.Data.Keys[name]; ok && key.Generator != nil && statefulGenerators[key.Generator.Name()] {
+					keys = append(keys, fmt.Sprintf("%s (%s)", name, key.Generator.Name()))
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// resume reads the checkpoint file, if it exists, and sets the rows limits to
+// resume from the checkpoint. It returns an error if a statement to resume uses
+// a stateful generator because only the row count is resumed.
+func (s *Stage) resume(trxSet *trx.Set) error {
+	b, err := os.ReadFile(s.cfg.Checkpoint)
+	if err != nil {
+		if os.IsNotExist(err) {
+			finch.Debug("no checkpoint file %s", s.cfg.Checkpoint)
+			return nil
+		}
+		return err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return fmt.Errorf("invalid checkpoint file %s: %s", s.cfg.Checkpoint, err)
+	}
+	for k, n := range cp.Rows {
+		lm, ok := s.rows[k]
+		if !ok {
+			return fmt.Errorf("checkpoint file %s has rows for %s, but there is no rows limit on that statement; remove the file if the trx file changed", s.cfg.Checkpoint, k)
+		}
+		if n == 0 {
+			continue
+		}
+		if keys := statefulInputs(trxSet, k); len(keys) > 0 {
+			return fmt.Errorf("cannot resume %s from checkpoint file %s: data keys %s restart from the beginning on resume and would generate values already inserted; use a MySQL AUTO_INCREMENT column or a random generator, or remove the checkpoint file to start over", k, s.cfg.Checkpoint, strings.Join(keys, ", "))
+		}
+		lm.Resume(n)
+		log.Printf("[%s] Resuming %s from checkpoint: %d rows", s.cfg.Name, k, n)
+	}
+	return nil
+}
+
+// writeCheckpoint writes the checkpoint file atomically: a temp file renamed
+// to the checkpoint file.
+func (s *Stage) writeCheckpoint() error {
+	cp := checkpoint{
+		Stage: s.cfg.Name,
+		Rows:  make(map[string]int64, len(s.rows)),
+	}
+	for k, lm := range s.rows {
+		cp.Rows[k] = lm.N()
+	}
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.cfg.Checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cfg.Checkpoint)
+}
+
+// checkpoints writes the checkpoint file every CHECKPOINT_FREQ until ctx is
+// cancelled. Run writes the final checkpoint after clients stop.
+func (s *Stage) checkpoints(ctx context.Context) {
+	ticker := time.NewTicker(CHECKPOINT_FREQ)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.writeCheckpoint(); err != nil {
+				log.Printf("[%s] Error writing checkpoint: %s", s.cfg.Name, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package stage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+)
+
+func TestCheckpoint(t *testing.T) {
+	cfg := config.Stage{
+		Name:       "load",
+		Checkpoint: filepath.Join(t.TempDir(), "load.checkpoint"),
+		Trx: []config.Trx{
+			{
+				Name: "rows.sql",
+				File: "../test/trx/rows.sql",
+			},
+		},
+	}
+
+	// No checkpoint file yet, so start from zero
+	trxSet, err := trx.Load(cfg.Trx, data.NewScope(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, nil, nil)
+	s.rows = rowsLimits(trxSet)
+	if len(s.rows) != 1 {
+		t.Fatalf("got %d rows limits, expected 1: %v", len(s.rows), s.rows)
+	}
+	if err := s.resume(trxSet); err != nil {
+		t.Fatal(err)
+	}
+	lm := s.rows["rows.sql:1"]
+	if lm == nil {
+		t.Fatalf("no rows limit for rows.sql:1: %v", s.rows)
+	}
+	if lm.N() != 0 {
+		t.Errorf("got %d rows, expected 0", lm.N())
+	}
+	lm.Affected(300)
+	if err := s.writeCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume from checkpoint
+	trxSet, err = trx.Load(cfg.Trx, data.NewScope(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New(cfg, nil, nil)
+	s.rows = rowsLimits(trxSet)
+	if err := s.resume(trxSet); err != nil {
+		t.Fatal(err)
+	}
+	lm = s.rows["rows.sql:1"]
+	if lm.N() != 300 {
+		t.Errorf("got %d rows after resume, expected 300", lm.N())
+	}
+	if !lm.More(nil) {
+		t.Errorf("More false after resume, expected true: 300 of 1000 rows")
+	}
+	lm.Affected(700)
+	if lm.More(nil) {
+		t.Errorf("More true, expected false: 1000 of 1000 rows")
+	}
+}
+
+func TestCheckpoint_StatefulGenerator(t *testing.T) {
+	cfg := config.Stage{
+		Name:       "load",
+		Checkpoint: filepath.Join(t.TempDir(), "load.checkpoint"),
+		Trx: []config.Trx{
+			{
+				Name: "rows-auto-inc.sql",
+				File: "../test/trx/rows-auto-inc.sql",
+				Data: map[string]config.Data{
+					"id":   {Generator: "auto-inc"},
+					"name": {Generator: "str-fill-az"},
+				},
+			},
+		},
+	}
+
+	// No checkpoint file yet, so no error: nothing to resume
+	trxSet, err := trx.Load(cfg.Trx, data.NewScope(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, nil, nil)
+	s.rows = rowsLimits(trxSet)
+	if err := s.resume(trxSet); err != nil {
+		t.Fatal(err)
+	}
+	s.rows["rows-auto-inc.sql:1"].Affected(300)
+	if err := s.writeCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume is an error because @id (auto-inc) would start over and
+	// re-generate 1..300
+	trxSet, err = trx.Load(cfg.Trx, data.NewScope(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New(cfg, nil, nil)
+	s.rows = rowsLimits(trxSet)
+	err = s.resume(trxSet)
+	if err == nil {
+		t.Fatal("no error, expected error resuming auto-inc")
+	}
+	if !strings.Contains(err.Error(), "@id (auto-inc)") {
+		t.Errorf("error does not name @id (auto-inc): %s", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/square/finch/dbconn"
+)
+
+// ddlResult is when config.stage.ddl started and ended relative to the start
+// of the stage, and its error, if any. Run reports it after the final stats.
+type ddlResult struct {
+	start time.Duration
+	end   time.Duration
+	err   error
+	ran   bool
+}
+
+// ddl runs config.stage.ddl while clients run the foreground workload: it waits
+// ddl.delay, executes the DDL statement, waits ddl.after, then cancels the stage.
+// If stats are reported once (stats.freq is zero), it collects stats when the
+// DDL starts and ends, so there are three stats reports: before, during, and
+// after the DDL. Else the periodic stats runtime correlates with the DDL times.
+func (s *Stage) ddl(ctx context.Context, cancelStage context.CancelFunc, start time.Time, doneChan chan<- ddlResult) {
+	defer cancelStage()
+	var res ddlResult
+	defer func() { doneChan <- res }()
+
+	delay, _ := time.ParseDuration(s.cfg.DDL.Delay) // already validated
+	after, _ := time.ParseDuration(s.cfg.DDL.After) // already validated
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		log.Printf("[%s] DDL not run: stage stopped before ddl.delay %s", s.cfg.Name, s.cfg.DDL.Delay)
+		return
+	}
+
+	db, _, err := dbconn.Make()
+	if err != nil {
+		res.err = err
+		log.Printf("[%s] DDL error: %s", s.cfg.Name, err)
+		return
+	}
+	defer db.Close()
+
+	s.collect()
+	res.ran = true
+	res.start = time.Since(start)
+	log.Printf("[%s] DDL start: %s", s.cfg.Name, s.cfg.DDL.SQL)
+	_, res.err = db.ExecContext(ctx, s.cfg.DDL.SQL)
+	res.end = time.Since(start)
+	if ctx.Err() == nil {
+		s.collect() // else stage stopped; Run collects final stats
+	}
+	if res.err != nil {
+		log.Printf("[%s] DDL error after %s: %s", s.cfg.Name, res.end-res.start, res.err)
+		return
+	}
+	log.Printf("[%s] DDL done in %s, running workload for ddl.after %s", s.cfg.Name, res.end-res.start, s.cfg.DDL.After)
+
+	select {
+	case <-time.After(after):
+	case <-ctx.Done():
+	}
+}
+
+// collect collects stats at a DDL boundary if stats are reported once.
+func (s *Stage) collect() {
+	if s.stats == nil || s.stats.Freq > 0 {
+		return
+	}
+	s.stats.Collect()
+}
+
+// report logs the DDL result after the final stats so it's next to the stats
+// reports that it correlates with.
+func (r ddlResult) report(stage string) {
+	if !r.ran {
+		return
+	}
+	if r.err != nil {
+		log.Printf("[%s] DDL failed: runtime %s to %s (%s): %s", stage, r.start.Round(time.Millisecond), r.end.Round(time.Millisecond), (r.end - r.start).Round(time.Millisecond), r.err)
+		return
+	}
+	log.Printf("[%s] DDL: runtime %s to %s (%s)", stage, r.start.Round(time.Millisecond), r.end.Round(time.Millisecond), (r.end - r.start).Round(time.Millisecond))
+}
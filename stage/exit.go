@@ -0,0 +1,86 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/square/finch"
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+)
+
+// EXIT_CHECK_FREQ is how often the stage checks config.stage.exit conditions.
+// Counts can exceed the configured values by what clients do in this time.
+var EXIT_CHECK_FREQ = 100 * time.Millisecond
+
+// exit cancels the stage when config.stage.exit conditions are met. Runtime,
+// iter, and rows are combined by exit.when: any (OR) or all (AND). The error
+// budget (exit.errors) cancels the stage when exhausted regardless of when.
+func (s *Stage) exit(ctx context.Context, cancelStage context.CancelFunc, start time.Time) {
+	cfg := s.cfg.Exit
+	var runtime time.Duration
+	if cfg.Runtime != "" {
+		runtime, _ = time.ParseDuration(cfg.Runtime) // already validated
+	}
+	iter, _ := strconv.ParseUint(cfg.Iter, 10, 64)     // already validated
+	rows, _ := strconv.ParseUint(cfg.Rows, 10, 64)     // already validated
+	errors, _ := strconv.ParseUint(cfg.Errors, 10, 64) // already validated
+
+	ticker := time.NewTicker(EXIT_CHECK_FREQ)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		n := client.Counters{
+			Iter:   atomic.LoadUint64(&s.counters.Iter),
+			Rows:   atomic.LoadUint64(&s.counters.Rows),
+			Errors: atomic.LoadUint64(&s.counters.Errors),
+		}
+
+		if errors > 0 && n.Errors >= errors {
+			log.Printf("[%s] Stopping: error budget exhausted: %d errors (exit.errors %d)", s.cfg.Name, n.Errors, errors)
+			finch.Fail(finch.EXIT_THRESHOLD)
+			cancelStage()
+			return
+		}
+
+		// Conditions that are set, and which are reached
+		met := []string{}
+		nSet := 0
+		if runtime > 0 {
+			nSet++
+			if d := time.Since(start); d >= runtime {
+				met = append(met, "runtime "+cfg.Runtime)
+			}
+		}
+		if iter > 0 {
+			nSet++
+			if n.Iter >= iter {
+				met = append(met, "iter "+strconv.FormatUint(n.Iter, 10))
+			}
+		}
+		if rows > 0 {
+			nSet++
+			if n.Rows >= rows {
+				met = append(met, "rows "+strconv.FormatUint(n.Rows, 10))
+			}
+		}
+		if len(met) == 0 || (cfg.When == config.EXIT_ALL && len(met) < nSet) {
+			continue
+		}
+		finch.Debug("exit %+v: %v", n, met)
+		log.Printf("[%s] Stopping: exit.when %s: %s", s.cfg.Name, cfg.When, strings.Join(met, ", "))
+		cancelStage()
+		return
+	}
+}
@@ -0,0 +1,74 @@
+package stage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+)
+
+func TestExit(t *testing.T) {
+	EXIT_CHECK_FREQ = 5 * time.Millisecond
+	defer func() { EXIT_CHECK_FREQ = 100 * time.Millisecond }()
+
+	// run returns true if exit cancels the stage before the timeout
+	run := func(exit config.Exit, counters client.Counters) bool {
+		s := New(config.Stage{Name: "test", Exit: &exit}, nil, nil)
+		s.counters = &counters
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			s.exit(ctx, cancel, time.Now())
+			close(done)
+		}()
+		select {
+		case <-done:
+			return ctx.Err() != nil
+		case <-time.After(100 * time.Millisecond):
+			cancel()
+			<-done
+			return false
+		}
+	}
+
+	// any: iter reached
+	if !run(config.Exit{When: "any", Iter: "10", Rows: "100"}, client.Counters{Iter: 10}) {
+		t.Error("when any: iter reached but stage not stopped")
+	}
+
+	// all: iter reached but not rows
+	if run(config.Exit{When: "all", Iter: "10", Rows: "100"}, client.Counters{Iter: 10}) {
+		t.Error("when all: stage stopped but rows not reached")
+	}
+	if !run(config.Exit{When: "all", Iter: "10", Rows: "100"}, client.Counters{Iter: 10, Rows: 100}) {
+		t.Error("when all: iter and rows reached but stage not stopped")
+	}
+
+	// all: runtime and iter
+	if !run(config.Exit{When: "all", Runtime: "20ms", Iter: "10"}, client.Counters{Iter: 10}) {
+		t.Error("when all: runtime and iter reached but stage not stopped")
+	}
+
+	// Error budget regardless of when
+	if !run(config.Exit{When: "all", Iter: "10", Errors: "3"}, client.Counters{Errors: 3}) {
+		t.Error("error budget exhausted but stage not stopped")
+	}
+
+	// Counters are updated by clients while exit checks them
+	exit := config.Exit{When: "any", Rows: "5"}
+	s := New(config.Stage{Name: "test", Exit: &exit}, nil, nil)
+	s.counters = &client.Counters{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.exit(ctx, cancel, time.Now())
+	atomic.AddUint64(&s.counters.Rows, 5)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("rows reached but stage not stopped")
+	}
+}
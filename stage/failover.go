@@ -0,0 +1,74 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/finch/config"
+)
+
+// failoverHost returns the MySQL hostname without port to resolve for
+// config.stage.failover.dns-freq, or "" if there's nothing to resolve: no
+// hostname (socket or DSN) or an IP address.
+func failoverHost(hostname string) string {
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	if hostname == "" || net.ParseIP(hostname) != nil {
+		return ""
+	}
+	return hostname
+}
+
+// sameAddrs returns true if a and b are the same set of addresses. Both must
+// be sorted.
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// watchDNS resolves host every freq until ctx is done. When the addresses
+// change (a DNS flip, like an Aurora cluster endpoint after failover), it logs
+// the change and, if failover.on-dns-flip is reconnect, makes all clients
+// reconnect. Resolve errors are ignored because DNS can be briefly unavailable
+// during failover; the previous addresses are kept. When ctx is done, it sends
+// the number of flips to flipsChan.
+func (s *Stage) watchDNS(ctx context.Context, host string, freq time.Duration, flipsChan chan<- uint) {
+	var prev []string
+	flips := uint(0)
+	defer func() { flipsChan <- flips }()
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err == nil && len(addrs) > 0 {
+			sort.Strings(addrs)
+			if prev != nil && !sameAddrs(prev, addrs) {
+				flips++
+				log.Printf("[%s] DNS flip: %s %s -> %s", s.cfg.Name, host, strings.Join(prev, ","), strings.Join(addrs, ","))
+				if s.cfg.Failover.OnDNSFlip == config.FAILOVER_RECONNECT {
+					s.failover.Flip()
+				}
+			}
+			prev = addrs
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package stage
+
+import (
+	"testing"
+)
+
+func TestFailoverHost(t *testing.T) {
+	tests := map[string]string{
+		"db.cluster-abc.us-east-1.rds.amazonaws.com":      "db.cluster-abc.us-east-1.rds.amazonaws.com",
+		"db.cluster-abc.us-east-1.rds.amazonaws.com:3306": "db.cluster-abc.us-east-1.rds.amazonaws.com",
+		"127.0.0.1:3306": "",
+		"10.1.1.1":       "",
+		"":               "",
+	}
+	for hostname, expect := range tests {
+		if got := failoverHost(hostname); got != expect {
+			t.Errorf("failoverHost(%q) = %q, expected %q", hostname, got, expect)
+		}
+	}
+}
+
+func TestSameAddrs(t *testing.T) {
+	if !sameAddrs([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Error("same addrs not same")
+	}
+	if sameAddrs([]string{"10.0.0.1"}, []string{"10.0.0.2"}) {
+		t.Error("flipped addrs same, expected not same")
+	}
+	if sameAddrs([]string{"10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Error("added addr same, expected not same")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+)
+
+// grErrors returns finch.GroupReplicationErrorHandling if stage.group-replication
+// is set, else nil.
+func grErrors(cfg *config.GroupRepl) map[uint16]byte {
+	if cfg == nil {
+		return nil
+	}
+	return finch.GroupReplicationErrorHandling
+}
+
+// grMember is one Group Replication member from
+// performance_schema.replication_group_members.
+type grMember struct {
+	addr  string // MEMBER_HOST:MEMBER_PORT
+	state string // ONLINE, RECOVERING, UNREACHABLE, etc.
+	role  string // PRIMARY or SECONDARY
+}
+
+func grMembers(ctx context.Context, db *sql.DB) ([]grMember, error) {
+	rows, err := db.QueryContext(ctx, "SELECT MEMBER_HOST, MEMBER_PORT, MEMBER_STATE, MEMBER_ROLE FROM performance_schema.replication_group_members ORDER BY MEMBER_HOST, MEMBER_PORT")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []grMember{}
+	for rows.Next() {
+		var host string
+		var port sql.NullInt64
+		var m grMember
+		if err := rows.Scan(&host, &port, &m.state, &m.role); err != nil {
+			return nil, err
+		}
+		m.addr = host
+		if port.Valid {
+			m.addr = net.JoinHostPort(host, strconv.FormatInt(port.Int64, 10))
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(members) == 0 || (len(members) == 1 && members[0].state == "OFFLINE") {
+		return nil, fmt.Errorf("server is not a Group Replication member")
+	}
+	return members, nil
+}
+
+// groupRepl discovers the Group Replication members and logs them. With
+// spread-writes, it adds a target (config.stage.targets) for each ONLINE PRIMARY
+// member, named by its address, and returns the target names for
+// workload.Allocator.SpreadTargets. Member targets inherit the stage mysql
+// settings, like user-defined targets.
+func (s *Stage) groupRepl(ctx context.Context, db *sql.DB) ([]string, error) {
+	members, err := grMembers(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("group-replication: %s", err)
+	}
+	desc := make([]string, len(members))
+	for i, m := range members {
+		desc[i] = fmt.Sprintf("%s (%s %s)", m.addr, m.role, m.state)
+	}
+	log.Printf("[%s] Group Replication: %d members: %s", s.cfg.Name, len(members), strings.Join(desc, ", "))
+	if !config.True(s.cfg.GroupRepl.SpreadWrites) {
+		return nil, nil
+	}
+
+	def := s.cfg.MySQL
+	def.DSN, def.Hostname, def.Socket, def.Pipe = "", "", "", ""
+	if s.cfg.Targets == nil {
+		s.cfg.Targets = map[string]config.MySQL{}
+	}
+	primaries := []string{}
+	for _, m := range members {
+		if m.state != "ONLINE" || m.role != "PRIMARY" {
+			continue
+		}
+		if _, ok := s.cfg.Targets[m.addr]; !ok {
+			t := config.MySQL{Hostname: m.addr}
+			if s.cfg.MySQL.Protocol == config.PROTOCOL_X {
+				if host, _, err := net.SplitHostPort(m.addr); err == nil {
+					t.Hostname = host // X Protocol port, not MEMBER_PORT
+				}
+			}
+			t.With(def)
+			s.cfg.Targets[m.addr] = t
+		}
+		primaries = append(primaries, m.addr)
+	}
+	if len(primaries) == 0 {
+		return nil, fmt.Errorf("group-replication.spread-writes: no ONLINE PRIMARY members")
+	}
+	log.Printf("[%s] Group Replication: spreading writes across %d primaries: %s", s.cfg.Name, len(primaries), strings.Join(primaries, ", "))
+	return primaries, nil
+}
+
+// grCounters are one member's counters from
+// performance_schema.replication_group_member_stats.
+type grCounters struct {
+	role      string
+	local     uint64 // COUNT_TRANSACTIONS_LOCAL_PROPOSED
+	applied   uint64 // COUNT_TRANSACTIONS_REMOTE_APPLIED
+	conflicts uint64 // COUNT_CONFLICTS_DETECTED
+	rollbacks uint64 // COUNT_TRANSACTIONS_LOCAL_ROLLBACK
+}
+
+// grMemberStats returns the counters for all members by address.
+func grMemberStats(ctx context.Context, db *sql.DB) (map[string]grCounters, error) {
+	rows, err := db.QueryContext(ctx, "SELECT m.MEMBER_HOST, m.MEMBER_PORT, m.MEMBER_ROLE,"+
+		" s.COUNT_TRANSACTIONS_LOCAL_PROPOSED, s.COUNT_TRANSACTIONS_REMOTE_APPLIED, s.COUNT_CONFLICTS_DETECTED, s.COUNT_TRANSACTIONS_LOCAL_ROLLBACK"+
+		" FROM performance_schema.replication_group_members m JOIN performance_schema.replication_group_member_stats s USING (MEMBER_ID)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := map[string]grCounters{}
+	for rows.Next() {
+		var host string
+		var port sql.NullInt64
+		var c grCounters
+		if err := rows.Scan(&host, &port, &c.role, &c.local, &c.applied, &c.conflicts, &c.rollbacks); err != nil {
+			return nil, err
+		}
+		addr := host
+		if port.Valid {
+			addr = net.JoinHostPort(host, strconv.FormatInt(port.Int64, 10))
+		}
+		stats[addr] = c
+	}
+	return stats, rows.Err()
+}
+
+// grReport returns one line per member with throughput from start to end: local
+// trx/s (trx committed on the member) and applied trx/s (trx from other members),
+// and the number of certification conflicts and local rollbacks. A member that
+// joined during the stage is counted from zero.
+func grReport(start, end map[string]grCounters, d time.Duration) []string {
+	addrs := make([]string, 0, len(end))
+	for addr := range end {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	secs := d.Seconds()
+	if secs <= 0 {
+		secs = 1
+	}
+	delta := func(end, start uint64) uint64 {
+		if end < start { // counters reset: member rejoined
+			return end
+		}
+		return end - start
+	}
+	lines := make([]string, len(addrs))
+	for i, addr := range addrs {
+		e, s := end[addr], start[addr]
+		lines[i] = fmt.Sprintf("  %s %s: %.1f local trx/s, %.1f applied trx/s, %d conflicts, %d rollbacks", addr, e.role,
+			float64(delta(e.local, s.local))/secs,
+			float64(delta(e.applied, s.applied))/secs,
+			delta(e.conflicts, s.conflicts),
+			delta(e.rollbacks, s.rollbacks))
+	}
+	return lines
+}
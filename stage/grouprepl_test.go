@@ -0,0 +1,28 @@
+package stage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestGrReport(t *testing.T) {
+	start := map[string]grCounters{
+		"h1:3306": {role: "PRIMARY", local: 100, applied: 50, conflicts: 1, rollbacks: 1},
+		"h2:3306": {role: "PRIMARY", local: 200, applied: 80},
+	}
+	end := map[string]grCounters{
+		"h2:3306": {role: "PRIMARY", local: 400, applied: 180, conflicts: 3, rollbacks: 2},
+		"h1:3306": {role: "PRIMARY", local: 300, applied: 250, conflicts: 4, rollbacks: 1},
+		"h3:3306": {role: "SECONDARY", applied: 40}, // joined during stage
+	}
+	expect := []string{
+		"  h1:3306 PRIMARY: 20.0 local trx/s, 20.0 applied trx/s, 3 conflicts, 0 rollbacks",
+		"  h2:3306 PRIMARY: 20.0 local trx/s, 10.0 applied trx/s, 3 conflicts, 2 rollbacks",
+		"  h3:3306 SECONDARY: 0.0 local trx/s, 4.0 applied trx/s, 0 conflicts, 0 rollbacks",
+	}
+	if diff := deep.Equal(grReport(start, end, 10*time.Second), expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+)
+
+// GUARD_CHECK_FREQ is how often the stage checks compute resource usage
+// (config.stage.compute.max-cpu and max-gc-pause).
+var GUARD_CHECK_FREQ = time.Second
+
+// guard checks if the compute is client-bound (see stats.Guard). It logs a
+// warning when the compute becomes client-bound, not every check, and cancels
+// the stage if compute.on-client-bound is abort.
+func (s *Stage) guard(ctx context.Context, cancelStage context.CancelFunc) {
+	s.guardrail.Start()
+	ticker := time.NewTicker(GUARD_CHECK_FREQ)
+	defer ticker.Stop()
+	bound := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		over := s.guardrail.Check()
+		if len(over) == 0 {
+			if bound {
+				log.Printf("[%s] Compute no longer client-bound", s.cfg.Name)
+			}
+			bound = false
+			continue
+		}
+		if s.cfg.Compute.OnClientBound == config.BOUND_ABORT {
+			log.Printf("[%s] Stopping: compute is client-bound: %s (compute.on-client-bound: abort)", s.cfg.Name, strings.Join(over, ", "))
+			finch.Fail(finch.EXIT_THRESHOLD)
+			cancelStage()
+			return
+		}
+		if !bound {
+			log.Printf("[%s] WARNING: compute is client-bound, stats measure Finch not MySQL: %s", s.cfg.Name, strings.Join(over, ", "))
+		}
+		bound = true
+	}
+}
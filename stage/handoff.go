@@ -0,0 +1,49 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"log"
+
+	"github.com/square/finch/dbconn"
+)
+
+// takeHandoff logs the connections taken from the previous stage (workload.Allocator
+// takes them), and closes the ones it kept that this stage didn't take because
+// the DSN changed. It's called after the workload is allocated.
+func (s *Stage) takeHandoff() {
+	nTaken, nIdle := 0, 0
+	for egNo := range s.execGroups {
+		for _, cg := range s.execGroups[egNo] {
+			if cg.Taken {
+				nTaken++
+				nIdle += cg.DB.Stats().Idle
+			}
+		}
+	}
+	if nTaken > 0 {
+		log.Printf("[%s] Handoff: %d idle connections from previous stage", s.cfg.Name, nIdle)
+	}
+	if n := dbconn.CloseKept(); n > 0 {
+		log.Printf("[%s] Handoff: closed %d connection pools from previous stage with a different DSN", s.cfg.Name, n)
+	}
+}
+
+// handoff keeps the connection pool of each client group for the next stage if
+// config.stage.handoff is true and the stage finished (ok). Else, it closes the
+// pools taken from the previous stage because they keep all client connections
+// idle.
+func (s *Stage) handoff(ok bool) {
+	for egNo := range s.execGroups {
+		for _, cg := range s.execGroups[egNo] {
+			switch {
+			case cg.DB == nil:
+				continue
+			case s.cfg.Handoff && ok:
+				dbconn.Keep(cg.DBKey, cg.DB)
+			case cg.Taken:
+				cg.DB.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"fmt"
+
+	"github.com/square/finch"
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+)
+
+// partition returns the stage trx with param partition "I/N" set for data
+// generators that support it (data.Partitioned) when the stage is distributed,
+// so each compute instance generates unique values (keys). It doesn't change
+// partition if set in the stage file. The trx are copies because the config
+// is shared with the compute server.
+func partition(cfg config.Stage) []config.Trx {
+	n := finch.Uint(cfg.Compute.Instances)
+	if cfg.Instance == 0 || n < 2 {
+		return cfg.Trx // not distributed
+	}
+	trx := make([]config.Trx, len(cfg.Trx))
+	for i := range cfg.Trx {
+		trx[i] = cfg.Trx[i]
+		trx[i].Data = make(map[string]config.Data, len(cfg.Trx[i].Data))
+		for k, d := range cfg.Trx[i].Data {
+			if _, ok := d.Params["partition"]; data.Partitioned(d.Generator) && !ok {
+				params := map[string]string{"partition": fmt.Sprintf("%d/%d", cfg.Instance, n)}
+				for pk, pv := range d.Params {
+					params[pk] = pv
+				}
+				d.Params = params
+				finch.Debug("%s %s partition %s", cfg.Trx[i].Name, k, params["partition"])
+			}
+			trx[i].Data[k] = d
+		}
+	}
+	return trx
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"testing"
+
+	"github.com/square/finch/config"
+)
+
+func TestPartition(t *testing.T) {
+	cfg := config.Stage{
+		Compute:  config.Compute{Instances: "3"},
+		Instance: 2,
+		Trx: []config.Trx{{
+			Name: "insert.sql",
+			Data: map[string]config.Data{
+				"id":   {Generator: "auto-inc"},
+				"c":    {Generator: "int-chunk", Params: map[string]string{"size": "10", "partition": "1/1"}},
+				"name": {Generator: "str-fill-az"},
+			},
+		}},
+	}
+
+	trx := partition(cfg)
+	if got := trx[0].Data["id"].Params["partition"]; got != "2/3" {
+		t.Errorf("auto-inc: got partition %q, expected 2/3", got)
+	}
+	if got := trx[0].Data["c"].Params["partition"]; got != "1/1" {
+		t.Errorf("int-chunk: got partition %q, expected 1/1 (set in stage file)", got)
+	}
+	if _, ok := trx[0].Data["name"].Params["partition"]; ok {
+		t.Error("str-fill-az: partition set, expected not set (not partitioned)")
+	}
+	if cfg.Trx[0].Data["id"].Params != nil {
+		t.Error("original stage config changed, expected copy")
+	}
+
+	// Not distributed
+	cfg.Instance = 0
+	if trx := partition(cfg); trx[0].Data["id"].Params != nil {
+		t.Error("partition set for instance 0, expected not set")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	gorate "golang.org/x/time/rate"
+
+	"github.com/square/finch"
+	"github.com/square/finch/client"
+)
+
+// preconnect connects all clients in all execution groups and prepares their
+// statements before the stage starts (config.stage.preconnect), so the first
+// stats interval isn't dominated by connection setup. If preconnect-rate is
+// set, it limits new connections per second to avoid a connection storm.
+// Errors are logged, not returned, because clients reconnect in Run and report
+// the error if it happens again.
+func (s *Stage) preconnect(ctx context.Context) {
+	var rl *gorate.Limiter
+	if n := finch.Uint(s.cfg.PreconnRate); n > 0 {
+		rl = gorate.NewLimiter(gorate.Limit(n), 1)
+	}
+
+	t0 := time.Now()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	nClients, nErrors := 0, 0
+CLIENTS:
+	for egNo := range s.execGroups {
+		for cgNo := range s.execGroups[egNo] {
+			for _, c := range s.execGroups[egNo][cgNo].Clients {
+				if rl != nil {
+					if err := rl.Wait(ctx); err != nil {
+						break CLIENTS // CTRL-C
+					}
+				}
+				nClients++
+				wg.Add(1)
+				go func(c *client.Client) {
+					defer wg.Done()
+					if err := c.Preconnect(ctx); err != nil && ctx.Err() == nil {
+						mu.Lock()
+						nErrors++
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+					}
+				}(c)
+			}
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	if nErrors > 0 {
+		log.Printf("[%s] WARNING: preconnect: %d of %d clients failed to connect; first error: %s", s.cfg.Name, nErrors, nClients, firstErr)
+	}
+	log.Printf("[%s] Preconnected %d clients in %s", s.cfg.Name, nClients-nErrors, time.Since(t0).Round(time.Millisecond))
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/square/finch/limit"
+	"github.com/square/finch/workload"
+)
+
+// progress is the known bounds of an exec group: rows limits (-- rows: N),
+// iterations (workload.iter, iter-clients, and iter-exec-group), and runtime
+// (workload.runtime and stage.runtime). The stage prints the progress of the
+// bound nearest completion (config.stage.progress), which is also the best
+// estimate of when the exec group will finish.
+type progress struct {
+	bounds    []bound
+	cgRuntime time.Duration // max workload.runtime if all client groups have one
+	runtime   time.Duration // stage.runtime
+	stageEnd  time.Time     // set by Stage.Run if runtime
+	start     atomic.Int64  // UnixNano when exec group started, 0 = not started
+	done      atomic.Bool
+}
+
+// bound is a count with a max, like rows inserted.
+type bound struct {
+	what string
+	n    func() uint64
+	max  uint64
+}
+
+// newProgress returns the progress of the exec group, or nil if it has no known
+// bounds. It must be called before the clients run because it sets
+// Client.Progress for clients with an iterations limit.
+func newProgress(eg []workload.ClientGroup, stageRuntime time.Duration) *progress {
+	p := &progress{runtime: stageRuntime}
+
+	var iter *uint64 // all clients with workload.iter
+	var iterMax uint64
+	cgIter := []*uint32{}
+	var cgIterMax uint64
+	rows := map[*limit.Rows]bool{}
+	allRuntime := true
+	for _, cg := range eg {
+		if cg.Runtime == 0 {
+			allRuntime = false
+		} else if cg.Runtime > p.cgRuntime {
+			p.cgRuntime = cg.Runtime
+		}
+		if len(cg.Clients) == 0 {
+			continue
+		}
+		if c := cg.Clients[0]; c.IterClients > 0 {
+			cgIter = append(cgIter, c.IterClientsPtr)
+			cgIterMax += uint64(c.IterClients)
+		}
+		for _, c := range cg.Clients {
+			if c.Iter > 0 {
+				if iter == nil {
+					iter = new(uint64)
+				}
+				c.Progress = iter
+				iterMax += uint64(c.Iter)
+			}
+			for _, stmt := range c.Statements {
+				if lm := limit.RowsLimit(stmt.Limit); lm != nil {
+					rows[lm] = true
+				}
+			}
+		}
+	}
+	if !allRuntime {
+		p.cgRuntime = 0
+	}
+
+	if len(eg) > 0 && len(eg[0].Clients) > 0 && eg[0].Clients[0].IterExecGroup > 0 {
+		c := eg[0].Clients[0] // all clients share the exec group counter
+		ptr := c.IterExecGroupPtr
+		p.bounds = append(p.bounds, bound{
+			what: "iterations",
+			n:    func() uint64 { return uint64(atomic.LoadUint32(ptr)) },
+			max:  uint64(c.IterExecGroup),
+		})
+	}
+	if len(cgIter) > 0 {
+		p.bounds = append(p.bounds, bound{
+			what: "iterations",
+			n: func() uint64 {
+				var n uint64
+				for _, ptr := range cgIter {
+					n += uint64(atomic.LoadUint32(ptr))
+				}
+				return n
+			},
+			max: cgIterMax,
+		})
+	}
+	if iter != nil {
+		p.bounds = append(p.bounds, bound{
+			what: "iterations",
+			n:    func() uint64 { return atomic.LoadUint64(iter) },
+			max:  iterMax,
+		})
+	}
+	if len(rows) > 0 {
+		var max uint64
+		for lm := range rows {
+			max += uint64(lm.Max())
+		}
+		p.bounds = append(p.bounds, bound{
+			what: "rows",
+			n: func() uint64 {
+				var n uint64
+				for lm := range rows {
+					if v := lm.N(); v > 0 {
+						n += uint64(v)
+					}
+				}
+				return n
+			},
+			max: max,
+		})
+	}
+
+	if len(p.bounds) == 0 && p.cgRuntime == 0 && p.runtime == 0 {
+		return nil
+	}
+	return p
+}
+
+// status returns the percent complete, a description of the bound nearest
+// completion, and the ETA, or zero if unknown. It returns false if the exec
+// group isn't running.
+func (p *progress) status(now time.Time) (float64, string, time.Duration, bool) {
+	start := p.start.Load()
+	if start == 0 || p.done.Load() {
+		return 0, "", 0, false
+	}
+	elapsed := now.Sub(time.Unix(0, start))
+	var pct float64
+	var what string
+	var eta time.Duration
+	for _, b := range p.bounds {
+		n := b.n()
+		if n > b.max {
+			n = b.max // counters can overshoot when clients stop
+		}
+		f := float64(n) / float64(b.max) * 100
+		if f < pct || (f == pct && what != "") {
+			continue
+		}
+		pct = f
+		what = fmt.Sprintf("%s %s of %s", b.what, humanize.Comma(int64(n)), humanize.Comma(int64(b.max)))
+		eta = 0
+		if n > 0 {
+			eta = time.Duration(float64(elapsed) * float64(b.max-n) / float64(n))
+		}
+	}
+	runtime := func(end time.Time, total time.Duration) {
+		left := end.Sub(now)
+		if left < 0 {
+			left = 0
+		}
+		f := float64(total-left) / float64(total) * 100
+		if f <= pct && what != "" {
+			return
+		}
+		pct = f
+		what = fmt.Sprintf("runtime %s of %s", (total - left).Round(time.Second), total)
+		eta = left
+	}
+	if p.cgRuntime > 0 {
+		runtime(time.Unix(0, start).Add(p.cgRuntime), p.cgRuntime)
+	}
+	if !p.stageEnd.IsZero() {
+		// Stage runtime counts from when the stage started, which can be before
+		// this exec group started
+		runtime(p.stageEnd, p.runtime)
+	}
+	return pct, what, eta, true
+}
+
+// egProgress returns the progress of the exec group, or nil if progress is
+// disabled or the exec group has no known bounds.
+func (s *Stage) egProgress(egNo int) *progress {
+	if s.progress == nil {
+		return nil
+	}
+	return s.progress[egNo]
+}
+
+// reportProgress prints the progress of running exec groups every freq until
+// ctx is cancelled.
+func (s *Stage) reportProgress(ctx context.Context, freq time.Duration) {
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		for egNo, p := range s.progress {
+			if p == nil {
+				continue
+			}
+			pct, what, eta, ok := p.status(now)
+			if !ok {
+				continue
+			}
+			if eta > 0 {
+				log.Printf("[%s] Execution group %d: %.1f%% (%s), ETA %s (%s)", s.cfg.Name, egNo+1, pct, what, eta.Round(time.Second), now.Add(eta).Format("15:04:05"))
+			} else {
+				log.Printf("[%s] Execution group %d: %.1f%% (%s)", s.cfg.Name, egNo+1, pct, what)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package stage
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/limit"
+	"github.com/square/finch/trx"
+	"github.com/square/finch/workload"
+)
+
+func TestProgress(t *testing.T) {
+	// No bounds: no progress
+	eg := []workload.ClientGroup{{Clients: []*client.Client{{}}}}
+	if p := newProgress(eg, 0); p != nil {
+		t.Errorf("got progress %+v, expected nil when no bounds", p)
+	}
+
+	// Rows limit and iterations: nearest completion wins
+	lm := limit.NewRows(1000, 0)
+	c1 := &client.Client{Iter: 10, Statements: []*trx.Statement{{Limit: lm}}}
+	c2 := &client.Client{Iter: 10}
+	eg = []workload.ClientGroup{{Clients: []*client.Client{c1, c2}}}
+	p := newProgress(eg, 0)
+	if p == nil {
+		t.Fatal("got nil progress, expected rows and iterations bounds")
+	}
+	if c1.Progress == nil || c1.Progress != c2.Progress {
+		t.Fatal("Client.Progress not set and shared by clients with iter")
+	}
+
+	now := time.Now()
+	if _, _, _, ok := p.status(now); ok {
+		t.Error("status ok before exec group started, expected false")
+	}
+	p.start.Store(now.Add(-10 * time.Second).UnixNano())
+
+	lm.Affected(250)                  // 25% rows
+	atomic.AddUint64(c1.Progress, 10) // 50% iterations
+	pct, what, eta, ok := p.status(now)
+	if !ok {
+		t.Fatal("status not ok, expected ok after exec group started")
+	}
+	if pct != 50 || !strings.HasPrefix(what, "iterations 10 of 20") {
+		t.Errorf("got %.1f%% (%s), expected 50%% (iterations 10 of 20)", pct, what)
+	}
+	if eta != 10*time.Second {
+		t.Errorf("got ETA %s, expected 10s", eta)
+	}
+
+	lm.Affected(650) // 90% rows
+	pct, what, _, _ = p.status(now)
+	if pct != 90 || !strings.HasPrefix(what, "rows 900 of 1,000") {
+		t.Errorf("got %.1f%% (%s), expected 90%% (rows 900 of 1,000)", pct, what)
+	}
+
+	// Stage runtime: ETA is time left
+	p = newProgress([]workload.ClientGroup{{Clients: []*client.Client{{}}}}, time.Minute)
+	p.start.Store(now.Add(-15 * time.Second).UnixNano())
+	p.stageEnd = now.Add(45 * time.Second)
+	pct, what, eta, _ = p.status(now)
+	if pct != 25 || eta != 45*time.Second || what != "runtime 15s of 1m0s" {
+		t.Errorf("got %.1f%% (%s) ETA %s, expected 25%% (runtime 15s of 1m0s) ETA 45s", pct, what, eta)
+	}
+
+	p.done.Store(true)
+	if _, _, _, ok := p.status(now); ok {
+		t.Error("status ok after exec group done, expected false")
+	}
+}
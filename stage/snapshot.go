@@ -0,0 +1,185 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/stats"
+)
+
+// SNAPSHOT_MAX_CLIENTS is the max number of clients printed in a snapshot.
+// Clients that are reconnecting or have errors are printed first.
+const SNAPSHOT_MAX_CLIENTS = 32
+
+// runningStages are stages in Run, for Snapshot.
+var runningStages = struct {
+	*sync.Mutex
+	stages []*Stage
+}{Mutex: &sync.Mutex{}}
+
+func (s *Stage) setRunning(running bool) {
+	runningStages.Lock()
+	defer runningStages.Unlock()
+	if running {
+		runningStages.stages = append(runningStages.stages, s)
+		return
+	}
+	for i := range runningStages.stages {
+		if runningStages.stages[i] == s {
+			runningStages.stages = append(runningStages.stages[:i], runningStages.stages[i+1:]...)
+			return
+		}
+	}
+}
+
+// Running returns the number of stages in Run.
+func Running() int {
+	runningStages.Lock()
+	defer runningStages.Unlock()
+	return len(runningStages.stages)
+}
+
+// Snapshot prints a snapshot of all running stages to stdout: stats of the
+// current interval so far and the status of each client. It doesn't interrupt
+// the stages. It returns false if no stage is running. It's called on SIGUSR1.
+func Snapshot() bool {
+	runningStages.Lock()
+	stages := append([]*Stage{}, runningStages.stages...)
+	runningStages.Unlock()
+	for _, s := range stages {
+		now := time.Now()
+		fmt.Printf("[%s] Snapshot at %s (runtime %s)\n", s.cfg.Name, now.Format("15:04:05"), now.Sub(s.started).Round(time.Second))
+		if s.stats != nil {
+			r, _ := stats.NewStdout(map[string]string{"summary": "false"})
+			r.Report([]stats.Instance{s.stats.Snapshot()})
+		}
+		for _, line := range s.clientSnapshot() {
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
+	return len(stages) > 0
+}
+
+// clientSnapshot returns a summary line for each exec group followed by one
+// line for each running client, up to SNAPSHOT_MAX_CLIENTS.
+func (s *Stage) clientSnapshot() []string {
+	var lines, problem, running []string
+	for egNo := range s.execGroups {
+		var n, connected, reconnecting, done, waiting int
+		var errors uint64
+		for cgNo := range s.execGroups[egNo] {
+			for _, c := range s.execGroups[egNo][cgNo].Clients {
+				n++
+				st := c.Status()
+				errors += st.Errors
+				line := fmt.Sprintf("  Client %s: %s", c.RunLevel.ClientId(), clientStatus(st))
+				switch {
+				case st.Done:
+					done++
+				case st.Connected:
+					connected++
+				case st.Iter > 0:
+					reconnecting++
+				default:
+					waiting++ // exec group not started, or connecting
+				}
+				if st.Done || (st.Iter == 0 && st.Errors == 0) {
+					continue
+				}
+				if !st.Connected || st.Errors > 0 {
+					problem = append(problem, line)
+				} else {
+					running = append(running, line)
+				}
+			}
+		}
+		lines = append(lines, fmt.Sprintf("[%s] Execution group %d: %d clients: %d connected, %d reconnecting, %d done, %d not started, %d errors",
+			s.cfg.Name, egNo+1, n, connected, reconnecting, done, waiting, errors))
+	}
+	clients := append(problem, running...)
+	if len(clients) > SNAPSHOT_MAX_CLIENTS {
+		more := len(clients) - SNAPSHOT_MAX_CLIENTS
+		clients = append(clients[:SNAPSHOT_MAX_CLIENTS], fmt.Sprintf("  ... %d more clients", more))
+	}
+	return append(lines, clients...)
+}
+
+func clientStatus(st client.Status) string {
+	state := "connected"
+	if !st.Connected {
+		state = "reconnecting"
+	}
+	line := fmt.Sprintf("%s, iter %d", state, st.Iter)
+	if st.Statement >= 0 {
+		line += fmt.Sprintf(", statement %d: %s", st.Statement+1, oneLine(st.Query, 80))
+	}
+	if st.Errors > 0 {
+		line += fmt.Sprintf(", %d errors (last: %s)", st.Errors, st.LastError)
+	}
+	return line
+}
+
+var reSpace = regexp.MustCompile(`\s+`)
+
+// oneLine returns s on one line truncated to max chars.
+func oneLine(s string, max int) string {
+	s = strings.TrimSpace(reSpace.ReplaceAllString(s, " "))
+	if len(s) > max {
+		s = s[:max-3] + "..."
+	}
+	return s
+}
+
+// Vars are expvar counters for a running stage (--debug-addr).
+type Vars struct {
+	Name      string      `json:"name"`
+	Runtime   float64     `json:"runtime"` // seconds
+	Clients   int         `json:"clients"`
+	Connected int         `json:"connected"`
+	Done      int         `json:"done"`
+	Iter      uint64      `json:"iter"`
+	Errors    uint64      `json:"errors"`
+	Live      *stats.Live `json:"live,omitempty"` // last reported interval
+}
+
+// RunningVars returns the counters of all running stages.
+func RunningVars() []Vars {
+	runningStages.Lock()
+	stages := append([]*Stage{}, runningStages.stages...)
+	runningStages.Unlock()
+	vars := make([]Vars, len(stages))
+	for i, s := range stages {
+		v := Vars{
+			Name:    s.cfg.Name,
+			Runtime: time.Since(s.started).Seconds(),
+		}
+		for egNo := range s.execGroups {
+			for cgNo := range s.execGroups[egNo] {
+				for _, c := range s.execGroups[egNo][cgNo].Clients {
+					st := c.Status()
+					v.Clients++
+					if st.Connected {
+						v.Connected++
+					}
+					if st.Done {
+						v.Done++
+					}
+					v.Iter += st.Iter
+					v.Errors += st.Errors
+				}
+			}
+		}
+		if s.stats != nil {
+			v.Live = s.stats.Live()
+		}
+		vars[i] = v
+	}
+	return vars
+}
@@ -0,0 +1,73 @@
+package stage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/square/finch"
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+	"github.com/square/finch/workload"
+)
+
+func TestClientStatus(t *testing.T) {
+	got := clientStatus(client.Status{
+		Connected: true,
+		Iter:      5,
+		Statement: 1,
+		Query:     "SELECT *\n  FROM t\n  WHERE id = ?",
+		Errors:    2,
+		LastError: "Error 1205 (HY000): Lock wait timeout exceeded",
+	})
+	expect := "connected, iter 5, statement 2: SELECT * FROM t WHERE id = ?, 2 errors (last: Error 1205 (HY000): Lock wait timeout exceeded)"
+	if got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+
+	got = clientStatus(client.Status{Statement: -1})
+	if got != "reconnecting, iter 0" {
+		t.Errorf("got %q, expected \"reconnecting, iter 0\"", got)
+	}
+
+	if got := oneLine(strings.Repeat("x", 100), 10); got != "xxxxxxx..." {
+		t.Errorf("got %q, expected 7 x and ...", got)
+	}
+}
+
+func TestClientSnapshot(t *testing.T) {
+	s := &Stage{
+		cfg: config.Stage{Name: "test"},
+		execGroups: [][]workload.ClientGroup{
+			{{Clients: []*client.Client{
+				{RunLevel: finch.RunLevel{Stage: 1, ExecGroup: 1, ClientGroup: 1, Client: 1}},
+				{RunLevel: finch.RunLevel{Stage: 1, ExecGroup: 1, ClientGroup: 1, Client: 2}},
+			}}},
+		},
+	}
+	got := s.clientSnapshot()
+	expect := []string{"[test] Execution group 1: 2 clients: 0 connected, 0 reconnecting, 0 done, 2 not started, 0 errors"}
+	if len(got) != 1 || got[0] != expect[0] {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestRunningVars(t *testing.T) {
+	if got := RunningVars(); len(got) != 0 {
+		t.Fatalf("got %+v, expected no running stages", got)
+	}
+	s := &Stage{
+		cfg: config.Stage{Name: "test"},
+		execGroups: [][]workload.ClientGroup{
+			{{Clients: []*client.Client{{}, {}}}},
+		},
+	}
+	s.setRunning(true)
+	got := RunningVars()
+	s.setRunning(false)
+	if len(got) != 1 || got[0].Name != "test" || got[0].Clients != 2 || got[0].Live != nil {
+		t.Errorf("got %+v, expected stage test with 2 clients and no live stats", got)
+	}
+	if got := RunningVars(); len(got) != 0 {
+		t.Errorf("got %+v after stage stopped, expected none", got)
+	}
+}
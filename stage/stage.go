@@ -4,11 +4,17 @@ package stage
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"runtime/pprof"
+	"sort"
 	"time"
 
+	human "github.com/dustin/go-humanize"
+
 	"github.com/square/finch"
 	"github.com/square/finch/client"
 	"github.com/square/finch/config"
@@ -31,6 +37,25 @@ type Stage struct {
 	// --
 	doneChan   chan *client.Client      // <-Client.Run()
 	execGroups [][]workload.ClientGroup // [n][Client]
+	rows       map[string]*limit.Rows   // rows limits for config.stage.checkpoint
+	counters   *client.Counters         // for config.stage.exit
+	share      *client.Share            // for config.stage.compute.Share()
+	pause      *client.Pause            // for Pause
+	guardrail  *stats.Guard             // for config.stage.compute.max-cpu and max-gc-pause
+	progress   []*progress              // for config.stage.progress, by exec group; nil if no bounds
+	started    time.Time                // when Run started, for Snapshot
+	statusDb   *sql.DB                  // for config.stage.stats.tidb-status
+	failover   *client.Failover         // for config.stage.failover
+	grDb       *sql.DB                  // for config.stage.group-replication member stats
+}
+
+// flavorErrors are the errors handled for each mysql.flavor in addition to
+// finch.MySQLErrorHandling.
+var flavorErrors = map[string]map[uint16]byte{
+	config.FLAVOR_MARIADB:  finch.MariaDBErrorHandling,
+	config.FLAVOR_TIDB:     finch.TiDBErrorHandling,
+	config.FLAVOR_VITESS:   finch.VitessErrorHandling,
+	config.FLAVOR_PROXYSQL: finch.ProxySQLErrorHandling,
 }
 
 func New(cfg config.Stage, gds *data.Scope, stats *stats.Collector) *Stage {
@@ -40,6 +65,7 @@ func New(cfg config.Stage, gds *data.Scope, stats *stats.Collector) *Stage {
 		stats: stats,
 		// --
 		doneChan: make(chan *client.Client, 1),
+		pause:    &client.Pause{},
 	}
 }
 
@@ -57,19 +83,103 @@ func (s *Stage) Prepare(ctxFinch context.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("test connection to MySQL failed: %s: %s", dsnRedacted, err)
+		return finch.ExitError{Code: finch.EXIT_CONNECT, Err: fmt.Errorf("test connection to MySQL failed: %s: %s", dsnRedacted, err)}
+	}
+	flavor, version, err := serverVersion(ctx, db, s.cfg.MySQL.Flavor)
+	if err != nil {
+		log.Printf("[%s] Error detecting MySQL version: %s", s.cfg.Name, err)
+	}
+	// Group Replication (config.stage.group-replication): discover members, and
+	// add a target for each primary to spread writes across
+	var primaries []string
+	if s.cfg.GroupRepl != nil {
+		primaries, err = s.groupRepl(ctx, db)
+		if err != nil {
+			db.Close()
+			return err
+		}
+	}
+	// Measure client-side noise (timer, scheduler, round trip) to interpret
+	// sub-millisecond response times
+	if s.stats != nil {
+		// Calibration has its own timeout because the checks above can use
+		// most of theirs: time to connect (mysql.timeout-connect, default 10s)
+		// plus 1s for the timer, jitter, and SELECT 1 samples
+		timeout, _ := time.ParseDuration(s.cfg.MySQL.TimeoutConnect)
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctxCal, cancelCal := context.WithTimeout(ctxFinch, timeout+time.Second)
+		cal, err := stats.Calibrate(ctxCal, db)
+		cancelCal()
+		if err != nil {
+			log.Printf("[%s] Error measuring SELECT 1 round trip: %s", s.cfg.Name, err)
+		}
+		log.Printf("[%s] Calibration: %s", s.cfg.Name, cal)
+		s.stats.SetCalibration(cal)
+	}
+	switch {
+	case config.True(s.cfg.Stats.TiDBStatus) && s.cfg.Instance <= 1:
+		s.statusDb = db // closed in Run
+	case s.cfg.GroupRepl != nil && s.cfg.Instance <= 1:
+		s.grDb = db // closed in Run
+	default:
+		db.Close() // test conn
+	}
+	if version == "" {
+		log.Printf("Connected to %s", dsnRedacted)
+	} else {
+		log.Printf("Connected to %s (%s)", dsnRedacted, version)
+		if s.stats != nil {
+			s.stats.SetVersion(version)
+		}
+	}
+	if flavor == config.FLAVOR_SQLITE {
+		log.Printf("[%s] WARNING: SQLite (mysql.flavor: %s) is for developing trx files; stats are not comparable to MySQL", s.cfg.Name, config.FLAVOR_SQLITE)
+	}
+	if (flavor == config.FLAVOR_MARIADB || flavor == config.FLAVOR_TIDB) && (s.cfg.MySQL.Flavor == "" || s.cfg.MySQL.Flavor == config.FLAVOR_MYSQL) {
+		log.Printf("[%s] WARNING: server is %s but mysql.flavor is not set; set mysql.flavor: %s to handle %s errors", s.cfg.Name, version, flavor, flavor)
+	}
+
+	// Test connections to named targets (config.stage.targets), if any
+	dbconn.SetTargets(s.cfg.Targets)
+	for _, name := range targetNames(s.cfg.Targets) {
+		db, dsnRedacted, err := dbconn.MakeTarget(name)
+		if err != nil {
+			return fmt.Errorf("target %s: %s", name, err)
+		}
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return finch.ExitError{Code: finch.EXIT_CONNECT, Err: fmt.Errorf("test connection to target %s failed: %s: %s", name, dsnRedacted, err)}
+		}
+		db.Close()
+		log.Printf("Connected to target %s: %s", name, dsnRedacted)
 	}
-	db.Close() // test conn
-	log.Printf("Connected to %s", dsnRedacted)
 
 	// Load and validate all config.stage.trx files. This makes and validates all
 	// data generators, too. Being valid means only that the Finch config/setup is
 	// valid, not the SQL statements because those aren't run yet, so MySQL might
 	// still return errors on Run.
 	finch.Debug("load trx")
-	trxSet, err := trx.Load(s.cfg.Trx, s.gds, s.cfg.Params)
+	trxSet, err := trx.Load(partition(s.cfg), s.gds, s.cfg.Params)
 	if err != nil {
-		return err
+		return finch.ConfigError(err)
+	}
+	if s.cfg.MySQL.Flavor == config.FLAVOR_CLICKHOUSE {
+		if errs := trx.CheckNoTrx(trxSet); len(errs) > 0 {
+			return finch.ConfigError(fmt.Errorf("mysql.flavor: %s: %s", config.FLAVOR_CLICKHOUSE, errs[0]))
+		}
+	}
+
+	// Resume rows limits (-- rows: N) from checkpoint, if any
+	if s.cfg.Checkpoint != "" {
+		s.rows = rowsLimits(trxSet)
+		if len(s.rows) == 0 {
+			log.Printf("[%s] WARNING: checkpoint ignored because no statements have a rows limit", s.cfg.Name)
+			s.rows = nil
+		} else if err := s.resume(trxSet); err != nil {
+			return err
+		}
 	}
 
 	// Allocate the workload (config.stage.workload): execution groups, client groups,
@@ -77,6 +187,24 @@ func (s *Stage) Prepare(ctxFinch context.Context) error {
 	// returns the execution groups. Second, Clients returns the ready-to-run clients
 	// for each exec group. Both steps are required but separated for testing because
 	// the second is complex.
+	if s.cfg.Exit != nil {
+		s.counters = &client.Counters{}
+	}
+	if s.cfg.Compute.Share() {
+		s.share = &client.Share{}
+	}
+	if s.cfg.Failover != nil {
+		wait, _ := time.ParseDuration(s.cfg.Failover.ReconnectWait) // already validated
+		s.failover = &client.Failover{
+			ReconnectOnReadOnly: s.cfg.Failover.OnReadOnly == config.FAILOVER_RECONNECT,
+			ReconnectWait:       wait,
+		}
+	}
+	s.guardrail = stats.NewGuard(s.cfg.Compute) // nil if disabled
+	if s.stats != nil {
+		s.stats.Guard = s.guardrail
+	}
+
 	finch.Debug("alloc clients")
 	a := workload.Allocator{
 		Stage:     s.cfg.N,
@@ -86,14 +214,57 @@ func (s *Stage) Prepare(ctxFinch context.Context) error {
 		StageQPS:  limit.NewRate(finch.Uint(s.cfg.QPS)), // nil if config.stage.qps == 0
 		StageTPS:  limit.NewRate(finch.Uint(s.cfg.TPS)), // nil if config.stage.tps == 0
 		DoneChan:  s.doneChan,
+
+		QueryComment: s.cfg.QueryComment,
+		RunId:        s.cfg.RunId,
+		QueryHint:    s.cfg.QueryHint,
+		Counters:     s.counters,
+		Share:        s.share,
+		Pause:        s.pause,
+		Failover:     s.failover,
+
+		SpreadTargets: primaries,
+		ErrorHandling: finch.ErrorHandling(flavorErrors[s.cfg.MySQL.Flavor], grErrors(s.cfg.GroupRepl)),
+		Proxy:         s.cfg.MySQL.ClientPrepare(),
+		FastPath:      config.True(s.cfg.MySQL.FastPath),
+		PinClients:    s.cfg.PinClients,
+		Handoff:       s.cfg.Handoff,
+	}
+	a.SaveMaxRows, a.SaveMaxMemory = saveLimits(s.cfg.SaveLimits)
+	if s.stats != nil {
+		a.Clock = s.stats.Clock() // config.stats.clock
 	}
 	groups, err := a.Groups()
 	if err != nil {
-		return err
+		return finch.ConfigError(err)
 	}
 	s.execGroups, err = a.Clients(groups, s.stats != nil)
 	if err != nil {
-		return err
+		return finch.ConfigError(err)
+	}
+	s.takeHandoff()
+	if s.cfg.PinClients {
+		nCPU := len(client.CPUs())
+		for egNo := range s.execGroups {
+			n := 0
+			for cgNo := range s.execGroups[egNo] {
+				n += len(s.execGroups[egNo][cgNo].Clients)
+			}
+			if n > nCPU {
+				log.Printf("[%s] WARNING: pin-clients: execution group %d has %d clients but only %d CPUs (GOMAXPROCS); clients share CPUs", s.cfg.Name, egNo+1, n, nCPU)
+			}
+		}
+	}
+	log.Printf("[%s] Statements:", s.cfg.Name)
+	printSummary(os.Stdout, a, groups, s.execGroups, finch.Verbose)
+
+	// Progress of exec groups with known bounds (config.stage.progress)
+	if s.cfg.Progress != "0" {
+		runtime, _ := time.ParseDuration(s.cfg.Runtime) // already validated
+		s.progress = make([]*progress, len(s.execGroups))
+		for egNo := range s.execGroups {
+			s.progress[egNo] = newProgress(s.execGroups[egNo], runtime)
+		}
 	}
 
 	// Initialize all clients in all exec groups, and register their stats with
@@ -115,6 +286,129 @@ func (s *Stage) Prepare(ctxFinch context.Context) error {
 	return nil
 }
 
+// Validate loads all trx files, checks all statements, and allocates the
+// workload like Prepare but without connecting to MySQL. It returns all
+// statement errors from trx.Check, else the first load or allocation error.
+// A stage with load (config.stage.load) has no trx files to validate until
+// it's planned. This is used by "finch validate".
+func (s *Stage) Validate() []error {
+	if s.cfg.Load != nil {
+		return nil // trx and workload planned on run; see load.Plan
+	}
+	if len(s.cfg.Trx) == 0 {
+		panic("Stage.Validate called with zero trx")
+	}
+	trxSet, err := trx.Load(s.cfg.Trx, s.gds, s.cfg.Params)
+	if err != nil {
+		return []error{err}
+	}
+	errs := trx.Check(trxSet)
+	if s.cfg.MySQL.Flavor == config.FLAVOR_CLICKHOUSE {
+		errs = append(errs, trx.CheckNoTrx(trxSet)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	a := workload.Allocator{
+		Stage:     s.cfg.N,
+		StageName: s.cfg.Name,
+		TrxSet:    trxSet,
+		Workload:  s.cfg.Workload,
+	}
+	if _, err := a.Groups(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Dry run formats (--dry-run-format)
+const (
+	DRY_RUN_TEXT = "text"
+	DRY_RUN_JSON = "json"
+	DRY_RUN_DOT  = "dot"
+)
+
+// DryRun loads all trx files and allocates the workload like Prepare, then prints
+// the plan (see workload.Allocator.Plan) to w instead of initializing clients.
+// If format is json or dot, it prints the allocation (see workload.Allocation)
+// instead. It doesn't connect to MySQL. This is used by --dry-run.
+func (s *Stage) DryRun(w io.Writer, format string) error {
+	if s.cfg.Load != nil && format != DRY_RUN_TEXT {
+		al := workload.Allocation{Stage: s.cfg.N, StageName: s.cfg.Name, Load: s.cfg.Load.Table}
+		if format == DRY_RUN_JSON {
+			return al.JSON(w)
+		}
+		return al.Dot(w)
+	}
+	if s.cfg.Load != nil {
+		fmt.Fprintf(w, "Stage %d: %s (%s): load %s, %s rows, %s clients (planned on run, requires MySQL)\n",
+			s.cfg.N, s.cfg.Name, s.cfg.File, s.cfg.Load.Table, s.cfg.Load.Rows, s.cfg.Load.Clients)
+		return nil
+	}
+	if len(s.cfg.Trx) == 0 {
+		panic("Stage.DryRun called with zero trx")
+	}
+	dbconn.SetConfig(s.cfg.MySQL)
+	dbconn.SetTargets(s.cfg.Targets)
+	trxSet, err := trx.Load(s.cfg.Trx, s.gds, s.cfg.Params)
+	if err != nil {
+		return err
+	}
+	a := workload.Allocator{
+		Stage:     s.cfg.N,
+		StageName: s.cfg.Name,
+		TrxSet:    trxSet,
+		Workload:  s.cfg.Workload,
+		StageQPS:  limit.NewRate(finch.Uint(s.cfg.QPS)),
+		StageTPS:  limit.NewRate(finch.Uint(s.cfg.TPS)),
+		DoneChan:  s.doneChan,
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		return err
+	}
+	clients, err := a.Clients(groups, false)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case DRY_RUN_JSON:
+		return a.Allocation(groups, clients, s.cfg.QPS, s.cfg.TPS).JSON(w)
+	case DRY_RUN_DOT:
+		return a.Allocation(groups, clients, s.cfg.QPS, s.cfg.TPS).Dot(w)
+	}
+	fmt.Fprintf(w, "Stage %d: %s (%s)%s\n", s.cfg.N, s.cfg.Name, s.cfg.File, workload.Options(
+		"runtime", s.cfg.Runtime,
+		"qps", s.cfg.QPS,
+		"tps", s.cfg.TPS,
+	))
+	a.Plan(w, groups, clients)
+	printSummary(w, a, groups, clients, finch.Verbose)
+	if e := s.cfg.Exit; e != nil {
+		fmt.Fprintf(w, "  Exit when %s%s\n", e.When, workload.Options(
+			"runtime", e.Runtime,
+			"iter", e.Iter,
+			"rows", e.Rows,
+			"errors", e.Errors,
+		))
+	}
+	if f := s.cfg.Failover; f != nil {
+		fmt.Fprintf(w, "  Failover: on-read-only %s, on-dns-flip %s%s\n", f.OnReadOnly, f.OnDNSFlip, workload.Options(
+			"dns-freq", f.DNSFreq,
+			"reconnect-wait", f.ReconnectWait,
+		))
+	}
+	if g := s.cfg.GroupRepl; g != nil {
+		fmt.Fprintf(w, "  Group Replication: members discovered on run (requires MySQL)%s\n", workload.Options(
+			"spread-writes", finch.BoolString(config.True(g.SpreadWrites)),
+		))
+	}
+	if s.cfg.DDL != nil {
+		fmt.Fprintf(w, "  DDL after %s, then workload for %s: %s\n", s.cfg.DDL.Delay, s.cfg.DDL.After, s.cfg.DDL.SQL)
+	}
+	return nil
+}
+
 func (s *Stage) Run(ctxFinch context.Context) {
 	// There are 3 levels of contexts:
 	//
@@ -125,6 +419,11 @@ func (s *Stage) Run(ctxFinch context.Context) {
 	// The ctxClients can end before the ctxStage if, for example, a client group
 	// is conifgured to run for less than the full stage runtime. Different client
 	// groups can also have different runtimes.
+	// Connect clients before the stage clock (runtime and stats) starts
+	if s.cfg.Preconnect {
+		s.preconnect(ctxFinch) // CTRL-C: clients return on Run
+	}
+
 	var ctxStage context.Context
 	var cancelStage context.CancelFunc
 	if s.cfg.Runtime != "" {
@@ -137,99 +436,356 @@ func (s *Stage) Run(ctxFinch context.Context) {
 		log.Printf("[%s] Running (no runtime limit)", s.cfg.Name)
 	}
 
+	start := time.Now()
 	if s.stats != nil {
 		s.stats.Start()
 	}
+	s.started = start
+	s.setRunning(true) // for Snapshot (SIGUSR1)
+	defer s.setRunning(false)
+	finch.SendEvent(finch.Event{Type: finch.EVENT_STAGE_START, RunLevel: finch.RunLevel{Stage: s.cfg.N, StageName: s.cfg.Name}})
 
-	if finch.CPUProfile != nil {
-		pprof.StartCPUProfile(finch.CPUProfile)
+	// TiDB status (config.stage.stats.tidb-status): sample at start, print
+	// at end after final stats. Only the first compute instance does this
+	// because it's the same for all instances.
+	if s.statusDb != nil {
+		tidbStart := s.tidbStatus(ctxFinch)
+		defer func() {
+			if tidbEnd := s.tidbStatus(context.Background()); tidbEnd != nil {
+				log.Printf("[%s] TiDB status:", s.cfg.Name)
+				for _, line := range tidbStatusReport(tidbStart, tidbEnd) {
+					fmt.Println(line)
+				}
+			}
+			s.statusDb.Close()
+		}()
 	}
 
-	for egNo := range s.execGroups { // ------------------------------------- execution groups
-		if ctxFinch.Err() != nil {
-			break
+	// Group Replication member stats (config.stage.group-replication): sample
+	// at start, print per-member throughput at end after final stats. Like TiDB
+	// status, only the first compute instance does this.
+	if s.grDb != nil {
+		grStart, err := grMemberStats(ctxFinch, s.grDb)
+		if err != nil {
+			log.Printf("[%s] Error reading Group Replication member stats: %s", s.cfg.Name, err)
 		}
-		nClients := 0
-		for cgNo := range s.execGroups[egNo] { // --------------------------- client groups
-			log.Printf("[%s] Execution group %d, client group %d, runnning %d clients", s.cfg.Name, egNo+1, cgNo+1, len(s.execGroups[egNo][cgNo].Clients))
-			nClients += len(s.execGroups[egNo][cgNo].Clients)
-			var ctxClients context.Context
-			var cancelClients context.CancelFunc
-			if s.execGroups[egNo][cgNo].Runtime > 0 {
-				// Client group runtime (plus stage runtime, if any)
-				finch.Debug("eg %d/%d exec %s", s.execGroups[egNo][cgNo].Runtime)
-				ctxClients, cancelClients = context.WithDeadline(ctxStage, time.Now().Add(s.execGroups[egNo][cgNo].Runtime))
-				defer cancelClients()
-			} else {
-				// Stage runtime limit, if any
-				finch.Debug("%d/%d no limit", egNo, cgNo)
-				ctxClients = ctxStage
+		defer func() {
+			grEnd, err := grMemberStats(context.Background(), s.grDb)
+			s.grDb.Close()
+			if err != nil {
+				log.Printf("[%s] Error reading Group Replication member stats: %s", s.cfg.Name, err)
+				return
 			}
-			for _, c := range s.execGroups[egNo][cgNo].Clients { // --------- clients
-				go c.Run(ctxClients)
+			log.Printf("[%s] Group Replication members:", s.cfg.Name)
+			for _, line := range grReport(grStart, grEnd, time.Since(start)) {
+				fmt.Println(line)
 			}
-		} // start all clients, then...
+		}()
+	}
 
-		clientErrors := make([]*client.Client, 0, nClients)
-	CLIENTS:
-		for nClients > 0 { // wait for clients
-			select {
-			case c := <-s.doneChan:
-				finch.Debug("%s done: %v", c.RunLevel, c.Error)
-				nClients -= 1
-				if c.Error.Err != nil {
-					clientErrors = append(clientErrors, c)
-				}
-			case <-ctxStage.Done():
-				finch.Debug("stage runtime elapsed")
-				break CLIENTS
-			case <-ctxFinch.Done():
-				finch.Debug("finch terminated")
-				break CLIENTS
+	// Stage exit conditions (config.stage.exit) for all clients
+	var cancelExit context.CancelFunc
+	if s.counters != nil {
+		ctxStage, cancelExit = context.WithCancel(ctxStage)
+		defer cancelExit()
+		go s.exit(ctxStage, cancelExit, start)
+	}
+
+	// Compute resource guardrails (config.stage.compute.max-cpu and max-gc-pause)
+	if s.guardrail != nil {
+		var cancelGuard context.CancelFunc
+		ctxStage, cancelGuard = context.WithCancel(ctxStage)
+		defer cancelGuard()
+		go s.guard(ctxStage, cancelGuard)
+	}
+
+	// Online DDL benchmark (config.stage.ddl): DDL runs in background, then it
+	// cancels the stage
+	var ddlChan chan ddlResult
+	var cancelDDL context.CancelFunc
+	if s.cfg.DDL != nil {
+		ctxStage, cancelDDL = context.WithCancel(ctxStage)
+		defer cancelDDL()
+		ddlChan = make(chan ddlResult, 1)
+		go s.ddl(ctxStage, cancelDDL, start, ddlChan)
+	}
+
+	if s.rows != nil {
+		ctxCheckpoint, cancelCheckpoint := context.WithCancel(ctxFinch)
+		defer func() {
+			cancelCheckpoint()
+			if err := s.writeCheckpoint(); err != nil {
+				log.Printf("[%s] Error writing checkpoint: %s", s.cfg.Name, err)
 			}
-		}
-		if nClients > 0 {
-			// spinWaitMs gives clients a _little_ time to finish when either
-			// context is cancelled. This must be done to avoid a data race in
-			// stats reporting: the CLIENTS loop finishes and stats are reported
-			// below while a client is still writing to those stats. (This is
-			// also due to fact that stats are lock-free.) So when a context is
-			// cancelled, start sleeping 1ms and decrementing spinWaitMs which
-			// lets this for loop continue (spin) but also timeout quickly.
-			finch.Debug("spin wait for %d clients", nClients)
-			spinWaitMs := 10
-			for spinWaitMs > 0 && nClients > 0 {
-				select {
-				case c := <-s.doneChan:
-					finch.Debug("%s done: %v", c.RunLevel, c.Error)
-					nClients -= 1
-					if c.Error.Err != nil {
-						clientErrors = append(clientErrors, c)
-					}
-				default:
-					time.Sleep(1 * time.Millisecond)
-					spinWaitMs -= 1
-				}
+		}()
+		go s.checkpoints(ctxCheckpoint)
+	}
+
+	if s.progress != nil {
+		freq, _ := time.ParseDuration(s.cfg.Progress) // already validated
+		for _, p := range s.progress {
+			if p != nil && p.runtime > 0 {
+				p.stageEnd = start.Add(p.runtime)
 			}
 		}
-		if nClients > 0 {
-			log.Printf("[%s] WARNING: %d clients did not stop, statistics are not accurate", s.cfg.Name, nClients)
+		ctxProgress, cancelProgress := context.WithCancel(ctxStage)
+		defer cancelProgress()
+		go s.reportProgress(ctxProgress, freq)
+	}
+
+	// Failover awareness (config.stage.failover): watch for DNS flips of the
+	// MySQL hostname
+	var flipsChan chan uint
+	var cancelDNS context.CancelFunc
+	if s.failover != nil {
+		if host := failoverHost(s.cfg.MySQL.Hostname); host != "" && s.cfg.Failover.DNSFreq != "0" {
+			freq, _ := time.ParseDuration(s.cfg.Failover.DNSFreq) // already validated
+			var ctxDNS context.Context
+			ctxDNS, cancelDNS = context.WithCancel(ctxStage)
+			defer cancelDNS()
+			flipsChan = make(chan uint, 1)
+			go s.watchDNS(ctxDNS, host, freq, flipsChan)
+		}
+	}
+
+	if finch.CPUProfile != nil {
+		pprof.StartCPUProfile(finch.CPUProfile)
+	}
+
+	// Exec groups run sequentially unless start-after is set, in which case the
+	// exec group starts that long after the stage starts and runs concurrently
+	// with the other exec groups. running is the number of clients not done in
+	// each exec group; only this goroutine (via wait) modifies it.
+	running := make([]int, len(s.execGroups))
+	concurrent := []int{}
+	for egNo := range s.execGroups {
+		for cgNo := range s.execGroups[egNo] {
+			running[egNo] += len(s.execGroups[egNo][cgNo].Clients)
 		}
-		if len(clientErrors) > 0 {
-			log.Printf("%d client errors:\n", len(clientErrors))
-			for _, c := range clientErrors {
-				log.Printf("  %s: %s (%s)", c.RunLevel.ClientId(), c.Error.Err, c.Statements[c.Error.StatementNo].Query)
+		if s.execGroups[egNo][0].Concurrent {
+			if len(concurrent) == 0 {
+				var cancelRun context.CancelFunc
+				ctxStage, cancelRun = context.WithCancel(ctxStage)
+				defer cancelRun() // startAfter
 			}
+			concurrent = append(concurrent, egNo)
+			go s.startAfter(ctxStage, egNo)
+		}
+	}
+
+	for egNo := range s.execGroups { // ------------------------------------- execution groups
+		if s.execGroups[egNo][0].Concurrent {
+			continue // startAfter ^
+		}
+		if ctxFinch.Err() != nil || finch.Stopped(ctxFinch) {
+			break
+		}
+		for _, cancel := range s.start(ctxStage, egNo) {
+			defer cancel()
 		}
+		s.wait(ctxFinch, ctxStage, running, func() int { return running[egNo] })
+	}
+
+	if len(concurrent) > 0 {
+		s.wait(ctxFinch, ctxStage, running, func() int {
+			n := 0
+			for _, egNo := range concurrent {
+				n += running[egNo]
+			}
+			return n
+		})
 	}
 
 	if finch.CPUProfile != nil {
 		pprof.StopCPUProfile()
 	}
 
+	if cancelExit != nil {
+		cancelExit()
+	}
+
+	// Clients can finish before the DDL (e.g. iter limit), so stop it and wait
+	// for it to return before final stats because it collects stats, too
+	var ddl ddlResult
+	if ddlChan != nil {
+		cancelDDL()
+		ddl = <-ddlChan
+	}
+
 	if s.stats != nil {
 		if !s.stats.Stop(3*time.Second, ctxFinch.Err() != nil) {
 			log.Printf("\n[%s] Timeout waiting for final statistics, reported values are incomplete", s.cfg.Name)
 		}
 	}
+	ddl.report(s.cfg.Name)
+
+	if s.failover != nil {
+		flips := "DNS not watched"
+		if flipsChan != nil {
+			cancelDNS()
+			flips = fmt.Sprintf("%d DNS flips", <-flipsChan)
+		}
+		n, total, max := s.failover.Downtime()
+		log.Printf("[%s] Failover: %s, %d client downtimes, total %s, max %s", s.cfg.Name, flips, n, total.Round(time.Millisecond), max.Round(time.Millisecond))
+	}
+
+	s.handoff(ctxFinch.Err() == nil)
+	finch.SendEvent(finch.Event{Type: finch.EVENT_STAGE_DONE, RunLevel: finch.RunLevel{Stage: s.cfg.N, StageName: s.cfg.Name}})
+}
+
+// start starts all clients in the exec group. Clients in each client group
+// share a ctx that ends when the client group runtime elapses, if any, or when
+// ctxStage ends. The caller must call the returned cancel funcs.
+func (s *Stage) start(ctxStage context.Context, egNo int) []context.CancelFunc {
+	cancel := []context.CancelFunc{}
+	if p := s.egProgress(egNo); p != nil {
+		p.start.Store(time.Now().UnixNano())
+	}
+	for cgNo := range s.execGroups[egNo] { // ------------------------------- client groups
+		log.Printf("[%s] Execution group %d, client group %d, runnning %d clients", s.cfg.Name, egNo+1, cgNo+1, len(s.execGroups[egNo][cgNo].Clients))
+		var ctxClients context.Context
+		var cancelClients context.CancelFunc
+		if s.execGroups[egNo][cgNo].Runtime > 0 {
+			// Client group runtime (plus stage runtime, if any)
+			finch.Debug("eg %d/%d runtime %s", egNo, cgNo, s.execGroups[egNo][cgNo].Runtime)
+			ctxClients, cancelClients = context.WithDeadline(ctxStage, time.Now().Add(s.execGroups[egNo][cgNo].Runtime))
+			cancel = append(cancel, cancelClients)
+		} else {
+			// Stage runtime limit, if any
+			finch.Debug("%d/%d no limit", egNo, cgNo)
+			ctxClients = ctxStage
+		}
+		for _, c := range s.execGroups[egNo][cgNo].Clients { // ------------- clients
+			go c.Run(ctxClients)
+		}
+	}
+	return cancel
+}
+
+// startAfter starts the exec group after workload.start-after. If the stage
+// ends first, the clients are still started so they return immediately and
+// Run receives them like any other client that stopped.
+func (s *Stage) startAfter(ctxStage context.Context, egNo int) {
+	d := s.execGroups[egNo][0].StartAfter
+	if d > 0 {
+		log.Printf("[%s] Execution group %d starts after %s", s.cfg.Name, egNo+1, d)
+		select {
+		case <-time.After(d):
+		case <-ctxStage.Done():
+		}
+	}
+	cancel := s.start(ctxStage, egNo)
+	<-ctxStage.Done() // Run cancels it on return
+	for i := range cancel {
+		cancel[i]()
+	}
+}
+
+// wait waits for clients to finish until remaining returns zero or ctxStage or
+// ctxFinch ends. Clients from any exec group can finish while waiting, so each
+// one is counted in running by its exec group.
+func (s *Stage) wait(ctxFinch, ctxStage context.Context, running []int, remaining func() int) {
+	clientErrors := []*client.Client{}
+	done := func(c *client.Client) {
+		finch.Debug("%s done: %v", c.RunLevel, c.Error)
+		running[c.RunLevel.ExecGroup-1] -= 1
+		if p := s.egProgress(int(c.RunLevel.ExecGroup - 1)); p != nil && running[c.RunLevel.ExecGroup-1] == 0 {
+			p.done.Store(true)
+		}
+		if c.Error.Err != nil {
+			clientErrors = append(clientErrors, c)
+		}
+	}
+CLIENTS:
+	for remaining() > 0 { // wait for clients
+		select {
+		case c := <-s.doneChan:
+			done(c)
+		case <-ctxStage.Done():
+			finch.Debug("stage runtime elapsed")
+			break CLIENTS
+		case <-ctxFinch.Done():
+			finch.Debug("finch terminated")
+			break CLIENTS
+		}
+	}
+	if remaining() > 0 {
+		// spinWaitMs gives clients a _little_ time to finish when either
+		// context is cancelled. This must be done to avoid a data race in
+		// stats reporting: the CLIENTS loop finishes and stats are reported
+		// below while a client is still writing to those stats. (This is
+		// also due to fact that stats are lock-free.) So when a context is
+		// cancelled, start sleeping 1ms and decrementing spinWaitMs which
+		// lets this for loop continue (spin) but also timeout quickly.
+		finch.Debug("spin wait for %d clients", remaining())
+		spinWaitMs := 10
+		for spinWaitMs > 0 && remaining() > 0 {
+			select {
+			case c := <-s.doneChan:
+				done(c)
+			default:
+				time.Sleep(1 * time.Millisecond)
+				spinWaitMs -= 1
+			}
+		}
+	}
+	if n := remaining(); n > 0 {
+		log.Printf("[%s] WARNING: %d clients did not stop, statistics are not accurate", s.cfg.Name, n)
+	}
+	if len(clientErrors) > 0 {
+		finch.Fail(finch.EXIT_CLIENT_ERROR)
+		log.Printf("%d client errors:\n", len(clientErrors))
+		for _, c := range clientErrors {
+			log.Printf("  %s: %s %s", c.RunLevel.ClientId(), c.Error.Err, c.ErrorContext())
+		}
+	}
+}
+
+// Rebalance sets this compute instance to be instance i of n running the stage
+// when config.stage.compute.Share() is true (elastic or on-lost: reassign), so
+// it runs 1/n of the clients in each client group. The server calls it when
+// compute instances join, leave, or are lost.
+func (s *Stage) Rebalance(i, n uint) {
+	if s.share == nil {
+		return
+	}
+	if pi, pn := s.share.Get(); pi == i && pn == n {
+		return
+	}
+	s.share.Set(i, n)
+	log.Printf("[%s] Rebalanced: compute instance %d of %d", s.cfg.Name, i+1, n)
+}
+
+// Pause pauses or resumes all clients: paused clients idle between iterations.
+// The server calls it from the control API (POST /control/pause|resume).
+func (s *Stage) Pause(paused bool) {
+	if !s.pause.Set(paused) {
+		return
+	}
+	if paused {
+		log.Printf("[%s] Paused", s.cfg.Name)
+	} else {
+		log.Printf("[%s] Resumed", s.cfg.Name)
+	}
+}
+
+// targetNames returns the target names sorted so connections are tested and
+// logged in the same order every run.
+func targetNames(targets map[string]config.MySQL) []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// saveLimits returns config.stage.save-limits, or the default max-memory if not
+// set. Values are already validated.
+func saveLimits(c *config.SaveLimits) (maxRows uint, maxMemory uint64) {
+	if c == nil {
+		c = &config.SaveLimits{MaxMemory: config.DEFAULT_SAVE_MAX_MEMORY}
+	}
+	maxMemory, _ = human.ParseBytes(c.MaxMemory)
+	return finch.Uint(c.MaxRows), maxMemory
 }
@@ -2,8 +2,12 @@ package stage
 
 import (
 	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/square/finch"
 	"github.com/square/finch/config"
 	"github.com/square/finch/data"
 	"github.com/square/finch/test"
@@ -54,3 +58,87 @@ func TestPreapre_NoWorkload(t *testing.T) {
 		t.Fatalf("got %d clients, expected 1", len(s.execGroups[0]))
 	}
 }
+
+func TestFlavorErrors(t *testing.T) {
+	// Flavor maps are mutually exclusive: only the map for mysql.flavor is
+	// merged, so a code in two maps (like 9001 for tidb and proxysql) is
+	// handled by the flags of the flavor's map
+	for flavor, errs := range flavorErrors {
+		m := finch.ErrorHandling(errs)
+		for other, otherErrs := range flavorErrors {
+			if other == flavor {
+				continue
+			}
+			for code := range otherErrs {
+				_, mysql := finch.MySQLErrorHandling[code]
+				flags, own := errs[code]
+				if !mysql && !own {
+					if _, ok := m[code]; ok {
+						t.Errorf("flavor %s handles %s error %d", flavor, other, code)
+					}
+				} else if own && m[code] != flags {
+					t.Errorf("flavor %s error %d flags = %d, expected %d", flavor, code, m[code], flags)
+				}
+			}
+		}
+	}
+}
+
+func TestRun_SQLite(t *testing.T) {
+	// Finch includes a SQLite driver (dbconn/drivers.go), so a stage with
+	// mysql.flavor: sqlite runs trx files against an in-memory database
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	dir := t.TempDir()
+	files := map[string]string{
+		"stage.yaml": `stage:
+  name: sqlite
+  mysql:
+    flavor: sqlite
+    dsn: "file:finch-test?mode=memory&cache=shared"
+  workload:
+    - trx: [schema.sql]
+    - trx: [rows.sql]
+      iter: 3
+  trx:
+    - file: schema.sql
+    - file: rows.sql
+      data:
+        id:
+          generator: auto-inc
+`,
+		"schema.sql": "CREATE TABLE t (id INT PRIMARY KEY, c INT)\n",
+		"rows.sql":   "INSERT INTO t VALUES (@id, 1)\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stages, err := config.Load([]string{filepath.Join(dir, "stage.yaml")}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(dir) // like compute.Server
+
+	// Keep the in-memory database open until the test checks it
+	db, err := sql.Open("sqlite", stages[0].MySQL.DSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := New(stages[0], data.NewScope(), nil)
+	if err := s.Prepare(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Run(context.Background())
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d rows, expected 3", n)
+	}
+}
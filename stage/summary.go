@@ -0,0 +1,132 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/square/finch"
+	"github.com/square/finch/replay"
+	"github.com/square/finch/trx"
+	"github.com/square/finch/workload"
+)
+
+// SUMMARY_MAX_QUERY is the max length of a fingerprint in the statement summary
+// unless verbose (--verbose).
+const SUMMARY_MAX_QUERY = 60
+
+// printSummary prints a table of every statement in the stage: where it's
+// defined, its kind, prepare mode, the number of clients assigned its trx, its
+// data keys and their scopes, and its fingerprint. It's printed at stage start
+// and by --dry-run so misconfigured scopes or assignments can be spotted before
+// they cause weird results. If verbose, fingerprints are not truncated and data
+// keys include the generator.
+func printSummary(w io.Writer, a workload.Allocator, groups [][]int, clients [][]workload.ClientGroup, verbose bool) {
+	// Clients assigned each trx
+	nClients := map[string]int{}
+	for egNo := range groups {
+		for cgNo, refNo := range groups[egNo] {
+			for _, trxName := range a.Workload[refNo].Trx {
+				nClients[trxName] += len(clients[egNo][cgNo].Clients)
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 1, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TRX\tSTATEMENT\tKIND\tPREPARE\tCLIENTS\tDATA KEYS (SCOPE)\tFINGERPRINT")
+	for _, trxName := range a.TrxSet.Order {
+		if _, ok := nClients[trxName]; !ok {
+			continue // not assigned in workload
+		}
+		for _, s := range a.TrxSet.Statements[trxName] {
+			fmt.Fprintf(tw, "  %s\t%s:%d\t%s\t%s\t%d\t%s\t%s\n",
+				trxName,
+				filepath.Base(s.File), s.Line,
+				statementKind(s),
+				prepareMode(s),
+				nClients[trxName],
+				dataKeys(a, s, verbose),
+				fingerprint(s, verbose),
+			)
+		}
+	}
+	tw.Flush()
+}
+
+func statementKind(s *trx.Statement) string {
+	switch {
+	case s.Idle != 0:
+		return "idle"
+	case s.DDL:
+		return "ddl"
+	case s.Begin:
+		return "begin"
+	case s.Commit:
+		return "commit"
+	case s.Write: // before ResultSet for INSERT ... RETURNING
+		return "write"
+	case s.ResultSet:
+		return "read"
+	}
+	return "other"
+}
+
+func prepareMode(s *trx.Statement) string {
+	switch {
+	case s.PrepareMulti > 0:
+		return fmt.Sprintf("multi %d", s.PrepareMulti)
+	case s.Prepare:
+		return "yes"
+	}
+	return "no"
+}
+
+// dataKeys returns the input and output data keys of the statement with their
+// scopes, like "@id (client)", or "-" if none. Output keys (save-columns and
+// save-insert-id) are prefixed "=>".
+func dataKeys(a workload.Allocator, s *trx.Statement, verbose bool) string {
+	keys := []string{}
+	seen := map[string]bool{}
+	add := func(prefix, name string) {
+		name = strings.TrimSuffix(name, "()")
+		if name == finch.NOOP_COLUMN || seen[prefix+name] {
+			return
+		}
+		seen[prefix+name] = true
+		k, ok := a.TrxSet.Data.Keys[name]
+		if !ok || name == "@PREV" {
+			keys = append(keys, prefix+name)
+			return
+		}
+		if verbose && k.Generator != nil {
+			keys = append(keys, fmt.Sprintf("%s%s (%s, %s)", prefix, name, k.Scope, k.Generator.Name()))
+		} else {
+			keys = append(keys, fmt.Sprintf("%s%s (%s)", prefix, name, k.Scope))
+		}
+	}
+	for _, name := range s.Inputs {
+		add("", name)
+	}
+	for _, name := range s.Outputs {
+		add("=>", name)
+	}
+	if len(keys) == 0 {
+		return "-"
+	}
+	return strings.Join(keys, ", ")
+}
+
+func fingerprint(s *trx.Statement, verbose bool) string {
+	if s.Idle != 0 {
+		return "-- idle: " + s.Idle.String()
+	}
+	fp, _ := replay.Fingerprint(s.Query)
+	if !verbose && len(fp) > SUMMARY_MAX_QUERY {
+		fp = fp[:SUMMARY_MAX_QUERY-3] + "..."
+	}
+	return fp
+}
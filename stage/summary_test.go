@@ -0,0 +1,56 @@
+package stage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/finch/client"
+	"github.com/square/finch/config"
+	"github.com/square/finch/data"
+	"github.com/square/finch/trx"
+	"github.com/square/finch/workload"
+)
+
+func TestPrintSummary(t *testing.T) {
+	scope := data.NewScope()
+	scope.Keys["@id"] = data.Key{Name: "@id", Trx: "t1.sql", Scope: "client"}
+	set := &trx.Set{
+		Order: []string{"t1.sql", "t2.sql"},
+		Statements: map[string][]*trx.Statement{
+			"t1.sql": {
+				{Trx: "t1.sql", File: "/tmp/t1.sql", Line: 1, Query: "SELECT c\n  FROM t WHERE id = ?", ResultSet: true, Prepare: true, Inputs: []string{"@id"}},
+				{Trx: "t1.sql", File: "/tmp/t1.sql", Line: 3, Idle: time.Second},
+				{Trx: "t1.sql", File: "/tmp/t1.sql", Line: 5, Query: "INSERT INTO t VALUES (NULL, 'abc')", Write: true, Outputs: []string{"@new"}, InsertId: "@new"},
+			},
+			"t2.sql": { // not assigned
+				{Trx: "t2.sql", File: "/tmp/t2.sql", Line: 1, Query: "SELECT 1", ResultSet: true},
+			},
+		},
+		Data: scope,
+	}
+	a := workload.Allocator{
+		TrxSet:   set,
+		Workload: []config.ClientGroup{{Trx: []string{"t1.sql"}}},
+	}
+	groups := [][]int{{0}}
+	clients := [][]workload.ClientGroup{{{Clients: []*client.Client{{}, {}}}}}
+
+	var buf strings.Builder
+	printSummary(&buf, a, groups, clients, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, expected header and 3 statements:\n%s", len(lines), buf.String())
+	}
+	expect := [][]string{
+		{"t1.sql", "t1.sql:1", "read", "yes", "2", "@id", "(client)", "SELECT", "c", "FROM", "t", "WHERE", "id", "=", "?"},
+		{"t1.sql", "t1.sql:3", "idle", "no", "2", "-", "--", "idle:", "1s"},
+		{"t1.sql", "t1.sql:5", "write", "no", "2", "=>@new", "INSERT", "INTO", "t", "VALUES", "(NULL,", "?)"},
+	}
+	for i := range expect {
+		got := strings.Fields(lines[i+1])
+		if strings.Join(got, " ") != strings.Join(expect[i], " ") {
+			t.Errorf("line %d: got %q, expected %q", i+1, got, expect[i])
+		}
+	}
+}
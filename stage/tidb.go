@@ -0,0 +1,69 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tidbStatusVar returns true for TiDB-specific status variables sampled by
+// config.stage.stats.tidb-status: GC (tidb_gc_*) and schema version, which
+// explain performance changes during a stage that MySQL never has.
+func tidbStatusVar(name string) bool {
+	return strings.HasPrefix(name, "tidb_") || name == "ddl_schema_version"
+}
+
+// tidbStatus returns the TiDB status variables, or nil on error (it's logged
+// because the status is informational and doesn't affect the stage).
+func (s *Stage) tidbStatus(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	rows, err := s.statusDb.QueryContext(ctx, "SHOW GLOBAL STATUS")
+	if err != nil {
+		log.Printf("[%s] Error reading TiDB status: %s", s.cfg.Name, err)
+		return nil
+	}
+	defer rows.Close()
+	vars := map[string]string{}
+	for rows.Next() {
+		var name string
+		var val sql.NullString
+		if err := rows.Scan(&name, &val); err != nil {
+			log.Printf("[%s] Error reading TiDB status: %s", s.cfg.Name, err)
+			return nil
+		}
+		if tidbStatusVar(name) {
+			vars[name] = val.String
+		}
+	}
+	return vars
+}
+
+// tidbStatusReport returns one line for each TiDB status variable: its value
+// at stage start, and its value at stage end if changed.
+func tidbStatusReport(start, end map[string]string) []string {
+	names := make([]string, 0, len(end))
+	for name := range end {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		v0, ok := start[name]
+		switch {
+		case !ok:
+			lines[i] = fmt.Sprintf("  %s: %s", name, end[name])
+		case v0 != end[name]:
+			lines[i] = fmt.Sprintf("  %s: %s -> %s", name, v0, end[name])
+		default:
+			lines[i] = fmt.Sprintf("  %s: %s (unchanged)", name, v0)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,30 @@
+package stage
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestTiDBStatusReport(t *testing.T) {
+	start := map[string]string{
+		"ddl_schema_version":    "52",
+		"tidb_gc_last_run_time": "20241015-10:00:00",
+	}
+	end := map[string]string{
+		"ddl_schema_version":    "53",
+		"tidb_gc_last_run_time": "20241015-10:00:00",
+		"tidb_gc_safe_point":    "20241015-09:50:00",
+	}
+	expect := []string{
+		"  ddl_schema_version: 52 -> 53",
+		"  tidb_gc_last_run_time: 20241015-10:00:00 (unchanged)",
+		"  tidb_gc_safe_point: 20241015-09:50:00",
+	}
+	if diff := deep.Equal(tidbStatusReport(start, end), expect); diff != nil {
+		t.Error(diff)
+	}
+	if tidbStatusVar("Uptime") || !tidbStatusVar("tidb_gc_leader_desc") {
+		t.Error("wrong tidbStatusVar")
+	}
+}
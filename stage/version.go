@@ -0,0 +1,55 @@
+// Copyright 2024 Block, Inc.
+
+package stage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/square/finch/config"
+)
+
+// serverVersion returns the server flavor (config.FLAVOR_* const) and version
+// detected from @@version. See parseVersion. SQLite and ClickHouse have no
+// @@version, so they're detected from the configured flavor.
+func serverVersion(ctx context.Context, db *sql.DB, cfgFlavor string) (flavor, version string, err error) {
+	var v string
+	switch cfgFlavor {
+	case config.FLAVOR_SQLITE:
+		if err := db.QueryRowContext(ctx, "SELECT sqlite_version()").Scan(&v); err != nil {
+			return "", "", err
+		}
+		return config.FLAVOR_SQLITE, "SQLite " + v, nil
+	case config.FLAVOR_CLICKHOUSE:
+		if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&v); err != nil {
+			return "", "", err
+		}
+		return config.FLAVOR_CLICKHOUSE, "ClickHouse " + v, nil
+	}
+	if err := db.QueryRowContext(ctx, "SELECT @@version").Scan(&v); err != nil {
+		return "", "", err
+	}
+	flavor, version = parseVersion(v)
+	return flavor, version, nil
+}
+
+// parseVersion returns the server flavor and version from @@version, like
+// "10.11.6-MariaDB-1:10.11.6+maria~ubu2204" returns mariadb, "MariaDB 10.11.6".
+// TiDB and Vitess report a MySQL version followed by their own, like
+// "8.0.11-TiDB-v7.5.0". ProxySQL reports the backend version, so it's detected
+// as MySQL (or MariaDB).
+func parseVersion(v string) (flavor, version string) {
+	mysql, _, _ := strings.Cut(v, "-")
+	if _, tidb, ok := strings.Cut(v, "-TiDB-"); ok {
+		tidb, _, _ = strings.Cut(tidb, "-")
+		return config.FLAVOR_TIDB, "TiDB " + tidb
+	}
+	switch {
+	case strings.Contains(v, "-MariaDB"):
+		return config.FLAVOR_MARIADB, "MariaDB " + mysql
+	case strings.Contains(v, "-Vitess"):
+		return config.FLAVOR_VITESS, "Vitess (MySQL " + mysql + ")"
+	}
+	return config.FLAVOR_MYSQL, "MySQL " + mysql
+}
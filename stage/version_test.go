@@ -0,0 +1,28 @@
+package stage
+
+import (
+	"testing"
+
+	"github.com/square/finch/config"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		v       string
+		flavor  string
+		version string
+	}{
+		{"8.0.36", config.FLAVOR_MYSQL, "MySQL 8.0.36"},
+		{"8.0.36-28", config.FLAVOR_MYSQL, "MySQL 8.0.36"}, // Percona Server
+		{"10.11.6-MariaDB-1:10.11.6+maria~ubu2204", config.FLAVOR_MARIADB, "MariaDB 10.11.6"},
+		{"11.4.2-MariaDB-log", config.FLAVOR_MARIADB, "MariaDB 11.4.2"},
+		{"8.0.11-TiDB-v7.5.0", config.FLAVOR_TIDB, "TiDB v7.5.0"},
+		{"8.0.30-Vitess", config.FLAVOR_VITESS, "Vitess (MySQL 8.0.30)"},
+	}
+	for _, test := range tests {
+		flavor, version := parseVersion(test.v)
+		if flavor != test.flavor || version != test.version {
+			t.Errorf("parseVersion(%s) = %s, %s; expected %s, %s", test.v, flavor, version, test.flavor, test.version)
+		}
+	}
+}
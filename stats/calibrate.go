@@ -0,0 +1,94 @@
+// Copyright 2024 Block, Inc.
+
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Calibration is client-side noise measured on the compute when the stage
+// starts: the smallest measurable time, how late the scheduler wakes a sleeping
+// goroutine, and the fastest round trip to MySQL. Sub-millisecond response
+// times are only meaningful relative to these. See Calibrate.
+type Calibration struct {
+	Timer     time.Duration `json:"timer"`      // smallest nonzero clock increment
+	Jitter    time.Duration `json:"jitter"`     // median scheduler wake-up delay
+	JitterMax time.Duration `json:"jitter_max"` // max scheduler wake-up delay
+	RoundTrip time.Duration `json:"round_trip"` // fastest SELECT 1; 0 if not measured
+}
+
+func (c Calibration) String() string {
+	rt := "not measured"
+	if c.RoundTrip > 0 {
+		rt = c.RoundTrip.String()
+	}
+	return fmt.Sprintf("timer %s, scheduler jitter %s (max %s), SELECT 1 round trip %s",
+		c.Timer, c.Jitter, c.JitterMax, rt)
+}
+
+const (
+	calibrateTimerSamples = 10000
+	calibrateSleep        = time.Millisecond
+	calibrateSleepSamples = 50
+	calibrateQuerySamples = 50
+)
+
+// Calibrate measures a Calibration. If db is not nil, it executes SELECT 1 on
+// one connection to measure the round trip floor: driver, network, and server
+// overhead without any work. It takes about 100ms plus the round trips.
+func Calibrate(ctx context.Context, db *sql.DB) (Calibration, error) {
+	var c Calibration
+
+	// Timer resolution: smallest nonzero difference between consecutive reads
+	// of the monotonic clock (MonotonicClock is whole microseconds, so this is
+	// the resolution of the underlying clock, not the Clock)
+	start := time.Now()
+	last := time.Since(start)
+	for i := 0; i < calibrateTimerSamples; i++ {
+		now := time.Since(start)
+		if d := now - last; d > 0 && (c.Timer == 0 || d < c.Timer) {
+			c.Timer = d
+		}
+		last = now
+	}
+
+	// Scheduler jitter: how much longer than requested a sleep takes
+	late := make([]time.Duration, calibrateSleepSamples)
+	for i := range late {
+		t := time.Now()
+		time.Sleep(calibrateSleep)
+		late[i] = time.Since(t) - calibrateSleep
+	}
+	sort.Slice(late, func(i, j int) bool { return late[i] < late[j] })
+	c.Jitter = late[len(late)/2]
+	c.JitterMax = late[len(late)-1]
+
+	if db == nil {
+		return c, nil
+	}
+
+	// Round trip floor: fastest SELECT 1 on one connection, after a warm-up
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return c, err
+	}
+	defer conn.Close()
+	var n int
+	if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil {
+		return c, err
+	}
+	for i := 0; i < calibrateQuerySamples; i++ {
+		t := time.Now()
+		if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil {
+			return c, err
+		}
+		if d := time.Since(t); c.RoundTrip == 0 || d < c.RoundTrip {
+			c.RoundTrip = d
+		}
+	}
+	return c, nil
+}
@@ -5,6 +5,7 @@ package stats
 import (
 	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 
@@ -14,6 +15,11 @@ import (
 
 var Now func() time.Time = time.Now
 
+// FlushFreq is how often the Collector flushes client stats (see Trx). The ring
+// buffer holds 4096 events, so a client can record 400k events/s before it has
+// to flush the ring itself.
+var FlushFreq = 10 * time.Millisecond
+
 // Instance stats are per trx and total (all trx) stats from all clients on a
 // local or report instance. N-many instances constitute an interval of N instance
 // stats. Collector.Recv waits for stats to complete each interval before reporting.
@@ -25,6 +31,9 @@ type Instance struct {
 	Runtime  float64           // total elapsed seconds of benchmark
 	Total    *Stats            // all trx stats combined
 	Trx      map[string]*Stats // per trx stats
+
+	ClientBound []string // "host: reason" if compute was client-bound (Guard)
+	Util        float64  // load generator utilization (see utilization)
 }
 
 func NewInstance(hostname string) Instance {
@@ -35,7 +44,8 @@ func NewInstance(hostname string) Instance {
 	}
 }
 
-// Combine combines instance stats for the same interval.
+// Combine combines instance stats for the same interval. Total and trx stats
+// are combined by merging histograms, so percentiles are correct for all instances.
 func (in *Instance) Combine(from []Instance) {
 	in.Hostname = fmt.Sprintf("(%d combined)", len(from))
 	in.Clients = from[0].Clients
@@ -47,13 +57,73 @@ func (in *Instance) Combine(from []Instance) {
 		in.Total.Combine(from[1+i].Total)
 		in.Clients += from[1+i].Clients
 	}
+	in.ClientBound = nil
+	in.Util = 0
+	for i := range from {
+		in.ClientBound = addFlags(in.ClientBound, from[i].ClientBound)
+		if from[i].Util > in.Util {
+			in.Util = from[i].Util // busiest compute
+		}
+	}
+	in.Trx = map[string]*Stats{}
+	for i := range from {
+		for name, s := range from[i].Trx {
+			if _, ok := in.Trx[name]; !ok {
+				in.Trx[name] = NewStats()
+				in.Trx[name].Copy(s)
+				continue
+			}
+			in.Trx[name].Combine(s)
+		}
+	}
+}
+
+// Add adds stats from the next interval of the same instance to make totals for
+// all intervals. Cumulative stats span the whole runtime (Seconds == Runtime),
+// so they replace the totals. Trx stats are not added.
+func (in *Instance) Add(next Instance) {
+	if in.Interval == 0 || next.Seconds == next.Runtime {
+		in.Total.Copy(next.Total)
+		in.Seconds = next.Seconds
+		in.Util = next.Util
+	} else {
+		in.Total.Combine(next.Total)
+		if s := in.Seconds + next.Seconds; s > 0 {
+			in.Util = math.Round((in.Util*in.Seconds + next.Util*next.Seconds) / s) // time-weighted
+		}
+		in.Seconds += next.Seconds
+	}
+	in.Interval = next.Interval
+	in.Runtime = next.Runtime
+	if next.Clients > in.Clients {
+		in.Clients = next.Clients
+	}
+	in.ClientBound = addFlags(in.ClientBound, next.ClientBound)
+}
+
+// addFlags returns flags plus the flags in add that it doesn't already have.
+func addFlags(flags, add []string) []string {
+NEXT:
+	for _, f := range add {
+		for i := range flags {
+			if flags[i] == f {
+				continue NEXT
+			}
+		}
+		flags = append(flags, f)
+	}
+	return flags
 }
 
 // Collector collects and reports stats from local and remote instances.
 // If config.stats.freq is set, stats are collected/reported at that frequency.
 // Else, they're collected/reported once when the stage finishes and calls Stop.
+// If config.stats.cumulative is true, stats are not reset each interval, so each
+// report is all stats since the stage started.
 type Collector struct {
 	Freq       time.Duration
+	Cumulative bool
+	Guard      *Guard     // flags client-bound intervals; nil if disabled
 	trx        [][]*Trx   // lock-free trx stats per client
 	stats      [][]*Stats // stats per trx (per client)
 	local      Instance   // local instance stats
@@ -64,12 +134,17 @@ type Collector struct {
 	last       time.Time // when Collect was last called
 	reporters  []Reporter
 	finalChan  chan struct{}
+	flushStop  chan struct{} // stop flushing goroutine in Start
+	clock      *CoarseClock  // nil unless config.stats.clock: coarse
+	cpu        time.Duration // cpuTime when Collect was last called (Util)
+	cpuStart   time.Duration // cpuTime when Start was called (cumulative Util)
 
 	*sync.Mutex
 	intervalNo uint       // current interval being filled
 	interval   []Instance // all Instance stats
 	n          uint       // index in interval
 	reported   time.Time  // when Report was last called
+	live       *Live      // last reported interval from all instances
 }
 
 func NewCollector(cfg config.Stats, hostname string, nInstances uint) (*Collector, error) {
@@ -81,8 +156,21 @@ func NewCollector(cfg config.Stats, hostname string, nInstances uint) (*Collecto
 		return nil, err
 	}
 
+	var clock *CoarseClock
+	var res time.Duration
+	if cfg.Clock == config.CLOCK_COARSE {
+		res, _ = time.ParseDuration(cfg.ClockResolution) // already validated
+		clock = NewCoarseClock(res)
+	}
+	for _, r := range reporters {
+		if cr, ok := r.(ClockReporter); ok {
+			cr.SetClock(cfg.Clock, res)
+		}
+	}
+
 	return &Collector{
 		Freq:       freq,
+		Cumulative: config.True(cfg.Cumulative),
 		stopChan:   make(chan struct{}),
 		doneChan:   make(chan struct{}),
 		local:      NewInstance(hostname),
@@ -91,10 +179,20 @@ func NewCollector(cfg config.Stats, hostname string, nInstances uint) (*Collecto
 		reporters:  reporters,
 		intervalNo: 1,
 		finalChan:  make(chan struct{}),
+		clock:      clock,
 		Mutex:      &sync.Mutex{},
 	}, nil
 }
 
+// Clock returns the Clock for clients to measure response time: the coarse
+// clock if config.stats.clock is coarse, else the monotonic clock.
+func (c *Collector) Clock() Clock {
+	if c.clock != nil {
+		return c.clock.Now
+	}
+	return MonotonicClock
+}
+
 // Watch all trx stats from one client. This must be called for each Client
 // because it determines what Collect collects.
 func (c *Collector) Watch(trx []*Trx) {
@@ -136,6 +234,32 @@ func (c *Collector) Start() {
 	now := Now()
 	c.start = now
 	c.last = now
+	c.cpu = cpuTime()
+	c.cpuStart = c.cpu
+
+	if c.clock != nil {
+		c.clock.Start() // stopped in Stop
+	}
+
+	// Flush trx stats ring buffers (see Trx) off the clients' critical path
+	c.flushStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(FlushFreq)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for i := range c.trx {
+					for j := range c.trx[i] {
+						c.trx[i][j].Flush()
+					}
+				}
+			case <-c.flushStop:
+				return
+			}
+		}
+	}()
+
 	if c.Freq == 0 {
 		return
 	}
@@ -226,6 +350,13 @@ func (c *Collector) Stop(timeout time.Duration, terminated bool) bool {
 		until Report returns true, which means all stats received and reported.
 	*/
 
+	if c.clock != nil {
+		c.clock.Stop()
+	}
+	if c.flushStop != nil {
+		close(c.flushStop) // Collect flushes (Trx.Swap)
+	}
+
 	reported := false
 	var lastReported time.Duration
 	if c.Freq == 0 {
@@ -292,13 +423,23 @@ STOP:
 func (c *Collector) Collect() bool {
 	// End of this interval
 	now := Now()
+	cpu := cpuTime()
 	c.local.Interval += 1
 	c.local.Seconds = now.Sub(c.last).Seconds()
+	c.local.Util = utilization(cpu-c.cpu, now.Sub(c.last))
 	c.last = now
+	c.cpu = cpu
 
 	// Update total runtime: calculated from c.start, not c.last
 	c.local.Runtime = now.Sub(c.start).Seconds()
 
+	// Cumulative stats span the whole runtime, so rates like QPS are averaged
+	// over the runtime, not the interval
+	if c.Cumulative {
+		c.local.Seconds = c.local.Runtime
+		c.local.Util = utilization(cpu-c.cpuStart, now.Sub(c.start))
+	}
+
 	finch.Debug("collect")
 
 	// Lock-free swap: each Trx does an atomic pointer swap of its internal
@@ -311,8 +452,14 @@ func (c *Collector) Collect() bool {
 		}
 	}
 
-	// Combine all trx stats into total stats
-	c.local.Total.Reset()
+	// Combine all trx stats into total stats. If cumulative, don't reset:
+	// combine this interval into the running totals.
+	if !c.Cumulative {
+		c.local.Total.Reset()
+	}
+	if c.Guard != nil {
+		c.local.ClientBound = c.Guard.Flags(c.local.Hostname, !c.Cumulative)
+	}
 	seen := map[string]bool{}
 	for i := range c.trx {
 		for j := range c.trx[i] {
@@ -320,7 +467,7 @@ func (c *Collector) Collect() bool {
 			s := c.stats[i][j] // *Stats: DO NOT modify; see comment ^
 
 			// Reset our local copy first time we see the trx each interval
-			if !seen[trxName] {
+			if !seen[trxName] && !c.Cumulative {
 				c.local.Trx[trxName].Reset()
 				seen[trxName] = true
 			}
@@ -338,6 +485,39 @@ func (c *Collector) Collect() bool {
 	return c.Report(false)
 }
 
+// Snapshot returns the local stats of the current interval so far without
+// collecting or reporting them, so it doesn't affect periodic stats. Stats are
+// approximate and don't include errors; see Trx.Peek. It's called by
+// Stage.Snapshot (SIGUSR1).
+func (c *Collector) Snapshot() Instance {
+	now := Now()
+	c.Lock()
+	in := Instance{
+		Hostname: c.local.Hostname,
+		Clients:  c.local.Clients,
+		Interval: c.intervalNo,
+		Total:    NewStats(),
+	}
+	c.Unlock()
+	if c.start.IsZero() {
+		return in // not started
+	}
+	in.Runtime = now.Sub(c.start).Seconds()
+	in.Seconds = in.Runtime
+	if c.Freq > 0 {
+		// Active stats are only the current interval, even if cumulative
+		if d := time.Duration(in.Runtime*float64(time.Second)) % c.Freq; d > 0 {
+			in.Seconds = d.Seconds()
+		}
+	}
+	for i := range c.trx {
+		for j := range c.trx[i] {
+			in.Total.Combine(c.trx[i][j].Peek())
+		}
+	}
+	return in
+}
+
 // Recv receives stats from remote compute instances. It's called by
 // compute/Server.remoteStats.
 func (c *Collector) Recv(in Instance) {
@@ -372,6 +552,69 @@ func (c *Collector) Recv(in Instance) {
 	c.Report(false)
 }
 
+// SetInstances sets the number of instances in each interval. It's called
+// when compute instances join or leave an elastic stage (config.stage.compute.elastic).
+func (c *Collector) SetInstances(n uint) {
+	c.Lock()
+	defer c.Unlock()
+	if n > uint(len(c.interval)) {
+		interval := make([]Instance, n)
+		copy(interval, c.interval)
+		c.interval = interval
+	}
+	c.nInstances = n
+	if c.n > 0 && c.n >= n {
+		c.Report(false) // instance left and current interval is now complete
+	}
+}
+
+// SetVersion sets the MySQL server flavor and version for reporters that record
+// it (VersionReporter). It's called by the stage after connecting to MySQL,
+// before Start.
+func (c *Collector) SetVersion(version string) {
+	for _, r := range c.reporters {
+		if v, ok := r.(VersionReporter); ok {
+			v.SetVersion(version)
+		}
+	}
+}
+
+// SetCalibration sets the Calibration for reporters that record it
+// (CalibrationReporter). It's called by the stage after connecting to MySQL,
+// before Start.
+func (c *Collector) SetCalibration(cal Calibration) {
+	for _, r := range c.reporters {
+		if v, ok := r.(CalibrationReporter); ok {
+			v.SetCalibration(cal)
+		}
+	}
+}
+
+// Live returns the last reported interval from all instances combined, or nil
+// if no interval has been reported yet.
+func (c *Collector) Live() *Live {
+	c.Lock()
+	defer c.Unlock()
+	return c.live
+}
+
+// IntervalNo returns the current interval number.
+func (c *Collector) IntervalNo() uint {
+	c.Lock()
+	defer c.Unlock()
+	return c.intervalNo
+}
+
+// SetInterval sets the next interval number. It's called before Start on
+// a compute instance that joins an elastic stage that's already running so
+// its stats intervals match the server.
+func (c *Collector) SetInterval(n uint) {
+	if n > 0 {
+		c.intervalNo = n
+		c.local.Interval = n - 1 // Collect increments
+	}
+}
+
 // Report reports stats when then current interval is completed: when there are
 // stats from all instances (local and remote). Until the interval is complete,
 // Report does nothing and returns false, unless force is true to force reporting
@@ -385,6 +628,10 @@ func (c *Collector) Report(force bool) bool {
 	} else {
 		finch.Debug("interval %d: complete", c.intervalNo)
 	}
+	if c.n > 0 {
+		live := NewLive(c.interval[0:c.n])
+		c.live = &live
+	}
 	for _, r := range c.reporters {
 		r.Report(c.interval[0:c.n])
 	}
@@ -3,6 +3,7 @@
 package stats_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -178,6 +179,64 @@ func TestCollector_2Clients(t *testing.T) {
 	}
 }
 
+func TestCollector_Cumulative(t *testing.T) {
+	var gotN []uint64
+	var gotSeconds []float64
+	r := mock.StatsReporter{
+		ReportFunc: func(from []stats.Instance) {
+			gotN = append(gotN, from[0].Total.N[stats.TOTAL])
+			gotSeconds = append(gotSeconds, from[0].Seconds)
+		},
+	}
+	stats.Register("mock-cumulative", r) // needs a unique reporter name
+
+	cumulative := true
+	cfg := config.Stats{
+		Cumulative: &cumulative,
+		Report: map[string]map[string]string{
+			"mock-cumulative": nil,
+		},
+	}
+	c, err := stats.NewCollector(cfg, "local", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trx1 := stats.NewTrx("t1")
+	c.Watch([]*stats.Trx{trx1})
+
+	// Fake time for Now: start, then two 5s intervals
+	ti := 0
+	start := time.Now().Add(time.Duration(-11) * time.Second)
+	times := []time.Time{
+		start,
+		start.Add(5 * time.Second),
+		start.Add(10 * time.Second),
+	}
+	stats.Now = func() time.Time {
+		now := times[ti]
+		ti += 1
+		return now
+	}
+	defer func() { stats.Now = time.Now }()
+
+	c.Start() // freq=0, so Collect is called manually
+	trx1.Record(stats.READ, 100)
+	trx1.Record(stats.READ, 200)
+	c.Collect()
+	trx1.Record(stats.READ, 300)
+	c.Collect()
+
+	// Second report includes the first interval, and seconds is the runtime
+	if diff := deep.Equal(gotN, []uint64{2, 3}); diff != nil {
+		t.Error(diff)
+	}
+	deep.FloatPrecision = 3
+	if diff := deep.Equal(gotSeconds, []float64{5.0, 10.0}); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestCollector_Combine(t *testing.T) {
 	s1 := stats.NewStats()
 	// {READ, WRITE, COMMIT, TOTAL}
@@ -246,4 +305,171 @@ func TestCollector_Combine(t *testing.T) {
 	if diff := deep.Equal(all.Total, expect); diff != nil {
 		t.Error(diff)
 	}
+	// Trx stats are combined, too
+	if diff := deep.Equal(all.Trx["t1"], expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNewLive(t *testing.T) {
+	s1 := stats.NewStats()
+	s1.Record(stats.READ, 100)
+	s1.Record(stats.READ, 100)
+	s2 := stats.NewStats()
+	s2.Record(stats.WRITE, 2000)
+	s2.Record(stats.COMMIT, 1000)
+	s2.Errors[1213] = 2
+	s2.Errors[1205] = 0
+	from := []stats.Instance{
+		{Hostname: "local", Clients: 2, Interval: 3, Seconds: 2.0, Runtime: 6.0, Total: s1},
+		{Hostname: "remote1", Clients: 1, Interval: 3, Seconds: 2.0, Runtime: 6.0, Total: s2},
+	}
+
+	live := stats.NewLive(from)
+	if live.Interval != 3 || live.Runtime != 6.0 || live.Clients != 3 {
+		t.Errorf("got interval %d, runtime %f, clients %d; expected 3, 6.0, 3", live.Interval, live.Runtime, live.Clients)
+	}
+	if diff := deep.Equal(live.Computes, []string{"local", "remote1"}); diff != nil {
+		t.Error(diff)
+	}
+	if live.QPS != 2.0 || live.ReadQPS != 1.0 || live.WriteQPS != 0.5 || live.TPS != 0.5 {
+		t.Errorf("got QPS %f, r_QPS %f, w_QPS %f, TPS %f; expected 2.0, 1.0, 0.5, 0.5", live.QPS, live.ReadQPS, live.WriteQPS, live.TPS)
+	}
+	if live.Max != 2000 {
+		t.Errorf("got max %d, expected 2000", live.Max)
+	}
+	if len(live.Percentiles) != len(stats.LivePercentiles) {
+		t.Errorf("got percentiles %v, expected %v", live.Percentiles, stats.LivePercentileNames)
+	}
+	if diff := deep.Equal(live.ErrorCodes, map[uint16]uint64{1213: 2}); diff != nil || live.Errors != 2 {
+		t.Errorf("got errors %d %v, expected 2 (1213)", live.Errors, live.ErrorCodes)
+	}
+}
+
+func TestCollector_Snapshot(t *testing.T) {
+	cfg := config.Stats{
+		Report: map[string]map[string]string{
+			"mock-snapshot": nil,
+		},
+	}
+	reported := 0
+	stats.Register("mock-snapshot", mock.StatsReporter{
+		ReportFunc: func(from []stats.Instance) { reported++ },
+	})
+	c, err := stats.NewCollector(cfg, "local", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trx1 := stats.NewTrx("t1")
+	c.Watch([]*stats.Trx{trx1})
+
+	start := time.Now().Add(-2 * time.Second)
+	stats.Now = func() time.Time { return start }
+	c.Start()
+	stats.Now = time.Now
+	trx1.Record(stats.READ, 100)
+	trx1.Record(stats.WRITE, 200)
+	trx1.Error(1062) // not in snapshot
+
+	got := c.Snapshot()
+	if got.Total.N[stats.TOTAL] != 2 || got.Total.N[stats.READ] != 1 {
+		t.Errorf("got N %v, expected 2 total and 1 read", got.Total.N)
+	}
+	if len(got.Total.Errors) != 0 {
+		t.Errorf("got errors %v, expected none", got.Total.Errors)
+	}
+	if got.Clients != 1 || got.Interval != 1 || got.Runtime < 2 {
+		t.Errorf("got clients %d interval %d runtime %.1f, expected 1, 1, >= 2", got.Clients, got.Interval, got.Runtime)
+	}
+
+	// Snapshot doesn't collect or report: stats are still active
+	if reported != 0 {
+		t.Errorf("got %d reports, expected 0", reported)
+	}
+	if got := c.Snapshot(); got.Total.N[stats.TOTAL] != 2 {
+		t.Errorf("got N %d after second snapshot, expected 2", got.Total.N[stats.TOTAL])
+	}
+}
+
+func TestCollector_CoarseClock(t *testing.T) {
+	cfg := config.Stats{
+		Clock:           config.CLOCK_COARSE,
+		ClockResolution: "1ms",
+		Report:          map[string]map[string]string{},
+	}
+	c, err := stats.NewCollector(cfg, "local", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := c.Clock()
+	c.Start()
+	t0 := clock()
+	time.Sleep(20 * time.Millisecond)
+	t1 := clock()
+	c.Stop(time.Second, false)
+
+	// Coarse clock only changes when the ticker updates it, so elapsed time is
+	// about 20ms but not exact
+	if d := t1 - t0; d < 10000 || d > 1000000 {
+		t.Errorf("coarse clock elapsed %dus, expected about 20000us", d)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	cal, err := stats.Calibrate(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Timer <= 0 || cal.Timer > time.Millisecond {
+		t.Errorf("timer %s, expected (0, 1ms]", cal.Timer)
+	}
+	if cal.Jitter < 0 || cal.JitterMax < cal.Jitter {
+		t.Errorf("jitter %s max %s, expected 0 <= jitter <= max", cal.Jitter, cal.JitterMax)
+	}
+	if cal.RoundTrip != 0 {
+		t.Errorf("round trip %s, expected 0 without db", cal.RoundTrip)
+	}
+}
+
+func TestCollector_Util(t *testing.T) {
+	var got []stats.Instance
+	stats.Register("mock-util", mock.StatsReporter{
+		ReportFunc: func(from []stats.Instance) {
+			got = make([]stats.Instance, len(from))
+			copy(got, from)
+		},
+	})
+	cfg := config.Stats{
+		Report: map[string]map[string]string{"mock-util": nil},
+	}
+	c, err := stats.NewCollector(cfg, "local", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	// Busy loop on one CPU, so utilization is about 100% / GOMAXPROCS
+	for t0 := time.Now(); time.Since(t0) < 100*time.Millisecond; {
+	}
+	c.Stop(time.Second, false)
+	if len(got) != 1 {
+		t.Fatalf("got %d instances, expected 1", len(got))
+	}
+	if got[0].Util <= 0 || got[0].Util > 100 {
+		t.Errorf("util %.0f%%, expected (0, 100]", got[0].Util)
+	}
+
+	// Combined is the busiest compute, and totals are time-weighted
+	a := stats.Instance{Interval: 1, Seconds: 1, Runtime: 1, Util: 20, Total: stats.NewStats()}
+	b := stats.Instance{Interval: 1, Seconds: 1, Runtime: 1, Util: 80, Total: stats.NewStats()}
+	all := stats.NewInstance("")
+	all.Combine([]stats.Instance{a, b})
+	if all.Util != 80 {
+		t.Errorf("combined util %.0f, expected 80 (max)", all.Util)
+	}
+	total := stats.NewInstance("")
+	total.Add(a)
+	total.Add(stats.Instance{Interval: 2, Seconds: 3, Runtime: 4, Util: 60, Total: stats.NewStats()})
+	if total.Util != 50 {
+		t.Errorf("total util %.0f, expected 50 (20*1 + 60*3) / 4", total.Util)
+	}
 }
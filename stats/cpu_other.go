@@ -0,0 +1,19 @@
+// Copyright 2024 Block, Inc.
+
+//go:build !windows
+
+package stats
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and system CPU time used by this process.
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
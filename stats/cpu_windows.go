@@ -0,0 +1,28 @@
+// Copyright 2024 Block, Inc.
+
+//go:build windows
+
+package stats
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and kernel CPU time used by this process.
+func cpuTime() time.Duration {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0
+	}
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(p, &created, &exited, &kernel, &user); err != nil {
+		return 0
+	}
+	// Filetime durations are in 100ns units. Filetime.Nanoseconds is for
+	// timestamps (since 1601), so it can't be used here.
+	ft := func(t syscall.Filetime) time.Duration {
+		return time.Duration((uint64(t.HighDateTime)<<32 | uint64(t.LowDateTime)) * 100)
+	}
+	return ft(kernel) + ft(user)
+}
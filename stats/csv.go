@@ -8,13 +8,20 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/square/finch"
 )
 
 // CSV is a Reporter that prints stats to STDOUT. This is the default when
-// config.stats is not set.
+// config.stats is not set. If option retries is true, retries is a column after
+// compute. If option run (the run ID) is set, it's the last column. Columns are
+// only added at the end so that existing scripts that read the file by column
+// number still work.
 type CSV struct {
-	file *os.File
-	p    []float64
+	file    *os.File
+	p       []float64
+	retries bool
+	run     string
 }
 
 var _ Reporter = &CSV{}
@@ -47,11 +54,20 @@ func NewCSV(opts map[string]string) (*CSV, error) {
 		strings.Join(withPrefix(sP, "w_"), ","), // write
 		strings.Join(withPrefix(sP, "c_"), ","), // commit
 	)
+	retries := finch.Bool(opts["retries"])
+	if retries {
+		fmt.Fprint(f, ",retries")
+	}
+	if opts["run"] != "" {
+		fmt.Fprint(f, ",run")
+	}
 	fmt.Fprintln(f)
 
 	r := &CSV{
-		file: f,
-		p:    nP,
+		file:    f,
+		p:       nP,
+		retries: retries,
+		run:     opts["run"],
 	}
 	return r, nil
 }
@@ -117,6 +133,12 @@ func (r *CSV) Report(from []Instance) {
 	line = strings.Replace(line, "P", intsToString(total.Percentiles(READ, r.p), ",", false), 1)
 	line = strings.Replace(line, "P", intsToString(total.Percentiles(WRITE, r.p), ",", false), 1)
 	line = strings.Replace(line, "P", intsToString(total.Percentiles(COMMIT, r.p), ",", false), 1)
+	if r.retries {
+		line += fmt.Sprintf(",%d", total.Retries)
+	}
+	if r.run != "" {
+		line += "," + r.run
+	}
 
 	fmt.Fprintln(r.file, line)
 }
@@ -0,0 +1,139 @@
+// Copyright 2024 Block, Inc.
+
+package stats
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/square/finch/config"
+)
+
+// Guard monitors the compute instance itself: the percent of its CPUs that Finch
+// uses, and the percent of time that Finch is paused for Go garbage collection
+// (config.stage.compute.max-cpu and max-gc-pause). Above either, the compute is
+// client-bound: it can't generate more load, so the stats measure the limits of
+// the compute, not the database. The stage calls Check periodically, and the
+// Collector flags each interval in which the compute was client-bound
+// (Instance.ClientBound).
+type Guard struct {
+	maxCPU float64 // percent; 0 = disabled
+	maxGC  float64 // percent; 0 = disabled
+	nCPU   float64
+	last   time.Time
+	cpu    time.Duration
+	gc     uint64 // runtime.MemStats.PauseTotalNs
+	*sync.Mutex
+	cpuBound bool // since last Flags
+	gcBound  bool
+}
+
+// NewGuard returns a new Guard, or nil if max-cpu and max-gc-pause are both zero.
+func NewGuard(cfg config.Compute) *Guard {
+	maxCPU, _ := strconv.ParseFloat(cfg.MaxCPU, 64)    // already validated
+	maxGC, _ := strconv.ParseFloat(cfg.MaxGCPause, 64) // already validated
+	if maxCPU == 0 && maxGC == 0 {
+		return nil
+	}
+	g := &Guard{
+		maxCPU: maxCPU,
+		maxGC:  maxGC,
+		nCPU:   float64(runtime.GOMAXPROCS(0)),
+		Mutex:  &sync.Mutex{},
+	}
+	g.Start()
+	return g
+}
+
+// Start samples initial usage. NewGuard calls it, but the stage calls it again
+// when it starts running so usage before then (like loading) isn't counted.
+func (g *Guard) Start() {
+	g.Lock()
+	defer g.Unlock()
+	g.last = time.Now()
+	g.cpu = cpuTime()
+	g.gc = gcPauseTotal()
+	g.cpuBound = false
+	g.gcBound = false
+}
+
+// Check samples usage since the last Check (or Start) and returns a message for
+// each threshold exceeded, or nil if the compute isn't client-bound.
+func (g *Guard) Check() []string {
+	now := time.Now()
+	cpu := cpuTime()
+	gc := gcPauseTotal()
+
+	g.Lock()
+	defer g.Unlock()
+	wall := now.Sub(g.last)
+	if wall <= 0 {
+		return nil
+	}
+	cpuPct := float64(cpu-g.cpu) / float64(wall) / g.nCPU * 100
+	gcPct := float64(gc-g.gc) / float64(wall) * 100
+	g.last, g.cpu, g.gc = now, cpu, gc
+
+	var over []string
+	if g.maxCPU > 0 && cpuPct > g.maxCPU {
+		over = append(over, fmt.Sprintf("CPU %.0f%% of %.0f CPUs > max-cpu %g%%", cpuPct, g.nCPU, g.maxCPU))
+		g.cpuBound = true
+	}
+	if g.maxGC > 0 && gcPct > g.maxGC {
+		over = append(over, fmt.Sprintf("GC pause %.1f%% > max-gc-pause %g%%", gcPct, g.maxGC))
+		g.gcBound = true
+	}
+	return over
+}
+
+// Flags returns the client-bound flags for hostname since the last call: which
+// thresholds were exceeded. Flags are the same for every interval, so they can
+// be deduplicated across intervals and instances. If reset is false, flags are
+// kept, which is used for cumulative stats.
+func (g *Guard) Flags(hostname string, reset bool) []string {
+	g.Lock()
+	defer g.Unlock()
+	var flags []string
+	if g.cpuBound {
+		flags = append(flags, fmt.Sprintf("%s: CPU > max-cpu %g%%", hostname, g.maxCPU))
+	}
+	if g.gcBound {
+		flags = append(flags, fmt.Sprintf("%s: GC pause > max-gc-pause %g%%", hostname, g.maxGC))
+	}
+	if reset {
+		g.cpuBound = false
+		g.gcBound = false
+	}
+	return flags
+}
+
+// ClientBoundUtil is the load generator utilization (percent) at which results
+// are probably client-bound. Stdout warns if an interval reaches it, even if
+// Guard is disabled or didn't flag the interval.
+const ClientBoundUtil = 90.0
+
+// utilization returns load generator utilization: the percent of the compute's
+// CPUs (GOMAXPROCS) that Finch used in wall time, rounded to a whole percent.
+// The rest of the time, clients are waiting on MySQL (or idle). Near 100%,
+// clients are CPU-saturated: they can't generate more load, and response times
+// include time waiting to be scheduled, not only MySQL.
+func utilization(cpu, wall time.Duration) float64 {
+	if wall <= 0 {
+		return 0
+	}
+	u := float64(cpu) / float64(wall) / float64(runtime.GOMAXPROCS(0)) * 100
+	if u > 100 {
+		u = 100
+	}
+	return math.Round(u)
+}
+
+func gcPauseTotal() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.PauseTotalNs
+}
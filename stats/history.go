@@ -0,0 +1,126 @@
+// Copyright 2024 Block, Inc.
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/square/finch/config"
+)
+
+// HistoryRecord is one stage run in a history file: a JSON line appended by
+// the History reporter when the stage finishes. Rates are averaged over the
+// stage runtime, and percentiles are for the whole runtime.
+type HistoryRecord struct {
+	Time  time.Time `json:"time"`            // when stage finished
+	Run   string    `json:"run,omitempty"`   // run ID; same for all stages in a run
+	Stage string    `json:"stage,omitempty"` // stage name
+	MySQL string    `json:"mysql,omitempty"` // server flavor and version
+	Clock string    `json:"clock,omitempty"` // "coarse RESOLUTION" if stats.clock: coarse
+
+	Calibration *Calibration `json:"calibration,omitempty"` // client-side noise
+	Live
+}
+
+// History is a Reporter that appends one HistoryRecord per stage run to a file
+// (option file, required), so the file is a history of results over many runs:
+// for example, recurring runs on a schedule (--schedule) against the same
+// target. Options stage and run set HistoryRecord.Stage and Run.
+type History struct {
+	file     *os.File
+	stage    string
+	run      string
+	version  string
+	clock    string
+	cal      *Calibration
+	total    Instance
+	computes map[string]bool
+}
+
+var _ Reporter = &History{}
+var _ VersionReporter = &History{}
+var _ ClockReporter = &History{}
+var _ CalibrationReporter = &History{}
+
+func NewHistory(opts map[string]string) (*History, error) {
+	if opts["file"] == "" {
+		return nil, fmt.Errorf("history reporter requires option file")
+	}
+	f, err := os.OpenFile(opts["file"], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r := &History{
+		file:     f,
+		stage:    opts["stage"],
+		run:      opts["run"],
+		total:    NewInstance(""),
+		computes: map[string]bool{},
+	}
+	return r, nil
+}
+
+// SetVersion sets HistoryRecord.MySQL.
+func (r *History) SetVersion(version string) {
+	r.version = version
+}
+
+// SetClock sets HistoryRecord.Clock if the clock is coarse, so results measured
+// with different accuracy can be told apart.
+func (r *History) SetClock(clock string, resolution time.Duration) {
+	if clock == config.CLOCK_COARSE {
+		r.clock = fmt.Sprintf("%s %s", clock, resolution)
+	}
+}
+
+// SetCalibration sets HistoryRecord.Calibration.
+func (r *History) SetCalibration(cal Calibration) {
+	r.cal = &cal
+}
+
+// Report adds interval stats from all instances to the stage totals.
+func (r *History) Report(from []Instance) {
+	in := NewInstance("")
+	in.Combine(from)
+	for i := range from {
+		r.computes[from[i].Hostname] = true
+	}
+	r.total.Add(in)
+}
+
+// Stop appends the stage totals to the file. Nothing is written if the stage
+// didn't report any stats.
+func (r *History) Stop() {
+	defer r.file.Close()
+	if r.total.Interval == 0 {
+		return
+	}
+	rec := HistoryRecord{
+		Time:  Now(),
+		Run:   r.run,
+		Stage: r.stage,
+		MySQL: r.version,
+		Clock: r.clock,
+		Live:  NewLive([]Instance{r.total}),
+
+		Calibration: r.cal,
+	}
+	rec.Computes = make([]string, 0, len(r.computes))
+	for name := range r.computes {
+		rec.Computes = append(rec.Computes, name)
+	}
+	sort.Strings(rec.Computes)
+	bytes, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Error encoding history record: %s", err)
+		return
+	}
+	if _, err := r.file.Write(append(bytes, '\n')); err != nil {
+		log.Printf("Error writing history file %s: %s", r.file.Name(), err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Block, Inc.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// statsJSON is how Stats are encoded when computes send them to the server.
+// Buckets are sparse: for each event type, a flat list of index-count pairs
+// for non-zero buckets only. Most of the 450 buckets are zero, so this is a
+// fraction of the size of the full histogram.
+type statsJSON struct {
+	Buckets [][]uint64        `json:"b"`
+	Min     []int64           `json:"min"`
+	Max     []int64           `json:"max"`
+	N       []uint64          `json:"n"`
+	Errors  map[uint16]uint64 `json:"errors,omitempty"`
+	Retries uint64            `json:"retries,omitempty"`
+}
+
+func (s Stats) MarshalJSON() ([]byte, error) {
+	w := statsJSON{
+		Buckets: make([][]uint64, len(s.Buckets)),
+		Min:     s.Min,
+		Max:     s.Max,
+		N:       s.N,
+		Retries: s.Retries,
+	}
+	for i := range s.Buckets {
+		w.Buckets[i] = []uint64{}
+		for j, n := range s.Buckets[i] {
+			if n > 0 {
+				w.Buckets[i] = append(w.Buckets[i], uint64(j), n)
+			}
+		}
+	}
+	for code, n := range s.Errors {
+		if n == 0 {
+			continue // Reset zeros but keeps error codes
+		}
+		if w.Errors == nil {
+			w.Errors = map[uint16]uint64{}
+		}
+		w.Errors[code] = n
+	}
+	return json.Marshal(w)
+}
+
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	var w statsJSON
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	if len(w.Buckets) != nEventTypes || len(w.Min) != nEventTypes || len(w.Max) != nEventTypes || len(w.N) != nEventTypes {
+		return fmt.Errorf("invalid stats: expected %d event types", nEventTypes)
+	}
+	*s = *NewStats()
+	for i := range w.Buckets {
+		if len(w.Buckets[i])%2 != 0 {
+			return fmt.Errorf("invalid stats: odd number of bucket values for event type %d", i)
+		}
+		for j := 0; j < len(w.Buckets[i]); j += 2 {
+			if w.Buckets[i][j] >= n_buckets {
+				return fmt.Errorf("invalid stats: bucket %d out of range", w.Buckets[i][j])
+			}
+			s.Buckets[i][w.Buckets[i][j]] = w.Buckets[i][j+1]
+		}
+	}
+	copy(s.Min, w.Min)
+	copy(s.Max, w.Max)
+	copy(s.N, w.N)
+	for code, n := range w.Errors {
+		s.Errors[code] = n
+	}
+	s.Retries = w.Retries
+	return nil
+}
+
+// DecodeInstances decodes stats sent by a compute: a batch (JSON array) of
+// instances, or a single instance.
+func DecodeInstances(data []byte) ([]Instance, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []Instance
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+	var in Instance
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	return []Instance{in}, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Block, Inc.
+
+package stats
+
+// LivePercentiles are the percentiles in Live stats.
+var LivePercentiles = []float64{50, 95, 99, 99.9}
+var LivePercentileNames = []string{"P50", "P95", "P99", "P999"}
+
+// Live is the last reported interval from all compute instances combined:
+// a cluster-wide live view of a distributed stage. The server returns it on
+// GET /live while running. Rates are per second, and percentiles are
+// microseconds calculated from the merged histograms of all instances.
+type Live struct {
+	Interval    uint              `json:"interval"`
+	Runtime     float64           `json:"runtime"`
+	Computes    []string          `json:"computes"`
+	Clients     uint              `json:"clients"`
+	QPS         float64           `json:"qps"`
+	ReadQPS     float64           `json:"r_qps"`
+	WriteQPS    float64           `json:"w_qps"`
+	TPS         float64           `json:"tps"`
+	Errors      uint64            `json:"errors"`
+	ErrorCodes  map[uint16]uint64 `json:"error-codes,omitempty"` // MySQL error code => count
+	Retries     uint64            `json:"retries"`
+	Percentiles map[string]uint64 `json:"percentiles"` // all queries
+	Max         int64             `json:"max"`
+	ClientBound []string          `json:"client-bound,omitempty"` // see Guard
+	Util        float64           `json:"util"`                   // busiest compute; see utilization
+}
+
+// NewLive returns the live view of interval stats from all instances.
+func NewLive(from []Instance) Live {
+	all := NewInstance("")
+	all.Combine(from)
+	s := all.Total
+	live := Live{
+		Interval:    all.Interval,
+		Runtime:     all.Runtime,
+		Computes:    make([]string, len(from)),
+		Clients:     all.Clients,
+		Retries:     s.Retries,
+		Percentiles: map[string]uint64{},
+		Max:         s.Max[TOTAL],
+		ClientBound: all.ClientBound,
+		Util:        all.Util,
+	}
+	for i := range from {
+		live.Computes[i] = from[i].Hostname
+	}
+	if all.Seconds > 0 {
+		live.QPS = float64(s.N[TOTAL]) / all.Seconds
+		live.ReadQPS = float64(s.N[READ]) / all.Seconds
+		live.WriteQPS = float64(s.N[WRITE]) / all.Seconds
+		live.TPS = float64(s.N[COMMIT]) / all.Seconds
+	}
+	for code, n := range s.Errors {
+		if n == 0 {
+			continue
+		}
+		live.Errors += n
+		if live.ErrorCodes == nil {
+			live.ErrorCodes = map[uint16]uint64{}
+		}
+		live.ErrorCodes[code] = n
+	}
+	if s.N[TOTAL] > 0 {
+		q := s.Percentiles(TOTAL, LivePercentiles)
+		for i := range q {
+			live.Percentiles[LivePercentileNames[i]] = q[i]
+		}
+	}
+	return live
+}
@@ -14,7 +14,9 @@ import (
 
 // Server is a Reporter that sends stats to a remote compute instance (--server).
 // When running as a client, Finch uses and configures this reporter automatically
-// in compute/Remote.Boot.
+// in compute/Remote.Boot. Stats are sent gzip-compressed, and stats queued while
+// a send is in progress are sent together in one batch, which reduces traffic
+// to the server on the same network as the benchmark.
 type Server struct {
 	server    string // for logging
 	client    *proto.Client
@@ -35,6 +37,7 @@ func NewServer(opts map[string]string) (Server, error) {
 		doneChan: make(chan struct{}),
 	}
 	r.client.StageId = opts["stage-id"] // from compute/client.run
+	r.client.Gzip = true
 	go r.report()
 	return r, nil
 }
@@ -71,11 +74,28 @@ func (r Server) Stop() {
 func (r Server) report() {
 	defer close(r.doneChan)
 	for s := range r.statsChan {
-		err := r.client.Send(context.Background(), "/stats", s, proto.R{300 * time.Millisecond, 10 * time.Millisecond, 3})
+		batch := Batch(s, r.statsChan)
+		err := r.client.Send(context.Background(), "/stats", batch, proto.R{300 * time.Millisecond, 10 * time.Millisecond, 3})
 		if err != nil {
-			log.Printf("Failed to send stats: %s\n%+v\n", err, s)
+			log.Printf("Failed to send stats: %s\n%+v\n", err, batch)
 			continue
 		}
-		finch.Debug("sent stats to %s", r.server)
+		finch.Debug("sent %d stats to %s", len(batch), r.server)
+	}
+}
+
+// Batch returns first and all other stats queued in c without blocking.
+func Batch(first Instance, c chan Instance) []Instance {
+	batch := []Instance{first}
+	for {
+		select {
+		case s, ok := <-c:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, s)
+		default:
+			return batch
+		}
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	h "github.com/dustin/go-humanize"
 
@@ -25,6 +26,26 @@ type Reporter interface {
 	Stop()
 }
 
+// VersionReporter is an optional Reporter interface to receive the MySQL server
+// flavor and version, like "MariaDB 10.11.6", detected when the stage connects.
+// See Collector.SetVersion.
+type VersionReporter interface {
+	SetVersion(version string)
+}
+
+// ClockReporter is an optional Reporter interface to receive the clock that
+// clients use to measure response time (config.stats.clock) and its resolution
+// (0 for the monotonic clock), to report the accuracy of a coarse clock.
+type ClockReporter interface {
+	SetClock(clock string, resolution time.Duration)
+}
+
+// CalibrationReporter is an optional Reporter interface to receive the
+// client-side noise measured when the stage starts. See Collector.SetCalibration.
+type CalibrationReporter interface {
+	SetCalibration(Calibration)
+}
+
 type ReporterFactory interface {
 	Make(name string, opts map[string]string) (Reporter, error)
 }
@@ -64,6 +85,7 @@ func init() {
 	Register("stdout", f)
 	Register("server", f)
 	Register("csv", f)
+	Register("history", f)
 }
 
 type repo struct {
@@ -88,6 +110,8 @@ func (f factory) Make(name string, opts map[string]string) (Reporter, error) {
 		return NewServer(opts)
 	case "csv":
 		return NewCSV(opts)
+	case "history":
+		return NewHistory(opts)
 	}
 	return nil, fmt.Errorf("reporter %s not registered", name)
 }
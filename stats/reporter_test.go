@@ -3,7 +3,11 @@
 package stats_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -85,4 +89,103 @@ func TestCSV(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+
+	// Retries after compute, and run ID is the last column
+	s.Retries = 3
+	file = filepath.Join(t.TempDir(), "run.csv")
+	r, err = stats.NewCSV(map[string]string{"file": file, "retries": "yes", "run": "cq1k2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Report(from)
+	r.Stop()
+	got, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `interval,duration,runtime,clients,QPS,min,P999,max,r_QPS,r_min,r_P999,r_max,w_QPS,w_min,w_P999,w_max,TPS,c_min,c_P999,c_max,errors,compute,retries,run
+1,2.0,2.0,1,3,110,389,390,1,110,185,190,1,210,294,290,1,310,389,390,0,local,3,cq1k2
+`
+	if string(got) != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s\n", string(got), expect)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	for run := 1; run <= 2; run++ {
+		r, err := stats.NewHistory(map[string]string{"file": file, "stage": "test", "run": fmt.Sprintf("run%d", run)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetVersion("MariaDB 10.11.6")
+		r.SetCalibration(stats.Calibration{Timer: 100, Jitter: 50000, JitterMax: 200000, RoundTrip: 80000})
+		for i := uint(1); i <= 2; i++ {
+			s := stats.NewStats()
+			s.Record(stats.READ, 100)
+			s.Record(stats.COMMIT, 200)
+			r.Report([]stats.Instance{{Hostname: "local", Clients: 2, Interval: i, Seconds: 1.0, Runtime: float64(i), Total: s}})
+		}
+		r.Stop()
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected 2 (one per run):\n%s", len(lines), bytes)
+	}
+	var got stats.HistoryRecord
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Run != "run2" || got.Stage != "test" || got.MySQL != "MariaDB 10.11.6" {
+		t.Errorf("got run %s stage %s mysql %s, expected run2 test MariaDB 10.11.6", got.Run, got.Stage, got.MySQL)
+	}
+	if got.Calibration == nil || got.Calibration.RoundTrip != 80000 {
+		t.Errorf("got calibration %+v, expected round trip 80000", got.Calibration)
+	}
+	// 4 queries (2 per interval) over 2s runtime
+	if got.Runtime != 2.0 || got.QPS != 2.0 || got.TPS != 1.0 || got.Clients != 2 {
+		t.Errorf("got runtime %.1f QPS %.1f TPS %.1f clients %d, expected 2.0, 2.0, 1.0, 2", got.Runtime, got.QPS, got.TPS, got.Clients)
+	}
+	if diff := deep.Equal(got.Computes, []string{"local"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := stats.NewHistory(map[string]string{}); err == nil {
+		t.Error("no error without file option, expected one")
+	}
+}
+
+func TestOutliers(t *testing.T) {
+	instance := func(name string, n int, latency int64) stats.Instance {
+		s := stats.NewStats()
+		for i := 0; i < n; i++ {
+			s.Record(stats.READ, latency)
+		}
+		return stats.Instance{Hostname: name, Clients: 1, Interval: 1, Seconds: 1.0, Runtime: 1.0, Total: s}
+	}
+
+	each := []stats.Instance{
+		instance("c1", 100, 1000),
+		instance("c2", 100, 1000),
+		instance("c3", 100, 1000),
+	}
+	if got := stats.Outliers(each); len(got) != 0 {
+		t.Errorf("got outliers %v, expected none", got)
+	}
+
+	// c3 is slow (high latency) and does less than half the QPS of the others
+	each[2] = instance("c3", 40, 5000)
+	got := stats.Outliers(each)
+	if len(got) != 2 || !strings.HasPrefix(got[0], "c3: QPS") || !strings.HasPrefix(got[1], "c3: P99") {
+		t.Errorf("got outliers %v, expected c3 QPS and P99", got)
+	}
+
+	if got := stats.Outliers(each[0:1]); len(got) != 0 {
+		t.Errorf("got outliers %v for one compute, expected none", got)
+	}
 }
@@ -4,6 +4,7 @@ package stats
 
 import (
 	"math"
+	"sync"
 	"sync/atomic"
 )
 
@@ -29,6 +30,7 @@ type Stats struct {
 	Max     []int64           // response time (μs)
 	N       []uint64          // number of events (queries)
 	Errors  map[uint16]uint64 // count MySQL error codes
+	Retries uint64            // count retries (e.g. -- cas)
 }
 
 func NewStats() *Stats {
@@ -101,6 +103,7 @@ func (s *Stats) Reset() {
 	for k := range s.Errors {
 		s.Errors[k] = 0
 	}
+	s.Retries = 0
 }
 
 // Copy copies all stats from c, overwriting all values in s. Calling Reset before
@@ -115,6 +118,7 @@ func (s *Stats) Copy(c *Stats) {
 	for k, v := range c.Errors {
 		s.Errors[k] = v
 	}
+	s.Retries = c.Retries
 }
 
 // Combine combines all stats from c. All values in s are adjusted with respect
@@ -136,6 +140,7 @@ func (s *Stats) Combine(c *Stats) {
 	for k, v := range c.Errors {
 		s.Errors[k] += v
 	}
+	s.Retries += c.Retries
 }
 
 func (s Stats) Percentiles(eventType byte, p []float64) (q []uint64) {
@@ -187,14 +192,32 @@ func (s Stats) Percentiles(eventType byte, p []float64) (q []uint64) {
 // then it's returned to the Collector for reporting, and "b" is made active for
 // on-going stats recording by the Client. This is the other half of the lock-free
 // Stats design.
+//
+// Record doesn't write to the active stats. It writes the event to a ring buffer
+// owned by the client, and Flush (called by the Collector) records the events in
+// the active stats. This keeps the bucket math and writes to memory shared with
+// the Collector off the client's critical path, which otherwise perturbs
+// sub-100µs response times. If the ring is full, the client flushes it.
 type Trx struct {
 	Name string
 	a    *Stats
 	b    *Stats
 	sp   atomic.Pointer[Stats]
 	onA  bool
+
+	ring []uint64      // event type << eventShift | duration (μs)
+	head atomic.Uint64 // next event written by Record
+	_    [56]byte      // head and tail on different cache lines
+	tail atomic.Uint64 // next event read by Flush
+	mux  sync.Mutex    // guards Flush and Swap
 }
 
+const (
+	ringSize   = 4096 // events; power of 2
+	eventShift = 62   // top 2 bits of ring entry: READ, WRITE, COMMIT, TOTAL
+	eventMask  = 1<<eventShift - 1
+)
+
 func NewTrx(name string) *Trx {
 	t := &Trx{
 		Name: name,
@@ -202,20 +225,55 @@ func NewTrx(name string) *Trx {
 		a:    NewStats(),
 		b:    NewStats(),
 		onA:  true,
+		ring: make([]uint64, ringSize),
 	}
 	t.sp.Store(t.a)
 	return t
 }
 
+// Record records the duration of an event in microseconds. Only one goroutine
+// (the client) can call it.
 func (t *Trx) Record(eventType byte, d int64) {
-	t.sp.Load().Record(eventType, d)
+	h := t.head.Load()
+	if h-t.tail.Load() == ringSize {
+		t.Flush() // ring full; Collector is behind
+	}
+	t.ring[h&(ringSize-1)] = uint64(eventType)<<eventShift | uint64(d)&eventMask
+	t.head.Store(h + 1)
+}
+
+// Flush records events in the ring buffer in the active stats. It's called
+// periodically by the Collector (see Collector.Start), by Swap and Peek, and by
+// Record if the ring is full.
+func (t *Trx) Flush() {
+	t.mux.Lock()
+	t.flush()
+	t.mux.Unlock()
+}
+
+func (t *Trx) flush() {
+	s := t.sp.Load()
+	tail, head := t.tail.Load(), t.head.Load()
+	for ; tail < head; tail++ {
+		e := t.ring[tail&(ringSize-1)]
+		s.Record(byte(e>>eventShift), int64(e&eventMask))
+	}
+	t.tail.Store(tail)
 }
 
 func (t *Trx) Error(n uint16) {
 	t.sp.Load().Errors[n] += 1
 }
 
+func (t *Trx) Retry() {
+	t.sp.Load().Retries += 1
+}
+
 func (t *Trx) Swap() *Stats {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.flush() // events so far are in this interval
+
 	// on A; switch to B
 	if t.onA {
 		t.b.Reset()
@@ -230,6 +288,24 @@ func (t *Trx) Swap() *Stats {
 	return t.b
 }
 
+// Peek returns a copy of the active stats without swapping. It's approximate
+// because the client keeps recording while the stats are copied, and errors are
+// not copied because the client writes the Errors map without a lock. It's used
+// only for Collector.Snapshot.
+func (t *Trx) Peek() *Stats {
+	t.Flush()
+	c := t.sp.Load()
+	s := NewStats()
+	for i := 0; i < nEventTypes; i++ {
+		copy(s.Buckets[i], c.Buckets[i])
+		s.Min[i] = c.Min[i]
+		s.Max[i] = c.Max[i]
+		s.N[i] = c.N[i]
+	}
+	s.Retries = c.Retries
+	return s
+}
+
 /*
   0 [0.000000, 10.000000)		10 us
   1 [10.000000, 10.471285)
@@ -3,6 +3,7 @@
 package stats_test
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 	"time"
@@ -88,6 +89,30 @@ func TestTrxStats(t *testing.T) {
 	}
 }
 
+func TestTrxStats_Ring(t *testing.T) {
+	// More events than the ring holds: Record flushes when the ring is full,
+	// so no events are lost, and max is the last event
+	s := stats.NewTrx("t1")
+	n := 10000
+	for i := 1; i <= n; i++ {
+		s.Record(stats.WRITE, int64(i))
+	}
+	a := s.Swap()
+	if a.N[stats.WRITE] != uint64(n) || a.N[stats.TOTAL] != uint64(n) {
+		t.Errorf("got %d writes and %d total, expected %d", a.N[stats.WRITE], a.N[stats.TOTAL], n)
+	}
+	if a.Min[stats.WRITE] != 1 || a.Max[stats.WRITE] != int64(n) {
+		t.Errorf("got min %d max %d, expected 1 and %d", a.Min[stats.WRITE], a.Max[stats.WRITE], n)
+	}
+
+	// Flush records events in the active stats, so Peek sees them
+	s.Record(stats.COMMIT, 50)
+	s.Flush()
+	if p := s.Peek(); p.N[stats.COMMIT] != 1 {
+		t.Errorf("got %d commits, expected 1", p.N[stats.COMMIT])
+	}
+}
+
 func TestTrxStats_MultiThreaded(t *testing.T) {
 	finch.Debugging = true
 	cfg := config.Stats{
@@ -201,3 +226,83 @@ func TestPecentiles_P50(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestStatsJSON(t *testing.T) {
+	// Stats are encoded with sparse buckets when sent to the server, so
+	// decoding must restore the full histogram
+	s := stats.NewStats()
+	s.Record(stats.READ, 100)
+	s.Record(stats.READ, 250)
+	s.Record(stats.WRITE, 5000)
+	s.Errors[1062] = 2
+	s.Retries = 1
+	in := stats.NewInstance("c1")
+	in.Interval = 3
+	in.Total = s
+	in.Trx["t1"] = s
+
+	b, err := json.Marshal([]stats.Instance{in, in})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > 1000 {
+		t.Errorf("encoded 2 instances as %d bytes, expected < 1000 with sparse buckets", len(b))
+	}
+	got, err := stats.DecodeInstances(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, []stats.Instance{in, in}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Single instance, not a batch
+	b, _ = json.Marshal(in)
+	got, err = stats.DecodeInstances(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, []stats.Instance{in}); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := stats.DecodeInstances([]byte(`{"Total":{"b":[[450,1],[],[],[]],"min":[0,0,0,0],"max":[0,0,0,0],"n":[1,0,0,0]}}`)); err == nil {
+		t.Error("no error for bucket out of range")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	if stats.NewGuard(config.Compute{MaxCPU: "0", MaxGCPause: "0"}) != nil {
+		t.Error("NewGuard returned a Guard with max-cpu and max-gc-pause 0, expected nil")
+	}
+
+	g := stats.NewGuard(config.Compute{MaxCPU: "0.001", MaxGCPause: "0"})
+	g.Start()
+	for end := time.Now().Add(50 * time.Millisecond); time.Now().Before(end); {
+		// Use CPU
+	}
+	if over := g.Check(); len(over) != 1 {
+		t.Errorf("Check returned %v, expected 1 message for max-cpu", over)
+	}
+	expect := []string{"c1: CPU > max-cpu 0.001%"}
+	if diff := deep.Equal(g.Flags("c1", false), expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(g.Flags("c1", true), expect); diff != nil {
+		t.Error(diff) // not reset on previous call
+	}
+	if flags := g.Flags("c1", true); flags != nil {
+		t.Errorf("Flags returned %v after reset, expected nil", flags)
+	}
+
+	// Flags are deduplicated when combined
+	a := stats.NewInstance("c1")
+	a.ClientBound = expect
+	b := stats.NewInstance("c2")
+	b.ClientBound = []string{"c2: CPU > max-cpu 90%"}
+	all := stats.NewInstance("")
+	all.Combine([]stats.Instance{a, b, a})
+	if diff := deep.Equal(all.ClientBound, []string{expect[0], b.ClientBound[0]}); diff != nil {
+		t.Error(diff)
+	}
+}
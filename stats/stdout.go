@@ -5,11 +5,14 @@ package stats
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	h "github.com/dustin/go-humanize"
 	"github.com/square/finch"
+	"github.com/square/finch/config"
 )
 
 // Stdout is a Reporter that prints stats to STDOUT. This is the default when
@@ -21,16 +24,38 @@ import (
 //	      combined:      true
 //	      each-instance: false
 //	      percentiles:   "P999"
+//	      summary:       true
+//
+// Option run is the run ID (set by the server), which is printed before the
+// first report.
+//
+// With stats from more than one compute instance, Stop prints a summary of each
+// compute for the whole stage and computes with outlier throughput or latency,
+// so one bad compute can be identified rather than skewing the combined stats.
 type Stdout struct {
-	p        []float64
-	w        *tabwriter.Writer
-	header   string
-	all      *Instance
-	each     bool
-	combined bool
+	p         []float64
+	w         *tabwriter.Writer
+	header    string
+	all       *Instance
+	each      bool
+	combined  bool
+	summary   bool
+	computes  map[string]*Instance // totals per compute (summary)
+	order     []string             // computes in order reported
+	intervals uint
+	bound     []string // client-bound flags from all intervals (Guard)
+	util      float64  // load generator utilization: sum of Util * Seconds
+	utilSec   float64  //   sum of Seconds
+	utilMax   Instance //   interval with max Util (Hostname, Interval, Util)
+	run       string
+	reported  bool
+	sqlite    bool          // mysql.flavor: sqlite; stats not comparable
+	coarse    time.Duration // stats.clock: coarse resolution; 0 if monotonic
 }
 
 var _ Reporter = &Stdout{}
+var _ VersionReporter = &Stdout{}
+var _ ClockReporter = &Stdout{}
 
 func NewStdout(opts map[string]string) (*Stdout, error) {
 	sP, nP, err := ParsePercentiles(opts["percentiles"])
@@ -44,6 +69,7 @@ func NewStdout(opts map[string]string) (*Stdout, error) {
 		strings.Join(withPrefix(sP, "w_"), ","), // write
 		strings.Join(withPrefix(sP, "c_"), ","), // commit
 	)
+	header = strings.Replace(header, ",compute", ",retries,compute", 1) // not in csv by default
 	header = strings.ReplaceAll(header, ",", "\t")
 	r := &Stdout{
 		p:        nP,
@@ -51,6 +77,12 @@ func NewStdout(opts map[string]string) (*Stdout, error) {
 		header:   header,
 		each:     finch.Bool(opts["each-instance"]),
 		combined: finch.Bool(opts["combined"]),
+		summary:  true,
+		computes: map[string]*Instance{},
+		run:      opts["run"],
+	}
+	if v, ok := opts["summary"]; ok {
+		r.summary = finch.Bool(v)
 	}
 
 	_, ok1 := opts["each-instance"]
@@ -69,7 +101,44 @@ func NewStdout(opts map[string]string) (*Stdout, error) {
 	return r, nil
 }
 
+// SetVersion marks every report as not comparable if the server is SQLite
+// (mysql.flavor: sqlite), which is only for developing trx files.
+func (r *Stdout) SetVersion(version string) {
+	r.sqlite = strings.HasPrefix(version, "SQLite")
+}
+
+// SetClock notes in every report that response times are accurate only to the
+// resolution of the coarse clock (stats.clock: coarse).
+func (r *Stdout) SetClock(clock string, resolution time.Duration) {
+	if clock == config.CLOCK_COARSE {
+		r.coarse = resolution
+	}
+}
+
 func (r *Stdout) Report(from []Instance) {
+	if r.summary {
+		r.intervals++
+		for i := range from {
+			in, ok := r.computes[from[i].Hostname]
+			if !ok {
+				c := NewInstance(from[i].Hostname)
+				in = &c
+				r.computes[from[i].Hostname] = in
+				r.order = append(r.order, from[i].Hostname)
+			}
+			in.Add(from[i])
+		}
+	}
+	if !r.reported && r.run != "" {
+		fmt.Printf("Run %s\n", r.run)
+	}
+	r.reported = true
+	if r.sqlite {
+		fmt.Println("SQLite: stats are not comparable to MySQL")
+	}
+	if r.coarse > 0 {
+		fmt.Printf("Coarse clock: response times are accurate to %s\n", r.coarse)
+	}
 	fmt.Fprintln(r.w, r.header)
 	if r.each {
 		for i := range from {
@@ -81,6 +150,17 @@ func (r *Stdout) Report(from []Instance) {
 		r.print(r.all)
 	}
 	r.w.Flush()
+	for i := range from {
+		for _, f := range from[i].ClientBound {
+			fmt.Println("Client-bound:", f)
+		}
+		r.bound = addFlags(r.bound, from[i].ClientBound)
+		r.util += from[i].Util * from[i].Seconds
+		r.utilSec += from[i].Seconds
+		if r.utilMax.Interval == 0 || from[i].Util > r.utilMax.Util {
+			r.utilMax = Instance{Hostname: from[i].Hostname, Interval: from[i].Interval, Util: from[i].Util}
+		}
+	}
 	fmt.Println()
 }
 
@@ -90,37 +170,38 @@ func (r *Stdout) print(in *Instance) {
 	for _, v := range s.Errors {
 		errorCount += v
 	}
-	line := fmt.Sprintf("%d\t%.1f\t%.1f\t%d\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\n",
+	line := fmt.Sprintf("%d\t%.1f\t%.1f\t%d\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\tP\t%s\t%s\t%s\t%s\n",
 		in.Interval,
 		in.Seconds, // duration (of interval)
 		in.Runtime,
 		in.Clients,
 
 		// TOTAL
-		h.Comma(int64(float64(s.N[TOTAL])/in.Seconds)), // QPS
+		rate(s.N[TOTAL], in.Seconds), // QPS
 		h.Comma(s.Min[TOTAL]),
 		// P
 		h.Comma(s.Max[TOTAL]),
 
 		// READ
-		h.Comma(int64(float64(s.N[READ])/in.Seconds)),
+		rate(s.N[READ], in.Seconds),
 		h.Comma(s.Min[READ]),
 		// P
 		h.Comma(s.Max[READ]),
 
 		// WRITE
-		h.Comma(int64(float64(s.N[WRITE])/in.Seconds)),
+		rate(s.N[WRITE], in.Seconds),
 		h.Comma(s.Min[WRITE]),
 		// P
 		h.Comma(s.Max[WRITE]),
 
 		// COMMIT
-		h.Comma(int64(float64(s.N[COMMIT])/in.Seconds)), // TPS
+		rate(s.N[COMMIT], in.Seconds), // TPS
 		h.Comma(s.Min[COMMIT]),
 		// P
 		h.Comma(s.Max[COMMIT]),
 
 		h.Comma(int64(errorCount)),
+		h.Comma(int64(s.Retries)),
 
 		in.Hostname,
 	)
@@ -134,4 +215,95 @@ func (r *Stdout) print(in *Instance) {
 	fmt.Fprintf(r.w, line)
 }
 
-func (r *Stdout) Stop() {}
+// Stop prints the per-compute summary if there are stats from more than one
+// compute. The summary table is not printed if there's only one report that
+// printed each instance already, but outliers are always printed. If any compute
+// was client-bound, a warning is always printed because the stats measure the
+// limits of the compute, not the database.
+func (r *Stdout) Stop() {
+	if r.utilSec > 0 {
+		m := r.utilMax
+		fmt.Printf("Load generator utilization: %.0f%% average, %.0f%% max (%s interval %d)\n\n", r.util/r.utilSec, m.Util, m.Hostname, m.Interval)
+		if m.Util >= ClientBoundUtil && len(r.bound) == 0 {
+			fmt.Printf("WARNING: results might be client-bound: load generator utilization %.0f%% on %s in interval %d\n\n", m.Util, m.Hostname, m.Interval)
+		}
+	}
+	if len(r.bound) > 0 {
+		fmt.Printf("WARNING: results are client-bound: %s\n\n", strings.Join(r.bound, ", "))
+	}
+	if !r.summary || len(r.computes) < 2 {
+		return
+	}
+	each := make([]Instance, len(r.order))
+	for i, name := range r.order {
+		each[i] = *r.computes[name]
+	}
+	if r.intervals > 1 || !r.each {
+		fmt.Println("Summary (all intervals):")
+		fmt.Fprintln(r.w, r.header)
+		for i := range each {
+			r.print(&each[i])
+		}
+		all := NewInstance("")
+		all.Combine(each)
+		r.print(&all)
+		r.w.Flush()
+		fmt.Println()
+	}
+	for _, o := range Outliers(each) {
+		fmt.Println("Outlier compute:", o)
+	}
+}
+
+// Outliers returns a message for each compute with outlier throughput or latency
+// compared to the median of the other computes: QPS per client less than half,
+// or P99 latency more than double. A compute instance far from the database
+// (network latency) or short on resources is usually the cause.
+func Outliers(each []Instance) []string {
+	if len(each) < 2 {
+		return nil
+	}
+	qps := make([]float64, len(each)) // per client
+	p99 := make([]float64, len(each))
+	for i := range each {
+		if each[i].Seconds > 0 && each[i].Clients > 0 {
+			qps[i] = float64(each[i].Total.N[TOTAL]) / each[i].Seconds / float64(each[i].Clients)
+		}
+		if each[i].Total.N[TOTAL] > 0 {
+			p99[i] = float64(each[i].Total.Percentiles(TOTAL, []float64{99})[0])
+		}
+	}
+	var msgs []string
+	for i := range each {
+		if m := medianExcept(qps, i); m > 0 && qps[i] < m/2 {
+			msgs = append(msgs, fmt.Sprintf("%s: QPS per client %.1f is less than half the other computes (median %.1f)", each[i].Hostname, qps[i], m))
+		}
+		if m := medianExcept(p99, i); m > 0 && p99[i] > m*2 {
+			msgs = append(msgs, fmt.Sprintf("%s: P99 %s us is more than double the other computes (median %s us)", each[i].Hostname, h.Comma(int64(p99[i])), h.Comma(int64(m))))
+		}
+	}
+	return msgs
+}
+
+// medianExcept returns the median of v without v[i].
+func medianExcept(v []float64, i int) float64 {
+	others := make([]float64, 0, len(v)-1)
+	others = append(others, v[:i]...)
+	others = append(others, v[i+1:]...)
+	sort.Float64s(others)
+	n := len(others)
+	if n%2 == 1 {
+		return others[n/2]
+	}
+	return (others[n/2-1] + others[n/2]) / 2
+}
+
+// rate returns n per second. Rates less than 1 are printed with decimals, else
+// long-running queries (like 1 query per minute) would print as zero QPS.
+func rate(n uint64, seconds float64) string {
+	r := float64(n) / seconds
+	if r > 0 && r < 1 {
+		return fmt.Sprintf("%.3f", r)
+	}
+	return h.Comma(int64(r))
+}
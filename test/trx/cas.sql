@@ -0,0 +1,9 @@
+BEGIN
+
+-- save-columns: @v
+SELECT v FROM t WHERE id = @id
+
+-- cas: 5
+UPDATE t SET v = v + 1 WHERE id = @id AND v = @v
+
+COMMIT
@@ -0,0 +1,8 @@
+SELECT c FROM t WHERE id BETWEEN @r AND @PREV
+
+SELECT c FROM t WHERE id BETWEEN @r AND 100
+
+SELECT c FROM t WHERE id = @d AND c LIKE 'a%'
+
+-- prepare
+SELECT c FROM t WHERE id = @d AND c = ? AND d = '?'
@@ -0,0 +1,11 @@
+-- prepare
+ADD app.users {"_id": @id, "name": "finch"}
+
+-- prepare
+FIND app.users WHERE _id = @id
+
+-- prepare
+MODIFY app.users SET name = 'bird' WHERE _id = @id
+
+-- prepare
+REMOVE app.users WHERE _id = @id
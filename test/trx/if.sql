@@ -0,0 +1,14 @@
+UPDATE t SET c = @c WHERE id = @id
+
+-- if: ${params.with_index}
+UPDATE t SET k = @c WHERE id = @id
+-- end-if
+
+-- if: ${params.engine} == rocksdb
+-- prepare
+-- else
+-- if: !${params.with_index}
+-- prepare
+-- end-if
+-- end-if
+DELETE FROM t WHERE id = @id
@@ -0,0 +1,3 @@
+SELECT 1
+
+-- include: include-cycle.sql
@@ -0,0 +1,5 @@
+-- include: include/begin.sql
+
+UPDATE t SET c = c + 1 WHERE id = @id
+
+-- include: include/commit.sql
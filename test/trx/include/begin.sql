@@ -0,0 +1,3 @@
+SET SESSION transaction_isolation = 'READ-COMMITTED'
+
+BEGIN
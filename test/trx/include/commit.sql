@@ -0,0 +1 @@
+COMMIT
@@ -0,0 +1,5 @@
+-- save-columns: @c
+-- if-no-rows: regenerate 3
+select c from t1 where id=@id
+
+insert into t2 values (@c)
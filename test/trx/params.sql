@@ -0,0 +1,4 @@
+-- rows: $params.rows
+INSERT INTO t VALUES (@id, JSON_EXTRACT(@c, '$.a'))
+
+SELECT c FROM t WHERE id <= $params.rows LIMIT ${params.n}
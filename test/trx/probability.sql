@@ -0,0 +1,7 @@
+SELECT c FROM t WHERE id = 1
+
+-- probability: 0.1
+UPDATE t SET c = c + 1 WHERE id = 1
+
+-- probability: 1
+DELETE FROM t WHERE id = 1
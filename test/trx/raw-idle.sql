@@ -0,0 +1,4 @@
+SELECT 1;
+-- idle: 5ms
+SELECT 2;
+SELECT 3;
@@ -0,0 +1,9 @@
+BEGIN
+
+-- repeat: 100
+INSERT INTO t VALUES (@id, @c)
+
+UPDATE t SET c = @c WHERE id = @id
+-- end-repeat
+
+COMMIT
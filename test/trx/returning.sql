@@ -0,0 +1,4 @@
+-- save-columns: @id, _
+INSERT INTO t (c) VALUES (@c) RETURNING id, c
+
+DELETE FROM t WHERE id = @id
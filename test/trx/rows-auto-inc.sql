@@ -0,0 +1,2 @@
+-- rows: 1000
+INSERT INTO t VALUES (@id, @name)
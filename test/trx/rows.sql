@@ -0,0 +1,4 @@
+-- rows: 1000
+INSERT INTO t VALUES (NULL, 'a')
+
+SELECT COUNT(*) FROM t
@@ -0,0 +1,23 @@
+-- MySQL dump 10.13
+--
+-- Host: localhost    Database: test
+/*!40101 SET NAMES utf8mb4 */;
+
+DROP TABLE IF EXISTS `t`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+CREATE TABLE `t` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `c` varchar(100) DEFAULT 'a;b', # not a delimiter
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+DELIMITER ;;
+CREATE PROCEDURE p()
+BEGIN
+  SELECT 'x%';
+  SELECT 2;
+END ;;
+DELIMITER ;
+
+/* plain comment; removed */
+INSERT INTO t VALUES (1, 'it\'s');
@@ -0,0 +1,11 @@
+BEGIN
+
+-- tags: secondary-index
+SELECT c FROM t WHERE c = 1
+
+-- tags: pk, point
+SELECT c FROM t WHERE id = 1
+
+UPDATE t SET c = 2 WHERE id = 1
+
+COMMIT
@@ -0,0 +1,4 @@
+INSERT INTO t (id{{range seq 3}}, c{{.}}{{end}}) VALUES (@id{{range seq 3}}, @c{{end}})
+{{range seq .Params.shards}}
+DELETE FROM t_{{.}} WHERE id = @id
+{{end}}
@@ -0,0 +1,114 @@
+// Copyright 2024 Block, Inc.
+
+package trx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check checks that each statement has one placeholder for each data key and
+// one data key for each value generated: "?" for prepared statements, else fmt
+// verbs like "%d". A mismatch doesn't fail Load, but the statement will fail
+// or use the wrong values when run. All errors are returned, not only the first,
+// for "finch validate".
+func Check(set *Set) []error {
+	errs := []error{}
+	for _, trxName := range set.Order {
+		for _, s := range set.Statements[trxName] {
+			if s.Query == "" {
+				continue // idle
+			}
+
+			// Values generated for the data keys. A generator that returns
+			// multiple values, like int-range, needs @PREV for each extra value.
+			values := 0
+			for _, name := range s.Inputs {
+				if name == "@PREV" {
+					continue
+				}
+				if k, ok := set.Data.Keys[name]; ok && k.Generator != nil {
+					n, _ := k.Generator.Format()
+					values += int(n)
+				}
+			}
+			if values != len(s.Inputs) {
+				errs = append(errs, s.errorf("data keys %s generate %d values for %d data keys: use @PREV once for each additional value of a generator that returns multiple values, like int-range: \"BETWEEN @d AND @PREV\"",
+					strings.Join(s.Inputs, ", "), values, len(s.Inputs)))
+			}
+
+			if s.Prepare {
+				if n := placeholders(s.Query); n != len(s.Inputs) {
+					errs = append(errs, s.errorf("prepared statement has %d ? placeholders but %d data keys", n, len(s.Inputs)))
+				}
+			} else if n := verbs(s.Query); n != len(s.Inputs) {
+				errs = append(errs, s.errorf("statement has %d %% placeholders but %d data keys: write a literal %% as %%%%, like \"LIKE 'a%%%%'\"", n, len(s.Inputs)))
+			}
+		}
+	}
+	return errs
+}
+
+// CheckNoTrx checks that no statement requires transactions or insert IDs, which
+// ClickHouse (mysql.flavor: clickhouse) doesn't have: BEGIN, COMMIT, cas, and
+// save-insert-id. Like Check, all errors are returned.
+func CheckNoTrx(set *Set) []error {
+	errs := []error{}
+	for _, trxName := range set.Order {
+		for _, s := range set.Statements[trxName] {
+			switch {
+			case s.Begin || s.Commit:
+				errs = append(errs, s.errorf("no transactions: remove BEGIN and COMMIT"))
+			case s.CAS > 0:
+				errs = append(errs, s.errorf("no transactions: cas not allowed"))
+			case s.InsertId != "":
+				errs = append(errs, s.errorf("no insert IDs: save-insert-id not allowed"))
+			}
+		}
+	}
+	return errs
+}
+
+func (s *Statement) errorf(format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if s.Line == 0 {
+		return fmt.Errorf("%s: %s", s.File, msg)
+	}
+	return fmt.Errorf("%s line %d: %s", s.File, s.Line, msg)
+}
+
+// placeholders returns the number of "?" placeholders in the SQL query, ignoring
+// "?" in quoted strings and identifiers.
+func placeholders(query string) int {
+	n := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '?':
+			n++
+		case '\'', '"', '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// verbs returns the number of fmt verbs in a non-prepared query, which the
+// client formats with the data key values. "%%" is a literal "%", not a verb.
+func verbs(query string) int {
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '%' {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Block, Inc.
+
+package trx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var reDelimiter = regexp.MustCompile(`(?i)^\s*DELIMITER\s+(\S+)\s*$`)
+
+// SplitSQL splits plain SQL into statements like the mysql client: statements
+// end with the current delimiter (default ";"), which is changed by DELIMITER
+// lines. Comments are removed except executable comments (/*! ... */) and
+// optimizer hints (/*+ ... */) that MySQL needs. Delimiters in quotes and
+// comments are ignored. Empty statements are ignored.
+func SplitSQL(sql string) ([]string, error) {
+	stmts := []string{}
+	delim := ";"
+	var stmt strings.Builder
+
+	end := func() {
+		if q := strings.TrimSpace(stmt.String()); q != "" {
+			stmts = append(stmts, q)
+		}
+		stmt.Reset()
+	}
+
+	lineStart := true
+	for i := 0; i < len(sql); {
+		// DELIMITER is a mysql client command, not SQL, so it's only valid
+		// on its own line between statements
+		if lineStart && strings.TrimSpace(stmt.String()) == "" {
+			eol := strings.IndexByte(sql[i:], '\n')
+			if eol < 0 {
+				eol = len(sql) - i
+			}
+			if m := reDelimiter.FindStringSubmatch(sql[i : i+eol]); m != nil {
+				delim = m[1]
+				stmt.Reset()
+				i += eol
+				continue
+			}
+		}
+		lineStart = false
+
+		c := sql[i]
+		switch {
+		case c == '\n':
+			lineStart = true
+			stmt.WriteByte(c)
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			// Quoted string or identifier: copy through closing quote
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\\' && c != '`' {
+					j++ // skip escaped char
+					continue
+				}
+				if sql[j] == c {
+					break
+				}
+			}
+			if j >= len(sql) {
+				return nil, fmt.Errorf("unterminated %c quote: %.40s", c, sql[i:])
+			}
+			stmt.WriteString(sql[i : j+1])
+			i = j + 1
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "--") && (i+2 == len(sql) || strings.ContainsRune(" \t\r\n", rune(sql[i+2])))):
+			// Single-line comment: skip to end of line but keep the newline
+			eol := strings.IndexByte(sql[i:], '\n')
+			if eol < 0 {
+				i = len(sql)
+			} else {
+				i += eol
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			j := strings.Index(sql[i+2:], "*/")
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated comment: %.40s", sql[i:])
+			}
+			j += i + 4 // past */
+			if strings.HasPrefix(sql[i:], "/*!") || strings.HasPrefix(sql[i:], "/*+") {
+				stmt.WriteString(sql[i:j])
+			} else {
+				stmt.WriteByte(' ')
+			}
+			i = j
+		case strings.HasPrefix(sql[i:], delim):
+			end()
+			i += len(delim)
+		default:
+			stmt.WriteByte(c)
+			i++
+		}
+	}
+	end()
+	return stmts, nil
+}
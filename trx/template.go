@@ -0,0 +1,144 @@
+// Copyright 2024 Block, Inc.
+
+package trx
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data passed to a trx file template (stage.trx[].template=true).
+type TemplateData struct {
+	Params map[string]string // stage.params
+	Env    map[string]string // environment variables
+}
+
+// Template funcs that take numbers also accept strings like "10" because
+// stage.params values are strings.
+var templateFuncs = template.FuncMap{
+	// seq N returns [1, 2, ..., N]; seq M N returns [M, M+1, ..., N]
+	"seq": func(args ...interface{}) ([]int, error) {
+		n, err := toInts(args...)
+		if err != nil {
+			return nil, fmt.Errorf("seq: %s", err)
+		}
+		var first, last int
+		switch len(n) {
+		case 1:
+			first, last = 1, n[0]
+		case 2:
+			first, last = n[0], n[1]
+		default:
+			return nil, fmt.Errorf("seq: expected 1 or 2 args, got %d", len(n))
+		}
+		if last < first {
+			return []int{}, nil
+		}
+		s := make([]int, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			s = append(s, i)
+		}
+		return s, nil
+	},
+	"int": func(v interface{}) (int, error) {
+		n, err := toInts(v)
+		if err != nil {
+			return 0, err
+		}
+		return n[0], nil
+	},
+	"add": func(a, b interface{}) (int, error) {
+		n, err := toInts(a, b)
+		if err != nil {
+			return 0, fmt.Errorf("add: %s", err)
+		}
+		return n[0] + n[1], nil
+	},
+	"sub": func(a, b interface{}) (int, error) {
+		n, err := toInts(a, b)
+		if err != nil {
+			return 0, fmt.Errorf("sub: %s", err)
+		}
+		return n[0] - n[1], nil
+	},
+	"mul": func(a, b interface{}) (int, error) {
+		n, err := toInts(a, b)
+		if err != nil {
+			return 0, fmt.Errorf("mul: %s", err)
+		}
+		return n[0] * n[1], nil
+	},
+	"rand": func(max interface{}) (int, error) {
+		n, err := toInts(max)
+		if err != nil {
+			return 0, fmt.Errorf("rand: %s", err)
+		}
+		if n[0] < 1 {
+			return 0, fmt.Errorf("rand: %d invalid: must be >= 1", n[0])
+		}
+		return rand.Intn(n[0]), nil
+	},
+	// repeat N SEP S returns S repeated N times separated by SEP
+	"repeat": func(count interface{}, sep, s string) (string, error) {
+		n, err := toInts(count)
+		if err != nil {
+			return "", fmt.Errorf("repeat: %s", err)
+		}
+		if n[0] < 1 {
+			return "", nil
+		}
+		return strings.TrimSuffix(strings.Repeat(s+sep, n[0]), sep), nil
+	},
+	"join": strings.Join,
+}
+
+func toInts(args ...interface{}) ([]int, error) {
+	n := make([]int, len(args))
+	for i, v := range args {
+		switch v := v.(type) {
+		case int:
+			n[i] = v
+		case string:
+			d, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not an integer", v)
+			}
+			n[i] = d
+		default:
+			return nil, fmt.Errorf("%v (%T) is not an integer", v, v)
+		}
+	}
+	return n, nil
+}
+
+// Template executes the trx file as a Go text/template and returns the output,
+// which is parsed as a normal trx file.
+func Template(file string, params map[string]string) ([]byte, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(file).Funcs(templateFuncs).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %s: %s", file, err)
+	}
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, TemplateData{Params: params, Env: env}); err != nil {
+		return nil, fmt.Errorf("executing template %s: %s", file, err)
+	}
+	return out.Bytes(), nil
+}
@@ -4,9 +4,12 @@ package trx
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -26,6 +29,16 @@ const (
 	END   = byte(0x2)
 )
 
+// No-rows policies (Statement.NoRows) for a SELECT that saves columns
+// (save-columns) but returns zero rows. See the if-no-rows modifier.
+const (
+	NO_ROWS_IGNORE     = byte(iota) // default: keep previous column values (nil if none)
+	NO_ROWS_RETRY                   // re-execute with the same input values
+	NO_ROWS_REGENERATE              // re-execute with new input values
+	NO_ROWS_SKIP                    // skip statements in the trx that use the columns
+	NO_ROWS_ERROR                   // stop client with ErrNoRows
+)
+
 const EXPLICIT_CALL_SUFFIX = "()"
 
 var DataKeyPattern = regexp.MustCompile(`@[\w_-]+(?:\(\))?`)
@@ -42,6 +55,8 @@ type Set struct {
 // Statement is one query in a transaction and all its read-only metadata.
 type Statement struct {
 	Trx          string
+	File         string // trx file or included file
+	Line         uint   // first line of statement in File (0 if unknown)
 	Query        string
 	ResultSet    bool
 	Prepare      bool
@@ -56,6 +71,14 @@ type Statement struct {
 	InsertId     string   // data key (special output)
 	Limit        limit.Data
 	Calls        []byte
+	NoRows       byte    // NO_ROWS_* const
+	NoRowsRetry  int     // for NO_ROWS_RETRY and NO_ROWS_REGENERATE
+	CAS          int     // max retries if zero rows affected (-- cas)
+	CASFrom      int     // retry from this many statements back (0 = self)
+	Probability  float64 // execute on this fraction of iterations (0 = always)
+	Repeat       int     // last statement in repeat block: total passes (-- repeat)
+	RepeatFrom   int     // last statement in repeat block: statements back to first
+	Tags         []string
 }
 
 type Meta struct {
@@ -85,8 +108,13 @@ func Load(trxFiles []config.Trx, scope *data.Scope, params map[string]string) (*
 
 var ErrEOF = fmt.Errorf("EOF")
 
+// ErrNoRows is returned by a client when a statement with "-- if-no-rows: error"
+// returns zero rows.
+var ErrNoRows = fmt.Errorf("no rows for saved columns")
+
 type lineBuf struct {
 	n      uint
+	start  uint // line number of first line in str or mods
 	str    string
 	mods   []string
 	copyNo uint
@@ -105,6 +133,10 @@ type File struct {
 	stmtNo  uint           // 1-indexed in file (not a line number; not an index into stmt)
 	stmts   []*Statement   // all statements in this file
 	hasDDL  bool           // true if any statement is DDL
+	include []string       // stack of included files (-- include) to detect cycles
+	repeat  int            // -- repeat: N while in block, else 0
+	repeatI int            // index into stmts of first statement in repeat block
+	cond    []bool         // stack of -- if conditions: true if lines are included
 }
 
 func NewFile(cfg config.Trx, set *Set, params map[string]string) *File {
@@ -121,31 +153,66 @@ func NewFile(cfg config.Trx, set *Set, params map[string]string) *File {
 
 func (f *File) Load() error {
 	finch.Debug("loading %s", f.cfg.File)
-	file, err := os.Open(f.cfg.File)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		err = f.line(strings.TrimSpace(scanner.Text()))
+	f.include = []string{filepath.Clean(f.cfg.File)}
+	var r io.Reader
+	if f.cfg.Template {
+		out, err := Template(f.cfg.File, f.params)
 		if err != nil {
-			if err == ErrEOF {
-				break
-			}
 			return err
 		}
+		r = bytes.NewReader(out)
+	} else {
+		file, err := os.Open(f.cfg.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
 	}
-	err = f.line("") // last line
-	if err != nil {
-		return err
+
+	if f.cfg.Raw {
+		if err := f.raw(r); err != nil {
+			return err
+		}
+	} else {
+		if err := f.scan(r); err != nil {
+			return err
+		}
 	}
 
 	if len(f.stmts) == 0 {
 		return fmt.Errorf("trx file %s has no statements; at least 1 is required", f.cfg.File)
 	}
 
+	if f.repeat > 0 {
+		return fmt.Errorf("trx file %s has -- repeat without -- end-repeat", f.cfg.File)
+	}
+	if len(f.cond) > 0 {
+		return fmt.Errorf("trx file %s has -- if without -- end-if", f.cfg.File)
+	}
+
+	// For -- cas, retry from the first statement that saves a column used by
+	// the CAS statement, which is usually the SELECT that reads the version.
+	for i, s := range f.stmts {
+		if s.CAS == 0 {
+			continue
+		}
+		inputs := map[string]bool{}
+		for _, dataKey := range s.Inputs {
+			inputs[dataKey] = true
+		}
+	READ:
+		for j := 0; j < i; j++ {
+			for _, dataKey := range f.stmts[j].Outputs {
+				if inputs[dataKey] {
+					s.CASFrom = i - j
+					break READ
+				}
+			}
+		}
+		finch.Debug("cas: statement %d retry from %d", i+1, i+1-s.CASFrom)
+	}
+
 	noRefs := []string{}
 	for col, refs := range f.colRefs {
 		if refs > 0 {
@@ -157,10 +224,6 @@ func (f *File) Load() error {
 		return fmt.Errorf("saved columns not referenced: %s", strings.Join(noRefs, ", "))
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err) // shouldn't happen
-	}
-
 	f.set.Order = append(f.set.Order, f.cfg.Name)
 	f.set.Statements[f.cfg.Name] = f.stmts
 	f.set.Meta[f.cfg.Name] = Meta{
@@ -170,16 +233,113 @@ func (f *File) Load() error {
 	return nil
 }
 
+// scan reads a Finch trx file line by line.
+func (f *File) scan(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		err := f.line(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			if err == ErrEOF {
+				break
+			}
+			return err
+		}
+	}
+	if err := f.line(""); err != nil { // last line
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err) // shouldn't happen
+	}
+	return nil
+}
+
+// raw reads a plain SQL file (stage.trx[].raw=true), like a mysqldump schema,
+// and makes one statement per SQL statement, executed verbatim. There are no
+// modifiers, data keys, or other Finch trx file syntax except "-- idle: TIME"
+// on its own line between statements, which makes an idle statement.
+func (f *File) raw(r io.Reader) error {
+	sql, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// Split on idle lines, then split the SQL between them into statements
+	var chunk strings.Builder
+	flush := func() error {
+		queries, err := SplitSQL(chunk.String())
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %s", f.cfg.File, err)
+		}
+		chunk.Reset()
+		for _, query := range queries {
+			f.stmtNo++
+			s := &Statement{
+				Trx:   f.cfg.Name,
+				File:  f.cfg.File,
+				Query: strings.ReplaceAll(query, "%", "%%"), // client uses query as fmt format
+			}
+			f.switches(s, query)
+			f.stmts = append(f.stmts, s)
+		}
+		return nil
+	}
+	for _, line := range strings.SplitAfter(string(sql), "\n") {
+		m := reRawIdle.FindStringSubmatch(line)
+		if m == nil {
+			chunk.WriteString(line)
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(m[1])
+		if err != nil {
+			return fmt.Errorf("invalid idle in %s: '%s': %s", f.cfg.File, strings.TrimSpace(line), err)
+		}
+		f.stmtNo++
+		f.stmts = append(f.stmts, &Statement{Trx: f.cfg.Name, Idle: d})
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	finch.Debug("raw: %d statements, DDL %t", len(f.stmts), f.hasDDL)
+	return nil
+}
+
+var reRawIdle = regexp.MustCompile(`^--\s+idle:\s*(\S+)\s*$`)
+
 func (f *File) line(line string) error {
 	f.lb.n++
 
+	// Conditional lines: -- if, -- else, -- end-if. Lines in a false block
+	// are dropped as if they were not in the file.
+	if strings.HasPrefix(line, "-- if:") || line == "-- else" || line == "-- end-if" {
+		return f.condition(line)
+	}
+	for _, ok := range f.cond {
+		if !ok {
+			finch.Debug("line %d: skip (if false)", f.lb.n)
+			return nil
+		}
+	}
+
 	// More lines in statement
 	if line != "" {
 		finch.Debug("line %d: %s\n", f.lb.n, line)
+		if f.lb.str == "" && len(f.lb.mods) == 0 {
+			f.lb.start = f.lb.n
+		}
 		if strings.HasPrefix(line, "-- ") {
 			if line == "-- EOF" {
 				return ErrEOF
 			}
+			if strings.HasPrefix(line, "-- include:") {
+				return f.includeFile(line)
+			}
+			if strings.HasPrefix(line, "-- repeat:") || line == "-- end-repeat" {
+				return f.repeatBlock(line)
+			}
 			mod, err := config.Vars(strings.TrimSpace(strings.TrimPrefix(line, "--")), f.params, true)
 			if err != nil {
 				return fmt.Errorf("parsing modifier '%s' on line %d: %s", line, f.lb.n, err)
@@ -214,23 +374,164 @@ func (f *File) line(line string) error {
 	return nil
 }
 
-var reKeyVal = regexp.MustCompile(`([\w_-]+)(?:\:\s*(\w+))?`)
-var reCSV = regexp.MustCompile(`\/\*\!csv\s+(\d+)\s+(.+)\*\/`)
-var reFirstWord = regexp.MustCompile(`^(\w+)`)
+// includeFile reads statements from another file (-- include: FILE) as if
+// they were written in place of the include directive. The path is relative
+// to the directory of the file with the include directive.
+func (f *File) includeFile(line string) error {
+	if f.lb.str != "" || len(f.lb.mods) > 0 {
+		return fmt.Errorf("include on line %d must be between statements, not part of a statement: separate with a blank line and remove modifiers", f.lb.n)
+	}
+	file, err := config.Vars(strings.TrimSpace(strings.TrimPrefix(line, "-- include:")), f.params, true)
+	if err != nil {
+		return fmt.Errorf("parsing include '%s' on line %d: %s", line, f.lb.n, err)
+	}
+	if file == "" {
+		return fmt.Errorf("include on line %d: no file specified", f.lb.n)
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(f.include[len(f.include)-1]), file)
+	}
+	file = filepath.Clean(file)
+	for _, inc := range f.include {
+		if inc == file {
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(f.include, " -> "), file)
+		}
+	}
+	finch.Debug("include %s", file)
 
-func (f *File) statements() ([]*Statement, error) {
-	f.stmtNo++
-	s := &Statement{
-		Trx: f.cfg.Name, // trx name (trx.name or base(trx.file)
+	var lines []byte
+	if f.cfg.Template {
+		lines, err = Template(file, f.params)
+	} else {
+		lines, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("include on line %d: %s", f.lb.n, err)
 	}
 
-	query := strings.TrimSpace(f.lb.str)
-	finch.Debug("query raw: %s", query)
+	// Line numbers in error messages are relative to the included file, then
+	// restored to the line number of the include directive
+	n := f.lb.n
+	f.lb.n = 0
+	nCond := len(f.cond)
+	f.include = append(f.include, file)
+	defer func() {
+		f.include = f.include[:len(f.include)-1]
+		f.lb.n = n
+	}()
 
-	// ----------------------------------------------------------------------
-	// Switches
-	// ----------------------------------------------------------------------
+	scanner := bufio.NewScanner(bytes.NewReader(lines))
+	for scanner.Scan() {
+		if err := f.line(strings.TrimSpace(scanner.Text())); err != nil {
+			if err == ErrEOF {
+				break
+			}
+			return fmt.Errorf("in %s: %s", file, err)
+		}
+	}
+	if err := f.line(""); err != nil { // last statement in included file
+		return fmt.Errorf("in %s: %s", file, err)
+	}
+	if len(f.cond) != nCond {
+		return fmt.Errorf("in %s: -- if without -- end-if", file)
+	}
+	return scanner.Err()
+}
 
+// condition handles -- if: EXPR, -- else, and -- end-if. EXPR is interpolated
+// with stage.params and environment variables, then evaluated by ifTrue. Blocks
+// can be nested; an inner block is false if any outer block is false.
+func (f *File) condition(line string) error {
+	switch line {
+	case "-- end-if":
+		if len(f.cond) == 0 {
+			return fmt.Errorf("-- end-if on line %d without -- if", f.lb.n)
+		}
+		f.cond = f.cond[:len(f.cond)-1]
+		return nil
+	case "-- else":
+		if len(f.cond) == 0 {
+			return fmt.Errorf("-- else on line %d without -- if", f.lb.n)
+		}
+		f.cond[len(f.cond)-1] = !f.cond[len(f.cond)-1]
+		return nil
+	}
+
+	// Don't evaluate inner conditions in a false block: they might use params
+	// that are only defined when the outer condition is true
+	for _, ok := range f.cond {
+		if !ok {
+			f.cond = append(f.cond, false)
+			return nil
+		}
+	}
+
+	expr, err := config.Vars(strings.TrimSpace(strings.TrimPrefix(line, "-- if:")), f.params, false)
+	if err != nil {
+		return fmt.Errorf("parsing '%s' on line %d: %s", line, f.lb.n, err)
+	}
+	ok, err := config.IfTrue(expr)
+	if err != nil {
+		return fmt.Errorf("invalid condition on line %d: %s", f.lb.n, err)
+	}
+	finch.Debug("line %d: if %s = %t", f.lb.n, expr, ok)
+	f.cond = append(f.cond, ok)
+	return nil
+}
+
+// repeatBlock handles -- repeat: N and -- end-repeat. Statements in the block
+// are executed N times per iteration. Only the last statement in the block is
+// modified: it records N and how far back to jump (Statement.RepeatFrom).
+func (f *File) repeatBlock(line string) error {
+	if line == "-- end-repeat" && f.lb.str != "" {
+		if err := f.line(""); err != nil { // end of last statement in block
+			return err
+		}
+		f.lb.n-- // line("") counted a line that doesn't exist
+	}
+	if f.lb.str != "" || len(f.lb.mods) > 0 {
+		return fmt.Errorf("%s on line %d must be before or after a statement, not part of it: separate with a blank line and remove modifiers", line, f.lb.n)
+	}
+
+	if line == "-- end-repeat" {
+		if f.repeat == 0 {
+			return fmt.Errorf("-- end-repeat on line %d without -- repeat", f.lb.n)
+		}
+		if f.repeatI == len(f.stmts) {
+			return fmt.Errorf("empty repeat block ending on line %d", f.lb.n)
+		}
+		last := f.stmts[len(f.stmts)-1]
+		last.Repeat = f.repeat
+		last.RepeatFrom = len(f.stmts) - 1 - f.repeatI
+		finch.Debug("repeat %d: statements %d-%d", f.repeat, f.repeatI+1, len(f.stmts))
+		f.repeat = 0
+		return nil
+	}
+
+	if f.repeat > 0 {
+		return fmt.Errorf("nested -- repeat on line %d: repeat blocks cannot be nested", f.lb.n)
+	}
+	if len(f.stmts) == 0 {
+		// Repeating from the first statement in the file would re-enter the
+		// trx (file) boundary, which the client uses for stats
+		return fmt.Errorf("-- repeat on line %d: repeat block cannot start with the first statement; use iterations to repeat the whole trx", f.lb.n)
+	}
+	v, err := config.Vars(strings.TrimSpace(strings.TrimPrefix(line, "-- repeat:")), f.params, true)
+	if err != nil {
+		return fmt.Errorf("parsing '%s' on line %d: %s", line, f.lb.n, err)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid repeat on line %d: %s: must be an integer >= 1", f.lb.n, v)
+	}
+	f.repeat = n
+	f.repeatI = len(f.stmts)
+	return nil
+}
+
+// switches sets the statement type from the first word in the query and
+// returns the first word (uppercase).
+func (f *File) switches(s *Statement, query string) string {
 	// @todo regexp to extract first word
 	com := strings.ToUpper(reFirstWord.FindString(query))
 	switch com {
@@ -242,11 +543,67 @@ func (f *File) statements() ([]*Statement, error) {
 		s.Commit = true // used to measure TPS rate in client/client.go
 	case "INSERT", "UPDATE", "DELETE", "REPLACE":
 		s.Write = true
+		s.ResultSet = reReturning.MatchString(query) // MariaDB INSERT ... RETURNING
+	case "FIND": // X Protocol document store CRUD (mysql.protocol: x)
+		s.ResultSet = true
+	case "ADD", "MODIFY", "REMOVE":
+		s.Write = true
 	case "ALTER", "CREATE", "DROP", "RENAME", "TRUNCATE":
 		finch.Debug("DDL")
 		s.DDL = true    // statement is DDL
 		f.hasDDL = true // trx has DDL
 	}
+	return com
+}
+
+var reKeyVal = regexp.MustCompile(`([\w_-]+)(?:\:\s*(\w+))?`)
+var reCSV = regexp.MustCompile(`\/\*\!csv\s+(\d+)\s+(.+)\*\/`)
+var reFirstWord = regexp.MustCompile(`^(\w+)`)
+var reReturning = regexp.MustCompile(`(?i)\sRETURNING\s`)
+
+func (f *File) statements() ([]*Statement, error) {
+	f.stmtNo++
+	s := &Statement{
+		Trx:  f.cfg.Name, // trx name (trx.name or base(trx.file)
+		File: f.include[len(f.include)-1],
+		Line: f.lb.start,
+	}
+
+	// $params.name in the statement, like LIMIT $params.rows. Only params
+	// because $ can be SQL, like JSON path '$.a'.
+	query, err := config.ParamVars(strings.TrimSpace(f.lb.str), f.params, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s line %d: %s", f.include[len(f.include)-1], f.lb.start, err)
+	}
+	finch.Debug("query raw: %s", query)
+
+	// ----------------------------------------------------------------------
+	// Switches
+	// ----------------------------------------------------------------------
+
+	com := f.switches(s, query)
+
+	// ----------------------------------------------------------------------
+	// Tags: -- tags: a, b. Filter before other modifiers so a removed statement
+	// has no side effects, like save-columns.
+	// ----------------------------------------------------------------------
+
+	for _, mod := range f.lb.mods {
+		if !strings.HasPrefix(mod, "tags:") {
+			continue
+		}
+		tags := strings.FieldsFunc(strings.TrimPrefix(mod, "tags:"), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(tags) == 0 {
+			return nil, fmt.Errorf("invalid tags modifier: '%s': no tags", mod)
+		}
+		s.Tags = append(s.Tags, tags...)
+	}
+	if !f.cfg.Tags.Keep(s.Tags) {
+		finch.Debug("tags %v: removed", s.Tags)
+		return nil, nil
+	}
 
 	// ----------------------------------------------------------------------
 	// Modifiers: --prepare, --table-size, etc.
@@ -262,6 +619,8 @@ func (f *File) statements() ([]*Statement, error) {
 		switch m[0] {
 		case "prepare", "prepared":
 			s.Prepare = true
+		case "tags":
+			// Handled above
 		case "idle":
 			d, err := time.ParseDuration(m[1])
 			if err != nil {
@@ -297,10 +656,19 @@ func (f *File) statements() ([]*Statement, error) {
 				lm = limit.NewSize(max, m[2], m[1], "")
 			}
 			s.Limit = limit.Or(s.Limit, lm)
+		case "table-rows":
+			if len(m) != 3 {
+				return nil, fmt.Errorf("invalid table-rows modifier: split %d fields, expected 3: %s", len(m), mod)
+			}
+			max, err := strconv.ParseUint(m[2], 10, 64)
+			if err != nil || max == 0 {
+				return nil, fmt.Errorf("invalid table-rows limit: %s: must be an integer > 0", m[2])
+			}
+			s.Limit = limit.Or(s.Limit, limit.NewTableRows(int64(max), m[1]))
 		case "save-insert-id":
 			// @todo check len(m)
 			if s.ResultSet {
-				return nil, fmt.Errorf("save-insert-id not allowed on SELECT")
+				return nil, fmt.Errorf("save-insert-id not allowed on SELECT or RETURNING; use save-columns")
 			}
 			finch.Debug("save-insert-id")
 			dataKey, err := f.column(0, m[1])
@@ -319,6 +687,60 @@ func (f *File) statements() ([]*Statement, error) {
 				}
 				s.Outputs = append(s.Outputs, dataKey)
 			}
+		case "cas":
+			if !s.Write {
+				return nil, fmt.Errorf("cas not allowed on %s; only INSERT, UPDATE, DELETE, or REPLACE", com)
+			}
+			if s.ResultSet {
+				return nil, fmt.Errorf("cas not allowed with RETURNING")
+			}
+			s.CAS = 3
+			if len(m) > 1 {
+				n, err := strconv.Atoi(m[1])
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("invalid cas retries: %s: must be an integer >= 1", m[1])
+				}
+				s.CAS = n
+			}
+		case "probability":
+			if s.Begin || s.Commit {
+				return nil, fmt.Errorf("probability not allowed on %s; it would break the MySQL transaction", com)
+			}
+			if len(m) != 2 {
+				return nil, fmt.Errorf("invalid probability modifier: '%s': expected one value: probability: P", mod)
+			}
+			p, err := strconv.ParseFloat(m[1], 64)
+			if err != nil || p <= 0 || p > 1 {
+				return nil, fmt.Errorf("invalid probability: %s: must be a number > 0 and <= 1", m[1])
+			}
+			if p < 1 {
+				s.Probability = p
+			}
+		case "if-no-rows":
+			if len(m) < 2 {
+				return nil, fmt.Errorf("invalid if-no-rows modifier: '%s': missing policy: retry, regenerate, skip, or error", mod)
+			}
+			switch m[1] {
+			case "retry", "regenerate":
+				s.NoRows = NO_ROWS_RETRY
+				if m[1] == "regenerate" {
+					s.NoRows = NO_ROWS_REGENERATE
+				}
+				s.NoRowsRetry = 1
+				if len(m) == 3 {
+					n, err := strconv.Atoi(m[2])
+					if err != nil || n < 1 {
+						return nil, fmt.Errorf("invalid if-no-rows %s count: %s: must be an integer >= 1", m[1], m[2])
+					}
+					s.NoRowsRetry = n
+				}
+			case "skip":
+				s.NoRows = NO_ROWS_SKIP
+			case "error":
+				s.NoRows = NO_ROWS_ERROR
+			default:
+				return nil, fmt.Errorf("invalid if-no-rows policy: %s: valid policies are: retry, regenerate, skip, error", m[1])
+			}
 		case "copies":
 			n, err := strconv.Atoi(m[1])
 			if err != nil {
@@ -366,6 +788,10 @@ func (f *File) statements() ([]*Statement, error) {
 		}
 	}
 
+	if s.NoRows != NO_ROWS_IGNORE && (!s.ResultSet || len(s.Outputs) == 0) {
+		return nil, fmt.Errorf("if-no-rows requires a SELECT with save-columns")
+	}
+
 	// ----------------------------------------------------------------------
 	// Replace /*!copy-number*/
 	// ----------------------------------------------------------------------
@@ -470,6 +896,9 @@ func (f *File) statements() ([]*Statement, error) {
 
 				if dataCfg.Scope == "" {
 					dataCfg.Scope = finch.SCOPE_STATEMENT
+					if dataCfg.Generator == "table" {
+						dataCfg.Scope = finch.SCOPE_ITER // same table for all statements in an iteration
+					}
 					f.cfg.Data[name] = dataCfg
 				}
 
@@ -481,6 +910,14 @@ func (f *File) statements() ([]*Statement, error) {
 				if err != nil {
 					return nil, err
 				}
+				if dataCfg.Batch > 1 {
+					if _, ok := g.(data.BatchWriter); !ok {
+						return nil, fmt.Errorf("%s: %s data generator does not support batch", name, dataCfg.Generator)
+					}
+					if finch.RunLevelNumber(dataCfg.Scope) > finch.RunLevelNumber(finch.SCOPE_CLIENT) {
+						return nil, fmt.Errorf("%s: batch requires value, statement, trx, iter, or client scope, not %s", name, dataCfg.Scope)
+					}
+				}
 				f.set.Data.Keys[name] = data.Key{
 					Name:      name,
 					Trx:       f.cfg.Name,
@@ -488,6 +925,7 @@ func (f *File) statements() ([]*Statement, error) {
 					Statement: f.stmtNo,
 					Column:    -1,
 					Scope:     dataCfg.Scope,
+					Batch:     dataCfg.Batch,
 					Generator: g,
 				}
 				finch.Debug("%#v", k)
@@ -495,6 +933,9 @@ func (f *File) statements() ([]*Statement, error) {
 		}
 
 		if s.Prepare {
+			if g.Name() == "table" {
+				return nil, fmt.Errorf("%s: table data generator cannot be used in a prepared statement because MySQL cannot prepare table names", name)
+			}
 			dataFormats[name] = "?"
 		} else {
 			_, dataFormats[name] = g.Format()
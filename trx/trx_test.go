@@ -3,13 +3,16 @@
 package trx_test
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 
 	"github.com/square/finch"
 	"github.com/square/finch/config"
 	"github.com/square/finch/data"
+	"github.com/square/finch/limit"
 	"github.com/square/finch/trx"
 )
 
@@ -41,6 +44,8 @@ func TestLoad_001(t *testing.T) {
 			"001.sql": []*trx.Statement{
 				{
 					Trx:       "001.sql",
+					File:      "../test/trx/001.sql",
+					Line:      1,
 					Query:     "select c from t where id=%d",
 					Inputs:    []string{"@id"},
 					ResultSet: true,
@@ -100,6 +105,8 @@ func TestLoad_002(t *testing.T) {
 			"002.sql": []*trx.Statement{
 				{
 					Trx:       "002.sql",
+					File:      "../test/trx/002.sql",
+					Line:      2,
 					Query:     "SELECT c FROM t WHERE id BETWEEN %d AND %d",
 					Inputs:    []string{"@d", "@PREV"},
 					ResultSet: true,
@@ -161,6 +168,8 @@ func TestLoad_003(t *testing.T) {
 			"003.sql": []*trx.Statement{
 				{
 					Trx:       "003.sql",
+					File:      "../test/trx/003.sql",
+					Line:      3,
 					Query:     "select c from t1 where id=1",
 					Inputs:    nil,
 					Outputs:   []string{"@c"},
@@ -169,6 +178,8 @@ func TestLoad_003(t *testing.T) {
 				},
 				{
 					Trx:     "003.sql",
+					File:    "../test/trx/003.sql",
+					Line:    7,
 					Query:   "insert into t2 values ('%v')",
 					Inputs:  []string{"@c"},
 					Outputs: nil,
@@ -211,6 +222,8 @@ func TestLoad_copy3(t *testing.T) {
 			"copy3": []*trx.Statement{
 				{
 					Trx:          "copy3",
+					File:         "../test/trx/copy3-1.sql",
+					Line:         2,
 					Query:        "select c from t where id=?",
 					Inputs:       []string{"@id"},
 					ResultSet:    true,
@@ -220,6 +233,8 @@ func TestLoad_copy3(t *testing.T) {
 				},
 				{
 					Trx:          "copy3",
+					File:         "../test/trx/copy3-1.sql",
+					Line:         2,
 					Query:        "select c from t where id=?",
 					Inputs:       []string{"@id"},
 					ResultSet:    true,
@@ -230,6 +245,8 @@ func TestLoad_copy3(t *testing.T) {
 
 				{
 					Trx:          "copy3",
+					File:         "../test/trx/copy3-1.sql",
+					Line:         2,
 					Query:        "select c from t where id=?",
 					Inputs:       []string{"@id"},
 					ResultSet:    true,
@@ -295,6 +312,10 @@ func TestLoad_copy3(t *testing.T) {
 		},
 	}
 
+	for _, s := range expect.Statements["copy3"] {
+		s.File = "../test/trx/copy3-2.sql"
+	}
+
 	scope = data.NewScope()
 	got, err = trx.Load(trxList, scope, p)
 	if err != nil {
@@ -314,11 +335,15 @@ func TestLoad_COPY_NUMBER(t *testing.T) {
 			"copyNo": []*trx.Statement{
 				{
 					Trx:       "copyNo",
+					File:      "../test/trx/copy-no.sql",
+					Line:      2,
 					Query:     "select c from t1 where id=1",
 					ResultSet: true,
 				},
 				{
 					Trx:       "copyNo",
+					File:      "../test/trx/copy-no.sql",
+					Line:      2,
 					Query:     "select c from t2 where id=1",
 					ResultSet: true,
 				},
@@ -383,6 +408,8 @@ func TestLoad_RowScopeCSV(t *testing.T) {
 			file: []*trx.Statement{
 				{
 					Trx:       file,
+					File:      "../test/trx/" + file,
+					Line:      1,
 					Query:     "SELECT 1 -- (%d, %d %% 1000, '%d', '%d'), (%d, %d %% 1000, '%d', '%d')",
 					Inputs:    []string{"@d", "@d", "@d", "@d", "@d", "@d", "@d", "@d"},
 					Calls:     []byte{1, 0, 0, 0, 1, 0, 0, 0},
@@ -391,6 +418,8 @@ func TestLoad_RowScopeCSV(t *testing.T) {
 
 				{
 					Trx:       file,
+					File:      "../test/trx/" + file,
+					Line:      3,
 					Query:     "SELECT 1 -- (%d, %d %% 1000, '%d', '%d'), (%d, %d %% 1000, '%d', '%d')",
 					Inputs:    []string{"@d", "@d", "@d", "@d", "@d", "@d", "@d", "@d"},
 					Calls:     []byte{1, 0, 0, 0, 1, 0, 0, 0},
@@ -470,3 +499,540 @@ func TestRowScope(t *testing.T) {
 		}
 	}
 }
+
+func TestLoad_IfNoRows(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "no-rows.sql", // must set because we don't call Validate
+			File: "../test/trx/no-rows.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "int",
+				},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["no-rows.sql"]
+	if len(s) != 2 {
+		t.Fatalf("got %d statements, expected 2", len(s))
+	}
+	if s[0].NoRows != trx.NO_ROWS_REGENERATE {
+		t.Errorf("NoRows = %d, expected %d (NO_ROWS_REGENERATE)", s[0].NoRows, trx.NO_ROWS_REGENERATE)
+	}
+	if s[0].NoRowsRetry != 3 {
+		t.Errorf("NoRowsRetry = %d, expected 3", s[0].NoRowsRetry)
+	}
+	if s[1].NoRows != trx.NO_ROWS_IGNORE {
+		t.Errorf("NoRows = %d on statement without if-no-rows, expected 0 (NO_ROWS_IGNORE)", s[1].NoRows)
+	}
+}
+
+func TestLoad_CAS(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "cas.sql", // must set because we don't call Validate
+			File: "../test/trx/cas.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "int",
+					Scope:     finch.SCOPE_TRX,
+				},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["cas.sql"]
+	if len(s) != 4 {
+		t.Fatalf("got %d statements, expected 4", len(s))
+	}
+	if s[2].CAS != 5 {
+		t.Errorf("CAS = %d, expected 5", s[2].CAS)
+	}
+	if s[2].CASFrom != 1 {
+		t.Errorf("CASFrom = %d, expected 1 (retry from SELECT)", s[2].CASFrom)
+	}
+}
+
+func TestLoad_Returning(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "returning.sql", // must set because we don't call Validate
+			File: "../test/trx/returning.sql",
+			Data: map[string]config.Data{
+				"c": {
+					Generator: "int",
+					Scope:     finch.SCOPE_STATEMENT,
+				},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["returning.sql"]
+	if len(s) != 2 {
+		t.Fatalf("got %d statements, expected 2", len(s))
+	}
+	if !s[0].Write || !s[0].ResultSet {
+		t.Errorf("INSERT ... RETURNING: Write = %t, ResultSet = %t, expected both true", s[0].Write, s[0].ResultSet)
+	}
+	if !s[1].Write || s[1].ResultSet {
+		t.Errorf("DELETE: Write = %t, ResultSet = %t, expected Write only", s[1].Write, s[1].ResultSet)
+	}
+}
+
+func TestLoad_Probability(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "probability.sql", // must set because we don't call Validate
+			File: "../test/trx/probability.sql",
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["probability.sql"]
+	if len(s) != 3 {
+		t.Fatalf("got %d statements, expected 3", len(s))
+	}
+	if s[0].Probability != 0 {
+		t.Errorf("stmt 1 Probability = %f, expected 0 (not set)", s[0].Probability)
+	}
+	if s[1].Probability != 0.1 {
+		t.Errorf("stmt 2 Probability = %f, expected 0.1", s[1].Probability)
+	}
+	if s[2].Probability != 0 {
+		t.Errorf("stmt 3 Probability = %f, expected 0 (1 = always)", s[2].Probability)
+	}
+}
+
+func TestLoad_Template(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name:     "template.sql", // must set because we don't call Validate
+			File:     "../test/trx/template.sql",
+			Template: true,
+			Data: map[string]config.Data{
+				"id": {Generator: "int"},
+				"c":  {Generator: "int"},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, map[string]string{"shards": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["template.sql"]
+	if len(s) != 3 {
+		t.Fatalf("got %d statements, expected 3", len(s))
+	}
+	expect := []string{
+		"INSERT INTO t (id, c1, c2, c3) VALUES (%d, %d, %d, %d)",
+		"DELETE FROM t_1 WHERE id = %d",
+		"DELETE FROM t_2 WHERE id = %d",
+	}
+	for i := range expect {
+		if s[i].Query != expect[i] {
+			t.Errorf("stmt %d: got '%s', expected '%s'", i+1, s[i].Query, expect[i])
+		}
+	}
+}
+
+func TestLoad_Include(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "include.sql", // must set because we don't call Validate
+			File: "../test/trx/include.sql",
+			Data: map[string]config.Data{
+				"id": {Generator: "int"},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["include.sql"]
+	expect := []string{
+		"SET SESSION transaction_isolation = 'READ-COMMITTED'",
+		"BEGIN",
+		"UPDATE t SET c = c + 1 WHERE id = %d",
+		"COMMIT",
+	}
+	if len(s) != len(expect) {
+		t.Fatalf("got %d statements, expected %d", len(s), len(expect))
+	}
+	for i := range expect {
+		if s[i].Query != expect[i] {
+			t.Errorf("stmt %d: got '%s', expected '%s'", i+1, s[i].Query, expect[i])
+		}
+	}
+	if !s[1].Begin || !s[3].Commit {
+		t.Errorf("included BEGIN and COMMIT not detected: %+v, %+v", s[1], s[3])
+	}
+
+	// Including itself is an error
+	trxList = []config.Trx{
+		{
+			Name: "include-cycle.sql",
+			File: "../test/trx/include-cycle.sql",
+		},
+	}
+	_, err = trx.Load(trxList, data.NewScope(), p)
+	if err == nil {
+		t.Errorf("no error on include cycle, expected one")
+	}
+}
+
+func TestLoad_Repeat(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "repeat.sql", // must set because we don't call Validate
+			File: "../test/trx/repeat.sql",
+			Data: map[string]config.Data{
+				"id": {Generator: "int"},
+				"c":  {Generator: "int"},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["repeat.sql"]
+	if len(s) != 4 {
+		t.Fatalf("got %d statements, expected 4", len(s))
+	}
+	for i := range s {
+		if i == 2 {
+			continue
+		}
+		if s[i].Repeat != 0 {
+			t.Errorf("stmt %d Repeat = %d, expected 0", i+1, s[i].Repeat)
+		}
+	}
+	if s[2].Repeat != 100 {
+		t.Errorf("Repeat = %d, expected 100", s[2].Repeat)
+	}
+	if s[2].RepeatFrom != 1 {
+		t.Errorf("RepeatFrom = %d, expected 1", s[2].RepeatFrom)
+	}
+}
+
+func TestLoad_If(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "if.sql", // must set because we don't call Validate
+			File: "../test/trx/if.sql",
+			Data: map[string]config.Data{
+				"id": {Generator: "int"},
+				"c":  {Generator: "int"},
+			},
+		},
+	}
+
+	tests := []struct {
+		params  map[string]string
+		nStmts  int
+		prepare bool // last statement
+	}{
+		{map[string]string{"with_index": "true", "engine": "innodb"}, 3, false},
+		{map[string]string{"with_index": "false", "engine": "innodb"}, 2, true},
+		{map[string]string{"with_index": "1", "engine": "rocksdb"}, 3, true},
+	}
+	for _, test := range tests {
+		got, err := trx.Load(trxList, data.NewScope(), test.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := got.Statements["if.sql"]
+		if len(s) != test.nStmts {
+			t.Errorf("%v: got %d statements, expected %d", test.params, len(s), test.nStmts)
+			continue
+		}
+		if s[len(s)-1].Prepare != test.prepare {
+			t.Errorf("%v: prepare %t, expected %t", test.params, s[len(s)-1].Prepare, test.prepare)
+		}
+	}
+}
+
+func TestLoad_Raw(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "schema-dump.sql", // must set because we don't call Validate
+			File: "../test/trx/schema-dump.sql",
+			Raw:  true,
+		},
+	}
+
+	got, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["schema-dump.sql"]
+	expect := []string{
+		"/*!40101 SET NAMES utf8mb4 */",
+		"DROP TABLE IF EXISTS `t`",
+		"/*!40101 SET @saved_cs_client     = @@character_set_client */",
+		"CREATE TABLE `t` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  `c` varchar(100) DEFAULT 'a;b', \n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		"CREATE PROCEDURE p()\nBEGIN\n  SELECT 'x%%';\n  SELECT 2;\nEND",
+		"INSERT INTO t VALUES (1, 'it\\'s')",
+	}
+	if len(s) != len(expect) {
+		for i := range s {
+			t.Logf("%d: %s", i+1, s[i].Query)
+		}
+		t.Fatalf("got %d statements, expected %d", len(s), len(expect))
+	}
+	for i := range expect {
+		if s[i].Query != expect[i] {
+			t.Errorf("stmt %d: got '%s', expected '%s'", i+1, s[i].Query, expect[i])
+		}
+		if len(s[i].Inputs) > 0 {
+			t.Errorf("stmt %d has inputs %v, expected none", i+1, s[i].Inputs)
+		}
+	}
+	if !got.Meta["schema-dump.sql"].DDL {
+		t.Errorf("DDL not detected")
+	}
+}
+
+func TestLoad_RawIdle(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "raw-idle.sql",
+			File: "../test/trx/raw-idle.sql",
+			Raw:  true,
+		},
+	}
+
+	got, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["raw-idle.sql"]
+	if len(s) != 4 {
+		t.Fatalf("got %d statements, expected 4", len(s))
+	}
+	if s[1].Idle != 5*time.Millisecond || s[1].Query != "" {
+		t.Errorf("stmt 2: got %+v, expected idle 5ms", *s[1])
+	}
+	if s[2].Query != "SELECT 2" || s[3].Query != "SELECT 3" {
+		t.Errorf("got stmt 3 '%s' and 4 '%s', expected SELECT 2 and SELECT 3", s[2].Query, s[3].Query)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "check.sql",
+			File: "../test/trx/check.sql",
+			Data: map[string]config.Data{
+				"r": {Generator: "int-range"},
+				"d": {Generator: "int"},
+			},
+		},
+	}
+
+	got, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := trx.Check(got)
+	expect := []string{
+		"../test/trx/check.sql line 3:",
+		"../test/trx/check.sql line 5:",
+		"../test/trx/check.sql line 7:",
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expect), errs)
+	}
+	for i := range expect {
+		if !strings.HasPrefix(errs[i].Error(), expect[i]) {
+			t.Errorf("error %d: got '%s', expected prefix '%s'", i+1, errs[i], expect[i])
+		}
+	}
+}
+
+func TestLoad_Params(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "params.sql", // must set because we don't call Validate
+			File: "../test/trx/params.sql",
+			Data: map[string]config.Data{
+				"id": {Generator: "int"},
+				"c":  {Generator: "int"},
+			},
+		},
+	}
+
+	params := map[string]string{"rows": "10k", "n": "5"}
+	got, err := trx.Load(trxList, data.NewScope(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["params.sql"]
+	expect := []string{
+		"INSERT INTO t VALUES (%d, JSON_EXTRACT(%d, '$.a'))", // $.a not a param
+		"SELECT c FROM t WHERE id <= 10000 LIMIT 5",
+	}
+	if len(s) != len(expect) {
+		t.Fatalf("got %d statements, expected %d", len(s), len(expect))
+	}
+	for i := range expect {
+		if s[i].Query != expect[i] {
+			t.Errorf("stmt %d: got '%s', expected '%s'", i+1, s[i].Query, expect[i])
+		}
+	}
+	if lm := limit.RowsLimit(s[0].Limit); lm == nil {
+		t.Error("no rows limit on statement 1")
+	}
+
+	// Undefined param is an error
+	if _, err := trx.Load(trxList, data.NewScope(), map[string]string{"rows": "1"}); err == nil {
+		t.Error("undefined param n: no error, expected one")
+	}
+}
+
+func TestLoad_Tags(t *testing.T) {
+	tests := []struct {
+		tags   config.Tags
+		expect []string
+	}{
+		{
+			tags: config.Tags{},
+			expect: []string{
+				"BEGIN",
+				"SELECT c FROM t WHERE c = 1",
+				"SELECT c FROM t WHERE id = 1",
+				"UPDATE t SET c = 2 WHERE id = 1",
+				"COMMIT",
+			},
+		},
+		{
+			tags: config.Tags{Disable: []string{"secondary-index"}},
+			expect: []string{
+				"BEGIN",
+				"SELECT c FROM t WHERE id = 1",
+				"UPDATE t SET c = 2 WHERE id = 1",
+				"COMMIT",
+			},
+		},
+		{
+			tags: config.Tags{Enable: []string{"secondary-index"}},
+			expect: []string{
+				"BEGIN",
+				"SELECT c FROM t WHERE c = 1",
+				"UPDATE t SET c = 2 WHERE id = 1",
+				"COMMIT",
+			},
+		},
+		{
+			// Disable wins: pk statement removed even though point is enabled
+			tags: config.Tags{Enable: []string{"point"}, Disable: []string{"pk"}},
+			expect: []string{
+				"BEGIN",
+				"UPDATE t SET c = 2 WHERE id = 1",
+				"COMMIT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		trxList := []config.Trx{
+			{
+				Name: "tags.sql", // must set because we don't call Validate
+				File: "../test/trx/tags.sql",
+				Tags: tt.tags,
+			},
+		}
+		got, err := trx.Load(trxList, data.NewScope(), nil)
+		if err != nil {
+			t.Fatalf("%+v: %s", tt.tags, err)
+		}
+		s := got.Statements["tags.sql"]
+		queries := make([]string, len(s))
+		for i := range s {
+			queries[i] = s[i].Query
+		}
+		if diff := deep.Equal(queries, tt.expect); diff != nil {
+			t.Errorf("tags %+v: %v", tt.tags, diff)
+		}
+	}
+}
+
+func TestCheckNoTrx(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "cas.sql",
+			File: "../test/trx/cas.sql",
+			Data: map[string]config.Data{
+				"id": {Generator: "int", Scope: finch.SCOPE_TRX},
+			},
+		},
+	}
+	got, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := trx.CheckNoTrx(got)
+	if len(errs) != 3 { // BEGIN, cas, COMMIT
+		t.Errorf("got %d errors, expected 3: %v", len(errs), errs)
+	}
+}
+
+func TestLoad_DocStore(t *testing.T) {
+	trxList := []config.Trx{
+		{
+			Name: "docstore.sql", // must set because we don't call Validate
+			File: "../test/trx/docstore.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "int",
+					Scope:     finch.SCOPE_TRX,
+				},
+			},
+		},
+	}
+
+	scope := data.NewScope()
+	got, err := trx.Load(trxList, scope, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got.Statements["docstore.sql"]
+	if len(s) != 4 {
+		t.Fatalf("got %d statements, expected 4", len(s))
+	}
+	if !s[0].Write || s[0].ResultSet {
+		t.Errorf("ADD: Write = %t, ResultSet = %t, expected Write only", s[0].Write, s[0].ResultSet)
+	}
+	if s[1].Write || !s[1].ResultSet {
+		t.Errorf("FIND: Write = %t, ResultSet = %t, expected ResultSet only", s[1].Write, s[1].ResultSet)
+	}
+	if !s[2].Write || !s[3].Write {
+		t.Errorf("MODIFY and REMOVE: Write = %t, %t, expected true", s[2].Write, s[3].Write)
+	}
+}
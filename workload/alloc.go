@@ -0,0 +1,241 @@
+// Copyright 2024 Block, Inc.
+
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/square/finch/data"
+)
+
+// Allocation is the workload allocated by Groups and Clients as data: which
+// clients run which trx, which data generators each client uses (and so which
+// clients share a generator because of its scope), and how QPS and TPS limiters
+// are combined for each client. It's printed by --dry-run-format json or dot to
+// debug allocation and data scope without reading the allocator code.
+type Allocation struct {
+	Stage      uint             `json:"stage"`
+	StageName  string           `json:"stage_name"`
+	ExecGroups []ExecGroupAlloc `json:"exec_groups"`
+	Generators []GeneratorAlloc `json:"generators"`
+	Limiters   []LimiterAlloc   `json:"limiters"`
+	Load       string           `json:"load,omitempty"` // table loaded by config.stage.load (allocated on run)
+}
+
+type ExecGroupAlloc struct {
+	N            uint               `json:"n"`
+	Name         string             `json:"name"`
+	ClientGroups []ClientGroupAlloc `json:"client_groups"`
+}
+
+type ClientGroupAlloc struct {
+	N       uint          `json:"n"`
+	Trx     []string      `json:"trx"`
+	Target  string        `json:"target,omitempty"`
+	Clients []ClientAlloc `json:"clients"`
+}
+
+// ClientAlloc is one client. QPS and TPS are the Id of the innermost limiter
+// that the client waits on, if any; follow LimiterAlloc.Parent for the others.
+type ClientAlloc struct {
+	Id         string   `json:"id"`         // e1/g1/c1
+	Generators []string `json:"generators"` // GeneratorAlloc.Id in statement order, no duplicates
+	QPS        string   `json:"qps,omitempty"`
+	TPS        string   `json:"tps,omitempty"`
+}
+
+// GeneratorAlloc is one copy of a data generator (data.Scope.Copy).
+type GeneratorAlloc struct {
+	Id      string   `json:"id"` // @d(copy number)
+	Key     string   `json:"key"`
+	Type    string   `json:"type"`
+	Scope   string   `json:"scope"`
+	Clients []string `json:"clients"` // ClientAlloc.Id of clients that use it
+}
+
+// LimiterAlloc is one rate limiter (limit.Rate). Limiters are combined with
+// limit.And, so a client waits on its limiter and every parent. Limiters for
+// options qps and tps are per client: every client has its own instance.
+type LimiterAlloc struct {
+	Id     string `json:"id"`     // like e1/g1/qps-clients
+	Option string `json:"option"` // config option: qps, qps-exec-group, etc.
+	Rate   string `json:"rate"`   // per second
+	Parent string `json:"parent,omitempty"`
+}
+
+// Allocation returns the workload allocated by Groups and Clients. qps and tps
+// are config.stage.qps and config.stage.tps, which aren't part of the Allocator
+// (only their limiters are).
+func (a *Allocator) Allocation(groups [][]int, clients [][]ClientGroup, qps, tps string) Allocation {
+	al := Allocation{
+		Stage:      a.Stage,
+		StageName:  a.StageName,
+		ExecGroups: make([]ExecGroupAlloc, len(groups)),
+		Generators: []GeneratorAlloc{},
+		Limiters:   []LimiterAlloc{},
+	}
+	stageQPS := al.limiter("", "qps", qps, "")
+	stageTPS := al.limiter("", "tps", tps, "")
+
+	gens := map[data.Id]int{} // Generators index
+	for egNo := range groups {
+		cgFirst := a.Workload[groups[egNo][0]]
+		egId := fmt.Sprintf("e%d/", egNo+1)
+		egQPS := al.limiter(egId, "qps-exec-group", cgFirst.QPSExecGroup, stageQPS)
+		egTPS := al.limiter(egId, "tps-exec-group", cgFirst.TPSExecGroup, stageTPS)
+		al.ExecGroups[egNo] = ExecGroupAlloc{
+			N:            uint(egNo + 1),
+			Name:         cgFirst.Group,
+			ClientGroups: make([]ClientGroupAlloc, len(groups[egNo])),
+		}
+		for cgNo, refNo := range groups[egNo] {
+			cg := a.Workload[refNo]
+			cgId := fmt.Sprintf("%sg%d/", egId, cgNo+1)
+			cgQPS := al.limiter(cgId, "qps-clients", cg.QPSClients, egQPS)
+			cgTPS := al.limiter(cgId, "tps-clients", cg.TPSClients, egTPS)
+			cQPS := al.limiter(cgId, "qps", cg.QPS, cgQPS)
+			cTPS := al.limiter(cgId, "tps", cg.TPS, cgTPS)
+			cga := ClientGroupAlloc{
+				N:       uint(cgNo + 1),
+				Trx:     cg.Trx,
+				Target:  cg.Target,
+				Clients: make([]ClientAlloc, len(clients[egNo][cgNo].Clients)),
+			}
+			for k := range cga.Clients {
+				ca := ClientAlloc{
+					Id:         fmt.Sprintf("%sc%d", cgId, k+1),
+					Generators: []string{},
+					QPS:        cQPS,
+					TPS:        cTPS,
+				}
+				seen := map[data.Id]bool{}
+				var ids []data.Id
+				if k < len(clients[egNo][cgNo].Generators) {
+					ids = clients[egNo][cgNo].Generators[k]
+				}
+				for _, id := range ids {
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+					i, ok := gens[id]
+					if !ok {
+						i = len(al.Generators)
+						gens[id] = i
+						al.Generators = append(al.Generators, GeneratorAlloc{
+							Id:      fmt.Sprintf("%s(%d)", id.DataKey, id.CopyNo),
+							Key:     id.DataKey,
+							Type:    id.Type,
+							Scope:   id.Scope,
+							Clients: []string{},
+						})
+					}
+					al.Generators[i].Clients = append(al.Generators[i].Clients, ca.Id)
+					ca.Generators = append(ca.Generators, al.Generators[i].Id)
+				}
+				cga.Clients[k] = ca
+			}
+			al.ExecGroups[egNo].ClientGroups[cgNo] = cga
+		}
+	}
+	sort.SliceStable(al.Generators, func(i, j int) bool { return al.Generators[i].Key < al.Generators[j].Key })
+	return al
+}
+
+// limiter adds a limiter for option if rate is set and returns its Id, else it
+// returns parent because limit.And(parent, nil) is parent.
+func (al *Allocation) limiter(prefix, option, rate, parent string) string {
+	if rate == "" || rate == "0" {
+		return parent
+	}
+	id := prefix + option
+	if prefix == "" {
+		id = "stage/" + option
+	}
+	al.Limiters = append(al.Limiters, LimiterAlloc{
+		Id:     id,
+		Option: option,
+		Rate:   rate,
+		Parent: parent,
+	})
+	return id
+}
+
+// JSON writes the allocation as indented JSON.
+func (al Allocation) JSON(w io.Writer) error {
+	bytes, err := json.MarshalIndent(al, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(bytes))
+	return err
+}
+
+// Dot writes the allocation as a Graphviz digraph: a cluster for each exec group
+// and client group, client -> trx, client -> data generator (labeled with its
+// scope), and client -> limiter -> parent limiter (dashed). Render it with, for
+// example, dot -Tsvg.
+func (al Allocation) Dot(w io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %q {\n", fmt.Sprintf("stage %d %s", al.Stage, al.StageName))
+	fmt.Fprintf(b, "  rankdir=LR;\n  node [shape=box, fontsize=10];\n")
+	if al.Load != "" {
+		fmt.Fprintf(b, "  %q;\n", "load "+al.Load+" (allocated on run)")
+	}
+	trx := map[string]bool{}
+	for _, eg := range al.ExecGroups {
+		fmt.Fprintf(b, "  subgraph \"cluster_e%d\" {\n    label=%q;\n", eg.N, fmt.Sprintf("exec group %d: %s", eg.N, eg.Name))
+		for _, cg := range eg.ClientGroups {
+			label := fmt.Sprintf("client group %d", cg.N)
+			if cg.Target != "" {
+				label += " @ " + cg.Target
+			}
+			fmt.Fprintf(b, "    subgraph \"cluster_e%d_g%d\" {\n      label=%q;\n", eg.N, cg.N, label)
+			for _, c := range cg.Clients {
+				fmt.Fprintf(b, "      %q [shape=ellipse];\n", c.Id)
+			}
+			fmt.Fprintf(b, "    }\n")
+		}
+		fmt.Fprintf(b, "  }\n")
+	}
+	for _, eg := range al.ExecGroups {
+		for _, cg := range eg.ClientGroups {
+			for _, trxName := range cg.Trx {
+				if !trx[trxName] {
+					trx[trxName] = true
+					fmt.Fprintf(b, "  %q [shape=note];\n", trxName)
+				}
+			}
+			for _, c := range cg.Clients {
+				for _, trxName := range cg.Trx {
+					fmt.Fprintf(b, "  %q -> %q;\n", c.Id, trxName)
+				}
+				for _, g := range c.Generators {
+					fmt.Fprintf(b, "  %q -> %q [color=blue];\n", c.Id, g)
+				}
+				if c.QPS != "" {
+					fmt.Fprintf(b, "  %q -> %q [style=dashed];\n", c.Id, c.QPS)
+				}
+				if c.TPS != "" {
+					fmt.Fprintf(b, "  %q -> %q [style=dashed];\n", c.Id, c.TPS)
+				}
+			}
+		}
+	}
+	for _, g := range al.Generators {
+		fmt.Fprintf(b, "  %q [shape=cylinder, color=blue, label=%q];\n", g.Id, fmt.Sprintf("%s\n%s, scope %s", g.Id, g.Type, g.Scope))
+	}
+	for _, l := range al.Limiters {
+		fmt.Fprintf(b, "  %q [shape=hexagon, label=%q];\n", l.Id, fmt.Sprintf("%s\n%s/s", l.Id, l.Rate))
+		if l.Parent != "" {
+			fmt.Fprintf(b, "  %q -> %q [style=dashed];\n", l.Id, l.Parent)
+		}
+	}
+	fmt.Fprintf(b, "}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
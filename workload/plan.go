@@ -0,0 +1,88 @@
+// Copyright 2024 Block, Inc.
+
+package workload
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Plan prints the workload allocated by Groups and Clients: exec groups, client
+// groups, number of clients, trx assigned to each client group, limits, and data
+// keys. This is printed by --dry-run to verify the allocation without running it.
+func (a *Allocator) Plan(w io.Writer, groups [][]int, clients [][]ClientGroup) {
+	for egNo := range groups {
+		cgFirst := a.Workload[groups[egNo][0]]
+		fmt.Fprintf(w, "  Exec group %d: %s%s\n", egNo+1, cgFirst.Group, Options(
+			"qps", cgFirst.QPSExecGroup,
+			"tps", cgFirst.TPSExecGroup,
+			"iter", cgFirst.IterExecGroup,
+			"start-after", cgFirst.StartAfter,
+		))
+		for cgNo, egRefNo := range groups[egNo] {
+			cg := a.Workload[egRefNo]
+			fmt.Fprintf(w, "    Client group %d: %d clients%s\n", cgNo+1, len(clients[egNo][cgNo].Clients), Options(
+				"runtime", cg.Runtime,
+				"iter", cg.Iter,
+				"iter-clients", cg.IterClients,
+				"qps", cg.QPS,
+				"qps-clients", cg.QPSClients,
+				"tps", cg.TPS,
+				"tps-clients", cg.TPSClients,
+				"start-jitter", cg.StartJitter,
+				"pipeline", cg.Pipeline,
+				"connections", cg.Connections,
+				"db", cg.Db,
+				"target", cg.Target,
+			))
+			trx := make([]string, len(cg.Trx))
+			for i, trxName := range cg.Trx {
+				trx[i] = fmt.Sprintf("%s (%d statements)", trxName, len(a.TrxSet.Statements[trxName]))
+				if len(cg.Weights) > 0 {
+					trx[i] += " weight " + cg.Weights[i]
+				}
+			}
+			fmt.Fprintf(w, "      trx: %s\n", strings.Join(trx, ", "))
+			if clients[egNo][cgNo].DataLimit {
+				fmt.Fprintf(w, "      data limit: clients stop when a -- rows, table-size, or database-size limit is reached\n")
+			}
+		}
+	}
+
+	// Data keys in this stage. Data.Keys is global (all stages), so skip keys
+	// from trx in other stages.
+	names := []string{}
+	for name, k := range a.TrxSet.Data.Keys {
+		if _, ok := a.TrxSet.Statements[k.Trx]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "  Data keys:\n")
+	for _, name := range names {
+		k := a.TrxSet.Data.Keys[name]
+		g := "-"
+		if k.Generator != nil {
+			g = k.Generator.Name()
+		}
+		fmt.Fprintf(w, "    %s: %s, scope %s, %s\n", name, g, k.Scope, k)
+	}
+}
+
+// Options returns ", key value" for each key-value pair with a non-zero value,
+// else an empty string.
+func Options(kv ...string) string {
+	s := ""
+	for i := 0; i < len(kv)-1; i += 2 {
+		if kv[i+1] == "" || kv[i+1] == "0" {
+			continue
+		}
+		s += fmt.Sprintf(", %s %s", kv[i], kv[i+1])
+	}
+	return s
+}
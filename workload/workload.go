@@ -3,7 +3,10 @@
 package workload
 
 import (
+	"database/sql"
 	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/square/finch"
@@ -30,6 +33,27 @@ type Allocator struct {
 	StageQPS  limit.Rate           // config.stage.qps
 	StageTPS  limit.Rate           // config.stage.tps
 	DoneChan  chan *client.Client  // Stage.doneChan
+
+	QueryComment bool             // config.stage.query-comment
+	RunId        string           // config.stage.RunId for query comment
+	QueryHint    string           // config.stage.query-hint
+	Counters     *client.Counters // config.stage.exit
+	Share        *client.Share    // config.stage.compute.elastic
+	Pause        *client.Pause    // server control API
+	Failover     *client.Failover // config.stage.failover
+
+	// SpreadTargets are Group Replication PRIMARY members (targets) that client
+	// groups without a target are split across (see spread).
+	SpreadTargets []string // config.stage.group-replication.spread-writes
+
+	ErrorHandling map[uint16]byte // config.stage.mysql.flavor (finch.ErrorHandling)
+	Proxy         bool            // config.stage.mysql.ClientPrepare(): vitess, proxysql, or clickhouse
+	FastPath      bool            // config.stage.mysql.fast-path
+	Clock         stats.Clock     // config.stats.clock
+	PinClients    bool            // config.stage.pin-clients
+	SaveMaxRows   uint            // config.stage.save-limits.max-rows
+	SaveMaxMemory uint64          // config.stage.save-limits.max-memory
+	Handoff       bool            // config.stage.handoff
 }
 
 // ClientGroup is a runnable group of clients created from a config.ClientGroup.
@@ -41,6 +65,24 @@ type ClientGroup struct {
 	Runtime   time.Duration // used by Stage to create a single ctx for all clients in the group
 	DataLimit bool
 	Clients   []*client.Client
+
+	// StartAfter is workload.start-after from the first client group in the exec
+	// group. If Concurrent is true (start-after is set), Stage starts the exec
+	// group StartAfter after the stage starts, concurrently with other exec groups.
+	StartAfter time.Duration
+	Concurrent bool
+
+	// DB is the connection pool for all clients in the group. Its DSN is DBKey
+	// (dbconn.HandoffKey). Taken is true if it was kept by the previous stage
+	// (config.stage.handoff), so it has idle connections for the clients.
+	DB    *sql.DB `deep:"-"`
+	DBKey string  `deep:"-"` // has password: don't print
+	Taken bool
+
+	// Generators are the data generators used by each client (same index as
+	// Clients), in statement order. Clients that share a generator (data scope
+	// above client) have the same Id. This is used by Allocation.
+	Generators [][]data.Id `deep:"-"`
 }
 
 // Group is allocation call 1 of 2 that returns a key for Clients to access
@@ -90,6 +132,10 @@ func (a *Allocator) Groups() ([][]int, error) {
 		prev = a.Workload[i].Group
 	}
 
+	if len(a.SpreadTargets) > 0 {
+		a.Workload = a.spread(a.Workload)
+	}
+
 	// Group client groups by name to form exec groups.
 	groups := [][]int{}
 	groupNo := -1
@@ -140,8 +186,18 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 		execGroupTPS := limit.And(a.StageTPS, limit.NewRate(finch.Uint(cgFirst.TPSExecGroup)))
 
 		clients[egNo] = make([]ClientGroup, len(groups[egNo]))
+		startAfter, _ := time.ParseDuration(cgFirst.StartAfter) // already validated
 
 		var execGroupIterPtr uint32
+		var cpus []int // config.stage.pin-clients: client.CPUs
+		if a.PinClients {
+			cpus = client.CPUs()
+		}
+		nCPU := 0                 // next in cpus, round-robin in the exec group
+		var execGroupClients uint // for client.IterChunk
+		for _, egRefNo := range groups[egNo] {
+			execGroupClients += finch.Uint(a.Workload[egRefNo].Clients)
+		}
 
 		for cgNo, egRefNo := range groups[egNo] { // ------------- CLIENT GROUP
 			finch.Debug("alloc %d/%d eg ref %d", egNo, cgNo, egRefNo)
@@ -154,36 +210,114 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 			nClients := finch.Uint(cg.Clients)
 			clients[egNo][cgNo].Clients = make([]*client.Client, nClients)
 			clients[egNo][cgNo].Runtime, _ = time.ParseDuration(cg.Runtime) // already validated
+			clients[egNo][cgNo].StartAfter = startAfter
+			clients[egNo][cgNo].Concurrent = cgFirst.StartAfter != ""
+			jitter, _ := time.ParseDuration(cg.StartJitter) // already validated
 
 			var clientsIterPtr uint32
 
-			db, _, err := dbconn.Make() // stage already validated connection
+			// Proxies route on the connection database, and ClickHouse over HTTP
+			// has no session, so set workload.db on connect instead of executing USE
+			defaultDb := cg.Db
+			dsnDb := ""
+			if a.Proxy && cg.Db != "" {
+				dsnDb = cg.Db
+				defaultDb = ""
+			}
+			// Take the connection pool kept by the previous stage, if any, for
+			// the same DSN (config.stage.handoff), else make a new one
+			dbKey, err := dbconn.HandoffKey(cg.Target, dsnDb)
 			if err != nil {
 				return nil, err
 			}
-			if finch.ModifyDB != nil {
-				finch.ModifyDB(db, runlevel)
+			db := dbconn.Take(dbKey)
+			taken := db != nil
+			if db == nil {
+				if dsnDb != "" {
+					db, _, err = dbconn.MakeDb(cg.Target, dsnDb)
+				} else {
+					db, _, err = dbconn.MakeTarget(cg.Target) // stage already validated connection
+				}
+				if err != nil {
+					return nil, err
+				}
+				if finch.ModifyDB != nil {
+					finch.ModifyDB(db, runlevel)
+				}
 			}
+			if taken || a.Handoff {
+				// Keep every client connection idle in the pool when the client
+				// closes it, not just the default 2, so it can be handed off
+				nConns := nClients
+				if n := finch.Uint(cg.Connections); n > 1 {
+					nConns *= n
+				}
+				if n := finch.Uint(cg.Pipeline); n > 1 {
+					nConns *= n
+				}
+				db.SetMaxIdleConns(int(nConns))
+			}
+			clients[egNo][cgNo].DB = db
+			clients[egNo][cgNo].DBKey = dbKey
+			clients[egNo][cgNo].Taken = taken
+			clients[egNo][cgNo].Generators = make([][]data.Id, nClients)
 
 			for k := uint(0); k < nClients; k++ { // ------------------- CLIENT
 				runlevel.Client = k + 1
 				c := &client.Client{
 					RunLevel:  runlevel,
 					DB:        db,         // *sql.DB
-					DefaultDb: cg.Db,      // default database
+					DefaultDb: defaultDb,  // default database
 					DoneChan:  a.DoneChan, // <- *Client
 					Iter:      finch.Uint(cg.Iter),
 					Stats:     make([]*stats.Trx, len(cg.Trx)), // Client requires slice but values can be nil
+
+					QueryComment: a.QueryComment,
+					RunId:        a.RunId,
+					QueryHint:    a.QueryHint,
+					Counters:     a.Counters,
+					Share:        a.Share,
+					Pause:        a.Pause,
+					Failover:     a.Failover,
+
+					ErrorHandling: a.ErrorHandling,
+					ClientPrepare: a.Proxy,
+					FastPath:      a.FastPath,
+					Clock:         a.Clock,
+					Pipeline:      finch.Uint(cg.Pipeline),
+					Connections:   finch.Uint(cg.Connections),
+					SaveMaxRows:   a.SaveMaxRows,
+					SaveMaxMemory: a.SaveMaxMemory,
+				}
+				if a.PinClients {
+					c.Pin = true
+					c.CPU = cpus[nCPU%len(cpus)]
+					nCPU++
+				}
+
+				// Trx weights: one trx per iteration chosen by weight
+				if len(cg.Weights) > 0 {
+					c.TrxWeights = make([]uint, len(cg.Weights))
+					for i, w := range cg.Weights {
+						c.TrxWeights[i] = finch.Uint(w)
+					}
+				}
+
+				// Random start delay [0, jitter) to stagger client start
+				if jitter > 0 {
+					c.StartDelay = time.Duration(rand.Int63n(int64(jitter)))
 				}
 
 				// Set combined limits, if any: iterations, QPS, TPS
 				if n := finch.Uint(cg.IterClients); n > 0 {
 					c.IterClients = uint32(n)
 					c.IterClientsPtr = &clientsIterPtr
+					c.IterClientsN = client.IterChunk(n, nClients)
 				}
 				if n := finch.Uint(cg.IterExecGroup); n > 0 {
 					c.IterExecGroup = uint32(n)
 					c.IterExecGroupPtr = &execGroupIterPtr
+					c.IterExecGroupN = client.IterChunk(n, execGroupClients)
 				}
 				if qps := limit.And(clientsQPS, limit.NewRate(finch.Uint(cg.QPS))); qps != nil {
 					c.QPS = qps.Allow()
@@ -204,6 +338,7 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 				finch.Debug("%s", runlevel.ClientId())
 
 				calledDataKeys := map[string]bool{}
+				gens := []data.Id{}
 				runlevel.Trx = 0
 				n = 0 // stmt number all trx
 
@@ -215,9 +350,13 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 					c.Data[n].TrxBoundary |= trx.BEGIN // finch trx file, not MySQL trx
 
 					// Stats for this trx if stage.stats=true and disable-status=false
-					// for this client group
+					// for this client group. Stats are separate per target: trx@target.
 					if withStats && !cg.DisableStats {
-						c.Stats[trxNo] = stats.NewTrx(trxName)
+						statsName := trxName
+						if cg.Target != "" {
+							statsName += "@" + cg.Target
+						}
+						c.Stats[trxNo] = stats.NewTrx(statsName)
 					}
 
 					for _, stmt := range a.TrxSet.Statements[trxName] { // STMT
@@ -229,6 +368,9 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 							c.Data[n].Inputs = []data.ValueFunc{}
 							for ino, dataKey := range stmt.Inputs {
 								if g := a.TrxSet.Data.Copy(dataKey, runlevel); g != nil {
+									gens = append(gens, g.Id())
+									// Client copies input values, so the generator can reuse its value slice
+									g.Reuse()
 									if stmt.Calls[ino] == 1 { // explicit call
 										c.Data[n].Inputs = append(c.Data[n].Inputs, g.Call)
 									} else { // call when scope changes, else copy
@@ -254,6 +396,7 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 								}
 								if g := a.TrxSet.Data.Copy(dataKey, runlevel); g != nil {
 									c.Data[n].Outputs[i] = g
+									gens = append(gens, g.Id())
 									finch.Debug("    output %s", g.Id().String())
 								}
 							}
@@ -262,6 +405,7 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 						if stmt.InsertId != "" {
 							g := a.TrxSet.Data.Copy(stmt.InsertId, runlevel)
 							c.Data[n].InsertId = g
+							gens = append(gens, g.Id())
 							finch.Debug("    insert-id %s", g.Id().String())
 						}
 
@@ -279,6 +423,7 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 				}
 
 				clients[egNo][cgNo].Clients[k] = c
+				clients[egNo][cgNo].Generators[k] = gens
 			} // client
 		} // client group
 	} // exec group
@@ -286,6 +431,37 @@ func (a *Allocator) Clients(groups [][]int, withStats bool) ([][]ClientGroup, er
 	return clients, nil
 }
 
+// spread returns the workload with each client group that has no target and no
+// DDL split into one client group per SpreadTargets, which are consecutive in
+// the same exec group. Clients are divided evenly, and the first targets get the
+// remainder. Limits per client group, like qps-clients, apply to each split
+// client group.
+func (a *Allocator) spread(cgs []config.ClientGroup) []config.ClientGroup {
+	spread := make([]config.ClientGroup, 0, len(cgs)*len(a.SpreadTargets))
+	k := uint(len(a.SpreadTargets))
+	for _, cg := range cgs {
+		if cg.Target != "" || a.hasDDL(cg.Trx) {
+			spread = append(spread, cg)
+			continue
+		}
+		n := finch.Uint(cg.Clients)
+		for i, target := range a.SpreadTargets {
+			m := n / k
+			if uint(i) < n%k {
+				m++
+			}
+			if m == 0 {
+				break // fewer clients than targets
+			}
+			split := cg
+			split.Clients = strconv.FormatUint(uint64(m), 10)
+			split.Target = target
+			spread = append(spread, split)
+		}
+	}
+	return spread
+}
+
 func (a *Allocator) AutoAssign() []config.ClientGroup {
 	cg := []config.ClientGroup{}
 	prevHasDDL := true
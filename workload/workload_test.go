@@ -3,9 +3,11 @@
 package workload_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/square/finch/client"
 	"github.com/square/finch/config"
 	"github.com/square/finch/data"
+	"github.com/square/finch/dbconn"
 	"github.com/square/finch/test/mock"
 	"github.com/square/finch/trx"
 	"github.com/square/finch/workload"
@@ -20,6 +23,8 @@ import (
 
 var p = map[string]string{}
 
+var cwd, _ = os.Getwd()
+
 func TestGroups_SetupOne(t *testing.T) {
 	mockValues := []interface{}{"hello"}
 	g := mock.DataGenerator{
@@ -125,6 +130,8 @@ func TestGroups_SetupOne(t *testing.T) {
 						Statements: []*trx.Statement{
 							{
 								Trx:       "001.sql",
+								File:      "../test/trx/001.sql",
+								Line:      1,
 								Query:     "select c from t where id=%d",
 								ResultSet: true,
 								Inputs:    []string{"@id"},
@@ -305,3 +312,276 @@ func TestGroups_ClientGroups(t *testing.T) {
 		}
 	}
 }
+
+func TestPlan(t *testing.T) {
+	os.Chdir(cwd) // TestGroups_ClientGroups changes dir
+	trxList := []config.Trx{
+		{
+			Name: "001.sql", // must set; Validate not called
+			File: "../test/trx/001.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "auto-inc",
+				},
+			},
+		},
+	}
+	set, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: "run",
+		TrxSet:    set,
+		Workload: []config.ClientGroup{
+			{
+				Clients: "4",
+				QPS:     "100",
+				Runtime: "10s",
+			},
+		},
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := a.Clients(groups, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	a.Plan(&buf, groups, clients)
+	expect := "  Exec group 1: dml1\n" +
+		"    Client group 1: 4 clients, runtime 10s, qps 100\n" +
+		"      trx: 001.sql (1 statements)\n" +
+		"  Data keys:\n" +
+		"    @id: auto-inc, scope statement, 001.sql line 1 statement 1\n"
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+}
+
+func TestAllocation(t *testing.T) {
+	os.Chdir(cwd) // TestGroups_ClientGroups changes dir
+	trxList := []config.Trx{
+		{
+			Name: "001.sql", // must set; Validate not called
+			File: "../test/trx/001.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "auto-inc",
+					Scope:     finch.SCOPE_CLIENT_GROUP,
+				},
+			},
+		},
+	}
+	set, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: "run",
+		TrxSet:    set,
+		Workload: []config.ClientGroup{
+			{
+				Clients:    "2",
+				QPSClients: "100",
+			},
+		},
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := a.Clients(groups, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both clients share the client-group scoped generator, and the client
+	// group limiter is combined with the stage limiter
+	got := a.Allocation(groups, clients, "500", "")
+	expect := workload.Allocation{
+		Stage:     1,
+		StageName: "run",
+		ExecGroups: []workload.ExecGroupAlloc{
+			{
+				N:    1,
+				Name: "dml1",
+				ClientGroups: []workload.ClientGroupAlloc{
+					{
+						N:   1,
+						Trx: []string{"001.sql"},
+						Clients: []workload.ClientAlloc{
+							{Id: "e1/g1/c1", Generators: []string{"@id(1)"}, QPS: "e1/g1/qps-clients"},
+							{Id: "e1/g1/c2", Generators: []string{"@id(1)"}, QPS: "e1/g1/qps-clients"},
+						},
+					},
+				},
+			},
+		},
+		Generators: []workload.GeneratorAlloc{
+			{Id: "@id(1)", Key: "@id", Type: "auto-inc", Scope: finch.SCOPE_CLIENT_GROUP, Clients: []string{"e1/g1/c1", "e1/g1/c2"}},
+		},
+		Limiters: []workload.LimiterAlloc{
+			{Id: "stage/qps", Option: "qps", Rate: "500"},
+			{Id: "e1/g1/qps-clients", Option: "qps-clients", Rate: "100", Parent: "stage/qps"},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestClients_Target(t *testing.T) {
+	os.Chdir(cwd)
+	trxList := []config.Trx{
+		{
+			Name: "001.sql", // must set; Validate not called
+			File: "../test/trx/001.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "auto-inc",
+				},
+			},
+		},
+	}
+	set, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbconn.SetConfig(config.MySQL{})
+	dbconn.SetTargets(map[string]config.MySQL{"replica": {Hostname: "replica"}})
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: "run",
+		TrxSet:    set,
+		Workload: []config.ClientGroup{
+			{Group: "g", Clients: "1"},
+			{Group: "g", Clients: "1", Target: "replica"},
+		},
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := a.Clients(groups, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{
+		clients[0][0].Clients[0].Stats[0].Name,
+		clients[0][1].Clients[0].Stats[0].Name,
+	}
+	expect := []string{"001.sql", "001.sql@replica"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestClients_StartJitter(t *testing.T) {
+	os.Chdir(cwd)
+	trxList := []config.Trx{
+		{
+			Name: "001.sql", // must set; Validate not called
+			File: "../test/trx/001.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "auto-inc",
+				},
+			},
+		},
+	}
+	set, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbconn.SetConfig(config.MySQL{})
+	jitter := 50 * time.Millisecond
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: "run",
+		TrxSet:    set,
+		Workload: []config.ClientGroup{
+			{Group: "g1", Clients: "100", StartJitter: jitter.String()},
+			{Group: "g2", Clients: "10"}, // no jitter
+		},
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := a.Clients(groups, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("got %d exec groups, expected 2", len(clients))
+	}
+	if n := len(clients[0][0].Clients); n != 100 {
+		t.Fatalf("got %d clients in g1, expected 100", n)
+	}
+	for _, c := range clients[0][0].Clients {
+		if c.StartDelay < 0 || c.StartDelay >= jitter {
+			t.Errorf("client %s: StartDelay %s not in [0, %s)", c.RunLevel.ClientId(), c.StartDelay, jitter)
+		}
+	}
+	for _, c := range clients[1][0].Clients {
+		if c.StartDelay != 0 {
+			t.Errorf("client %s: StartDelay %s, expected 0 without start-jitter", c.RunLevel.ClientId(), c.StartDelay)
+		}
+	}
+}
+
+func TestGroups_Spread(t *testing.T) {
+	os.Chdir(cwd)
+	trxList := []config.Trx{
+		{
+			Name: "001.sql", // must set; Validate not called
+			File: "../test/trx/001.sql",
+			Data: map[string]config.Data{
+				"id": {
+					Generator: "auto-inc",
+				},
+			},
+		},
+	}
+	set, err := trx.Load(trxList, data.NewScope(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := workload.Allocator{
+		Stage:     1,
+		StageName: "run",
+		TrxSet:    set,
+		Workload: []config.ClientGroup{
+			{Group: "g", Clients: "5"},
+			{Group: "g", Clients: "1", Target: "replica"},
+			{Group: "g", Clients: "1"},
+		},
+		SpreadTargets: []string{"h1:3306", "h2:3306"},
+	}
+	groups, err := a.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(groups, [][]int{{0, 1, 2, 3}}); diff != nil {
+		t.Error(diff)
+	}
+	got := make([]string, len(a.Workload))
+	for i, cg := range a.Workload {
+		got[i] = cg.Clients + "@" + cg.Target
+	}
+	expect := []string{"3@h1:3306", "2@h2:3306", "1@replica", "1@h1:3306"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}